@@ -0,0 +1,371 @@
+// Copyright (c) 2020 CyberAgent, Inc. All rights reserved.
+// https://github.com/openfresh/gosrt
+
+// Package capture records the messages received on a connection to a
+// file, with the times they arrived at and were produced at, and
+// replays them later at the same pace, to reproduce in the lab what a
+// receiver saw in the field.
+//
+// A capture file starts with an 8-byte magic and the time the capture
+// started, in nanoseconds since the Unix epoch. Each message follows
+// as a record of a flags byte, its arrival time and source time as
+// nanoseconds since the start, its message number and the sequence
+// number of its first packet, 4 bytes each, and its payload behind its
+// 4-byte length; all integers are big-endian. Files of the first
+// version of the format, whose records have no numbers, are read too.
+package capture
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"errors"
+	"io"
+	"math"
+	"time"
+
+	"github.com/openfresh/gosrt/srt"
+)
+
+// magic starts capture files, with the version of the format last.
+const (
+	magic   = "SRTCAP\x00\x02"
+	magicV1 = "SRTCAP\x00\x01"
+)
+
+// recordHeaderSize is the size of the fixed part of a record, and
+// recordHeaderSizeV1 that of the first version of the format.
+const (
+	recordHeaderSize   = 1 + 8 + 8 + 4 + 4 + 4
+	recordHeaderSizeV1 = 1 + 8 + 8 + 4
+)
+
+// Flags of records.
+const (
+	flagSourceTime = 0x01 // the record has a source time
+	flagMsgNo      = 0x02 // the record has a message and sequence number
+)
+
+// MaxPayload bounds the payloads of the records read, to reject
+// corrupt files before allocating for them.
+const MaxPayload = 16 << 20
+
+// Errors of reading capture files.
+var (
+	ErrFormat   = errors.New("capture: not a capture file")
+	ErrTooLarge = errors.New("capture: record too large")
+)
+
+// A Record is a message of a capture.
+type Record struct {
+	// Time is when the message was read.
+	Time time.Time
+
+	// SourceTime is when the sender produced the message, zero if
+	// unknown.
+	SourceTime time.Time
+
+	// MsgNo is the number of the message, and PktSeq the sequence
+	// number of its first packet, as srt.MsgCtrl has them, for gaps
+	// to tell of the messages dropped. MsgNo is 0 if they are unknown,
+	// SRT numbering messages from 1.
+	MsgNo  int32
+	PktSeq int32
+
+	Payload []byte
+}
+
+// A Writer writes a capture file.
+type Writer struct {
+	w     *bufio.Writer
+	start time.Time
+	err   error
+}
+
+// NewWriter writes the header of a capture starting now to w and
+// returns a Writer of its records.
+func NewWriter(w io.Writer) (*Writer, error) {
+	return newWriter(w, time.Now())
+}
+
+func newWriter(w io.Writer, start time.Time) (*Writer, error) {
+	// Times are stored on the wall clock, the only one that means
+	// something once the process is gone.
+	cw := &Writer{w: bufio.NewWriter(w), start: start.Round(0)}
+	var hdr [len(magic) + 8]byte
+	copy(hdr[:], magic)
+	binary.BigEndian.PutUint64(hdr[len(magic):], uint64(start.UnixNano()))
+	if _, err := cw.w.Write(hdr[:]); err != nil {
+		return nil, err
+	}
+	return cw, nil
+}
+
+// Write adds r to the capture. Records are buffered; Flush writes
+// them out.
+func (w *Writer) Write(r Record) error {
+	if w.err != nil {
+		return w.err
+	}
+	if len(r.Payload) > MaxPayload {
+		return ErrTooLarge
+	}
+	var hdr [recordHeaderSize]byte
+	binary.BigEndian.PutUint64(hdr[1:], uint64(r.Time.Sub(w.start)))
+	if !r.SourceTime.IsZero() {
+		hdr[0] |= flagSourceTime
+		binary.BigEndian.PutUint64(hdr[9:], uint64(r.SourceTime.Sub(w.start)))
+	}
+	if r.MsgNo != 0 {
+		hdr[0] |= flagMsgNo
+		binary.BigEndian.PutUint32(hdr[17:], uint32(r.MsgNo))
+		binary.BigEndian.PutUint32(hdr[21:], uint32(r.PktSeq))
+	}
+	binary.BigEndian.PutUint32(hdr[25:], uint32(len(r.Payload)))
+	if _, err := w.w.Write(hdr[:]); err != nil {
+		w.err = err
+		return err
+	}
+	if _, err := w.w.Write(r.Payload); err != nil {
+		w.err = err
+		return err
+	}
+	return nil
+}
+
+// Flush writes the buffered records out.
+func (w *Writer) Flush() error {
+	if w.err != nil {
+		return w.err
+	}
+	w.err = w.w.Flush()
+	return w.err
+}
+
+// A Reader reads a capture file.
+type Reader struct {
+	r     *bufio.Reader
+	start time.Time
+	v1    bool // of the first version of the format
+}
+
+// NewReader reads the header of the capture file r and returns a
+// Reader of its records.
+func NewReader(r io.Reader) (*Reader, error) {
+	cr := &Reader{r: bufio.NewReader(r)}
+	var hdr [len(magic) + 8]byte
+	if _, err := io.ReadFull(cr.r, hdr[:]); err != nil {
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			err = ErrFormat
+		}
+		return nil, err
+	}
+	switch string(hdr[:len(magic)]) {
+	case magic:
+	case magicV1:
+		cr.v1 = true
+	default:
+		return nil, ErrFormat
+	}
+	cr.start = time.Unix(0, int64(binary.BigEndian.Uint64(hdr[len(magic):])))
+	return cr, nil
+}
+
+// Start returns the time the capture started at.
+func (r *Reader) Start() time.Time { return r.start }
+
+// Next returns the next record, or io.EOF at the end of the capture.
+// A capture cut short, as one that was being written when its
+// recorder stopped, ends with io.ErrUnexpectedEOF.
+func (r *Reader) Next() (Record, error) {
+	var hdr [recordHeaderSize]byte
+	size := recordHeaderSize
+	if r.v1 {
+		size = recordHeaderSizeV1
+	}
+	if _, err := io.ReadFull(r.r, hdr[:size]); err != nil {
+		return Record{}, err
+	}
+	n := binary.BigEndian.Uint32(hdr[size-4:])
+	if n > MaxPayload {
+		return Record{}, ErrTooLarge
+	}
+	rec := Record{
+		Time:    r.start.Add(time.Duration(binary.BigEndian.Uint64(hdr[1:]))),
+		Payload: make([]byte, n),
+	}
+	if hdr[0]&flagSourceTime != 0 {
+		rec.SourceTime = r.start.Add(time.Duration(binary.BigEndian.Uint64(hdr[9:])))
+	}
+	if hdr[0]&flagMsgNo != 0 && !r.v1 {
+		rec.MsgNo = int32(binary.BigEndian.Uint32(hdr[17:]))
+		rec.PktSeq = int32(binary.BigEndian.Uint32(hdr[21:]))
+	}
+	if _, err := io.ReadFull(r.r, rec.Payload); err != nil {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return Record{}, err
+	}
+	return rec, nil
+}
+
+// A MessageReader reads messages with their source time and numbers,
+// as SRT connections do.
+type MessageReader interface {
+	ReadMessage() ([]byte, *srt.MsgCtrl, error)
+}
+
+// A SourceTimeReader reads messages with the time they were produced
+// at, as SRT connections do.
+type SourceTimeReader interface {
+	ReadWithSourceTime(b []byte) (int, time.Time, error)
+}
+
+// A SourceTimeWriter writes messages stamped with the time they were
+// produced at, as SRT connections do.
+type SourceTimeWriter interface {
+	WriteWithSourceTime(b []byte, t time.Time) (int, error)
+}
+
+// readSize is the size of the reads of Capture, enough for any
+// message.
+const readSize = 64 << 10
+
+// Capture reads messages from r and writes them to w until r fails,
+// and returns the number of records written. Source times and message
+// numbers are recorded when r is a MessageReader whose first read
+// succeeds, source times only when r is a SourceTimeReader whose first
+// read does; otherwise Capture reads plainly. Capture flushes w before
+// returning; it returns nil if r ended with io.EOF, otherwise the
+// error it ended with, such as that of a connection closed to stop
+// the capture.
+func Capture(w *Writer, r io.Reader) (int, error) {
+	mr, _ := r.(MessageReader)
+	str, _ := r.(SourceTimeReader)
+	b := make([]byte, readSize)
+	count := 0
+	for {
+		var (
+			n   int
+			src time.Time
+			ctl *srt.MsgCtrl
+			err error
+		)
+		if mr != nil {
+			var m []byte
+			m, ctl, err = mr.ReadMessage()
+			if err != nil && len(m) == 0 && count == 0 {
+				mr = nil
+				continue
+			}
+			n = copy(b, m)
+		} else if str != nil {
+			n, src, err = str.ReadWithSourceTime(b)
+			if err != nil && n == 0 && count == 0 {
+				// Libraries without source times fail the
+				// first read; a plain one may work.
+				str = nil
+				continue
+			}
+		} else {
+			n, err = r.Read(b)
+		}
+		if n > 0 {
+			rec := Record{Time: time.Now(), SourceTime: src, Payload: b[:n]}
+			if ctl != nil {
+				rec.SourceTime, rec.MsgNo, rec.PktSeq = ctl.SourceTime, ctl.MsgNo, ctl.PktSeq
+			}
+			if werr := w.Write(rec); werr != nil {
+				return count, werr
+			}
+			count++
+		}
+		if err != nil {
+			if ferr := w.Flush(); ferr != nil {
+				return count, ferr
+			}
+			if err == io.EOF {
+				err = nil
+			}
+			return count, err
+		}
+	}
+}
+
+// Replay writes the payloads of the records of r to w at the pace they
+// were captured at, until the capture ends or ctx is done, and returns
+// the number of records written. When w is a SourceTimeWriter, records
+// with a source time are written with one as old, at the time of
+// writing, as it was when captured, so the receiver paces them again
+// from their source times. If the first of these writes fails, as
+// with libraries without source times, Replay writes plainly instead.
+// It returns nil at the end of the capture.
+func Replay(ctx context.Context, w io.Writer, r *Reader) (int, error) {
+	return ReplaySpeed(ctx, w, r, 1)
+}
+
+// ReplaySpeed is like Replay, faster by a factor of speed. An infinite
+// speed writes the records as fast as w takes them.
+func ReplaySpeed(ctx context.Context, w io.Writer, r *Reader, speed float64) (int, error) {
+	if speed <= 0 {
+		return 0, errors.New("capture: speed must be positive")
+	}
+	stw, _ := w.(SourceTimeWriter)
+	var (
+		first time.Time // time of the first record
+		start time.Time // when it was replayed
+		count int
+		sent  bool // whether a write with source time succeeded
+	)
+	for {
+		rec, err := r.Next()
+		if err == io.EOF {
+			return count, nil
+		}
+		if err != nil {
+			return count, err
+		}
+		if count == 0 {
+			first, start = rec.Time, time.Now()
+		} else if !math.IsInf(speed, 1) {
+			at := start.Add(time.Duration(float64(rec.Time.Sub(first)) / speed))
+			if err := sleep(ctx, time.Until(at)); err != nil {
+				return count, err
+			}
+		}
+		if err := ctx.Err(); err != nil {
+			return count, err
+		}
+		if stw != nil && !rec.SourceTime.IsZero() {
+			age := time.Duration(float64(rec.Time.Sub(rec.SourceTime)) / speed)
+			_, err = stw.WriteWithSourceTime(rec.Payload, time.Now().Add(-age))
+			if err != nil && !sent {
+				// As in Capture, fall back to plain writes.
+				stw = nil
+				_, err = w.Write(rec.Payload)
+			}
+			sent = true
+		} else {
+			_, err = w.Write(rec.Payload)
+		}
+		if err != nil {
+			return count, err
+		}
+		count++
+	}
+}
+
+func sleep(ctx context.Context, d time.Duration) error {
+	if d <= 0 {
+		return nil
+	}
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-t.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
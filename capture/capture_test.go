@@ -0,0 +1,296 @@
+// Copyright (c) 2020 CyberAgent, Inc. All rights reserved.
+// https://github.com/openfresh/gosrt
+
+package capture
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"math"
+	"testing"
+	"time"
+
+	"github.com/openfresh/gosrt/srt"
+)
+
+func TestWriteRead(t *testing.T) {
+	start := time.Unix(1600000000, 0)
+	recs := []Record{
+		{Time: start.Add(10 * time.Millisecond), Payload: []byte("first")},
+		{Time: start.Add(20 * time.Millisecond), SourceTime: start.Add(5 * time.Millisecond), Payload: []byte("second")},
+		{Time: start.Add(30 * time.Millisecond), Payload: []byte{}},
+		{Time: start.Add(40 * time.Millisecond), MsgNo: 7, PktSeq: 0, Payload: []byte("numbered")},
+		{Time: start.Add(50 * time.Millisecond), MsgNo: 8, PktSeq: 0x7fffffff, Payload: []byte("last")},
+	}
+	var buf bytes.Buffer
+	w, err := newWriter(&buf, start)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, r := range recs {
+		if err := w.Write(r); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := w.Flush(); err != nil {
+		t.Fatal(err)
+	}
+
+	r, err := NewReader(bytes.NewReader(buf.Bytes()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !r.Start().Equal(start) {
+		t.Errorf("got start %v; want %v", r.Start(), start)
+	}
+	for i, want := range recs {
+		got, err := r.Next()
+		if err != nil {
+			t.Fatalf("record %d: %v", i, err)
+		}
+		if !got.Time.Equal(want.Time) || !got.SourceTime.Equal(want.SourceTime) || got.MsgNo != want.MsgNo || got.PktSeq != want.PktSeq || !bytes.Equal(got.Payload, want.Payload) {
+			t.Errorf("record %d: got %+v; want %+v", i, got, want)
+		}
+	}
+	if _, err := r.Next(); err != io.EOF {
+		t.Errorf("got %v at the end; want io.EOF", err)
+	}
+
+	// A capture cut in a record.
+	r, _ = NewReader(bytes.NewReader(buf.Bytes()[:buf.Len()-recordHeaderSize-2]))
+	for {
+		if _, err = r.Next(); err != nil {
+			break
+		}
+	}
+	if err != io.ErrUnexpectedEOF {
+		t.Errorf("got %v for a truncated capture; want io.ErrUnexpectedEOF", err)
+	}
+}
+
+func TestReadV1(t *testing.T) {
+	b := []byte("SRTCAP\x00\x01")
+	b = append(b, 0, 0, 0, 0, 0, 0, 0, 0) // started at the epoch
+	b = append(b, flagSourceTime, 0, 0, 0, 0, 0, 0, 0, 20, 0, 0, 0, 0, 0, 0, 0, 10, 0, 0, 0, 2, 'v', '1')
+	r, err := NewReader(bytes.NewReader(b))
+	if err != nil {
+		t.Fatal(err)
+	}
+	rec, err := r.Next()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rec.Time.UnixNano() != 20 || rec.SourceTime.UnixNano() != 10 || rec.MsgNo != 0 || string(rec.Payload) != "v1" {
+		t.Errorf("got %+v; want the record of the first format", rec)
+	}
+	if _, err := r.Next(); err != io.EOF {
+		t.Errorf("got %v at the end; want io.EOF", err)
+	}
+}
+
+func TestNewReaderFormat(t *testing.T) {
+	for _, b := range []string{"", "SRTCAP", "NOTACAPTURE12345"} {
+		if _, err := NewReader(bytes.NewReader([]byte(b))); err != ErrFormat {
+			t.Errorf("NewReader(%q) = %v; want ErrFormat", b, err)
+		}
+	}
+}
+
+// srcReader serves messages with source times, then fails.
+type srcReader struct {
+	msgs []string
+	src  time.Time
+	err  error
+}
+
+func (r *srcReader) Read(b []byte) (int, error) {
+	panic("Read called on a SourceTimeReader")
+}
+
+func (r *srcReader) ReadWithSourceTime(b []byte) (int, time.Time, error) {
+	if len(r.msgs) == 0 {
+		return 0, time.Time{}, r.err
+	}
+	n := copy(b, r.msgs[0])
+	r.msgs = r.msgs[1:]
+	return n, r.src, nil
+}
+
+func TestCapture(t *testing.T) {
+	src := time.Now().Add(-time.Second)
+	errClosed := errors.New("closed")
+	var buf bytes.Buffer
+	w, _ := NewWriter(&buf)
+	n, err := Capture(w, &srcReader{msgs: []string{"a", "bb", "ccc"}, src: src, err: errClosed})
+	if n != 3 || err != errClosed {
+		t.Fatalf("Capture = %d, %v; want 3, %v", n, err, errClosed)
+	}
+	r, err := NewReader(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{"a", "bb", "ccc"} {
+		rec, err := r.Next()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(rec.Payload) != want || !rec.SourceTime.Equal(src.Round(0)) {
+			t.Errorf("got %q from %v; want %q from %v", rec.Payload, rec.SourceTime, want, src)
+		}
+	}
+
+	// A plain reader, ending with io.EOF.
+	buf.Reset()
+	w, _ = NewWriter(&buf)
+	if n, err := Capture(w, bytes.NewReader([]byte("stream"))); n != 1 || err != nil {
+		t.Fatalf("Capture = %d, %v; want 1, nil", n, err)
+	}
+	r, _ = NewReader(&buf)
+	if rec, err := r.Next(); err != nil || string(rec.Payload) != "stream" || !rec.SourceTime.IsZero() {
+		t.Errorf("got %+v, %v; want the stream without source time", rec, err)
+	}
+}
+
+// msgReader serves messages with their MsgCtrl, then fails.
+type msgReader struct {
+	srcReader
+	msgno int32
+}
+
+func (r *msgReader) ReadMessage() ([]byte, *srt.MsgCtrl, error) {
+	if len(r.msgs) == 0 {
+		return nil, nil, r.err
+	}
+	m := []byte(r.msgs[0])
+	r.msgs = r.msgs[1:]
+	r.msgno++
+	return m, &srt.MsgCtrl{SourceTime: r.src, MsgNo: r.msgno, PktSeq: 100 + r.msgno}, nil
+}
+
+func (r *msgReader) ReadWithSourceTime(b []byte) (int, time.Time, error) {
+	panic("ReadWithSourceTime called on a MessageReader")
+}
+
+func TestCaptureMessages(t *testing.T) {
+	src := time.Now().Add(-time.Second)
+	var buf bytes.Buffer
+	w, _ := NewWriter(&buf)
+	n, err := Capture(w, &msgReader{srcReader: srcReader{msgs: []string{"a", "bb"}, src: src, err: io.EOF}})
+	if n != 2 || err != nil {
+		t.Fatalf("Capture = %d, %v; want 2, nil", n, err)
+	}
+	r, _ := NewReader(&buf)
+	for i, want := range []string{"a", "bb"} {
+		rec, err := r.Next()
+		if err != nil {
+			t.Fatal(err)
+		}
+		msgno := int32(i + 1)
+		if string(rec.Payload) != want || !rec.SourceTime.Equal(src.Round(0)) || rec.MsgNo != msgno || rec.PktSeq != 100+msgno {
+			t.Errorf("got %+v; want %q from %v, message %d at %d", rec, want, src, msgno, 100+msgno)
+		}
+	}
+}
+
+// noSrcReader is a SourceTimeReader of a library without source
+// times.
+type noSrcReader struct{ io.Reader }
+
+func (noSrcReader) ReadWithSourceTime(b []byte) (int, time.Time, error) {
+	return 0, time.Time{}, errors.New("operation not supported")
+}
+
+func TestCaptureNoSourceTime(t *testing.T) {
+	var buf bytes.Buffer
+	w, _ := NewWriter(&buf)
+	if n, err := Capture(w, noSrcReader{bytes.NewReader([]byte("plain"))}); n != 1 || err != nil {
+		t.Fatalf("Capture = %d, %v; want 1, nil", n, err)
+	}
+}
+
+// recorder collects what Replay writes and when.
+type recorder struct {
+	msgs  []string
+	times []time.Time
+	srcs  []time.Time
+}
+
+func (w *recorder) Write(b []byte) (int, error) {
+	w.msgs = append(w.msgs, string(b))
+	w.times = append(w.times, time.Now())
+	w.srcs = append(w.srcs, time.Time{})
+	return len(b), nil
+}
+
+type srcRecorder struct{ recorder }
+
+func (w *srcRecorder) WriteWithSourceTime(b []byte, t time.Time) (int, error) {
+	w.Write(b)
+	w.srcs[len(w.srcs)-1] = t
+	return len(b), nil
+}
+
+func capture(t *testing.T, recs ...Record) *Reader {
+	var buf bytes.Buffer
+	w, _ := newWriter(&buf, time.Unix(1600000000, 0))
+	for _, r := range recs {
+		w.Write(r)
+	}
+	w.Flush()
+	r, err := NewReader(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return r
+}
+
+func TestReplay(t *testing.T) {
+	start := time.Unix(1600000000, 0)
+	recs := []Record{
+		{Time: start, Payload: []byte("a")},
+		{Time: start.Add(100 * time.Millisecond), SourceTime: start.Add(60 * time.Millisecond), Payload: []byte("b")},
+		{Time: start.Add(200 * time.Millisecond), Payload: []byte("c")},
+	}
+	var w srcRecorder
+	begin := time.Now()
+	n, err := Replay(context.Background(), &w, capture(t, recs...))
+	if n != 3 || err != nil {
+		t.Fatalf("Replay = %d, %v; want 3, nil", n, err)
+	}
+	if d := time.Since(begin); d < 200*time.Millisecond || d > time.Second {
+		t.Errorf("replay took %v; want about 200ms", d)
+	}
+	if got := w.times[1].Sub(w.times[0]); got < 100*time.Millisecond {
+		t.Errorf("second record replayed %v after the first; want 100ms", got)
+	}
+	if !w.srcs[0].IsZero() || !w.srcs[2].IsZero() {
+		t.Errorf("records without source time replayed with %v, %v", w.srcs[0], w.srcs[2])
+	}
+	if age := w.times[1].Sub(w.srcs[1]); age < 40*time.Millisecond || age > 60*time.Millisecond {
+		t.Errorf("replayed source time %v old; want 40ms", age)
+	}
+}
+
+func TestReplaySpeed(t *testing.T) {
+	start := time.Unix(1600000000, 0)
+	recs := []Record{
+		{Time: start, Payload: []byte("a")},
+		{Time: start.Add(time.Hour), Payload: []byte("b")},
+	}
+	var w recorder
+	if n, err := ReplaySpeed(context.Background(), &w, capture(t, recs...), math.Inf(1)); n != 2 || err != nil {
+		t.Fatalf("ReplaySpeed = %d, %v; want 2, nil", n, err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	w = recorder{}
+	if n, err := ReplaySpeed(ctx, &w, capture(t, recs...), 10); n != 1 || err != context.DeadlineExceeded {
+		t.Errorf("ReplaySpeed = %d, %v; want 1, %v", n, err, context.DeadlineExceeded)
+	}
+	if _, err := ReplaySpeed(ctx, &w, capture(t, recs...), 0); err == nil {
+		t.Error("ReplaySpeed with speed 0 succeeded")
+	}
+}
@@ -0,0 +1,517 @@
+// Copyright (c) 2020 CyberAgent, Inc. All rights reserved.
+// https://github.com/openfresh/gosrt
+
+// Package dvr keeps the last minutes of a live stream received, as a
+// time-shift buffer: delayed readers play it out behind live, for
+// confidence monitoring, and Dump writes what it holds around an
+// incident to a capture file, to replay the ingest problem at once.
+//
+//	b, err := dvr.NewBuffer(dvr.Config{Window: 10 * time.Minute})
+//	go b.Record(conn)
+//
+//	r := b.NewReader(30 * time.Second)
+//	go r.Play(ctx, monitor)
+//
+//	w, _ := capture.NewWriter(f)
+//	b.Dump(ctx, w, incident.Add(-time.Minute), incident.Add(time.Minute))
+//
+// The buffer is held in memory, or in a directory as segment files in
+// the format of package capture, one every Config.Segment, which bounds
+// the memory of long windows to an index of the messages.
+package dvr
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/openfresh/gosrt/capture"
+)
+
+// Defaults of a Config left zero.
+const (
+	DefaultWindow  = time.Minute
+	DefaultSegment = 10 * time.Second
+)
+
+// segmentSuffix ends the names of the segment files.
+const segmentSuffix = ".srtcap"
+
+// readSize is the size of the reads of Record, enough for any message.
+const readSize = 64 << 10
+
+// ErrClosed is the error of writing to a closed Buffer.
+var ErrClosed = errors.New("dvr: buffer closed")
+
+// A Config configures a Buffer.
+type Config struct {
+	// Window is how long the messages are kept, DefaultWindow if 0.
+	Window time.Duration
+
+	// MaxBytes, if positive, bounds the payloads kept too, the oldest
+	// messages going first.
+	MaxBytes int64
+
+	// Dir, if set, is the directory that holds the messages, rather
+	// than memory, and Segment the span of each of its files,
+	// DefaultSegment if 0. The segment files left in Dir by an earlier
+	// Buffer are removed.
+	Dir     string
+	Segment time.Duration
+}
+
+// A Buffer keeps the messages written to it for the Window of its
+// Config. Its methods may be called concurrently.
+type Buffer struct {
+	cfg Config
+
+	mu      sync.Mutex
+	first   int64   // sequence number of entries[0]
+	entries []entry // oldest first
+	bytes   int64
+	evicted int64
+	changed chan struct{} // closed at the next change
+	closed  bool
+	err     error // of the disk
+
+	segs []*segment // on disk, oldest first
+	w    *capture.Writer
+	f    *os.File
+}
+
+// An entry is a message of the buffer; on disk, without its payload.
+type entry struct {
+	capture.Record
+	size int
+}
+
+// A segment is a file of the buffer on disk.
+type segment struct {
+	path  string
+	first int64 // sequence number of its first message
+	start time.Time
+}
+
+// A Stats are the counters of a Buffer.
+type Stats struct {
+	Messages int
+	Bytes    int64
+
+	// Oldest and Newest are the times the messages kept were written
+	// at, zero if there are none.
+	Oldest, Newest time.Time
+
+	// Evicted is the number of messages that left the buffer.
+	Evicted int64
+}
+
+// NewBuffer returns a Buffer of cfg. It only fails for a Dir it can't
+// use.
+func NewBuffer(cfg Config) (*Buffer, error) {
+	if cfg.Window <= 0 {
+		cfg.Window = DefaultWindow
+	}
+	if cfg.Segment <= 0 {
+		cfg.Segment = DefaultSegment
+	}
+	b := &Buffer{cfg: cfg, changed: make(chan struct{})}
+	if cfg.Dir != "" {
+		if err := os.MkdirAll(cfg.Dir, 0755); err != nil {
+			return nil, err
+		}
+		old, err := filepath.Glob(filepath.Join(cfg.Dir, "*"+segmentSuffix))
+		if err != nil {
+			return nil, err
+		}
+		for _, path := range old {
+			if err := os.Remove(path); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return b, nil
+}
+
+// Write adds p to the buffer as a message received now, so that a
+// Buffer may be the destination of an srt.FanOutWriter.
+func (b *Buffer) Write(p []byte) (int, error) {
+	if err := b.WriteRecord(capture.Record{Time: time.Now(), Payload: p}); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// WriteRecord adds r to the buffer, which evicts the messages older
+// than the Window before it, or beyond MaxBytes. The records must come
+// in time order. The payload of r is copied.
+func (b *Buffer) WriteRecord(r capture.Record) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.closed {
+		return ErrClosed
+	}
+	if b.err != nil {
+		return b.err
+	}
+	e := entry{Record: r, size: len(r.Payload)}
+	if b.cfg.Dir == "" {
+		e.Payload = append([]byte(nil), r.Payload...)
+	} else {
+		if err := b.writeDisk(r); err != nil {
+			b.err = err
+			return err
+		}
+		e.Payload = nil
+	}
+	b.entries = append(b.entries, e)
+	b.bytes += int64(e.size)
+	b.evict(r.Time)
+	close(b.changed)
+	b.changed = make(chan struct{})
+	return nil
+}
+
+// evict drops the messages older than the window at now, or beyond
+// MaxBytes, and the segments left without messages.
+func (b *Buffer) evict(now time.Time) {
+	n := 0
+	for n < len(b.entries)-1 && (now.Sub(b.entries[n].Time) > b.cfg.Window ||
+		b.cfg.MaxBytes > 0 && b.bytes > b.cfg.MaxBytes) {
+		b.bytes -= int64(b.entries[n].size)
+		b.entries[n] = entry{}
+		n++
+	}
+	b.entries = b.entries[n:]
+	b.first += int64(n)
+	b.evicted += int64(n)
+	for len(b.segs) > 1 && b.segs[1].first <= b.first {
+		os.Remove(b.segs[0].path)
+		b.segs = b.segs[1:]
+	}
+}
+
+// writeDisk appends r to the current segment file, starting another
+// one every Segment.
+func (b *Buffer) writeDisk(r capture.Record) error {
+	if b.w == nil || r.Time.Sub(b.segs[len(b.segs)-1].start) >= b.cfg.Segment {
+		if err := b.closeSegment(); err != nil {
+			return err
+		}
+		seq := b.first + int64(len(b.entries))
+		path := filepath.Join(b.cfg.Dir, fmt.Sprintf("%020d%s", seq, segmentSuffix))
+		f, err := os.Create(path)
+		if err != nil {
+			return err
+		}
+		w, err := capture.NewWriter(f)
+		if err != nil {
+			f.Close()
+			return err
+		}
+		b.f, b.w = f, w
+		b.segs = append(b.segs, &segment{path: path, first: seq, start: r.Time})
+	}
+	// Readers read the records written out only.
+	if err := b.w.Write(r); err != nil {
+		return err
+	}
+	return b.w.Flush()
+}
+
+func (b *Buffer) closeSegment() error {
+	if b.f == nil {
+		return nil
+	}
+	err := b.f.Close()
+	b.f, b.w = nil, nil
+	return err
+}
+
+// Record reads messages from r into the buffer until r fails, as
+// capture.Capture does, with their source times when r is a
+// capture.SourceTimeReader, and returns the number of messages. It
+// returns nil if r ended with io.EOF, otherwise its error, such as
+// that of a connection closed to stop the recording.
+func (b *Buffer) Record(r io.Reader) (int, error) {
+	str, _ := r.(capture.SourceTimeReader)
+	p := make([]byte, readSize)
+	count := 0
+	for {
+		var (
+			n   int
+			src time.Time
+			err error
+		)
+		if str != nil {
+			n, src, err = str.ReadWithSourceTime(p)
+			if err != nil && n == 0 && count == 0 {
+				// As with capture.Capture, a plain read may work.
+				str = nil
+				continue
+			}
+		} else {
+			n, err = r.Read(p)
+		}
+		if n > 0 {
+			if werr := b.WriteRecord(capture.Record{Time: time.Now(), SourceTime: src, Payload: p[:n]}); werr != nil {
+				return count, werr
+			}
+			count++
+		}
+		if err == io.EOF {
+			return count, nil
+		}
+		if err != nil {
+			return count, err
+		}
+	}
+}
+
+// Stats returns the counters of b.
+func (b *Buffer) Stats() Stats {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	s := Stats{Messages: len(b.entries), Bytes: b.bytes, Evicted: b.evicted}
+	if len(b.entries) > 0 {
+		s.Oldest, s.Newest = b.entries[0].Time, b.entries[len(b.entries)-1].Time
+	}
+	return s
+}
+
+// Close stops the buffer: writes fail with ErrClosed, and readers end
+// with io.EOF once they read the messages left. The segment files stay
+// until Remove, if the buffer is on disk, for the readers to finish.
+func (b *Buffer) Close() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.closed {
+		return ErrClosed
+	}
+	b.closed = true
+	close(b.changed)
+	return b.closeSegment()
+}
+
+// Remove removes the segment files of a closed buffer.
+func (b *Buffer) Remove() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if !b.closed {
+		return errors.New("dvr: buffer not closed")
+	}
+	var first error
+	for _, s := range b.segs {
+		if err := os.Remove(s.path); err != nil && first == nil {
+			first = err
+		}
+	}
+	b.segs = nil
+	return first
+}
+
+// seek returns the sequence number of the first message written at or
+// after t.
+func (b *Buffer) seek(t time.Time) int64 {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	i := sort.Search(len(b.entries), func(i int) bool { return !b.entries[i].Time.Before(t) })
+	return b.first + int64(i)
+}
+
+// A Reader reads the messages of a Buffer delayed, each once it is as
+// old as the delay. A Reader must not be used concurrently.
+type Reader struct {
+	b       *Buffer
+	delay   time.Duration
+	next    int64 // sequence number of the next message
+	skipped int64
+
+	// the segment file read, on disk, and the sequence number of the
+	// next record in it
+	seg *segment
+	f   *os.File
+	cr  *capture.Reader
+	pos int64
+}
+
+// NewReader returns a Reader of the messages of b delay behind live,
+// starting from the message written delay ago, or the oldest kept.
+func (b *Buffer) NewReader(delay time.Duration) *Reader {
+	return &Reader{b: b, delay: delay, next: b.seek(time.Now().Add(-delay))}
+}
+
+// Skipped returns the number of messages the reader missed, the buffer
+// having evicted them first.
+func (r *Reader) Skipped() int64 { return r.skipped }
+
+// Next returns the next message once it is as old as the delay of the
+// reader, waiting for it until ctx is done. It returns io.EOF once the
+// buffer is closed and the reader read all the messages. Messages kept
+// in memory share their payloads, which must not be modified.
+func (r *Reader) Next(ctx context.Context) (capture.Record, error) {
+	b := r.b
+	for {
+		b.mu.Lock()
+		if r.next < b.first {
+			r.skipped += b.first - r.next
+			r.next = b.first
+		}
+		if i := r.next - b.first; i < int64(len(b.entries)) {
+			e := b.entries[i]
+			b.mu.Unlock()
+			if err := sleep(ctx, time.Until(e.Time.Add(r.delay))); err != nil {
+				return capture.Record{}, err
+			}
+			rec, ok, err := r.read(e)
+			if err != nil {
+				return capture.Record{}, err
+			}
+			if !ok {
+				continue // evicted while waiting
+			}
+			r.next++
+			return rec, nil
+		}
+		ch, closed, err := b.changed, b.closed, b.err
+		b.mu.Unlock()
+		if err != nil {
+			return capture.Record{}, err
+		}
+		if closed {
+			return capture.Record{}, io.EOF
+		}
+		select {
+		case <-ctx.Done():
+			return capture.Record{}, ctx.Err()
+		case <-ch:
+		}
+	}
+}
+
+// read returns message r.next, e, reading its payload from disk if it
+// isn't in memory, or false if the buffer evicted it.
+func (r *Reader) read(e entry) (capture.Record, bool, error) {
+	b := r.b
+	b.mu.Lock()
+	if r.next < b.first {
+		b.mu.Unlock()
+		return capture.Record{}, false, nil
+	}
+	if b.cfg.Dir == "" {
+		b.mu.Unlock()
+		return e.Record, true, nil
+	}
+	i := sort.Search(len(b.segs), func(i int) bool { return b.segs[i].first > r.next }) - 1
+	seg := b.segs[i]
+	b.mu.Unlock()
+
+	if r.seg != seg || r.pos > r.next {
+		r.closeSegment()
+		f, err := os.Open(seg.path)
+		if os.IsNotExist(err) {
+			return capture.Record{}, false, nil
+		}
+		if err != nil {
+			return capture.Record{}, false, err
+		}
+		cr, err := capture.NewReader(f)
+		if err != nil {
+			f.Close()
+			return capture.Record{}, false, err
+		}
+		r.seg, r.f, r.cr, r.pos = seg, f, cr, seg.first
+	}
+	for {
+		rec, err := r.cr.Next()
+		if err != nil {
+			r.closeSegment()
+			return capture.Record{}, false, err
+		}
+		r.pos++
+		if r.pos > r.next {
+			return rec, true, nil
+		}
+	}
+}
+
+func (r *Reader) closeSegment() {
+	if r.f != nil {
+		r.f.Close()
+	}
+	r.seg, r.f, r.cr = nil, nil, nil
+}
+
+// Close releases the segment file the reader has open.
+func (r *Reader) Close() error {
+	r.closeSegment()
+	return nil
+}
+
+// Play writes the payloads of the messages of r to w as Next returns
+// them, until ctx is done, w fails or the buffer is closed, which ends
+// it with nil, and returns the number of messages written.
+func (r *Reader) Play(ctx context.Context, w io.Writer) (int, error) {
+	count := 0
+	for ctx.Err() == nil {
+		rec, err := r.Next(ctx)
+		if err == io.EOF {
+			return count, nil
+		}
+		if err != nil {
+			return count, err
+		}
+		if _, err := w.Write(rec.Payload); err != nil {
+			return count, err
+		}
+		count++
+	}
+	return count, ctx.Err()
+}
+
+// Dump writes the messages of b written from from to to w, waiting for
+// those to come until to, or ctx is done, and returns their number.
+// The capture can be replayed with capture.Replay.
+func (b *Buffer) Dump(ctx context.Context, w *capture.Writer, from, to time.Time) (int, error) {
+	r := &Reader{b: b, next: b.seek(from)}
+	defer r.Close()
+	dctx, cancel := context.WithDeadline(ctx, to)
+	defer cancel()
+	count := 0
+	for {
+		rec, err := r.Next(dctx)
+		if err == io.EOF || err == context.DeadlineExceeded && ctx.Err() == nil {
+			break
+		}
+		if err != nil {
+			return count, err
+		}
+		if rec.Time.After(to) {
+			break
+		}
+		if err := w.Write(rec); err != nil {
+			return count, err
+		}
+		count++
+	}
+	return count, w.Flush()
+}
+
+func sleep(ctx context.Context, d time.Duration) error {
+	if d <= 0 {
+		return nil
+	}
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-t.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
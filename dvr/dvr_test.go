@@ -0,0 +1,267 @@
+// Copyright (c) 2020 CyberAgent, Inc. All rights reserved.
+// https://github.com/openfresh/gosrt
+
+package dvr
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/openfresh/gosrt/capture"
+)
+
+// fill writes n messages to b, one every step up to now, and returns
+// the time of the first.
+func fill(t *testing.T, b *Buffer, n int, step time.Duration) time.Time {
+	t.Helper()
+	start := time.Now().Add(-time.Duration(n-1) * step)
+	for i := 0; i < n; i++ {
+		rec := capture.Record{Time: start.Add(time.Duration(i) * step), Payload: []byte(fmt.Sprintf("%03d", i))}
+		if err := b.WriteRecord(rec); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return start
+}
+
+func configs(t *testing.T, cfg Config) map[string]Config {
+	disk := cfg
+	disk.Dir = t.TempDir()
+	disk.Segment = time.Second
+	return map[string]Config{"memory": cfg, "disk": disk}
+}
+
+func TestWindow(t *testing.T) {
+	for name, cfg := range configs(t, Config{Window: 10 * time.Second}) {
+		t.Run(name, func(t *testing.T) {
+			b, err := NewBuffer(cfg)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer b.Close()
+			fill(t, b, 200, 100*time.Millisecond)
+			s := b.Stats()
+			if s.Messages != 101 || s.Evicted != 99 {
+				t.Errorf("got %d messages, %d evicted; want 101, 99", s.Messages, s.Evicted)
+			}
+			if d := s.Newest.Sub(s.Oldest); d != 10*time.Second {
+				t.Errorf("got a span of %v; want 10s", d)
+			}
+			if s.Bytes != 3*int64(s.Messages) {
+				t.Errorf("got %d bytes; want %d", s.Bytes, 3*s.Messages)
+			}
+			if cfg.Dir != "" {
+				// 10s of segments, and the one the oldest message is in.
+				if n := len(segments(t, cfg.Dir)); n != 11 {
+					t.Errorf("got %d segment files; want 11", n)
+				}
+			}
+		})
+	}
+}
+
+func TestMaxBytes(t *testing.T) {
+	b, _ := NewBuffer(Config{Window: time.Hour, MaxBytes: 100})
+	for i := 0; i < 50; i++ {
+		b.Write(make([]byte, 10))
+	}
+	if s := b.Stats(); s.Messages != 10 || s.Bytes != 100 {
+		t.Errorf("got %d messages of %d bytes; want 10 of 100", s.Messages, s.Bytes)
+	}
+	// The newest message stays, however large.
+	b.Write(make([]byte, 1000))
+	if s := b.Stats(); s.Messages != 1 {
+		t.Errorf("got %d messages; want 1", s.Messages)
+	}
+}
+
+func TestReader(t *testing.T) {
+	for name, cfg := range configs(t, Config{Window: time.Minute}) {
+		t.Run(name, func(t *testing.T) {
+			b, err := NewBuffer(cfg)
+			if err != nil {
+				t.Fatal(err)
+			}
+			fill(t, b, 50, 100*time.Millisecond)
+
+			// 550ms behind live, the reader starts with the message
+			// written 500ms ago and waits for the next ones.
+			ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+			defer cancel()
+			r := b.NewReader(550 * time.Millisecond)
+			defer r.Close()
+			for i := 44; i < 50; i++ {
+				rec, err := r.Next(ctx)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if string(rec.Payload) != fmt.Sprintf("%03d", i) {
+					t.Fatalf("got message %q; want %d", rec.Payload, i)
+				}
+				if age := time.Since(rec.Time); age < 550*time.Millisecond {
+					t.Errorf("message %d read %v old; want 550ms", i, age)
+				}
+			}
+
+			// Live messages come as old as the delay.
+			go func() {
+				time.Sleep(50 * time.Millisecond)
+				b.Write([]byte("live"))
+				b.Close()
+			}()
+			rec, err := r.Next(ctx)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(rec.Payload) != "live" || time.Since(rec.Time) < 550*time.Millisecond {
+				t.Errorf("got %q %v old", rec.Payload, time.Since(rec.Time))
+			}
+			if _, err := r.Next(ctx); err != io.EOF {
+				t.Errorf("got %v after Close; want io.EOF", err)
+			}
+			if err := b.WriteRecord(capture.Record{Time: time.Now()}); err != ErrClosed {
+				t.Errorf("got %v writing after Close; want ErrClosed", err)
+			}
+			if cfg.Dir != "" {
+				if err := b.Remove(); err != nil {
+					t.Fatal(err)
+				}
+				if n := len(segments(t, cfg.Dir)); n != 0 {
+					t.Errorf("got %d segment files after Remove", n)
+				}
+			}
+		})
+	}
+}
+
+func TestReaderSkipped(t *testing.T) {
+	for name, cfg := range configs(t, Config{Window: 2 * time.Second}) {
+		t.Run(name, func(t *testing.T) {
+			b, err := NewBuffer(cfg)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer b.Close()
+			fill(t, b, 10, 100*time.Millisecond)
+			r := b.NewReader(time.Hour)
+			defer r.Close()
+			// The window moves past the reader.
+			start := time.Now().Add(time.Hour)
+			for i := 0; i < 30; i++ {
+				b.WriteRecord(capture.Record{Time: start.Add(time.Duration(i) * 100 * time.Millisecond), Payload: []byte("late")})
+			}
+			ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+			defer cancel()
+			// The oldest message left, written an hour from now, isn't
+			// due for two hours.
+			if _, err := r.Next(ctx); err != context.DeadlineExceeded {
+				t.Fatalf("got %v; want the deadline", err)
+			}
+			if r.Skipped() != 19 {
+				t.Errorf("skipped %d messages; want 19", r.Skipped())
+			}
+		})
+	}
+}
+
+func TestDump(t *testing.T) {
+	for name, cfg := range configs(t, Config{Window: time.Minute}) {
+		t.Run(name, func(t *testing.T) {
+			b, err := NewBuffer(cfg)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer b.Close()
+			start := fill(t, b, 100, 10*time.Millisecond)
+			incident := start.Add(500 * time.Millisecond)
+
+			// Around an incident, with messages to come past it.
+			go func() {
+				time.Sleep(50 * time.Millisecond)
+				b.Write([]byte("after"))
+			}()
+			var buf bytes.Buffer
+			w, _ := capture.NewWriter(&buf)
+			n, err := b.Dump(context.Background(), w, incident.Add(-100*time.Millisecond), time.Now().Add(200*time.Millisecond))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if n != 61 {
+				t.Errorf("dumped %d messages; want 61", n)
+			}
+			cr, err := capture.NewReader(bytes.NewReader(buf.Bytes()))
+			if err != nil {
+				t.Fatal(err)
+			}
+			var got []string
+			for {
+				rec, err := cr.Next()
+				if err == io.EOF {
+					break
+				}
+				if err != nil {
+					t.Fatal(err)
+				}
+				got = append(got, string(rec.Payload))
+			}
+			if len(got) != 61 || got[0] != "040" || got[59] != "099" || got[60] != "after" {
+				t.Errorf("got %v", got)
+			}
+		})
+	}
+}
+
+func TestRecord(t *testing.T) {
+	b, _ := NewBuffer(Config{})
+	n, err := b.Record(&messages{msgs: []string{"a", "b", "c"}})
+	if err != nil || n != 3 {
+		t.Fatalf("recorded %d messages, %v; want 3", n, err)
+	}
+	s := b.Stats()
+	if s.Messages != 3 || s.Bytes != 3 {
+		t.Errorf("got %+v", s)
+	}
+}
+
+// messages reads a message at a time.
+type messages struct{ msgs []string }
+
+func (m *messages) Read(p []byte) (int, error) {
+	if len(m.msgs) == 0 {
+		return 0, io.EOF
+	}
+	n := copy(p, m.msgs[0])
+	m.msgs = m.msgs[1:]
+	return n, nil
+}
+
+func TestNewBufferRemovesSegments(t *testing.T) {
+	dir := t.TempDir()
+	other := filepath.Join(dir, "other")
+	ioutil.WriteFile(other, nil, 0644)
+	ioutil.WriteFile(filepath.Join(dir, "00000000000000000001"+segmentSuffix), nil, 0644)
+	if _, err := NewBuffer(Config{Dir: dir}); err != nil {
+		t.Fatal(err)
+	}
+	if n := len(segments(t, dir)); n != 0 {
+		t.Errorf("got %d segment files left", n)
+	}
+	if _, err := os.Stat(other); err != nil {
+		t.Error(err)
+	}
+}
+
+func segments(t *testing.T, dir string) []string {
+	names, err := filepath.Glob(filepath.Join(dir, "*"+segmentSuffix))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return names
+}
@@ -17,6 +17,7 @@ import (
 
 	"github.com/openfresh/gosrt/srt"
 	"github.com/openfresh/gosrt/srtapi"
+	"github.com/openfresh/gosrt/streamid"
 )
 
 func main() {
@@ -53,18 +54,13 @@ func main() {
 		if err != nil {
 			log.Fatal(err)
 		}
-		if strings.HasPrefix(streamID, "#!::") {
-			items := strings.Split(streamID[4:], ",")
-			for i := range items {
-				kv := strings.Split(items[i], "=")
-				if len(kv) == 2 && kv[0] == "u" {
-					username = kv[1]
-				}
-			}
-			if username == "" {
+		if strings.HasPrefix(streamID, streamid.Prefix) {
+			id, err := streamid.ParseID(streamID)
+			if err != nil || id.User == "" {
 				fmt.Println("USER NOT FOUND")
 				return -1
 			}
+			username = id.User
 		} else {
 			// By default the whole streamid is username
 			username = streamID
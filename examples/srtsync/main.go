@@ -0,0 +1,149 @@
+// Copyright (c) 2020 CyberAgent, Inc. All rights reserved.
+// https://github.com/openfresh/gosrt
+
+// Command srtsync mirrors a directory to another host over SRT,
+// resuming the files cut off and verifying what arrives.
+//
+// On the receiving host:
+//
+//	srtsync -listen :5000 -dir /srv/incoming
+//
+// On the sending host, once or every so often:
+//
+//	srtsync -state /var/lib/srtsync.json -every 10m ingest:5000 /var/media
+//
+// An srt:// URL of several endpoints, such as
+// srt://ingest:5000,ingest:5001?latency=500, sends over all of them at
+// once, in parts.
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"net"
+	"os"
+	"os/signal"
+	"strings"
+	"time"
+
+	"github.com/openfresh/gosrt/srt"
+	"github.com/openfresh/gosrt/srtfile"
+)
+
+func main() {
+	listen := flag.String("listen", "", "receive on `address` instead of sending")
+	dir := flag.String("dir", ".", "`directory` receiving the files")
+	checksum := flag.String("checksum", srtfile.ChecksumXXH64, "checksum of the files sent: xxh64, sha256 or none")
+	state := flag.String("state", "", "`file` keeping what was synced, to skip it next time")
+	every := flag.Duration("every", 0, "sync again after `interval`, rather than once")
+	progress := flag.Duration("progress", 0, "report the progress of each file every `interval`")
+	attempts := flag.Int("attempts", srtfile.DefaultSendAttempts, "connections made for a file before leaving it to the next sync")
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "usage: %s [flags] address directory\n       %s -listen address [-dir directory]\n", os.Args[0], os.Args[0])
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	sig := make(chan os.Signal, 1)
+	signal.Notify(sig, os.Interrupt)
+	go func() {
+		<-sig
+		cancel()
+	}()
+	defer srt.Shutdown()
+
+	if *listen != "" {
+		if flag.NArg() != 0 {
+			flag.Usage()
+			os.Exit(2)
+		}
+		receive(ctx, *listen, *dir)
+		return
+	}
+	if flag.NArg() != 2 {
+		flag.Usage()
+		os.Exit(2)
+	}
+	if *checksum == "none" {
+		*checksum = srtfile.ChecksumNone
+	}
+	s := &srtfile.Sender{Checksum: *checksum, Attempts: *attempts}
+	if *progress > 0 {
+		s.ProgressInterval = *progress
+		s.OnProgress = func(p srtfile.Progress) {
+			eta := "?"
+			if d := p.ETA(); d >= 0 {
+				eta = d.Round(time.Second).String()
+			}
+			fmt.Printf("  %s: %d/%d bytes acknowledged, %.0f kB/s, ETA %s\n", p.Name, p.Acked, p.Total, p.Rate/1000, eta)
+		}
+	}
+	address := flag.Arg(0)
+	if strings.HasPrefix(address, "srt://") {
+		u, err := srt.ParseGroupURL(address)
+		if err != nil {
+			log.Fatal(err)
+		}
+		if len(u.Endpoints) > 1 {
+			s.Links = srtfile.GroupLinks(nil, u)
+		}
+	}
+	s.Dial = func(ctx context.Context) (net.Conn, error) {
+		return srtfile.Dial(ctx, nil, address)
+	}
+	sy := &srtfile.Syncer{
+		Sender: s,
+		State:  *state,
+		OnProgress: func(p srtfile.SyncProgress) {
+			status := fmt.Sprintf("%d bytes sent", p.Result.Transferred())
+			if p.Err != nil {
+				status = p.Err.Error()
+			}
+			fmt.Printf("[%d/%d files, %d/%d bytes] %s: %s\n", p.FilesDone, p.Files, p.BytesDone, p.Bytes, p.Name, status)
+		},
+	}
+	for {
+		res, err := sy.Sync(ctx, flag.Arg(1))
+		fmt.Printf("%d files: %d synced, %d unchanged, %d failed, %d bytes sent\n", res.Files, res.Synced, res.Skipped, res.Failed, res.Transferred)
+		if err != nil && ctx.Err() == nil {
+			log.Print(err)
+		}
+		if *every <= 0 || ctx.Err() != nil {
+			if err != nil {
+				os.Exit(1)
+			}
+			return
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(*every):
+		}
+	}
+}
+
+func receive(ctx context.Context, address, dir string) {
+	ln, err := srtfile.Listen(ctx, address)
+	if err != nil {
+		log.Fatal(err)
+	}
+	r := &srtfile.Receiver{
+		Dir: dir,
+		OnReceive: func(res srtfile.Result, err error) {
+			if err != nil {
+				fmt.Printf("%s: %v\n", res.Name, err)
+				return
+			}
+			fmt.Printf("%s: %d of %d bytes received\n", res.Name, res.Transferred(), res.Size)
+		},
+		OnMismatch: func(m srtfile.Mismatch) {
+			fmt.Printf("%s: checksum mismatch at %d+%d\n", m.Name, m.Offset, m.Size)
+		},
+	}
+	if err := r.Serve(ctx, ln); err != nil && ctx.Err() == nil {
+		log.Fatal(err)
+	}
+}
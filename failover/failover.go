@@ -0,0 +1,259 @@
+// Copyright (c) 2020 CyberAgent, Inc. All rights reserved.
+// https://github.com/openfresh/gosrt
+
+// Package failover switches between redundant sources of a stream,
+// such as the SRT connections of a main and a backup encoder, reading
+// from the preferred source that is healthy.
+package failover
+
+import (
+	"errors"
+	"io"
+	"sync"
+	"time"
+)
+
+// ErrSilent is the error of a source that delivered nothing for the
+// Timeout of its Switcher.
+var ErrSilent = errors.New("failover: source silent")
+
+// Defaults of the Switcher fields left zero.
+const (
+	DefaultTimeout = time.Second
+	DefaultHoldoff = 5 * time.Second
+)
+
+// readSize is the size of the reads from the sources, enough for any
+// SRT live message.
+const readSize = 1500
+
+// An Event is a switch from one source to another.
+type Event struct {
+	Time     time.Time
+	From, To int   // indexes of the sources
+	Err      error // why From was left; nil when switching back to a preferred source
+}
+
+// A Switcher reads messages from the first of its sources that is
+// healthy: one that neither failed nor was silent for Timeout, nor
+// fails Check. When the source being read turns unhealthy, it switches
+// to the next healthy one at once, so the output misses at most the
+// Timeout; it switches back to a preferred source once that was
+// healthy for Holdoff. All the sources are read all the time, to keep
+// track of their health and not hold back their senders; the messages
+// of the sources not being read are dropped.
+//
+// The fields must be set before the first Read.
+type Switcher struct {
+	// Timeout is how long a source may deliver nothing before it is
+	// unhealthy. Zero means DefaultTimeout.
+	Timeout time.Duration
+
+	// Holdoff is how long a source must be healthy before it replaces
+	// a less preferred one. Zero means DefaultHoldoff; a negative
+	// Holdoff never switches back.
+	Holdoff time.Duration
+
+	// Check, if set, is called for each source several times per
+	// Timeout; a source it returns an error for is unhealthy. It lets
+	// thresholds on the statistics of a connection, such as its loss
+	// rate, trigger a switch.
+	Check func(source int) error
+
+	// OnSwitch, if set, is called from Read on every switch.
+	OnSwitch func(Event)
+
+	sources []io.Reader
+	once    sync.Once
+	msgs    chan message
+
+	mu      sync.Mutex
+	active  int
+	seen    []time.Time // last message of each source
+	errs    []error     // read errors
+	checks  []error     // Check results
+	healthy []time.Time // since when each source is healthy
+	waiting []bool      // sources waiting for Read
+	next    time.Time   // of the next checks
+}
+
+type message struct {
+	source int
+	data   []byte
+}
+
+// New returns a Switcher reading from sources, in the order of
+// preference.
+func New(sources ...io.Reader) *Switcher {
+	return &Switcher{sources: sources}
+}
+
+// Active returns the index of the source being read.
+func (s *Switcher) Active() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.active
+}
+
+func (s *Switcher) start() {
+	now := time.Now()
+	n := len(s.sources)
+	s.msgs = make(chan message)
+	s.seen = make([]time.Time, n)
+	s.errs = make([]error, n)
+	s.checks = make([]error, n)
+	s.healthy = make([]time.Time, n)
+	s.waiting = make([]bool, n)
+	for i := range s.sources {
+		// Give each source its Timeout to start.
+		s.seen[i], s.healthy[i] = now, now
+		go s.receive(i)
+	}
+}
+
+// setWaiting records whether source i waits for Read to take its
+// message, during which it can't be silent.
+func (s *Switcher) setWaiting(i int, waiting bool) {
+	s.mu.Lock()
+	s.waiting[i] = waiting
+	if !waiting {
+		s.seen[i] = time.Now()
+	}
+	s.mu.Unlock()
+}
+
+func (s *Switcher) receive(i int) {
+	buf := make([]byte, readSize)
+	for {
+		n, err := s.sources[i].Read(buf)
+		s.mu.Lock()
+		if n > 0 {
+			s.seen[i] = time.Now()
+		}
+		if err != nil {
+			s.errs[i] = err
+		}
+		active := s.active == i
+		s.mu.Unlock()
+		if n > 0 && active {
+			s.setWaiting(i, true)
+			s.msgs <- message{i, append([]byte(nil), buf[:n]...)}
+			s.setWaiting(i, false)
+		}
+		if err != nil {
+			// Wake Read up to notice.
+			select {
+			case s.msgs <- message{source: i}:
+			default:
+			}
+			return
+		}
+	}
+}
+
+// Read reads the next message of the active source into p. A message
+// longer than p is truncated. Read returns an error once every source
+// failed, that of the active one.
+func (s *Switcher) Read(p []byte) (int, error) {
+	s.once.Do(s.start)
+	for {
+		wait, err := s.update()
+		if err != nil {
+			return 0, err
+		}
+		t := time.NewTimer(wait)
+		select {
+		case m := <-s.msgs:
+			t.Stop()
+			if m.data != nil && m.source == s.Active() {
+				return copy(p, m.data), nil
+			}
+		case <-t.C:
+		}
+	}
+}
+
+// update switches sources as their health requires, and returns how
+// long to wait before checking them again.
+func (s *Switcher) update() (time.Duration, error) {
+	var events []Event
+	defer func() {
+		if s.OnSwitch != nil {
+			for _, e := range events {
+				s.OnSwitch(e)
+			}
+		}
+	}()
+	timeout := s.timeout()
+	interval := timeout / 4
+	now := time.Now()
+	if s.Check != nil && !now.Before(s.next) {
+		for i := range s.sources {
+			err := s.Check(i)
+			s.mu.Lock()
+			s.checks[i] = err
+			s.mu.Unlock()
+		}
+		s.next = now.Add(interval)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	dead := 0
+	for i := range s.sources {
+		if s.errs[i] != nil {
+			dead++
+		}
+		if s.health(i, now) != nil {
+			s.healthy[i] = time.Time{}
+		} else if s.healthy[i].IsZero() {
+			s.healthy[i] = now
+		}
+	}
+	if dead == len(s.sources) {
+		return 0, s.errs[s.active]
+	}
+	if err := s.health(s.active, now); err != nil {
+		for i := range s.sources {
+			if i != s.active && s.health(i, now) == nil {
+				events = append(events, Event{Time: now, From: s.active, To: i, Err: err})
+				s.active = i
+				break
+			}
+		}
+	} else if holdoff := s.holdoff(); holdoff >= 0 {
+		for i := 0; i < s.active; i++ {
+			if !s.healthy[i].IsZero() && now.Sub(s.healthy[i]) >= holdoff {
+				events = append(events, Event{Time: now, From: s.active, To: i})
+				s.active = i
+				break
+			}
+		}
+	}
+	return interval, nil
+}
+
+// health returns why source i is unhealthy, nil if it is healthy.
+func (s *Switcher) health(i int, now time.Time) error {
+	if s.errs[i] != nil {
+		return s.errs[i]
+	}
+	if !s.waiting[i] && now.Sub(s.seen[i]) >= s.timeout() {
+		return ErrSilent
+	}
+	return s.checks[i]
+}
+
+func (s *Switcher) timeout() time.Duration {
+	if s.Timeout > 0 {
+		return s.Timeout
+	}
+	return DefaultTimeout
+}
+
+func (s *Switcher) holdoff() time.Duration {
+	if s.Holdoff != 0 {
+		return s.Holdoff
+	}
+	return DefaultHoldoff
+}
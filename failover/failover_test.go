@@ -0,0 +1,145 @@
+// Copyright (c) 2020 CyberAgent, Inc. All rights reserved.
+// https://github.com/openfresh/gosrt
+
+package failover
+
+import (
+	"errors"
+	"io"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// source delivers its name every millisecond while on, and ends once
+// closed.
+type source struct {
+	name string
+	on   int32
+	done chan struct{}
+}
+
+func newSource(name string) *source {
+	return &source{name: name, on: 1, done: make(chan struct{})}
+}
+
+func (s *source) Read(b []byte) (int, error) {
+	for {
+		select {
+		case <-s.done:
+			return 0, io.EOF
+		case <-time.After(time.Millisecond):
+		}
+		if atomic.LoadInt32(&s.on) == 1 {
+			return copy(b, s.name), nil
+		}
+	}
+}
+
+func (s *source) set(on bool) {
+	v := int32(0)
+	if on {
+		v = 1
+	}
+	atomic.StoreInt32(&s.on, v)
+}
+
+// readUntil reads from s until it gets want, failing after a second.
+func readUntil(t *testing.T, s *Switcher, want string) {
+	t.Helper()
+	b := make([]byte, 10)
+	deadline := time.Now().Add(time.Second)
+	for time.Now().Before(deadline) {
+		n, err := s.Read(b)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(b[:n]) == want {
+			return
+		}
+	}
+	t.Fatalf("no message from %s", want)
+}
+
+func TestSwitcher(t *testing.T) {
+	main, backup := newSource("main"), newSource("backup")
+	defer close(main.done)
+	defer close(backup.done)
+	events := make(chan Event, 10)
+	s := New(main, backup)
+	s.Timeout = 40 * time.Millisecond
+	s.Holdoff = 100 * time.Millisecond
+	s.OnSwitch = func(e Event) { events <- e }
+
+	readUntil(t, s, "main")
+	main.set(false)
+	readUntil(t, s, "backup")
+	if e := <-events; e.From != 0 || e.To != 1 || e.Err != ErrSilent {
+		t.Errorf("got %+v; want a switch to the backup for silence", e)
+	}
+	main.set(true)
+	start := time.Now()
+	readUntil(t, s, "main")
+	if d := time.Since(start); d < s.Holdoff {
+		t.Errorf("switched back after %v; want at least %v", d, s.Holdoff)
+	}
+	if e := <-events; e.From != 1 || e.To != 0 || e.Err != nil {
+		t.Errorf("got %+v; want a switch back to the main source", e)
+	}
+}
+
+func TestSwitcherCheck(t *testing.T) {
+	main, backup := newSource("main"), newSource("backup")
+	defer close(main.done)
+	defer close(backup.done)
+	lossy := errors.New("too many losses")
+	var bad int32
+	events := make(chan Event, 10)
+	s := New(main, backup)
+	s.Timeout = 40 * time.Millisecond
+	s.Holdoff = -1
+	s.Check = func(i int) error {
+		if i == 0 && atomic.LoadInt32(&bad) == 1 {
+			return lossy
+		}
+		return nil
+	}
+	s.OnSwitch = func(e Event) { events <- e }
+
+	readUntil(t, s, "main")
+	atomic.StoreInt32(&bad, 1)
+	readUntil(t, s, "backup")
+	if e := <-events; e.Err != lossy {
+		t.Errorf("got %+v; want a switch for %v", e, lossy)
+	}
+	// A negative Holdoff keeps the backup.
+	atomic.StoreInt32(&bad, 0)
+	time.Sleep(100 * time.Millisecond)
+	readUntil(t, s, "backup")
+	if s.Active() != 1 {
+		t.Errorf("switched back to source %d", s.Active())
+	}
+}
+
+func TestSwitcherEnd(t *testing.T) {
+	main, backup := newSource("main"), newSource("backup")
+	s := New(main, backup)
+	readUntil(t, s, "main")
+	close(main.done)
+	// A failed source is left without waiting for the Timeout.
+	start := time.Now()
+	readUntil(t, s, "backup")
+	if d := time.Since(start); d >= DefaultTimeout {
+		t.Errorf("switched after %v; want no wait", d)
+	}
+	close(backup.done)
+	b := make([]byte, 10)
+	for {
+		if _, err := s.Read(b); err != nil {
+			if err != io.EOF {
+				t.Errorf("got %v; want %v", err, io.EOF)
+			}
+			break
+		}
+	}
+}
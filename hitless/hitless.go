@@ -0,0 +1,315 @@
+// Copyright (c) 2020 CyberAgent, Inc. All rights reserved.
+// https://github.com/openfresh/gosrt
+
+// Package hitless protects a stream by sending it over several SRT
+// connections at once, over diverse network paths, and merging the
+// copies on reception, in the manner of SMPTE ST 2022-7: a message
+// lost on one path is taken from another, duplicates are dropped, and
+// the receiver sees a single sequence.
+//
+// Writer numbers each message with a 4-byte sequence number ahead of
+// its payload, which Reader strips again; payloads must leave room
+// for it within the payload size of the connections. libsrt 1.5
+// broadcast groups do the same within the SRT library, for peers that
+// support them.
+package hitless
+
+import (
+	"encoding/binary"
+	"errors"
+	"io"
+	"sync"
+	"time"
+)
+
+// HeaderSize is the size of the sequence number ahead of each message.
+const HeaderSize = 4
+
+// ErrNoPath is returned by Writer when every path failed.
+var ErrNoPath = errors.New("hitless: no path left")
+
+// ErrClosed is returned by Reader once it is closed.
+var ErrClosed = errors.New("hitless: reader closed")
+
+// Writer sends each message written to it over every path.
+type Writer struct {
+	mu    sync.Mutex
+	paths []io.Writer
+	errs  []error
+	seq   uint32
+	buf   []byte
+}
+
+// NewWriter returns a Writer sending over the given paths, typically
+// SRT connections to the same receiver.
+func NewWriter(paths ...io.Writer) *Writer {
+	return &Writer{paths: paths, errs: make([]error, len(paths))}
+}
+
+// Write sends p as one message over every path still working. A path
+// whose write fails is given up; Write fails only once none is left,
+// with ErrNoPath.
+func (w *Writer) Write(p []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.buf = append(w.buf[:0], 0, 0, 0, 0)
+	binary.BigEndian.PutUint32(w.buf, w.seq)
+	w.buf = append(w.buf, p...)
+	w.seq++
+	ok := false
+	for i, path := range w.paths {
+		if w.errs[i] != nil {
+			continue
+		}
+		if _, err := path.Write(w.buf); err != nil {
+			w.errs[i] = err
+			continue
+		}
+		ok = true
+	}
+	if !ok {
+		return 0, ErrNoPath
+	}
+	return len(p), nil
+}
+
+// Err returns the error path i was given up with, nil if it works.
+func (w *Writer) Err(i int) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.errs[i]
+}
+
+// DefaultHold is the Hold of readers created by NewReader.
+const DefaultHold = 200 * time.Millisecond
+
+// maxPending bounds the messages Reader holds while waiting for a
+// missing one.
+const maxPending = 8192
+
+// readSize is the size of the reads from each path, enough for any
+// SRT live message.
+const readSize = 1500
+
+// Stats counts what a Reader did with the messages of its paths.
+type Stats struct {
+	Delivered  uint64 // messages returned by Read
+	Duplicates uint64 // copies dropped
+	Lost       uint64 // messages no path delivered in time
+	Repaired   uint64 // messages a path missed and another delivered
+}
+
+type pending struct {
+	data []byte
+	at   time.Time
+}
+
+// Reader merges the copies of a stream sent by a Writer over several
+// paths.
+type Reader struct {
+	hold  time.Duration
+	wake  chan struct{}
+	paths []io.Reader
+	wg    sync.WaitGroup // the goroutines reading the paths
+
+	mu      sync.Mutex
+	closed  bool
+	started bool
+	next    uint32
+	pending map[uint32]*pending
+	alive   int
+	err     error
+	stats   Stats
+	newest  []uint32 // per path, the sequence number after its newest message
+}
+
+// NewReader returns a Reader merging the messages read from the given
+// paths, waiting up to DefaultHold for a missing message.
+func NewReader(paths ...io.Reader) *Reader {
+	return NewReaderHold(DefaultHold, paths...)
+}
+
+// NewReaderHold returns a Reader merging the messages read from the
+// given paths. When a message is missing, it waits up to hold after
+// the next one arrived for some path to deliver it, then skips it. The
+// hold should cover the difference in delay between the paths.
+func NewReaderHold(hold time.Duration, paths ...io.Reader) *Reader {
+	r := &Reader{
+		hold:    hold,
+		wake:    make(chan struct{}, 1),
+		paths:   paths,
+		pending: map[uint32]*pending{},
+		alive:   len(paths),
+		newest:  make([]uint32, len(paths)),
+	}
+	r.wg.Add(len(paths))
+	for i, p := range paths {
+		go r.receive(i, p)
+	}
+	return r
+}
+
+func (r *Reader) receive(i int, path io.Reader) {
+	defer r.wg.Done()
+	buf := make([]byte, readSize)
+	for {
+		n, err := path.Read(buf)
+		if n >= HeaderSize {
+			r.add(i, binary.BigEndian.Uint32(buf), append([]byte(nil), buf[HeaderSize:n]...))
+		}
+		if err != nil {
+			r.mu.Lock()
+			r.alive--
+			if r.err == nil || r.err == io.EOF {
+				r.err = err
+			}
+			r.mu.Unlock()
+			r.signal()
+			return
+		}
+	}
+}
+
+func (r *Reader) add(i int, seq uint32, data []byte) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.closed {
+		return
+	}
+	if !r.started {
+		r.started = true
+		r.next = seq
+	}
+	if seqLess(seq, r.next) || r.pending[seq] != nil {
+		r.stats.Duplicates++
+		return
+	}
+	// A message older than what another path delivered already fills
+	// that path's gap.
+	for j, newest := range r.newest {
+		if j != i && seqLess(seq, newest) {
+			r.stats.Repaired++
+			break
+		}
+	}
+	if !seqLess(seq, r.newest[i]) {
+		r.newest[i] = seq + 1
+	}
+	r.pending[seq] = &pending{data: data, at: time.Now()}
+	if len(r.pending) > maxPending {
+		r.skip()
+	}
+	r.signal()
+}
+
+func (r *Reader) signal() {
+	select {
+	case r.wake <- struct{}{}:
+	default:
+	}
+}
+
+// Read reads the next message of the stream into p. A message longer
+// than p is truncated. Read returns io.EOF once every path ended, or
+// the error of the last path to fail, and ErrClosed once r is closed.
+func (r *Reader) Read(p []byte) (int, error) {
+	for {
+		r.mu.Lock()
+		if r.closed {
+			r.mu.Unlock()
+			return 0, ErrClosed
+		}
+		if m := r.pending[r.next]; m != nil {
+			delete(r.pending, r.next)
+			r.next++
+			r.stats.Delivered++
+			r.mu.Unlock()
+			return copy(p, m.data), nil
+		}
+		var wait time.Duration
+		if len(r.pending) > 0 {
+			if wait = r.hold - time.Since(r.oldest()); wait <= 0 {
+				r.skip()
+				r.mu.Unlock()
+				continue
+			}
+		} else if r.alive == 0 {
+			err := r.err
+			r.mu.Unlock()
+			return 0, err
+		}
+		r.mu.Unlock()
+
+		if wait > 0 {
+			t := time.NewTimer(wait)
+			select {
+			case <-r.wake:
+			case <-t.C:
+			}
+			t.Stop()
+		} else {
+			<-r.wake
+		}
+	}
+}
+
+// Close stops r, closes the paths that are io.Closers, SRT
+// connections say, and waits for the goroutines reading the paths to
+// return: those of paths that aren't io.Closers return once their path
+// ends. It returns the first error closing a path.
+func (r *Reader) Close() error {
+	r.mu.Lock()
+	if r.closed {
+		r.mu.Unlock()
+		return ErrClosed
+	}
+	r.closed = true
+	r.pending = nil
+	r.mu.Unlock()
+	r.signal()
+	var first error
+	for _, p := range r.paths {
+		if c, ok := p.(io.Closer); ok {
+			if err := c.Close(); err != nil && first == nil {
+				first = err
+			}
+		}
+	}
+	r.wg.Wait()
+	return first
+}
+
+// Stats returns the counts of the Reader so far.
+func (r *Reader) Stats() Stats {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.stats
+}
+
+// oldest returns when the earliest pending message arrived.
+func (r *Reader) oldest() time.Time {
+	var t time.Time
+	for _, m := range r.pending {
+		if t.IsZero() || m.at.Before(t) {
+			t = m.at
+		}
+	}
+	return t
+}
+
+// skip gives up on the messages missing before the first pending one.
+func (r *Reader) skip() {
+	first, found := r.next, false
+	for seq := range r.pending {
+		if !found || seqLess(seq, first) {
+			first, found = seq, true
+		}
+	}
+	r.stats.Lost += uint64(first - r.next)
+	r.next = first
+}
+
+// seqLess reports whether a comes before b, with wraparound.
+func seqLess(a, b uint32) bool {
+	return int32(a-b) < 0
+}
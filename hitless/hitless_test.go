@@ -0,0 +1,188 @@
+// Copyright (c) 2020 CyberAgent, Inc. All rights reserved.
+// https://github.com/openfresh/gosrt
+
+package hitless
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"testing"
+	"time"
+)
+
+// path carries messages like a message-mode connection, one per Read.
+type path chan []byte
+
+func (p path) Write(b []byte) (int, error) {
+	p <- append([]byte(nil), b...)
+	return len(b), nil
+}
+
+func (p path) Read(b []byte) (int, error) {
+	m, ok := <-p
+	if !ok {
+		return 0, io.EOF
+	}
+	return copy(b, m), nil
+}
+
+// lossy drops the messages whose payload is listed.
+type lossy struct {
+	w    io.Writer
+	drop map[string]bool
+}
+
+func (l lossy) Write(b []byte) (int, error) {
+	if l.drop[string(b[HeaderSize:])] {
+		return len(b), nil
+	}
+	return l.w.Write(b)
+}
+
+func readAll(t *testing.T, r *Reader) []string {
+	var got []string
+	b := make([]byte, 100)
+	for {
+		n, err := r.Read(b)
+		if err == io.EOF {
+			return got
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		got = append(got, string(b[:n]))
+	}
+}
+
+func TestHitless(t *testing.T) {
+	a, b := make(path, 100), make(path, 100)
+	w := NewWriter(
+		lossy{a, map[string]bool{"m1": true, "m2": true, "m7": true}},
+		lossy{b, map[string]bool{"m4": true, "m7": true}},
+	)
+	for i := 0; i < 10; i++ {
+		fmt.Fprintf(w, "m%d", i)
+	}
+	close(a)
+	close(b)
+
+	r := NewReaderHold(50*time.Millisecond, a, b)
+	got := readAll(t, r)
+	want := []string{"m0", "m1", "m2", "m3", "m4", "m5", "m6", "m8", "m9"}
+	if fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Errorf("got %v; want %v", got, want)
+	}
+	st := r.Stats()
+	if st.Delivered != 9 || st.Lost != 1 || st.Duplicates != 15-9 {
+		t.Errorf("got %+v; want 9 delivered, 1 lost, 6 duplicates", st)
+	}
+}
+
+// frames records the messages written.
+type frames [][]byte
+
+func (f *frames) Write(b []byte) (int, error) {
+	*f = append(*f, append([]byte(nil), b...))
+	return len(b), nil
+}
+
+func TestHitlessHold(t *testing.T) {
+	a, b := make(path, 10), make(path, 10)
+	var late frames
+	w := NewWriter(lossy{a, map[string]bool{"m1": true}}, &late)
+	r := NewReaderHold(time.Hour, a, b)
+	fmt.Fprint(w, "m0")
+	fmt.Fprint(w, "m1")
+	fmt.Fprint(w, "m2")
+
+	msg := make([]byte, 10)
+	for _, want := range []string{"m0", "m1", "m2"} {
+		if want == "m1" {
+			// Path b lags behind a: m1 must wait for it.
+			go func() {
+				time.Sleep(20 * time.Millisecond)
+				for _, f := range late {
+					b <- f
+				}
+				close(b)
+			}()
+		}
+		n, err := r.Read(msg)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(msg[:n]) != want {
+			t.Fatalf("got %q; want %q", msg[:n], want)
+		}
+	}
+	close(a)
+	if _, err := r.Read(msg); err != io.EOF {
+		t.Errorf("got %v; want %v", err, io.EOF)
+	}
+	if st := r.Stats(); st.Repaired != 1 || st.Lost != 0 || st.Duplicates != 2 {
+		t.Errorf("got %+v; want m1 repaired", st)
+	}
+}
+
+type failing struct{}
+
+func (failing) Write(b []byte) (int, error) { return 0, errors.New("down") }
+
+func TestWriterFailover(t *testing.T) {
+	a := make(path, 10)
+	w := NewWriter(failing{}, a)
+	if _, err := w.Write([]byte("m0")); err != nil {
+		t.Fatal(err)
+	}
+	if w.Err(0) == nil || w.Err(1) != nil {
+		t.Errorf("got errors %v, %v; want path 0 given up", w.Err(0), w.Err(1))
+	}
+	w = NewWriter(failing{})
+	if _, err := w.Write([]byte("m0")); err != ErrNoPath {
+		t.Errorf("got %v; want %v", err, ErrNoPath)
+	}
+}
+
+func TestSeqLess(t *testing.T) {
+	if !seqLess(0xffffffff, 0) || seqLess(0, 0xffffffff) || seqLess(1, 1) {
+		t.Error("seqLess doesn't wrap around")
+	}
+}
+
+func TestReaderClose(t *testing.T) {
+	ar, aw := io.Pipe()
+	br, bw := io.Pipe()
+	defer aw.Close()
+	defer bw.Close()
+	r := NewReader(ar, br)
+	read := make(chan error, 1)
+	go func() {
+		_, err := r.Read(make([]byte, 100))
+		read <- err
+	}()
+	closed := make(chan error, 1)
+	go func() { closed <- r.Close() }()
+	select {
+	case err := <-closed:
+		if err != nil {
+			t.Errorf("Close() = %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Close didn't stop the goroutines reading the paths")
+	}
+	select {
+	case err := <-read:
+		if err != ErrClosed {
+			t.Errorf("got %v; want %v", err, ErrClosed)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Read not unblocked by Close")
+	}
+	if _, err := aw.Write([]byte("late")); err != io.ErrClosedPipe {
+		t.Errorf("got %v writing to a path; want it closed", err)
+	}
+	if err := r.Close(); err != ErrClosed {
+		t.Errorf("second Close() = %v; want %v", err, ErrClosed)
+	}
+}
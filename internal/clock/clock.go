@@ -0,0 +1,47 @@
+// Copyright (c) 2020 CyberAgent, Inc. All rights reserved.
+// https://github.com/openfresh/gosrt
+
+// Package clock abstracts the time deadlines and periodic work are
+// measured with, so tests can substitute a Fake clock they advance
+// by hand and check timeouts instantly and deterministically.
+package clock
+
+import "time"
+
+// A Clock tells the time and runs timers.
+type Clock interface {
+	Now() time.Time
+	AfterFunc(d time.Duration, f func()) Timer
+	NewTicker(d time.Duration) Ticker
+}
+
+// A Timer is a timer started by AfterFunc.
+type Timer interface {
+	// Stop prevents the timer from firing, and reports whether it
+	// was pending.
+	Stop() bool
+}
+
+// A Ticker delivers the time on its channel at regular intervals,
+// dropping ticks for slow receivers.
+type Ticker interface {
+	C() <-chan time.Time
+	Stop()
+}
+
+// System is the clock of the time package.
+var System Clock = systemClock{}
+
+type systemClock struct{}
+
+func (systemClock) Now() time.Time { return time.Now() }
+
+func (systemClock) AfterFunc(d time.Duration, f func()) Timer { return time.AfterFunc(d, f) }
+
+func (systemClock) NewTicker(d time.Duration) Ticker { return systemTicker{time.NewTicker(d)} }
+
+type systemTicker struct{ t *time.Ticker }
+
+func (t systemTicker) C() <-chan time.Time { return t.t.C }
+
+func (t systemTicker) Stop() { t.t.Stop() }
@@ -0,0 +1,119 @@
+// Copyright (c) 2020 CyberAgent, Inc. All rights reserved.
+// https://github.com/openfresh/gosrt
+
+package clock
+
+import (
+	"sync"
+	"time"
+)
+
+// Fake is a Clock whose time only moves with Advance, which fires the
+// timers and tickers that fall due on the calling goroutine, in the
+// order of their times. Timers started with a duration of zero or
+// less fire at the next Advance.
+type Fake struct {
+	mu     sync.Mutex
+	now    time.Time
+	timers []*fakeTimer
+}
+
+type fakeTimer struct {
+	c      *Fake
+	when   time.Time
+	period time.Duration // of tickers
+	f      func()
+	ch     chan time.Time
+}
+
+// NewFake returns a Fake clock set at now.
+func NewFake(now time.Time) *Fake {
+	return &Fake{now: now}
+}
+
+// Now returns the time of the clock.
+func (c *Fake) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+// AfterFunc calls f once the clock advanced by d.
+func (c *Fake) AfterFunc(d time.Duration, f func()) Timer {
+	return c.add(&fakeTimer{c: c, when: c.Now().Add(d), f: f})
+}
+
+// NewTicker returns a Ticker ticking every d of the clock.
+func (c *Fake) NewTicker(d time.Duration) Ticker {
+	if d <= 0 {
+		panic("clock: non-positive interval for NewTicker")
+	}
+	return fakeTicker{c.add(&fakeTimer{c: c, when: c.Now().Add(d), period: d, ch: make(chan time.Time, 1)})}
+}
+
+func (c *Fake) add(t *fakeTimer) *fakeTimer {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.timers = append(c.timers, t)
+	return t
+}
+
+// Advance moves the clock forward by d.
+func (c *Fake) Advance(d time.Duration) {
+	c.mu.Lock()
+	end := c.now.Add(d)
+	for {
+		i := c.next(end)
+		if i < 0 {
+			break
+		}
+		t := c.timers[i]
+		if t.when.After(c.now) {
+			c.now = t.when
+		}
+		if t.period > 0 {
+			t.when = t.when.Add(t.period)
+			select {
+			case t.ch <- c.now:
+			default:
+			}
+			continue
+		}
+		c.timers = append(c.timers[:i], c.timers[i+1:]...)
+		c.mu.Unlock()
+		t.f()
+		c.mu.Lock()
+	}
+	c.now = end
+	c.mu.Unlock()
+}
+
+// next returns the index of the earliest timer due by end, -1 if none
+// is. c.mu must be held.
+func (c *Fake) next(end time.Time) int {
+	i := -1
+	for j, t := range c.timers {
+		if !t.when.After(end) && (i < 0 || t.when.Before(c.timers[i].when)) {
+			i = j
+		}
+	}
+	return i
+}
+
+func (t *fakeTimer) Stop() bool {
+	t.c.mu.Lock()
+	defer t.c.mu.Unlock()
+	for i, tt := range t.c.timers {
+		if tt == t {
+			t.c.timers = append(t.c.timers[:i], t.c.timers[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+type fakeTicker struct{ t *fakeTimer }
+
+func (t fakeTicker) C() <-chan time.Time { return t.t.ch }
+
+func (t fakeTicker) Stop() { t.t.Stop() }
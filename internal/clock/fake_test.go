@@ -0,0 +1,48 @@
+// Copyright (c) 2020 CyberAgent, Inc. All rights reserved.
+// https://github.com/openfresh/gosrt
+
+package clock
+
+import (
+	"testing"
+	"time"
+)
+
+func TestFake(t *testing.T) {
+	start := time.Unix(1000, 0)
+	c := NewFake(start)
+	var fired []time.Duration
+	record := func() { fired = append(fired, c.Now().Sub(start)) }
+	c.AfterFunc(3*time.Second, record)
+	c.AfterFunc(time.Second, record)
+	stopped := c.AfterFunc(2*time.Second, record)
+	if !stopped.Stop() || stopped.Stop() {
+		t.Error("Stop doesn't report the timer pending once")
+	}
+	tk := c.NewTicker(time.Second)
+	defer tk.Stop()
+
+	c.Advance(1500 * time.Millisecond)
+	if len(fired) != 1 || fired[0] != time.Second {
+		t.Fatalf("got %v; want a timer fired at 1s", fired)
+	}
+	if got := <-tk.C(); got != start.Add(time.Second) {
+		t.Errorf("got a tick at %v; want %v", got, start.Add(time.Second))
+	}
+	c.Advance(5 * time.Second)
+	if len(fired) != 2 || fired[1] != 3*time.Second {
+		t.Errorf("got %v; want timers fired at 1s and 3s", fired)
+	}
+	if got := c.Now(); got != start.Add(6500*time.Millisecond) {
+		t.Errorf("got %v; want %v", got, start.Add(6500*time.Millisecond))
+	}
+	// Ticks the receiver missed are dropped.
+	if got := <-tk.C(); got != start.Add(2*time.Second) {
+		t.Errorf("got a tick at %v; want the first one missed, at 2s", got)
+	}
+	select {
+	case got := <-tk.C():
+		t.Errorf("got a tick at %v; want the rest dropped", got)
+	default:
+	}
+}
@@ -0,0 +1,166 @@
+// Copyright (c) 2020 CyberAgent, Inc. All rights reserved.
+// https://github.com/openfresh/gosrt
+
+package native
+
+import (
+	"sync"
+	"time"
+)
+
+// CongestionControl paces the data packets a connection sends and
+// bounds those in flight, from what the acknowledgments and loss
+// reports of the peer tell of the path. Its methods are called with
+// the socket locked, so they must not block nor call back into the
+// package. Retransmissions are sent at once whatever it says, as
+// libsrt does in live mode.
+type CongestionControl interface {
+	// OnACK is called as the peer acknowledges acked more packets,
+	// with the round trip time it measured.
+	OnACK(acked int, rtt time.Duration)
+
+	// OnLoss is called as the peer reports lost packets missing.
+	OnLoss(lost int)
+
+	// Pacing returns the time to wait after sending a new packet of
+	// size payload bytes before sending the next one, 0 for none.
+	Pacing(size int) time.Duration
+
+	// Window returns the most packets sent and not acknowledged yet,
+	// 0 for no other bound than the send buffer.
+	Window() int
+}
+
+// CongestionParams describe the connection a CongestionControl is made
+// for.
+type CongestionParams struct {
+	PayloadSize int   // largest payload of a packet
+	MaxBW       int64 // OptMaxBW as the connection is made, in bytes per second; 0 or less for none
+	MaxWindow   int   // packets the send buffer holds
+}
+
+// A CongestionFactory makes the CongestionControl of a connection.
+type CongestionFactory func(CongestionParams) CongestionControl
+
+var (
+	ccmu       sync.Mutex
+	congestion = map[string]CongestionFactory{
+		"live": newLiveCC,
+		"file": newFileCC,
+	}
+)
+
+// RegisterCongestion makes f the congestion control named name, for
+// the sockets given it as OptCongestion. The built-in "live" and
+// "file" can't be replaced.
+func RegisterCongestion(name string, f CongestionFactory) error {
+	if name == "" || name == "live" || name == "file" || f == nil {
+		return EINVPARAM
+	}
+	ccmu.Lock()
+	defer ccmu.Unlock()
+	congestion[name] = f
+	return nil
+}
+
+func congestionFactory(name string) CongestionFactory {
+	ccmu.Lock()
+	defer ccmu.Unlock()
+	return congestion[name]
+}
+
+// packetOverhead is the bytes of the headers of a data packet on the
+// wire: SRT, UDP and IPv4.
+const packetOverhead = 16 + udpHeader
+
+// liveCC is the congestion control of live mode: the application sets
+// the rate, so it only paces the packets to OptMaxBW if it is set.
+type liveCC struct {
+	maxBW int64
+}
+
+func newLiveCC(p CongestionParams) CongestionControl {
+	return &liveCC{maxBW: p.MaxBW}
+}
+
+// A maxBWFollower is a CongestionControl following the changes of
+// OptMaxBW once the connection is made, as the built-in ones do.
+type maxBWFollower interface {
+	setMaxBW(bps int64)
+}
+
+func (cc *liveCC) setMaxBW(bps int64) { cc.maxBW = bps }
+
+func (cc *liveCC) OnACK(int, time.Duration) {}
+func (cc *liveCC) OnLoss(int)               {}
+func (cc *liveCC) Window() int              { return 0 }
+
+func (cc *liveCC) Pacing(size int) time.Duration {
+	if cc.maxBW <= 0 {
+		return 0
+	}
+	return time.Duration(int64(size+packetOverhead) * int64(time.Second) / cc.maxBW)
+}
+
+// fileCCInitialWindow is the window a fileCC starts with, that of
+// libsrt's file congestion control.
+const fileCCInitialWindow = 16
+
+// fileCC is a congestion control for bulk transfers, probing the path
+// for the rate it bears: its window grows by a packet for each one
+// acknowledged up to the first loss (slow start), then by a packet per
+// window, and halves on a loss, at most once a round trip. Like liveCC
+// it paces to OptMaxBW if it is set.
+type fileCC struct {
+	liveCC
+	window    float64
+	max       float64
+	slowStart bool
+	rtt       time.Duration
+	decreased time.Time // last time the window was halved
+}
+
+func newFileCC(p CongestionParams) CongestionControl {
+	cc := &fileCC{
+		liveCC:    liveCC{maxBW: p.MaxBW},
+		window:    fileCCInitialWindow,
+		max:       float64(p.MaxWindow),
+		slowStart: true,
+	}
+	if cc.max < 2 {
+		cc.max = 2
+	}
+	if cc.window > cc.max {
+		cc.window = cc.max
+	}
+	return cc
+}
+
+func (cc *fileCC) OnACK(acked int, rtt time.Duration) {
+	cc.rtt = rtt
+	if cc.slowStart {
+		cc.window += float64(acked)
+	} else {
+		cc.window += float64(acked) / cc.window
+	}
+	if cc.window > cc.max {
+		cc.window = cc.max
+	}
+}
+
+func (cc *fileCC) OnLoss(lost int) {
+	cc.slowStart = false
+	now := time.Now()
+	if now.Sub(cc.decreased) < cc.rtt {
+		return
+	}
+	cc.decreased = now
+	cc.window /= 2
+	if cc.window < 2 {
+		cc.window = 2
+	}
+}
+
+func (cc *fileCC) Window() int {
+	return int(cc.window)
+}
@@ -0,0 +1,23 @@
+// Copyright (c) 2020 CyberAgent, Inc. All rights reserved.
+// https://github.com/openfresh/gosrt
+
+package native
+
+import "time"
+
+// epoch is the origin of the clock of TimeNow.
+var epoch = time.Now()
+
+// TimeNow returns the current time in microseconds, on the monotonic
+// clock source times are given on, like srt_time_now.
+func TimeNow() int64 {
+	return int64(time.Since(epoch) / time.Microsecond)
+}
+
+func sinceEpoch(t time.Time) int64 {
+	return int64(t.Sub(epoch) / time.Microsecond)
+}
+
+func atEpoch(us int64) time.Time {
+	return epoch.Add(time.Duration(us) * time.Microsecond)
+}
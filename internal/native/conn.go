@@ -0,0 +1,705 @@
+// Copyright (c) 2020 CyberAgent, Inc. All rights reserved.
+// https://github.com/openfresh/gosrt
+
+package native
+
+import (
+	"net"
+	"sort"
+	"time"
+)
+
+// Timing of the periodic work of a connection.
+const (
+	tickInterval      = 10 * time.Millisecond // ACKs, drops and readiness
+	fullACKInterval   = 100 * time.Millisecond
+	keepaliveInterval = time.Second
+	minNAKInterval    = 20 * time.Millisecond
+	minSndDropDelay   = time.Second
+)
+
+type sndPkt struct {
+	p       *packet
+	origin  time.Time     // when the application sent it
+	ttl     time.Duration // how long it may be retransmitted, 0 for ever
+	track   bool          // reported to the DeliveryHandler
+	dropped bool          // given up on for its TTL
+}
+
+type rcvPkt struct {
+	data  []byte
+	ts    int64 // unwrapped timestamp of the sender, in microseconds
+	msgno uint32
+	drop  bool // given up by the sender
+}
+
+// conn is the live mode transport of a connected socket: the send
+// buffer kept for retransmissions, and the receive buffer releasing
+// packets at their TSBPD play time. Every method must be called with
+// s.mu held.
+type conn struct {
+	s           *socket
+	flags       uint32 // negotiated HSREQ flags
+	payloadSize int
+	rcvLatency  time.Duration
+	sndLatency  time.Duration
+	timer       *time.Timer
+	stopped     bool
+
+	// TSBPD time base: the local time at which the peer's clock read 0,
+	// and the last timestamp seen, to unwrap the 32-bit timestamps.
+	peerStart time.Time
+	lastTS    int64
+
+	// sender
+	sndBuf    []*sndPkt // unacknowledged packets, in sequence order
+	sndCap    int
+	sndNext   uint32
+	msgno     uint32
+	unsent    int // packets at the end of sndBuf held back by cc
+	cc        CongestionControl
+	nextSend  time.Time // when cc lets the next new packet go
+	paceTimer *time.Timer
+
+	// encryption, with the key refresh of each direction
+	snd, rcv      *cryptoCtx
+	sndKK         uint8 // key encrypting new packets
+	kmCount       int   // packets sent with it
+	kmRefresh     int
+	kmPreAnnounce int
+	kmPending     []byte // KMREQ the peer hasn't answered
+	kmSent        time.Time
+	kmRetries     int
+	rcvAnnounced  uint8 // key announced by the peer but not used yet
+
+	// receiver
+	rcvBase  uint32 // next sequence number to deliver
+	rcvNext  uint32 // one past the highest sequence number received
+	rcvBuf   map[uint32]*rcvPkt
+	rcvCap   int
+	loss     map[uint32]time.Time // missing packets and when they were last reported
+	gaps     []Gap                // the latest gaps, oldest first
+	nGaps    int64                // gaps found since the connection started
+	gapPkts  int64                // packets missing in them
+	ackNo    uint32
+	ackTimes map[uint32]time.Time // when each full ACK was sent
+	lastACK  uint32
+	ackTime  time.Time
+	nakTime  time.Time
+
+	rtt, rttVar time.Duration
+	lastRecv    time.Time
+	lastSend    time.Time
+
+	stats, interval counters
+	statsStart      time.Time
+}
+
+// counters are the statistics kept by a connection.
+type counters struct {
+	pktSent, pktRecv       int64
+	pktSndLoss, pktRcvLoss int64
+	pktRetrans, pktRcvRetr int64
+	pktSndDrop, pktRcvDrop int64
+	pktRcvBelated          int64
+	pktRcvUndecrypt        int64
+	byteSent, byteRecv     int64
+	byteSndDrop            int64
+	byteRcvDrop            int64
+}
+
+func newConn(s *socket, now time.Time, peerTS uint32, flags uint32, rcvLatency, sndLatency time.Duration, cc *cryptoCtx) *conn {
+	mss := s.opts.mss - udpHeader
+	c := &conn{
+		s:           s,
+		flags:       flags,
+		payloadSize: s.opts.payloadSize,
+		rcvLatency:  rcvLatency,
+		sndLatency:  sndLatency,
+		peerStart:   now.Add(-time.Duration(peerTS) * time.Microsecond),
+		lastTS:      int64(peerTS),
+		sndCap:      maxInt(s.opts.sndBuf/mss, 2),
+		sndNext:     s.isn,
+		rcvBase:     s.isn,
+		rcvNext:     s.isn,
+		rcvBuf:      map[uint32]*rcvPkt{},
+		rcvCap:      maxInt(minInt(s.opts.rcvBuf/mss, s.opts.fc), 2),
+		loss:        map[uint32]time.Time{},
+		ackTimes:    map[uint32]time.Time{},
+		lastACK:     s.isn,
+		ackTime:     now,
+		nakTime:     now,
+		rtt:         100 * time.Millisecond,
+		rttVar:      50 * time.Millisecond,
+		lastRecv:    now,
+		lastSend:    now,
+		statsStart:  now,
+	}
+	if c.payloadSize == 0 || c.payloadSize > s.opts.maxPayload() {
+		c.payloadSize = s.opts.maxPayload()
+	}
+	f := newLiveCC
+	if name, _ := s.opts.extra[OptCongestion].(string); congestionFactory(name) != nil {
+		f = congestionFactory(name)
+	}
+	maxBW, _ := s.opts.extra[OptMaxBW].(int64)
+	c.cc = f(CongestionParams{PayloadSize: c.payloadSize, MaxBW: maxBW, MaxWindow: c.sndCap})
+	if cc != nil {
+		// Both directions start with the handshake's key, and each
+		// sender refreshes its own.
+		c.snd, c.rcv, c.sndKK = cc, cc.clone(), kkEven
+		if !cc.has(kkEven) {
+			c.sndKK = kkOdd
+		}
+		c.kmRefresh, _ = toInt(s.opts.extra[OptKMRefreshRate])
+		c.kmPreAnnounce, _ = toInt(s.opts.extra[OptKMPreAnnounce])
+		if c.kmPreAnnounce < 1 || 2*c.kmPreAnnounce >= c.kmRefresh {
+			c.kmPreAnnounce = (c.kmRefresh - 1) / 2
+		}
+	}
+	c.timer = time.AfterFunc(tickInterval, c.tick)
+	return c
+}
+
+// stop ends the periodic work of c.
+func (c *conn) stop() {
+	c.stopped = true
+	c.timer.Stop()
+	if c.paceTimer != nil {
+		c.paceTimer.Stop()
+	}
+}
+
+func (c *conn) tick() {
+	s := c.s
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if c.stopped {
+		return
+	}
+	now := time.Now()
+	if idle := time.Duration(s.opts.peerIdle) * time.Millisecond; idle > 0 && now.Sub(c.lastRecv) > idle {
+		s.fail(ECONNLOST)
+		return
+	}
+	c.sendACK(now)
+	if c.flags&flagPERIODICNAK != 0 {
+		c.sendNAK(now)
+	}
+	c.dropOld(now)
+	c.retryKM(now)
+	if now.Sub(c.lastSend) >= keepaliveInterval {
+		c.sendCtrl(ctrlKeepalive, 0, nil)
+	}
+	// Packets reaching their play time make the socket readable.
+	s.update()
+	c.timer.Reset(tickInterval)
+}
+
+func (c *conn) sendCtrl(typ uint16, info uint32, cif []byte) {
+	c.s.mux.send(c.s.ctrlPacket(typ, info, c.s.peerID, cif), c.s.peer)
+	c.lastSend = time.Now()
+}
+
+// write queues p as a new message from origin and sends it as soon as
+// the congestion control lets it, reporting false if the send buffer is
+// full. The message number is c.msgno.
+func (c *conn) write(p []byte, now, origin time.Time, ttl time.Duration, track bool) bool {
+	if !c.writable() {
+		return false
+	}
+	c.msgno = msgInc(c.msgno)
+	pkt := &packet{
+		seq:     c.sndNext,
+		pp:      ppSolo,
+		msgno:   c.msgno,
+		ts:      c.s.timestamp(origin),
+		dst:     c.s.peerID,
+		payload: append([]byte(nil), p...),
+	}
+	if c.snd != nil {
+		c.encrypt(pkt, now)
+	}
+	c.sndNext = seqInc(c.sndNext)
+	c.sndBuf = append(c.sndBuf, &sndPkt{p: pkt, origin: now, ttl: ttl, track: track})
+	c.unsent++
+	c.pump(now)
+	return true
+}
+
+// pump sends the packets held back that the congestion control lets
+// go, and has the rest sent once their time comes, or as the peer
+// acknowledges some of those in flight.
+func (c *conn) pump(now time.Time) {
+	for c.unsent > 0 {
+		if w := c.cc.Window(); w > 0 && len(c.sndBuf)-c.unsent >= w {
+			return
+		}
+		if now.Before(c.nextSend) {
+			d := c.nextSend.Sub(now)
+			if c.paceTimer == nil {
+				c.paceTimer = time.AfterFunc(d, c.paced)
+			} else {
+				c.paceTimer.Reset(d)
+			}
+			return
+		}
+		sp := c.sndBuf[len(c.sndBuf)-c.unsent]
+		c.unsent--
+		c.s.mux.send(sp.p, c.s.peer)
+		c.lastSend = now
+		n := int64(len(sp.p.payload))
+		c.stats.pktSent++
+		c.stats.byteSent += n
+		c.interval.pktSent++
+		c.interval.byteSent += n
+		if d := c.cc.Pacing(len(sp.p.payload)); d > 0 {
+			if c.nextSend.Before(now) {
+				c.nextSend = now
+			}
+			c.nextSend = c.nextSend.Add(d)
+		}
+	}
+}
+
+func (c *conn) paced() {
+	s := c.s
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if !c.stopped {
+		c.pump(time.Now())
+	}
+}
+
+// trimmed keeps c.unsent within sndBuf once packets left it.
+func (c *conn) trimmed() {
+	if c.unsent > len(c.sndBuf) {
+		c.unsent = len(c.sndBuf)
+	}
+}
+
+func (c *conn) writable() bool {
+	return len(c.sndBuf) < c.sndCap
+}
+
+// find returns the index in sndBuf of the packet with sequence number
+// seq, or -1.
+func (c *conn) find(seq uint32) int {
+	if len(c.sndBuf) == 0 {
+		return -1
+	}
+	i := seqDiff(seq, c.sndBuf[0].p.seq)
+	if i < 0 || i >= len(c.sndBuf) {
+		return -1
+	}
+	return i
+}
+
+// dropOld gives up on the packets that couldn't be delivered in time
+// anyway, and tells the receiver not to wait for them.
+func (c *conn) dropOld(now time.Time) {
+	if c.flags&flagTLPKTDROP == 0 || len(c.sndBuf) == 0 {
+		return
+	}
+	threshold := c.sndLatency + time.Duration(c.s.opts.sndDropDelay)*time.Millisecond
+	if threshold < minSndDropDelay {
+		threshold = minSndDropDelay
+	}
+	threshold += 2 * tickInterval
+	n := 0
+	for n < len(c.sndBuf) && now.Sub(c.sndBuf[n].origin) > threshold {
+		n++
+	}
+	if n == 0 {
+		return
+	}
+	first, last := c.sndBuf[0].p, c.sndBuf[n-1].p
+	dropped := 0
+	for _, sp := range c.sndBuf[:n] {
+		if sp.dropped {
+			continue
+		}
+		dropped++
+		c.stats.byteSndDrop += int64(len(sp.p.payload))
+		if sp.track {
+			c.delivered(sp.p.msgno, false)
+		}
+	}
+	c.stats.pktSndDrop += int64(dropped)
+	c.interval.pktSndDrop += int64(dropped)
+	c.sndBuf = append(c.sndBuf[:0], c.sndBuf[n:]...)
+	c.trimmed()
+	cif := appendUint32(appendUint32(nil, first.seq), last.seq)
+	c.sendCtrl(ctrlDropReq, last.msgno, cif)
+	if dropped > 0 {
+		c.dropped(first.seq, last.seq, dropped, true)
+	}
+}
+
+// expire gives up on the packet sp, which outlived its TTL, rather
+// than retransmitting it. It stays in the send buffer until the
+// receiver, told to drop it too, acknowledges the packets after it.
+func (c *conn) expire(sp *sndPkt) {
+	sp.dropped = true
+	c.stats.pktSndDrop++
+	c.interval.pktSndDrop++
+	c.stats.byteSndDrop += int64(len(sp.p.payload))
+	cif := appendUint32(appendUint32(nil, sp.p.seq), sp.p.seq)
+	c.sendCtrl(ctrlDropReq, sp.p.msgno, cif)
+	c.dropped(sp.p.seq, sp.p.seq, 1, true)
+	if sp.track {
+		c.delivered(sp.p.msgno, false)
+	}
+}
+
+// retransmit sends again the packet with sequence number seq, if it is
+// still around and within its TTL.
+func (c *conn) retransmit(seq uint32) {
+	i := c.find(seq)
+	if i < 0 || i >= len(c.sndBuf)-c.unsent || c.sndBuf[i].dropped {
+		return
+	}
+	if sp := c.sndBuf[i]; sp.ttl > 0 && time.Since(sp.origin) > sp.ttl {
+		c.expire(sp)
+		return
+	}
+	p := *c.sndBuf[i].p
+	p.rexmit = c.flags&flagREXMITFLG != 0
+	c.s.mux.send(&p, c.s.peer)
+	c.lastSend = time.Now()
+	c.stats.pktRetrans++
+	c.interval.pktRetrans++
+}
+
+// input handles a packet from the peer.
+func (c *conn) input(p *packet, now time.Time) {
+	c.lastRecv = now
+	if !p.ctrl {
+		c.data(p, now)
+		return
+	}
+	switch p.typ {
+	case ctrlACK:
+		if p.info != 0 {
+			c.sendCtrl(ctrlACKACK, p.info, make([]byte, 4))
+		}
+		ack, ok := parseACK(p.payload)
+		if !ok {
+			return
+		}
+		n := 0
+		if i := c.find(ack.seq); i > 0 {
+			n = i
+		} else if i < 0 && len(c.sndBuf) > 0 && !seqLess(ack.seq, c.sndBuf[0].p.seq) {
+			n = len(c.sndBuf)
+		}
+		for _, sp := range c.sndBuf[:n] {
+			if sp.track && !sp.dropped {
+				c.delivered(sp.p.msgno, true)
+			}
+		}
+		c.sndBuf = append(c.sndBuf[:0], c.sndBuf[n:]...)
+		c.trimmed()
+		if ack.rtt != 0 {
+			c.rtt = time.Duration(ack.rtt) * time.Microsecond
+			c.rttVar = time.Duration(ack.rttVar) * time.Microsecond
+		}
+		if n > 0 {
+			c.cc.OnACK(n, c.rtt)
+			c.pump(now)
+		}
+	case ctrlACKACK:
+		sent, ok := c.ackTimes[p.info]
+		if !ok {
+			return
+		}
+		delete(c.ackTimes, p.info)
+		sample := now.Sub(sent)
+		d := c.rtt - sample
+		if d < 0 {
+			d = -d
+		}
+		c.rttVar = (3*c.rttVar + d) / 4
+		c.rtt = (7*c.rtt + sample) / 8
+	case ctrlNAK:
+		lost := 0
+		parseLossList(p.payload, len(c.sndBuf), func(seq uint32) {
+			lost++
+			c.stats.pktSndLoss++
+			c.interval.pktSndLoss++
+			c.retransmit(seq)
+		})
+		if lost > 0 {
+			c.cc.OnLoss(lost)
+		}
+	case ctrlDropReq:
+		if len(p.payload) < 8 {
+			return
+		}
+		first := uint32(p.payload[0])<<24 | uint32(p.payload[1])<<16 | uint32(p.payload[2])<<8 | uint32(p.payload[3])
+		last := uint32(p.payload[4])<<24 | uint32(p.payload[5])<<16 | uint32(p.payload[6])<<8 | uint32(p.payload[7])
+		c.dropRange(first&seqMask, last&seqMask)
+	case ctrlUser:
+		c.keyMaterial(p)
+	case ctrlShutdown:
+		c.s.fail(ECONNLOST)
+	}
+}
+
+// dropRange stops waiting for the packets the sender gave up on.
+func (c *conn) dropRange(first, last uint32) {
+	if seqLess(first, c.rcvBase) {
+		first = c.rcvBase
+	}
+	dropped := 0
+	now := time.Now()
+	for seq, n := first, 0; !seqLess(last, seq) && n < c.rcvCap; seq, n = seqInc(seq), n+1 {
+		if c.rcvBuf[seq] == nil {
+			c.rcvBuf[seq] = &rcvPkt{drop: true}
+			c.stats.pktRcvDrop++
+			c.interval.pktRcvDrop++
+			dropped++
+		}
+		if _, ok := c.loss[seq]; ok {
+			delete(c.loss, seq)
+			c.settleGap(seq, now, true)
+		}
+	}
+	if dropped > 0 {
+		c.dropped(first, last, dropped, false)
+	}
+	if !seqLess(last, c.rcvNext) {
+		c.rcvNext = seqInc(last)
+	}
+}
+
+// unwrap extends a 32-bit timestamp of the peer to 64 bits, taking the
+// one closest to the last timestamp seen.
+func (c *conn) unwrap(ts uint32) int64 {
+	t := c.lastTS + int64(int32(ts-uint32(c.lastTS)))
+	if t > c.lastTS {
+		c.lastTS = t
+	}
+	return t
+}
+
+func (c *conn) data(p *packet, now time.Time) {
+	seq := p.seq
+	ts := c.unwrap(p.ts)
+	if p.rexmit {
+		c.stats.pktRcvRetr++
+		c.interval.pktRcvRetr++
+	}
+	if seqLess(seq, c.rcvBase) || c.rcvBuf[seq] != nil {
+		c.stats.pktRcvBelated++
+		c.interval.pktRcvBelated++
+		return
+	}
+	if seqDiff(seq, c.rcvBase) >= c.rcvCap {
+		// No room; the sender will retransmit it.
+		return
+	}
+	if p.kk != kkNone && !c.decrypt(p) {
+		c.stats.pktRcvUndecrypt++
+		c.interval.pktRcvUndecrypt++
+		return
+	}
+	c.stats.pktRecv++
+	c.stats.byteRecv += int64(len(p.payload))
+	c.interval.pktRecv++
+	c.interval.byteRecv += int64(len(p.payload))
+	c.rcvBuf[seq] = &rcvPkt{data: p.payload, ts: ts, msgno: p.msgno}
+	if _, ok := c.loss[seq]; ok {
+		delete(c.loss, seq)
+		c.settleGap(seq, now, false)
+		return
+	}
+	if !seqLess(seq, c.rcvNext) {
+		if seq != c.rcvNext {
+			// Report the gap right away.
+			var lost []uint32
+			for s := c.rcvNext; s != seq; s = seqInc(s) {
+				c.loss[s] = now
+				lost = append(lost, s)
+			}
+			c.stats.pktRcvLoss += int64(len(lost))
+			c.interval.pktRcvLoss += int64(len(lost))
+			c.addGap(c.rcvNext, seqAdd(seq, -1), len(lost), now)
+			c.sendCtrl(ctrlNAK, 0, marshalLossList(lost))
+		}
+		c.rcvNext = seqInc(seq)
+	}
+}
+
+// sendACK acknowledges the packets received without a gap.
+func (c *conn) sendACK(now time.Time) {
+	ack := c.rcvNext
+	for seq := range c.loss {
+		if seqLess(seq, ack) {
+			ack = seq
+		}
+	}
+	if ack == c.lastACK && now.Sub(c.ackTime) < fullACKInterval {
+		return
+	}
+	c.ackNo++
+	if c.ackNo == 0 {
+		c.ackNo = 1
+	}
+	c.ackTimes[c.ackNo] = now
+	for no := range c.ackTimes {
+		if c.ackNo-no > 64 {
+			delete(c.ackTimes, no)
+		}
+	}
+	c.lastACK = ack
+	c.ackTime = now
+	d := ackData{
+		seq:    ack,
+		rtt:    uint32(c.rtt / time.Microsecond),
+		rttVar: uint32(c.rttVar / time.Microsecond),
+		avail:  uint32(maxInt(c.rcvCap-len(c.rcvBuf), 2)),
+	}
+	c.sendCtrl(ctrlACK, c.ackNo, d.marshal())
+}
+
+// sendNAK reports again the packets still missing.
+func (c *conn) sendNAK(now time.Time) {
+	interval := c.rtt + 4*c.rttVar
+	if interval < minNAKInterval {
+		interval = minNAKInterval
+	}
+	if len(c.loss) == 0 || now.Sub(c.nakTime) < interval {
+		return
+	}
+	c.nakTime = now
+	var lost []uint32
+	for seq, t := range c.loss {
+		if now.Sub(t) >= interval {
+			lost = append(lost, seq)
+			c.loss[seq] = now
+		}
+	}
+	if len(lost) == 0 {
+		return
+	}
+	sort.Slice(lost, func(i, j int) bool { return seqLess(lost[i], lost[j]) })
+	c.sendCtrl(ctrlNAK, 0, marshalLossList(lost))
+}
+
+// playTime returns when a packet with the peer timestamp ts is due.
+func (c *conn) playTime(ts int64) time.Time {
+	return c.peerStart.Add(time.Duration(ts)*time.Microsecond + c.rcvLatency)
+}
+
+// next returns the next packet to deliver at now, skipping the packets
+// given up on. If skip is set, it also skips missing packets whose
+// successors are already due. The returned sequence number is that of
+// the packet, which the caller removes.
+func (c *conn) next(now time.Time, skip bool) (uint32, *rcvPkt) {
+	for {
+		rp := c.rcvBuf[c.rcvBase]
+		if rp != nil && rp.drop {
+			delete(c.rcvBuf, c.rcvBase)
+			c.rcvBase = seqInc(c.rcvBase)
+			continue
+		}
+		if rp != nil {
+			if now.Before(c.playTime(rp.ts)) {
+				return 0, nil
+			}
+			return c.rcvBase, rp
+		}
+		if c.flags&flagTLPKTDROP == 0 || c.rcvBase == c.rcvNext {
+			return 0, nil
+		}
+		// Find the first packet received after the gap.
+		seq := seqInc(c.rcvBase)
+		for seq != c.rcvNext && (c.rcvBuf[seq] == nil || c.rcvBuf[seq].drop) {
+			seq = seqInc(seq)
+		}
+		if seq == c.rcvNext {
+			return 0, nil
+		}
+		rp = c.rcvBuf[seq]
+		if now.Before(c.playTime(rp.ts)) {
+			return 0, nil
+		}
+		if !skip {
+			return seq, rp
+		}
+		dropped := 0
+		for s := c.rcvBase; s != seq; s = seqInc(s) {
+			if c.rcvBuf[s] == nil {
+				c.stats.pktRcvDrop++
+				c.interval.pktRcvDrop++
+				dropped++
+			}
+			delete(c.rcvBuf, s)
+			if _, ok := c.loss[s]; ok {
+				delete(c.loss, s)
+				c.settleGap(s, now, true)
+			}
+		}
+		if dropped > 0 {
+			c.dropped(c.rcvBase, seqAdd(seq, -1), dropped, false)
+		}
+		c.rcvBase = seq
+	}
+}
+
+// read delivers the next message due into p, with what RecvMsg
+// reports of it, reporting false if there is none.
+func (c *conn) read(p []byte, now time.Time) (int, RecvInfo, bool) {
+	seq, rp := c.next(now, true)
+	if rp == nil {
+		return 0, RecvInfo{}, false
+	}
+	delete(c.rcvBuf, seq)
+	c.rcvBase = seqInc(seq)
+	origin := c.peerStart.Add(time.Duration(rp.ts) * time.Microsecond)
+	return copy(p, rp.data), RecvInfo{SrcTime: sinceEpoch(origin), Seq: seq, MsgNo: rp.msgno}, true
+}
+
+func (c *conn) readable(now time.Time) bool {
+	_, rp := c.next(now, false)
+	return rp != nil
+}
+
+// rcvCount returns the number of packets in the receive buffer.
+func (c *conn) rcvCount() int {
+	n := 0
+	for _, rp := range c.rcvBuf {
+		if !rp.drop {
+			n++
+		}
+	}
+	return n
+}
+
+// input handles a packet addressed to a caller or accepted socket.
+func (s *socket) input(p *packet, from *net.UDPAddr) {
+	now := time.Now()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.peer == nil || from.Port != s.peer.Port {
+		return
+	}
+	if !from.IP.Equal(s.peer.IP) {
+		// Dialing the unspecified address reaches the local host,
+		// which answers from one of its own addresses.
+		if s.state != StatusConnecting || !s.peer.IP.IsUnspecified() {
+			return
+		}
+	}
+	switch s.state {
+	case StatusConnecting:
+		if s.hs != nil && p.ctrl && p.typ == ctrlHandshake {
+			s.peer = from
+			s.callerInput(p, now)
+		}
+	case StatusConnected:
+		s.c.input(p, now)
+		s.update()
+	}
+}
@@ -0,0 +1,348 @@
+// Copyright (c) 2020 CyberAgent, Inc. All rights reserved.
+// https://github.com/openfresh/gosrt
+
+package native
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/subtle"
+	"encoding/binary"
+	"errors"
+	"hash"
+)
+
+// Key material states (SRTO_KMSTATE and friends).
+const (
+	KMUnsecured = 0
+	KMSecuring  = 1
+	KMSecured   = 2
+	KMNoSecret  = 3
+	KMBadSecret = 4
+)
+
+const (
+	pbkdf2Iter = 2048
+	saltSize   = 16
+)
+
+var (
+	errBadKM     = errors.New("malformed key material message")
+	errBadSecret = errors.New("key material does not match passphrase")
+)
+
+// pbkdf2 derives a key as in RFC 8018 section 5.2 using HMAC-SHA1,
+// which is what the key encrypting key derivation of SRT uses.
+func pbkdf2(password, salt []byte, iter, keyLen int) []byte {
+	prf := hmac.New(sha1.New, password)
+	hashLen := prf.Size()
+	numBlocks := (keyLen + hashLen - 1) / hashLen
+
+	var buf [4]byte
+	dk := make([]byte, 0, numBlocks*hashLen)
+	u := make([]byte, hashLen)
+	for block := 1; block <= numBlocks; block++ {
+		prf.Reset()
+		prf.Write(salt)
+		binary.BigEndian.PutUint32(buf[:], uint32(block))
+		prf.Write(buf[:4])
+		dk = prf.Sum(dk)
+		t := dk[len(dk)-hashLen:]
+		copy(u, t)
+		for n := 2; n <= iter; n++ {
+			u = prfSum(prf, u)
+			for i := range u {
+				t[i] ^= u[i]
+			}
+		}
+	}
+	return dk[:keyLen]
+}
+
+func prfSum(prf hash.Hash, u []byte) []byte {
+	prf.Reset()
+	prf.Write(u)
+	return prf.Sum(u[:0])
+}
+
+// kek derives the key encrypting key from a passphrase. Only the last
+// 8 bytes of the salt take part in the derivation.
+func kek(passphrase string, salt []byte, keyLen int) []byte {
+	return pbkdf2([]byte(passphrase), salt[len(salt)-8:], pbkdf2Iter, keyLen)
+}
+
+var wrapIV = [8]byte{0xa6, 0xa6, 0xa6, 0xa6, 0xa6, 0xa6, 0xa6, 0xa6}
+
+// wrapKey implements the AES key wrap of RFC 3394.
+func wrapKey(kek, key []byte) ([]byte, error) {
+	if len(key)%8 != 0 || len(key) < 16 {
+		return nil, errBadKM
+	}
+	block, err := aes.NewCipher(kek)
+	if err != nil {
+		return nil, err
+	}
+	n := len(key) / 8
+	out := make([]byte, 8+len(key))
+	copy(out[8:], key)
+	a := wrapIV
+	var b [16]byte
+	for j := 0; j < 6; j++ {
+		for i := 1; i <= n; i++ {
+			copy(b[:8], a[:])
+			copy(b[8:], out[8*i:8*i+8])
+			block.Encrypt(b[:], b[:])
+			t := uint64(n*j + i)
+			binary.BigEndian.PutUint64(a[:], binary.BigEndian.Uint64(b[:8])^t)
+			copy(out[8*i:], b[8:])
+		}
+	}
+	copy(out, a[:])
+	return out, nil
+}
+
+// unwrapKey reverses wrapKey, reporting errBadSecret if the integrity
+// check fails, which is what a wrong passphrase leads to.
+func unwrapKey(kek, wrapped []byte) ([]byte, error) {
+	if len(wrapped)%8 != 0 || len(wrapped) < 24 {
+		return nil, errBadKM
+	}
+	block, err := aes.NewCipher(kek)
+	if err != nil {
+		return nil, err
+	}
+	n := len(wrapped)/8 - 1
+	out := make([]byte, len(wrapped)-8)
+	copy(out, wrapped[8:])
+	var a [8]byte
+	copy(a[:], wrapped[:8])
+	var b [16]byte
+	for j := 5; j >= 0; j-- {
+		for i := n; i >= 1; i-- {
+			t := uint64(n*j + i)
+			binary.BigEndian.PutUint64(b[:8], binary.BigEndian.Uint64(a[:])^t)
+			copy(b[8:], out[8*(i-1):8*i])
+			block.Decrypt(b[:], b[:])
+			copy(a[:], b[:8])
+			copy(out[8*(i-1):], b[8:])
+		}
+	}
+	if subtle.ConstantTimeCompare(a[:], wrapIV[:]) != 1 {
+		return nil, errBadSecret
+	}
+	return out, nil
+}
+
+// kmMsg is a key material message, as carried by KMREQ and KMRSP
+// handshake extensions.
+type kmMsg struct {
+	kk      uint8 // which keys are present, kkEven and/or kkOdd
+	salt    []byte
+	keyLen  int
+	wrapped []byte
+}
+
+const (
+	kmSign       = 0x2029
+	kmCipherCTR  = 2
+	kmSEsrt      = 2
+	kmHeaderSize = 16
+)
+
+func (m *kmMsg) marshal() []byte {
+	b := make([]byte, kmHeaderSize, kmHeaderSize+len(m.salt)+len(m.wrapped))
+	b[0] = 0x12 // version 1, packet type KMmsg
+	binary.BigEndian.PutUint16(b[1:], kmSign)
+	b[3] = m.kk & 3
+	// b[4:8] is KEKI, 0 for the default KEK
+	b[8] = kmCipherCTR
+	b[9] = 0 // no authentication
+	b[10] = kmSEsrt
+	b[14] = byte(len(m.salt) / 4)
+	b[15] = byte(m.keyLen / 4)
+	b = append(b, m.salt...)
+	return append(b, m.wrapped...)
+}
+
+func parseKM(b []byte) (*kmMsg, error) {
+	if len(b) < kmHeaderSize || b[0] != 0x12 || binary.BigEndian.Uint16(b[1:]) != kmSign {
+		return nil, errBadKM
+	}
+	if b[8] != kmCipherCTR {
+		return nil, errBadKM
+	}
+	m := &kmMsg{kk: b[3] & 3}
+	slen, klen := int(b[14])*4, int(b[15])*4
+	switch klen {
+	case 16, 24, 32:
+	default:
+		return nil, errBadKM
+	}
+	nkeys := 1
+	if m.kk == kkEven|kkOdd {
+		nkeys = 2
+	}
+	b = b[kmHeaderSize:]
+	if len(b) < slen+8+nkeys*klen {
+		return nil, errBadKM
+	}
+	m.salt = b[:slen]
+	m.keyLen = klen
+	m.wrapped = b[slen : slen+8+nkeys*klen]
+	return m, nil
+}
+
+// cryptoCtx holds the stream encrypting keys of a connection, or of
+// one direction of it once the keys are refreshed. SRT keeps two key
+// slots, even and odd, to switch between them without a gap.
+type cryptoCtx struct {
+	salt   []byte
+	kek    []byte
+	keyLen int
+	keys   [2]cipher.Block // indexed by the KK value less one
+	seks   [2][]byte
+	km     []byte // the KM message announcing the keys
+}
+
+// newCryptoCtx generates a random even key of keyLen bytes, protected
+// by passphrase.
+func newCryptoCtx(passphrase string, keyLen int) (*cryptoCtx, error) {
+	salt := make([]byte, saltSize)
+	if _, err := rand.Read(salt); err != nil {
+		return nil, err
+	}
+	c := &cryptoCtx{salt: salt, kek: kek(passphrase, salt, keyLen), keyLen: keyLen}
+	if err := c.generate(kkEven); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// cryptoFromKM recovers the keys announced by a KM message.
+func cryptoFromKM(passphrase string, km []byte) (*cryptoCtx, error) {
+	m, err := parseKM(km)
+	if err != nil {
+		return nil, err
+	}
+	c := &cryptoCtx{
+		salt:   append([]byte(nil), m.salt...),
+		kek:    kek(passphrase, m.salt, m.keyLen),
+		keyLen: m.keyLen,
+	}
+	if _, _, err := c.update(km); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// clone returns a copy of c whose keys can be refreshed independently.
+func (c *cryptoCtx) clone() *cryptoCtx {
+	n := *c
+	return &n
+}
+
+// has reports whether the key kk is installed.
+func (c *cryptoCtx) has(kk uint8) bool {
+	return c.keys[kk-1] != nil
+}
+
+// generate installs a new random key in slot kk and updates c.km to
+// announce every installed key.
+func (c *cryptoCtx) generate(kk uint8) error {
+	sek := make([]byte, c.keyLen)
+	if _, err := rand.Read(sek); err != nil {
+		return err
+	}
+	block, err := aes.NewCipher(sek)
+	if err != nil {
+		return err
+	}
+	c.keys[kk-1], c.seks[kk-1] = block, sek
+	return c.announce()
+}
+
+// retire removes the key kk and updates c.km to announce the other.
+func (c *cryptoCtx) retire(kk uint8) error {
+	c.keys[kk-1], c.seks[kk-1] = nil, nil
+	return c.announce()
+}
+
+func (c *cryptoCtx) announce() error {
+	m := &kmMsg{salt: c.salt, keyLen: c.keyLen}
+	var seks []byte
+	for i, sek := range c.seks {
+		if sek != nil {
+			m.kk |= uint8(i + 1)
+			seks = append(seks, sek...)
+		}
+	}
+	wrapped, err := wrapKey(c.kek, seks)
+	if err != nil {
+		return err
+	}
+	m.wrapped = wrapped
+	c.km = m.marshal()
+	return nil
+}
+
+// update installs the keys announced by the KM message km, which
+// must use the salt and key length of c, and removes the others. It
+// returns the keys added and the keys removed.
+func (c *cryptoCtx) update(km []byte) (added, removed uint8, err error) {
+	m, err := parseKM(km)
+	if err != nil {
+		return 0, 0, err
+	}
+	if m.keyLen != c.keyLen || !bytes.Equal(m.salt, c.salt) {
+		return 0, 0, errBadKM
+	}
+	keys, err := unwrapKey(c.kek, m.wrapped)
+	if err != nil {
+		return 0, 0, err
+	}
+	for i := range c.keys {
+		kk := uint8(i + 1)
+		if m.kk&kk == 0 {
+			if c.keys[i] != nil {
+				removed |= kk
+			}
+			c.keys[i], c.seks[i] = nil, nil
+			continue
+		}
+		sek := keys[:c.keyLen]
+		if kk == kkOdd {
+			sek = keys[len(keys)-c.keyLen:]
+		}
+		if c.seks[i] != nil && bytes.Equal(c.seks[i], sek) {
+			continue
+		}
+		block, err := aes.NewCipher(sek)
+		if err != nil {
+			return 0, 0, err
+		}
+		c.keys[i], c.seks[i] = block, append([]byte(nil), sek...)
+		added |= kk
+	}
+	c.km = append([]byte(nil), km...)
+	return added, removed, nil
+}
+
+// xor encrypts or decrypts, in place with the key kk, the payload of
+// the data packet with sequence number seq. It reports false if that
+// key isn't installed.
+func (c *cryptoCtx) xor(kk uint8, seq uint32, p []byte) bool {
+	if kk != kkEven && kk != kkOdd || c.keys[kk-1] == nil {
+		return false
+	}
+	var iv [aes.BlockSize]byte
+	binary.BigEndian.PutUint32(iv[10:], seq)
+	for i := 0; i < 14; i++ {
+		iv[i] ^= c.salt[i]
+	}
+	cipher.NewCTR(c.keys[kk-1], iv[:]).XORKeyStream(p, p)
+	return true
+}
@@ -0,0 +1,241 @@
+// Copyright (c) 2020 CyberAgent, Inc. All rights reserved.
+// https://github.com/openfresh/gosrt
+
+package native
+
+import (
+	"sync"
+	"time"
+)
+
+// Epoll event flags. The values are those of libsrt's SRT_EPOLL_OPT.
+const (
+	EpollIn  uint32 = 0x1
+	EpollOut uint32 = 0x4
+	EpollErr uint32 = 0x8
+	EpollET  uint32 = 1 << 31
+
+	epollEvents = EpollIn | EpollOut | EpollErr
+)
+
+// Epoll flags.
+const (
+	EpollEnableEmpty       = 1
+	EpollEnableOutputcheck = 2
+)
+
+// Event is a readiness event reported by EpollWait.
+type Event struct {
+	Fd     int
+	Events uint32
+}
+
+type epollSub struct {
+	events  uint32 // subscribed events, possibly with EpollET
+	pending uint32 // edge triggered events not reported yet
+}
+
+type epoll struct {
+	cond  *sync.Cond
+	flags int
+	subs  map[int]*epollSub
+}
+
+var (
+	// epmu protects the following, and is the lock of every epoll's
+	// cond. It may be taken while holding a socket's lock, so a
+	// socket's lock is never taken after it.
+	epmu       sync.Mutex
+	epolls     = map[int]*epoll{}
+	nextEpoll  = 1
+	sockEpolls = map[int]map[int]bool{} // socket ID to epoll IDs
+)
+
+// EpollCreate creates an epoll container.
+func EpollCreate() (int, error) {
+	epmu.Lock()
+	defer epmu.Unlock()
+	eid := nextEpoll
+	nextEpoll++
+	epolls[eid] = &epoll{cond: sync.NewCond(&epmu), subs: map[int]*epollSub{}}
+	return eid, nil
+}
+
+// EpollRelease deletes an epoll container.
+func EpollRelease(eid int) error {
+	epmu.Lock()
+	defer epmu.Unlock()
+	ep, ok := epolls[eid]
+	if !ok {
+		return EINVPOLLID
+	}
+	for id := range ep.subs {
+		delete(sockEpolls[id], eid)
+	}
+	delete(epolls, eid)
+	ep.cond.Broadcast()
+	return nil
+}
+
+// EpollSet sets the flags of an epoll container and returns the
+// previous ones. Negative flags just query them.
+func EpollSet(eid, flags int) (int, error) {
+	epmu.Lock()
+	defer epmu.Unlock()
+	ep, ok := epolls[eid]
+	if !ok {
+		return 0, EINVPOLLID
+	}
+	old := ep.flags
+	if flags >= 0 {
+		ep.flags = flags
+	}
+	return old, nil
+}
+
+// EpollAdd subscribes an epoll container to events of socket s.
+// Events the socket is already ready for are reported by the next
+// wait.
+func EpollAdd(eid, s int, events uint32) error {
+	return epollSubscribe(eid, s, events, true)
+}
+
+// EpollUpdate changes the events an epoll container waits for on s.
+// Like EpollAdd, it reports the current readiness again.
+func EpollUpdate(eid, s int, events uint32) error {
+	return epollSubscribe(eid, s, events, false)
+}
+
+func epollSubscribe(eid, s int, events uint32, add bool) error {
+	sock := lookup(s)
+	if sock == nil {
+		return EINVSOCK
+	}
+	epmu.Lock()
+	defer epmu.Unlock()
+	ep, ok := epolls[eid]
+	if !ok {
+		return EINVPOLLID
+	}
+	sub := ep.subs[s]
+	if sub == nil {
+		sub = &epollSub{}
+		ep.subs[s] = sub
+		if sockEpolls[s] == nil {
+			sockEpolls[s] = map[int]bool{}
+		}
+		sockEpolls[s][eid] = true
+	}
+	sub.events = events
+	sub.pending = sock.readiness() & events & epollEvents
+	if sub.pending != 0 {
+		ep.cond.Broadcast()
+	}
+	return nil
+}
+
+// EpollRemove unsubscribes an epoll container from socket s.
+func EpollRemove(eid, s int) error {
+	epmu.Lock()
+	defer epmu.Unlock()
+	ep, ok := epolls[eid]
+	if !ok {
+		return EINVPOLLID
+	}
+	delete(ep.subs, s)
+	delete(sockEpolls[s], eid)
+	if len(sockEpolls[s]) == 0 {
+		delete(sockEpolls, s)
+	}
+	return nil
+}
+
+// EpollWait waits up to timeout for events and returns at most max of
+// them. A negative timeout waits forever. It returns no events and no
+// error when the timeout expires.
+func EpollWait(eid int, max int, timeout time.Duration) ([]Event, error) {
+	var deadline time.Time
+	if timeout >= 0 {
+		deadline = time.Now().Add(timeout)
+		t := time.AfterFunc(timeout, func() {
+			epmu.Lock()
+			if ep, ok := epolls[eid]; ok {
+				ep.cond.Broadcast()
+			}
+			epmu.Unlock()
+		})
+		defer t.Stop()
+	}
+
+	epmu.Lock()
+	defer epmu.Unlock()
+	for {
+		ep, ok := epolls[eid]
+		if !ok {
+			return nil, EINVPOLLID
+		}
+		if len(ep.subs) == 0 && ep.flags&EpollEnableEmpty == 0 {
+			return nil, EPOLLEMPTY
+		}
+		if evs := ep.collect(max); len(evs) > 0 {
+			return evs, nil
+		}
+		if !deadline.IsZero() && !time.Now().Before(deadline) {
+			return nil, nil
+		}
+		ep.cond.Wait()
+	}
+}
+
+// collect gathers the events to report. epmu must be held.
+func (ep *epoll) collect(max int) []Event {
+	var evs []Event
+	for s, sub := range ep.subs {
+		if len(evs) == max {
+			break
+		}
+		var ev uint32
+		if sub.events&EpollET != 0 {
+			ev = sub.pending
+			sub.pending = 0
+		} else if sock := lookup(s); sock != nil {
+			ev = sock.readiness() & sub.events & epollEvents
+		} else {
+			ev = EpollErr & sub.events
+		}
+		if ev != 0 {
+			evs = append(evs, Event{Fd: s, Events: ev})
+		}
+	}
+	return evs
+}
+
+// epollNotify tells the epoll containers watching socket s that it
+// became ready for events.
+func epollNotify(s int, events uint32) {
+	epmu.Lock()
+	defer epmu.Unlock()
+	for eid := range sockEpolls[s] {
+		ep := epolls[eid]
+		if ep == nil {
+			continue
+		}
+		sub := ep.subs[s]
+		if ev := events & sub.events & epollEvents; ev != 0 {
+			sub.pending |= ev
+			ep.cond.Broadcast()
+		}
+	}
+}
+
+// epollForget drops every subscription to socket s, once it's gone.
+func epollForget(s int) {
+	epmu.Lock()
+	defer epmu.Unlock()
+	for eid := range sockEpolls[s] {
+		if ep := epolls[eid]; ep != nil {
+			delete(ep.subs, s)
+		}
+	}
+	delete(sockEpolls, s)
+}
@@ -0,0 +1,131 @@
+// Copyright (c) 2020 CyberAgent, Inc. All rights reserved.
+// https://github.com/openfresh/gosrt
+
+package native
+
+// Error is an SRT error code. The values are those of libsrt's
+// SRT_ERRNO, so that they can be handed out through srtapi unchanged.
+type Error int
+
+// Error codes.
+const (
+	EUNKNOWN        Error = -1
+	SUCCESS         Error = 0
+	ECONNSETUP      Error = 1000
+	ENOSERVER       Error = 1001
+	ECONNREJ        Error = 1002
+	ESOCKFAIL       Error = 1003
+	ESECFAIL        Error = 1004
+	ESCLOSED        Error = 1005
+	ECONNFAIL       Error = 2000
+	ECONNLOST       Error = 2001
+	ENOCONN         Error = 2002
+	ERESOURCE       Error = 3000
+	ETHREAD         Error = 3001
+	ENOBUF          Error = 3002
+	ESYSOBJ         Error = 3003
+	EFILE           Error = 4000
+	EINVRDOFF       Error = 4001
+	ERDPERM         Error = 4002
+	EINVWROFF       Error = 4003
+	EWRPERM         Error = 4004
+	EINVOP          Error = 5000
+	EBOUNDSOCK      Error = 5001
+	ECONNSOCK       Error = 5002
+	EINVPARAM       Error = 5003
+	EINVSOCK        Error = 5004
+	EUNBOUNDSOCK    Error = 5005
+	ENOLISTEN       Error = 5006
+	ERDVNOSERV      Error = 5007
+	ERDVUNBOUND     Error = 5008
+	EINVALMSGAPI    Error = 5009
+	EINVALBUFFERAPI Error = 5010
+	EDUPLISTEN      Error = 5011
+	ELARGEMSG       Error = 5012
+	EINVPOLLID      Error = 5013
+	EPOLLEMPTY      Error = 5014
+	EBINDCONFLICT   Error = 5015
+	EASYNCFAIL      Error = 6000
+	EASYNCSND       Error = 6001
+	EASYNCRCV       Error = 6002
+	ETIMEOUT        Error = 6003
+	ECONGEST        Error = 6004
+	EPEERERR        Error = 7000
+)
+
+var errorText = map[Error]string{
+	EUNKNOWN:        "Unknown error",
+	SUCCESS:         "Success",
+	ECONNSETUP:      "Connection setup failure",
+	ENOSERVER:       "Connection setup failure: connection timed out",
+	ECONNREJ:        "Connection setup failure: connection rejected",
+	ESOCKFAIL:       "Connection setup failure: unable to create/configure SRT socket",
+	ESECFAIL:        "Connection setup failure: aborted for security reasons",
+	ESCLOSED:        "Connection setup failure: socket closed during operation",
+	ECONNFAIL:       "Connection failure",
+	ECONNLOST:       "Connection was broken",
+	ENOCONN:         "Connection does not exist",
+	ERESOURCE:       "System resource failure",
+	ETHREAD:         "System resource failure: unable to create new threads",
+	ENOBUF:          "System resource failure: unable to allocate buffers",
+	ESYSOBJ:         "System resource failure: unable to allocate a system object",
+	EFILE:           "File system failure",
+	EINVRDOFF:       "File system failure: cannot seek read position",
+	ERDPERM:         "File system failure: failure in read",
+	EINVWROFF:       "File system failure: cannot seek write position",
+	EWRPERM:         "File system failure: failure in write",
+	EINVOP:          "Operation not supported",
+	EBOUNDSOCK:      "Operation not supported: Cannot do this operation on a BOUND socket",
+	ECONNSOCK:       "Operation not supported: Cannot do this operation on a CONNECTED socket",
+	EINVPARAM:       "Operation not supported: Bad parameters",
+	EINVSOCK:        "Operation not supported: Invalid socket ID",
+	EUNBOUNDSOCK:    "Operation not supported: Cannot do this operation on an UNBOUND socket",
+	ENOLISTEN:       "Operation not supported: Socket is not in listening state",
+	ERDVNOSERV:      "Operation not supported: Listen/accept is not supported in rendezous connection setup",
+	ERDVUNBOUND:     "Operation not supported: Cannot call connect on UNBOUND socket in rendezvous connection setup",
+	EINVALMSGAPI:    "Operation not supported: Incorrect use of Message API (sendmsg/recvmsg).",
+	EINVALBUFFERAPI: "Operation not supported: Incorrect use of Buffer API (send/recv) or File API (sendfile/recvfile).",
+	EDUPLISTEN:      "Operation not supported: Another socket is already listening on the same port",
+	ELARGEMSG:       "Operation not supported: Message is too large to send (it must be less than the SRT send buffer size)",
+	EINVPOLLID:      "Operation not supported: Invalid epoll ID",
+	EPOLLEMPTY:      "Operation not supported: All sockets removed from epoll waiting set",
+	EBINDCONFLICT:   "Operation not supported: Bind conflict",
+	EASYNCFAIL:      "Non-blocking call failure",
+	EASYNCSND:       "Non-blocking call failure: no buffer available for sending",
+	EASYNCRCV:       "Non-blocking call failure: no data available for reading",
+	ETIMEOUT:        "Non-blocking call failure: transmission timed out",
+	ECONGEST:        "Non-blocking call failure: early congestion notification",
+	EPEERERR:        "The peer side has signaled an error",
+}
+
+func (e Error) Error() string {
+	if s, ok := errorText[e]; ok {
+		return s
+	}
+	return errorText[EUNKNOWN]
+}
+
+// Reject reasons, as reported in a rejected handshake.
+const (
+	RejectUnknown    = 0
+	RejectSystem     = 1
+	RejectPeer       = 2
+	RejectResource   = 3
+	RejectRogue      = 4
+	RejectBacklog    = 5
+	RejectIPE        = 6
+	RejectClose      = 7
+	RejectVersion    = 8
+	RejectRdvCookie  = 9
+	RejectBadSecret  = 10
+	RejectUnsecure   = 11
+	RejectMessageAPI = 12
+	RejectCongestion = 13
+	RejectFilter     = 14
+	RejectGroup      = 15
+	RejectTimeout    = 16
+
+	// RejectFallback is the reason given when a listen callback
+	// rejects a connection without saying why.
+	RejectFallback = 1000
+)
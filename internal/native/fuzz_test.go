@@ -0,0 +1,41 @@
+// Copyright (c) 2020 CyberAgent, Inc. All rights reserved.
+// https://github.com/openfresh/gosrt
+
+//go:build go1.18
+// +build go1.18
+
+package native
+
+import (
+	"bytes"
+	"testing"
+)
+
+// Every datagram a listener receives goes through these parsers before
+// any handshake vouches for its sender.
+
+func FuzzParsePacket(f *testing.F) {
+	hs := &handshake{version: 5, exts: []hsExt{{typ: extSID, data: marshalSID("#!::r=live")}}}
+	f.Add((&packet{ctrl: true, typ: ctrlHandshake, payload: hs.marshal()}).marshal(nil))
+	f.Add((&packet{seq: 1, msgno: 1, payload: []byte("data")}).marshal(nil))
+	f.Fuzz(func(t *testing.T, b []byte) {
+		p, err := parsePacket(b)
+		if err != nil {
+			return
+		}
+		if got := p.marshal(nil); !bytes.Equal(got, b) {
+			t.Fatalf("got %x back; want %x", got, b)
+		}
+		if p.ctrl {
+			if hs, err := parseHandshake(p.payload); err == nil {
+				for _, e := range hs.exts {
+					parseHSReq(e.data)
+					parseSID(e.data)
+					parseKM(e.data)
+				}
+			}
+			parseACK(p.payload)
+			parseLossList(p.payload, 16, func(uint32) {})
+		}
+	})
+}
@@ -0,0 +1,462 @@
+// Copyright (c) 2020 CyberAgent, Inc. All rights reserved.
+// https://github.com/openfresh/gosrt
+
+package native
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha1"
+	"encoding/binary"
+	"math/rand"
+	"net"
+	"time"
+)
+
+// How often a caller repeats a handshake request that got no answer.
+const hsInterval = 250 * time.Millisecond
+
+// callerHandshake is the state of a connection attempt.
+type callerHandshake struct {
+	conclusion bool // past the induction phase
+	req        *packet
+	timer      *time.Timer
+	deadline   time.Time
+	crypto     *cryptoCtx
+}
+
+// startHandshake sends the induction request and arms the timer
+// repeating it. s.mu must be held.
+func (s *socket) startHandshake() {
+	s.isn = uint32(rand.Int31()) & seqMask
+	hs := &handshake{
+		version:  4,
+		extfield: 2, // UDT_DGRAM
+		isn:      s.isn,
+		mss:      uint32(s.opts.mss),
+		fc:       uint32(s.opts.fc),
+		typ:      hsInduction,
+		id:       uint32(s.id),
+	}
+	hs.setPeerIP(s.peer.IP)
+	s.hs = &callerHandshake{
+		req:      s.ctrlPacket(ctrlHandshake, 0, 0, hs.marshal()),
+		deadline: time.Now().Add(time.Duration(s.opts.connTimeo) * time.Millisecond),
+	}
+	s.mux.send(s.hs.req, s.peer)
+	s.hs.timer = time.AfterFunc(hsInterval, s.handshakeTimer)
+}
+
+func (s *socket) handshakeTimer() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.state != StatusConnecting {
+		return
+	}
+	if !time.Now().Before(s.hs.deadline) {
+		s.reject = RejectTimeout
+		s.fail(ENOSERVER)
+		return
+	}
+	s.hs.req.ts = s.timestamp(time.Now())
+	s.mux.send(s.hs.req, s.peer)
+	s.hs.timer.Reset(hsInterval)
+}
+
+func (s *socket) timestamp(now time.Time) uint32 {
+	if now.Before(s.start) {
+		return 0
+	}
+	return uint32(now.Sub(s.start) / time.Microsecond)
+}
+
+func (s *socket) ctrlPacket(typ uint16, info uint32, dst uint32, cif []byte) *packet {
+	return &packet{
+		ctrl:    true,
+		typ:     typ,
+		info:    info,
+		ts:      s.timestamp(time.Now()),
+		dst:     dst,
+		payload: cif,
+	}
+}
+
+// callerInput handles a handshake answer from the listener.
+// s.mu must be held.
+func (s *socket) callerInput(p *packet, now time.Time) {
+	hs, err := parseHandshake(p.payload)
+	if err != nil {
+		return
+	}
+	if hs.typ >= hsFailure && hs.typ != hsConclusion && hs.typ != hsAgreement && hs.typ != hsDone {
+		s.reject = int(hs.typ - hsFailure)
+		s.fail(ECONNREJ)
+		return
+	}
+	if !s.hs.conclusion {
+		if hs.typ != hsInduction {
+			return
+		}
+		if hs.version < 5 || hs.extfield != srtMagic {
+			// HSv4 peers aren't supported.
+			s.reject = RejectVersion
+			s.fail(ECONNREJ)
+			return
+		}
+		if err := s.sendConclusion(hs); err != nil {
+			s.reject = RejectSystem
+			s.fail(ESECFAIL)
+		}
+		return
+	}
+	if hs.typ != hsConclusion {
+		return
+	}
+	rsp, ok := parseHSReq(hs.ext(extHSRSP))
+	if !ok {
+		s.reject = RejectRogue
+		s.fail(ECONNREJ)
+		return
+	}
+	cc := s.hs.crypto
+	if cc != nil {
+		km := hs.ext(extKMRSP)
+		switch {
+		case len(km) == 4 && !s.opts.enforced:
+			// The listener has no passphrase; go on in the clear.
+			cc = nil
+			s.kmState = KMNoSecret
+		case len(km) == 4:
+			s.reject = RejectUnsecure
+			s.kmState = KMNoSecret
+			s.fail(ECONNREJ)
+			return
+		case !bytes.Equal(km, cc.km):
+			s.reject = RejectBadSecret
+			s.kmState = KMBadSecret
+			s.fail(ECONNREJ)
+			return
+		default:
+			s.kmState = KMSecured
+		}
+	}
+	s.peerID = hs.id
+	s.peerVer = rsp.version
+	s.hs.timer.Stop()
+	s.connected(now, p.ts, rsp.flags, time.Duration(rsp.sndDelay)*time.Millisecond,
+		time.Duration(rsp.rcvDelay)*time.Millisecond, cc)
+}
+
+// sendConclusion answers the listener's induction response.
+func (s *socket) sendConclusion(ind *handshake) error {
+	hs := &handshake{
+		version:  5,
+		extfield: hsExtHSREQ,
+		isn:      s.isn,
+		mss:      uint32(s.opts.mss),
+		fc:       uint32(s.opts.fc),
+		typ:      hsConclusion,
+		id:       uint32(s.id),
+		cookie:   ind.cookie,
+	}
+	hs.setPeerIP(s.peer.IP)
+	flags := uint32(flagTSBPDSND | flagTSBPDRCV | flagREXMITFLG)
+	if s.opts.tlPktDrop {
+		flags |= flagTLPKTDROP
+	}
+	if s.opts.nakReport {
+		flags |= flagPERIODICNAK
+	}
+	if n := s.opts.keyLen(); n > 0 {
+		cc, err := newCryptoCtx(s.opts.passphrase, n)
+		if err != nil {
+			return err
+		}
+		s.hs.crypto = cc
+		s.kmState = KMSecuring
+		flags |= flagCrypt
+		hs.encfield = uint16(n / 8)
+		hs.extfield |= hsExtKMREQ
+	}
+	req := hsreq{
+		version:  srtVersion,
+		flags:    flags,
+		rcvDelay: uint16(s.opts.rcvLatency),
+		sndDelay: uint16(s.opts.peerLatency),
+	}
+	hs.exts = append(hs.exts, hsExt{typ: extHSREQ, data: req.marshal()})
+	if s.hs.crypto != nil {
+		hs.exts = append(hs.exts, hsExt{typ: extKMREQ, data: s.hs.crypto.km})
+	}
+	if s.opts.streamID != "" {
+		hs.extfield |= hsExtConfig
+		hs.exts = append(hs.exts, hsExt{typ: extSID, data: marshalSID(s.opts.streamID)})
+	}
+	s.hs.conclusion = true
+	s.hs.req = s.ctrlPacket(ctrlHandshake, 0, 0, hs.marshal())
+	s.mux.send(s.hs.req, s.peer)
+	return nil
+}
+
+// connected switches s to the connected state. peerTS is the timestamp
+// of the peer's handshake packet, which sets the time base for TSBPD.
+// s.mu must be held.
+func (s *socket) connected(now time.Time, peerTS uint32, flags uint32, rcvLatency, sndLatency time.Duration, cc *cryptoCtx) {
+	s.c = newConn(s, now, peerTS, flags, rcvLatency, sndLatency, cc)
+	s.state = StatusConnected
+	s.hs = nil
+	s.update()
+	s.cond.Broadcast()
+}
+
+// cookie returns the SYN cookie expected from addr in the given
+// minute.
+func (s *socket) cookie(addr *net.UDPAddr, minute int64) uint32 {
+	h := hmac.New(sha1.New, s.secret[:])
+	h.Write([]byte(addr.String()))
+	var b [8]byte
+	binary.BigEndian.PutUint64(b[:], uint64(minute))
+	h.Write(b[:])
+	return binary.BigEndian.Uint32(h.Sum(nil))
+}
+
+func (s *socket) validCookie(addr *net.UDPAddr, cookie uint32, now time.Time) bool {
+	minute := now.Unix() / 60
+	return cookie == s.cookie(addr, minute) || cookie == s.cookie(addr, minute-1)
+}
+
+// listenerInput handles a handshake request addressed to listener s.
+func (s *socket) listenerInput(p *packet, from *net.UDPAddr) {
+	hs, err := parseHandshake(p.payload)
+	if err != nil {
+		return
+	}
+	now := time.Now()
+	s.mu.Lock()
+	if s.state != StatusListening {
+		s.mu.Unlock()
+		return
+	}
+	switch hs.typ {
+	case hsInduction:
+		rsp := &handshake{
+			version:  5,
+			extfield: srtMagic,
+			isn:      hs.isn,
+			mss:      uint32(s.opts.mss),
+			fc:       uint32(s.opts.fc),
+			typ:      hsInduction,
+			id:       uint32(s.id),
+			cookie:   s.cookie(from, now.Unix()/60),
+		}
+		if n := s.opts.keyLen(); n > 0 {
+			rsp.encfield = uint16(n / 8)
+		}
+		rsp.setPeerIP(from.IP)
+		s.mux.send(s.ctrlPacket(ctrlHandshake, 0, hs.id, rsp.marshal()), from)
+		s.mu.Unlock()
+		return
+	case hsConclusion:
+	default:
+		s.mu.Unlock()
+		return
+	}
+	if !s.validCookie(from, hs.cookie, now) {
+		s.mu.Unlock()
+		return
+	}
+	key := childKey{from.String(), hs.id}
+	if ns := s.children[key]; ns != nil {
+		// Our answer got lost; repeat it.
+		ns.mu.Lock()
+		rsp := ns.hsResp
+		ns.mu.Unlock()
+		if rsp != nil {
+			s.mux.send(rsp, from)
+		}
+		s.mu.Unlock()
+		return
+	}
+	if hs.version < 5 {
+		s.rejectPeer(hs, from, RejectVersion)
+		s.mu.Unlock()
+		return
+	}
+	if len(s.queue) >= s.backlog {
+		s.rejectPeer(hs, from, RejectBacklog)
+		s.mu.Unlock()
+		return
+	}
+	ns := newSocket(s.opts.clone())
+	ns.parent = s
+	ns.mux = s.mux
+	ns.peer = from
+	ns.peerID = hs.id
+	ns.isn = hs.isn
+	ns.state = StatusConnecting
+	if sid := hs.ext(extSID); sid != nil {
+		ns.opts.streamID = parseSID(sid)
+	}
+	// Repeated conclusions are ignored until this one is answered.
+	s.children[key] = ns
+	cb := s.callback
+	s.mu.Unlock()
+
+	// The callback may set options of the new socket, so it runs
+	// without locks held.
+	if cb != nil && cb(ns.id, int(hs.version), from, ns.opts.streamID) < 0 {
+		ns.mu.Lock()
+		reason := ns.reject
+		ns.mu.Unlock()
+		if reason < RejectFallback {
+			reason = RejectFallback
+		}
+		s.mu.Lock()
+		s.rejectPeer(hs, from, reason)
+		s.mu.Unlock()
+		ns.close()
+		return
+	}
+
+	ns.mu.Lock()
+	rsp, reason := ns.accept(hs, p.ts, now)
+	ns.mu.Unlock()
+	if reason >= 0 {
+		s.mu.Lock()
+		s.rejectPeer(hs, from, reason)
+		s.mu.Unlock()
+		ns.close()
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.state != StatusListening || s.children[key] != ns {
+		go ns.close()
+		return
+	}
+	s.mux.add(ns)
+	ns.mu.Lock()
+	ns.hsResp = rsp
+	ns.mu.Unlock()
+	s.mux.send(rsp, from)
+	s.queue = append(s.queue, ns)
+	s.update()
+}
+
+// accept negotiates the connection requested by hs with the options of
+// ns, returning either the conclusion response or a reject reason.
+// ns.mu must be held.
+func (ns *socket) accept(hs *handshake, peerTS uint32, now time.Time) (*packet, int) {
+	req, ok := parseHSReq(hs.ext(extHSREQ))
+	if !ok {
+		return nil, RejectRogue
+	}
+	var cc *cryptoCtx
+	km := hs.ext(extKMREQ)
+	switch {
+	case ns.opts.passphrase != "" && km != nil:
+		var err error
+		if cc, err = cryptoFromKM(ns.opts.passphrase, km); err != nil {
+			ns.kmState = KMBadSecret
+			return nil, RejectBadSecret
+		}
+		ns.kmState = KMSecured
+		// As with libsrt, the caller decides the key length.
+		ns.opts.pbKeyLen = cc.keyLen
+	case ns.opts.passphrase != "" || km != nil:
+		if ns.opts.enforced {
+			return nil, RejectUnsecure
+		}
+		if km != nil {
+			ns.kmState = KMNoSecret
+		}
+	}
+
+	// Each direction uses the larger of the latencies asked for by
+	// its sender and its receiver.
+	rcvLatency := maxInt(ns.opts.rcvLatency, int(req.sndDelay))
+	sndLatency := maxInt(ns.opts.peerLatency, int(req.rcvDelay))
+	flags := uint32(flagTSBPDSND | flagTSBPDRCV | flagREXMITFLG)
+	if ns.opts.tlPktDrop && req.flags&flagTLPKTDROP != 0 {
+		flags |= flagTLPKTDROP
+	}
+	if ns.opts.nakReport {
+		flags |= flagPERIODICNAK
+	}
+	if cc != nil {
+		flags |= flagCrypt
+	}
+	rsp := &handshake{
+		version:  5,
+		extfield: hsExtHSREQ,
+		isn:      hs.isn,
+		mss:      uint32(minInt(ns.opts.mss, int(hs.mss))),
+		fc:       uint32(ns.opts.fc),
+		typ:      hsConclusion,
+		id:       uint32(ns.id),
+		cookie:   hs.cookie,
+	}
+	rsp.setPeerIP(ns.peer.IP)
+	hsrsp := hsreq{
+		version:  srtVersion,
+		flags:    flags,
+		rcvDelay: uint16(rcvLatency),
+		sndDelay: uint16(sndLatency),
+	}
+	rsp.exts = append(rsp.exts, hsExt{typ: extHSRSP, data: hsrsp.marshal()})
+	switch {
+	case cc != nil:
+		rsp.extfield |= hsExtKMREQ
+		rsp.exts = append(rsp.exts, hsExt{typ: extKMRSP, data: km})
+	case km != nil:
+		rsp.extfield |= hsExtKMREQ
+		rsp.exts = append(rsp.exts, hsExt{typ: extKMRSP, data: []byte{0, 0, 0, KMNoSecret}})
+	}
+	ns.peerVer = req.version
+	ns.connected(now, peerTS, flags&req.flags|flagTSBPDSND|flagTSBPDRCV,
+		time.Duration(rcvLatency)*time.Millisecond, time.Duration(sndLatency)*time.Millisecond, cc)
+	return ns.ctrlPacket(ctrlHandshake, 0, hs.id, rsp.marshal()), -1
+}
+
+// rejectPeer answers hs with a rejection. s.mu must be held.
+func (s *socket) rejectPeer(hs *handshake, from *net.UDPAddr, reason int) {
+	rsp := *hs
+	rsp.version = 5
+	rsp.typ = hsFailure + uint32(reason)
+	rsp.id = uint32(s.id)
+	rsp.exts = nil
+	rsp.setPeerIP(from.IP)
+	s.mux.send(s.ctrlPacket(ctrlHandshake, 0, hs.id, rsp.marshal()), from)
+}
+
+// forget drops the record of an accepted socket that was closed.
+func (s *socket) forget(ns *socket) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for k, v := range s.children {
+		if v == ns {
+			delete(s.children, k)
+		}
+	}
+	for i, v := range s.queue {
+		if v == ns {
+			s.queue = append(s.queue[:i], s.queue[i+1:]...)
+			break
+		}
+	}
+}
+
+func maxInt(a, b int) int {
+	if a > b {
+		return a
+	}
+	return b
+}
+
+func minInt(a, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
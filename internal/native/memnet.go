@@ -0,0 +1,197 @@
+// Copyright (c) 2020 CyberAgent, Inc. All rights reserved.
+// https://github.com/openfresh/gosrt
+
+// +build srtmock
+
+package native
+
+import (
+	"errors"
+	"net"
+	"sync"
+	"syscall"
+)
+
+// With the srtmock build tag, sockets exchange their datagrams over an
+// in-memory network instead of UDP, so connections never touch the
+// host's sockets. Every address is local: a datagram goes to the
+// endpoint bound to its destination address, or else to one bound to
+// the wildcard address of the same family. IPv4 and IPv6 endpoints
+// share no ports, as UDP sockets opened by the net package don't. Like
+// UDP, the network silently drops datagrams nobody receives or whose
+// receiver's queue is full.
+
+const (
+	memQueueLen  = 1024
+	memFirstPort = 49152
+)
+
+var errMemClosed = errors.New("use of closed network connection")
+
+var memnet = struct {
+	sync.Mutex
+	ports map[int][]*memConn
+	next  int
+}{ports: map[int][]*memConn{}, next: memFirstPort}
+
+type datagram struct {
+	b    []byte
+	from *net.UDPAddr
+}
+
+type memConn struct {
+	laddr  *net.UDPAddr
+	v6     bool
+	in     chan datagram
+	closed chan struct{}
+	once   sync.Once
+}
+
+// conflicts reports whether binding ip in the given family collides
+// with c.
+func (c *memConn) conflicts(ip net.IP, v6 bool) bool {
+	return c.v6 == v6 && (c.laddr.IP.Equal(ip) || c.laddr.IP.IsUnspecified() || ip.IsUnspecified())
+}
+
+func memBindable(port int, ip net.IP, v6 bool) bool {
+	for _, c := range memnet.ports[port] {
+		if c.conflicts(ip, v6) {
+			return false
+		}
+	}
+	return true
+}
+
+// memLookup returns the endpoint receiving datagrams sent to addr.
+// memnet must be locked.
+func memLookup(addr *net.UDPAddr) *memConn {
+	conns := memnet.ports[addr.Port]
+	for _, c := range conns {
+		if c.laddr.IP.Equal(addr.IP) {
+			return c
+		}
+	}
+	v6 := addr.IP.To4() == nil
+	for _, c := range conns {
+		if c.v6 == v6 && c.laddr.IP.IsUnspecified() {
+			return c
+		}
+	}
+	if addr.IP.IsUnspecified() && len(conns) > 0 {
+		// Sending to the wildcard address reaches the local host.
+		return conns[0]
+	}
+	return nil
+}
+
+// RouteSource returns the local IP a socket bound to the wildcard
+// address sends to addr from: addr's own, every address being local,
+// nil if addr is the wildcard address.
+func RouteSource(addr *net.UDPAddr) net.IP {
+	if addr.IP == nil || addr.IP.IsUnspecified() {
+		return nil
+	}
+	return addr.IP
+}
+
+func listenPacket(network string, addr *net.UDPAddr) (packetConn, error) {
+	v6 := network == "udp6"
+	ip := addr.IP
+	if ip == nil {
+		ip = net.IPv4zero
+		if v6 {
+			ip = net.IPv6unspecified
+		}
+	}
+	memnet.Lock()
+	defer memnet.Unlock()
+	port := addr.Port
+	if port == 0 {
+		for i := memFirstPort; i <= 0xffff; i++ {
+			p := memnet.next
+			if memnet.next++; memnet.next > 0xffff {
+				memnet.next = memFirstPort
+			}
+			if memBindable(p, ip, v6) {
+				port = p
+				break
+			}
+		}
+	}
+	if port == 0 || !memBindable(port, ip, v6) {
+		return nil, &net.OpError{Op: "listen", Net: network, Addr: addr, Err: syscall.EADDRINUSE}
+	}
+	c := &memConn{
+		laddr:  &net.UDPAddr{IP: ip, Port: port, Zone: addr.Zone},
+		v6:     v6,
+		in:     make(chan datagram, memQueueLen),
+		closed: make(chan struct{}),
+	}
+	memnet.ports[port] = append(memnet.ports[port], c)
+	return c, nil
+}
+
+func (c *memConn) ReadFromUDP(b []byte) (int, *net.UDPAddr, error) {
+	select {
+	case d := <-c.in:
+		return copy(b, d.b), d.from, nil
+	case <-c.closed:
+		return 0, nil, &net.OpError{Op: "read", Net: "udp", Addr: c.laddr, Err: errMemClosed}
+	}
+}
+
+func (c *memConn) WriteToUDP(b []byte, addr *net.UDPAddr) (int, error) {
+	select {
+	case <-c.closed:
+		return 0, &net.OpError{Op: "write", Net: "udp", Addr: addr, Err: errMemClosed}
+	default:
+	}
+	memnet.Lock()
+	peer := memLookup(addr)
+	memnet.Unlock()
+	if peer == nil {
+		return len(b), nil
+	}
+	from := c.laddr
+	if from.IP.IsUnspecified() && !addr.IP.IsUnspecified() {
+		// Every address is local: like the kernel delivering
+		// locally, send from the address sent to.
+		from = &net.UDPAddr{IP: addr.IP, Port: from.Port, Zone: from.Zone}
+	}
+	select {
+	case peer.in <- datagram{b: append([]byte(nil), b...), from: from}:
+	default:
+	}
+	return len(b), nil
+}
+
+func (c *memConn) LocalAddr() net.Addr {
+	return c.laddr
+}
+
+func (c *memConn) Close() error {
+	c.once.Do(func() {
+		memnet.Lock()
+		conns := memnet.ports[c.laddr.Port]
+		for i, cc := range conns {
+			if cc == c {
+				conns = append(conns[:i:i], conns[i+1:]...)
+				break
+			}
+		}
+		if len(conns) == 0 {
+			delete(memnet.ports, c.laddr.Port)
+		} else {
+			memnet.ports[c.laddr.Port] = conns
+		}
+		memnet.Unlock()
+		close(c.closed)
+	})
+	return nil
+}
+
+// filePacketConn fails: system sockets can't reach the in-memory
+// network.
+func filePacketConn(fd int) (packetConn, error) {
+	return nil, EINVOP
+}
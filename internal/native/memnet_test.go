@@ -0,0 +1,79 @@
+// Copyright (c) 2020 CyberAgent, Inc. All rights reserved.
+// https://github.com/openfresh/gosrt
+
+// +build srtmock
+
+package native
+
+import (
+	"net"
+	"testing"
+)
+
+func TestMemNetwork(t *testing.T) {
+	a, err := listenPacket("udp4", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer a.Close()
+	b, err := listenPacket("udp6", &net.UDPAddr{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	baddr := b.LocalAddr().(*net.UDPAddr)
+	if baddr.Port == a.LocalAddr().(*net.UDPAddr).Port {
+		t.Fatalf("both endpoints got port %d", baddr.Port)
+	}
+	if _, err := listenPacket("udp6", &net.UDPAddr{IP: net.IPv6loopback, Port: baddr.Port}); err == nil {
+		t.Fatalf("second listener on [::]:%d succeeded", baddr.Port)
+	}
+	v4, err := listenPacket("udp4", &net.UDPAddr{Port: baddr.Port})
+	if err != nil {
+		t.Fatalf("IPv4 listener on a port taken by IPv6: %v", err)
+	}
+	v4.Close()
+
+	if _, err := a.WriteToUDP([]byte("hello"), &net.UDPAddr{IP: net.IPv6loopback, Port: baddr.Port}); err != nil {
+		t.Fatal(err)
+	}
+	buf := make([]byte, 16)
+	n, from, err := b.ReadFromUDP(buf)
+	if err != nil || string(buf[:n]) != "hello" || from.String() != a.LocalAddr().String() {
+		t.Fatalf("got %q from %v, %v; want %q from %v", buf[:n], from, err, "hello", a.LocalAddr())
+	}
+
+	b.Close()
+	if _, _, err := b.ReadFromUDP(buf); err == nil {
+		t.Fatal("read from a closed endpoint succeeded")
+	}
+	if n, err := a.WriteToUDP([]byte("lost"), baddr); n != 4 || err != nil {
+		t.Fatalf("write to a closed port: got %d, %v; want it silently dropped", n, err)
+	}
+	c, err := listenPacket("udp4", baddr)
+	if err != nil {
+		t.Fatalf("port %d not reusable after close: %v", baddr.Port, err)
+	}
+	c.Close()
+}
+
+func TestMemNetworkWildcardSource(t *testing.T) {
+	a, err := listenPacket("udp4", &net.UDPAddr{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer a.Close()
+	b, err := listenPacket("udp4", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer b.Close()
+	if _, err := a.WriteToUDP([]byte("hello"), b.LocalAddr().(*net.UDPAddr)); err != nil {
+		t.Fatal(err)
+	}
+	buf := make([]byte, 16)
+	_, from, err := b.ReadFromUDP(buf)
+	want := &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1), Port: a.LocalAddr().(*net.UDPAddr).Port}
+	if err != nil || from.String() != want.String() {
+		t.Fatalf("got datagram from %v, %v; want from %v", from, err, want)
+	}
+}
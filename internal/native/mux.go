@@ -0,0 +1,129 @@
+// Copyright (c) 2020 CyberAgent, Inc. All rights reserved.
+// https://github.com/openfresh/gosrt
+
+package native
+
+import (
+	"net"
+	"sync"
+)
+
+// packetConn is the datagram socket a mux reads and writes. It is a
+// *net.UDPConn unless the srtmock build tag swaps in the in-memory
+// network.
+type packetConn interface {
+	ReadFromUDP(b []byte) (int, *net.UDPAddr, error)
+	WriteToUDP(b []byte, addr *net.UDPAddr) (int, error)
+	LocalAddr() net.Addr
+	Close() error
+}
+
+// A mux owns a UDP socket and dispatches the packets it receives to
+// the SRT sockets bound to it: handshakes addressed to socket 0 go to
+// the listener, everything else to the socket with the destination ID.
+type mux struct {
+	pc    packetConn
+	laddr *net.UDPAddr
+
+	mu       sync.Mutex // protects the following
+	socks    map[uint32]*socket
+	listener *socket
+	refs     int
+}
+
+func newMux(network string, addr *net.UDPAddr) (*mux, error) {
+	pc, err := listenPacket(network, addr)
+	if err != nil {
+		return nil, err
+	}
+	return newMuxConn(pc), nil
+}
+
+// newMuxConn returns the mux owning pc.
+func newMuxConn(pc packetConn) *mux {
+	m := &mux{
+		pc:    pc,
+		laddr: pc.LocalAddr().(*net.UDPAddr),
+		socks: map[uint32]*socket{},
+	}
+	go m.run()
+	return m
+}
+
+func (m *mux) run() {
+	buf := make([]byte, 65536)
+	for {
+		n, from, err := m.pc.ReadFromUDP(buf)
+		if err != nil {
+			if ne, ok := err.(net.Error); ok && ne.Temporary() {
+				continue
+			}
+			return
+		}
+		p, err := parsePacket(append([]byte(nil), buf[:n]...))
+		if err != nil {
+			continue
+		}
+		m.dispatch(p, from)
+	}
+}
+
+func (m *mux) dispatch(p *packet, from *net.UDPAddr) {
+	m.mu.Lock()
+	var s *socket
+	if p.dst == 0 {
+		if p.ctrl && p.typ == ctrlHandshake {
+			s = m.listener
+		}
+	} else {
+		s = m.socks[p.dst]
+	}
+	m.mu.Unlock()
+	if s == nil {
+		return
+	}
+	if s.isListener() {
+		s.listenerInput(p, from)
+		return
+	}
+	s.input(p, from)
+}
+
+func (m *mux) send(p *packet, to *net.UDPAddr) {
+	m.pc.WriteToUDP(p.marshal(make([]byte, 0, headerSize+len(p.payload))), to)
+}
+
+// add registers s to receive the packets addressed to it.
+func (m *mux) add(s *socket) {
+	m.mu.Lock()
+	m.socks[uint32(s.id)] = s
+	m.refs++
+	m.mu.Unlock()
+}
+
+// remove unregisters s, closing the UDP socket along with the last one.
+func (m *mux) remove(s *socket) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.socks[uint32(s.id)] != s {
+		return
+	}
+	delete(m.socks, uint32(s.id))
+	if m.listener == s {
+		m.listener = nil
+	}
+	if m.refs--; m.refs == 0 {
+		m.pc.Close()
+	}
+}
+
+// listen makes s the socket receiving the listener handshakes.
+func (m *mux) listen(s *socket) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.listener != nil && m.listener != s {
+		return EDUPLISTEN
+	}
+	m.listener = s
+	return nil
+}
@@ -0,0 +1,671 @@
+// Copyright (c) 2020 CyberAgent, Inc. All rights reserved.
+// https://github.com/openfresh/gosrt
+
+package native
+
+import (
+	"bytes"
+	"encoding/hex"
+	"fmt"
+	"net"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestKeyWrap(t *testing.T) {
+	// RFC 3394 section 4.1.
+	kek, _ := hex.DecodeString("000102030405060708090A0B0C0D0E0F")
+	key, _ := hex.DecodeString("00112233445566778899AABBCCDDEEFF")
+	want, _ := hex.DecodeString("1FA68B0A8112B447AEF34BD8FB5A7B829D3E862371D2CFE5")
+	got, err := wrapKey(kek, key)
+	if err != nil || !bytes.Equal(got, want) {
+		t.Fatalf("wrapKey = %x, %v; want %x", got, err, want)
+	}
+	back, err := unwrapKey(kek, got)
+	if err != nil || !bytes.Equal(back, key) {
+		t.Fatalf("unwrapKey = %x, %v; want %x", back, err, key)
+	}
+	got[0] ^= 1
+	if _, err := unwrapKey(kek, got); err != errBadSecret {
+		t.Fatalf("unwrapKey of corrupted key: got %v, want %v", err, errBadSecret)
+	}
+}
+
+func TestLossList(t *testing.T) {
+	seqs := []uint32{seqMask - 1, seqMask, 0, 1, 5, 7, 8}
+	var got []uint32
+	parseLossList(marshalLossList(seqs), 100, func(s uint32) { got = append(got, s) })
+	if !reflect.DeepEqual(got, seqs) {
+		t.Fatalf("got %v, want %v", got, seqs)
+	}
+	got = got[:0]
+	parseLossList(appendUint32(appendUint32(nil, 0x80000000), 1000), 10, func(s uint32) { got = append(got, s) })
+	if len(got) != 10 {
+		t.Fatalf("range truncated to %d sequence numbers, want 10", len(got))
+	}
+}
+
+func TestStreamID(t *testing.T) {
+	for _, sid := range []string{"", "a", "abcd", "#!::r=live/feed,m=publish"} {
+		if got := parseSID(marshalSID(sid)); got != sid {
+			t.Errorf("got %q, want %q", got, sid)
+		}
+	}
+}
+
+func listen(t *testing.T, opts map[int]interface{}) (int, *net.UDPAddr) {
+	t.Helper()
+	l, _ := Socket()
+	for opt, v := range opts {
+		if err := SetOption(l, opt, v); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := Bind(l, &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)}); err != nil {
+		t.Fatal(err)
+	}
+	if err := Listen(l, 5); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { Close(l) })
+	addr, _ := Sockname(l)
+	return l, addr
+}
+
+func dial(t *testing.T, addr *net.UDPAddr, opts map[int]interface{}) (int, error) {
+	t.Helper()
+	c, _ := Socket()
+	t.Cleanup(func() { Close(c) })
+	for opt, v := range opts {
+		if err := SetOption(c, opt, v); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return c, Connect(c, addr)
+}
+
+func TestRoundTrip(t *testing.T) {
+	for _, pass := range []string{"", "0123456789abcdef"} {
+		t.Run(fmt.Sprintf("passphrase=%q", pass), func(t *testing.T) {
+			opts := map[int]interface{}{OptLatency: 20, OptPassphrase: pass}
+			l, addr := listen(t, opts)
+			var sid string
+			SetListenCallback(l, func(ns, hsversion int, peer *net.UDPAddr, streamid string) int {
+				sid = streamid
+				return 0
+			})
+			opts[OptStreamID] = "feed"
+			c, err := dial(t, addr, opts)
+			if err != nil {
+				t.Fatal(err)
+			}
+			a, _, err := Accept(l)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer Close(a)
+			if sid != "feed" {
+				t.Errorf("listen callback got stream ID %q, want %q", sid, "feed")
+			}
+			if v, _ := GetOption(a, OptStreamID); v != "feed" {
+				t.Errorf("accepted socket stream ID %q, want %q", v, "feed")
+			}
+			want := int32(KMUnsecured)
+			if pass != "" {
+				want = KMSecured
+			}
+			if v, _ := GetOption(a, OptKMState); v != want {
+				t.Errorf("KM state %v, want %v", v, want)
+			}
+
+			const n = 100
+			for i := 0; i < n; i++ {
+				if _, err := Send(c, []byte(fmt.Sprintf("message %d", i))); err != nil {
+					t.Fatal(err)
+				}
+			}
+			for i := 0; i < n; i++ {
+				want := fmt.Sprintf("message %d", i)
+				buf := make([]byte, 1500)
+				n, err := Recv(a, buf)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if string(buf[:n]) != want {
+					t.Fatalf("got %q, want %q", buf[:n], want)
+				}
+			}
+
+			Close(c)
+			if _, err := Recv(a, make([]byte, 1500)); err != ECONNLOST {
+				t.Fatalf("Recv after peer closed: got %v, want %v", err, ECONNLOST)
+			}
+		})
+	}
+}
+
+func TestLatency(t *testing.T) {
+	_, addr := listen(t, map[int]interface{}{OptRcvLatency: 200, OptPeerLatency: 0})
+	c, err := dial(t, addr, map[int]interface{}{OptLatency: 50})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v, _ := GetOption(c, OptPeerLatency); v != int32(200) {
+		t.Errorf("peer latency %v, want 200", v)
+	}
+	if v, _ := GetOption(c, OptRcvLatency); v != int32(50) {
+		t.Errorf("receiver latency %v, want 50", v)
+	}
+}
+
+func TestTSBPD(t *testing.T) {
+	l, addr := listen(t, map[int]interface{}{OptLatency: 200})
+	c, err := dial(t, addr, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	a, _, _ := Accept(l)
+	defer Close(a)
+	start := time.Now()
+	Send(c, []byte("x"))
+	if _, err := Recv(a, make([]byte, 1500)); err != nil {
+		t.Fatal(err)
+	}
+	if d := time.Since(start); d < 150*time.Millisecond {
+		t.Errorf("packet delivered after %v, before its play time", d)
+	}
+}
+
+func TestReject(t *testing.T) {
+	tests := []struct {
+		name       string
+		lopts      map[int]interface{}
+		copts      map[int]interface{}
+		callback   ListenCallback
+		wantReason int
+	}{
+		{
+			name:       "bad secret",
+			lopts:      map[int]interface{}{OptPassphrase: "0123456789abcdef"},
+			copts:      map[int]interface{}{OptPassphrase: "fedcba9876543210"},
+			wantReason: RejectBadSecret,
+		},
+		{
+			name:       "unsecure",
+			lopts:      map[int]interface{}{OptPassphrase: "0123456789abcdef"},
+			wantReason: RejectUnsecure,
+		},
+		{
+			name: "callback",
+			callback: func(ns, hsversion int, peer *net.UDPAddr, streamid string) int {
+				return -1
+			},
+			wantReason: RejectFallback,
+		},
+		{
+			name: "callback reason",
+			callback: func(ns, hsversion int, peer *net.UDPAddr, streamid string) int {
+				SetRejectReason(ns, RejectFallback+403)
+				return -1
+			},
+			wantReason: RejectFallback + 403,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			l, addr := listen(t, tt.lopts)
+			if tt.callback != nil {
+				SetListenCallback(l, tt.callback)
+			}
+			c, err := dial(t, addr, tt.copts)
+			if err != ECONNREJ {
+				t.Fatalf("got %v, want %v", err, ECONNREJ)
+			}
+			if r := RejectReason(c); r != tt.wantReason {
+				t.Errorf("reject reason %d, want %d", r, tt.wantReason)
+			}
+		})
+	}
+}
+
+func TestKeyRefresh(t *testing.T) {
+	opts := map[int]interface{}{OptPassphrase: "0123456789abcdef"}
+	l, addr := listen(t, opts)
+	opts[OptKMRefreshRate] = 8
+	opts[OptKMPreAnnounce] = 2
+	c, err := dial(t, addr, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	a, _, _ := Accept(l)
+	defer Close(a)
+	var sent, received []KeyEvent
+	SetKeyEventHandler(c, func(ev KeyEvent) { sent = append(sent, ev) })
+	SetKeyEventHandler(a, func(ev KeyEvent) { received = append(received, ev) })
+
+	const n = 20
+	for i := 0; i < n; i++ {
+		Send(c, []byte(fmt.Sprintf("message %d", i)))
+		// Give the KMREQ time to get ahead of the packets using its key.
+		time.Sleep(time.Millisecond)
+	}
+	for i := 0; i < n; i++ {
+		want := fmt.Sprintf("message %d", i)
+		buf := make([]byte, 1500)
+		n, err := Recv(a, buf)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(buf[:n]) != want {
+			t.Fatalf("got %q, want %q", buf[:n], want)
+		}
+	}
+	var want []KeyEvent
+	for _, ev := range []KeyEvent{
+		{Kind: KeyAnnounced, Key: KeyOdd},
+		{Kind: KeySwitched, Key: KeyOdd},
+		{Kind: KeyRetired, Key: KeyEven},
+		{Kind: KeyAnnounced, Key: KeyEven},
+		{Kind: KeySwitched, Key: KeyEven},
+		{Kind: KeyRetired, Key: KeyOdd},
+	} {
+		ev.Sender = true
+		want = append(want, ev)
+	}
+	if !reflect.DeepEqual(sent, want) {
+		t.Errorf("sender events %v, want %v", sent, want)
+	}
+	for i := range want {
+		want[i].Sender = false
+	}
+	if !reflect.DeepEqual(received, want) {
+		t.Errorf("receiver events %v, want %v", received, want)
+	}
+}
+
+func TestConnectTimeout(t *testing.T) {
+	pc, err := listenPacket("udp4", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pc.Close()
+	_, err = dial(t, pc.LocalAddr().(*net.UDPAddr), map[int]interface{}{OptConnTimeo: 300})
+	if err != ENOSERVER {
+		t.Fatalf("got %v, want %v", err, ENOSERVER)
+	}
+}
+
+// TestRetransmission relays the connection through a proxy that drops
+// the first data packet, which must then be retransmitted.
+func TestRetransmission(t *testing.T) {
+	proxy, err := listenPacket("udp4", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer proxy.Close()
+	l, addr := listen(t, map[int]interface{}{OptLatency: 300})
+	go func() {
+		buf := make([]byte, 1500)
+		var caller *net.UDPAddr
+		dropped := false
+		for {
+			n, from, err := proxy.ReadFromUDP(buf)
+			if err != nil {
+				return
+			}
+			if from.Port != addr.Port {
+				caller = from
+				if p, err := parsePacket(buf[:n]); err == nil && !p.ctrl && !dropped {
+					dropped = true
+					continue
+				}
+				proxy.WriteToUDP(buf[:n], addr)
+			} else if caller != nil {
+				proxy.WriteToUDP(buf[:n], caller)
+			}
+		}
+	}()
+	c, err := dial(t, proxy.LocalAddr().(*net.UDPAddr), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	a, _, _ := Accept(l)
+	defer Close(a)
+	for _, m := range []string{"one", "two"} {
+		Send(c, []byte(m))
+	}
+	for _, want := range []string{"one", "two"} {
+		buf := make([]byte, 1500)
+		n, err := Recv(a, buf)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(buf[:n]) != want {
+			t.Fatalf("got %q, want %q", buf[:n], want)
+		}
+	}
+	st, _ := Bstats(c, false)
+	if st.PktRetransTotal == 0 {
+		t.Error("no packet was retransmitted")
+	}
+	gaps, n, pkts, err := Gaps(a)
+	if err != nil || len(gaps) != 1 || n != 1 || pkts != 1 {
+		t.Fatalf("gaps %+v, %d of %d packets, %v; want the first packet", gaps, n, pkts, err)
+	}
+	if g := gaps[0]; g.First != g.Last || g.Packets != 1 || g.Recovered != 1 || g.Dropped != 0 || g.Resolved.Before(g.Detected) {
+		t.Errorf("gap %+v; want a packet recovered", g)
+	}
+}
+
+// TestDropEvents relays the connection through a proxy that loses two
+// packets for good: the receiver skips the first once its successor is
+// due, and the sender, never acknowledged for the second, drops it, and
+// has the receiver drop it too.
+func TestDropEvents(t *testing.T) {
+	proxy, err := listenPacket("udp4", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer proxy.Close()
+	l, addr := listen(t, map[int]interface{}{OptLatency: 50})
+	lost := make(chan uint32, 2)
+	go func() {
+		buf := make([]byte, 1500)
+		var caller *net.UDPAddr
+		seen := map[string]bool{}
+		for {
+			n, from, err := proxy.ReadFromUDP(buf)
+			if err != nil {
+				return
+			}
+			if from.Port != addr.Port {
+				caller = from
+				if p, err := parsePacket(buf[:n]); err == nil && !p.ctrl && (string(p.payload) == "two" || string(p.payload) == "four") {
+					if !seen[string(p.payload)] {
+						seen[string(p.payload)] = true
+						lost <- p.seq
+					}
+					continue
+				}
+				proxy.WriteToUDP(buf[:n], addr)
+			} else if caller != nil {
+				proxy.WriteToUDP(buf[:n], caller)
+			}
+		}
+	}()
+	c, err := dial(t, proxy.LocalAddr().(*net.UDPAddr), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer Close(c)
+	a, _, _ := Accept(l)
+	defer Close(a)
+	sent := make(chan DropEvent, 2)
+	received := make(chan DropEvent, 2)
+	SetDropHandler(c, func(ev DropEvent) { sent <- ev })
+	SetDropHandler(a, func(ev DropEvent) { received <- ev })
+
+	for _, m := range []string{"one", "two", "three", "four"} {
+		Send(c, []byte(m))
+	}
+	for _, want := range []string{"one", "three"} {
+		buf := make([]byte, 1500)
+		n, err := Recv(a, buf)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(buf[:n]) != want {
+			t.Fatalf("got %q, want %q", buf[:n], want)
+		}
+	}
+	two, four := <-lost, <-lost
+	for _, tt := range []struct {
+		events <-chan DropEvent
+		want   DropEvent
+	}{
+		{received, DropEvent{First: two, Last: two, Packets: 1}},
+		{sent, DropEvent{First: four, Last: four, Packets: 1, Sender: true}},
+		{received, DropEvent{First: four, Last: four, Packets: 1}},
+	} {
+		select {
+		case ev := <-tt.events:
+			if ev != tt.want {
+				t.Errorf("got %+v, want %+v", ev, tt.want)
+			}
+		case <-time.After(3 * time.Second):
+			t.Errorf("no event %+v", tt.want)
+		}
+	}
+
+	// The second loss was never a gap, nothing coming after it.
+	gaps, _, _, _ := Gaps(a)
+	if len(gaps) != 1 || gaps[0].First != two || gaps[0].Dropped != 1 || gaps[0].Resolved.IsZero() {
+		t.Errorf("gaps %+v; want the first loss, dropped", gaps)
+	}
+}
+
+// TestDeliveryReports loses a tracked message for good, which its TTL
+// drops on the first retransmission asked for past it, well before the
+// receiver would skip it.
+func TestDeliveryReports(t *testing.T) {
+	proxy, err := listenPacket("udp4", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer proxy.Close()
+	l, addr := listen(t, map[int]interface{}{OptLatency: 1000})
+	go func() {
+		buf := make([]byte, 1500)
+		var caller *net.UDPAddr
+		for {
+			n, from, err := proxy.ReadFromUDP(buf)
+			if err != nil {
+				return
+			}
+			if from.Port != addr.Port {
+				caller = from
+				if p, err := parsePacket(buf[:n]); err == nil && !p.ctrl && string(p.payload) == "two" {
+					continue
+				}
+				proxy.WriteToUDP(buf[:n], addr)
+			} else if caller != nil {
+				proxy.WriteToUDP(buf[:n], caller)
+			}
+		}
+	}()
+	c, err := dial(t, proxy.LocalAddr().(*net.UDPAddr), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer Close(c)
+	a, _, _ := Accept(l)
+	defer Close(a)
+	type report struct {
+		msgno     uint32
+		delivered bool
+	}
+	reports := make(chan report, 3)
+	SetDeliveryHandler(c, func(msgno uint32, delivered bool) { reports <- report{msgno, delivered} })
+
+	want := map[uint32]bool{}
+	for _, m := range []string{"one", "two", "three", "untracked"} {
+		_, msgno, err := SendMsgCtrl(c, []byte(m), MsgCtrl{TTL: 50 * time.Millisecond, Track: m != "untracked"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if m != "untracked" {
+			want[msgno] = m != "two"
+		}
+	}
+	for _, m := range []string{"one", "three", "untracked"} {
+		buf := make([]byte, 1500)
+		n, err := Recv(a, buf)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(buf[:n]) != m {
+			t.Fatalf("got %q, want %q", buf[:n], m)
+		}
+	}
+	got := map[uint32]bool{}
+	for len(got) < len(want) {
+		select {
+		case r := <-reports:
+			got[r.msgno] = r.delivered
+		case <-time.After(3 * time.Second):
+			t.Fatalf("got reports %v, want %v", got, want)
+		}
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got reports %v, want %v", got, want)
+	}
+}
+
+// windowCC holds a connection to a window of 4 packets, paced 1ms
+// apart, counting what it is told.
+type windowCC struct {
+	mu          sync.Mutex
+	acked, pkts int
+}
+
+func (cc *windowCC) OnACK(acked int, rtt time.Duration) {
+	cc.mu.Lock()
+	cc.acked += acked
+	cc.mu.Unlock()
+}
+
+func (cc *windowCC) OnLoss(int) {}
+
+func (cc *windowCC) Pacing(size int) time.Duration {
+	cc.mu.Lock()
+	cc.pkts++
+	cc.mu.Unlock()
+	return time.Millisecond
+}
+
+func (cc *windowCC) Window() int { return 4 }
+
+func TestCongestionControl(t *testing.T) {
+	if err := RegisterCongestion("live", func(CongestionParams) CongestionControl { return &windowCC{} }); err != EINVPARAM {
+		t.Errorf("registering live: got %v, want %v", err, EINVPARAM)
+	}
+	cc := &windowCC{}
+	if err := RegisterCongestion("test-window", func(CongestionParams) CongestionControl { return cc }); err != nil {
+		t.Fatal(err)
+	}
+	s, _ := Socket()
+	defer Close(s)
+	if err := SetOption(s, OptCongestion, "unknown"); err != EINVPARAM {
+		t.Errorf("OptCongestion unknown: got %v, want %v", err, EINVPARAM)
+	}
+
+	l, addr := listen(t, map[int]interface{}{OptLatency: 20})
+	c, err := dial(t, addr, map[int]interface{}{OptCongestion: "test-window"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer Close(c)
+	a, _, _ := Accept(l)
+	defer Close(a)
+	const n = 40
+	for i := 0; i < n; i++ {
+		if _, err := Send(c, []byte(fmt.Sprintf("message %d", i))); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if st, _ := Bstats(c, false); st.PktFlightSize > 4 || st.PktCongestionWindow != 4 {
+		t.Fatalf("flight size %d, congestion window %d; want at most 4, and 4", st.PktFlightSize, st.PktCongestionWindow)
+	}
+	for i := 0; i < n; i++ {
+		want := fmt.Sprintf("message %d", i)
+		buf := make([]byte, 1500)
+		m, err := Recv(a, buf)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(buf[:m]) != want {
+			t.Fatalf("got %q, want %q", buf[:m], want)
+		}
+	}
+	deadline := time.Now().Add(3 * time.Second)
+	for {
+		cc.mu.Lock()
+		acked, pkts := cc.acked, cc.pkts
+		cc.mu.Unlock()
+		if acked == n && pkts == n {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("%d packets sent, %d acknowledged; want %d", pkts, acked, n)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+// TestPacing has the live congestion control pace packets of 1000
+// bytes to OptMaxBW, 10ms apart, whether it is set before connecting
+// or after.
+func TestPacing(t *testing.T) {
+	t.Run("before", func(t *testing.T) { testPacing(t, false) })
+	t.Run("after", func(t *testing.T) { testPacing(t, true) })
+}
+
+func testPacing(t *testing.T, after bool) {
+	const maxBW = int64(100 * (1000 + packetOverhead))
+	l, addr := listen(t, map[int]interface{}{OptLatency: 20})
+	opts := map[int]interface{}{OptMaxBW: maxBW}
+	if after {
+		opts = nil
+	}
+	c, err := dial(t, addr, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer Close(c)
+	if after {
+		if err := SetOption(c, OptMaxBW, maxBW); err != nil {
+			t.Fatal(err)
+		}
+	}
+	a, _, _ := Accept(l)
+	defer Close(a)
+	const n = 20
+	start := time.Now()
+	for i := 0; i < n; i++ {
+		if _, err := Send(c, make([]byte, 1000)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for i := 0; i < n; i++ {
+		if _, err := Recv(a, make([]byte, 1500)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if d := time.Since(start); d < (n-1)*10*time.Millisecond {
+		t.Errorf("%d packets took %v; want at least %v", n, d, (n-1)*10*time.Millisecond)
+	}
+}
+
+func TestEpoll(t *testing.T) {
+	l, addr := listen(t, nil)
+	eid, _ := EpollCreate()
+	defer EpollRelease(eid)
+	if err := EpollAdd(eid, l, EpollIn|EpollET); err != nil {
+		t.Fatal(err)
+	}
+	if evs, err := EpollWait(eid, 10, 50*time.Millisecond); err != nil || len(evs) != 0 {
+		t.Fatalf("got %v, %v; want a timeout", evs, err)
+	}
+	if _, err := dial(t, addr, nil); err != nil {
+		t.Fatal(err)
+	}
+	evs, err := EpollWait(eid, 10, time.Second)
+	if err != nil || len(evs) != 1 || evs[0] != (Event{Fd: l, Events: EpollIn}) {
+		t.Fatalf("got %v, %v; want a read event", evs, err)
+	}
+	if evs, _ := EpollWait(eid, 10, 50*time.Millisecond); len(evs) != 0 {
+		t.Fatalf("edge triggered event reported again: %v", evs)
+	}
+}
@@ -0,0 +1,445 @@
+// Copyright (c) 2020 CyberAgent, Inc. All rights reserved.
+// https://github.com/openfresh/gosrt
+
+package native
+
+// Socket options. The values are those of libsrt's SRT_SOCKOPT.
+const (
+	OptMSS                = 0
+	OptSndSyn             = 1
+	OptRcvSyn             = 2
+	OptISN                = 3
+	OptFC                 = 4
+	OptSndBuf             = 5
+	OptRcvBuf             = 6
+	OptLinger             = 7
+	OptUDPSndBuf          = 8
+	OptUDPRcvBuf          = 9
+	OptRendezvous         = 12
+	OptSndTimeo           = 13
+	OptRcvTimeo           = 14
+	OptReuseAddr          = 15
+	OptMaxBW              = 16
+	OptState              = 17
+	OptEvent              = 18
+	OptSndData            = 19
+	OptRcvData            = 20
+	OptSender             = 21
+	OptTsbpdMode          = 22
+	OptLatency            = 23
+	OptInputBW            = 24
+	OptOheadBW            = 25
+	OptPassphrase         = 26
+	OptPBKeyLen           = 27
+	OptKMState            = 28
+	OptIPTTL              = 29
+	OptIPTOS              = 30
+	OptTLPktDrop          = 31
+	OptSndDropDelay       = 32
+	OptNAKReport          = 33
+	OptVersion            = 34
+	OptPeerVersion        = 35
+	OptConnTimeo          = 36
+	OptDriftTracer        = 37
+	OptMinInputBW         = 38
+	OptSndKMState         = 40
+	OptRcvKMState         = 41
+	OptLossMaxTTL         = 42
+	OptRcvLatency         = 43
+	OptPeerLatency        = 44
+	OptMinVersion         = 45
+	OptStreamID           = 46
+	OptCongestion         = 47
+	OptMessageAPI         = 48
+	OptPayloadSize        = 49
+	OptTransType          = 50
+	OptKMRefreshRate      = 51
+	OptKMPreAnnounce      = 52
+	OptEnforcedEncryption = 53
+	OptIPv6Only           = 54
+	OptPeerIdleTimeo      = 55
+	OptBindToDevice       = 56
+	OptPacketFilter       = 60
+	OptRetransmitAlgo     = 61
+)
+
+// Socket states. The values are those of libsrt's SRT_SOCKSTATUS.
+const (
+	StatusInit       = 1
+	StatusOpened     = 2
+	StatusListening  = 3
+	StatusConnecting = 4
+	StatusConnected  = 5
+	StatusBroken     = 6
+	StatusClosing    = 7
+	StatusClosed     = 8
+	StatusNonexist   = 9
+)
+
+// Transmission types.
+const (
+	TransLive    = 0
+	TransFile    = 1
+	TransInvalid = 2
+)
+
+// Kind is the type of the value of a socket option.
+type Kind int
+
+// Option value kinds. Int options are 32 bits wide, Int64 ones 64.
+const (
+	KindInt Kind = iota
+	KindInt64
+	KindBool
+	KindString
+)
+
+var optKinds = map[int]Kind{
+	OptMSS: KindInt, OptSndSyn: KindBool, OptRcvSyn: KindBool, OptISN: KindInt,
+	OptFC: KindInt, OptSndBuf: KindInt, OptRcvBuf: KindInt, OptLinger: KindInt,
+	OptUDPSndBuf: KindInt, OptUDPRcvBuf: KindInt, OptRendezvous: KindBool,
+	OptSndTimeo: KindInt, OptRcvTimeo: KindInt, OptReuseAddr: KindBool,
+	OptMaxBW: KindInt64, OptState: KindInt, OptEvent: KindInt, OptSndData: KindInt,
+	OptRcvData: KindInt, OptSender: KindBool, OptTsbpdMode: KindBool,
+	OptLatency: KindInt, OptInputBW: KindInt64, OptOheadBW: KindInt,
+	OptPassphrase: KindString, OptPBKeyLen: KindInt, OptKMState: KindInt,
+	OptIPTTL: KindInt, OptIPTOS: KindInt, OptTLPktDrop: KindBool,
+	OptSndDropDelay: KindInt, OptNAKReport: KindBool, OptVersion: KindInt,
+	OptPeerVersion: KindInt, OptConnTimeo: KindInt, OptDriftTracer: KindBool,
+	OptMinInputBW: KindInt64, OptSndKMState: KindInt, OptRcvKMState: KindInt,
+	OptLossMaxTTL: KindInt, OptRcvLatency: KindInt, OptPeerLatency: KindInt,
+	OptMinVersion: KindInt, OptStreamID: KindString, OptCongestion: KindString,
+	OptMessageAPI: KindBool, OptPayloadSize: KindInt, OptTransType: KindInt,
+	OptKMRefreshRate: KindInt, OptKMPreAnnounce: KindInt,
+	OptEnforcedEncryption: KindBool, OptIPv6Only: KindInt, OptPeerIdleTimeo: KindInt,
+	OptBindToDevice: KindString, OptPacketFilter: KindString, OptRetransmitAlgo: KindInt,
+}
+
+// OptionKind returns the kind of value opt takes.
+func OptionKind(opt int) (Kind, bool) {
+	k, ok := optKinds[opt]
+	return k, ok
+}
+
+// options holds the settable options of a socket.
+type options struct {
+	mss          int
+	sndSyn       bool
+	rcvSyn       bool
+	fc           int
+	sndBuf       int // bytes
+	rcvBuf       int // bytes
+	sndTimeo     int // ms, -1 for none
+	rcvTimeo     int // ms, -1 for none
+	rcvLatency   int // ms
+	peerLatency  int // ms
+	passphrase   string
+	pbKeyLen     int
+	tlPktDrop    bool
+	sndDropDelay int // ms
+	nakReport    bool
+	connTimeo    int // ms
+	streamID     string
+	messageAPI   bool
+	payloadSize  int
+	transType    int
+	enforced     bool
+	peerIdle     int // ms
+	rendezvous   bool
+
+	// Options that are accepted and reported back, but that don't
+	// change how the connection behaves.
+	extra map[int]interface{}
+}
+
+func defaultOptions() options {
+	return options{
+		mss:         1500,
+		sndSyn:      true,
+		rcvSyn:      true,
+		fc:          25600,
+		sndBuf:      8192 * (1500 - udpHeader),
+		rcvBuf:      8192 * (1500 - udpHeader),
+		sndTimeo:    -1,
+		rcvTimeo:    -1,
+		rcvLatency:  120,
+		peerLatency: 0,
+		tlPktDrop:   true,
+		nakReport:   true,
+		connTimeo:   3000,
+		messageAPI:  true,
+		payloadSize: 1316,
+		transType:   TransLive,
+		enforced:    true,
+		peerIdle:    5000,
+		extra: map[int]interface{}{
+			OptLinger:        int32(0),
+			OptUDPSndBuf:     int32(65536),
+			OptUDPRcvBuf:     int32(65536),
+			OptReuseAddr:     true,
+			OptMaxBW:         int64(-1),
+			OptInputBW:       int64(0),
+			OptMinInputBW:    int64(0),
+			OptOheadBW:       int32(25),
+			OptIPTTL:         int32(64),
+			OptIPTOS:         int32(0xb8),
+			OptSender:        false,
+			OptTsbpdMode:     true,
+			OptDriftTracer:   true,
+			OptLossMaxTTL:    int32(0),
+			OptMinVersion:    int32(0x010000),
+			OptCongestion:    "live",
+			OptKMRefreshRate: int32(0x1000000),
+			OptKMPreAnnounce: int32(0x1000),
+			OptIPv6Only:      int32(-1),
+			OptBindToDevice:  "",
+			OptPacketFilter:  "",
+		},
+	}
+}
+
+// clone returns a copy of o that shares nothing with it, for sockets
+// accepted by a listener.
+func (o *options) clone() options {
+	c := *o
+	c.extra = make(map[int]interface{}, len(o.extra))
+	for k, v := range o.extra {
+		c.extra[k] = v
+	}
+	return c
+}
+
+// maxPayload is the largest payload a packet can carry.
+func (o *options) maxPayload() int {
+	return o.mss - udpHeader - headerSize
+}
+
+func toInt(v interface{}) (int, bool) {
+	switch v := v.(type) {
+	case int:
+		return v, true
+	case int32:
+		return int(v), true
+	case int64:
+		return int(v), true
+	case bool:
+		if v {
+			return 1, true
+		}
+		return 0, true
+	}
+	return 0, false
+}
+
+// set sets the option opt.
+func (o *options) set(opt int, v interface{}) error {
+	kind, ok := optKinds[opt]
+	if !ok {
+		return EINVOP
+	}
+	var n int
+	var s string
+	if kind == KindString {
+		if s, ok = v.(string); !ok {
+			return EINVPARAM
+		}
+	} else if n, ok = toInt(v); !ok {
+		return EINVPARAM
+	}
+	b := n != 0
+	switch opt {
+	case OptState, OptEvent, OptSndData, OptRcvData, OptKMState, OptSndKMState,
+		OptRcvKMState, OptVersion, OptPeerVersion, OptISN:
+		return EINVOP
+	case OptMSS:
+		if n < 76 || n > 65536 {
+			return EINVPARAM
+		}
+		o.mss = n
+	case OptSndSyn:
+		o.sndSyn = b
+	case OptRcvSyn:
+		o.rcvSyn = b
+	case OptFC:
+		if n < 32 {
+			return EINVPARAM
+		}
+		o.fc = n
+	case OptSndBuf:
+		if n <= 0 {
+			return EINVPARAM
+		}
+		o.sndBuf = n
+	case OptRcvBuf:
+		if n <= 0 {
+			return EINVPARAM
+		}
+		o.rcvBuf = n
+	case OptSndTimeo:
+		o.sndTimeo = n
+	case OptRcvTimeo:
+		o.rcvTimeo = n
+	case OptLatency:
+		if n < 0 {
+			return EINVPARAM
+		}
+		o.rcvLatency, o.peerLatency = n, n
+	case OptRcvLatency:
+		if n < 0 {
+			return EINVPARAM
+		}
+		o.rcvLatency = n
+	case OptPeerLatency:
+		if n < 0 {
+			return EINVPARAM
+		}
+		o.peerLatency = n
+	case OptPassphrase:
+		if s != "" && (len(s) < 10 || len(s) > 79) {
+			return EINVPARAM
+		}
+		o.passphrase = s
+	case OptPBKeyLen:
+		switch n {
+		case 0, 16, 24, 32:
+		default:
+			return EINVPARAM
+		}
+		o.pbKeyLen = n
+	case OptTLPktDrop:
+		o.tlPktDrop = b
+	case OptSndDropDelay:
+		o.sndDropDelay = n
+	case OptNAKReport:
+		o.nakReport = b
+	case OptConnTimeo:
+		if n < 0 {
+			return EINVPARAM
+		}
+		o.connTimeo = n
+	case OptStreamID:
+		if len(s) > 512 {
+			return EINVPARAM
+		}
+		o.streamID = s
+	case OptMessageAPI:
+		o.messageAPI = b
+	case OptPayloadSize:
+		if n < 0 || n > o.maxPayload() {
+			return EINVPARAM
+		}
+		o.payloadSize = n
+	case OptTransType:
+		switch n {
+		case TransLive:
+			o.payloadSize, o.messageAPI, o.tlPktDrop = 1316, true, true
+		case TransFile:
+			// Only live mode is implemented.
+			return EINVOP
+		default:
+			return EINVPARAM
+		}
+		o.transType = n
+	case OptEnforcedEncryption:
+		o.enforced = b
+	case OptPeerIdleTimeo:
+		if n < 0 {
+			return EINVPARAM
+		}
+		o.peerIdle = n
+	case OptRendezvous:
+		o.rendezvous = b
+	case OptCongestion:
+		if congestionFactory(s) == nil {
+			return EINVPARAM
+		}
+		o.extra[opt] = s
+	case OptPacketFilter:
+		if s != "" {
+			// Packet filters (FEC) aren't implemented.
+			return EINVPARAM
+		}
+		o.extra[opt] = s
+	default:
+		switch kind {
+		case KindInt:
+			o.extra[opt] = int32(n)
+		case KindInt64:
+			o.extra[opt] = int64(n)
+		case KindBool:
+			o.extra[opt] = b
+		case KindString:
+			o.extra[opt] = s
+		}
+	}
+	return nil
+}
+
+// get returns the value of a settable option, as an int32, int64, bool
+// or string depending on its kind.
+func (o *options) get(opt int) (interface{}, bool) {
+	switch opt {
+	case OptMSS:
+		return int32(o.mss), true
+	case OptSndSyn:
+		return o.sndSyn, true
+	case OptRcvSyn:
+		return o.rcvSyn, true
+	case OptFC:
+		return int32(o.fc), true
+	case OptSndBuf:
+		return int32(o.sndBuf), true
+	case OptRcvBuf:
+		return int32(o.rcvBuf), true
+	case OptSndTimeo:
+		return int32(o.sndTimeo), true
+	case OptRcvTimeo:
+		return int32(o.rcvTimeo), true
+	case OptLatency, OptRcvLatency:
+		return int32(o.rcvLatency), true
+	case OptPeerLatency:
+		return int32(o.peerLatency), true
+	case OptPassphrase:
+		return o.passphrase, true
+	case OptPBKeyLen:
+		return int32(o.pbKeyLen), true
+	case OptTLPktDrop:
+		return o.tlPktDrop, true
+	case OptSndDropDelay:
+		return int32(o.sndDropDelay), true
+	case OptNAKReport:
+		return o.nakReport, true
+	case OptConnTimeo:
+		return int32(o.connTimeo), true
+	case OptStreamID:
+		return o.streamID, true
+	case OptMessageAPI:
+		return o.messageAPI, true
+	case OptPayloadSize:
+		return int32(o.payloadSize), true
+	case OptTransType:
+		return int32(o.transType), true
+	case OptEnforcedEncryption:
+		return o.enforced, true
+	case OptPeerIdleTimeo:
+		return int32(o.peerIdle), true
+	case OptRendezvous:
+		return o.rendezvous, true
+	case OptVersion:
+		return int32(srtVersion), true
+	}
+	v, ok := o.extra[opt]
+	return v, ok
+}
+
+// keyLen returns the encryption key length to use, or 0 if the socket
+// doesn't encrypt.
+func (o *options) keyLen() int {
+	if o.passphrase == "" {
+		return 0
+	}
+	if o.pbKeyLen == 0 {
+		return 16
+	}
+	return o.pbKeyLen
+}
@@ -0,0 +1,420 @@
+// Copyright (c) 2020 CyberAgent, Inc. All rights reserved.
+// https://github.com/openfresh/gosrt
+
+package native
+
+import (
+	"encoding/binary"
+	"errors"
+	"net"
+)
+
+// SRT packet header layout.
+const (
+	headerSize = 16 // bytes
+	udpHeader  = 28 // IPv4 + UDP header size, as counted by SRTO_MSS
+)
+
+// Control packet types.
+const (
+	ctrlHandshake = 0x0000
+	ctrlKeepalive = 0x0001
+	ctrlACK       = 0x0002
+	ctrlNAK       = 0x0003
+	ctrlCongWarn  = 0x0004
+	ctrlShutdown  = 0x0005
+	ctrlACKACK    = 0x0006
+	ctrlDropReq   = 0x0007
+	ctrlPeerError = 0x0008
+	ctrlUser      = 0x7fff
+)
+
+// Packet position flags of a data packet (PP field).
+const (
+	ppMiddle = 0
+	ppLast   = 1
+	ppFirst  = 2
+	ppSolo   = 3
+)
+
+// Encryption key flags of a data packet (KK field).
+const (
+	kkNone = 0
+	kkEven = 1
+	kkOdd  = 2
+)
+
+var errShortPacket = errors.New("short packet")
+
+// packet is a decoded SRT packet. Control and data packets share it;
+// ctrl tells them apart.
+type packet struct {
+	ctrl bool
+	ts   uint32 // timestamp in microseconds since the sender's start
+	dst  uint32 // destination socket ID
+
+	// control packets
+	typ  uint16
+	sub  uint16
+	info uint32 // type-specific information
+
+	// data packets
+	seq    uint32
+	pp     uint8
+	order  bool
+	kk     uint8
+	rexmit bool
+	msgno  uint32
+
+	payload []byte // CIF for control packets
+}
+
+func parsePacket(b []byte) (*packet, error) {
+	if len(b) < headerSize {
+		return nil, errShortPacket
+	}
+	p := &packet{}
+	w0 := binary.BigEndian.Uint32(b[0:])
+	w1 := binary.BigEndian.Uint32(b[4:])
+	p.ts = binary.BigEndian.Uint32(b[8:])
+	p.dst = binary.BigEndian.Uint32(b[12:])
+	p.payload = b[headerSize:]
+	if w0&0x80000000 != 0 {
+		p.ctrl = true
+		p.typ = uint16(w0>>16) & 0x7fff
+		p.sub = uint16(w0)
+		p.info = w1
+		return p, nil
+	}
+	p.seq = w0
+	p.pp = uint8(w1 >> 30)
+	p.order = w1&(1<<29) != 0
+	p.kk = uint8(w1>>27) & 3
+	p.rexmit = w1&(1<<26) != 0
+	p.msgno = w1 & 0x03ffffff
+	return p, nil
+}
+
+// marshal appends the wire form of p to b.
+func (p *packet) marshal(b []byte) []byte {
+	var w0, w1 uint32
+	if p.ctrl {
+		w0 = 0x80000000 | uint32(p.typ)<<16 | uint32(p.sub)
+		w1 = p.info
+	} else {
+		w0 = p.seq & seqMask
+		w1 = uint32(p.pp)<<30 | uint32(p.kk)<<27 | p.msgno&0x03ffffff
+		if p.order {
+			w1 |= 1 << 29
+		}
+		if p.rexmit {
+			w1 |= 1 << 26
+		}
+	}
+	b = appendUint32(b, w0)
+	b = appendUint32(b, w1)
+	b = appendUint32(b, p.ts)
+	b = appendUint32(b, p.dst)
+	return append(b, p.payload...)
+}
+
+func appendUint32(b []byte, v uint32) []byte {
+	return append(b, byte(v>>24), byte(v>>16), byte(v>>8), byte(v))
+}
+
+// Sequence numbers are 31 bits wide and wrap around.
+const seqMask = 0x7fffffff
+
+func seqInc(s uint32) uint32 { return (s + 1) & seqMask }
+
+func seqAdd(s uint32, n int) uint32 { return uint32(int64(s)+int64(n)) & seqMask }
+
+// seqDiff returns a-b, taking wrap around into account.
+func seqDiff(a, b uint32) int {
+	return int(int32((a-b)<<1) >> 1)
+}
+
+// seqLess reports whether a precedes b.
+func seqLess(a, b uint32) bool { return seqDiff(a, b) < 0 }
+
+// Message numbers are 26 bits wide.
+func msgInc(n uint32) uint32 {
+	n = (n + 1) & 0x03ffffff
+	if n == 0 {
+		n = 1
+	}
+	return n
+}
+
+// Handshake types.
+const (
+	hsWaveahand  = 0
+	hsInduction  = 1
+	hsConclusion = 0xffffffff
+	hsAgreement  = 0xfffffffe
+	hsDone       = 0xfffffffd
+
+	// A rejected handshake carries hsFailure plus the reject reason.
+	hsFailure = 1000
+)
+
+// Handshake extension flags and types.
+const (
+	hsExtHSREQ  = 1
+	hsExtKMREQ  = 2
+	hsExtConfig = 4
+
+	extHSREQ   = 1
+	extHSRSP   = 2
+	extKMREQ   = 3
+	extKMRSP   = 4
+	extSID     = 5
+	extCONGEST = 6
+	extFILTER  = 7
+	extGROUP   = 8
+
+	srtMagic = 0x4a17
+)
+
+// SRT HSREQ/HSRSP flags.
+const (
+	flagTSBPDSND    = 0x01
+	flagTSBPDRCV    = 0x02
+	flagCrypt       = 0x04
+	flagTLPKTDROP   = 0x08
+	flagPERIODICNAK = 0x10
+	flagREXMITFLG   = 0x20
+	flagStream      = 0x40
+	flagFilter      = 0x80
+)
+
+// Version is the version of libsrt whose protocol is implemented here.
+// srtVersion is the same, as exchanged in HSREQ.
+const (
+	Version    = "1.4.2"
+	srtVersion = 0x010402
+)
+
+const hsSize = 48 // handshake CIF without extensions
+
+// handshake is the handshake control information field.
+type handshake struct {
+	version  uint32
+	encfield uint16
+	extfield uint16
+	isn      uint32
+	mss      uint32
+	fc       uint32
+	typ      uint32
+	id       uint32
+	cookie   uint32
+	peerIP   [16]byte
+
+	exts []hsExt
+}
+
+// hsExt is a handshake extension block.
+type hsExt struct {
+	typ  uint16
+	data []byte // a multiple of 4 bytes
+}
+
+func parseHandshake(b []byte) (*handshake, error) {
+	if len(b) < hsSize {
+		return nil, errShortPacket
+	}
+	hs := &handshake{
+		version:  binary.BigEndian.Uint32(b[0:]),
+		encfield: binary.BigEndian.Uint16(b[4:]),
+		extfield: binary.BigEndian.Uint16(b[6:]),
+		isn:      binary.BigEndian.Uint32(b[8:]),
+		mss:      binary.BigEndian.Uint32(b[12:]),
+		fc:       binary.BigEndian.Uint32(b[16:]),
+		typ:      binary.BigEndian.Uint32(b[20:]),
+		id:       binary.BigEndian.Uint32(b[24:]),
+		cookie:   binary.BigEndian.Uint32(b[28:]),
+	}
+	copy(hs.peerIP[:], b[32:48])
+	b = b[hsSize:]
+	for len(b) >= 4 {
+		typ := binary.BigEndian.Uint16(b[0:])
+		n := int(binary.BigEndian.Uint16(b[2:])) * 4
+		b = b[4:]
+		if n > len(b) {
+			return nil, errShortPacket
+		}
+		hs.exts = append(hs.exts, hsExt{typ: typ, data: b[:n]})
+		b = b[n:]
+	}
+	return hs, nil
+}
+
+func (hs *handshake) marshal() []byte {
+	b := make([]byte, 0, hsSize+64)
+	b = appendUint32(b, hs.version)
+	b = append(b, byte(hs.encfield>>8), byte(hs.encfield), byte(hs.extfield>>8), byte(hs.extfield))
+	b = appendUint32(b, hs.isn)
+	b = appendUint32(b, hs.mss)
+	b = appendUint32(b, hs.fc)
+	b = appendUint32(b, hs.typ)
+	b = appendUint32(b, hs.id)
+	b = appendUint32(b, hs.cookie)
+	b = append(b, hs.peerIP[:]...)
+	for _, e := range hs.exts {
+		b = append(b, byte(e.typ>>8), byte(e.typ), byte(len(e.data)/4>>8), byte(len(e.data)/4))
+		b = append(b, e.data...)
+	}
+	return b
+}
+
+func (hs *handshake) ext(typ uint16) []byte {
+	for _, e := range hs.exts {
+		if e.typ == typ {
+			return e.data
+		}
+	}
+	return nil
+}
+
+// setPeerIP stores ip in the handshake's peer IP address field.
+// IPv4 addresses occupy the first 4 bytes.
+func (hs *handshake) setPeerIP(ip net.IP) {
+	if ip4 := ip.To4(); ip4 != nil {
+		// Each 32-bit word of the field is in host order on the
+		// wire, so a v4 address reads reversed.
+		hs.peerIP[0], hs.peerIP[1], hs.peerIP[2], hs.peerIP[3] = ip4[3], ip4[2], ip4[1], ip4[0]
+		return
+	}
+	copy(hs.peerIP[:], ip.To16())
+}
+
+// hsreq is the content of a HSREQ or HSRSP extension.
+type hsreq struct {
+	version  uint32
+	flags    uint32
+	rcvDelay uint16 // ms
+	sndDelay uint16 // ms
+}
+
+func (r hsreq) marshal() []byte {
+	b := make([]byte, 0, 12)
+	b = appendUint32(b, r.version)
+	b = appendUint32(b, r.flags)
+	return appendUint32(b, uint32(r.rcvDelay)<<16|uint32(r.sndDelay))
+}
+
+func parseHSReq(b []byte) (hsreq, bool) {
+	if len(b) < 12 {
+		return hsreq{}, false
+	}
+	d := binary.BigEndian.Uint32(b[8:])
+	return hsreq{
+		version:  binary.BigEndian.Uint32(b[0:]),
+		flags:    binary.BigEndian.Uint32(b[4:]),
+		rcvDelay: uint16(d >> 16),
+		sndDelay: uint16(d),
+	}, true
+}
+
+// The stream ID travels as 32-bit words in host order, so every group
+// of four characters is reversed on the wire.
+func marshalSID(sid string) []byte {
+	b := make([]byte, (len(sid)+3)/4*4)
+	copy(b, sid)
+	swapWords(b)
+	return b
+}
+
+func parseSID(b []byte) string {
+	s := make([]byte, len(b))
+	copy(s, b)
+	swapWords(s)
+	for len(s) > 0 && s[len(s)-1] == 0 {
+		s = s[:len(s)-1]
+	}
+	return string(s)
+}
+
+func swapWords(b []byte) {
+	for i := 0; i+4 <= len(b); i += 4 {
+		b[i], b[i+1], b[i+2], b[i+3] = b[i+3], b[i+2], b[i+1], b[i]
+	}
+}
+
+// ackData is the CIF of a full ACK.
+type ackData struct {
+	seq      uint32 // first sequence number not received yet
+	rtt      uint32 // microseconds
+	rttVar   uint32 // microseconds
+	avail    uint32 // available receive buffer, in packets
+	pktRate  uint32 // packets per second
+	capacity uint32 // estimated link capacity, packets per second
+	rate     uint32 // receiving rate, bytes per second
+}
+
+func (a ackData) marshal() []byte {
+	b := make([]byte, 0, 28)
+	for _, v := range []uint32{a.seq, a.rtt, a.rttVar, a.avail, a.pktRate, a.capacity, a.rate} {
+		b = appendUint32(b, v)
+	}
+	return b
+}
+
+func parseACK(b []byte) (ackData, bool) {
+	if len(b) < 4 {
+		return ackData{}, false
+	}
+	var w [7]uint32
+	for i := range w {
+		if len(b) < 4*(i+1) {
+			break
+		}
+		w[i] = binary.BigEndian.Uint32(b[4*i:])
+	}
+	return ackData{w[0] & seqMask, w[1], w[2], w[3], w[4], w[5], w[6]}, true
+}
+
+// marshalLossList encodes the sorted sequence numbers in seqs,
+// collapsing consecutive ones into ranges.
+func marshalLossList(seqs []uint32) []byte {
+	var b []byte
+	for i := 0; i < len(seqs); {
+		j := i
+		for j+1 < len(seqs) && seqs[j+1] == seqInc(seqs[j]) {
+			j++
+		}
+		if j == i {
+			b = appendUint32(b, seqs[i])
+		} else {
+			b = appendUint32(b, seqs[i]|0x80000000)
+			b = appendUint32(b, seqs[j])
+		}
+		i = j + 1
+	}
+	return b
+}
+
+// parseLossList calls fn for every sequence number in a loss list.
+// Ranges longer than max are truncated, so a hostile peer can't make
+// us spin.
+func parseLossList(b []byte, max int, fn func(uint32)) {
+	for len(b) >= 4 {
+		v := binary.BigEndian.Uint32(b)
+		b = b[4:]
+		if v&0x80000000 == 0 {
+			fn(v)
+			continue
+		}
+		if len(b) < 4 {
+			return
+		}
+		first, last := v&seqMask, binary.BigEndian.Uint32(b)&seqMask
+		b = b[4:]
+		for s, n := first, 0; n < max; s, n = seqInc(s), n+1 {
+			fn(s)
+			if s == last {
+				break
+			}
+		}
+	}
+}
@@ -0,0 +1,166 @@
+// Copyright (c) 2020 CyberAgent, Inc. All rights reserved.
+// https://github.com/openfresh/gosrt
+
+package native
+
+import "time"
+
+// Subtypes of ctrlUser packets carrying key material.
+const (
+	extKMREQSub = 3
+	extKMRSPSub = 4
+)
+
+// Retransmission of an unanswered KMREQ.
+const (
+	kmRetryInterval = 250 * time.Millisecond
+	kmMaxRetries    = 10
+)
+
+// Keys, as the KK flags of data packets name them.
+const (
+	KeyEven = kkEven
+	KeyOdd  = kkOdd
+)
+
+// Steps of a key refresh reported by KeyEvent.
+const (
+	// KeyAnnounced is reported when a new key is sent to the peer,
+	// or received from it, ahead of its use.
+	KeyAnnounced = iota + 1
+
+	// KeySwitched is reported when packets start being encrypted,
+	// or are first received encrypted, with the new key.
+	KeySwitched
+
+	// KeyRetired is reported when the previous key is withdrawn.
+	KeyRetired
+)
+
+// KeyEvent reports a step in refreshing the keys of a connection.
+type KeyEvent struct {
+	Kind   int  // KeyAnnounced, KeySwitched or KeyRetired
+	Key    int  // KeyEven or KeyOdd
+	Sender bool // whether the key encrypts what the socket sends
+}
+
+// KeyEventHandler is called with each KeyEvent of a socket. It is
+// called with the socket locked, so it must neither block nor call
+// back into the package.
+type KeyEventHandler func(KeyEvent)
+
+// SetKeyEventHandler sets the function notified of the key refreshes
+// of socket s.
+func SetKeyEventHandler(s int, h KeyEventHandler) error {
+	sock := lookup(s)
+	if sock == nil {
+		return EINVSOCK
+	}
+	sock.mu.Lock()
+	defer sock.mu.Unlock()
+	sock.keyEvents = h
+	return nil
+}
+
+func (c *conn) keyEvent(kind int, kk uint8, sender bool) {
+	if h := c.s.keyEvents; h != nil {
+		h(KeyEvent{Kind: kind, Key: int(kk), Sender: sender})
+	}
+}
+
+// encrypt encrypts the new packet p, first advancing the key refresh
+// schedule: after kmRefresh packets with a key, the sender switches to
+// the other one, which it announces kmPreAnnounce packets before and
+// withdraws as many packets after.
+func (c *conn) encrypt(p *packet, now time.Time) {
+	other := kkEven + kkOdd - c.sndKK
+	switch {
+	case c.kmRefresh <= 0:
+	case c.kmCount == c.kmRefresh:
+		c.sndKK, c.kmCount = other, 0
+		c.keyEvent(KeySwitched, c.sndKK, true)
+	case c.kmCount == c.kmPreAnnounce && c.snd.has(other):
+		if c.snd.retire(other) == nil {
+			c.sendKM(now)
+			c.keyEvent(KeyRetired, other, true)
+		}
+	case c.kmCount == c.kmRefresh-c.kmPreAnnounce:
+		if c.snd.generate(other) == nil {
+			c.sendKM(now)
+			c.keyEvent(KeyAnnounced, other, true)
+		}
+	}
+	c.kmCount++
+	p.kk = c.sndKK
+	c.snd.xor(p.kk, p.seq, p.payload)
+}
+
+// sendKM sends the keys announced by c.snd to the peer, until it
+// acknowledges them.
+func (c *conn) sendKM(now time.Time) {
+	c.kmPending = c.snd.km
+	c.kmRetries = 0
+	c.kmSent = now
+	c.sendExt(extKMREQSub, c.kmPending)
+}
+
+// retryKM sends again a KMREQ the peer hasn't answered.
+func (c *conn) retryKM(now time.Time) {
+	if c.kmPending == nil || now.Sub(c.kmSent) < kmRetryInterval {
+		return
+	}
+	if c.kmRetries++; c.kmRetries > kmMaxRetries {
+		c.kmPending = nil
+		return
+	}
+	c.kmSent = now
+	c.sendExt(extKMREQSub, c.kmPending)
+}
+
+func (c *conn) sendExt(sub uint16, cif []byte) {
+	p := c.s.ctrlPacket(ctrlUser, 0, c.s.peerID, cif)
+	p.sub = sub
+	c.s.mux.send(p, c.s.peer)
+	c.lastSend = time.Now()
+}
+
+// keyMaterial handles a KMREQ or KMRSP from the peer.
+func (c *conn) keyMaterial(p *packet) {
+	switch p.sub {
+	case extKMREQSub:
+		if c.rcv == nil {
+			return
+		}
+		added, removed, err := c.rcv.update(p.payload)
+		if err != nil {
+			return
+		}
+		c.sendExt(extKMRSPSub, p.payload)
+		for _, kk := range []uint8{kkEven, kkOdd} {
+			if added&kk != 0 {
+				c.rcvAnnounced = kk
+				c.keyEvent(KeyAnnounced, kk, false)
+			}
+			if removed&kk != 0 {
+				c.keyEvent(KeyRetired, kk, false)
+			}
+		}
+	case extKMRSPSub:
+		if c.kmPending != nil && string(p.payload) == string(c.kmPending) {
+			c.kmPending = nil
+		}
+	}
+}
+
+// decrypt decrypts the received data packet p, reporting false if its
+// key is unknown.
+func (c *conn) decrypt(p *packet) bool {
+	if c.rcv == nil || !c.rcv.xor(p.kk, p.seq, p.payload) {
+		return false
+	}
+	if p.kk == c.rcvAnnounced {
+		c.rcvAnnounced = kkNone
+		c.keyEvent(KeySwitched, p.kk, false)
+	}
+	return true
+}
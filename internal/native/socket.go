@@ -0,0 +1,656 @@
+// Copyright (c) 2020 CyberAgent, Inc. All rights reserved.
+// https://github.com/openfresh/gosrt
+
+package native
+
+import (
+	crand "crypto/rand"
+	"math/rand"
+	"net"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// ListenCallback is called for every connection a listener is about to
+// accept, with the ID of the new socket. The connection is rejected if
+// it returns a negative value.
+type ListenCallback func(ns int, hsversion int, peer *net.UDPAddr, streamid string) int
+
+type socket struct {
+	id    int
+	ready uint32 // Epoll flags the socket is ready for, accessed atomically
+
+	mu    sync.Mutex // protects the following
+	cond  *sync.Cond
+	state int
+	opts  options
+	mux   *mux
+	start time.Time // origin of the timestamps we send
+
+	// listener
+	backlog  int
+	queue    []*socket
+	children map[childKey]*socket
+	callback ListenCallback
+	secret   [16]byte // cookie secret
+
+	// caller and accepted sockets
+	peer       *net.UDPAddr
+	peerID     uint32
+	parent     *socket // listener which accepted the socket
+	err        Error   // why the connection was broken
+	reject     int     // reject reason of a failed connection
+	kmState    int
+	peerVer    uint32
+	isn        uint32
+	hs         *callerHandshake
+	hsResp     *packet // answer to the conclusion, for retransmissions
+	c          *conn
+	keyEvents  KeyEventHandler
+	drops      DropHandler
+	deliveries DeliveryHandler
+	closeOnce  sync.Once
+}
+
+// childKey identifies the caller of an accepted socket.
+type childKey struct {
+	addr string
+	id   uint32
+}
+
+var (
+	sockmu  sync.RWMutex // protects the following
+	sockets = map[int]*socket{}
+	lastID  = 1 + rand.New(rand.NewSource(time.Now().UnixNano())).Intn(1<<30-1)
+)
+
+func lookup(id int) *socket {
+	sockmu.RLock()
+	defer sockmu.RUnlock()
+	return sockets[id]
+}
+
+// newSocket allocates a socket ID and registers the socket. Like in
+// libsrt, IDs count down from a random value.
+func newSocket(opts options) *socket {
+	s := &socket{state: StatusInit, opts: opts, start: time.Now()}
+	s.cond = sync.NewCond(&s.mu)
+	sockmu.Lock()
+	for {
+		if lastID--; lastID <= 0 {
+			lastID = 1<<30 - 1
+		}
+		if _, ok := sockets[lastID]; !ok {
+			break
+		}
+	}
+	s.id = lastID
+	sockets[s.id] = s
+	sockmu.Unlock()
+	return s
+}
+
+// Startup initializes the library. It can be called more than once.
+func Startup() error { return nil }
+
+// Cleanup releases the library's resources.
+func Cleanup() error { return nil }
+
+// Socket creates an SRT socket.
+func Socket() (int, error) {
+	return newSocket(defaultOptions()).id, nil
+}
+
+// Bind binds socket s to a local UDP address.
+func Bind(s int, addr *net.UDPAddr) error {
+	sock := lookup(s)
+	if sock == nil {
+		return EINVSOCK
+	}
+	sock.mu.Lock()
+	defer sock.mu.Unlock()
+	return sock.bind(addr)
+}
+
+func (s *socket) bind(addr *net.UDPAddr) error {
+	if s.state != StatusInit {
+		return EBOUNDSOCK
+	}
+	network := "udp4"
+	if addr.IP != nil && addr.IP.To4() == nil {
+		network = "udp6"
+	}
+	m, err := newMux(network, addr)
+	if err != nil {
+		return ESOCKFAIL
+	}
+	s.mux = m
+	m.add(s)
+	s.state = StatusOpened
+	return nil
+}
+
+// BindAcquire binds socket s to the bound UDP socket with the file
+// descriptor udp instead of opening one, as srt_bind_acquire does. The
+// socket takes udp over, and closes it when it is done with it.
+func BindAcquire(s int, udp int) error {
+	sock := lookup(s)
+	if sock == nil {
+		return EINVSOCK
+	}
+	sock.mu.Lock()
+	defer sock.mu.Unlock()
+	if sock.state != StatusInit {
+		return EBOUNDSOCK
+	}
+	pc, err := filePacketConn(udp)
+	if err != nil {
+		return err
+	}
+	m := newMuxConn(pc)
+	sock.mux = m
+	m.add(sock)
+	sock.state = StatusOpened
+	return nil
+}
+
+// Listen makes socket s listen for connections.
+func Listen(s int, backlog int) error {
+	sock := lookup(s)
+	if sock == nil {
+		return EINVSOCK
+	}
+	if backlog <= 0 {
+		return EINVPARAM
+	}
+	sock.mu.Lock()
+	defer sock.mu.Unlock()
+	switch sock.state {
+	case StatusInit:
+		return EUNBOUNDSOCK
+	case StatusListening:
+		return nil
+	case StatusOpened:
+	default:
+		return ECONNSOCK
+	}
+	if sock.opts.rendezvous {
+		return ERDVNOSERV
+	}
+	if err := sock.mux.listen(sock); err != nil {
+		return err
+	}
+	crand.Read(sock.secret[:])
+	sock.backlog = backlog
+	sock.children = map[childKey]*socket{}
+	sock.state = StatusListening
+	return nil
+}
+
+// SetListenCallback installs the callback consulted by listener s
+// before accepting a connection.
+func SetListenCallback(s int, fn ListenCallback) error {
+	sock := lookup(s)
+	if sock == nil {
+		return EINVSOCK
+	}
+	sock.mu.Lock()
+	defer sock.mu.Unlock()
+	sock.callback = fn
+	return nil
+}
+
+func (s *socket) isListener() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.state == StatusListening
+}
+
+// Accept returns a connection established with listener s.
+func Accept(s int) (int, *net.UDPAddr, error) {
+	sock := lookup(s)
+	if sock == nil {
+		return -1, nil, EINVSOCK
+	}
+	sock.mu.Lock()
+	defer sock.mu.Unlock()
+	deadline := sock.deadline(sock.opts.rcvTimeo)
+	for {
+		if sock.state != StatusListening {
+			if sock.state == StatusClosed {
+				return -1, nil, EINVSOCK
+			}
+			return -1, nil, ENOLISTEN
+		}
+		if len(sock.queue) > 0 {
+			ns := sock.queue[0]
+			sock.queue = sock.queue[1:]
+			sock.update()
+			return ns.id, ns.peer, nil
+		}
+		if !sock.opts.rcvSyn {
+			return -1, nil, EASYNCRCV
+		}
+		if !sock.wait(deadline) {
+			return -1, nil, EASYNCRCV
+		}
+	}
+}
+
+// Connect connects socket s to a listener at addr. A socket in
+// non-blocking mode returns right away in the connecting state.
+func Connect(s int, addr *net.UDPAddr) error {
+	sock := lookup(s)
+	if sock == nil {
+		return EINVSOCK
+	}
+	if addr == nil {
+		return EINVPARAM
+	}
+	sock.mu.Lock()
+	defer sock.mu.Unlock()
+	switch sock.state {
+	case StatusInit:
+		local := &net.UDPAddr{IP: net.IPv4zero}
+		if addr.IP.To4() == nil {
+			local.IP = net.IPv6unspecified
+		}
+		if err := sock.bind(local); err != nil {
+			return err
+		}
+	case StatusOpened:
+	case StatusListening:
+		return EINVOP
+	default:
+		return ECONNSOCK
+	}
+	if sock.opts.rendezvous {
+		// Rendezvous connections aren't implemented.
+		return EINVOP
+	}
+	sock.peer = addr
+	sock.state = StatusConnecting
+	sock.startHandshake()
+	if !sock.opts.sndSyn {
+		return nil
+	}
+	for sock.state == StatusConnecting {
+		sock.cond.Wait()
+	}
+	if sock.state != StatusConnected {
+		return sock.err
+	}
+	return nil
+}
+
+// Recv reads the next message available on socket s.
+func Recv(s int, p []byte) (int, error) {
+	n, _, err := RecvMsg(s, p)
+	return n, err
+}
+
+// RecvInfo is what RecvMsg reports of a message.
+type RecvInfo struct {
+	SrcTime int64  // time the peer sent it at, on the clock of TimeNow
+	Seq     uint32 // sequence number of its packet
+	MsgNo   uint32
+}
+
+// RecvMsg reads the next message available on socket s, and returns
+// with it its source time and numbers.
+func RecvMsg(s int, p []byte) (n int, info RecvInfo, err error) {
+	sock := lookup(s)
+	if sock == nil {
+		return -1, RecvInfo{}, EINVSOCK
+	}
+	sock.mu.Lock()
+	defer sock.mu.Unlock()
+	deadline := sock.deadline(sock.opts.rcvTimeo)
+	for {
+		switch sock.state {
+		case StatusConnected, StatusBroken:
+		case StatusClosed:
+			return -1, RecvInfo{}, EINVSOCK
+		default:
+			return -1, RecvInfo{}, ENOCONN
+		}
+		if n, info, ok := sock.c.read(p, time.Now()); ok {
+			sock.update()
+			return n, info, nil
+		}
+		sock.update()
+		if sock.state == StatusBroken {
+			return -1, RecvInfo{}, sock.err
+		}
+		if !sock.opts.rcvSyn {
+			return -1, RecvInfo{}, EASYNCRCV
+		}
+		if !sock.wait(deadline) {
+			return -1, RecvInfo{}, EASYNCRCV
+		}
+	}
+}
+
+// Send sends p as one message on socket s.
+func Send(s int, p []byte) (int, error) {
+	return SendMsg(s, p, 0)
+}
+
+// SendMsg sends p as one message on socket s, stamped with the source
+// time srctime, on the clock of TimeNow, or the current time if it is
+// zero.
+func SendMsg(s int, p []byte, srctime int64) (int, error) {
+	n, _, err := SendMsgCtrl(s, p, MsgCtrl{SrcTime: srctime})
+	return n, err
+}
+
+// MsgCtrl controls how SendMsgCtrl sends a message.
+type MsgCtrl struct {
+	SrcTime int64         // source time on the clock of TimeNow, 0 for now
+	TTL     time.Duration // how long the message may be retransmitted, 0 for ever
+	Track   bool          // report its delivery to the DeliveryHandler
+}
+
+// SendMsgCtrl sends p as one message on socket s, as mc says, and
+// returns its message number with its length.
+func SendMsgCtrl(s int, p []byte, mc MsgCtrl) (int, uint32, error) {
+	sock := lookup(s)
+	if sock == nil {
+		return -1, 0, EINVSOCK
+	}
+	sock.mu.Lock()
+	defer sock.mu.Unlock()
+	deadline := sock.deadline(sock.opts.sndTimeo)
+	for {
+		switch sock.state {
+		case StatusConnected:
+		case StatusBroken:
+			return -1, 0, sock.err
+		case StatusClosed:
+			return -1, 0, EINVSOCK
+		default:
+			return -1, 0, ENOCONN
+		}
+		if len(p) > sock.c.payloadSize {
+			return -1, 0, ELARGEMSG
+		}
+		now := time.Now()
+		origin := now
+		if mc.SrcTime != 0 {
+			origin = atEpoch(mc.SrcTime)
+		}
+		if sock.c.write(p, now, origin, mc.TTL, mc.Track) {
+			sock.update()
+			return len(p), sock.c.msgno, nil
+		}
+		sock.update()
+		if !sock.opts.sndSyn {
+			return -1, 0, EASYNCSND
+		}
+		if !sock.wait(deadline) {
+			return -1, 0, EASYNCSND
+		}
+	}
+}
+
+// Close closes socket s. A connected socket tells its peer it is gone.
+func Close(s int) error {
+	sock := lookup(s)
+	if sock == nil {
+		return EINVSOCK
+	}
+	sock.close()
+	return nil
+}
+
+func (s *socket) close() {
+	s.closeOnce.Do(func() {
+		sockmu.Lock()
+		delete(sockets, s.id)
+		sockmu.Unlock()
+
+		s.mu.Lock()
+		if s.state == StatusConnected && s.c != nil {
+			s.c.sendCtrl(ctrlShutdown, 0, make([]byte, 4))
+		}
+		if s.c != nil {
+			s.c.stop()
+		}
+		if s.hs != nil {
+			s.hs.timer.Stop()
+		}
+		queued := s.queue
+		s.queue = nil
+		parent := s.parent
+		s.state = StatusClosed
+		s.update()
+		s.cond.Broadcast()
+		m := s.mux
+		s.mu.Unlock()
+
+		for _, ns := range queued {
+			ns.close()
+		}
+		if parent != nil {
+			parent.forget(s)
+		}
+		if m != nil {
+			m.remove(s)
+		}
+		epollForget(s.id)
+	})
+}
+
+// Sockname returns the local address of socket s.
+func Sockname(s int) (*net.UDPAddr, error) {
+	sock := lookup(s)
+	if sock == nil {
+		return nil, EINVSOCK
+	}
+	sock.mu.Lock()
+	defer sock.mu.Unlock()
+	if sock.mux == nil {
+		return nil, EUNBOUNDSOCK
+	}
+	return sock.mux.laddr, nil
+}
+
+// Peername returns the address of the peer of socket s.
+func Peername(s int) (*net.UDPAddr, error) {
+	sock := lookup(s)
+	if sock == nil {
+		return nil, EINVSOCK
+	}
+	sock.mu.Lock()
+	defer sock.mu.Unlock()
+	if sock.state != StatusConnected && sock.state != StatusBroken {
+		return nil, ENOCONN
+	}
+	return sock.peer, nil
+}
+
+// State returns the state of socket s, StatusNonexist if there is no
+// such socket.
+func State(s int) int {
+	sock := lookup(s)
+	if sock == nil {
+		return StatusNonexist
+	}
+	sock.mu.Lock()
+	defer sock.mu.Unlock()
+	return sock.state
+}
+
+// RejectReason returns why the connection of socket s was rejected.
+func RejectReason(s int) int {
+	sock := lookup(s)
+	if sock == nil {
+		return RejectUnknown
+	}
+	sock.mu.Lock()
+	defer sock.mu.Unlock()
+	return sock.reject
+}
+
+// SetRejectReason sets the reason of the rejection of s by a listen
+// callback, which must be at least RejectFallback.
+func SetRejectReason(s int, reason int) error {
+	sock := lookup(s)
+	if sock == nil {
+		return EINVSOCK
+	}
+	if reason < RejectFallback {
+		return EINVPARAM
+	}
+	sock.mu.Lock()
+	defer sock.mu.Unlock()
+	sock.reject = reason
+	return nil
+}
+
+// GetOption returns the value of option opt of socket s, as an int32,
+// int64, bool or string depending on its kind.
+func GetOption(s, opt int) (interface{}, error) {
+	sock := lookup(s)
+	if sock == nil {
+		return nil, EINVSOCK
+	}
+	sock.mu.Lock()
+	defer sock.mu.Unlock()
+	switch opt {
+	case OptState:
+		return int32(sock.state), nil
+	case OptEvent:
+		return int32(sock.readiness()), nil
+	case OptKMState, OptSndKMState, OptRcvKMState:
+		return int32(sock.kmState), nil
+	case OptPeerVersion:
+		return int32(sock.peerVer), nil
+	case OptISN:
+		return int32(sock.isn), nil
+	case OptSndData, OptRcvData:
+		if sock.c == nil {
+			return int32(0), nil
+		}
+		if opt == OptSndData {
+			return int32(len(sock.c.sndBuf)), nil
+		}
+		return int32(sock.c.rcvCount()), nil
+	case OptRcvLatency, OptLatency, OptPeerLatency:
+		if sock.c != nil {
+			d := sock.c.rcvLatency
+			if opt == OptPeerLatency {
+				d = sock.c.sndLatency
+			}
+			return int32(d / time.Millisecond), nil
+		}
+	}
+	v, ok := sock.opts.get(opt)
+	if !ok {
+		return nil, EINVOP
+	}
+	return v, nil
+}
+
+// SetOption sets option opt of socket s. v is an integer type, a bool
+// or a string depending on the kind of the option.
+func SetOption(s, opt int, v interface{}) error {
+	sock := lookup(s)
+	if sock == nil {
+		return EINVSOCK
+	}
+	sock.mu.Lock()
+	defer sock.mu.Unlock()
+	if err := sock.opts.set(opt, v); err != nil {
+		return err
+	}
+	if opt == OptMaxBW && sock.c != nil {
+		if cc, ok := sock.c.cc.(maxBWFollower); ok {
+			maxBW, _ := sock.opts.extra[OptMaxBW].(int64)
+			cc.setMaxBW(maxBW)
+		}
+	}
+	// Blocking calls pick up new modes and timeouts.
+	sock.cond.Broadcast()
+	return nil
+}
+
+// deadline returns the time a blocking call with the timeout ms gives
+// up, or the zero time if it doesn't.
+func (s *socket) deadline(ms int) time.Time {
+	if ms < 0 {
+		return time.Time{}
+	}
+	return time.Now().Add(time.Duration(ms) * time.Millisecond)
+}
+
+// wait waits for s.cond until deadline, reporting false once it passed.
+// s.mu must be held.
+func (s *socket) wait(deadline time.Time) bool {
+	if deadline.IsZero() {
+		s.cond.Wait()
+		return true
+	}
+	d := time.Until(deadline)
+	if d <= 0 {
+		return false
+	}
+	t := time.AfterFunc(d, func() {
+		s.mu.Lock()
+		s.cond.Broadcast()
+		s.mu.Unlock()
+	})
+	s.cond.Wait()
+	t.Stop()
+	return time.Now().Before(deadline)
+}
+
+// readiness returns the Epoll flags s is ready for.
+func (s *socket) readiness() uint32 {
+	return atomic.LoadUint32(&s.ready)
+}
+
+// update recomputes what s is ready for, waking up blocked calls and
+// epoll waiters on any rising edge. s.mu must be held.
+func (s *socket) update() {
+	var ready uint32
+	switch s.state {
+	case StatusListening:
+		if len(s.queue) > 0 {
+			ready |= EpollIn
+		}
+	case StatusConnected:
+		now := time.Now()
+		if s.c.readable(now) {
+			ready |= EpollIn
+		}
+		if s.c.writable() {
+			ready |= EpollOut
+		}
+	case StatusBroken, StatusClosed:
+		ready = EpollIn | EpollOut | EpollErr
+	}
+	old := atomic.SwapUint32(&s.ready, ready)
+	if rising := ready &^ old; rising != 0 {
+		s.cond.Broadcast()
+		epollNotify(s.id, rising)
+	}
+}
+
+// fail breaks the connection of s with err. s.mu must be held.
+func (s *socket) fail(err Error) {
+	if s.state == StatusClosed || s.state == StatusBroken {
+		return
+	}
+	s.state = StatusBroken
+	s.err = err
+	if s.c != nil {
+		s.c.stop()
+	}
+	if s.hs != nil {
+		s.hs.timer.Stop()
+	}
+	s.update()
+	s.cond.Broadcast()
+}
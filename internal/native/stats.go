@@ -0,0 +1,241 @@
+// Copyright (c) 2020 CyberAgent, Inc. All rights reserved.
+// https://github.com/openfresh/gosrt
+
+package native
+
+import "time"
+
+// Stats holds the statistics of a connection, named after the fields
+// of libsrt's CBytePerfMon. The values not suffixed with Total count
+// since the statistics were last cleared.
+type Stats struct {
+	MsTimeStamp int64
+
+	PktSent, PktSentTotal             int64
+	PktRecv, PktRecvTotal             int64
+	PktSndLoss, PktSndLossTotal       int64
+	PktRcvLoss, PktRcvLossTotal       int64
+	PktRetrans, PktRetransTotal       int64
+	PktRcvRetrans, PktRcvRetransTotal int64
+	PktSndDrop, PktSndDropTotal       int64
+	PktRcvDrop, PktRcvDropTotal       int64
+	PktRcvBelated, PktRcvBelatedTotal int64
+	PktRcvUndecrypt                   int64
+	ByteSent, ByteSentTotal           int64
+	ByteRecv, ByteRecvTotal           int64
+	ByteSndDropTotal                  int64
+
+	PktFlightSize       int
+	PktSndBuf           int
+	ByteSndBuf          int
+	MsSndBuf            int
+	PktRcvBuf           int
+	ByteRcvBuf          int
+	MsRcvBuf            int
+	MsRTT               float64
+	MsSndTsbPdDelay     int
+	MsRcvTsbPdDelay     int
+	MbpsSendRate        float64
+	MbpsRecvRate        float64
+	PktFlowWindow       int
+	PktCongestionWindow int
+	ByteAvailSndBuf     int
+	ByteAvailRcvBuf     int
+}
+
+// A DropEvent reports packets given up on as too late to be
+// delivered: by the sender, once they outlived the latency in its
+// buffer, or by the receiver, for missing packets whose successors
+// were due, or that the sender dropped.
+type DropEvent struct {
+	First, Last uint32 // sequence numbers of the range, both included
+	Packets     int    // packets of the range dropped by this event
+	Sender      bool   // whether the sending side dropped them
+}
+
+// DropHandler is called with each DropEvent of a socket, with the
+// socket locked like a KeyEventHandler.
+type DropHandler func(DropEvent)
+
+// SetDropHandler sets the function notified of the packets socket s
+// drops.
+func SetDropHandler(s int, h DropHandler) error {
+	sock := lookup(s)
+	if sock == nil {
+		return EINVSOCK
+	}
+	sock.mu.Lock()
+	defer sock.mu.Unlock()
+	sock.drops = h
+	return nil
+}
+
+func (c *conn) dropped(first, last uint32, n int, sender bool) {
+	if h := c.s.drops; h != nil {
+		h(DropEvent{First: first, Last: last, Packets: n, Sender: sender})
+	}
+}
+
+// A Gap is a range of packets found missing on reception, a packet
+// further on having arrived first, and what became of them.
+type Gap struct {
+	First, Last uint32 // sequence numbers of the range, both included
+	Packets     int    // packets of the range
+	Detected    time.Time
+
+	// Recovered counts the packets of the range that arrived since,
+	// retransmitted or out of order, and Dropped those given up on as
+	// too late. Resolved is when the last of them did, zero while
+	// some are still missing.
+	Recovered int
+	Dropped   int
+	Resolved  time.Time
+}
+
+// maxGaps is the number of gaps a connection remembers.
+const maxGaps = 256
+
+// Gaps returns the latest gaps of socket s, oldest first, up to maxGaps
+// of them, and the number of gaps and of packets missing in them since
+// the connection started.
+func Gaps(s int) ([]Gap, int64, int64, error) {
+	sock := lookup(s)
+	if sock == nil {
+		return nil, 0, 0, EINVSOCK
+	}
+	sock.mu.Lock()
+	defer sock.mu.Unlock()
+	c := sock.c
+	if c == nil {
+		return nil, 0, 0, nil
+	}
+	return append([]Gap(nil), c.gaps...), c.nGaps, c.gapPkts, nil
+}
+
+func (c *conn) addGap(first, last uint32, n int, now time.Time) {
+	if len(c.gaps) == maxGaps {
+		c.gaps = append(c.gaps[:0], c.gaps[1:]...)
+	}
+	c.gaps = append(c.gaps, Gap{First: first, Last: last, Packets: n, Detected: now})
+	c.nGaps++
+	c.gapPkts += int64(n)
+}
+
+// settleGap records the missing packet seq as arrived, or dropped.
+func (c *conn) settleGap(seq uint32, now time.Time, dropped bool) {
+	for i := len(c.gaps) - 1; i >= 0; i-- {
+		g := &c.gaps[i]
+		if seqLess(seq, g.First) || seqLess(g.Last, seq) {
+			continue
+		}
+		if dropped {
+			g.Dropped++
+		} else {
+			g.Recovered++
+		}
+		if g.Recovered+g.Dropped == g.Packets {
+			g.Resolved = now
+		}
+		return
+	}
+}
+
+// DeliveryHandler is called with the message number of each message
+// sent with MsgCtrl.Track, once the peer acknowledged it, or once it
+// was dropped, with the socket locked like a KeyEventHandler.
+type DeliveryHandler func(msgno uint32, delivered bool)
+
+// SetDeliveryHandler sets the function notified of the delivery of the
+// tracked messages of socket s.
+func SetDeliveryHandler(s int, h DeliveryHandler) error {
+	sock := lookup(s)
+	if sock == nil {
+		return EINVSOCK
+	}
+	sock.mu.Lock()
+	defer sock.mu.Unlock()
+	sock.deliveries = h
+	return nil
+}
+
+func (c *conn) delivered(msgno uint32, ok bool) {
+	if h := c.s.deliveries; h != nil {
+		h(msgno, ok)
+	}
+}
+
+// Bstats returns the statistics of socket s, restarting the interval
+// counters if clear is set.
+func Bstats(s int, clear bool) (Stats, error) {
+	sock := lookup(s)
+	if sock == nil {
+		return Stats{}, EINVSOCK
+	}
+	sock.mu.Lock()
+	defer sock.mu.Unlock()
+	now := time.Now()
+	st := Stats{MsTimeStamp: int64(now.Sub(sock.start) / time.Millisecond)}
+	c := sock.c
+	if c == nil {
+		return st, nil
+	}
+	t, i := &c.stats, &c.interval
+	st.PktSent, st.PktSentTotal = i.pktSent, t.pktSent
+	st.PktRecv, st.PktRecvTotal = i.pktRecv, t.pktRecv
+	st.PktSndLoss, st.PktSndLossTotal = i.pktSndLoss, t.pktSndLoss
+	st.PktRcvLoss, st.PktRcvLossTotal = i.pktRcvLoss, t.pktRcvLoss
+	st.PktRetrans, st.PktRetransTotal = i.pktRetrans, t.pktRetrans
+	st.PktRcvRetrans, st.PktRcvRetransTotal = i.pktRcvRetr, t.pktRcvRetr
+	st.PktSndDrop, st.PktSndDropTotal = i.pktSndDrop, t.pktSndDrop
+	st.PktRcvDrop, st.PktRcvDropTotal = i.pktRcvDrop, t.pktRcvDrop
+	st.PktRcvBelated, st.PktRcvBelatedTotal = i.pktRcvBelated, t.pktRcvBelated
+	st.PktRcvUndecrypt = t.pktRcvUndecrypt
+	st.ByteSent, st.ByteSentTotal = i.byteSent, t.byteSent
+	st.ByteRecv, st.ByteRecvTotal = i.byteRecv, t.byteRecv
+	st.ByteSndDropTotal = t.byteSndDrop
+
+	mss := sock.opts.mss - udpHeader
+	st.PktFlightSize = len(c.sndBuf) - c.unsent
+	st.PktSndBuf = len(c.sndBuf)
+	for _, sp := range c.sndBuf {
+		st.ByteSndBuf += len(sp.p.payload)
+	}
+	if len(c.sndBuf) > 0 {
+		st.MsSndBuf = int(now.Sub(c.sndBuf[0].origin) / time.Millisecond)
+	}
+	st.PktRcvBuf = c.rcvCount()
+	// The span of the receive buffer is that of the timestamps of the
+	// packets in it; the map isn't ordered.
+	var first, last int64
+	n := 0
+	for _, rp := range c.rcvBuf {
+		if rp.drop {
+			continue
+		}
+		if n == 0 || rp.ts < first {
+			first = rp.ts
+		}
+		if n == 0 || rp.ts > last {
+			last = rp.ts
+		}
+		n++
+		st.ByteRcvBuf += len(rp.data)
+	}
+	st.MsRcvBuf = int((last - first) / 1000)
+	st.MsRTT = float64(c.rtt) / float64(time.Millisecond)
+	st.MsSndTsbPdDelay = int(c.sndLatency / time.Millisecond)
+	st.MsRcvTsbPdDelay = int(c.rcvLatency / time.Millisecond)
+	st.PktFlowWindow = c.rcvCap - len(c.rcvBuf)
+	st.PktCongestionWindow = c.cc.Window()
+	st.ByteAvailSndBuf = (c.sndCap - len(c.sndBuf)) * mss
+	st.ByteAvailRcvBuf = (c.rcvCap - len(c.rcvBuf)) * mss
+	if d := now.Sub(c.statsStart).Seconds(); d > 0 {
+		st.MbpsSendRate = float64(i.byteSent) * 8 / d / 1e6
+		st.MbpsRecvRate = float64(i.byteRecv) * 8 / d / 1e6
+	}
+	if clear {
+		c.interval = counters{}
+		c.statsStart = now
+	}
+	return st, nil
+}
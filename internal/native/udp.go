@@ -0,0 +1,27 @@
+// Copyright (c) 2020 CyberAgent, Inc. All rights reserved.
+// https://github.com/openfresh/gosrt
+
+// +build !srtmock
+
+package native
+
+import "net"
+
+// RouteSource returns the local IP the system sends to addr from, or
+// nil if it has no route. Connecting a UDP socket sends nothing.
+func RouteSource(addr *net.UDPAddr) net.IP {
+	c, err := net.DialUDP("udp", nil, addr)
+	if err != nil {
+		return nil
+	}
+	defer c.Close()
+	return c.LocalAddr().(*net.UDPAddr).IP
+}
+
+func listenPacket(network string, addr *net.UDPAddr) (packetConn, error) {
+	pc, err := net.ListenUDP(network, addr)
+	if err != nil {
+		return nil, err
+	}
+	return pc, nil
+}
@@ -0,0 +1,34 @@
+// Copyright (c) 2020 CyberAgent, Inc. All rights reserved.
+// https://github.com/openfresh/gosrt
+
+// +build !srtmock,!windows
+
+package native
+
+import (
+	"net"
+	"os"
+	"syscall"
+)
+
+// filePacketConn returns the UDP socket with the file descriptor fd,
+// which it takes over if it succeeds.
+func filePacketConn(fd int) (packetConn, error) {
+	dup, err := syscall.Dup(fd)
+	if err != nil {
+		return nil, EINVPARAM
+	}
+	f := os.NewFile(uintptr(dup), "udp")
+	c, err := net.FilePacketConn(f)
+	f.Close()
+	if err != nil {
+		return nil, EINVPARAM
+	}
+	pc, ok := c.(*net.UDPConn)
+	if !ok {
+		c.Close()
+		return nil, EINVPARAM
+	}
+	syscall.Close(fd)
+	return pc, nil
+}
@@ -0,0 +1,11 @@
+// Copyright (c) 2020 CyberAgent, Inc. All rights reserved.
+// https://github.com/openfresh/gosrt
+
+// +build !srtmock
+
+package native
+
+// filePacketConn fails: Windows sockets are not file descriptors.
+func filePacketConn(fd int) (packetConn, error) {
+	return nil, EINVOP
+}
@@ -10,20 +10,38 @@ package poll
 
 import (
 	"sync"
+	"sync/atomic"
 )
 
 type fdMutex struct {
-	rlock sync.Mutex
-	wlock sync.Mutex
+	rlock   sync.Mutex
+	wlock   sync.Mutex
+	raw     sync.RWMutex // held shared by RawControl
+	closing int32        // set once by increfAndClose
 }
 
 func (fdmu *fdMutex) init() {
 	fdmu.rlock = sync.Mutex{}
 	fdmu.wlock = sync.Mutex{}
+	fdmu.raw = sync.RWMutex{}
+}
+
+// increfAndClose marks fdmu as closing.
+// It returns false if it was already closing.
+func (fdmu *fdMutex) increfAndClose() bool {
+	return atomic.CompareAndSwapInt32(&fdmu.closing, 0, 1)
+}
+
+func (fdmu *fdMutex) closed() bool {
+	return atomic.LoadInt32(&fdmu.closing) != 0
 }
 
 func (fd *FD) readLock() error {
 	fd.fdmu.rlock.Lock()
+	if fd.fdmu.closed() {
+		fd.fdmu.rlock.Unlock()
+		return errClosing()
+	}
 	return nil
 }
 
@@ -33,9 +51,26 @@ func (fd *FD) readUnlock() {
 
 func (fd *FD) writeLock() error {
 	fd.fdmu.wlock.Lock()
+	if fd.fdmu.closed() {
+		fd.fdmu.wlock.Unlock()
+		return errClosing()
+	}
 	return nil
 }
 
 func (fd *FD) writeUnlock() {
 	fd.fdmu.wlock.Unlock()
 }
+
+func (fd *FD) rawLock() error {
+	fd.fdmu.raw.RLock()
+	if fd.fdmu.closed() {
+		fd.fdmu.raw.RUnlock()
+		return errClosing()
+	}
+	return nil
+}
+
+func (fd *FD) rawUnlock() {
+	fd.fdmu.raw.RUnlock()
+}
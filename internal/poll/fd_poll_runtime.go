@@ -40,8 +40,10 @@ func (pd *pollDesc) close() {
 	if pd.runtimeCtx == nil {
 		return
 	}
+	// runtimeCtx is kept, rather than reset to nil, so that late
+	// callers such as SetDeadline see a closing descriptor instead of
+	// racing with its removal.
 	pd.runtimeCtx.Close()
-	pd.runtimeCtx = nil
 }
 
 // Evict evicts fd from the pending list, unblocking any I/O running on fd.
@@ -57,7 +59,7 @@ func (pd *pollDesc) prepare(mode int) error {
 		return nil
 	}
 	res := pd.runtimeCtx.Reset(mode)
-	return convertErr(res)
+	return convertErr(res, pd.runtimeCtx)
 }
 
 func (pd *pollDesc) prepareRead() error {
@@ -73,7 +75,7 @@ func (pd *pollDesc) wait(mode int) error {
 		return errors.New("waiting for unsupported file type")
 	}
 	res := pd.runtimeCtx.Wait(mode)
-	return convertErr(res)
+	return convertErr(res, pd.runtimeCtx)
 }
 
 func (pd *pollDesc) waitRead() error {
@@ -88,7 +90,7 @@ func (pd *pollDesc) pollable() bool {
 	return pd.runtimeCtx != nil
 }
 
-func convertErr(res int) error {
+func convertErr(res int, ctx runtime.PollDesc) error {
 	switch res {
 	case 0:
 		return nil
@@ -96,6 +98,8 @@ func convertErr(res int) error {
 		return errClosing()
 	case 2:
 		return ErrTimeout
+	case 3:
+		return ctx.Err()
 	}
 	println("unreachable: ", res)
 	panic("unreachable")
@@ -117,7 +121,16 @@ func (fd *FD) SetWriteDeadline(t time.Time) error {
 }
 
 func setDeadlineImpl(fd *FD, t time.Time, mode int) error {
-	d := time.Until(t)
+	var d time.Duration
+	if !t.IsZero() {
+		d = t.Sub(runtime.Clock.Now())
+		if d == 0 {
+			d = -1 // don't confuse deadline right now with no deadline
+		}
+	}
+	if fd.fdmu.closed() {
+		return errClosing()
+	}
 	if fd.pd.runtimeCtx == nil {
 		return ErrNoDeadline
 	}
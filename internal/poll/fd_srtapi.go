@@ -48,8 +48,12 @@ func (fd *FD) destroy() error {
 	return err
 }
 
-// Close closes the FD.
+// Close closes the FD. Closing an FD more than once returns
+// ErrNetClosing.
 func (fd *FD) Close() error {
+	if !fd.fdmu.increfAndClose() {
+		return errClosing()
+	}
 	// Unblock any I/O.  Once it all unblocks and returns,
 	// so that it cannot be referring to fd.sysfd anymore,
 	// the final decref will close fd.sysfd. This should happen
@@ -57,6 +61,14 @@ func (fd *FD) Close() error {
 	// attempts to block in the pollDesc will return errClosing(fd.isFile).
 	fd.pd.evict()
 
+	// Wait for the readers and writers to return before destroying
+	// the descriptor they are using.
+	fd.fdmu.rlock.Lock()
+	defer fd.fdmu.rlock.Unlock()
+	fd.fdmu.wlock.Lock()
+	defer fd.fdmu.wlock.Unlock()
+	fd.fdmu.raw.Lock()
+	defer fd.fdmu.raw.Unlock()
 	return fd.destroy()
 }
 
@@ -138,6 +150,57 @@ func (fd *FD) Write(p []byte) (int, error) {
 	}
 }
 
+// ReadMsg reads one message into p, and its source time into mc. If
+// non-nil, received is called with mc once a message is read, before
+// the next read can start, for the messages to be seen in order.
+func (fd *FD) ReadMsg(p []byte, mc *srtapi.MsgCtrl, received func(*srtapi.MsgCtrl)) (int, error) {
+	if err := fd.readLock(); err != nil {
+		return 0, err
+	}
+	defer fd.readUnlock()
+	if err := fd.pd.prepareRead(); err != nil {
+		return 0, err
+	}
+	for {
+		n, err := srtapi.RecvMsg2(fd.Sysfd, p, mc)
+		if err != nil {
+			n = 0
+			if err == srtapi.EASYNCRCV && fd.pd.pollable() {
+				if err = fd.pd.waitRead(); err == nil {
+					continue
+				}
+			}
+		} else if received != nil {
+			received(mc)
+		}
+		err = fd.eofError(n, err)
+		return n, err
+	}
+}
+
+// WriteMsg writes p as one message, with the source time in mc.
+func (fd *FD) WriteMsg(p []byte, mc *srtapi.MsgCtrl) (int, error) {
+	if err := fd.writeLock(); err != nil {
+		return 0, err
+	}
+	defer fd.writeUnlock()
+	if err := fd.pd.prepareWrite(); err != nil {
+		return 0, err
+	}
+	for {
+		n, err := srtapi.SendMsg2(fd.Sysfd, p, mc)
+		if err == srtapi.EASYNCSND && fd.pd.pollable() {
+			if err = fd.pd.waitWrite(); err == nil {
+				continue
+			}
+		}
+		if err != nil {
+			return 0, err
+		}
+		return n, nil
+	}
+}
+
 // Accept wraps the accept network call.
 func (fd *FD) Accept() (int, syscall.Sockaddr, string, error) {
 	if err := fd.readLock(); err != nil {
@@ -172,5 +235,58 @@ func (fd *FD) Accept() (int, syscall.Sockaddr, string, error) {
 
 // WaitWrite waits until data can be read from fd.
 func (fd *FD) WaitWrite() error {
+	if fd.fdmu.closed() {
+		return errClosing()
+	}
 	return fd.pd.waitWrite()
 }
+
+// RawControl calls f with the socket of fd, which stays open until f
+// returns. It doesn't wait for pending reads and writes.
+func (fd *FD) RawControl(f func(int)) error {
+	if err := fd.rawLock(); err != nil {
+		return err
+	}
+	defer fd.rawUnlock()
+	f(fd.Sysfd)
+	return nil
+}
+
+// RawRead calls f with the socket of fd until it returns true, waiting
+// for the socket to be readable after each false.
+func (fd *FD) RawRead(f func(int) bool) error {
+	if err := fd.readLock(); err != nil {
+		return err
+	}
+	defer fd.readUnlock()
+	if err := fd.pd.prepareRead(); err != nil {
+		return err
+	}
+	for {
+		if f(fd.Sysfd) {
+			return nil
+		}
+		if err := fd.pd.waitRead(); err != nil {
+			return err
+		}
+	}
+}
+
+// RawWrite is like RawRead for writing.
+func (fd *FD) RawWrite(f func(int) bool) error {
+	if err := fd.writeLock(); err != nil {
+		return err
+	}
+	defer fd.writeUnlock()
+	if err := fd.pd.prepareWrite(); err != nil {
+		return err
+	}
+	for {
+		if f(fd.Sysfd) {
+			return nil
+		}
+		if err := fd.pd.waitWrite(); err != nil {
+			return err
+		}
+	}
+}
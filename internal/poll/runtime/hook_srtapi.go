@@ -0,0 +1,18 @@
+// Copyright (c) 2020 CyberAgent, Inc. All rights reserved.
+// https://github.com/openfresh/gosrt
+
+// +build !pollscan
+
+package runtime
+
+import (
+	"github.com/openfresh/gosrt/srtapi"
+)
+
+var (
+	// Placeholders for srt epoll calls.
+	epollAddFunc    = srtapi.EpollAddUsock
+	epollUpdateFunc = srtapi.EpollUpdateUsock
+	epollRemoveFunc = srtapi.EpollRemoveUsock
+	epollUwaitFunc  = srtapi.EpollUwait
+)
@@ -10,9 +10,32 @@ package runtime
 
 import (
 	"sync"
+	"sync/atomic"
 	"time"
+
+	"github.com/openfresh/gosrt/internal/clock"
 )
 
+// This file holds the parts of the poller shared by every backend. A
+// backend, picked by build tags, implements netpollinit,
+// netpollshutdown, netpolldescriptor, netpollopen, netpollclose and
+// netpollarm, and calls netpollready as descriptors become ready:
+//
+//	netpoll_epoll.go  srt_epoll_uwait (default)
+//	netpoll_scan.go   periodic scan of socket event flags (pollscan)
+//
+// A descriptor is only registered for the readiness no goroutine can
+// miss, errors. The readiness for reading or writing is asked for by
+// netpollarm while a goroutine is blocked on it, so that idle sockets,
+// and writable sockets no one writes to, cost the poller nothing.
+//
+// Built with nosrtlib, either backend runs on the pure Go SRT
+// implementation instead of libsrt.
+
+// Clock is used to hook the clock of the deadline timers, and of
+// deadlines in package poll.
+var Clock = clock.System
+
 // PollDesc - Network poller descriptor.
 type PollDesc interface {
 	Close()
@@ -20,9 +43,12 @@ type PollDesc interface {
 	Reset(mode int) int
 	SetDeadline(d time.Duration, mode int)
 	Unblock()
+	Err() error
 }
 
 type pollDesc struct {
+	gen     uint64     // incarnation of fd, immutable after PollOpen
+	events  int32      // epoll events registered for fd, updated atomically
 	lock    sync.Mutex // protects the following fields
 	fd      int
 	closing bool
@@ -30,13 +56,17 @@ type pollDesc struct {
 	rrdy    bool
 	rl      sync.Mutex
 	rc      *sync.Cond
-	rt      *time.Timer   // read deadline timer
+	rt      clock.Timer   // read deadline timer
 	rd      time.Duration // read deadline
 	wrdy    bool
 	wl      sync.Mutex
 	wc      *sync.Cond
-	wt      *time.Timer   // write deadline timer
+	wt      clock.Timer   // write deadline timer
 	wd      time.Duration // write deadline
+	err     error         // poller failure confined to this descriptor
+	rwait   int           // goroutines blocked reading
+	wwait   int           // goroutines blocked writing
+	armed   int           // mode netpollarm was last called with
 }
 
 // PollServerInit initialize the poller
@@ -54,9 +84,15 @@ func PollServerDescriptor() int {
 	return netpolldescriptor()
 }
 
+// pollGen is the last generation handed out by PollOpen. The SRT
+// library may reuse a socket ID once it has been closed, so the
+// generation is what tells two incarnations of the same ID apart.
+var pollGen uint64
+
 // PollOpen associate fd with pd
 func PollOpen(fd int) (PollDesc, error) {
 	pd := pollDesc{}
+	pd.gen = atomic.AddUint64(&pollGen, 1)
 	pd.fd = fd
 	pd.closing = false
 	pd.seq++
@@ -70,7 +106,13 @@ func PollOpen(fd int) (PollDesc, error) {
 }
 
 func (pd *pollDesc) Close() {
-	netpollclose(pd.fd)
+	// Neutralize pending deadline timers, so a closed pd isn't kept
+	// alive by timers that would only find it gone when they fire.
+	pd.lock.Lock()
+	pd.seq++
+	pd.stopTimers()
+	pd.lock.Unlock()
+	netpollclose(pd)
 }
 
 func (pd *pollDesc) Wait(mode int) int {
@@ -78,8 +120,7 @@ func (pd *pollDesc) Wait(mode int) int {
 	if err != 0 {
 		return err
 	}
-	netpollblock(pd, mode)
-	return 0
+	return netpollblock(pd, mode)
 }
 
 func (pd *pollDesc) Reset(mode int) int {
@@ -98,14 +139,7 @@ func (pd *pollDesc) SetDeadline(d time.Duration, mode int) {
 	}
 	pd.seq++ // invalidate current timers
 	// Reset current timers.
-	if pd.rt != nil {
-		pd.rt.Stop()
-		pd.rt = nil
-	}
-	if pd.wt != nil {
-		pd.wt.Stop()
-		pd.wt = nil
-	}
+	pd.stopTimers()
 	if d < 0 {
 		d = -1
 	}
@@ -116,19 +150,19 @@ func (pd *pollDesc) SetDeadline(d time.Duration, mode int) {
 	if mode == 'w' || mode == 'r'+'w' {
 		pd.wd = d
 	}
+	seq := pd.seq
 	if pd.rd > 0 && pd.rd == pd.wd {
-		pd.rt = time.AfterFunc(pd.rd, func() {
-			netpollDeadline(pd, pd.seq)
+		pd.rt = Clock.AfterFunc(pd.rd, func() {
+			netpollDeadline(pd, seq)
 		})
 	} else {
-		seq := pd.seq
 		if pd.rd > 0 {
-			pd.rt = time.AfterFunc(pd.rd, func() {
+			pd.rt = Clock.AfterFunc(pd.rd, func() {
 				netpollReadDeadline(pd, seq)
 			})
 		}
 		if pd.wd > 0 {
-			pd.wt = time.AfterFunc(pd.wd, func() {
+			pd.wt = Clock.AfterFunc(pd.wd, func() {
 				netpollWriteDeadline(pd, seq)
 			})
 		}
@@ -142,6 +176,13 @@ func (pd *pollDesc) SetDeadline(d time.Duration, mode int) {
 	}
 }
 
+// Err returns the poller failure reported by Wait or Reset as 3.
+func (pd *pollDesc) Err() error {
+	pd.lock.Lock()
+	defer pd.lock.Unlock()
+	return pd.err
+}
+
 func (pd *pollDesc) Unblock() {
 	pd.lock.Lock()
 	defer pd.lock.Unlock()
@@ -152,6 +193,11 @@ func (pd *pollDesc) Unblock() {
 	pd.seq++
 	netpollunblock(pd, 'r', false)
 	netpollunblock(pd, 'w', false)
+	pd.stopTimers()
+}
+
+// stopTimers stops the deadline timers. pd.lock must be held.
+func (pd *pollDesc) stopTimers() {
 	if pd.rt != nil {
 		pd.rt.Stop()
 		pd.rt = nil
@@ -178,18 +224,24 @@ func netpollcheckerr(pd *pollDesc, mode int) int {
 	if (mode == 'r' && pd.rd < 0) || (mode == 'w' && pd.wd < 0) {
 		return 2 // errTimeout
 	}
+	if pd.Err() != nil {
+		return 3 // pd.err
+	}
 	return 0
 }
 
-func netpollblock(pd *pollDesc, mode int) {
+func netpollblock(pd *pollDesc, mode int) int {
 	c := pd.rc
 	rdy := &pd.rrdy
 	if mode == 'w' {
 		c = pd.wc
 		rdy = &pd.wrdy
-		netpoll_wait_for_write(pd.fd, true)
-		defer netpoll_wait_for_write(pd.fd, false)
 	}
+	if err := netpollwaiting(pd, mode, 1); err != nil {
+		netpollfail(pd, err)
+		return 3
+	}
+	defer netpollwaiting(pd, mode, -1)
 
 	c.L.Lock()
 	defer c.L.Unlock()
@@ -197,6 +249,59 @@ func netpollblock(pd *pollDesc, mode int) {
 		c.Wait()
 	}
 	*rdy = false
+	if pd.Err() != nil {
+		return 3
+	}
+	return 0
+}
+
+// netpollwaiting counts delta goroutines more blocked on pd for mode,
+// and has the backend arm the readiness there are goroutines left to
+// wait for. Readiness arriving between the arming and the wait isn't
+// lost: netpollready records it for the waiter to find.
+func netpollwaiting(pd *pollDesc, mode int, delta int) error {
+	pd.lock.Lock()
+	defer pd.lock.Unlock()
+	if mode == 'r' {
+		pd.rwait += delta
+	} else {
+		pd.wwait += delta
+	}
+	armed := 0
+	if pd.rwait > 0 {
+		armed += 'r'
+	}
+	if pd.wwait > 0 {
+		armed += 'w'
+	}
+	if armed == pd.armed {
+		return nil
+	}
+	if err := netpollarm(pd, armed); err != nil {
+		if delta > 0 {
+			if mode == 'r' {
+				pd.rwait -= delta
+			} else {
+				pd.wwait -= delta
+			}
+		}
+		return err
+	}
+	pd.armed = armed
+	return nil
+}
+
+// netpollfail records a poller failure for pd and wakes up any I/O
+// blocked on it. Only this descriptor is affected; the poll loop and
+// other descriptors carry on.
+func netpollfail(pd *pollDesc, err error) {
+	pd.lock.Lock()
+	if pd.err == nil {
+		pd.err = err
+	}
+	pd.lock.Unlock()
+	netpollunblock(pd, 'r', false)
+	netpollunblock(pd, 'w', false)
 }
 
 func netpollunblock(pd *pollDesc, mode int, ioready bool) {
@@ -6,11 +6,14 @@
 // license that can be found in the LICENSE file.
 // https://github.com/golang/go
 
+// +build !pollscan
+
 package runtime
 
 import (
 	"sync"
 	"sync/atomic"
+	"time"
 
 	"github.com/openfresh/gosrt/logging"
 	"github.com/openfresh/gosrt/srtapi"
@@ -30,6 +33,9 @@ func netpollinit() {
 	var err error
 	epfd, err = srtapi.EpollCreate()
 	if err == nil {
+		if _, err = srtapi.EpollSet(epfd, srtapi.EpollEnableEmpty); err != nil {
+			println("runtime: srt_epoll_set failed with", err.Error())
+		}
 		go run()
 		return
 	}
@@ -48,35 +54,113 @@ func netpolldescriptor() int {
 	return epfd
 }
 
+// minEvents is the least room for events a wait has. The buffer grows
+// with the sockets registered, so that a single wait can report them
+// all.
+const minEvents = 128
+
+// netpollevents returns the events a descriptor armed for mode is
+// registered for.
+func netpollevents(mode int) int {
+	events := srtapi.EpollErr | srtapi.EpollEt
+	if mode == 'r' || mode == 'r'+'w' {
+		events |= srtapi.EpollIn
+	}
+	if mode == 'w' || mode == 'r'+'w' {
+		events |= srtapi.EpollOut
+	}
+	return events
+}
+
 func netpollopen(fd int, pd *pollDesc) error {
-	events := srtapi.EpollIn | srtapi.EpollErr | srtapi.EpollEt
+	events := netpollevents(0)
+	atomic.StoreInt32(&pd.events, int32(events))
 	pdsLock.Lock()
 	pds[fd] = pd
 	pdsLock.Unlock()
-	return srtapi.EpollAddUsock(epfd, fd, events)
+	return epollAddFunc(epfd, fd, events)
 }
 
-func netpollclose(fd int) error {
+func netpollclose(pd *pollDesc) error {
 	pdsLock.Lock()
-	delete(pds, fd)
+	if cur := pds[pd.fd]; cur == nil || cur.gen != pd.gen {
+		// The socket ID has already been handed to a newer
+		// incarnation; its registration is not ours to remove.
+		pdsLock.Unlock()
+		return nil
+	}
+	delete(pds, pd.fd)
 	pdsLock.Unlock()
-	return srtapi.EpollRemoveUsock(epfd, fd)
+	return epollRemoveFunc(epfd, pd.fd)
 }
 
-func netpoll_wait_for_write(fd int, enable bool) {
-	events := srtapi.EpollIn | srtapi.EpollErr | srtapi.EpollEt
-	if enable {
-		events |= srtapi.EpollOut
+// netpollarm updates the registration of pd for mode. pd.lock must be
+// held. libsrt reports the readiness the socket already has when its
+// events change, so a socket that became readable while disarmed is
+// reported once armed.
+func netpollarm(pd *pollDesc, mode int) error {
+	events := netpollevents(mode)
+	if err := epollUpdateFunc(epfd, pd.fd, events); err != nil {
+		return err
+	}
+	atomic.StoreInt32(&pd.events, int32(events))
+	return nil
+}
+
+// netpollstale reports whether an event reported for pd by a wait
+// that started at generation waitGen may belong to an older
+// incarnation of the same socket ID. Such an event is dropped, and the
+// registration is refreshed so that libsrt reports the socket again
+// if the new incarnation really is ready.
+func netpollstale(pd *pollDesc, waitGen uint64) bool {
+	if pd.gen <= waitGen {
+		return false
+	}
+	pdsLock.RLock()
+	var err error
+	if pds[pd.fd] == pd {
+		pd.lock.Lock()
+		err = epollUpdateFunc(epfd, pd.fd, int(atomic.LoadInt32(&pd.events)))
+		pd.lock.Unlock()
+	}
+	pdsLock.RUnlock()
+	if err != nil {
+		netpollfail(pd, err)
 	}
-	srtapi.EpollUpdateUsock(epfd, fd, events)
+	return true
+}
+
+// netpollmode returns the mode of the goroutines to wake up for events.
+// An error wakes up both, for them to find it.
+func netpollmode(events int) int {
+	mode := 0
+	if events&(srtapi.EpollIn|srtapi.EpollErr) != 0 {
+		mode += 'r'
+	}
+	if events&(srtapi.EpollOut|srtapi.EpollErr) != 0 {
+		mode += 'w'
+	}
+	return mode
+}
+
+// readyEvent is an event reported by a wait, with its descriptor.
+type readyEvent struct {
+	pd   *pollDesc
+	mode int
 }
 
 func run() {
-	var rfdslen, wfdslen int
-	var rfds, wfds [128]srtapi.SrtSocket
+	evs := make([]srtapi.SrtEpollEvent, minEvents)
+	var ready []readyEvent
 
 	defer func() {
+		pdsLock.RLock()
+		open := make(map[int]*pollDesc, len(pds))
 		for s, pd := range pds {
+			open[s] = pd
+		}
+		pdsLock.RUnlock()
+		for s, pd := range open {
 			if !pd.closing {
 				srtapi.Close(s)
 			}
@@ -85,72 +169,51 @@ func run() {
 		done <- true
 	}()
 
+	var lastErr error
 	for atomic.LoadInt32(&intState) == 0 {
-		rfdslen = len(rfds)
-		wfdslen = len(wfds)
-
-		if _, err := srtapi.EpollSet(epfd, srtapi.EpollEnableEmpty); err != nil {
-			println("runtime: srt_epoll_set failed with", err.Error())
-			panic("runtime: netpoll::run failed")
+		pdsLock.RLock()
+		if n := len(pds); n > len(evs) {
+			evs = make([]srtapi.SrtEpollEvent, n+n/4)
 		}
-		n := srtapi.EpollWait(epfd, &rfds[0], &rfdslen, &wfds[0], &wfdslen, 100)
-		if n > 0 {
-			pdsLock.RLock()
-			for i := 0; i < rfdslen; i++ {
-				fd := int(rfds[i])
-				if pd := pds[fd]; pd != nil {
-					netpollready(pd, 'r')
-				}
+		pdsLock.RUnlock()
+
+		waitGen := atomic.LoadUint64(&pollGen)
+		n, err := epollUwaitFunc(epfd, &evs[0], len(evs), 100)
+		if err != nil {
+			// Keep polling: a failed wait must not take down every
+			// connection sharing the poller.
+			if err != lastErr {
+				println("runtime: srt_epoll_uwait on fd", epfd, "failed with", err.Error())
+				lastErr = err
 			}
-			for i := 0; i < wfdslen; i++ {
-				fd := int(wfds[i])
-				if pd := pds[fd]; pd != nil {
-					netpollready(pd, 'w')
-				}
-			}
-			pdsLock.RUnlock()
+			time.Sleep(10 * time.Millisecond)
+			continue
 		}
-	}
-}
-
-// this version may be better but it get deadlock state when tring to connect to closed SRT socket currently
-/*func runUWaitVersion() {
-	const fdsSize = 128
-	var fdsSet [fdsSize]srtapi.SrtEpollEvent
-
-	defer func() {
-		for s, pd := range pds {
-			if !pd.closing {
-				srtapi.Close(s)
-			}
+		lastErr = nil
+		if n > len(evs) {
+			n = len(evs)
+		}
+		if n == 0 {
+			continue
 		}
-		srtapi.Cleanup()
-		done <- true
-	}()
 
-	for atomic.LoadInt32(&intState) == 0 {
-		if _, err := srtapi.EpollSet(epfd, srtapi.EpollEnableEmpty); err != nil {
-			println("runtime: srt_epoll_set failed with", err.Error())
-			panic("runtime: netpoll::run failed")
+		// Look the descriptors up under the lock, and wake them up
+		// once it's released, for PollOpen and netpollclose not to
+		// wait for the waiters.
+		ready = ready[:0]
+		pdsLock.RLock()
+		for i := 0; i < n; i++ {
+			fd := int(srtapi.GetFdFromEpollEvent(&evs[i]))
+			if pd := pds[fd]; pd != nil {
+				ready = append(ready, readyEvent{pd, netpollmode(srtapi.GetEventsFromEpollEvent(&evs[i]))})
+			}
 		}
-		n := srtapi.EpollUwait(epfd, &fdsSet[0], fdsSize, 100)
-		if n > 0 {
-			pdsLock.RLock()
-			for i := 0; i < n; i++ {
-				fds := fdsSet[i]
-				fd := int(srtapi.GetFdFromEpollEvent(&fds))
-				events := srtapi.GetEventsFromEpollEvent(&fds)
-				if pd := pds[fd]; pd != nil {
-					var mode int
-					if (events & srtapi.EpollOut) == 0 {
-						mode = 'r'
-					} else {
-						mode = 'w'
-					}
-					netpollready(pd, mode)
-				}
+		pdsLock.RUnlock()
+		for i, ev := range ready {
+			if ev.mode != 0 && !netpollstale(ev.pd, waitGen) {
+				netpollready(ev.pd, ev.mode)
 			}
-			pdsLock.RUnlock()
+			ready[i] = readyEvent{}
 		}
 	}
-}*/
+}
@@ -0,0 +1,129 @@
+// Copyright (c) 2020 CyberAgent, Inc. All rights reserved.
+// https://github.com/openfresh/gosrt
+
+// +build pollscan
+
+package runtime
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/openfresh/gosrt/logging"
+	"github.com/openfresh/gosrt/srtapi"
+)
+
+// The scan backend does without srt_epoll: like a select loop, it
+// reads the SRTO_EVENT flags of every registered socket at each tick.
+// Readiness is level triggered, so a reader that drained a socket
+// between two scans is still woken up by the next one. The scan costs
+// a call per socket and tick, which makes this a fallback for SRT
+// builds whose epoll can't be relied upon rather than the default.
+
+const scanInterval = 5 * time.Millisecond
+
+var (
+	pds      = make(map[int]*pollDesc)
+	pdsLock  = &sync.RWMutex{}
+	intState int32
+	done     = make(chan bool, 1)
+	started  bool
+
+	// Placeholder for the socket event flags query.
+	eventsFunc = func(fd int) (int, error) {
+		return srtapi.GetsockflagInt(fd, srtapi.OptionEvent)
+	}
+)
+
+func netpollinit() {
+	srtapi.Startup()
+	logging.Init()
+	started = true
+	go run()
+}
+
+func netpollshutdown() {
+	atomic.CompareAndSwapInt32(&intState, 0, 1)
+	if started {
+		<-done
+	}
+}
+
+func netpolldescriptor() int {
+	return -1
+}
+
+func netpollopen(fd int, pd *pollDesc) error {
+	atomic.StoreInt32(&pd.events, int32(srtapi.EpollErr))
+	pdsLock.Lock()
+	pds[fd] = pd
+	pdsLock.Unlock()
+	return nil
+}
+
+func netpollclose(pd *pollDesc) error {
+	pdsLock.Lock()
+	if cur := pds[pd.fd]; cur == pd {
+		delete(pds, pd.fd)
+	}
+	pdsLock.Unlock()
+	return nil
+}
+
+// netpollarm sets the events the scan reports pd for to those of mode.
+func netpollarm(pd *pollDesc, mode int) error {
+	events := srtapi.EpollErr
+	if mode == 'r' || mode == 'r'+'w' {
+		events |= srtapi.EpollIn
+	}
+	if mode == 'w' || mode == 'r'+'w' {
+		events |= srtapi.EpollOut
+	}
+	atomic.StoreInt32(&pd.events, int32(events))
+	return nil
+}
+
+// scan reports every registered socket that is ready for the events it
+// waits for.
+func scan() {
+	pdsLock.RLock()
+	defer pdsLock.RUnlock()
+	for fd, pd := range pds {
+		ev, err := eventsFunc(fd)
+		if err != nil {
+			netpollfail(pd, err)
+			continue
+		}
+		armed := int(atomic.LoadInt32(&pd.events))
+		mode := 0
+		if ev&(srtapi.EpollIn|srtapi.EpollErr) != 0 && armed&srtapi.EpollIn != 0 {
+			mode += 'r'
+		}
+		if ev&(srtapi.EpollOut|srtapi.EpollErr) != 0 && armed&srtapi.EpollOut != 0 {
+			mode += 'w'
+		}
+		if mode != 0 {
+			netpollready(pd, mode)
+		}
+	}
+}
+
+func run() {
+	defer func() {
+		for s, pd := range pds {
+			if !pd.closing {
+				srtapi.Close(s)
+			}
+		}
+		srtapi.Cleanup()
+		done <- true
+	}()
+
+	t := time.NewTicker(scanInterval)
+	defer t.Stop()
+	for atomic.LoadInt32(&intState) == 0 {
+		<-t.C
+		scan()
+	}
+}
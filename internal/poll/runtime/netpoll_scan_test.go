@@ -0,0 +1,86 @@
+// Copyright (c) 2020 CyberAgent, Inc. All rights reserved.
+// https://github.com/openfresh/gosrt
+
+// +build pollscan
+
+package runtime
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/openfresh/gosrt/srtapi"
+)
+
+func TestScanReadiness(t *testing.T) {
+	var mu sync.Mutex
+	events := map[int]int{}
+	setEvents := func(fd, ev int) {
+		mu.Lock()
+		events[fd] = ev
+		mu.Unlock()
+	}
+	old := eventsFunc
+	t.Cleanup(func() { eventsFunc = old })
+	eventsFunc = func(fd int) (int, error) {
+		mu.Lock()
+		defer mu.Unlock()
+		ev, ok := events[fd]
+		if !ok {
+			return 0, srtapi.EINVSOCK
+		}
+		return ev, nil
+	}
+
+	const fd, gone = 2000, 2001
+	setEvents(fd, srtapi.EpollOut)
+	ctx, err := PollOpen(fd)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ctx.Close()
+
+	res := make(chan int)
+	go func() { res <- ctx.Wait('r') }()
+	// Writable doesn't wake up a reader.
+	scan()
+	select {
+	case r := <-res:
+		t.Fatalf("reader woken up with %d before the socket was readable", r)
+	case <-time.After(20 * time.Millisecond):
+	}
+	setEvents(fd, srtapi.EpollIn|srtapi.EpollOut)
+	scan()
+	if r := <-res; r != 0 {
+		t.Fatalf("got %d; want 0", r)
+	}
+	// A writer is only woken up once it waits for the socket.
+	go func() { res <- ctx.Wait('w') }()
+	for {
+		scan()
+		select {
+		case r := <-res:
+			if r != 0 {
+				t.Fatalf("got %d; want 0", r)
+			}
+		case <-time.After(scanInterval):
+			continue
+		}
+		break
+	}
+
+	// A socket whose flags can't be read any more fails alone.
+	bad, err := PollOpen(gone)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer bad.Close()
+	scan()
+	if err := bad.Err(); err != srtapi.EINVSOCK {
+		t.Fatalf("got %v; want %v", err, srtapi.EINVSOCK)
+	}
+	if err := ctx.Err(); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,209 @@
+// Copyright (c) 2020 CyberAgent, Inc. All rights reserved.
+// https://github.com/openfresh/gosrt
+
+// +build !pollscan
+
+package runtime
+
+import (
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/openfresh/gosrt/internal/clock"
+	"github.com/openfresh/gosrt/srtapi"
+)
+
+// fakeEpoll replaces the srt epoll calls for the duration of a test.
+// update, if non-nil, decides the result of srt_epoll_update_usock.
+func fakeEpoll(t *testing.T, update func(fd int) error) {
+	add, upd, remove := epollAddFunc, epollUpdateFunc, epollRemoveFunc
+	t.Cleanup(func() {
+		epollAddFunc, epollUpdateFunc, epollRemoveFunc = add, upd, remove
+	})
+	epollAddFunc = func(int, int, int) error { return nil }
+	epollRemoveFunc = func(int, int) error { return nil }
+	epollUpdateFunc = func(_ int, fd int, _ int) error {
+		if update != nil {
+			return update(fd)
+		}
+		return nil
+	}
+}
+
+func TestPollFailureIsolation(t *testing.T) {
+	const bad, good = 1000, 1001
+	fakeEpoll(t, func(fd int) error {
+		if fd == bad {
+			return srtapi.EINVSOCK
+		}
+		return nil
+	})
+
+	bpd, err := PollOpen(bad)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer bpd.Close()
+	gpd, err := PollOpen(good)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer gpd.Close()
+
+	if res := bpd.Wait('w'); res != 3 {
+		t.Fatalf("got %d; want 3", res)
+	}
+	if err := bpd.Err(); err != srtapi.EINVSOCK {
+		t.Fatalf("got %v; want %v", err, srtapi.EINVSOCK)
+	}
+	// Once failed, the descriptor keeps failing instead of blocking.
+	if res := bpd.Reset('r'); res != 3 {
+		t.Fatalf("got %d; want 3", res)
+	}
+
+	// The other descriptor is unaffected.
+	if err := gpd.Err(); err != nil {
+		t.Fatal(err)
+	}
+	gpd.SetDeadline(50*time.Millisecond, 'w')
+	if res := gpd.Wait('w'); res != 0 {
+		t.Fatalf("got %d; want 0", res)
+	}
+	if res := gpd.Reset('w'); res != 2 {
+		t.Fatalf("got %d; want 2", res)
+	}
+}
+
+func TestPollCloseStopsTimers(t *testing.T) {
+	fakeEpoll(t, nil)
+
+	for _, mode := range []int{'r', 'w', 'r' + 'w'} {
+		ctx, err := PollOpen(1002)
+		if err != nil {
+			t.Fatal(err)
+		}
+		pd := ctx.(*pollDesc)
+		if mode == 'r'+'w' {
+			pd.SetDeadline(time.Hour, mode)
+		} else {
+			pd.SetDeadline(time.Hour, 'r')
+			pd.SetDeadline(2*time.Hour, 'w')
+		}
+		pd.lock.Lock()
+		seq := pd.seq
+		pd.lock.Unlock()
+
+		pd.Close()
+		pd.lock.Lock()
+		rt, wt := pd.rt, pd.wt
+		pd.lock.Unlock()
+		if rt != nil || wt != nil {
+			t.Fatalf("mode %d: timers still armed after Close", mode)
+		}
+		// A callback that was already on its way must be a no-op.
+		netpollDeadline(pd, seq)
+		netpollReadDeadline(pd, seq)
+		netpollWriteDeadline(pd, seq)
+	}
+}
+
+func TestPollDeadlineClock(t *testing.T) {
+	fakeEpoll(t, nil)
+	c := clock.NewFake(time.Unix(1000, 0))
+	defer func(orig clock.Clock) { Clock = orig }(Clock)
+	Clock = c
+
+	pd, err := PollOpen(1003)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pd.Close()
+	pd.SetDeadline(time.Hour, 'r')
+	done := make(chan int)
+	go func() { done <- pd.Wait('r') }()
+	select {
+	case res := <-done:
+		t.Fatalf("Wait returned %d before the deadline", res)
+	case <-time.After(20 * time.Millisecond):
+	}
+	c.Advance(time.Hour)
+	if res := <-done; res != 0 {
+		t.Fatalf("got %d; want 0", res)
+	}
+	if res := pd.Reset('r'); res != 2 {
+		t.Fatalf("got %d; want 2", res)
+	}
+}
+
+func TestPollArmOnDemand(t *testing.T) {
+	fakeEpoll(t, nil)
+	var mu sync.Mutex
+	var updates []int
+	epollUpdateFunc = func(_ int, _ int, events int) error {
+		mu.Lock()
+		updates = append(updates, events)
+		mu.Unlock()
+		return nil
+	}
+	next := func() int {
+		t.Helper()
+		for i := 0; i < 100; i++ {
+			mu.Lock()
+			if len(updates) > 0 {
+				ev := updates[0]
+				updates = updates[1:]
+				mu.Unlock()
+				return ev
+			}
+			mu.Unlock()
+			time.Sleep(time.Millisecond)
+		}
+		t.Fatal("no registration update")
+		return 0
+	}
+	const base = srtapi.EpollErr | srtapi.EpollEt
+
+	ctx, err := PollOpen(1004)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ctx.Close()
+	pd := ctx.(*pollDesc)
+	if ev := int(uint32(atomic.LoadInt32(&pd.events))); ev != base {
+		t.Fatalf("registered for %#x; want %#x", ev, base)
+	}
+
+	// Reading arms the read readiness, and a writer joining the write
+	// one, until they are woken up.
+	res := make(chan int)
+	go func() { res <- pd.Wait('r') }()
+	if ev := next(); ev != base|srtapi.EpollIn {
+		t.Fatalf("got %#x while reading; want %#x", ev, base|srtapi.EpollIn)
+	}
+	go func() { res <- pd.Wait('w') }()
+	if ev := next(); ev != base|srtapi.EpollIn|srtapi.EpollOut {
+		t.Fatalf("got %#x while reading and writing; want %#x", ev, base|srtapi.EpollIn|srtapi.EpollOut)
+	}
+	netpollready(pd, 'r')
+	if r := <-res; r != 0 {
+		t.Fatalf("got %d; want 0", r)
+	}
+	if ev := next(); ev != base|srtapi.EpollOut {
+		t.Fatalf("got %#x while writing; want %#x", ev, base|srtapi.EpollOut)
+	}
+	netpollready(pd, 'w')
+	if r := <-res; r != 0 {
+		t.Fatalf("got %d; want 0", r)
+	}
+	if ev := next(); ev != base {
+		t.Fatalf("got %#x once woken up; want %#x", ev, base)
+	}
+
+	// Readiness reported before the wait isn't lost.
+	netpollready(pd, 'r')
+	if r := pd.Wait('r'); r != 0 {
+		t.Fatalf("got %d; want 0", r)
+	}
+}
@@ -15,9 +15,12 @@ import (
 )
 
 // Socket wraps srtapi.Socket.
-func (sw *Switch) Socket(family, sotype, proto int) (s int, err error) {
+func (sw *Switch) Socket() (s int, err error) {
 	sw.once.Do(sw.init)
 
+	// srt_create_socket takes no address family; SRT sockets are
+	// always datagram based.
+	family, sotype, proto := syscall.AF_UNSPEC, syscall.SOCK_DGRAM, 0
 	so := &Status{Cookie: cookie(family, sotype, proto)}
 	sw.fmu.RLock()
 	f := sw.fltab[FilterSocket]
@@ -27,7 +30,7 @@ func (sw *Switch) Socket(family, sotype, proto int) (s int, err error) {
 	if err != nil {
 		return -1, err
 	}
-	s, so.Err = srtapi.Socket(family, sotype, proto)
+	s, so.Err = srtapi.Socket()
 	if err = af.apply(so); err != nil {
 		if so.Err == nil {
 			srtapi.Close(s)
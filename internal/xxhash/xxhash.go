@@ -0,0 +1,139 @@
+// Copyright (c) 2020 CyberAgent, Inc. All rights reserved.
+// https://github.com/openfresh/gosrt
+
+// Package xxhash implements XXH64, the 64-bit xxHash of seed 0, a fast
+// non-cryptographic checksum.
+package xxhash
+
+import (
+	"encoding/binary"
+	"hash"
+	"math/bits"
+)
+
+const (
+	prime1 uint64 = 11400714785074694791
+	prime2 uint64 = 14029467366897019727
+	prime3 uint64 = 1609587929392839161
+	prime4 uint64 = 9650029242287828579
+	prime5 uint64 = 2870177450012600261
+)
+
+// Size is the size of a checksum in bytes.
+const Size = 8
+
+// BlockSize is the block size of the hash in bytes.
+const BlockSize = 32
+
+type digest struct {
+	v     [4]uint64
+	total uint64
+	mem   [BlockSize]byte
+	n     int // bytes in mem
+}
+
+// New returns a new XXH64 hash.
+func New() hash.Hash64 {
+	d := new(digest)
+	d.Reset()
+	return d
+}
+
+// Sum64 returns the XXH64 checksum of b.
+func Sum64(b []byte) uint64 {
+	d := new(digest)
+	d.Reset()
+	d.Write(b)
+	return d.Sum64()
+}
+
+func (d *digest) Reset() {
+	p1, p2 := prime1, prime2 // wrapping, as constants don't
+	d.v = [4]uint64{p1 + p2, p2, 0, -p1}
+	d.total = 0
+	d.n = 0
+}
+
+func (d *digest) Size() int      { return Size }
+func (d *digest) BlockSize() int { return BlockSize }
+
+func round(acc, input uint64) uint64 {
+	acc += input * prime2
+	acc = bits.RotateLeft64(acc, 31)
+	return acc * prime1
+}
+
+func mergeRound(acc, v uint64) uint64 {
+	acc ^= round(0, v)
+	return acc*prime1 + prime4
+}
+
+func (d *digest) stripe(b []byte) {
+	for i := range d.v {
+		d.v[i] = round(d.v[i], binary.LittleEndian.Uint64(b[8*i:]))
+	}
+}
+
+func (d *digest) Write(b []byte) (int, error) {
+	n := len(b)
+	d.total += uint64(n)
+	if d.n+len(b) < BlockSize {
+		d.n += copy(d.mem[d.n:], b)
+		return n, nil
+	}
+	if d.n > 0 {
+		c := copy(d.mem[d.n:], b)
+		d.stripe(d.mem[:])
+		b = b[c:]
+		d.n = 0
+	}
+	for len(b) >= BlockSize {
+		d.stripe(b)
+		b = b[BlockSize:]
+	}
+	d.n = copy(d.mem[:], b)
+	return n, nil
+}
+
+func (d *digest) Sum64() uint64 {
+	var h uint64
+	if d.total >= BlockSize {
+		v := d.v
+		h = bits.RotateLeft64(v[0], 1) + bits.RotateLeft64(v[1], 7) +
+			bits.RotateLeft64(v[2], 12) + bits.RotateLeft64(v[3], 18)
+		for _, x := range v {
+			h = mergeRound(h, x)
+		}
+	} else {
+		h = prime5
+	}
+	h += d.total
+
+	b := d.mem[:d.n]
+	for ; len(b) >= 8; b = b[8:] {
+		h ^= round(0, binary.LittleEndian.Uint64(b))
+		h = bits.RotateLeft64(h, 27)*prime1 + prime4
+	}
+	if len(b) >= 4 {
+		h ^= uint64(binary.LittleEndian.Uint32(b)) * prime1
+		h = bits.RotateLeft64(h, 23)*prime2 + prime3
+		b = b[4:]
+	}
+	for _, c := range b {
+		h ^= uint64(c) * prime5
+		h = bits.RotateLeft64(h, 11) * prime1
+	}
+
+	h ^= h >> 33
+	h *= prime2
+	h ^= h >> 29
+	h *= prime3
+	h ^= h >> 32
+	return h
+}
+
+func (d *digest) Sum(b []byte) []byte {
+	var s [Size]byte
+	binary.BigEndian.PutUint64(s[:], d.Sum64())
+	return append(b, s[:]...)
+}
@@ -0,0 +1,45 @@
+// Copyright (c) 2020 CyberAgent, Inc. All rights reserved.
+// https://github.com/openfresh/gosrt
+
+package xxhash
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestSum64(t *testing.T) {
+	for _, tt := range []struct {
+		in   string
+		want uint64
+	}{
+		{"", 0xef46db3751d8e999},
+		{"a", 0xd24ec4f1a98c6e5b},
+		{"abc", 0x44bc2cf5ad770999},
+		{"Nobody inspects the spammish repetition", 0xfbcea83c8a378bf1},
+	} {
+		if got := Sum64([]byte(tt.in)); got != tt.want {
+			t.Errorf("Sum64(%q) = %#x; want %#x", tt.in, got, tt.want)
+		}
+	}
+}
+
+// TestWrite checks that the checksum doesn't depend on how the input is
+// split.
+func TestWrite(t *testing.T) {
+	in := []byte(strings.Repeat("0123456789abcdef", 20) + "xyz")
+	want := Sum64(in)
+	for step := 1; step < 70; step++ {
+		d := New()
+		for i := 0; i < len(in); i += step {
+			end := i + step
+			if end > len(in) {
+				end = len(in)
+			}
+			d.Write(in[i:end])
+		}
+		if got := d.Sum64(); got != want {
+			t.Fatalf("written %d bytes at a time: %#x; want %#x", step, got, want)
+		}
+	}
+}
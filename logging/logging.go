@@ -1,9 +1,16 @@
 // Copyright (c) 2018 CyberAgent, Inc. All rights reserved.
 // https://github.com/openfresh/gosrt
 
+// +build !nosrtlib,!srtmock
+
 package logging
 
-// #cgo LDFLAGS: -lsrt
+// #cgo !srtstatic,!srtprebuilt,!nopkgconfig pkg-config: srt
+// #cgo !srtstatic,!srtprebuilt,nopkgconfig LDFLAGS: -lsrt
+// #cgo srtstatic,linux LDFLAGS: -Wl,--push-state,-Bstatic -lsrt -lcrypto -Wl,--pop-state -lstdc++ -lm -ldl -lpthread
+// #cgo srtstatic,darwin LDFLAGS: -lsrt -lcrypto -lc++
+// #cgo srtstatic,windows LDFLAGS: -Wl,-Bstatic -lsrt -lcrypto -lstdc++ -Wl,-Bdynamic -lws2_32 -lcrypt32
+// #include <stdlib.h>
 // #include <srt/srt.h>
 // #include "udt_wrapper.h"
 /*
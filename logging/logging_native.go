@@ -0,0 +1,20 @@
+// Copyright (c) 2020 CyberAgent, Inc. All rights reserved.
+// https://github.com/openfresh/gosrt
+
+// +build nosrtlib srtmock
+
+package logging
+
+// HandlerFunc logging handler function type
+type HandlerFunc func(level int, file string, line int, area string, message string)
+
+var handler HandlerFunc
+
+// Init initialize logging function. The native SRT implementation has
+// no internal logs, so there is nothing to set up.
+func Init() {}
+
+// SetHandler set handler
+func SetHandler(h HandlerFunc) {
+	handler = h
+}
@@ -1,6 +1,8 @@
 // Copyright (c) 2018 CyberAgent, Inc. All rights reserved.
 // https://github.com/openfresh/gosrt
 
+// +build !nosrtlib,!srtmock
+
 #include "udt_wrapper.h"
 #include <srt/udt.h>
 
@@ -1,6 +1,8 @@
 // Copyright (c) 2018 CyberAgent, Inc. All rights reserved.
 // https://github.com/openfresh/gosrt
 
+// +build !nosrtlib,!srtmock
+
 #ifndef udt_wrapper_h
 #define udt_wrapper_h
 
@@ -0,0 +1,345 @@
+// Copyright (c) 2020 CyberAgent, Inc. All rights reserved.
+// https://github.com/openfresh/gosrt
+
+// Package migrate keeps the connection of a mobile caller going across
+// network changes. A Conn watches the addresses of the local
+// interfaces; when they change, from a phone moving between cellular
+// and Wi-Fi say, it dials the peer again, and swaps the new connection
+// in for the old one, which it closes once the new one is up. The
+// application reads and writes the Conn throughout, and only sees a
+// stall if the old path died before the new one came up.
+//
+// To let the listener tell a migrated connection from a new session,
+// stream IDs in the access control syntax (see package streamid) are
+// given a session key, "s", if they don't have one, which every dial
+// of the Conn shares, and re-dials the key "resume", the number of the
+// migration. Other stream IDs are sent as they are.
+package migrate
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/openfresh/gosrt/srt"
+	"github.com/openfresh/gosrt/streamid"
+)
+
+// ResumeKey is the stream ID key numbering the migrations.
+const ResumeKey = "resume"
+
+// DefaultInterval is the Interval of a Dialer left zero.
+const DefaultInterval = time.Second
+
+// ErrClosed is the error of the operations of a closed Conn.
+var ErrClosed = errors.New("migrate: use of closed connection")
+
+// A Dialer dials migrating connections.
+type Dialer struct {
+	// Dial dials the peer; it is the DialContext of a zero
+	// srt.Dialer if nil.
+	Dial func(ctx context.Context, network, address string) (net.Conn, error)
+
+	// Interval is how often the local addresses are checked.
+	Interval time.Duration
+
+	// Addrs returns the local addresses; it is net.InterfaceAddrs if
+	// nil. Loopback addresses are ignored.
+	Addrs func() ([]net.Addr, error)
+
+	// OnMigrate, if set, is called after each migration attempt, with
+	// the new connection, or the error dialing it.
+	OnMigrate func(c net.Conn, err error)
+}
+
+// DialContext connects to address, as the Dial function does, and
+// returns the Conn migrating the connection. The options of ctx apply
+// to every dial; ctx itself only bounds the first one.
+func (d *Dialer) DialContext(ctx context.Context, network, address string) (*Conn, error) {
+	c := &Conn{d: d, network: network, address: address, done: make(chan struct{})}
+	c.opts, c.sid = sessionContext(ctx)
+	c.addrs = c.localAddrs()
+	nc, err := c.dial(ctx, 0)
+	if err != nil {
+		return nil, err
+	}
+	c.c = nc
+	go c.watch()
+	return c, nil
+}
+
+// Dial connects to address with a zero Dialer.
+func Dial(ctx context.Context, network, address string) (*Conn, error) {
+	var d Dialer
+	return d.DialContext(ctx, network, address)
+}
+
+// detached carries the values of a context, its options say, without
+// its deadline and cancellation, for the dials of the migrations.
+type detached struct{ context.Context }
+
+func (detached) Deadline() (time.Time, bool) { return time.Time{}, false }
+func (detached) Done() <-chan struct{}       { return nil }
+func (detached) Err() error                  { return nil }
+
+// sessionContext returns ctx detached, and its stream ID with the
+// session key added.
+func sessionContext(ctx context.Context) (context.Context, string) {
+	sid, _ := srt.Option(ctx, "streamid")
+	if m, err := streamid.Parse(sid); err == nil && m["s"] == "" {
+		var b [8]byte
+		rand.Read(b[:])
+		m["s"] = hex.EncodeToString(b[:])
+		if s, err := streamid.Format(m); err == nil {
+			sid = s
+		}
+	}
+	return detached{ctx}, sid
+}
+
+// A Conn is a connection that migrates across network changes. Its
+// methods may be called concurrently, as those of net.Conn.
+type Conn struct {
+	d       *Dialer
+	network string
+	address string
+	opts    context.Context
+	sid     string
+
+	mu        sync.Mutex
+	c         net.Conn
+	gen       int
+	addrs     string
+	closed    bool
+	rdeadline time.Time
+	wdeadline time.Time
+
+	// migmu serializes the migrations
+	migmu sync.Mutex
+
+	done chan struct{}
+}
+
+func (c *Conn) dial(ctx context.Context, gen int) (net.Conn, error) {
+	sid := c.sid
+	if gen > 0 {
+		if m, err := streamid.Parse(sid); err == nil {
+			m[ResumeKey] = strconv.Itoa(gen)
+			if s, err := streamid.Format(m); err == nil {
+				sid = s
+			}
+		}
+	}
+	if sid != "" {
+		ctx = srt.WithOptions(ctx, srt.Options("streamid", sid))
+	}
+	dial := c.d.Dial
+	if dial == nil {
+		var d srt.Dialer
+		dial = d.DialContext
+	}
+	return dial(ctx, c.network, c.address)
+}
+
+// localAddrs returns the local addresses other than loopback ones, as a
+// string to compare.
+func (c *Conn) localAddrs() string {
+	addrs := c.d.Addrs
+	if addrs == nil {
+		addrs = net.InterfaceAddrs
+	}
+	as, err := addrs()
+	if err != nil {
+		return ""
+	}
+	var s []string
+	for _, a := range as {
+		if ipn, ok := a.(*net.IPNet); ok && ipn.IP.IsLoopback() {
+			continue
+		}
+		s = append(s, a.String())
+	}
+	sort.Strings(s)
+	return strings.Join(s, " ")
+}
+
+func (c *Conn) watch() {
+	interval := c.d.Interval
+	if interval <= 0 {
+		interval = DefaultInterval
+	}
+	t := time.NewTicker(interval)
+	defer t.Stop()
+	for {
+		select {
+		case <-t.C:
+			c.check()
+		case <-c.done:
+			return
+		}
+	}
+}
+
+// check migrates the connection if the local addresses changed, once
+// any migration under way is over.
+func (c *Conn) check() {
+	c.migmu.Lock()
+	defer c.migmu.Unlock()
+	addrs := c.localAddrs()
+	c.mu.Lock()
+	if c.closed || addrs == c.addrs {
+		c.mu.Unlock()
+		return
+	}
+	gen := c.gen + 1
+	c.mu.Unlock()
+
+	nc, err := c.dial(c.opts, gen)
+
+	c.mu.Lock()
+	if err != nil || c.closed {
+		c.mu.Unlock()
+		if nc != nil {
+			nc.Close()
+		}
+		if err != nil && c.d.OnMigrate != nil {
+			c.d.OnMigrate(nil, err)
+		}
+		return
+	}
+	old := c.c
+	c.c, c.gen, c.addrs = nc, gen, addrs
+	if !c.rdeadline.IsZero() {
+		nc.SetReadDeadline(c.rdeadline)
+	}
+	if !c.wdeadline.IsZero() {
+		nc.SetWriteDeadline(c.wdeadline)
+	}
+	c.mu.Unlock()
+	old.Close()
+	if c.d.OnMigrate != nil {
+		c.d.OnMigrate(nc, nil)
+	}
+}
+
+func (c *Conn) current() (net.Conn, int, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.closed {
+		return nil, 0, ErrClosed
+	}
+	return c.c, c.gen, nil
+}
+
+// retry reports whether an operation on generation gen that failed
+// should be tried again, on a connection that replaced it, or that
+// replaces it now that the failure prompted a check of the addresses.
+func (c *Conn) retry(gen int) bool {
+	c.check()
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return !c.closed && c.gen != gen
+}
+
+// Read reads from the current connection. A read interrupted by a
+// migration goes on on the new connection.
+func (c *Conn) Read(p []byte) (int, error) {
+	for {
+		nc, gen, err := c.current()
+		if err != nil {
+			return 0, err
+		}
+		n, err := nc.Read(p)
+		if err == nil || n > 0 || isTimeout(err) || !c.retry(gen) {
+			return n, err
+		}
+	}
+}
+
+// Write writes to the current connection, as Read reads.
+func (c *Conn) Write(p []byte) (int, error) {
+	for {
+		nc, gen, err := c.current()
+		if err != nil {
+			return 0, err
+		}
+		n, err := nc.Write(p)
+		if err == nil || n > 0 || isTimeout(err) || !c.retry(gen) {
+			return n, err
+		}
+	}
+}
+
+func isTimeout(err error) bool {
+	var ne net.Error
+	return errors.As(err, &ne) && ne.Timeout()
+}
+
+// Migrations returns the number of times the connection migrated.
+func (c *Conn) Migrations() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.gen
+}
+
+// Conn returns the current connection.
+func (c *Conn) Conn() net.Conn {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.c
+}
+
+// Close closes the connection, and stops watching the addresses.
+func (c *Conn) Close() error {
+	c.mu.Lock()
+	if c.closed {
+		c.mu.Unlock()
+		return ErrClosed
+	}
+	c.closed = true
+	close(c.done)
+	nc := c.c
+	c.mu.Unlock()
+	return nc.Close()
+}
+
+// LocalAddr returns the local address of the current connection.
+func (c *Conn) LocalAddr() net.Addr { return c.Conn().LocalAddr() }
+
+// RemoteAddr returns the address of the peer.
+func (c *Conn) RemoteAddr() net.Addr { return c.Conn().RemoteAddr() }
+
+// SetDeadline sets the read and write deadlines, which carry over to
+// the connections migrated to.
+func (c *Conn) SetDeadline(t time.Time) error {
+	c.mu.Lock()
+	c.rdeadline, c.wdeadline = t, t
+	nc := c.c
+	c.mu.Unlock()
+	return nc.SetDeadline(t)
+}
+
+// SetReadDeadline sets the read deadline, as SetDeadline does.
+func (c *Conn) SetReadDeadline(t time.Time) error {
+	c.mu.Lock()
+	c.rdeadline = t
+	nc := c.c
+	c.mu.Unlock()
+	return nc.SetReadDeadline(t)
+}
+
+// SetWriteDeadline sets the write deadline, as SetDeadline does.
+func (c *Conn) SetWriteDeadline(t time.Time) error {
+	c.mu.Lock()
+	c.wdeadline = t
+	nc := c.c
+	c.mu.Unlock()
+	return nc.SetWriteDeadline(t)
+}
@@ -0,0 +1,137 @@
+// Copyright (c) 2020 CyberAgent, Inc. All rights reserved.
+// https://github.com/openfresh/gosrt
+
+package migrate
+
+import (
+	"context"
+	"io"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/openfresh/gosrt/srt"
+	"github.com/openfresh/gosrt/streamid"
+)
+
+// network fakes the interfaces of a phone, and the listener it dials.
+type network struct {
+	mu    sync.Mutex
+	addrs []net.Addr
+	peers chan net.Conn
+	sids  chan string
+}
+
+func newNetwork(addr string) *network {
+	n := &network{peers: make(chan net.Conn, 4), sids: make(chan string, 4)}
+	n.move(addr)
+	return n
+}
+
+func (n *network) move(addr string) {
+	_, ipn, _ := net.ParseCIDR(addr)
+	n.mu.Lock()
+	n.addrs = []net.Addr{&net.IPNet{IP: net.IPv4(127, 0, 0, 1), Mask: net.CIDRMask(8, 32)}, ipn}
+	n.mu.Unlock()
+}
+
+func (n *network) dialer() *Dialer {
+	return &Dialer{
+		Interval: 10 * time.Millisecond,
+		Addrs: func() ([]net.Addr, error) {
+			n.mu.Lock()
+			defer n.mu.Unlock()
+			return n.addrs, nil
+		},
+		Dial: func(ctx context.Context, network, address string) (net.Conn, error) {
+			sid, _ := srt.Option(ctx, "streamid")
+			c1, c2 := net.Pipe()
+			n.sids <- sid
+			n.peers <- c2
+			return c1, nil
+		},
+	}
+}
+
+func TestMigrate(t *testing.T) {
+	n := newNetwork("10.0.0.2/24")
+	migrated := make(chan error, 1)
+	d := n.dialer()
+	d.OnMigrate = func(_ net.Conn, err error) { migrated <- err }
+	ctx := srt.WithOptions(context.Background(), srt.Options("streamid", "#!::r=live/feed,m=publish"))
+	c, err := d.DialContext(ctx, "srt", "server:5000")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	first := <-n.peers
+	keys, err := streamid.Parse(<-n.sids)
+	if err != nil || keys["r"] != "live/feed" || keys["s"] == "" || keys[ResumeKey] != "" {
+		t.Fatalf("first stream ID keys %v, %v; want the resource and a session", keys, err)
+	}
+	session := keys["s"]
+
+	go c.Write([]byte("before"))
+	b := make([]byte, 16)
+	if m, err := first.Read(b); err != nil || string(b[:m]) != "before" {
+		t.Fatalf("first read %q, %v", b[:m], err)
+	}
+
+	// A read blocked on the old connection goes on on the new one.
+	read := make(chan string, 1)
+	go func() {
+		m, err := c.Read(b)
+		if err != nil {
+			read <- err.Error()
+			return
+		}
+		read <- string(b[:m])
+	}()
+
+	n.move("192.168.1.5/24")
+	if err := <-migrated; err != nil {
+		t.Fatal(err)
+	}
+	second := <-n.peers
+	keys, _ = streamid.Parse(<-n.sids)
+	if keys["s"] != session || keys[ResumeKey] != "1" {
+		t.Errorf("second stream ID keys %v; want session %s, resume 1", keys, session)
+	}
+	if c.Migrations() != 1 {
+		t.Errorf("Migrations() = %d; want 1", c.Migrations())
+	}
+	if _, err := first.Read(b); err != io.EOF {
+		t.Errorf("old connection read: %v; want EOF", err)
+	}
+	if _, err := second.Write([]byte("after")); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case s := <-read:
+		if s != "after" {
+			t.Errorf("read %q; want after", s)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("read did not go on after the migration")
+	}
+}
+
+func TestMigratePlainStreamID(t *testing.T) {
+	n := newNetwork("10.0.0.2/24")
+	ctx := srt.WithOptions(context.Background(), srt.Options("streamid", "feed"))
+	c, err := n.dialer().DialContext(ctx, "srt", "server:5000")
+	if err != nil {
+		t.Fatal(err)
+	}
+	<-n.peers
+	if sid := <-n.sids; sid != "feed" {
+		t.Errorf("stream ID %q; want feed", sid)
+	}
+	if err := c.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.Read(make([]byte, 1)); err != ErrClosed {
+		t.Errorf("read after Close: %v; want ErrClosed", err)
+	}
+}
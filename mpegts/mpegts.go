@@ -0,0 +1,202 @@
+// Copyright (c) 2020 CyberAgent, Inc. All rights reserved.
+// https://github.com/openfresh/gosrt
+
+// Package mpegts keeps MPEG transport streams aligned on their
+// 188-byte packets as they cross SRT connections. Live SRT carries
+// 1316-byte payloads, 7 TS packets each; a payload splitting a packet
+// leaves the receiving demuxer lost until it finds the sync byte
+// again.
+package mpegts
+
+import (
+	"errors"
+	"io"
+)
+
+// PacketSize is the size of a TS packet.
+const PacketSize = 188
+
+// SyncByte starts every TS packet.
+const SyncByte = 0x47
+
+// PacketsPerPayload is the number of TS packets in an SRT live
+// payload of the default 1316 bytes.
+const PacketsPerPayload = 7
+
+// ErrSync reports data that doesn't start with SyncByte where a TS
+// packet should begin.
+var ErrSync = errors.New("mpegts: sync byte not found")
+
+// Writer bundles the TS packets written to it into writes of a fixed
+// number of whole packets to the underlying writer, such as an SRT
+// connection.
+type Writer struct {
+	w    io.Writer
+	buf  []byte
+	size int
+}
+
+// NewWriter returns a Writer writing PacketsPerPayload packets at a
+// time to w.
+func NewWriter(w io.Writer) *Writer {
+	return NewWriterSize(w, PacketsPerPayload)
+}
+
+// NewWriterSize returns a Writer writing the given number of packets
+// at a time to w.
+func NewWriterSize(w io.Writer, packets int) *Writer {
+	if packets < 1 {
+		packets = 1
+	}
+	size := packets * PacketSize
+	return &Writer{w: w, buf: make([]byte, 0, size), size: size}
+}
+
+// Write buffers p, writing out every bundle it completes. p needn't
+// hold whole packets, but each packet must start with SyncByte;
+// otherwise Write stops there and returns ErrSync, with n counting
+// the bytes before the packet.
+func (w *Writer) Write(p []byte) (n int, err error) {
+	for len(p) > 0 {
+		off := len(w.buf) % PacketSize
+		if off == 0 && p[0] != SyncByte {
+			return n, ErrSync
+		}
+		k := PacketSize - off
+		if k > len(p) {
+			k = len(p)
+		}
+		w.buf = append(w.buf, p[:k]...)
+		p = p[k:]
+		n += k
+		if len(w.buf) == w.size {
+			if err := w.flush(); err != nil {
+				return n, err
+			}
+		}
+	}
+	return n, nil
+}
+
+// Flush writes out the whole packets buffered, even if they don't
+// fill a bundle. A trailing partial packet stays buffered.
+func (w *Writer) Flush() error {
+	return w.flush()
+}
+
+// Buffered returns the number of bytes buffered.
+func (w *Writer) Buffered() int {
+	return len(w.buf)
+}
+
+func (w *Writer) flush() error {
+	whole := len(w.buf) - len(w.buf)%PacketSize
+	if whole == 0 {
+		return nil
+	}
+	if _, err := w.w.Write(w.buf[:whole]); err != nil {
+		return err
+	}
+	w.buf = w.buf[:copy(w.buf, w.buf[whole:])]
+	return nil
+}
+
+// readSize is what Reader reads at a time, enough for any SRT
+// payload.
+const readSize = 64 * PacketSize
+
+// Reader reads whole TS packets from an underlying reader, such as an
+// SRT connection, checking their sync bytes.
+type Reader struct {
+	r        io.Reader
+	buf      []byte
+	off, end int
+	err      error
+	dropped  int64
+}
+
+// NewReader returns a Reader reading from r.
+func NewReader(r io.Reader) *Reader {
+	return &Reader{r: r, buf: make([]byte, readSize+PacketSize)}
+}
+
+// Read reads whole packets into p, which must hold at least one. On
+// finding data without a sync byte where a packet should begin, Read
+// skips to the next SyncByte and returns ErrSync; reading may go on
+// from there.
+func (r *Reader) Read(p []byte) (int, error) {
+	if len(p) < PacketSize {
+		return 0, io.ErrShortBuffer
+	}
+	for {
+		if r.off < r.end && r.buf[r.off] != SyncByte {
+			r.resync()
+			return 0, ErrSync
+		}
+		if avail := r.end - r.off; avail >= PacketSize {
+			n := len(p) - len(p)%PacketSize
+			if whole := avail - avail%PacketSize; n > whole {
+				n = whole
+			}
+			// Stop short of a packet that lost sync, so the packets
+			// before it are delivered first.
+			for i := PacketSize; i < n; i += PacketSize {
+				if r.buf[r.off+i] != SyncByte {
+					n = i
+					break
+				}
+			}
+			copy(p, r.buf[r.off:r.off+n])
+			r.off += n
+			return n, nil
+		}
+		if r.err != nil {
+			if r.off < r.end && r.err == io.EOF {
+				r.dropped += int64(r.end - r.off)
+				r.off = r.end
+				return 0, io.ErrUnexpectedEOF
+			}
+			return 0, r.err
+		}
+		r.fill()
+	}
+}
+
+// Dropped returns the number of bytes skipped to regain sync, or left
+// over at the end of the stream.
+func (r *Reader) Dropped() int64 {
+	return r.dropped
+}
+
+func (r *Reader) resync() {
+	i := r.off + 1
+	for i < r.end && r.buf[i] != SyncByte {
+		i++
+	}
+	r.dropped += int64(i - r.off)
+	r.off = i
+}
+
+// maxEmptyReads is the number of empty reads in a row after which
+// fill gives up, as bufio does.
+const maxEmptyReads = 100
+
+// fill reads once more from r, after what is buffered.
+func (r *Reader) fill() {
+	if r.off > 0 {
+		r.end = copy(r.buf, r.buf[r.off:r.end])
+		r.off = 0
+	}
+	for i := 0; i < maxEmptyReads; i++ {
+		n, err := r.r.Read(r.buf[r.end:])
+		r.end += n
+		if err != nil {
+			r.err = err
+			return
+		}
+		if n > 0 {
+			return
+		}
+	}
+	r.err = io.ErrNoProgress
+}
@@ -0,0 +1,138 @@
+// Copyright (c) 2020 CyberAgent, Inc. All rights reserved.
+// https://github.com/openfresh/gosrt
+
+package mpegts
+
+import (
+	"bytes"
+	"io"
+	"testing"
+	"testing/iotest"
+)
+
+// packets returns n TS packets, each filled with its index.
+func packets(n int) []byte {
+	b := make([]byte, 0, n*PacketSize)
+	for i := 0; i < n; i++ {
+		p := bytes.Repeat([]byte{byte(i)}, PacketSize)
+		p[0] = SyncByte
+		b = append(b, p...)
+	}
+	return b
+}
+
+// writes records each write.
+type writes [][]byte
+
+func (w *writes) Write(p []byte) (int, error) {
+	*w = append(*w, append([]byte(nil), p...))
+	return len(p), nil
+}
+
+func TestWriter(t *testing.T) {
+	var got writes
+	w := NewWriter(&got)
+	data := packets(17)
+	// Write in pieces that split packets.
+	for b := data; len(b) > 0; {
+		k := 100
+		if k > len(b) {
+			k = len(b)
+		}
+		if n, err := w.Write(b[:k]); n != k || err != nil {
+			t.Fatalf("got %d, %v; want %d, nil", n, err, k)
+		}
+		b = b[k:]
+	}
+	if len(got) != 2 {
+		t.Fatalf("got %d writes before Flush; want 2", len(got))
+	}
+	if w.Buffered() != 3*PacketSize {
+		t.Errorf("got %d bytes buffered; want %d", w.Buffered(), 3*PacketSize)
+	}
+	if err := w.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	for i, want := range []int{7, 7, 3} {
+		if len(got[i]) != want*PacketSize {
+			t.Errorf("write #%d: got %d bytes; want %d packets", i, len(got[i]), want)
+		}
+	}
+	if !bytes.Equal(bytes.Join(got, nil), data) {
+		t.Error("written data differs")
+	}
+}
+
+func TestWriterSync(t *testing.T) {
+	var got writes
+	w := NewWriter(&got)
+	data := append(packets(1), 0x00, SyncByte)
+	n, err := w.Write(data)
+	if n != PacketSize || err != ErrSync {
+		t.Fatalf("got %d, %v; want %d, %v", n, err, PacketSize, ErrSync)
+	}
+	// A partial packet is completed by the next write.
+	if n, err := w.Write(packets(1)[:10]); n != 10 || err != nil {
+		t.Fatalf("got %d, %v; want 10, nil", n, err)
+	}
+	if n, err := w.Write([]byte{0x00}); n != 1 || err != nil {
+		t.Fatalf("got %d, %v; want 1, nil", n, err)
+	}
+}
+
+func TestReader(t *testing.T) {
+	data := packets(10)
+	r := NewReader(iotest.OneByteReader(bytes.NewReader(data)))
+	var got []byte
+	p := make([]byte, 3*PacketSize+50)
+	for {
+		n, err := r.Read(p)
+		if n%PacketSize != 0 {
+			t.Fatalf("got %d bytes; want whole packets", n)
+		}
+		got = append(got, p[:n]...)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	if !bytes.Equal(got, data) {
+		t.Error("read data differs")
+	}
+	if _, err := r.Read(make([]byte, 10)); err != io.ErrShortBuffer {
+		t.Errorf("got %v; want %v", err, io.ErrShortBuffer)
+	}
+}
+
+func TestReaderSync(t *testing.T) {
+	good := packets(3)
+	var data []byte
+	data = append(data, good[:PacketSize]...)
+	data = append(data, 0x01, 0x02, 0x03)
+	data = append(data, good[PacketSize:]...)
+	data = append(data, SyncByte, 0x00)
+	r := NewReader(bytes.NewReader(data))
+	p := make([]byte, 10*PacketSize)
+
+	steps := []struct {
+		n   int
+		err error
+	}{
+		{PacketSize, nil},
+		{0, ErrSync},
+		{2 * PacketSize, nil},
+		{0, io.ErrUnexpectedEOF},
+		{0, io.EOF},
+	}
+	for i, st := range steps {
+		n, err := r.Read(p)
+		if n != st.n || err != st.err {
+			t.Fatalf("#%d: got %d, %v; want %d, %v", i, n, err, st.n, st.err)
+		}
+	}
+	if r.Dropped() != 5 {
+		t.Errorf("got %d bytes dropped; want 5", r.Dropped())
+	}
+}
@@ -0,0 +1,118 @@
+// Copyright (c) 2020 CyberAgent, Inc. All rights reserved.
+// https://github.com/openfresh/gosrt
+
+package mpegts
+
+import (
+	"context"
+	"io"
+	"time"
+)
+
+// pcrHz is the frequency of the PCR clock.
+const pcrHz = 27000000
+
+// pcrWrap is where PCR values wrap around: the 33-bit base counts at
+// 90 kHz, 300 ticks of the 27 MHz clock.
+const pcrWrap = (1 << 33) * 300
+
+// maxPCRJump is the largest step from a PCR to the next that Play
+// paces; larger ones, and steps back, are discontinuities the stream
+// restarts its clock at.
+const maxPCRJump = 2 * time.Second
+
+// PCR returns the program clock reference of the TS packet p, in
+// ticks of 27 MHz, and whether p carries one.
+func PCR(p []byte) (int64, bool) {
+	if len(p) < 12 || p[0] != SyncByte || p[3]&0x20 == 0 || p[4] < 7 || p[5]&0x10 == 0 {
+		return 0, false
+	}
+	base := int64(p[6])<<25 | int64(p[7])<<17 | int64(p[8])<<9 | int64(p[9])<<1 | int64(p[10])>>7
+	ext := int64(p[10]&0x01)<<8 | int64(p[11])
+	return base*300 + ext, true
+}
+
+// pid returns the packet identifier of the TS packet p.
+func pid(p []byte) int {
+	return int(p[1]&0x1f)<<8 | int(p[2])
+}
+
+// Play copies the transport stream read from r to w at the speed its
+// PCRs give, as a live source would produce it, until r ends or ctx is
+// done. It replays recordings in real time, for tests or playout. w
+// gets PacketsPerPayload packets at a time, fewer when waiting for
+// the time of the next PCR. The clock follows the first PID carrying
+// PCRs, and restarts at its discontinuities. Play returns the number
+// of bytes written.
+func Play(ctx context.Context, w io.Writer, r io.Reader) (int64, error) {
+	var (
+		cw      = &countWriter{w: w}
+		tw      = NewWriter(cw)
+		tr      = NewReader(r)
+		buf     = make([]byte, PacketSize)
+		clock   = -1 // PID of the PCRs
+		prev    int64
+		elapsed time.Duration // since start, as the PCRs tell
+		start   time.Time
+	)
+	for {
+		n, err := tr.Read(buf)
+		if err == ErrSync {
+			continue
+		}
+		if err == io.EOF {
+			err = tw.Flush()
+			return cw.n, err
+		}
+		if err != nil {
+			return cw.n, err
+		}
+		if pcr, ok := PCR(buf); ok && (clock < 0 || pid(buf) == clock) {
+			clock = pid(buf)
+			ticks := (pcr - prev + pcrWrap) % pcrWrap
+			step := time.Duration(ticks * 1000 / (pcrHz / 1000000))
+			prev = pcr
+			if start.IsZero() || step > maxPCRJump || buf[5]&0x80 != 0 {
+				elapsed, start = 0, time.Now()
+			} else {
+				elapsed += step
+			}
+			if wait := time.Until(start.Add(elapsed)); wait > 0 {
+				if err := tw.Flush(); err != nil {
+					return cw.n, err
+				}
+				if err := sleep(ctx, wait); err != nil {
+					return cw.n, err
+				}
+			}
+		}
+		if _, err := tw.Write(buf[:n]); err != nil {
+			return cw.n, err
+		}
+		if err := ctx.Err(); err != nil {
+			return cw.n, err
+		}
+	}
+}
+
+func sleep(ctx context.Context, d time.Duration) error {
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-t.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+type countWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (w *countWriter) Write(p []byte) (int, error) {
+	n, err := w.w.Write(p)
+	w.n += int64(n)
+	return n, err
+}
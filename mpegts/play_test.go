@@ -0,0 +1,96 @@
+// Copyright (c) 2020 CyberAgent, Inc. All rights reserved.
+// https://github.com/openfresh/gosrt
+
+package mpegts
+
+import (
+	"bytes"
+	"context"
+	"testing"
+	"time"
+)
+
+// pcrPacket returns a TS packet of PID 0x100 carrying pcr.
+func pcrPacket(pcr int64, discontinuity bool) []byte {
+	p := make([]byte, PacketSize)
+	p[0], p[1], p[2], p[3] = SyncByte, 0x01, 0x00, 0x30
+	p[4], p[5] = 7, 0x10
+	if discontinuity {
+		p[5] |= 0x80
+	}
+	base, ext := pcr/300, pcr%300
+	p[6], p[7], p[8], p[9] = byte(base>>25), byte(base>>17), byte(base>>9), byte(base>>1)
+	p[10] = byte(base<<7) | 0x7e | byte(ext>>8)
+	p[11] = byte(ext)
+	return p
+}
+
+func TestPCR(t *testing.T) {
+	for _, want := range []int64{0, 1, 299, 300, 27000000, pcrWrap - 1} {
+		if got, ok := PCR(pcrPacket(want, false)); !ok || got != want {
+			t.Errorf("got %d, %v; want %d, true", got, ok, want)
+		}
+	}
+	if _, ok := PCR(packets(1)); ok {
+		t.Error("found a PCR in a packet without adaptation field")
+	}
+}
+
+func TestPlay(t *testing.T) {
+	var data []byte
+	// 300ms of stream, then a discontinuity that must not be waited
+	// for.
+	for i := int64(0); i <= 3; i++ {
+		data = append(data, pcrPacket(i*pcrHz/10, false)...)
+		data = append(data, packets(10)...)
+	}
+	data = append(data, pcrPacket(pcrHz*3600, true)...)
+	data = append(data, packets(3)...)
+
+	var got writes
+	start := time.Now()
+	n, err := Play(context.Background(), &got, bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if elapsed := time.Since(start); elapsed < 300*time.Millisecond || elapsed > 2*time.Second {
+		t.Errorf("played in %v; want about 300ms", elapsed)
+	}
+	if n != int64(len(data)) || !bytes.Equal(bytes.Join(got, nil), data) {
+		t.Errorf("got %d bytes; want %d, unchanged", n, len(data))
+	}
+	for i, w := range got {
+		if len(w)%PacketSize != 0 || len(w) > PacketsPerPayload*PacketSize {
+			t.Errorf("write #%d: got %d bytes", i, len(w))
+		}
+	}
+}
+
+func TestPlayLongerThanJump(t *testing.T) {
+	// PCRs 500ms apart pace the stream past maxPCRJump from the first.
+	var data []byte
+	for i := int64(0); i <= 5; i++ {
+		data = append(data, pcrPacket(i*pcrHz/2, false)...)
+	}
+	var got writes
+	start := time.Now()
+	if _, err := Play(context.Background(), &got, bytes.NewReader(data)); err != nil {
+		t.Fatal(err)
+	}
+	if elapsed := time.Since(start); elapsed < 2500*time.Millisecond {
+		t.Errorf("played in %v; want 2.5s", elapsed)
+	}
+}
+
+func TestPlayCanceled(t *testing.T) {
+	var data []byte
+	for i := int64(0); i < 10; i++ {
+		data = append(data, pcrPacket(i*pcrHz, false)...)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	var got writes
+	if _, err := Play(ctx, &got, bytes.NewReader(data)); err != context.DeadlineExceeded {
+		t.Errorf("got %v; want %v", err, context.DeadlineExceeded)
+	}
+}
@@ -0,0 +1,589 @@
+// Copyright (c) 2020 CyberAgent, Inc. All rights reserved.
+// https://github.com/openfresh/gosrt
+
+// Package mux carries independent streams over a single SRT connection,
+// so that the media, its control channel and its metadata share one
+// handshake and one port. Each stream is a net.Conn of its own, with
+// flow control: a stream whose reader lags holds back its writer only.
+//
+// Streams travel as frames each written in one message, MaxFrameSize
+// long at most, which live mode connections carry as they are and
+// stream mode connections split anywhere; either way, no message may be
+// lost, so live mode connections need "tlpktdrop" disabled.
+package mux
+
+import (
+	"encoding/binary"
+	"errors"
+	"io"
+	"net"
+	"os"
+	"sync"
+	"time"
+)
+
+// Errors of sessions and streams.
+var (
+	ErrSessionClosed = errors.New("mux: session closed")
+	ErrStreamClosed  = errors.New("mux: stream closed")
+	ErrStreamReset   = errors.New("mux: stream reset by peer")
+	ErrProtocol      = errors.New("mux: protocol error")
+)
+
+// Window is the number of bytes a stream may send ahead of what its
+// peer read.
+const Window = 256 << 10
+
+// Defaults of the Config fields left zero.
+const (
+	DefaultMaxFrameSize  = 1316
+	DefaultAcceptBacklog = 256
+)
+
+// Frame types and flags. A frame starts with its type, flags, stream ID
+// and length, followed by length bytes of data; the length of a window
+// update is the number of bytes the receiver read, and no data follow.
+const (
+	typeData   = 0
+	typeWindow = 1
+
+	flagSYN = 1 << 0 // opens the stream
+	flagFIN = 1 << 1 // the sender won't write more
+	flagRST = 1 << 2 // the sender dropped the stream
+
+	headerSize = 10
+)
+
+// A Config tunes a Session. The zero Config is ready to use.
+type Config struct {
+	// MaxFrameSize bounds the frames, and so the messages, the
+	// Session writes. In live mode, it must not exceed the payload
+	// size of the connection. Zero means DefaultMaxFrameSize.
+	MaxFrameSize int
+
+	// AcceptBacklog is how many streams the peer may open ahead of
+	// Accept; further ones are reset. Zero means
+	// DefaultAcceptBacklog.
+	AcceptBacklog int
+}
+
+// A Session multiplexes streams over a connection. One end of the
+// connection makes a Client session and the other a Server one; either
+// may open streams, which the other accepts.
+type Session struct {
+	conn     io.ReadWriteCloser
+	maxFrame int
+	accepts  chan *Stream
+	done     chan struct{}
+
+	wmu sync.Mutex // serializes the frames
+
+	mu      sync.Mutex
+	streams map[uint32]*Stream
+	nextID  uint32
+	err     error // why the session ended
+}
+
+// Client returns a session over conn for the end that dialed it. The
+// Session owns conn from then on.
+func Client(conn io.ReadWriteCloser, config *Config) *Session {
+	return newSession(conn, config, 1)
+}
+
+// Server returns a session over conn for the end that accepted it.
+func Server(conn io.ReadWriteCloser, config *Config) *Session {
+	return newSession(conn, config, 2)
+}
+
+func newSession(conn io.ReadWriteCloser, config *Config, firstID uint32) *Session {
+	if config == nil {
+		config = &Config{}
+	}
+	s := &Session{
+		conn:     conn,
+		maxFrame: config.MaxFrameSize,
+		done:     make(chan struct{}),
+		streams:  map[uint32]*Stream{},
+		nextID:   firstID,
+	}
+	if s.maxFrame <= headerSize {
+		s.maxFrame = DefaultMaxFrameSize
+	}
+	backlog := config.AcceptBacklog
+	if backlog <= 0 {
+		backlog = DefaultAcceptBacklog
+	}
+	s.accepts = make(chan *Stream, backlog)
+	go s.receive()
+	return s
+}
+
+// Open opens a new stream.
+func (s *Session) Open() (*Stream, error) {
+	s.mu.Lock()
+	if s.err != nil {
+		s.mu.Unlock()
+		return nil, s.err
+	}
+	st := newStream(s, s.nextID)
+	// Client streams are odd, server ones even.
+	s.nextID += 2
+	s.streams[st.id] = st
+	s.mu.Unlock()
+	if err := s.writeFrame(typeData, flagSYN, st.id, 0, nil); err != nil {
+		return nil, err
+	}
+	return st, nil
+}
+
+// AcceptStream waits for the peer to open a stream and returns it.
+func (s *Session) AcceptStream() (*Stream, error) {
+	select {
+	case st := <-s.accepts:
+		return st, nil
+	case <-s.done:
+		return nil, s.err
+	}
+}
+
+// Accept implements the net.Listener Accept method, so that servers
+// written for listeners can serve the streams of a session.
+func (s *Session) Accept() (net.Conn, error) {
+	st, err := s.AcceptStream()
+	if err != nil {
+		return nil, err
+	}
+	return st, nil
+}
+
+// Addr returns the local address of the connection, if it has one.
+func (s *Session) Addr() net.Addr {
+	if c, ok := s.conn.(net.Conn); ok {
+		return c.LocalAddr()
+	}
+	return nil
+}
+
+// NumStreams returns the number of streams open, counting those closed
+// on this end until the peer closes them too.
+func (s *Session) NumStreams() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.streams)
+}
+
+// Done returns a channel closed once the session ended.
+func (s *Session) Done() <-chan struct{} { return s.done }
+
+// Close closes the connection, and with it every stream.
+func (s *Session) Close() error {
+	if !s.shutdown(ErrSessionClosed) {
+		return ErrSessionClosed
+	}
+	return s.conn.Close()
+}
+
+// shutdown ends the session with err, reporting whether it was the
+// first to.
+func (s *Session) shutdown(err error) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.err != nil {
+		return false
+	}
+	s.err = err
+	close(s.done)
+	return true
+}
+
+func (s *Session) writeFrame(typ, flags byte, id, length uint32, data []byte) error {
+	s.wmu.Lock()
+	defer s.wmu.Unlock()
+	select {
+	case <-s.done:
+		return s.err
+	default:
+	}
+	b := make([]byte, headerSize, headerSize+len(data))
+	b[0], b[1] = typ, flags
+	binary.BigEndian.PutUint32(b[2:], id)
+	binary.BigEndian.PutUint32(b[6:], length)
+	if _, err := s.conn.Write(append(b, data...)); err != nil {
+		if s.shutdown(err) {
+			s.conn.Close()
+		}
+		return err
+	}
+	return nil
+}
+
+// receive reads the frames, which may span messages, until the
+// connection fails.
+func (s *Session) receive() {
+	b := make([]byte, 64<<10)
+	var buf []byte
+	for {
+		n, err := s.conn.Read(b)
+		if err != nil {
+			if s.shutdown(err) {
+				s.conn.Close()
+			}
+			return
+		}
+		buf = append(buf, b[:n]...)
+		for len(buf) >= headerSize {
+			typ, flags := buf[0], buf[1]
+			id := binary.BigEndian.Uint32(buf[2:])
+			length := binary.BigEndian.Uint32(buf[6:])
+			size := headerSize
+			if typ == typeData {
+				if length > Window {
+					s.fail()
+					return
+				}
+				size += int(length)
+			}
+			if len(buf) < size {
+				break
+			}
+			if !s.handle(typ, flags, id, length, buf[headerSize:size]) {
+				s.fail()
+				return
+			}
+			buf = buf[size:]
+		}
+		if len(buf) == 0 {
+			buf = nil
+		}
+	}
+}
+
+func (s *Session) fail() {
+	if s.shutdown(ErrProtocol) {
+		s.conn.Close()
+	}
+}
+
+// handle processes a frame, reporting whether it was valid.
+func (s *Session) handle(typ, flags byte, id, length uint32, data []byte) bool {
+	if typ != typeData && typ != typeWindow {
+		return false
+	}
+	s.mu.Lock()
+	st := s.streams[id]
+	if flags&flagSYN != 0 {
+		if st != nil || id%2 == s.nextID%2 || id == 0 {
+			s.mu.Unlock()
+			return false
+		}
+		st = newStream(s, id)
+		select {
+		case s.accepts <- st:
+			s.streams[id] = st
+		default:
+			s.mu.Unlock()
+			go s.writeFrame(typeData, flagRST, id, 0, nil)
+			return true
+		}
+	}
+	s.mu.Unlock()
+	if st == nil {
+		// A stream closed meanwhile.
+		return true
+	}
+	if typ == typeWindow {
+		st.grant(length)
+	} else if !st.push(data) {
+		return false
+	}
+	if flags&flagFIN != 0 {
+		st.finish()
+	}
+	if flags&flagRST != 0 {
+		st.reset()
+	}
+	return true
+}
+
+func (s *Session) remove(id uint32) {
+	s.mu.Lock()
+	delete(s.streams, id)
+	s.mu.Unlock()
+}
+
+// A Stream is a bidirectional stream of a Session.
+type Stream struct {
+	s  *Session
+	id uint32
+
+	readable chan struct{} // signaled on data, FIN, RST and deadline changes
+	writable chan struct{} // signaled on window updates, RST and deadline changes
+
+	mu            sync.Mutex
+	buf           []byte
+	unacked       uint32 // bytes read but not yet granted back
+	sendWindow    uint32
+	readDeadline  time.Time
+	writeDeadline time.Time
+	finished      bool // by the peer
+	closed        bool
+	writeClosed   bool
+	wasReset      bool
+}
+
+func newStream(s *Session, id uint32) *Stream {
+	return &Stream{
+		s:          s,
+		id:         id,
+		readable:   make(chan struct{}, 1),
+		writable:   make(chan struct{}, 1),
+		sendWindow: Window,
+	}
+}
+
+func signal(c chan struct{}) {
+	select {
+	case c <- struct{}{}:
+	default:
+	}
+}
+
+// ID returns the ID of the stream, unique within its session.
+func (st *Stream) ID() uint32 { return st.id }
+
+func (st *Stream) push(data []byte) bool {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	if st.closed {
+		// Grant back what is dropped, lest the peer wait for the
+		// window until it closes the stream too.
+		st.unacked += uint32(len(data))
+		if st.unacked >= Window/2 {
+			go st.s.writeFrame(typeWindow, 0, st.id, st.unacked, nil)
+			st.unacked = 0
+		}
+		return true
+	}
+	if len(st.buf)+len(data) > Window {
+		return false
+	}
+	st.buf = append(st.buf, data...)
+	signal(st.readable)
+	return true
+}
+
+func (st *Stream) grant(n uint32) {
+	st.mu.Lock()
+	st.sendWindow += n
+	st.mu.Unlock()
+	signal(st.writable)
+}
+
+func (st *Stream) finish() {
+	st.mu.Lock()
+	st.finished = true
+	closed := st.closed
+	st.mu.Unlock()
+	signal(st.readable)
+	if closed {
+		st.s.remove(st.id)
+	}
+}
+
+func (st *Stream) reset() {
+	st.mu.Lock()
+	st.wasReset = true
+	st.mu.Unlock()
+	signal(st.readable)
+	signal(st.writable)
+	st.s.remove(st.id)
+}
+
+// wait waits for c to be signaled, until deadline or the end of the
+// session.
+func (st *Stream) wait(c chan struct{}, deadline time.Time) error {
+	var timeout <-chan time.Time
+	if !deadline.IsZero() {
+		d := time.Until(deadline)
+		if d <= 0 {
+			return os.ErrDeadlineExceeded
+		}
+		t := time.NewTimer(d)
+		defer t.Stop()
+		timeout = t.C
+	}
+	select {
+	case <-c:
+		return nil
+	case <-timeout:
+		return os.ErrDeadlineExceeded
+	case <-st.s.done:
+		return st.s.err
+	}
+}
+
+// Read reads data of the stream, and returns io.EOF once the peer
+// closed it and all was read.
+func (st *Stream) Read(b []byte) (int, error) {
+	for {
+		st.mu.Lock()
+		switch {
+		case st.closed:
+			st.mu.Unlock()
+			return 0, ErrStreamClosed
+		case len(st.buf) > 0:
+			n := copy(b, st.buf)
+			st.buf = st.buf[n:]
+			st.unacked += uint32(n)
+			// Grant the window back by halves, not to flood the
+			// connection with updates.
+			var grant uint32
+			if st.unacked >= Window/2 || len(st.buf) == 0 && st.unacked > 0 {
+				grant, st.unacked = st.unacked, 0
+			}
+			st.mu.Unlock()
+			if grant > 0 {
+				st.s.writeFrame(typeWindow, 0, st.id, grant, nil)
+			}
+			return n, nil
+		case st.wasReset:
+			st.mu.Unlock()
+			return 0, ErrStreamReset
+		case st.finished:
+			st.mu.Unlock()
+			return 0, io.EOF
+		}
+		deadline := st.readDeadline
+		st.mu.Unlock()
+		if err := st.wait(st.readable, deadline); err != nil {
+			return 0, err
+		}
+	}
+}
+
+// Write writes b to the stream, waiting for the peer to read when b
+// exceeds the window.
+func (st *Stream) Write(b []byte) (int, error) {
+	max := st.s.maxFrame - headerSize
+	var nn int
+	for nn < len(b) {
+		st.mu.Lock()
+		switch {
+		case st.closed || st.writeClosed:
+			st.mu.Unlock()
+			return nn, ErrStreamClosed
+		case st.wasReset:
+			st.mu.Unlock()
+			return nn, ErrStreamReset
+		case st.sendWindow == 0:
+			deadline := st.writeDeadline
+			st.mu.Unlock()
+			if err := st.wait(st.writable, deadline); err != nil {
+				return nn, err
+			}
+			continue
+		}
+		n := len(b) - nn
+		if n > max {
+			n = max
+		}
+		if uint32(n) > st.sendWindow {
+			n = int(st.sendWindow)
+		}
+		st.sendWindow -= uint32(n)
+		st.mu.Unlock()
+		if err := st.s.writeFrame(typeData, 0, st.id, uint32(n), b[nn:nn+n]); err != nil {
+			return nn, err
+		}
+		nn += n
+	}
+	return nn, nil
+}
+
+// Close closes the stream: the peer reads io.EOF once it read what was
+// written. What the peer writes until it closes the stream too is
+// dropped, and granted back so that its writes don't block; the stream
+// is done with then.
+func (st *Stream) Close() error {
+	st.mu.Lock()
+	if st.closed {
+		st.mu.Unlock()
+		return ErrStreamClosed
+	}
+	st.closed = true
+	wasReset, finished, writeClosed := st.wasReset, st.finished, st.writeClosed
+	grant := st.unacked + uint32(len(st.buf))
+	st.buf, st.unacked = nil, 0
+	st.mu.Unlock()
+	signal(st.readable)
+	signal(st.writable)
+	if wasReset {
+		return nil
+	}
+	if finished {
+		st.s.remove(st.id)
+	} else if grant > 0 {
+		if err := st.s.writeFrame(typeWindow, 0, st.id, grant, nil); err != nil {
+			return err
+		}
+	}
+	if writeClosed {
+		return nil
+	}
+	return st.s.writeFrame(typeData, flagFIN, st.id, 0, nil)
+}
+
+// CloseWrite closes the writing side of the stream: the peer reads
+// io.EOF once it read what was written, while the stream can still be
+// read. Close is still needed to be done with the stream.
+func (st *Stream) CloseWrite() error {
+	st.mu.Lock()
+	if st.closed || st.writeClosed {
+		st.mu.Unlock()
+		return ErrStreamClosed
+	}
+	st.writeClosed = true
+	wasReset := st.wasReset
+	st.mu.Unlock()
+	signal(st.writable)
+	if wasReset {
+		return nil
+	}
+	return st.s.writeFrame(typeData, flagFIN, st.id, 0, nil)
+}
+
+// LocalAddr returns the local address of the connection, if it has one.
+func (st *Stream) LocalAddr() net.Addr { return st.s.Addr() }
+
+// RemoteAddr returns the remote address of the connection, if it has
+// one.
+func (st *Stream) RemoteAddr() net.Addr {
+	if c, ok := st.s.conn.(net.Conn); ok {
+		return c.RemoteAddr()
+	}
+	return nil
+}
+
+// SetDeadline sets the read and write deadlines of the stream.
+func (st *Stream) SetDeadline(t time.Time) error {
+	st.SetReadDeadline(t)
+	return st.SetWriteDeadline(t)
+}
+
+// SetReadDeadline sets the read deadline of the stream.
+func (st *Stream) SetReadDeadline(t time.Time) error {
+	st.mu.Lock()
+	st.readDeadline = t
+	st.mu.Unlock()
+	signal(st.readable)
+	return nil
+}
+
+// SetWriteDeadline sets the write deadline of the stream.
+func (st *Stream) SetWriteDeadline(t time.Time) error {
+	st.mu.Lock()
+	st.writeDeadline = t
+	st.mu.Unlock()
+	signal(st.writable)
+	return nil
+}
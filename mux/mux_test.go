@@ -0,0 +1,332 @@
+// Copyright (c) 2020 CyberAgent, Inc. All rights reserved.
+// https://github.com/openfresh/gosrt
+
+package mux
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/openfresh/gosrt/srt"
+)
+
+func pipe(t *testing.T) (*Session, *Session) {
+	c1, c2 := net.Pipe()
+	client, server := Client(c1, nil), Server(c2, nil)
+	t.Cleanup(func() {
+		client.Close()
+		server.Close()
+	})
+	return client, server
+}
+
+// echo serves the streams of s by echoing them.
+func echo(s *Session) {
+	for {
+		st, err := s.AcceptStream()
+		if err != nil {
+			return
+		}
+		go func() {
+			io.Copy(st, st)
+			st.Close()
+		}()
+	}
+}
+
+func exchange(t *testing.T, st *Stream, data []byte) {
+	errc := make(chan error, 1)
+	go func() {
+		_, err := st.Write(data)
+		errc <- err
+	}()
+	got := make([]byte, len(data))
+	if _, err := io.ReadFull(st, got); err != nil {
+		t.Error(err)
+		return
+	}
+	if err := <-errc; err != nil {
+		t.Error(err)
+	}
+	if !bytes.Equal(got, data) {
+		t.Errorf("stream %d corrupted", st.ID())
+	}
+}
+
+func TestStreams(t *testing.T) {
+	client, server := pipe(t)
+	go echo(server)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		st, err := client.Open()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if st.ID()%2 != 1 {
+			t.Errorf("client stream ID %d; want odd", st.ID())
+		}
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			defer st.Close()
+			// Several windows, so that flow control comes into play.
+			exchange(t, st, bytes.Repeat([]byte(fmt.Sprintf("stream %d ", i)), 3*Window/9))
+		}(i)
+	}
+	wg.Wait()
+
+	// The server may open streams too.
+	go echo(client)
+	st, err := server.Open()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if st.ID()%2 != 0 {
+		t.Errorf("server stream ID %d; want even", st.ID())
+	}
+	exchange(t, st, []byte("from the server"))
+	st.Close()
+}
+
+func TestFlowControl(t *testing.T) {
+	client, server := pipe(t)
+	slow, err := client.Open()
+	if err != nil {
+		t.Fatal(err)
+	}
+	fast, err := client.Open()
+	if err != nil {
+		t.Fatal(err)
+	}
+	slowPeer, _ := server.AcceptStream()
+	fastPeer, _ := server.AcceptStream()
+
+	// Nothing reads slow: its writer stops at the window.
+	written := make(chan int, 1)
+	go func() {
+		n, _ := slow.Write(make([]byte, 2*Window))
+		written <- n
+	}()
+	time.Sleep(20 * time.Millisecond)
+
+	// Meanwhile, fast still flows.
+	go fastPeer.Write([]byte("fast"))
+	b := make([]byte, 4)
+	fast.SetReadDeadline(time.Now().Add(time.Second))
+	if _, err := io.ReadFull(fast, b); err != nil || string(b) != "fast" {
+		t.Fatalf("got %q, %v", b, err)
+	}
+	select {
+	case n := <-written:
+		t.Fatalf("wrote %d bytes past the window", n)
+	default:
+	}
+
+	if _, err := io.ReadFull(slowPeer, make([]byte, 2*Window)); err != nil {
+		t.Fatal(err)
+	}
+	if n := <-written; n != 2*Window {
+		t.Errorf("wrote %d; want %d", n, 2*Window)
+	}
+}
+
+func TestClose(t *testing.T) {
+	client, server := pipe(t)
+	st, err := client.Open()
+	if err != nil {
+		t.Fatal(err)
+	}
+	peer, err := server.AcceptStream()
+	if err != nil {
+		t.Fatal(err)
+	}
+	st.Write([]byte("last words"))
+	st.Close()
+	b, err := readAll(peer)
+	if err != nil || string(b) != "last words" {
+		t.Errorf("got %q, %v; want the data then EOF", b, err)
+	}
+	if _, err := st.Read(b); err != ErrStreamClosed {
+		t.Errorf("Read after Close = %v; want %v", err, ErrStreamClosed)
+	}
+	if _, err := st.Write(b); err != ErrStreamClosed {
+		t.Errorf("Write after Close = %v; want %v", err, ErrStreamClosed)
+	}
+	peer.Close()
+	for deadline := time.Now().Add(time.Second); client.NumStreams()+server.NumStreams() > 0; time.Sleep(time.Millisecond) {
+		if time.Now().After(deadline) {
+			t.Fatalf("%d and %d streams left open", client.NumStreams(), server.NumStreams())
+		}
+	}
+
+	// Closing the session ends everything.
+	st, _ = client.Open()
+	peer, _ = server.AcceptStream()
+	client.Close()
+	if _, err := st.Read(b); err != ErrSessionClosed {
+		t.Errorf("Read on a closed session = %v; want %v", err, ErrSessionClosed)
+	}
+	if _, err := peer.Read(b); err == nil {
+		t.Error("Read succeeded after the peer closed the session")
+	}
+	if _, err := server.Accept(); err == nil {
+		t.Error("Accept succeeded after the peer closed the session")
+	}
+	if _, err := client.Open(); err != ErrSessionClosed {
+		t.Errorf("Open on a closed session = %v; want %v", err, ErrSessionClosed)
+	}
+}
+
+func TestWriteAfterPeerClose(t *testing.T) {
+	client, server := pipe(t)
+	st, err := client.Open()
+	if err != nil {
+		t.Fatal(err)
+	}
+	st.Write([]byte("hello"))
+	peer, err := server.AcceptStream()
+	if err != nil {
+		t.Fatal(err)
+	}
+	peer.Close()
+
+	// What is written past the close is dropped, but granted back.
+	st.SetWriteDeadline(time.Now().Add(5 * time.Second))
+	if n, err := st.Write(make([]byte, 3*Window)); err != nil || n != 3*Window {
+		t.Fatalf("Write = %d, %v; want %d, nil", n, err, 3*Window)
+	}
+	if _, err := st.Read(make([]byte, 1)); err != io.EOF {
+		t.Errorf("Read = %v; want EOF", err)
+	}
+	st.Close()
+	for deadline := time.Now().Add(time.Second); client.NumStreams()+server.NumStreams() > 0; time.Sleep(time.Millisecond) {
+		if time.Now().After(deadline) {
+			t.Fatalf("%d and %d streams left open", client.NumStreams(), server.NumStreams())
+		}
+	}
+}
+
+func readAll(r io.Reader) ([]byte, error) {
+	var buf bytes.Buffer
+	_, err := io.Copy(&buf, r)
+	return buf.Bytes(), err
+}
+
+func TestCloseWrite(t *testing.T) {
+	client, server := pipe(t)
+	go echo(server)
+	st, err := client.Open()
+	if err != nil {
+		t.Fatal(err)
+	}
+	data := bytes.Repeat([]byte("half"), Window)
+	go func() {
+		st.Write(data)
+		st.CloseWrite()
+	}()
+	// The echo goes on after the peer read io.EOF.
+	b, err := readAll(st)
+	if err != nil || !bytes.Equal(b, data) {
+		t.Fatalf("got %d bytes, %v; want %d then EOF", len(b), err, len(data))
+	}
+	if _, err := st.Write(b); err != ErrStreamClosed {
+		t.Errorf("Write after CloseWrite = %v; want %v", err, ErrStreamClosed)
+	}
+	st.Close()
+	for deadline := time.Now().Add(time.Second); client.NumStreams()+server.NumStreams() > 0; time.Sleep(time.Millisecond) {
+		if time.Now().After(deadline) {
+			t.Fatalf("%d and %d streams left open", client.NumStreams(), server.NumStreams())
+		}
+	}
+}
+
+func TestDeadline(t *testing.T) {
+	client, server := pipe(t)
+	st, _ := client.Open()
+	server.AcceptStream()
+	st.SetReadDeadline(time.Now().Add(10 * time.Millisecond))
+	if _, err := st.Read(make([]byte, 1)); err != os.ErrDeadlineExceeded {
+		t.Errorf("got %v; want %v", err, os.ErrDeadlineExceeded)
+	}
+
+	// Changing the deadline wakes a pending Read up.
+	st.SetReadDeadline(time.Time{})
+	errc := make(chan error, 1)
+	go func() {
+		_, err := st.Read(make([]byte, 1))
+		errc <- err
+	}()
+	time.Sleep(10 * time.Millisecond)
+	st.SetReadDeadline(time.Now())
+	select {
+	case err := <-errc:
+		if nerr, ok := err.(net.Error); !ok || !nerr.Timeout() {
+			t.Errorf("got %v; want a timeout", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Read didn't return")
+	}
+}
+
+func TestBacklog(t *testing.T) {
+	c1, c2 := net.Pipe()
+	client, server := Client(c1, nil), Server(c2, &Config{AcceptBacklog: 1})
+	defer client.Close()
+	defer server.Close()
+	first, _ := client.Open()
+	second, _ := client.Open()
+	second.SetReadDeadline(time.Now().Add(time.Second))
+	if _, err := second.Read(make([]byte, 1)); err != ErrStreamReset {
+		t.Errorf("got %v for a stream past the backlog; want %v", err, ErrStreamReset)
+	}
+	if st, _ := server.AcceptStream(); st.ID() != first.ID() {
+		t.Errorf("accepted stream %d; want %d", st.ID(), first.ID())
+	}
+}
+
+func TestProtocolError(t *testing.T) {
+	c1, c2 := net.Pipe()
+	server := Server(c2, nil)
+	defer server.Close()
+	defer c1.Close()
+	c1.Write([]byte{7, 0, 0, 0, 0, 1, 0, 0, 0, 0})
+	<-server.Done()
+	if _, err := server.Accept(); err != ErrProtocol {
+		t.Errorf("got %v; want %v", err, ErrProtocol)
+	}
+}
+
+func TestSRT(t *testing.T) {
+	ctx := srt.WithOptions(context.Background(), srt.Options("tlpktdrop", "false"))
+	c1, c2, err := srt.PipeContext(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	client, server := Client(c1, nil), Server(c2, nil)
+	defer client.Close()
+	defer server.Close()
+	go echo(server)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 3; i++ {
+		st, err := client.Open()
+		if err != nil {
+			t.Fatal(err)
+		}
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			defer st.Close()
+			exchange(t, st, bytes.Repeat([]byte{byte(i)}, 100<<10))
+		}(i)
+	}
+	wg.Wait()
+}
@@ -0,0 +1,256 @@
+// Copyright (c) 2020 CyberAgent, Inc. All rights reserved.
+// https://github.com/openfresh/gosrt
+
+// Package nat connects SRT peers that are both behind NATs, without a
+// relay. Each peer learns the public mapping of a local UDP port from
+// STUN servers, the peers swap these and their local addresses as
+// candidates through a signaling channel of the application's choice,
+// and then punch through their NATs with SRT rendezvous connections
+// from that same port, trying the candidates in turn.
+//
+// It takes NATs that map a local port to the same public port
+// whatever the destination, as most home and office routers do;
+// symmetric NATs need a relay.
+package nat
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"strconv"
+	"time"
+
+	"github.com/openfresh/gosrt/srt"
+)
+
+// A CandidateType tells where a candidate address comes from.
+type CandidateType int
+
+// Candidate types.
+const (
+	// Host candidates are addresses of the local interfaces, which
+	// peers on the same network reach directly.
+	Host CandidateType = iota
+
+	// ServerReflexive candidates are public mappings learned from
+	// STUN servers.
+	ServerReflexive
+)
+
+func (t CandidateType) String() string {
+	switch t {
+	case Host:
+		return "host"
+	case ServerReflexive:
+		return "srflx"
+	}
+	return "CandidateType(" + strconv.Itoa(int(t)) + ")"
+}
+
+// MarshalText encodes t as its String, for signaling messages.
+func (t CandidateType) MarshalText() ([]byte, error) {
+	switch t {
+	case Host, ServerReflexive:
+		return []byte(t.String()), nil
+	}
+	return nil, fmt.Errorf("nat: unknown candidate type %d", int(t))
+}
+
+// UnmarshalText decodes the String of a candidate type.
+func (t *CandidateType) UnmarshalText(text []byte) error {
+	switch string(text) {
+	case "host":
+		*t = Host
+	case "srflx":
+		*t = ServerReflexive
+	default:
+		return fmt.Errorf("nat: unknown candidate type %q", text)
+	}
+	return nil
+}
+
+// A Candidate is an address a peer may be reached at.
+type Candidate struct {
+	Type CandidateType
+	Addr *net.UDPAddr
+}
+
+func (c Candidate) String() string {
+	return fmt.Sprintf("%v %v", c.Type, c.Addr)
+}
+
+// A Signaler carries candidates between the peers, through whatever
+// channel they share: an HTTP service, a chat room, a file.
+type Signaler interface {
+	// Exchange sends the local candidates to the peer and returns
+	// the peer's.
+	Exchange(ctx context.Context, local []Candidate) ([]Candidate, error)
+}
+
+// A StartSignaler is a Signaler that also agrees with the peer on a
+// time to start connecting at, so that both peers try each pair of
+// candidates at the same time even if one got the other's candidates
+// later. Traversal.Dial waits for it when its Signaler is one.
+type StartSignaler interface {
+	Signaler
+
+	// ExchangeStart is like Exchange, and also returns the start
+	// time, on the local clock.
+	ExchangeStart(ctx context.Context, local []Candidate) ([]Candidate, time.Time, error)
+}
+
+// DefaultTimeout is the Timeout of a Traversal left zero.
+const DefaultTimeout = 3 * time.Second
+
+// ErrNoCandidates is the error of Dial when the peer sent no
+// candidate.
+var ErrNoCandidates = errors.New("nat: no candidates from the peer")
+
+// A Traversal connects to a peer running one too.
+type Traversal struct {
+	// LocalAddr is the local UDP address to connect from. If nil,
+	// or its port is zero, a port is chosen.
+	LocalAddr *net.UDPAddr
+
+	// STUNServers are the STUN servers asked for the public mapping
+	// of the local port, as host or host:port. They should be on
+	// the far side of the NAT; without any, only host candidates
+	// are exchanged.
+	STUNServers []string
+
+	// Signaler exchanges the candidates with the peer.
+	Signaler Signaler
+
+	// Timeout is how long each candidate of the peer is tried for.
+	// Both peers should use the same, so that they try the same
+	// pair of candidates at the same time.
+	Timeout time.Duration
+}
+
+// dialRendezvous makes an SRT rendezvous connection from port to
+// raddr. It is a variable for tests.
+var dialRendezvous = func(ctx context.Context, port int, raddr *net.UDPAddr, timeout time.Duration) (*srt.SRTConn, error) {
+	ctx = srt.WithOptions(ctx, srt.Options("conntimeo", strconv.Itoa(int(timeout/time.Millisecond))))
+	d := srt.Dialer{Timeout: timeout}
+	return d.DialRendezvous(ctx, "srt4", ":"+strconv.Itoa(port), raddr.String())
+}
+
+// Candidates returns the candidates of the local port port: those of
+// the addresses of the up interfaces, then the public mappings the
+// STUN servers report. It asks them through c, which must be bound to
+// port. Unresponsive servers are skipped.
+func (t *Traversal) Candidates(ctx context.Context, c net.PacketConn, port int) []Candidate {
+	cands := hostCandidates(port)
+	for _, server := range t.STUNServers {
+		addr, err := Discover(ctx, c, server)
+		if err != nil {
+			continue
+		}
+		cands = appendCandidate(cands, Candidate{Type: ServerReflexive, Addr: addr})
+	}
+	return cands
+}
+
+// Dial gathers the local candidates, exchanges them with the peer
+// through the Signaler, waits for the start time of a StartSignaler,
+// then connects to the peer's candidates in turn, host ones first,
+// until a connection succeeds. Options set on
+// ctx with srt.WithOptions apply to the connection.
+func (t *Traversal) Dial(ctx context.Context) (*srt.SRTConn, error) {
+	laddr := t.LocalAddr
+	if laddr == nil {
+		laddr = &net.UDPAddr{}
+	}
+	pc, err := net.ListenUDP("udp4", laddr)
+	if err != nil {
+		return nil, err
+	}
+	port := pc.LocalAddr().(*net.UDPAddr).Port
+	local := t.Candidates(ctx, pc, port)
+	// The NATs keep the mappings for a while after the port is
+	// released, long enough for SRT to bind it again.
+	pc.Close()
+
+	remote, start, err := t.exchange(ctx, local)
+	if err != nil {
+		return nil, err
+	}
+	if len(remote) == 0 {
+		return nil, ErrNoCandidates
+	}
+	if d := time.Until(start); d > 0 {
+		timer := time.NewTimer(d)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return nil, ctx.Err()
+		case <-timer.C:
+		}
+	}
+	timeout := t.Timeout
+	if timeout <= 0 {
+		timeout = DefaultTimeout
+	}
+	for _, typ := range []CandidateType{Host, ServerReflexive} {
+		for _, cand := range remote {
+			if cand.Type != typ {
+				continue
+			}
+			c, derr := dialRendezvous(ctx, port, cand.Addr, timeout)
+			if derr == nil {
+				return c, nil
+			}
+			err = fmt.Errorf("nat: %v: %w", cand, derr)
+			if ctx.Err() != nil {
+				return nil, err
+			}
+		}
+	}
+	if err == nil {
+		return nil, ErrNoCandidates
+	}
+	return nil, err
+}
+
+// exchange exchanges the candidates through the Signaler, and returns
+// the start time it agreed on, if it is a StartSignaler.
+func (t *Traversal) exchange(ctx context.Context, local []Candidate) ([]Candidate, time.Time, error) {
+	if s, ok := t.Signaler.(StartSignaler); ok {
+		return s.ExchangeStart(ctx, local)
+	}
+	remote, err := t.Signaler.Exchange(ctx, local)
+	return remote, time.Time{}, err
+}
+
+// hostCandidates returns the candidates of port on the IPv4 addresses
+// of the up interfaces, loopback and link-local ones aside.
+func hostCandidates(port int) []Candidate {
+	addrs, err := net.InterfaceAddrs()
+	if err != nil {
+		return nil
+	}
+	var cands []Candidate
+	for _, a := range addrs {
+		ipnet, ok := a.(*net.IPNet)
+		if !ok {
+			continue
+		}
+		ip := ipnet.IP.To4()
+		if ip == nil || ip.IsLoopback() || ip.IsLinkLocalUnicast() {
+			continue
+		}
+		cands = appendCandidate(cands, Candidate{Type: Host, Addr: &net.UDPAddr{IP: ip, Port: port}})
+	}
+	return cands
+}
+
+// appendCandidate appends c to cands unless it has its address.
+func appendCandidate(cands []Candidate, c Candidate) []Candidate {
+	for _, cc := range cands {
+		if cc.Addr.Port == c.Addr.Port && cc.Addr.IP.Equal(c.Addr.IP) {
+			return cands
+		}
+	}
+	return append(cands, c)
+}
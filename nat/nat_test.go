@@ -0,0 +1,251 @@
+// Copyright (c) 2020 CyberAgent, Inc. All rights reserved.
+// https://github.com/openfresh/gosrt
+
+package nat
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/openfresh/gosrt/srt"
+)
+
+// stunServer answers binding requests on the loopback interface with
+// the address they came from, as reply builds it.
+func stunServer(t *testing.T, reply func(req []byte, from *net.UDPAddr) []byte) string {
+	c, err := net.ListenUDP("udp4", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { c.Close() })
+	go func() {
+		b := make([]byte, 1500)
+		for {
+			n, from, err := c.ReadFromUDP(b)
+			if err != nil {
+				return
+			}
+			if resp := reply(b[:n], from); resp != nil {
+				c.WriteToUDP(resp, from)
+			}
+		}
+	}()
+	return c.LocalAddr().String()
+}
+
+// bindingResponse returns a binding success response to req mapping
+// from, with either attribute.
+func bindingResponse(req []byte, from *net.UDPAddr, xored bool) []byte {
+	attr := make([]byte, 12)
+	port := uint16(from.Port)
+	ip := append([]byte(nil), from.IP.To4()...)
+	binary.BigEndian.PutUint16(attr[0:], stunMappedAddress)
+	if xored {
+		binary.BigEndian.PutUint16(attr[0:], stunXORMappedAddr)
+		port ^= stunMagicCookie >> 16
+		var cookie [4]byte
+		binary.BigEndian.PutUint32(cookie[:], stunMagicCookie)
+		for i := range ip {
+			ip[i] ^= cookie[i]
+		}
+	}
+	binary.BigEndian.PutUint16(attr[2:], 8)
+	attr[5] = 0x01
+	binary.BigEndian.PutUint16(attr[6:], port)
+	copy(attr[8:], ip)
+	resp := make([]byte, stunHeaderSize, stunHeaderSize+len(attr))
+	binary.BigEndian.PutUint16(resp[0:], stunBindingSuccess)
+	binary.BigEndian.PutUint16(resp[2:], uint16(len(attr)))
+	copy(resp[4:20], req[4:20])
+	return append(resp, attr...)
+}
+
+func TestDiscover(t *testing.T) {
+	for _, xored := range []bool{true, false} {
+		drop := 1 // lose the first request
+		server := stunServer(t, func(req []byte, from *net.UDPAddr) []byte {
+			if binary.BigEndian.Uint16(req) != stunBindingRequest {
+				t.Errorf("got message type %#x; want a binding request", binary.BigEndian.Uint16(req))
+			}
+			if drop > 0 {
+				drop--
+				return nil
+			}
+			return bindingResponse(req, from, xored)
+		})
+		c, err := net.ListenUDP("udp4", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer c.Close()
+		addr, err := Discover(context.Background(), c, server)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if addr.String() != c.LocalAddr().String() {
+			t.Errorf("xored %v: got mapping %v; want %v", xored, addr, c.LocalAddr())
+		}
+	}
+}
+
+func TestDiscoverErrors(t *testing.T) {
+	c, err := net.ListenUDP("udp4", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	// Other transactions are ignored; the context bounds the wait.
+	server := stunServer(t, func(req []byte, from *net.UDPAddr) []byte {
+		resp := bindingResponse(req, from, true)
+		resp[19] ^= 0xff
+		return resp
+	})
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	if _, err := Discover(ctx, c, server); err != context.DeadlineExceeded {
+		t.Errorf("got %v for a foreign transaction; want %v", err, context.DeadlineExceeded)
+	}
+
+	server = stunServer(t, func(req []byte, from *net.UDPAddr) []byte {
+		return bindingResponse(req, from, true)[:stunHeaderSize+4]
+	})
+	if _, err := Discover(context.Background(), c, server); err != ErrSTUNResponse {
+		t.Errorf("got %v for a truncated response; want %v", err, ErrSTUNResponse)
+	}
+}
+
+type fakeSignaler struct {
+	local  []Candidate
+	remote []Candidate
+}
+
+func (s *fakeSignaler) Exchange(ctx context.Context, local []Candidate) ([]Candidate, error) {
+	s.local = local
+	return s.remote, nil
+}
+
+func TestTraversalDial(t *testing.T) {
+	server := stunServer(t, func(req []byte, from *net.UDPAddr) []byte {
+		return bindingResponse(req, from, true)
+	})
+	remote := []Candidate{
+		{Type: ServerReflexive, Addr: &net.UDPAddr{IP: net.IPv4(192, 0, 2, 1), Port: 4000}},
+		{Type: Host, Addr: &net.UDPAddr{IP: net.IPv4(10, 0, 0, 2), Port: 4000}},
+		{Type: ServerReflexive, Addr: &net.UDPAddr{IP: net.IPv4(192, 0, 2, 2), Port: 4000}},
+	}
+	var tried []string
+	ports := map[int]bool{}
+	want := &srt.SRTConn{}
+	saved := dialRendezvous
+	defer func() { dialRendezvous = saved }()
+	dialRendezvous = func(ctx context.Context, port int, raddr *net.UDPAddr, timeout time.Duration) (*srt.SRTConn, error) {
+		tried = append(tried, raddr.String())
+		ports[port] = true
+		if timeout != 2*time.Second {
+			t.Errorf("got timeout %v; want 2s", timeout)
+		}
+		if raddr.String() == "192.0.2.2:4000" {
+			return want, nil
+		}
+		return nil, errors.New("connection timeout")
+	}
+
+	sig := &fakeSignaler{remote: remote}
+	tr := &Traversal{
+		LocalAddr:   &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)},
+		STUNServers: []string{server},
+		Signaler:    sig,
+		Timeout:     2 * time.Second,
+	}
+	c, err := tr.Dial(context.Background())
+	if err != nil || c != want {
+		t.Fatalf("Dial = %p, %v; want %p", c, err, want)
+	}
+	if got := len(tried); got != 3 || tried[0] != "10.0.0.2:4000" || tried[1] != "192.0.2.1:4000" {
+		t.Errorf("tried %v; want the host candidate, then the reflexive ones in order", tried)
+	}
+	if len(ports) != 1 {
+		t.Errorf("dialed from ports %v; want one", ports)
+	}
+	var srflx *Candidate
+	for i, cand := range sig.local {
+		if cand.Type == ServerReflexive {
+			srflx = &sig.local[i]
+		}
+	}
+	if srflx == nil || !srflx.Addr.IP.IsLoopback() || !ports[srflx.Addr.Port] {
+		t.Errorf("sent local candidates %v; want the mapping of the dialing port", sig.local)
+	}
+
+	sig.remote = nil
+	if _, err := tr.Dial(context.Background()); err != ErrNoCandidates {
+		t.Errorf("got %v without remote candidates; want %v", err, ErrNoCandidates)
+	}
+	sig.remote = remote[:1]
+	if _, err := tr.Dial(context.Background()); err == nil {
+		t.Error("Dial succeeded with no reachable candidate")
+	}
+}
+
+type fakeStartSignaler struct {
+	fakeSignaler
+	start time.Time
+}
+
+func (s *fakeStartSignaler) ExchangeStart(ctx context.Context, local []Candidate) ([]Candidate, time.Time, error) {
+	remote, err := s.Exchange(ctx, local)
+	return remote, s.start, err
+}
+
+func TestTraversalStart(t *testing.T) {
+	var dialed time.Time
+	saved := dialRendezvous
+	defer func() { dialRendezvous = saved }()
+	dialRendezvous = func(ctx context.Context, port int, raddr *net.UDPAddr, timeout time.Duration) (*srt.SRTConn, error) {
+		dialed = time.Now()
+		return &srt.SRTConn{}, nil
+	}
+
+	start := time.Now().Add(100 * time.Millisecond)
+	sig := &fakeStartSignaler{start: start}
+	sig.remote = []Candidate{{Type: Host, Addr: &net.UDPAddr{IP: net.IPv4(10, 0, 0, 2), Port: 4000}}}
+	tr := &Traversal{LocalAddr: &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)}, Signaler: sig}
+	if _, err := tr.Dial(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if dialed.Before(start) {
+		t.Errorf("dialed %v before the start", start.Sub(dialed))
+	}
+
+	sig.start = time.Now().Add(time.Hour)
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if _, err := tr.Dial(ctx); err != context.DeadlineExceeded {
+		t.Errorf("got %v waiting for a start an hour away; want %v", err, context.DeadlineExceeded)
+	}
+}
+
+func TestCandidateTypeText(t *testing.T) {
+	for _, typ := range []CandidateType{Host, ServerReflexive} {
+		b, err := typ.MarshalText()
+		if err != nil {
+			t.Fatal(err)
+		}
+		var got CandidateType
+		if err := got.UnmarshalText(b); err != nil || got != typ {
+			t.Errorf("%v: got %v, %v", typ, got, err)
+		}
+	}
+	if _, err := CandidateType(7).MarshalText(); err == nil {
+		t.Error("marshaled an unknown type")
+	}
+	var typ CandidateType
+	if err := typ.UnmarshalText([]byte("relay")); err == nil {
+		t.Error("unmarshaled an unknown type")
+	}
+}
@@ -0,0 +1,180 @@
+// Copyright (c) 2020 CyberAgent, Inc. All rights reserved.
+// https://github.com/openfresh/gosrt
+
+package nat
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"net"
+	"time"
+)
+
+// STUN (RFC 5389) message and attribute types, and the magic cookie.
+const (
+	stunBindingRequest  = 0x0001
+	stunBindingSuccess  = 0x0101
+	stunMappedAddress   = 0x0001
+	stunXORMappedAddr   = 0x0020
+	stunMagicCookie     = 0x2112a442
+	stunHeaderSize      = 20
+	stunDefaultPort     = "3478"
+	stunMaxResponseSize = 1500
+)
+
+// stunRetries are the delays between the retransmissions of a binding
+// request, doubling from the initial RTO of RFC 5389, cut short.
+var stunRetries = []time.Duration{500 * time.Millisecond, time.Second, 2 * time.Second, 4 * time.Second}
+
+// Errors of Discover.
+var (
+	ErrSTUNTimeout  = errors.New("nat: no response from STUN server")
+	ErrSTUNResponse = errors.New("nat: malformed STUN response")
+)
+
+// Discover sends a STUN binding request from c to server, as host or
+// host:port with port 3478 by default, and returns the address the
+// server saw it come from: the public mapping of c's port if c is
+// behind a NAT. Datagrams c receives meanwhile that aren't the answer
+// are discarded. Discover retransmits the request as RFC 5389 does,
+// for at most about 7 seconds, or until ctx is done.
+func Discover(ctx context.Context, c net.PacketConn, server string) (*net.UDPAddr, error) {
+	if _, _, err := net.SplitHostPort(server); err != nil {
+		server = net.JoinHostPort(server, stunDefaultPort)
+	}
+	raddr, err := net.ResolveUDPAddr("udp", server)
+	if err != nil {
+		return nil, err
+	}
+	var txid [12]byte
+	if _, err := rand.Read(txid[:]); err != nil {
+		return nil, err
+	}
+	req := make([]byte, stunHeaderSize)
+	binary.BigEndian.PutUint16(req[0:], stunBindingRequest)
+	binary.BigEndian.PutUint32(req[4:], stunMagicCookie)
+	copy(req[8:], txid[:])
+	defer c.SetReadDeadline(time.Time{})
+
+	b := make([]byte, stunMaxResponseSize)
+	for _, rto := range stunRetries {
+		if _, err := c.WriteTo(req, raddr); err != nil {
+			return nil, err
+		}
+		deadline := time.Now().Add(rto)
+		if d, ok := ctx.Deadline(); ok && d.Before(deadline) {
+			deadline = d
+		}
+		c.SetReadDeadline(deadline)
+		for {
+			n, from, err := c.ReadFrom(b)
+			if err != nil {
+				if nerr, ok := err.(net.Error); ok && nerr.Timeout() {
+					break
+				}
+				return nil, err
+			}
+			if !sameAddr(from, raddr) {
+				continue
+			}
+			if addr, err := parseBindingResponse(b[:n], txid); err == nil {
+				return addr, nil
+			} else if err != errNotOurs {
+				return nil, err
+			}
+		}
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+	}
+	return nil, ErrSTUNTimeout
+}
+
+func sameAddr(a net.Addr, b *net.UDPAddr) bool {
+	ua, ok := a.(*net.UDPAddr)
+	return ok && ua.Port == b.Port && ua.IP.Equal(b.IP)
+}
+
+// errNotOurs is the error of parseBindingResponse for a message that
+// isn't a response to the request of txid.
+var errNotOurs = errors.New("not our STUN response")
+
+// parseBindingResponse returns the mapped address of a binding success
+// response to the request of txid.
+func parseBindingResponse(b []byte, txid [12]byte) (*net.UDPAddr, error) {
+	if len(b) < stunHeaderSize || binary.BigEndian.Uint32(b[4:]) != stunMagicCookie || string(b[8:20]) != string(txid[:]) {
+		return nil, errNotOurs
+	}
+	if binary.BigEndian.Uint16(b[0:]) != stunBindingSuccess {
+		return nil, ErrSTUNResponse
+	}
+	length := int(binary.BigEndian.Uint16(b[2:]))
+	if stunHeaderSize+length > len(b) {
+		return nil, ErrSTUNResponse
+	}
+	var mapped *net.UDPAddr
+	for attrs := b[stunHeaderSize : stunHeaderSize+length]; len(attrs) >= 4; {
+		typ := binary.BigEndian.Uint16(attrs[0:])
+		n := int(binary.BigEndian.Uint16(attrs[2:]))
+		if 4+n > len(attrs) {
+			return nil, ErrSTUNResponse
+		}
+		v := attrs[4 : 4+n]
+		switch typ {
+		case stunXORMappedAddr:
+			return parseAddress(v, txid, true)
+		case stunMappedAddress:
+			a, err := parseAddress(v, txid, false)
+			if err != nil {
+				return nil, err
+			}
+			mapped = a
+		}
+		// Attributes are padded to 4 bytes.
+		n = (n + 3) &^ 3
+		if 4+n > len(attrs) {
+			break
+		}
+		attrs = attrs[4+n:]
+	}
+	if mapped == nil {
+		return nil, ErrSTUNResponse
+	}
+	return mapped, nil
+}
+
+// parseAddress parses the value of a MAPPED-ADDRESS or, xored,
+// XOR-MAPPED-ADDRESS attribute.
+func parseAddress(v []byte, txid [12]byte, xored bool) (*net.UDPAddr, error) {
+	if len(v) < 4 {
+		return nil, ErrSTUNResponse
+	}
+	var ip net.IP
+	switch v[1] {
+	case 0x01:
+		if len(v) < 8 {
+			return nil, ErrSTUNResponse
+		}
+		ip = net.IP(append([]byte(nil), v[4:8]...))
+	case 0x02:
+		if len(v) < 20 {
+			return nil, ErrSTUNResponse
+		}
+		ip = net.IP(append([]byte(nil), v[4:20]...))
+	default:
+		return nil, ErrSTUNResponse
+	}
+	port := binary.BigEndian.Uint16(v[2:])
+	if xored {
+		var key [16]byte
+		binary.BigEndian.PutUint32(key[:], stunMagicCookie)
+		copy(key[4:], txid[:])
+		for i := range ip {
+			ip[i] ^= key[i]
+		}
+		port ^= stunMagicCookie >> 16
+	}
+	return &net.UDPAddr{IP: ip, Port: int(port)}, nil
+}
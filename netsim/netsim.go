@@ -0,0 +1,358 @@
+// Copyright (c) 2020 CyberAgent, Inc. All rights reserved.
+// https://github.com/openfresh/gosrt
+
+// Package netsim relays UDP between SRT endpoints over a simulated
+// network path, with loss, delay, jitter, reordering and a bandwidth
+// cap, for integration tests of retransmission, latency and packet
+// filter settings. Losses and delays are drawn from a seeded source,
+// so a test sees the same pattern on every run.
+//
+// The proxy runs on the host's UDP sockets: it doesn't reach
+// connections on the in-memory network of the srtmock build tag.
+package netsim
+
+import (
+	"errors"
+	"math/rand"
+	"net"
+	"sync"
+	"time"
+)
+
+// DefaultMaxQueue is the MaxQueue of an Impairment left zero.
+const DefaultMaxQueue = 200 * time.Millisecond
+
+// reorderTimeout is how long a datagram held back to be reordered
+// waits for a next one to overtake it.
+const reorderTimeout = 50 * time.Millisecond
+
+var errClosed = errors.New("netsim: proxy closed")
+
+// maxDatagram is the size of the datagrams relayed.
+const maxDatagram = 65536
+
+// Impairment describes one direction of the simulated path.
+type Impairment struct {
+	// Loss is the probability of a datagram being dropped.
+	Loss float64
+
+	// Delay is the one-way delay added to every datagram, and Jitter
+	// the largest random delay added on top. Datagrams keep their
+	// order however their delays vary.
+	Delay  time.Duration
+	Jitter time.Duration
+
+	// Reorder is the probability of a datagram being overtaken by
+	// the next one.
+	Reorder float64
+
+	// Bandwidth caps the rate, in bits per second; zero means no cap.
+	// Datagrams that would queue for more than MaxQueue behind the
+	// cap are dropped, as by a router. Zero MaxQueue means
+	// DefaultMaxQueue.
+	Bandwidth int64
+	MaxQueue  time.Duration
+
+	// Seed seeds the random source of the losses, jitter and
+	// reordering.
+	Seed int64
+}
+
+// Stats counts what one direction of a Proxy did with its datagrams.
+type Stats struct {
+	Forwarded int64
+	Lost      int64 // dropped for Loss
+	Overflow  int64 // dropped for exceeding MaxQueue
+	Reordered int64
+}
+
+// A Proxy relays datagrams from the clients reaching its address to a
+// target address, and back, each client over its own socket, so the
+// target sees as many peers as there are clients.
+type Proxy struct {
+	pc     *net.UDPConn
+	target *net.UDPAddr
+	up     *link // from clients to the target
+	down   *link // back to the clients
+
+	mu       sync.Mutex
+	sessions map[string]*net.UDPConn
+	closed   bool
+	wg       sync.WaitGroup
+}
+
+// NewProxy returns a Proxy listening on an ephemeral port of the
+// loopback interface and relaying to target, applying up to what the
+// clients send and down to what comes back.
+func NewProxy(target string, up, down Impairment) (*Proxy, error) {
+	taddr, err := net.ResolveUDPAddr("udp", target)
+	if err != nil {
+		return nil, err
+	}
+	ip := net.IPv4(127, 0, 0, 1)
+	if taddr.IP.To4() == nil && taddr.IP != nil {
+		ip = net.IPv6loopback
+	}
+	pc, err := net.ListenUDP("udp", &net.UDPAddr{IP: ip})
+	if err != nil {
+		return nil, err
+	}
+	p := &Proxy{
+		pc:       pc,
+		target:   taddr,
+		up:       newLink(up),
+		down:     newLink(down),
+		sessions: map[string]*net.UDPConn{},
+	}
+	p.wg.Add(1)
+	go p.serve()
+	return p, nil
+}
+
+// Addr returns the address of the proxy, to dial instead of the
+// target.
+func (p *Proxy) Addr() net.Addr {
+	return p.pc.LocalAddr()
+}
+
+// SetImpairments changes the impairments of both directions, from the
+// next datagram on.
+func (p *Proxy) SetImpairments(up, down Impairment) {
+	p.up.set(up)
+	p.down.set(down)
+}
+
+// Stats returns the counts of both directions.
+func (p *Proxy) Stats() (up, down Stats) {
+	return p.up.stats(), p.down.stats()
+}
+
+// Close stops the proxy, dropping the datagrams in flight.
+func (p *Proxy) Close() error {
+	p.mu.Lock()
+	if p.closed {
+		p.mu.Unlock()
+		return nil
+	}
+	p.closed = true
+	for _, s := range p.sessions {
+		s.Close()
+	}
+	p.mu.Unlock()
+	err := p.pc.Close()
+	p.up.close()
+	p.down.close()
+	p.wg.Wait()
+	return err
+}
+
+func (p *Proxy) serve() {
+	defer p.wg.Done()
+	buf := make([]byte, maxDatagram)
+	for {
+		n, from, err := p.pc.ReadFromUDP(buf)
+		if err != nil {
+			return
+		}
+		s, err := p.session(from)
+		if err != nil {
+			continue
+		}
+		p.up.send(append([]byte(nil), buf[:n]...), func(b []byte) { s.Write(b) })
+	}
+}
+
+// session returns the socket relaying the datagrams of client.
+func (p *Proxy) session(client *net.UDPAddr) (*net.UDPConn, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if s := p.sessions[client.String()]; s != nil {
+		return s, nil
+	}
+	if p.closed {
+		return nil, errClosed
+	}
+	s, err := net.DialUDP("udp", nil, p.target)
+	if err != nil {
+		return nil, err
+	}
+	p.sessions[client.String()] = s
+	p.wg.Add(1)
+	go func() {
+		defer p.wg.Done()
+		buf := make([]byte, maxDatagram)
+		for {
+			n, err := s.Read(buf)
+			if err != nil {
+				if ne, ok := err.(net.Error); ok && ne.Temporary() {
+					// An ICMP error from a target not listening yet.
+					continue
+				}
+				return
+			}
+			p.down.send(append([]byte(nil), buf[:n]...), func(b []byte) { p.pc.WriteToUDP(b, client) })
+		}
+	}()
+	return s, nil
+}
+
+// A link delivers datagrams in one direction, in the order of their
+// departure times.
+type link struct {
+	mu     sync.Mutex
+	imp    Impairment
+	rnd    *rand.Rand
+	free   time.Time // when the bandwidth cap lets the next datagram out
+	last   time.Time // departure of the last datagram
+	held   *datagram // datagram waiting to be overtaken
+	queue  []*datagram
+	st     Stats
+	wake   chan struct{}
+	done   chan struct{}
+	closed bool
+}
+
+type datagram struct {
+	b      []byte
+	out    func([]byte)
+	depart time.Time
+}
+
+func newLink(imp Impairment) *link {
+	l := &link{
+		imp:  imp,
+		rnd:  rand.New(rand.NewSource(imp.Seed)),
+		wake: make(chan struct{}, 1),
+		done: make(chan struct{}),
+	}
+	go l.run()
+	return l
+}
+
+func (l *link) set(imp Impairment) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if imp.Seed != l.imp.Seed {
+		l.rnd = rand.New(rand.NewSource(imp.Seed))
+	}
+	l.imp = imp
+}
+
+func (l *link) stats() Stats {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.st
+}
+
+func (l *link) close() {
+	l.mu.Lock()
+	if !l.closed {
+		l.closed = true
+		close(l.done)
+	}
+	l.mu.Unlock()
+}
+
+// send schedules b to be passed to out.
+func (l *link) send(b []byte, out func([]byte)) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	imp := l.imp
+	if l.rnd.Float64() < imp.Loss {
+		l.st.Lost++
+		return
+	}
+	now := time.Now()
+	depart := now
+	if imp.Bandwidth > 0 {
+		if l.free.After(now) {
+			depart = l.free
+		}
+		maxQueue := imp.MaxQueue
+		if maxQueue <= 0 {
+			maxQueue = DefaultMaxQueue
+		}
+		if depart.Sub(now) > maxQueue {
+			l.st.Overflow++
+			return
+		}
+		depart = depart.Add(time.Duration(int64(len(b)) * 8 * int64(time.Second) / imp.Bandwidth))
+		l.free = depart
+	}
+	depart = depart.Add(imp.Delay)
+	if imp.Jitter > 0 {
+		depart = depart.Add(time.Duration(l.rnd.Int63n(int64(imp.Jitter))))
+	}
+	d := &datagram{b: b, out: out}
+	if l.held == nil && l.rnd.Float64() < imp.Reorder {
+		l.held, d.depart = d, depart
+		time.AfterFunc(depart.Sub(now)+reorderTimeout, func() { l.release(d) })
+		return
+	}
+	l.schedule(d, depart)
+	if h := l.held; h != nil {
+		// The held datagram follows the one overtaking it.
+		l.held = nil
+		l.st.Reordered++
+		l.schedule(h, d.depart)
+	}
+}
+
+// release schedules d if it is still held.
+func (l *link) release(d *datagram) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.held == d {
+		l.held = nil
+		l.schedule(d, d.depart)
+	}
+}
+
+// schedule queues d for depart, or after the last datagram if that is
+// later. l.mu must be held.
+func (l *link) schedule(d *datagram, depart time.Time) {
+	if depart.Before(l.last) {
+		depart = l.last
+	}
+	d.depart, l.last = depart, depart
+	l.queue = append(l.queue, d)
+	select {
+	case l.wake <- struct{}{}:
+	default:
+	}
+}
+
+func (l *link) run() {
+	t := time.NewTimer(time.Hour)
+	defer t.Stop()
+	for {
+		l.mu.Lock()
+		var d *datagram
+		var wait time.Duration = time.Hour
+		if len(l.queue) > 0 {
+			if wait = time.Until(l.queue[0].depart); wait <= 0 {
+				d = l.queue[0]
+				l.queue = l.queue[1:]
+				l.st.Forwarded++
+			}
+		}
+		l.mu.Unlock()
+		if d != nil {
+			d.out(d.b)
+			continue
+		}
+		if !t.Stop() {
+			select {
+			case <-t.C:
+			default:
+			}
+		}
+		t.Reset(wait)
+		select {
+		case <-l.done:
+			return
+		case <-l.wake:
+		case <-t.C:
+		}
+	}
+}
@@ -0,0 +1,155 @@
+// Copyright (c) 2020 CyberAgent, Inc. All rights reserved.
+// https://github.com/openfresh/gosrt
+
+package netsim
+
+import (
+	"encoding/binary"
+	"net"
+	"testing"
+	"time"
+)
+
+// echo returns a UDP socket sending back what it receives.
+func echo(t *testing.T) *net.UDPConn {
+	pc, err := net.ListenUDP("udp4", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	go func() {
+		buf := make([]byte, maxDatagram)
+		for {
+			n, from, err := pc.ReadFromUDP(buf)
+			if err != nil {
+				return
+			}
+			pc.WriteToUDP(buf[:n], from)
+		}
+	}()
+	return pc
+}
+
+// exchange sends n numbered datagrams of size bytes through p, and
+// returns the numbers coming back in order of arrival.
+func exchange(t *testing.T, p *Proxy, n, size int, gap time.Duration) []int {
+	c, err := net.DialUDP("udp4", nil, p.Addr().(*net.UDPAddr))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	b := make([]byte, size)
+	for i := 0; i < n; i++ {
+		binary.BigEndian.PutUint32(b, uint32(i))
+		if _, err := c.Write(b); err != nil {
+			t.Fatal(err)
+		}
+		time.Sleep(gap)
+	}
+	var got []int
+	c.SetReadDeadline(time.Now().Add(300 * time.Millisecond))
+	for {
+		if _, err := c.Read(b); err != nil {
+			return got
+		}
+		got = append(got, int(binary.BigEndian.Uint32(b)))
+	}
+}
+
+func TestProxyLoss(t *testing.T) {
+	target := echo(t)
+	defer target.Close()
+	p, err := NewProxy(target.LocalAddr().String(), Impairment{Loss: 0.2, Seed: 1}, Impairment{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer p.Close()
+	got := exchange(t, p, 200, 100, 0)
+	up, down := p.Stats()
+	if up.Lost < 20 || up.Lost > 60 {
+		t.Errorf("lost %d of 200 datagrams; want about 40", up.Lost)
+	}
+	if int(up.Forwarded) != 200-int(up.Lost) || len(got) != int(up.Forwarded) || down.Forwarded != up.Forwarded {
+		t.Errorf("got %d back, forwarded %+v up and %+v down", len(got), up, down)
+	}
+
+	// The same seed loses the same datagrams.
+	p2, err := NewProxy(target.LocalAddr().String(), Impairment{Loss: 0.2, Seed: 1}, Impairment{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer p2.Close()
+	if got2 := exchange(t, p2, 200, 100, 0); len(got2) != len(got) {
+		t.Errorf("got %d datagrams back; want %d as with the same seed", len(got2), len(got))
+	}
+}
+
+func TestProxyDelay(t *testing.T) {
+	target := echo(t)
+	defer target.Close()
+	imp := Impairment{Delay: 30 * time.Millisecond, Jitter: 10 * time.Millisecond}
+	p, err := NewProxy(target.LocalAddr().String(), imp, imp)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer p.Close()
+	c, err := net.DialUDP("udp4", nil, p.Addr().(*net.UDPAddr))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	start := time.Now()
+	b := []byte("ping")
+	c.Write(b)
+	c.SetReadDeadline(start.Add(time.Second))
+	if _, err := c.Read(b); err != nil {
+		t.Fatal(err)
+	}
+	if rtt := time.Since(start); rtt < 60*time.Millisecond {
+		t.Errorf("got a round trip of %v; want at least 60ms", rtt)
+	}
+	// Jitter keeps datagrams in order.
+	got := exchange(t, p, 50, 100, 0)
+	for i, n := range got {
+		if n != i {
+			t.Fatalf("got %v; want 50 datagrams in order", got)
+		}
+	}
+}
+
+func TestProxyReorder(t *testing.T) {
+	target := echo(t)
+	defer target.Close()
+	p, err := NewProxy(target.LocalAddr().String(), Impairment{Reorder: 0.3, Seed: 2}, Impairment{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer p.Close()
+	got := exchange(t, p, 100, 100, time.Millisecond)
+	swapped := 0
+	for i := 1; i < len(got); i++ {
+		if got[i] < got[i-1] {
+			swapped++
+		}
+	}
+	up, _ := p.Stats()
+	if len(got) != 100 || swapped == 0 || int64(swapped) != up.Reordered {
+		t.Errorf("got %d datagrams, %d out of order; want 100 with %d reordered", len(got), swapped, up.Reordered)
+	}
+}
+
+func TestProxyBandwidth(t *testing.T) {
+	target := echo(t)
+	defer target.Close()
+	// 1000-byte datagrams at 400 kbit/s take 20ms each.
+	imp := Impairment{Bandwidth: 400000, MaxQueue: 100 * time.Millisecond}
+	p, err := NewProxy(target.LocalAddr().String(), imp, Impairment{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer p.Close()
+	got := exchange(t, p, 20, 1000, 0)
+	up, _ := p.Stats()
+	if up.Overflow == 0 || len(got) != int(up.Forwarded) || len(got) > 7 {
+		t.Errorf("got %d datagrams back, %+v; want the queue to overflow past 100ms", len(got), up)
+	}
+}
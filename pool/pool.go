@@ -0,0 +1,339 @@
+// Copyright (c) 2020 CyberAgent, Inc. All rights reserved.
+// https://github.com/openfresh/gosrt
+
+// Package pool keeps warm SRT connections to a server, so that
+// request/response exchanges over file mode connections don't pay for
+// a handshake each.
+package pool
+
+import (
+	"context"
+	"errors"
+	"net"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/openfresh/gosrt/srt"
+	"github.com/openfresh/gosrt/srtapi"
+)
+
+// ErrClosed is the error of Get on a closed Pool, and of the methods of
+// a Conn given back to its Pool.
+var ErrClosed = errors.New("pool: closed")
+
+// DefaultCheckInterval is the CheckInterval of a Pool left zero.
+const DefaultCheckInterval = 10 * time.Second
+
+// Delays between the attempts at dialing a replacement connection,
+// doubling from minRetry to maxRetry.
+const (
+	minRetry = 100 * time.Millisecond
+	maxRetry = 5 * time.Second
+)
+
+// A Pool keeps a number of connections to a server open, and hands
+// them out to goroutines in turn. Connections that fail, on use or on
+// the health checks run while they are idle, are closed and replaced
+// in the background.
+//
+// The fields must be set before the first Get.
+type Pool struct {
+	// Dial, if set, opens the connections. It is given a context that
+	// carries the file mode option, for srt.Dialer.DialContext to
+	// apply; by default, the connections are dialed with a zero
+	// srt.Dialer.
+	Dial func(ctx context.Context, network, address string) (net.Conn, error)
+
+	// Check, if set, is called on each idle connection every
+	// CheckInterval, and the connection is replaced if it returns an
+	// error. The connection is not in use meanwhile, so Check may
+	// exchange a message on it. Without Check, the SRT connections are
+	// only checked to be still connected.
+	Check func(net.Conn) error
+
+	// CheckInterval is the interval between the health checks. Zero
+	// means DefaultCheckInterval.
+	CheckInterval time.Duration
+
+	network, address string
+	size             int
+
+	once   sync.Once
+	idle   chan net.Conn
+	ctx    context.Context
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+
+	mu      sync.Mutex
+	closed  bool
+	dialErr error // of the last failed dial
+}
+
+// New returns a Pool of size connections to address on network, as
+// for srt.Dial.
+func New(network, address string, size int) *Pool {
+	if size < 1 {
+		size = 1
+	}
+	return &Pool{network: network, address: address, size: size}
+}
+
+func (p *Pool) start() {
+	p.idle = make(chan net.Conn, p.size)
+	p.ctx, p.cancel = context.WithCancel(context.Background())
+	for i := 0; i < p.size; i++ {
+		p.replace()
+	}
+	p.wg.Add(1)
+	go p.checkLoop()
+}
+
+// Get returns an idle connection, waiting for one until ctx is done.
+// The first Get opens the connections. If ctx is done while dials are
+// failing, Get returns the error of the last failed dial rather than
+// that of ctx.
+//
+// The caller must give the connection back with Close or Discard.
+func (p *Pool) Get(ctx context.Context) (*Conn, error) {
+	p.once.Do(p.start)
+	select {
+	case c := <-p.idle:
+		return &Conn{Conn: c, p: p}, nil
+	case <-p.ctx.Done():
+		return nil, ErrClosed
+	case <-ctx.Done():
+		p.mu.Lock()
+		err := p.dialErr
+		p.mu.Unlock()
+		if err == nil {
+			err = ctx.Err()
+		}
+		return nil, err
+	}
+}
+
+// Close closes the idle connections and stops the health checks and
+// the dials in progress. Connections in use are closed when they are
+// given back.
+func (p *Pool) Close() error {
+	p.once.Do(p.start)
+	p.mu.Lock()
+	if p.closed {
+		p.mu.Unlock()
+		return ErrClosed
+	}
+	p.closed = true
+	p.mu.Unlock()
+	p.cancel()
+	p.wg.Wait()
+	for {
+		select {
+		case c := <-p.idle:
+			c.Close()
+		default:
+			return nil
+		}
+	}
+}
+
+// put makes c idle again, or closes it if the pool is closed.
+func (p *Pool) put(c net.Conn) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.closed {
+		c.Close()
+		return
+	}
+	// There is room: the pool never has more than size connections.
+	p.idle <- c
+}
+
+// replace dials a connection in the background until one succeeds or
+// the pool is closed, and makes it idle.
+func (p *Pool) replace() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.closed {
+		return
+	}
+	p.wg.Add(1)
+	go func() {
+		defer p.wg.Done()
+		retry := minRetry
+		for {
+			c, err := p.dial()
+			if err == nil {
+				p.mu.Lock()
+				p.dialErr = nil
+				p.mu.Unlock()
+				p.put(c)
+				return
+			}
+			p.mu.Lock()
+			p.dialErr = err
+			p.mu.Unlock()
+			select {
+			case <-p.ctx.Done():
+				return
+			case <-time.After(retry):
+			}
+			if retry *= 2; retry > maxRetry {
+				retry = maxRetry
+			}
+		}
+	}()
+}
+
+func (p *Pool) dial() (net.Conn, error) {
+	ctx := srt.WithOptions(p.ctx, srt.Options("transtype", strconv.Itoa(srtapi.TypeFile)))
+	if p.Dial != nil {
+		return p.Dial(ctx, p.network, p.address)
+	}
+	var d srt.Dialer
+	return d.DialContext(ctx, p.network, p.address)
+}
+
+func (p *Pool) checkLoop() {
+	defer p.wg.Done()
+	interval := p.CheckInterval
+	if interval <= 0 {
+		interval = DefaultCheckInterval
+	}
+	t := time.NewTicker(interval)
+	defer t.Stop()
+	for {
+		select {
+		case <-p.ctx.Done():
+			return
+		case <-t.C:
+		}
+		// Check the connections idle now, each out of the pool while
+		// it is checked.
+		for n := len(p.idle); n > 0; n-- {
+			var c net.Conn
+			select {
+			case c = <-p.idle:
+			default:
+			}
+			if c == nil {
+				break
+			}
+			if err := p.check(c); err != nil {
+				c.Close()
+				p.replace()
+				continue
+			}
+			p.put(c)
+		}
+	}
+}
+
+func (p *Pool) check(c net.Conn) error {
+	if p.Check != nil {
+		return p.Check(c)
+	}
+	return connected(c)
+}
+
+// errNotConnected is the health check error of an SRT connection that
+// is no longer connected.
+var errNotConnected = errors.New("pool: connection not connected")
+
+// connected checks that c is still connected, if it is an SRT
+// connection.
+func connected(c net.Conn) error {
+	rc, ok := c.(interface{ RawConn() (*srt.RawConn, error) })
+	if !ok {
+		return nil
+	}
+	raw, err := rc.RawConn()
+	if err != nil {
+		return err
+	}
+	var state int
+	if cerr := raw.Control(func(s srtapi.SrtSocket) {
+		state, err = srtapi.GetsockflagInt(int(s), srtapi.OptionState)
+	}); cerr != nil {
+		return cerr
+	}
+	if err != nil {
+		return err
+	}
+	if state != srtapi.StatusConnected {
+		return errNotConnected
+	}
+	return nil
+}
+
+// A Conn is a connection out of a Pool. Once a Read or Write on it
+// failed, it goes back to the pool only to be replaced, since a
+// request or response may have been cut short.
+type Conn struct {
+	net.Conn
+	p *Pool
+
+	mu     sync.Mutex
+	failed bool
+	done   bool
+}
+
+func (c *Conn) fail(err error) {
+	if err != nil {
+		c.mu.Lock()
+		c.failed = true
+		c.mu.Unlock()
+	}
+}
+
+// Read reads from the connection, as net.Conn.Read.
+func (c *Conn) Read(b []byte) (int, error) {
+	n, err := c.Conn.Read(b)
+	c.fail(err)
+	return n, err
+}
+
+// Write writes to the connection, as net.Conn.Write.
+func (c *Conn) Write(b []byte) (int, error) {
+	n, err := c.Conn.Write(b)
+	c.fail(err)
+	return n, err
+}
+
+// Close gives the connection back to its Pool, clearing its deadlines,
+// unless a Read or Write on it failed, in which case it is closed and
+// replaced.
+func (c *Conn) Close() error {
+	c.mu.Lock()
+	if c.done {
+		c.mu.Unlock()
+		return ErrClosed
+	}
+	c.done = true
+	failed := c.failed
+	c.mu.Unlock()
+	if failed || c.Conn.SetDeadline(time.Time{}) != nil {
+		return c.discard()
+	}
+	c.p.put(c.Conn)
+	return nil
+}
+
+// Discard closes the connection and has its Pool replace it, for when
+// the exchange on it was abandoned halfway.
+func (c *Conn) Discard() error {
+	c.mu.Lock()
+	if c.done {
+		c.mu.Unlock()
+		return ErrClosed
+	}
+	c.done = true
+	c.mu.Unlock()
+	return c.discard()
+}
+
+func (c *Conn) discard() error {
+	err := c.Conn.Close()
+	c.p.replace()
+	return err
+}
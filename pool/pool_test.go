@@ -0,0 +1,229 @@
+// Copyright (c) 2020 CyberAgent, Inc. All rights reserved.
+// https://github.com/openfresh/gosrt
+
+package pool
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/openfresh/gosrt/srt"
+)
+
+// server dials in-memory connections to an echo server, and keeps
+// them to be broken by the tests.
+type server struct {
+	mu    sync.Mutex
+	conns []net.Conn // server ends, in dial order
+	fail  error
+}
+
+func (s *server) dial(ctx context.Context, network, address string) (net.Conn, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.fail != nil {
+		return nil, s.fail
+	}
+	c1, c2 := net.Pipe()
+	s.conns = append(s.conns, c2)
+	go io.Copy(c2, c2)
+	return c1, nil
+}
+
+func (s *server) dials() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.conns)
+}
+
+// waitDials waits for the pool to have dialed n connections.
+func (s *server) waitDials(t *testing.T, n int) {
+	t.Helper()
+	for deadline := time.Now().Add(time.Second); s.dials() < n; time.Sleep(time.Millisecond) {
+		if time.Now().After(deadline) {
+			t.Fatalf("%d dials; want %d", s.dials(), n)
+		}
+	}
+}
+
+func echo(t *testing.T, c *Conn, msg string) {
+	t.Helper()
+	if _, err := c.Write([]byte(msg)); err != nil {
+		t.Fatal(err)
+	}
+	b := make([]byte, len(msg))
+	if _, err := io.ReadFull(c, b); err != nil || string(b) != msg {
+		t.Fatalf("got %q, %v; want %q", b, err, msg)
+	}
+}
+
+func TestPool(t *testing.T) {
+	s := &server{}
+	p := New("srt", "server:5000", 2)
+	p.Dial = s.dial
+	defer p.Close()
+
+	ctx := context.Background()
+	c1, err := p.Get(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c2, err := p.Get(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	echo(t, c1, "request 1")
+	echo(t, c2, "request 2")
+
+	// All in use.
+	tctx, cancel := context.WithTimeout(ctx, 20*time.Millisecond)
+	defer cancel()
+	if _, err := p.Get(tctx); err != context.DeadlineExceeded {
+		t.Errorf("got %v with all connections in use; want %v", err, context.DeadlineExceeded)
+	}
+
+	// A connection given back is reused.
+	under := c1.Conn
+	c1.SetReadDeadline(time.Now().Add(time.Hour))
+	if err := c1.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := c1.Close(); err != ErrClosed {
+		t.Errorf("second Close = %v; want %v", err, ErrClosed)
+	}
+	c3, err := p.Get(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c3.Conn != under {
+		t.Error("Get didn't reuse the idle connection")
+	}
+	echo(t, c3, "request 3")
+	if n := s.dials(); n != 2 {
+		t.Errorf("%d dials; want 2", n)
+	}
+
+	// A connection that failed is replaced.
+	s.mu.Lock()
+	s.conns[1].Close()
+	s.mu.Unlock()
+	if _, err := c2.Write([]byte("lost")); err == nil {
+		t.Fatal("Write succeeded on a closed connection")
+	}
+	c2.Close()
+	s.waitDials(t, 3)
+	c4, err := p.Get(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	echo(t, c4, "request 4")
+
+	// So is a discarded one.
+	c4.Discard()
+	s.waitDials(t, 4)
+	c3.Close()
+}
+
+func TestPoolCheck(t *testing.T) {
+	s := &server{}
+	p := New("srt", "server:5000", 2)
+	p.Dial = s.dial
+	p.CheckInterval = 5 * time.Millisecond
+	var mu sync.Mutex
+	bad := map[net.Conn]bool{}
+	p.Check = func(c net.Conn) error {
+		mu.Lock()
+		defer mu.Unlock()
+		if bad[c] {
+			return errors.New("unhealthy")
+		}
+		return nil
+	}
+	defer p.Close()
+
+	c, err := p.Get(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	mu.Lock()
+	bad[c.Conn] = true
+	mu.Unlock()
+	c.Close()
+	s.waitDials(t, 3)
+	for i := 0; i < 2; i++ {
+		c, err := p.Get(context.Background())
+		if err != nil {
+			t.Fatal(err)
+		}
+		mu.Lock()
+		if bad[c.Conn] {
+			t.Error("Get returned a connection that failed its check")
+		}
+		mu.Unlock()
+		defer c.Close()
+	}
+}
+
+func TestPoolDialError(t *testing.T) {
+	dialErr := errors.New("connection refused")
+	s := &server{fail: dialErr}
+	p := New("srt", "server:5000", 1)
+	p.Dial = s.dial
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if _, err := p.Get(ctx); err != dialErr {
+		t.Errorf("got %v; want the dial error", err)
+	}
+
+	// The dials are retried.
+	s.mu.Lock()
+	s.fail = nil
+	s.mu.Unlock()
+	c, err := p.Get(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := p.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := p.Get(context.Background()); err != ErrClosed {
+		t.Errorf("Get on a closed pool = %v; want %v", err, ErrClosed)
+	}
+	// Connections in use are closed when given back.
+	c.Close()
+	if _, err := c.Conn.Write([]byte("x")); err != io.ErrClosedPipe {
+		t.Errorf("Write after giving back to a closed pool = %v; want %v", err, io.ErrClosedPipe)
+	}
+	if err := p.Close(); err != ErrClosed {
+		t.Errorf("second Close = %v; want %v", err, ErrClosed)
+	}
+}
+
+func TestConnected(t *testing.T) {
+	c1, c2, err := srt.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c1.Close()
+	if err := connected(c1); err != nil {
+		t.Fatalf("connected = %v on a live connection", err)
+	}
+	c2.Close()
+	deadline := time.Now().Add(5 * time.Second)
+	for connected(c1) == nil {
+		if time.Now().After(deadline) {
+			t.Fatal("connection still connected after the peer closed")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if err := connected(c1); err != errNotConnected {
+		t.Errorf("got %v; want %v", err, errNotConnected)
+	}
+}
@@ -0,0 +1,379 @@
+// Copyright (c) 2020 CyberAgent, Inc. All rights reserved.
+// https://github.com/openfresh/gosrt
+
+// Package proxyproto carries the addresses of the original client of a
+// connection through relays, in the header of the HAProxy PROXY
+// protocol the relay sends as the first payload of its upstream stream
+// mode connection. Relays write it with WriteHeader; servers wrap their
+// listeners with NewListener, whose connections report the original
+// client as their RemoteAddr.
+//
+// Both versions of the protocol are read. Version 2 is written by
+// default, since only it has a datagram transport, which SRT addresses
+// map to; version 1 only knows TCP.
+package proxyproto
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/openfresh/gosrt/srt"
+)
+
+// Errors of reading headers.
+var (
+	ErrNoHeader = errors.New("proxyproto: no PROXY protocol header")
+	ErrHeader   = errors.New("proxyproto: malformed PROXY protocol header")
+)
+
+// A Command tells what a header is about.
+type Command int
+
+// Commands.
+const (
+	// Proxy headers carry the addresses of the original connection.
+	Proxy Command = iota
+
+	// Local headers come from connections the relay made on its own,
+	// such as health checks; the connection addresses are the real
+	// ones.
+	Local
+)
+
+// A Header is a PROXY protocol header.
+type Header struct {
+	// Version is the protocol version, 1 or 2. WriteHeader writes
+	// version 2 if it is 0.
+	Version int
+
+	Command Command
+
+	// Source and Destination are the addresses of the original
+	// client and of the server it connected to, of the same family.
+	// They are *srt.SRTAddr for datagram transports, and
+	// *net.TCPAddr for stream ones; both are nil in Local headers,
+	// and in Proxy ones of unknown family.
+	Source, Destination net.Addr
+}
+
+// HeaderFor returns the header relaying c, from its remote and local
+// addresses.
+func HeaderFor(c net.Conn) *Header {
+	return &Header{Command: Proxy, Source: c.RemoteAddr(), Destination: c.LocalAddr()}
+}
+
+// The starts of the headers of both versions, and their lengths.
+var (
+	v1Prefix    = []byte("PROXY ")
+	v2Signature = []byte("\r\n\r\n\x00\r\nQUIT\n")
+)
+
+const (
+	v2HeaderLen = 16
+	v1MaxLen    = 107
+)
+
+// Version 2 address families and transports.
+const (
+	famUnspec = 0x0
+	famInet   = 0x1
+	famInet6  = 0x2
+
+	protoStream = 0x1
+	protoDgram  = 0x2
+)
+
+// hostPort returns the IP and port of a, whether it is a datagram
+// address, and whether it is an IP address at all.
+func hostPort(a net.Addr) (net.IP, int, bool, bool) {
+	switch a := a.(type) {
+	case *srt.SRTAddr:
+		return a.IP, a.Port, true, true
+	case *net.UDPAddr:
+		return a.IP, a.Port, true, true
+	case *net.TCPAddr:
+		return a.IP, a.Port, false, true
+	}
+	return nil, 0, false, false
+}
+
+// WriteHeader writes h to w, in a single Write.
+func WriteHeader(w io.Writer, h *Header) error {
+	b, err := h.marshal()
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(b)
+	return err
+}
+
+func (h *Header) marshal() ([]byte, error) {
+	srcIP, srcPort, dgram, ok := hostPort(h.Source)
+	dstIP, dstPort, _, dok := hostPort(h.Destination)
+	known := h.Command == Proxy && ok && dok && (srcIP.To4() == nil) == (dstIP.To4() == nil)
+	switch h.Version {
+	case 1:
+		if h.Command == Local || !known {
+			return []byte("PROXY UNKNOWN\r\n"), nil
+		}
+		proto := "TCP4"
+		if srcIP.To4() == nil {
+			proto = "TCP6"
+		}
+		return []byte(fmt.Sprintf("PROXY %s %s %s %d %d\r\n", proto, srcIP, dstIP, srcPort, dstPort)), nil
+	case 0, 2:
+	default:
+		return nil, fmt.Errorf("proxyproto: unknown version %d", h.Version)
+	}
+	b := append([]byte(nil), v2Signature...)
+	if h.Command == Local {
+		return append(b, 0x20, famUnspec, 0, 0), nil
+	}
+	b = append(b, 0x21)
+	if !known {
+		return append(b, famUnspec, 0, 0), nil
+	}
+	proto := byte(protoStream)
+	if dgram {
+		proto = protoDgram
+	}
+	var addrs []byte
+	if ip4 := srcIP.To4(); ip4 != nil {
+		b = append(b, famInet<<4|proto)
+		addrs = append(append(addrs, ip4...), dstIP.To4()...)
+	} else {
+		b = append(b, famInet6<<4|proto)
+		addrs = append(append(addrs, srcIP.To16()...), dstIP.To16()...)
+	}
+	addrs = append(addrs, byte(srcPort>>8), byte(srcPort), byte(dstPort>>8), byte(dstPort))
+	b = append(b, byte(len(addrs)>>8), byte(len(addrs)))
+	return append(b, addrs...), nil
+}
+
+// ReadHeader reads a header from r. It returns ErrNoHeader, having
+// consumed nothing, if r doesn't start with one; it tells so from the
+// first byte that doesn't match, so as not to wait for more data from
+// clients that sent none.
+func ReadHeader(r *bufio.Reader) (*Header, error) {
+	for n := 1; ; n++ {
+		b, err := r.Peek(n)
+		if err != nil {
+			if n > 1 {
+				err = eof(err)
+			}
+			return nil, err
+		}
+		switch {
+		case bytes.HasPrefix(v2Signature, b):
+			if n == len(v2Signature) {
+				return readV2(r)
+			}
+		case bytes.HasPrefix(v1Prefix, b):
+			if n == len(v1Prefix) {
+				return readV1(r)
+			}
+		default:
+			return nil, ErrNoHeader
+		}
+	}
+}
+
+func readV1(r *bufio.Reader) (*Header, error) {
+	var line []byte
+	for len(line) < v1MaxLen {
+		c, err := r.ReadByte()
+		if err != nil {
+			return nil, eof(err)
+		}
+		line = append(line, c)
+		if c == '\n' {
+			break
+		}
+	}
+	if !bytes.HasSuffix(line, []byte("\r\n")) {
+		return nil, ErrHeader
+	}
+	f := strings.Split(string(line[:len(line)-2]), " ")
+	h := &Header{Version: 1, Command: Proxy}
+	if len(f) >= 2 && f[1] == "UNKNOWN" {
+		return h, nil
+	}
+	if len(f) != 6 || f[1] != "TCP4" && f[1] != "TCP6" {
+		return nil, ErrHeader
+	}
+	src, dst := net.ParseIP(f[2]), net.ParseIP(f[3])
+	sport, err1 := strconv.ParseUint(f[4], 10, 16)
+	dport, err2 := strconv.ParseUint(f[5], 10, 16)
+	if src == nil || dst == nil || err1 != nil || err2 != nil || (src.To4() != nil) != (f[1] == "TCP4") || (dst.To4() != nil) != (f[1] == "TCP4") {
+		return nil, ErrHeader
+	}
+	if f[1] == "TCP4" {
+		src, dst = src.To4(), dst.To4()
+	}
+	h.Source = &net.TCPAddr{IP: src, Port: int(sport)}
+	h.Destination = &net.TCPAddr{IP: dst, Port: int(dport)}
+	return h, nil
+}
+
+func readV2(r *bufio.Reader) (*Header, error) {
+	var hdr [v2HeaderLen]byte
+	if _, err := io.ReadFull(r, hdr[:]); err != nil {
+		return nil, eof(err)
+	}
+	if hdr[12]>>4 != 2 {
+		return nil, ErrHeader
+	}
+	body := make([]byte, binary.BigEndian.Uint16(hdr[14:]))
+	if _, err := io.ReadFull(r, body); err != nil {
+		return nil, eof(err)
+	}
+	h := &Header{Version: 2}
+	switch hdr[12] & 0xf {
+	case 0:
+		h.Command = Local
+		return h, nil
+	case 1:
+		h.Command = Proxy
+	default:
+		return nil, ErrHeader
+	}
+	var n int
+	switch hdr[13] >> 4 {
+	case famInet:
+		n = net.IPv4len
+	case famInet6:
+		n = net.IPv6len
+	default:
+		// Unspecified and Unix addresses are of no use over SRT.
+		return h, nil
+	}
+	if len(body) < 2*n+4 {
+		return nil, ErrHeader
+	}
+	src := net.IP(append([]byte(nil), body[:n]...))
+	dst := net.IP(append([]byte(nil), body[n:2*n]...))
+	sport := int(binary.BigEndian.Uint16(body[2*n:]))
+	dport := int(binary.BigEndian.Uint16(body[2*n+2:]))
+	switch hdr[13] & 0xf {
+	case protoDgram:
+		h.Source = &srt.SRTAddr{IP: src, Port: sport}
+		h.Destination = &srt.SRTAddr{IP: dst, Port: dport}
+	case protoStream:
+		h.Source = &net.TCPAddr{IP: src, Port: sport}
+		h.Destination = &net.TCPAddr{IP: dst, Port: dport}
+	}
+	return h, nil
+}
+
+func eof(err error) error {
+	if err == io.EOF {
+		return io.ErrUnexpectedEOF
+	}
+	return err
+}
+
+// DefaultReadHeaderTimeout is the ReadHeaderTimeout of a Listener left
+// zero.
+const DefaultReadHeaderTimeout = 10 * time.Second
+
+// A Listener reads the PROXY protocol header of the connections it
+// accepts.
+type Listener struct {
+	net.Listener
+
+	// Optional, if set, accepts connections without a header, as
+	// they come.
+	Optional bool
+
+	// ReadHeaderTimeout bounds the wait for the header. Zero means
+	// DefaultReadHeaderTimeout.
+	ReadHeaderTimeout time.Duration
+}
+
+// NewListener returns ln reading the headers of its connections.
+func NewListener(ln net.Listener) *Listener {
+	return &Listener{Listener: ln}
+}
+
+// Accept returns the next connection, whose header is read on its
+// first Read, RemoteAddr, LocalAddr or Header call, not to hold
+// back other connections.
+func (l *Listener) Accept() (net.Conn, error) {
+	c, err := l.Listener.Accept()
+	if err != nil {
+		return nil, err
+	}
+	timeout := l.ReadHeaderTimeout
+	if timeout <= 0 {
+		timeout = DefaultReadHeaderTimeout
+	}
+	return &Conn{Conn: c, r: bufio.NewReader(c), optional: l.Optional, timeout: timeout}, nil
+}
+
+// A Conn is a connection accepted by a Listener.
+type Conn struct {
+	net.Conn
+	r        *bufio.Reader
+	optional bool
+	timeout  time.Duration
+
+	once   sync.Once
+	header *Header
+	err    error
+}
+
+func (c *Conn) readHeader() {
+	c.once.Do(func() {
+		c.Conn.SetReadDeadline(time.Now().Add(c.timeout))
+		c.header, c.err = ReadHeader(c.r)
+		c.Conn.SetReadDeadline(time.Time{})
+		if c.err == ErrNoHeader && c.optional {
+			c.err = nil
+		}
+	})
+}
+
+// Header returns the header of the connection, nil if it had none.
+func (c *Conn) Header() (*Header, error) {
+	c.readHeader()
+	return c.header, c.err
+}
+
+// Read reads the data following the header. It fails with the error
+// reading the header, if that failed.
+func (c *Conn) Read(b []byte) (int, error) {
+	c.readHeader()
+	if c.err != nil {
+		return 0, c.err
+	}
+	return c.r.Read(b)
+}
+
+// RemoteAddr returns the address of the original client, if the header
+// has one, or else of the peer.
+func (c *Conn) RemoteAddr() net.Addr {
+	c.readHeader()
+	if c.header != nil && c.header.Command == Proxy && c.header.Source != nil {
+		return c.header.Source
+	}
+	return c.Conn.RemoteAddr()
+}
+
+// LocalAddr returns the address the original client connected to, if
+// the header has one, or else the local address.
+func (c *Conn) LocalAddr() net.Addr {
+	c.readHeader()
+	if c.header != nil && c.header.Command == Proxy && c.header.Destination != nil {
+		return c.header.Destination
+	}
+	return c.Conn.LocalAddr()
+}
@@ -0,0 +1,184 @@
+// Copyright (c) 2020 CyberAgent, Inc. All rights reserved.
+// https://github.com/openfresh/gosrt
+
+package proxyproto
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"io/ioutil"
+	"net"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/openfresh/gosrt/srt"
+)
+
+func TestHeaderRoundTrip(t *testing.T) {
+	tcp4 := func(s string, port int) net.Addr { return &net.TCPAddr{IP: net.ParseIP(s).To4(), Port: port} }
+	tcp6 := func(s string, port int) net.Addr { return &net.TCPAddr{IP: net.ParseIP(s), Port: port} }
+	srt4 := func(s string, port int) net.Addr { return &srt.SRTAddr{IP: net.ParseIP(s).To4(), Port: port} }
+	srt6 := func(s string, port int) net.Addr { return &srt.SRTAddr{IP: net.ParseIP(s), Port: port} }
+	tests := []struct {
+		in   Header
+		wire string // a prefix of it
+	}{
+		{Header{Version: 1, Source: tcp4("192.0.2.1", 4000), Destination: tcp4("198.51.100.1", 443)}, "PROXY TCP4 192.0.2.1 198.51.100.1 4000 443\r\n"},
+		{Header{Version: 1, Source: tcp6("2001:db8::1", 4000), Destination: tcp6("2001:db8::2", 443)}, "PROXY TCP6 2001:db8::1 2001:db8::2 4000 443\r\n"},
+		{Header{Version: 1}, "PROXY UNKNOWN\r\n"},
+		{Header{Version: 2, Source: tcp4("192.0.2.1", 4000), Destination: tcp4("198.51.100.1", 443)}, "\r\n\r\n\x00\r\nQUIT\n\x21\x11\x00\x0c"},
+		{Header{Version: 2, Source: srt4("192.0.2.1", 4000), Destination: srt4("198.51.100.1", 5000)}, "\r\n\r\n\x00\r\nQUIT\n\x21\x12\x00\x0c"},
+		{Header{Version: 2, Source: srt6("2001:db8::1", 4000), Destination: srt6("2001:db8::2", 5000)}, "\r\n\r\n\x00\r\nQUIT\n\x21\x22\x00\x24"},
+		{Header{Version: 2, Command: Local}, "\r\n\r\n\x00\r\nQUIT\n\x20\x00\x00\x00"},
+		{Header{Version: 2}, "\r\n\r\n\x00\r\nQUIT\n\x21\x00\x00\x00"},
+	}
+	for _, tt := range tests {
+		var buf bytes.Buffer
+		if err := WriteHeader(&buf, &tt.in); err != nil {
+			t.Fatal(err)
+		}
+		if !strings.HasPrefix(buf.String(), tt.wire) {
+			t.Errorf("%+v: wrote %q; want %q", tt.in, buf.Bytes(), tt.wire)
+		}
+		buf.WriteString("payload")
+		r := bufio.NewReader(&buf)
+		h, err := ReadHeader(r)
+		if err != nil {
+			t.Fatalf("%+v: %v", tt.in, err)
+		}
+		if !reflect.DeepEqual(*h, tt.in) {
+			t.Errorf("read %+v; want %+v", *h, tt.in)
+		}
+		if rest, _ := ioutil.ReadAll(r); string(rest) != "payload" {
+			t.Errorf("%+v: left %q; want the payload", tt.in, rest)
+		}
+	}
+
+	// Version 0 writes version 2.
+	var buf bytes.Buffer
+	WriteHeader(&buf, &Header{Source: srt4("192.0.2.1", 1), Destination: srt4("192.0.2.2", 2)})
+	if h, err := ReadHeader(bufio.NewReader(&buf)); err != nil || h.Version != 2 {
+		t.Errorf("got %+v, %v; want version 2", h, err)
+	}
+}
+
+func TestReadHeaderErrors(t *testing.T) {
+	tests := []struct {
+		in  string
+		err error
+	}{
+		{"GET / HTTP/1.1\r\n", ErrNoHeader},
+		{"PRO", io.ErrUnexpectedEOF},
+		{"PROXY TCP4 192.0.2.1\r\n", ErrHeader},
+		{"PROXY TCP4 2001:db8::1 192.0.2.1 1 2\r\n", ErrHeader},
+		{"PROXY TCP4 192.0.2.1 192.0.2.2 1 70000\r\n", ErrHeader},
+		{"PROXY " + strings.Repeat("x", 200), ErrHeader},
+		{"\r\n\r\n\x00\r\nQUIT\n\x31\x11\x00\x00", ErrHeader},
+		{"\r\n\r\n\x00\r\nQUIT\n\x21\x11\x00\x04\x01\x02\x03\x04", ErrHeader},
+		{"\r\n\r\n\x00\r\nQUIT\n\x21\x11\x00\x0c\x01", io.ErrUnexpectedEOF},
+		{"", io.EOF},
+	}
+	for _, tt := range tests {
+		r := bufio.NewReader(strings.NewReader(tt.in))
+		if _, err := ReadHeader(r); err != tt.err {
+			t.Errorf("%q: got %v; want %v", tt.in, err, tt.err)
+		}
+		if tt.err == ErrNoHeader {
+			if rest, _ := ioutil.ReadAll(r); string(rest) != tt.in {
+				t.Errorf("%q: consumed %q", tt.in, tt.in[:len(tt.in)-len(rest)])
+			}
+		}
+	}
+}
+
+func TestListener(t *testing.T) {
+	inner, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ln := NewListener(inner)
+	ln.Optional = true
+	ln.ReadHeaderTimeout = time.Second
+	defer ln.Close()
+
+	client := &srt.SRTAddr{IP: net.IPv4(192, 0, 2, 1).To4(), Port: 4000}
+	dest := &srt.SRTAddr{IP: net.IPv4(198, 51, 100, 1).To4(), Port: 5000}
+	go func() {
+		c, err := net.Dial("tcp", inner.Addr().String())
+		if err != nil {
+			return
+		}
+		defer c.Close()
+		// A header split anywhere, as stream mode may deliver it.
+		var buf bytes.Buffer
+		WriteHeader(&buf, &Header{Source: client, Destination: dest})
+		buf.WriteString("hello")
+		for _, b := range buf.Bytes() {
+			c.Write([]byte{b})
+		}
+		io.Copy(ioutil.Discard, c)
+	}()
+	c, err := ln.Accept()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	if got := c.RemoteAddr(); got.String() != client.String() || got.Network() != "srt" {
+		t.Errorf("RemoteAddr = %v %v; want %v", got.Network(), got, client)
+	}
+	if got := c.LocalAddr(); got.String() != dest.String() {
+		t.Errorf("LocalAddr = %v; want %v", got, dest)
+	}
+	b := make([]byte, 5)
+	if _, err := io.ReadFull(c, b); err != nil || string(b) != "hello" {
+		t.Errorf("got %q, %v; want the payload", b, err)
+	}
+
+	// Without a header, optional ones pass through.
+	go func() {
+		c, err := net.Dial("tcp", inner.Addr().String())
+		if err != nil {
+			return
+		}
+		defer c.Close()
+		c.Write([]byte("hello"))
+		io.Copy(ioutil.Discard, c)
+	}()
+	c2, err := ln.Accept()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c2.Close()
+	if h, err := c2.(*Conn).Header(); h != nil || err != nil {
+		t.Errorf("Header = %v, %v; want none", h, err)
+	}
+	if _, err := io.ReadFull(c2, b); err != nil || string(b) != "hello" {
+		t.Errorf("got %q, %v; want the payload", b, err)
+	}
+	if c2.RemoteAddr().Network() != "tcp" {
+		t.Errorf("RemoteAddr = %v; want the peer", c2.RemoteAddr())
+	}
+
+	// Required ones fail the reads.
+	ln.Optional = false
+	go func() {
+		c, err := net.Dial("tcp", inner.Addr().String())
+		if err != nil {
+			return
+		}
+		defer c.Close()
+		c.Write([]byte("hello"))
+		io.Copy(ioutil.Discard, c)
+	}()
+	c3, err := ln.Accept()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c3.Close()
+	if _, err := c3.Read(b); err != ErrNoHeader {
+		t.Errorf("got %v; want %v", err, ErrNoHeader)
+	}
+}
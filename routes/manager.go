@@ -0,0 +1,184 @@
+// Copyright (c) 2020 CyberAgent, Inc. All rights reserved.
+// https://github.com/openfresh/gosrt
+
+package routes
+
+import (
+	"context"
+	"errors"
+	"os"
+	"os/signal"
+	"reflect"
+	"sort"
+	"sync"
+	"syscall"
+)
+
+// ErrManagerClosed is the error of Apply and Reload after Close.
+var ErrManagerClosed = errors.New("routes: manager closed")
+
+// A Manager runs the routes of a configuration, and applies new
+// configurations to them as they come: routes that didn't change keep
+// running, with their sessions, routes that were removed are stopped,
+// and new ones are started. A route that changed is stopped, and its
+// new version started once the old one returned, so that it can listen
+// on the same address, as is a route added back while the instance
+// removed before drains.
+type Manager struct {
+	// Run runs r until ctx is done, and then drains it: it should
+	// close its listener and stop taking sessions at once, and may
+	// let the sessions it has end before it returns.
+	Run func(ctx context.Context, r Route) error
+
+	// OnExit, if set, is called with the error of Run when a route
+	// returns, nil if it was stopped.
+	OnExit func(r Route, err error)
+
+	mu      sync.Mutex
+	running map[string]*running
+	stopped map[string]*running // removed, and maybe draining still
+	wg      sync.WaitGroup
+	closed  bool
+}
+
+// A running route.
+type running struct {
+	route  Route
+	cancel context.CancelFunc
+	done   chan struct{} // closed once it, and those it followed, returned
+}
+
+// Apply has the routes of c run, in place of those of the previous
+// configuration. It returns once the changes are under way, without
+// waiting for the routes stopped to drain.
+func (m *Manager) Apply(c *Config) error {
+	if errs := c.Validate(); errs != nil {
+		return errs
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.closed {
+		return ErrManagerClosed
+	}
+	for name, s := range m.stopped {
+		select {
+		case <-s.done:
+			delete(m.stopped, name)
+		default:
+		}
+	}
+	next := make(map[string]*running, len(c.Routes))
+	for _, r := range c.Routes {
+		old := m.running[r.Name]
+		if old != nil && reflect.DeepEqual(old.route, r) {
+			next[r.Name] = old
+			continue
+		}
+		var prev <-chan struct{}
+		if old != nil {
+			old.cancel()
+			prev = old.done
+		} else if s := m.stopped[r.Name]; s != nil {
+			prev = s.done
+		}
+		delete(m.stopped, r.Name)
+		next[r.Name] = m.start(r, prev)
+	}
+	for name, old := range m.running {
+		if _, ok := next[name]; !ok {
+			old.cancel()
+			if m.stopped == nil {
+				m.stopped = make(map[string]*running)
+			}
+			m.stopped[name] = old
+		}
+	}
+	m.running = next
+	return nil
+}
+
+// start runs r once prev, if not nil, is closed. Stopped before, it
+// still waits for prev, for those following it to wait for both.
+func (m *Manager) start(r Route, prev <-chan struct{}) *running {
+	ctx, cancel := context.WithCancel(context.Background())
+	rr := &running{route: r, cancel: cancel, done: make(chan struct{})}
+	m.wg.Add(1)
+	go func() {
+		defer m.wg.Done()
+		defer close(rr.done)
+		if prev != nil {
+			select {
+			case <-prev:
+			case <-ctx.Done():
+				<-prev
+				return
+			}
+		}
+		err := m.Run(ctx, r)
+		if ctx.Err() != nil {
+			err = nil
+		}
+		if m.OnExit != nil {
+			m.OnExit(r, err)
+		}
+	}()
+	return rr
+}
+
+// Reload loads the configuration file name, and applies it. The routes
+// keep running as they were if the file is invalid.
+func (m *Manager) Reload(name string) error {
+	c, err := LoadFile(name)
+	if err != nil {
+		return err
+	}
+	return m.Apply(c)
+}
+
+// ReloadOnSignal reloads the configuration file name on each SIGHUP,
+// or on each of the signals given instead, until ctx is done. Errors
+// are passed to onError, which may be nil.
+func (m *Manager) ReloadOnSignal(ctx context.Context, name string, onError func(error), sig ...os.Signal) {
+	if len(sig) == 0 {
+		sig = []os.Signal{syscall.SIGHUP}
+	}
+	ch := make(chan os.Signal, 1)
+	signal.Notify(ch, sig...)
+	defer signal.Stop(ch)
+	for {
+		select {
+		case <-ch:
+			if err := m.Reload(name); err != nil && onError != nil {
+				onError(err)
+			}
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// Routes returns the names of the routes currently configured.
+func (m *Manager) Routes() []string {
+	m.mu.Lock()
+	names := make([]string, 0, len(m.running))
+	for name := range m.running {
+		names = append(names, name)
+	}
+	m.mu.Unlock()
+	sort.Strings(names)
+	return names
+}
+
+// Close stops every route, and waits for them to drain.
+func (m *Manager) Close() error {
+	m.mu.Lock()
+	m.closed = true
+	for _, r := range m.running {
+		r.cancel()
+	}
+	m.running = nil
+	m.stopped = nil
+	m.mu.Unlock()
+	m.wg.Wait()
+	return nil
+}
@@ -0,0 +1,184 @@
+// Copyright (c) 2020 CyberAgent, Inc. All rights reserved.
+// https://github.com/openfresh/gosrt
+
+package routes
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func route(name, output string) Route {
+	return Route{
+		Name:    name,
+		Input:   Endpoint{Type: TypeSRT, Address: ":5000"},
+		Outputs: []Endpoint{{Type: TypeUDP, Address: output}},
+	}
+}
+
+func TestManager(t *testing.T) {
+	var (
+		mu     sync.Mutex
+		log    []string
+		events = make(chan string, 16)
+	)
+	record := func(s string) {
+		mu.Lock()
+		log = append(log, s)
+		mu.Unlock()
+		events <- s
+	}
+	release := make(chan struct{})
+	m := &Manager{Run: func(ctx context.Context, r Route) error {
+		record("start " + r.Name + " " + r.Outputs[0].Address)
+		<-ctx.Done()
+		if r.Name == "slow" {
+			// Draining holds back the new version of the route.
+			<-release
+		}
+		record("stop " + r.Name + " " + r.Outputs[0].Address)
+		return nil
+	}}
+	wait := func(want ...string) {
+		t.Helper()
+		got := make(map[string]bool)
+		for range want {
+			select {
+			case e := <-events:
+				got[e] = true
+			case <-time.After(5 * time.Second):
+				t.Fatalf("got %v; want %v", got, want)
+			}
+		}
+		for _, w := range want {
+			if !got[w] {
+				t.Fatalf("got %v; want %v", got, want)
+			}
+		}
+	}
+
+	if err := m.Apply(&Config{Routes: []Route{route("keep", "h:1"), route("drop", "h:1"), route("slow", "h:1")}}); err != nil {
+		t.Fatal(err)
+	}
+	wait("start keep h:1", "start drop h:1", "start slow h:1")
+
+	if err := m.Apply(&Config{Routes: []Route{route("keep", "h:1"), route("slow", "h:2"), route("new", "h:1")}}); err != nil {
+		t.Fatal(err)
+	}
+	wait("stop drop h:1", "start new h:1")
+	if got, want := m.Routes(), []string{"keep", "new", "slow"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Routes() = %v; want %v", got, want)
+	}
+	close(release)
+	wait("stop slow h:1", "start slow h:2")
+
+	mu.Lock()
+	for i, e := range log {
+		if e == "start slow h:2" && log[i-1] != "stop slow h:1" {
+			t.Errorf("new version started before the old one stopped: %v", log)
+		}
+	}
+	mu.Unlock()
+
+	if err := m.Apply(&Config{Routes: []Route{{Name: "bad"}}}); err == nil {
+		t.Error("invalid configuration applied")
+	}
+	m.Close()
+	wait("stop keep h:1", "stop new h:1", "stop slow h:2")
+	if err := m.Apply(&Config{}); err != ErrManagerClosed {
+		t.Errorf("Apply after Close: %v; want ErrManagerClosed", err)
+	}
+}
+
+func TestManagerReadd(t *testing.T) {
+	started := make(chan string, 4)
+	release := make(chan struct{})
+	var stopped int32
+	m := &Manager{Run: func(ctx context.Context, r Route) error {
+		started <- r.Outputs[0].Address
+		<-ctx.Done()
+		if r.Outputs[0].Address == "h:1" {
+			<-release
+		}
+		atomic.AddInt32(&stopped, 1)
+		return nil
+	}}
+	defer m.Close()
+	var once sync.Once
+	drain := func() { once.Do(func() { close(release) }) }
+	defer drain()
+	apply := func(routes ...Route) {
+		t.Helper()
+		if err := m.Apply(&Config{Routes: routes}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	apply(route("a", "h:1"))
+	<-started
+	// Removed, draining, and added back twice: neither new version
+	// starts before the first drained.
+	apply()
+	apply(route("a", "h:2"))
+	apply(route("a", "h:3"))
+	select {
+	case a := <-started:
+		t.Fatalf("started %s while the route removed drains", a)
+	case <-time.After(50 * time.Millisecond):
+	}
+	drain()
+	select {
+	case a := <-started:
+		if a != "h:3" {
+			t.Errorf("started %s; want h:3", a)
+		}
+		if n := atomic.LoadInt32(&stopped); n != 1 {
+			t.Errorf("%d instances returned before the new one started; want 1", n)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("route added back not started")
+	}
+}
+
+func TestManagerReload(t *testing.T) {
+	dir, err := ioutil.TempDir("", "routes")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	name := filepath.Join(dir, "routes.json")
+
+	started := make(chan string, 4)
+	m := &Manager{Run: func(ctx context.Context, r Route) error {
+		started <- r.Name
+		<-ctx.Done()
+		return nil
+	}}
+	defer m.Close()
+	if err := ioutil.WriteFile(name, []byte(feed), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.Reload(name); err != nil {
+		t.Fatal(err)
+	}
+	if r := <-started; r != "feed" {
+		t.Errorf("started %q; want feed", r)
+	}
+
+	// A broken file leaves the routes running.
+	if err := ioutil.WriteFile(name, []byte(`{"routes": [`), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.Reload(name); err == nil {
+		t.Error("Reload of a broken file succeeded")
+	}
+	if got := m.Routes(); !reflect.DeepEqual(got, []string{"feed"}) {
+		t.Errorf("Routes() = %v; want [feed]", got)
+	}
+}
@@ -0,0 +1,437 @@
+// Copyright (c) 2020 CyberAgent, Inc. All rights reserved.
+// https://github.com/openfresh/gosrt
+
+package routes
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/openfresh/gosrt/srt"
+	"github.com/openfresh/gosrt/srtapi"
+)
+
+// Enforcement actions of a Quota.
+const (
+	ActionClose    = "close"    // reject the caller, or close the session
+	ActionThrottle = "throttle" // cap the send bandwidth of the sessions
+	ActionReport   = "report"   // only report the violation
+)
+
+// Limits of a Quota, as a Violation names them.
+const (
+	LimitStreams   = "streams"
+	LimitBandwidth = "bandwidth"
+	LimitDuration  = "duration"
+)
+
+// QuotaDefault is the key of the quota of the users a set of quotas
+// doesn't list by name.
+const QuotaDefault = "*"
+
+// DefaultQuotaInterval is the interval of Quotas whose Interval is 0.
+const DefaultQuotaInterval = time.Second
+
+// A Quota bounds what the callers of a user, as User tells them, take of
+// a listener. The zero Quota bounds nothing.
+type Quota struct {
+	// MaxStreams is the most sessions the user may have at once.
+	MaxStreams int `json:"maxstreams,omitempty"`
+
+	// MaxBandwidth is the most bytes per second the sessions of the
+	// user may send and receive together.
+	MaxBandwidth int64 `json:"maxbandwidth,omitempty"`
+
+	// MaxDuration is the longest a session may last, as
+	// time.ParseDuration takes it, "2h" say.
+	MaxDuration string `json:"maxduration,omitempty"`
+
+	// Action is what is done about a violation: ActionClose, the
+	// default, rejects the callers past MaxStreams, or while the user
+	// is over MaxBandwidth, with srt.RejectXOverload, closes its newest
+	// sessions until it is back under MaxBandwidth, and closes the
+	// sessions past MaxDuration. ActionThrottle caps what the listener
+	// sends on each session to an equal share of MaxBandwidth instead,
+	// from then on, the shares growing and shrinking as the sessions
+	// of the user leave and join; it can't slow down what callers
+	// send, and closes sessions as ActionClose does otherwise.
+	// ActionReport only reports violations, for a quota to be tried
+	// out before it is enforced.
+	Action string `json:"action,omitempty"`
+}
+
+func (q *Quota) action() string {
+	if q.Action == "" {
+		return ActionClose
+	}
+	return q.Action
+}
+
+// maxDuration returns MaxDuration, 0 if it is unset or invalid.
+func (q *Quota) maxDuration() time.Duration {
+	if q.MaxDuration == "" {
+		return 0
+	}
+	d, _ := time.ParseDuration(q.MaxDuration)
+	return d
+}
+
+func (q *Quota) validate(f string, add func(field, format string, args ...interface{})) {
+	if q.MaxStreams < 0 {
+		add(f+".maxstreams", "%d is negative", q.MaxStreams)
+	}
+	if q.MaxBandwidth < 0 {
+		add(f+".maxbandwidth", "%d is negative", q.MaxBandwidth)
+	}
+	if q.MaxDuration != "" {
+		if d, err := time.ParseDuration(q.MaxDuration); err != nil || d <= 0 {
+			add(f+".maxduration", "invalid duration %q", q.MaxDuration)
+		}
+	}
+	switch q.Action {
+	case "", ActionClose, ActionThrottle, ActionReport:
+	default:
+		add(f+".action", "unknown action %q", q.Action)
+	}
+}
+
+// A Violation is a user going over its quota.
+type Violation struct {
+	User  string
+	Limit string // LimitStreams, LimitBandwidth or LimitDuration
+
+	// Action is the action of the quota taken about it.
+	Action string
+	Quota  Quota
+
+	// Peer is the caller rejected, or the peer of Conn, the session
+	// past MaxDuration or closed or throttled for MaxBandwidth; Conn
+	// is nil for the others.
+	Peer net.Addr
+	Conn *srt.SRTConn
+
+	// Streams and Bandwidth are the sessions of the user and the bytes
+	// per second they carry, and Duration how long Conn has lasted.
+	Streams   int
+	Bandwidth int64
+	Duration  time.Duration
+}
+
+// Quotas enforce a Quota per user on the sessions of the listeners made
+// with their Hooks: on each caller as it connects, and on the sessions
+// every Interval, their bandwidth being measured over it. An SRT
+// listener endpoint with quotas has its Context carry them.
+//
+// The zero Quotas enforce nothing. The fields must not be changed once
+// the Quotas are used.
+type Quotas struct {
+	// Limits are the quotas by user; the users not in it have that of
+	// QuotaDefault, if any.
+	Limits map[string]Quota
+
+	// Interval is the time between two checks of the sessions; 0 means
+	// DefaultQuotaInterval.
+	Interval time.Duration
+
+	// OnViolation, if set, is called with each violation, once the
+	// action was taken. A user over MaxBandwidth is reported when it
+	// goes over it, and not again until it fell back under it. It must
+	// not block.
+	OnViolation func(Violation)
+
+	mu      sync.Mutex
+	users   map[string]*quotaUser
+	running bool
+}
+
+// A quotaUser is the sessions of a user.
+type quotaUser struct {
+	sessions   []*quotaSession // oldest first
+	over       bool            // over MaxBandwidth at the last check
+	throttling bool            // its sessions are given shares of MaxBandwidth
+}
+
+type quotaSession struct {
+	c         *srt.SRTConn
+	start     time.Time
+	at        time.Time // of the last sample
+	bytes     int64     // sent and received by then
+	rate      int64     // bytes per second over the last interval
+	throttled int64     // the send bandwidth it was capped to, if any
+	expired   bool
+}
+
+// sample returns the bytes s sent and received so far, and false once
+// it is closed.
+func (s *quotaSession) sample() (int64, bool) {
+	rc, err := s.c.RawConn()
+	if err != nil {
+		return 0, false
+	}
+	var snd srtapi.SendState
+	var rcv srtapi.RecvState
+	var serr, rerr error
+	if err := rc.Control(func(fd srtapi.SrtSocket) {
+		snd, serr = srtapi.GetSendState(int(fd))
+		rcv, rerr = srtapi.GetRecvState(int(fd))
+	}); err != nil || serr != nil || rerr != nil {
+		return 0, false
+	}
+	return snd.BytesSent + rcv.BytesReceived, true
+}
+
+func (q *Quotas) quota(user string) (Quota, bool) {
+	if l, ok := q.Limits[user]; ok {
+		return l, true
+	}
+	l, ok := q.Limits[QuotaDefault]
+	return l, ok
+}
+
+func (q *Quotas) interval() time.Duration {
+	if q.Interval <= 0 {
+		return DefaultQuotaInterval
+	}
+	return q.Interval
+}
+
+// Usage returns the sessions of user, and the bytes per second they
+// carried over the last interval.
+func (q *Quotas) Usage(user string) (streams int, bandwidth int64) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	u := q.users[user]
+	if u == nil {
+		return 0, 0
+	}
+	return len(u.sessions), u.bandwidth()
+}
+
+func (u *quotaUser) bandwidth() int64 {
+	var n int64
+	for _, s := range u.sessions {
+		n += s.rate
+	}
+	return n
+}
+
+// Hooks returns the hooks enforcing q on the connections accepted with
+// them (see srt.WithHooks). Callers over the quota are rejected from
+// the listen callback when the SRT implementation has one, and closed
+// as they are accepted otherwise.
+func (q *Quotas) Hooks() *srt.Hooks {
+	return &srt.Hooks{
+		BeforeHandshake: func(ctx context.Context, op string, addr net.Addr, streamID string) error {
+			if op != "accept" {
+				return nil
+			}
+			q.mu.Lock()
+			v, err := q.admit(User(streamID), addr)
+			q.mu.Unlock()
+			// The callers let in are reported by AfterConnect.
+			if err != nil {
+				q.report(v)
+			}
+			return err
+		},
+		AfterConnect: func(ctx context.Context, op string, c *srt.SRTConn) error {
+			if op != "accept" {
+				return nil
+			}
+			sid, _ := c.StreamID()
+			return q.add(User(sid), c)
+		},
+	}
+}
+
+// admit checks whether user may have one more session, returning the
+// violation if it may not. q.mu must be held.
+func (q *Quotas) admit(user string, peer net.Addr) ([]Violation, error) {
+	l, ok := q.quota(user)
+	if !ok {
+		return nil, nil
+	}
+	var streams int
+	var bw int64
+	if u := q.users[user]; u != nil {
+		streams, bw = len(u.sessions), u.bandwidth()
+	}
+	v := Violation{User: user, Action: l.action(), Quota: l, Peer: peer, Streams: streams, Bandwidth: bw}
+	var err error
+	switch {
+	case l.MaxStreams > 0 && streams >= l.MaxStreams:
+		v.Limit = LimitStreams
+		err = fmt.Errorf("routes: user %q has %d streams of %d: %w", user, streams, l.MaxStreams, errOverQuota)
+	case l.MaxBandwidth > 0 && bw >= l.MaxBandwidth && l.action() == ActionClose:
+		v.Limit = LimitBandwidth
+		err = fmt.Errorf("routes: user %q takes %d bytes/s of %d: %w", user, bw, l.MaxBandwidth, errOverQuota)
+	default:
+		return nil, nil
+	}
+	if l.action() == ActionReport {
+		err = nil
+	}
+	return []Violation{v}, err
+}
+
+var errOverQuota = &srt.RejectError{Reason: srt.RejectXOverload}
+
+// add counts c as a session of user, if its quota allows it, and has
+// the sessions checked from then on.
+func (q *Quotas) add(user string, c *srt.SRTConn) error {
+	q.mu.Lock()
+	v, err := q.admit(user, c.RemoteAddr())
+	if err == nil {
+		if q.users == nil {
+			q.users = make(map[string]*quotaUser)
+		}
+		u := q.users[user]
+		if u == nil {
+			u = &quotaUser{}
+			q.users[user] = u
+		}
+		now := time.Now()
+		s := &quotaSession{c: c, start: now, at: now}
+		s.bytes, _ = s.sample()
+		u.sessions = append(u.sessions, s)
+		if !q.running {
+			q.running = true
+			go q.run()
+		}
+	}
+	q.mu.Unlock()
+	q.report(v)
+	return err
+}
+
+// run checks the sessions every interval, while there are some.
+func (q *Quotas) run() {
+	t := time.NewTicker(q.interval())
+	defer t.Stop()
+	for now := range t.C {
+		if !q.check(now) {
+			return
+		}
+	}
+}
+
+// check enforces the quotas on the sessions, and reports whether there
+// are still some.
+func (q *Quotas) check(now time.Time) bool {
+	type throttle struct {
+		c   *srt.SRTConn
+		bps int64
+	}
+	var (
+		vs        []Violation
+		closes    []*srt.SRTConn
+		throttles []throttle
+	)
+	q.mu.Lock()
+	for user, u := range q.users {
+		live := u.sessions[:0]
+		for _, s := range u.sessions {
+			n, ok := s.sample()
+			if !ok {
+				continue
+			}
+			if d := now.Sub(s.at); d > 0 {
+				s.rate = int64(float64(n-s.bytes) / d.Seconds())
+			}
+			s.at, s.bytes = now, n
+			live = append(live, s)
+		}
+		u.sessions = live
+		l, ok := q.quota(user)
+		if ok {
+			if max := l.maxDuration(); max > 0 {
+				live := u.sessions[:0]
+				for _, s := range u.sessions {
+					if d := now.Sub(s.start); d > max && !s.expired {
+						s.expired = true
+						vs = append(vs, Violation{User: user, Limit: LimitDuration, Action: l.action(), Quota: l,
+							Peer: s.c.RemoteAddr(), Conn: s.c, Streams: len(u.sessions), Duration: d})
+						if l.action() != ActionReport {
+							closes = append(closes, s.c)
+							continue
+						}
+					}
+					live = append(live, s)
+				}
+				u.sessions = live
+			}
+			bw := u.bandwidth()
+			if l.MaxBandwidth > 0 && bw > l.MaxBandwidth {
+				v := Violation{User: user, Limit: LimitBandwidth, Action: l.action(), Quota: l,
+					Streams: len(u.sessions), Bandwidth: bw}
+				switch l.action() {
+				case ActionClose:
+					// The newest sessions go first, the ones the user
+					// was over its quota with.
+					for len(u.sessions) > 0 && bw > l.MaxBandwidth {
+						s := u.sessions[len(u.sessions)-1]
+						u.sessions = u.sessions[:len(u.sessions)-1]
+						bw -= s.rate
+						closes = append(closes, s.c)
+						vc := v
+						vc.Peer, vc.Conn = s.c.RemoteAddr(), s.c
+						vs = append(vs, vc)
+					}
+				case ActionThrottle:
+					u.throttling = true
+					if !u.over {
+						vs = append(vs, v)
+					}
+				case ActionReport:
+					if !u.over {
+						vs = append(vs, v)
+					}
+				}
+				u.over = l.action() != ActionClose
+			} else {
+				u.over = false
+			}
+			if u.throttling && len(u.sessions) > 0 {
+				// The shares follow the sessions joining and leaving.
+				share := l.MaxBandwidth / int64(len(u.sessions))
+				for _, s := range u.sessions {
+					if s.throttled != share {
+						s.throttled = share
+						throttles = append(throttles, throttle{s.c, share})
+					}
+				}
+			}
+		}
+		if len(u.sessions) == 0 {
+			delete(q.users, user)
+		}
+	}
+	more := len(q.users) > 0
+	if !more {
+		q.running = false
+	}
+	q.mu.Unlock()
+
+	for _, c := range closes {
+		c.Close()
+	}
+	for _, t := range throttles {
+		t.c.SetMaxBandwidth(t.bps)
+	}
+	sort.SliceStable(vs, func(i, j int) bool { return vs[i].User < vs[j].User })
+	q.report(vs)
+	return more
+}
+
+func (q *Quotas) report(vs []Violation) {
+	if q.OnViolation == nil {
+		return
+	}
+	for _, v := range vs {
+		q.OnViolation(v)
+	}
+}
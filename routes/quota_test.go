@@ -0,0 +1,214 @@
+// Copyright (c) 2020 CyberAgent, Inc. All rights reserved.
+// https://github.com/openfresh/gosrt
+
+package routes
+
+import (
+	"context"
+	"errors"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/openfresh/gosrt/srt"
+)
+
+func TestQuotas(t *testing.T) {
+	violations := make(chan Violation, 10)
+	q := &Quotas{
+		Limits: map[string]Quota{
+			"encoder": {MaxStreams: 1},
+			"bulk":    {MaxBandwidth: 1000},
+			"trial":   {MaxStreams: 1, Action: ActionReport},
+			"*":       {MaxDuration: "100ms"},
+		},
+		Interval:    20 * time.Millisecond,
+		OnViolation: func(v Violation) { violations <- v },
+	}
+	l, err := srt.ListenContext(srt.WithHooks(context.Background(), q.Hooks()), "srt4", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	ln := l.(*srt.SRTListener)
+	go func() {
+		for {
+			c, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer c.Close()
+				buf := make([]byte, 1500)
+				for {
+					if _, err := c.Read(buf); err != nil {
+						return
+					}
+				}
+			}()
+		}
+	}()
+	dial := func(sid string) (*srt.SRTConn, error) {
+		d := srt.Dialer{}
+		c, err := d.DialContext(srt.WithOptions(context.Background(), srt.Options("streamid", sid)), "srt", ln.Addr().String())
+		if err != nil {
+			return nil, err
+		}
+		return c.(*srt.SRTConn), nil
+	}
+	next := func(limit string) Violation {
+		t.Helper()
+		select {
+		case v := <-violations:
+			if v.Limit != limit {
+				t.Fatalf("violation %+v; want one of %s", v, limit)
+			}
+			return v
+		case <-time.After(5 * time.Second):
+			t.Fatalf("no violation of %s", limit)
+		}
+		return Violation{}
+	}
+
+	c, err := dial("#!::u=encoder")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	_, err = dial("#!::u=encoder,r=live/two")
+	var re *srt.RejectError
+	if !errors.As(err, &re) || re.Reason != srt.RejectXOverload {
+		t.Fatalf("second stream of encoder: %v; want a rejection for %v", err, srt.RejectXOverload)
+	}
+	if v := next(LimitStreams); v.User != "encoder" || v.Action != ActionClose || v.Streams != 1 {
+		t.Errorf("violation %+v; want encoder rejected at 1 stream", v)
+	}
+	if n, _ := q.Usage("encoder"); n != 1 {
+		t.Errorf("encoder has %d streams; want 1", n)
+	}
+
+	for i := 0; i < 2; i++ {
+		c, err := dial("trial")
+		if err != nil {
+			t.Fatalf("stream %d of trial: %v; want it reported only", i, err)
+		}
+		defer c.Close()
+	}
+	if v := next(LimitStreams); v.User != "trial" || v.Action != ActionReport {
+		t.Errorf("violation %+v; want trial reported", v)
+	}
+
+	b, err := dial("bulk")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer b.Close()
+	for i := 0; i < 20; i++ {
+		if _, err := b.Write(make([]byte, 1000)); err != nil {
+			break
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	if v := next(LimitBandwidth); v.User != "bulk" || v.Conn == nil || v.Bandwidth <= 1000 {
+		t.Errorf("violation %+v; want a session of bulk closed over 1000 bytes/s", v)
+	}
+
+	o, err := dial("other")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer o.Close()
+	if v := next(LimitDuration); v.User != "other" || v.Duration < 100*time.Millisecond {
+		t.Errorf("violation %+v; want other closed after 100ms", v)
+	}
+	o.SetReadDeadline(time.Now().Add(5 * time.Second))
+	if _, err := o.Read(make([]byte, 1500)); err == nil {
+		t.Error("session of other still open past its duration")
+	}
+}
+
+func TestQuotaThrottle(t *testing.T) {
+	// The sessions are checked by hand.
+	q := &Quotas{
+		Limits:   map[string]Quota{"thr": {MaxBandwidth: 1000, Action: ActionThrottle}},
+		Interval: time.Hour,
+	}
+	l, err := srt.ListenContext(srt.WithHooks(context.Background(), q.Hooks()), "srt4", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	go func() {
+		for {
+			c, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer c.Close()
+				buf := make([]byte, 1500)
+				for {
+					if _, err := c.Read(buf); err != nil {
+						return
+					}
+				}
+			}()
+		}
+	}()
+	var cs []net.Conn
+	for i := 0; i < 2; i++ {
+		var d srt.Dialer
+		c, err := d.DialContext(srt.WithOptions(context.Background(), srt.Options("streamid", "#!::u=thr")), "srt", l.Addr().String())
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer c.Close()
+		cs = append(cs, c)
+	}
+	shares := func() []int64 {
+		q.mu.Lock()
+		defer q.mu.Unlock()
+		var bw []int64
+		if u := q.users["thr"]; u != nil {
+			for _, s := range u.sessions {
+				bw = append(bw, s.throttled)
+			}
+		}
+		return bw
+	}
+	deadline := time.Now().Add(5 * time.Second)
+	for len(shares()) < 2 {
+		if time.Now().After(deadline) {
+			t.Fatal("sessions not counted")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	b := make([]byte, 1316)
+	for _, c := range cs {
+		for i := 0; i < 10; i++ {
+			if _, err := c.Write(b); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	time.Sleep(100 * time.Millisecond)
+	q.check(time.Now())
+	if got := shares(); len(got) != 2 || got[0] != 500 || got[1] != 500 {
+		t.Fatalf("got shares %v over the quota; want 500 each", got)
+	}
+
+	// The session left gives its share back.
+	cs[1].Close()
+	for time.Now().Before(deadline) {
+		q.check(time.Now())
+		if got := shares(); len(got) == 1 {
+			if got[0] != 1000 {
+				t.Errorf("got share %d once alone; want 1000", got[0])
+			}
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatal("session closed still counted")
+}
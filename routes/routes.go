@@ -0,0 +1,409 @@
+// Copyright (c) 2020 CyberAgent, Inc. All rights reserved.
+// https://github.com/openfresh/gosrt
+
+// Package routes loads the routes of a relay from a configuration
+// file: for each route, the input a stream comes from, the outputs it
+// goes to, and the SRT options and credentials of each, so that a
+// deployment changes in its configuration rather than its code.
+//
+// Configurations are JSON, which YAML configurations convert to
+// without loss:
+//
+//	{
+//	  "routes": [{
+//	    "name": "feed",
+//	    "input": {"type": "srt", "address": ":5000",
+//	      "options": {"latency": "200"},
+//	      "auth": {"users": {"encoder": "0123456789abcdef"}}},
+//	    "outputs": [
+//	      {"type": "srt", "address": "cdn.example.com:5000",
+//	        "options": {"streamid": "live/feed"}},
+//	      {"type": "udp", "address": "239.0.0.1:1234"}
+//	    ]
+//	  }]
+//	}
+//
+// A listener's "quotas" bound, per user, the streams its callers may
+// have at once, the bandwidth they may take together and how long each
+// session may last (see Quota).
+//
+// Load checks everything it can without opening a socket, and reports
+// each problem with the path of the field at fault. A Manager runs the
+// routes, and reloads them on SIGHUP or on demand without touching
+// those that didn't change.
+package routes
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/openfresh/gosrt/srt"
+	"github.com/openfresh/gosrt/streamid"
+)
+
+// A Config is a set of routes.
+type Config struct {
+	Routes []Route `json:"routes"`
+}
+
+// A Route carries the stream of its input to each of its outputs.
+type Route struct {
+	// Name identifies the route, in logs say; it must be unique.
+	Name string `json:"name"`
+
+	Input   Endpoint   `json:"input"`
+	Outputs []Endpoint `json:"outputs"`
+}
+
+// Endpoint types.
+const (
+	TypeSRT = "srt"
+	TypeUDP = "udp"
+)
+
+// SRT connection modes.
+const (
+	ModeCaller   = "caller"
+	ModeListener = "listener"
+)
+
+// An Endpoint is where a route reads or writes its stream.
+type Endpoint struct {
+	// Type is TypeSRT or TypeUDP.
+	Type string `json:"type"`
+
+	// Mode is ModeCaller or ModeListener, for SRT endpoints. Inputs
+	// listen and outputs call unless it says otherwise.
+	Mode string `json:"mode,omitempty"`
+
+	// Address is the host and port to call, or to listen on, with an
+	// empty host for all addresses.
+	Address string `json:"address"`
+
+	// Options are SRT options, as srt.Options takes them.
+	Options map[string]string `json:"options,omitempty"`
+
+	Auth *Auth `json:"auth,omitempty"`
+
+	// Quotas are the quotas of the users of a listener, by user, with
+	// QuotaDefault for the users not listed.
+	Quotas map[string]Quota `json:"quotas,omitempty"`
+}
+
+// Auth holds the credentials of an SRT endpoint.
+type Auth struct {
+	// Passphrase encrypts the connections, with keys of PBKeyLen
+	// bytes, 16, 24 or 32, or the libsrt default if 0.
+	Passphrase string `json:"passphrase,omitempty"`
+	PBKeyLen   int    `json:"pbkeylen,omitempty"`
+
+	// Users maps the users a listener accepts to their passphrases.
+	// The user of a caller is the "u" key of its stream ID, in the
+	// access control syntax, or else its whole stream ID. Callers of
+	// other users are rejected.
+	Users map[string]string `json:"users,omitempty"`
+}
+
+// A FieldError is a problem with a field of a configuration.
+type FieldError struct {
+	// Field is the path of the field, "routes[0].outputs[1].address"
+	// say, or empty for the configuration as a whole.
+	Field string
+	Err   error
+}
+
+func (e *FieldError) Error() string {
+	if e.Field == "" {
+		return "routes: " + e.Err.Error()
+	}
+	return "routes: " + e.Field + ": " + e.Err.Error()
+}
+
+func (e *FieldError) Unwrap() error { return e.Err }
+
+// Errors are the problems Load found with a configuration.
+type Errors []*FieldError
+
+func (e Errors) Error() string {
+	s := make([]string, len(e))
+	for i, fe := range e {
+		s[i] = fe.Error()
+	}
+	return strings.Join(s, "\n")
+}
+
+// Load reads a configuration from r, and validates it. Unknown fields
+// are errors, as they are most likely misspelt. The error is Errors if
+// the configuration is well-formed JSON.
+func Load(r io.Reader) (*Config, error) {
+	b, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	dec := json.NewDecoder(bytes.NewReader(b))
+	dec.DisallowUnknownFields()
+	var c Config
+	if err := dec.Decode(&c); err != nil {
+		return nil, decodeError(b, err)
+	}
+	if dec.More() {
+		return nil, &FieldError{Err: errors.New("data after the configuration")}
+	}
+	if errs := c.Validate(); errs != nil {
+		return nil, errs
+	}
+	return &c, nil
+}
+
+// LoadFile is Load from the named file.
+func LoadFile(name string) (*Config, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return Load(f)
+}
+
+// decodeError returns err with the line and column of its offset in
+// b, and the field it is about if it knows it.
+func decodeError(b []byte, err error) error {
+	var (
+		off   int64
+		field string
+	)
+	var se *json.SyntaxError
+	var te *json.UnmarshalTypeError
+	switch {
+	case errors.As(err, &se):
+		off = se.Offset
+	case errors.As(err, &te):
+		off, field = te.Offset, fieldPath(te.Field)
+		err = fmt.Errorf("%s is not a %v", te.Value, te.Type)
+	default:
+		return &FieldError{Err: err}
+	}
+	if off > int64(len(b)) {
+		off = int64(len(b))
+	}
+	line := 1 + bytes.Count(b[:off], []byte("\n"))
+	col := int(off) - bytes.LastIndexByte(b[:off], '\n')
+	return &FieldError{Field: field, Err: fmt.Errorf("line %d, column %d: %v", line, col, err)}
+}
+
+// fieldPath turns a field path of encoding/json, "routes.0.name", into
+// one of FieldError, "routes[0].name". Older Go versions leave out the
+// indexes.
+func fieldPath(f string) string {
+	var b strings.Builder
+	for i, s := range strings.Split(f, ".") {
+		if _, err := strconv.Atoi(s); err == nil {
+			b.WriteString("[" + s + "]")
+			continue
+		}
+		if i > 0 {
+			b.WriteByte('.')
+		}
+		b.WriteString(s)
+	}
+	return b.String()
+}
+
+// Validate returns the problems with c, or nil.
+func (c *Config) Validate() Errors {
+	var errs Errors
+	add := func(field, format string, args ...interface{}) {
+		errs = append(errs, &FieldError{Field: field, Err: fmt.Errorf(format, args...)})
+	}
+	names := make(map[string]int)
+	for i, r := range c.Routes {
+		f := fmt.Sprintf("routes[%d]", i)
+		switch j, dup := names[r.Name]; {
+		case r.Name == "":
+			add(f+".name", "missing")
+		case dup:
+			add(f+".name", "%q is already the name of routes[%d]", r.Name, j)
+		default:
+			names[r.Name] = i
+		}
+		r.Input.validate(f+".input", true, add)
+		if len(r.Outputs) == 0 {
+			add(f+".outputs", "missing")
+		}
+		for j := range r.Outputs {
+			r.Outputs[j].validate(fmt.Sprintf("%s.outputs[%d]", f, j), false, add)
+		}
+	}
+	return errs
+}
+
+func (e *Endpoint) validate(f string, input bool, add func(field, format string, args ...interface{})) {
+	switch e.Type {
+	case TypeSRT:
+	case TypeUDP:
+		if e.Mode != "" {
+			add(f+".mode", "UDP endpoints have no mode")
+		}
+		if len(e.Options) > 0 {
+			add(f+".options", "UDP endpoints have no options")
+		}
+		if e.Auth != nil {
+			add(f+".auth", "UDP endpoints have no auth")
+		}
+	case "":
+		add(f+".type", "missing")
+	default:
+		add(f+".type", "unknown type %q", e.Type)
+	}
+
+	mode := e.mode(input)
+	switch mode {
+	case ModeCaller, ModeListener, "":
+	default:
+		add(f+".mode", "unknown mode %q", e.Mode)
+	}
+
+	if e.Address == "" {
+		add(f+".address", "missing")
+	} else if host, port, err := net.SplitHostPort(e.Address); err != nil {
+		add(f+".address", "%v", err.(*net.AddrError).Err)
+	} else if n, err := strconv.Atoi(port); err != nil || n < 0 || n > 65535 {
+		add(f+".address", "invalid port %q", port)
+	} else if (mode == ModeCaller || e.Type == TypeUDP && !input) && (host == "" || n == 0) {
+		add(f+".address", "missing host or port to send to")
+	}
+
+	keys := make([]string, 0, len(e.Options))
+	for k := range e.Options {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		v := e.Options[k]
+		if err := srt.CheckOption(k, v); err == srt.ErrUnknownOption {
+			add(f+".options."+k, "unknown option")
+		} else if err != nil {
+			add(f+".options."+k, "invalid value %q", v)
+		}
+	}
+
+	if a := e.Auth; a != nil {
+		if a.Passphrase != "" {
+			checkPassphrase(f+".auth.passphrase", a.Passphrase, add)
+		}
+		switch a.PBKeyLen {
+		case 0, 16, 24, 32:
+		default:
+			add(f+".auth.pbkeylen", "%d is not 16, 24 or 32", a.PBKeyLen)
+		}
+		if len(a.Users) > 0 && mode != ModeListener {
+			add(f+".auth.users", "only listeners have users")
+		}
+		for u, p := range a.Users {
+			checkPassphrase(f+".auth.users."+u, p, add)
+		}
+	}
+
+	if len(e.Quotas) > 0 && mode != ModeListener {
+		add(f+".quotas", "only listeners have quotas")
+	}
+	users := make([]string, 0, len(e.Quotas))
+	for u := range e.Quotas {
+		users = append(users, u)
+	}
+	sort.Strings(users)
+	for _, u := range users {
+		q := e.Quotas[u]
+		q.validate(f+".quotas."+u, add)
+	}
+}
+
+// checkPassphrase checks the length libsrt requires of passphrases.
+func checkPassphrase(f, p string, add func(field, format string, args ...interface{})) {
+	if len(p) < 10 || len(p) > 79 {
+		add(f, "passphrases are 10 to 79 characters long")
+	}
+}
+
+// mode returns the mode of e, with its default, or "" for UDP
+// endpoints.
+func (e *Endpoint) mode(input bool) string {
+	switch {
+	case e.Type != TypeSRT:
+		return ""
+	case e.Mode != "":
+		return e.Mode
+	case input:
+		return ModeListener
+	}
+	return ModeCaller
+}
+
+// Listens reports whether e listens for connections, as an input by
+// default, rather than calling.
+func (e *Endpoint) Listens(input bool) bool {
+	return e.mode(input) == ModeListener
+}
+
+// Context returns ctx with the options, credentials and quotas of e,
+// for an SRT endpoint to be dialed or listened on with. Each call
+// enforces the quotas anew, on the listener made with its context.
+func (e *Endpoint) Context(ctx context.Context) context.Context {
+	var args []string
+	for k, v := range e.Options {
+		args = append(args, k, v)
+	}
+	if a := e.Auth; a != nil {
+		if a.Passphrase != "" {
+			args = append(args, "passphrase", a.Passphrase)
+		}
+		if a.PBKeyLen != 0 {
+			args = append(args, "pbkeylen", strconv.Itoa(a.PBKeyLen))
+		}
+		if len(a.Users) > 0 {
+			ctx = srt.WithPassphraseFunc(ctx, func(_ context.Context, _ net.Addr, sid string) (string, error) {
+				return a.passphrase(sid)
+			})
+		}
+	}
+	if len(args) > 0 {
+		ctx = srt.WithOptions(ctx, srt.Options(args...))
+	}
+	if len(e.Quotas) > 0 {
+		ctx = srt.WithHooks(ctx, (&Quotas{Limits: e.Quotas}).Hooks())
+	}
+	return ctx
+}
+
+var errUnknownUser = errors.New("routes: unknown user")
+
+// passphrase returns the passphrase of the user of sid.
+func (a *Auth) passphrase(sid string) (string, error) {
+	if p, ok := a.Users[User(sid)]; ok {
+		return p, nil
+	}
+	return "", errUnknownUser
+}
+
+// User returns the user of a caller with the stream ID sid, as
+// Auth.Users has it.
+func User(sid string) string {
+	if !strings.HasPrefix(sid, streamid.Prefix) {
+		return sid
+	}
+	id, err := streamid.ParseID(sid)
+	if err != nil {
+		return ""
+	}
+	return id.User
+}
@@ -0,0 +1,161 @@
+// Copyright (c) 2020 CyberAgent, Inc. All rights reserved.
+// https://github.com/openfresh/gosrt
+
+package routes
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/openfresh/gosrt/srt"
+)
+
+const feed = `{
+  "routes": [{
+    "name": "feed",
+    "input": {"type": "srt", "address": ":5000",
+      "options": {"latency": "200"},
+      "auth": {"users": {"encoder": "0123456789abcdef"}}},
+    "outputs": [
+      {"type": "srt", "address": "cdn.example.com:5000",
+        "options": {"streamid": "live/feed"},
+        "auth": {"passphrase": "fedcba9876543210", "pbkeylen": 32}},
+      {"type": "udp", "address": "239.0.0.1:1234"}
+    ]
+  }]
+}`
+
+func TestLoad(t *testing.T) {
+	c, err := Load(strings.NewReader(feed))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := &Config{Routes: []Route{{
+		Name: "feed",
+		Input: Endpoint{Type: TypeSRT, Address: ":5000",
+			Options: map[string]string{"latency": "200"},
+			Auth:    &Auth{Users: map[string]string{"encoder": "0123456789abcdef"}}},
+		Outputs: []Endpoint{
+			{Type: TypeSRT, Address: "cdn.example.com:5000",
+				Options: map[string]string{"streamid": "live/feed"},
+				Auth:    &Auth{Passphrase: "fedcba9876543210", PBKeyLen: 32}},
+			{Type: TypeUDP, Address: "239.0.0.1:1234"},
+		},
+	}}}
+	if !reflect.DeepEqual(c, want) {
+		t.Fatalf("Load = %+v; want %+v", c, want)
+	}
+	if !c.Routes[0].Input.Listens(true) || c.Routes[0].Outputs[0].Listens(false) {
+		t.Error("the input doesn't listen or the output does")
+	}
+
+	ctx := c.Routes[0].Outputs[0].Context(context.Background())
+	for k, v := range map[string]string{"streamid": "live/feed", "passphrase": "fedcba9876543210", "pbkeylen": "32"} {
+		if got, _ := srt.Option(ctx, k); got != v {
+			t.Errorf("option %s = %q; want %q", k, got, v)
+		}
+	}
+}
+
+func TestLoadErrors(t *testing.T) {
+	for _, tt := range []struct {
+		config string
+		want   []string
+	}{
+		{`{"routes": [{"name": "a", "input": {"type": "srt", "address": ":1"}, "outputs": [{"type": "udp", "address": "h:1"}]}]} {}`,
+			[]string{"routes: data after the configuration"}},
+		{"{\n  \"routes\": [,\n", []string{"routes: line 2, column 15: invalid character ',' looking for beginning of value"}},
+		{`{"routs": []}`, []string{`routes: json: unknown field "routs"`}},
+		{`{"routes": [{"input": {}, "outputs": []}]}`, []string{
+			"routes: routes[0].name: missing",
+			"routes: routes[0].input.type: missing",
+			"routes: routes[0].input.address: missing",
+			"routes: routes[0].outputs: missing",
+		}},
+		{`{"routes": [
+			{"name": "a", "input": {"type": "srt", "mode": "rendezvous", "address": "h"}, "outputs": [{"type": "udp", "address": ":1234", "mode": "caller"}]},
+			{"name": "a", "input": {"type": "rtmp", "address": ":x"}, "outputs": [{"type": "srt", "address": ":5000", "options": {"latncy": "1", "latency": "x"}}]}
+		]}`, []string{
+			`routes: routes[0].input.mode: unknown mode "rendezvous"`,
+			"routes: routes[0].input.address: missing port in address",
+			"routes: routes[0].outputs[0].mode: UDP endpoints have no mode",
+			"routes: routes[0].outputs[0].address: missing host or port to send to",
+			`routes: routes[1].name: "a" is already the name of routes[0]`,
+			`routes: routes[1].input.type: unknown type "rtmp"`,
+			`routes: routes[1].input.address: invalid port "x"`,
+			"routes: routes[1].outputs[0].address: missing host or port to send to",
+			`routes: routes[1].outputs[0].options.latency: invalid value "x"`,
+			"routes: routes[1].outputs[0].options.latncy: unknown option",
+		}},
+		{`{"routes": [{"name": "a",
+			"input": {"type": "srt", "address": ":1", "auth": {"passphrase": "short", "pbkeylen": 8}},
+			"outputs": [{"type": "srt", "address": "h:1", "auth": {"users": {"u": "0123456789"}}}]}]}`, []string{
+			"routes: routes[0].input.auth.passphrase: passphrases are 10 to 79 characters long",
+			"routes: routes[0].input.auth.pbkeylen: 8 is not 16, 24 or 32",
+			"routes: routes[0].outputs[0].auth.users: only listeners have users",
+		}},
+		{`{"routes": [{"name": "a",
+			"input": {"type": "srt", "address": ":1", "quotas": {"*": {"maxstreams": -1, "maxduration": "1x"}, "u": {"maxbandwidth": -2, "action": "kick"}}},
+			"outputs": [{"type": "srt", "address": "h:1", "quotas": {"u": {"maxstreams": 1}}}]}]}`, []string{
+			"routes: routes[0].input.quotas.*.maxstreams: -1 is negative",
+			`routes: routes[0].input.quotas.*.maxduration: invalid duration "1x"`,
+			"routes: routes[0].input.quotas.u.maxbandwidth: -2 is negative",
+			`routes: routes[0].input.quotas.u.action: unknown action "kick"`,
+			"routes: routes[0].outputs[0].quotas: only listeners have quotas",
+		}},
+	} {
+		_, err := Load(strings.NewReader(tt.config))
+		var got []string
+		var errs Errors
+		var fe *FieldError
+		switch {
+		case errors.As(err, &errs):
+			for _, e := range errs {
+				got = append(got, e.Error())
+			}
+		case errors.As(err, &fe):
+			got = []string{fe.Error()}
+		default:
+			t.Errorf("Load(%s): %v; want %q", tt.config, err, tt.want)
+			continue
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("Load(%s) errors\n%s\nwant\n%s", tt.config, strings.Join(got, "\n"), strings.Join(tt.want, "\n"))
+		}
+	}
+}
+
+func TestLoadTypeError(t *testing.T) {
+	_, err := Load(strings.NewReader("{\n  \"routes\": [\n    {\"name\": 1}]}"))
+	var fe *FieldError
+	if !errors.As(err, &fe) {
+		t.Fatalf("Load: %v; want a FieldError", err)
+	}
+	// Newer Go versions give the index of the route.
+	if fe.Field != "routes[0].name" && fe.Field != "routes.name" || fe.Err.Error() != "line 3, column 15: number is not a string" {
+		t.Errorf("Load: %v", err)
+	}
+}
+
+func TestUsers(t *testing.T) {
+	for sid, want := range map[string]string{
+		"encoder":                  "encoder",
+		"#!::u=encoder,r=live/one": "encoder",
+		"#!::r=live/one":           "",
+	} {
+		if got := User(sid); got != want {
+			t.Errorf("User(%q) = %q; want %q", sid, got, want)
+		}
+	}
+
+	a := &Auth{Users: map[string]string{"encoder": "0123456789abcdef"}}
+	if p, err := a.passphrase("#!::u=encoder"); err != nil || p != "0123456789abcdef" {
+		t.Errorf("passphrase of encoder = %q, %v", p, err)
+	}
+	if _, err := a.passphrase("other"); err != errUnknownUser {
+		t.Errorf("passphrase of other: %v; want errUnknownUser", err)
+	}
+}
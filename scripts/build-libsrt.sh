@@ -0,0 +1,39 @@
+#!/bin/sh
+# Copyright (c) 2020 CyberAgent, Inc. All rights reserved.
+# https://github.com/openfresh/gosrt
+#
+# Builds the pinned libsrt as a static library for the srtstatic build
+# tag. Usage: scripts/build-libsrt.sh [prefix]
+#
+# The library is installed to prefix (third_party/srt by default); build
+# gosrt against it with
+#
+#   CGO_CFLAGS=-I<prefix>/include CGO_LDFLAGS=-L<prefix>/lib \
+#       go build -tags srtstatic ./...
+
+set -eu
+
+SRT_VERSION=${SRT_VERSION:-v1.4.2}
+PREFIX=${1:-$(pwd)/third_party/srt}
+WORK=$(mktemp -d)
+trap 'rm -rf "$WORK"' EXIT
+
+wget -O "$WORK/srt.tar.gz" "https://github.com/Haivision/srt/archive/$SRT_VERSION.tar.gz"
+mkdir "$WORK/src" "$WORK/build"
+tar -xzf "$WORK/srt.tar.gz" -C "$WORK/src" --strip-components=1
+
+# Linking the OpenSSL archives into libsrt's link line keeps the crypto
+# library out of the binary's runtime dependencies as well.
+cd "$WORK/build"
+cmake "$WORK/src" \
+	-DCMAKE_BUILD_TYPE=Release \
+	-DCMAKE_INSTALL_PREFIX="$PREFIX" \
+	-DCMAKE_INSTALL_LIBDIR=lib \
+	-DENABLE_SHARED=OFF \
+	-DENABLE_STATIC=ON \
+	-DENABLE_APPS=OFF \
+	-DOPENSSL_USE_STATIC_LIBS=ON
+make -j"$(getconf _NPROCESSORS_ONLN 2>/dev/null || echo 2)"
+make install
+
+echo "libsrt $SRT_VERSION installed to $PREFIX"
@@ -0,0 +1,271 @@
+// Copyright (c) 2020 CyberAgent, Inc. All rights reserved.
+// https://github.com/openfresh/gosrt
+
+// Package signaling exchanges the candidates of nat.Traversal through
+// an HTTP service both peers reach, and agrees on the time they start
+// connecting at. The peers of a link post their candidates to the
+// same room URL; the first one waits for the second, and both get the
+// other's candidates:
+//
+//	POST /{room}   {"candidates":[{"type":"srflx","addr":"192.0.2.1:4000"}]}
+//	→ 200          {"candidates":[...],"start_in_ms":500}
+//
+// start_in_ms is relative to the answer, so that the clocks of the
+// peers needn't agree. The Server keeps the rooms in memory and has no
+// access control of its own: rooms are meant to be named after
+// unguessable tokens handed to both peers. Any other channel fits
+// nat.Signaler too; this is the one for peers that have nothing else.
+package signaling
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/openfresh/gosrt/nat"
+)
+
+// Defaults of the Server fields left zero.
+const (
+	DefaultWait       = 30 * time.Second
+	DefaultStartDelay = 500 * time.Millisecond
+)
+
+// maxBody bounds the messages read.
+const maxBody = 64 << 10
+
+// ErrNoPeer is the error of a Client whose peer didn't come to the
+// room in time.
+var ErrNoPeer = errors.New("signaling: no peer in the room")
+
+// A message is the body of requests and responses.
+type message struct {
+	Candidates []candidate `json:"candidates"`
+	StartInMs  int64       `json:"start_in_ms,omitempty"`
+}
+
+type candidate struct {
+	Type nat.CandidateType `json:"type"`
+	Addr string            `json:"addr"`
+}
+
+func encodeCandidates(cands []nat.Candidate) []candidate {
+	cs := make([]candidate, len(cands))
+	for i, c := range cands {
+		cs[i] = candidate{Type: c.Type, Addr: c.Addr.String()}
+	}
+	return cs
+}
+
+func decodeCandidates(cs []candidate) ([]nat.Candidate, error) {
+	cands := make([]nat.Candidate, len(cs))
+	for i, c := range cs {
+		addr, err := parseAddr(c.Addr)
+		if err != nil {
+			return nil, err
+		}
+		cands[i] = nat.Candidate{Type: c.Type, Addr: addr}
+	}
+	return cands, nil
+}
+
+// parseAddr parses an ip:port address, refusing host names, which a
+// peer would have the other resolve.
+func parseAddr(s string) (*net.UDPAddr, error) {
+	host, port, err := net.SplitHostPort(s)
+	if err != nil {
+		return nil, err
+	}
+	ip := net.ParseIP(host)
+	p, err := strconv.Atoi(port)
+	if ip == nil || err != nil || p <= 0 || p > 0xFFFF {
+		return nil, fmt.Errorf("signaling: invalid candidate address %q", s)
+	}
+	return &net.UDPAddr{IP: ip, Port: p}, nil
+}
+
+// A Server is the http.Handler of the rooms. The handler is mounted on
+// any mux, under a prefix stripped with http.StripPrefix.
+type Server struct {
+	// Wait is how long the first peer of a room waits for the
+	// second. Zero means DefaultWait.
+	Wait time.Duration
+
+	// StartDelay is how long after the answers the peers start
+	// connecting, which must cover the time the answers take to
+	// arrive. Zero means DefaultStartDelay.
+	StartDelay time.Duration
+
+	mu    sync.Mutex
+	rooms map[string]*room
+}
+
+// A room holds the candidates of the first peer until the second
+// comes, and hands the first the answer.
+type room struct {
+	offer  []candidate
+	answer chan message
+}
+
+func (s *Server) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	name := strings.Trim(req.URL.Path, "/")
+	if name == "" {
+		http.NotFound(w, req)
+		return
+	}
+	if req.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+		return
+	}
+	var m message
+	b, err := ioutil.ReadAll(http.MaxBytesReader(w, req.Body, maxBody))
+	if err == nil {
+		err = json.Unmarshal(b, &m)
+	}
+	if err == nil {
+		_, err = decodeCandidates(m.Candidates)
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	s.mu.Lock()
+	if s.rooms == nil {
+		s.rooms = make(map[string]*room)
+	}
+	r := s.rooms[name]
+	if r != nil {
+		// The second peer: both get the answers now. The answer is
+		// sent before unlocking, for the first peer to find it once
+		// it sees the room gone.
+		delete(s.rooms, name)
+		start := s.startDelay().Milliseconds()
+		r.answer <- message{Candidates: m.Candidates, StartInMs: start}
+		s.mu.Unlock()
+		writeJSON(w, message{Candidates: r.offer, StartInMs: start})
+		return
+	}
+	r = &room{offer: m.Candidates, answer: make(chan message, 1)}
+	s.rooms[name] = r
+	s.mu.Unlock()
+
+	wait := s.Wait
+	if wait <= 0 {
+		wait = DefaultWait
+	}
+	timer := time.NewTimer(wait)
+	defer timer.Stop()
+	select {
+	case a := <-r.answer:
+		writeJSON(w, a)
+		return
+	case <-timer.C:
+	case <-req.Context().Done():
+	}
+	s.mu.Lock()
+	if s.rooms[name] == r {
+		delete(s.rooms, name)
+	}
+	s.mu.Unlock()
+	select {
+	case a := <-r.answer:
+		// The second peer came meanwhile.
+		writeJSON(w, a)
+	default:
+		http.Error(w, "no peer", http.StatusRequestTimeout)
+	}
+}
+
+func (s *Server) startDelay() time.Duration {
+	if s.StartDelay > 0 {
+		return s.StartDelay
+	}
+	return DefaultStartDelay
+}
+
+func writeJSON(w http.ResponseWriter, v interface{}) {
+	b, err := json.Marshal(v)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(append(b, '\n'))
+}
+
+// A Client is the nat.StartSignaler of a room of a Server.
+type Client struct {
+	// URL is the room, the URL of the Server's handler followed by
+	// the name of the room.
+	URL string
+
+	// HTTPClient makes the requests; nil means http.DefaultClient.
+	// Its Timeout must leave room for the wait of the Server.
+	HTTPClient *http.Client
+}
+
+// Exchange implements the nat.Signaler Exchange method.
+func (c *Client) Exchange(ctx context.Context, local []nat.Candidate) ([]nat.Candidate, error) {
+	remote, _, err := c.ExchangeStart(ctx, local)
+	return remote, err
+}
+
+// ExchangeStart implements the nat.StartSignaler ExchangeStart method.
+// It fails with ErrNoPeer if the peer didn't come in time.
+func (c *Client) ExchangeStart(ctx context.Context, local []nat.Candidate) ([]nat.Candidate, time.Time, error) {
+	b, err := json.Marshal(message{Candidates: encodeCandidates(local)})
+	if err != nil {
+		return nil, time.Time{}, err
+	}
+	req, err := http.NewRequest(http.MethodPost, c.URL, bytes.NewReader(b))
+	if err != nil {
+		return nil, time.Time{}, err
+	}
+	req = req.WithContext(ctx)
+	req.Header.Set("Content-Type", "application/json")
+	hc := c.HTTPClient
+	if hc == nil {
+		hc = http.DefaultClient
+	}
+	resp, err := hc.Do(req)
+	if err != nil {
+		return nil, time.Time{}, err
+	}
+	defer resp.Body.Close()
+	now := time.Now()
+	b, err = ioutil.ReadAll(io.LimitReader(resp.Body, maxBody+1))
+	if err != nil {
+		return nil, time.Time{}, err
+	}
+	if len(b) > maxBody {
+		return nil, time.Time{}, errors.New("signaling: response too large")
+	}
+	switch resp.StatusCode {
+	case http.StatusOK:
+	case http.StatusRequestTimeout:
+		return nil, time.Time{}, ErrNoPeer
+	default:
+		return nil, time.Time{}, fmt.Errorf("signaling: %s: %s", resp.Status, bytes.TrimSpace(b))
+	}
+	var m message
+	if err := json.Unmarshal(b, &m); err != nil {
+		return nil, time.Time{}, fmt.Errorf("signaling: %v", err)
+	}
+	remote, err := decodeCandidates(m.Candidates)
+	if err != nil {
+		return nil, time.Time{}, err
+	}
+	return remote, now.Add(time.Duration(m.StartInMs) * time.Millisecond), nil
+}
@@ -0,0 +1,103 @@
+// Copyright (c) 2020 CyberAgent, Inc. All rights reserved.
+// https://github.com/openfresh/gosrt
+
+package signaling
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/openfresh/gosrt/nat"
+)
+
+func TestExchange(t *testing.T) {
+	s := &Server{StartDelay: 200 * time.Millisecond}
+	ts := httptest.NewServer(s)
+	defer ts.Close()
+
+	a := []nat.Candidate{
+		{Type: nat.Host, Addr: &net.UDPAddr{IP: net.IPv4(10, 0, 0, 1), Port: 4000}},
+		{Type: nat.ServerReflexive, Addr: &net.UDPAddr{IP: net.IPv4(192, 0, 2, 1), Port: 4000}},
+	}
+	b := []nat.Candidate{
+		{Type: nat.ServerReflexive, Addr: &net.UDPAddr{IP: net.ParseIP("2001:db8::2"), Port: 5000}},
+	}
+	type result struct {
+		remote []nat.Candidate
+		start  time.Time
+		err    error
+	}
+	rc := make(chan result, 1)
+	go func() {
+		c := &Client{URL: ts.URL + "/link-1"}
+		remote, start, err := c.ExchangeStart(context.Background(), a)
+		rc <- result{remote, start, err}
+	}()
+	time.Sleep(20 * time.Millisecond)
+	c := &Client{URL: ts.URL + "/link-1"}
+	remote, start, err := c.ExchangeStart(context.Background(), b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	first := <-rc
+	if first.err != nil {
+		t.Fatal(first.err)
+	}
+	if !sameCandidates(remote, a) || !sameCandidates(first.remote, b) {
+		t.Errorf("got %v and %v; want %v and %v", remote, first.remote, a, b)
+	}
+	if d := first.start.Sub(start); d < -50*time.Millisecond || d > 50*time.Millisecond {
+		t.Errorf("start times %v apart", d)
+	}
+	if d := time.Until(start); d <= 0 || d > 200*time.Millisecond {
+		t.Errorf("start in %v; want within 200ms", d)
+	}
+}
+
+func sameCandidates(a, b []nat.Candidate) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i].Type != b[i].Type || a[i].Addr.String() != b[i].Addr.String() {
+			return false
+		}
+	}
+	return true
+}
+
+func TestExchangeErrors(t *testing.T) {
+	ts := httptest.NewServer(&Server{Wait: 20 * time.Millisecond})
+	defer ts.Close()
+
+	c := &Client{URL: ts.URL + "/alone"}
+	if _, err := c.Exchange(context.Background(), nil); err != ErrNoPeer {
+		t.Errorf("got %v alone in the room; want %v", err, ErrNoPeer)
+	}
+
+	for _, tt := range []struct {
+		method, path, body string
+		status             int
+	}{
+		{http.MethodGet, "/room", "", http.StatusMethodNotAllowed},
+		{http.MethodPost, "/", `{"candidates":[]}`, http.StatusNotFound},
+		{http.MethodPost, "/room", `{"candidates":[{"type":"relay","addr":"192.0.2.1:4000"}]}`, http.StatusBadRequest},
+		{http.MethodPost, "/room", `{"candidates":[{"type":"host","addr":"example.com:4000"}]}`, http.StatusBadRequest},
+		{http.MethodPost, "/room", `{`, http.StatusBadRequest},
+	} {
+		req, _ := http.NewRequest(tt.method, ts.URL+tt.path, strings.NewReader(tt.body))
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != tt.status {
+			t.Errorf("%s %s %s: %s; want %d", tt.method, tt.path, tt.body, resp.Status, tt.status)
+		}
+	}
+}
@@ -0,0 +1,120 @@
+// Copyright (c) 2020 CyberAgent, Inc. All rights reserved.
+// https://github.com/openfresh/gosrt
+
+package srt
+
+import (
+	"net"
+	"strconv"
+	"syscall"
+	"time"
+
+	"github.com/openfresh/gosrt/srtapi"
+)
+
+// An AcceptHook decides whether a listener takes the caller at addr
+// asking for streamID, while the handshake is under way, for media
+// servers to route or refuse callers before they are accepted. An
+// error rejects the caller, with the reason of the RejectError it
+// wraps if that is an extended one, RejectXForbidden say, and
+// RejectCallback otherwise. It can set the options of the connection
+// through conn before returning nil.
+type AcceptHook func(addr net.Addr, streamID string, conn PreAcceptConn) error
+
+// PreAcceptConn is the socket of a caller an AcceptHook is deciding
+// on. Its options are set before the handshake is answered, so the
+// options of the handshake, the passphrase and the latency say, can
+// differ from those of the listener. It is only valid until the hook
+// returns.
+type PreAcceptConn struct {
+	s int
+}
+
+// SocketID returns the ID of the SRT socket of the caller.
+func (c PreAcceptConn) SocketID() int {
+	return c.s
+}
+
+// SetOption sets the option of the socket with the given key to
+// value, given as WithOptions takes it. Keys that aren't option names
+// fail with ErrUnknownOption.
+func (c PreAcceptConn) SetOption(key, value string) error {
+	o := lookupOption(key)
+	if o == nil {
+		return ErrUnknownOption
+	}
+	return o.apply(c.s, value)
+}
+
+// GetOption returns the value of the option of the socket with the
+// given key, formatted as WithOptions takes it.
+func (c PreAcceptConn) GetOption(key string) (string, error) {
+	return getOption(c.s, key)
+}
+
+// SetPassphrase sets the passphrase of the connection, "" for an
+// unencrypted one.
+func (c PreAcceptConn) SetPassphrase(passphrase string) error {
+	return srtapi.SetsockoptString(c.s, 0, srtapi.OptionPassphrase, passphrase)
+}
+
+// SetLatency sets the latency of the connection, rounded down to the
+// millisecond as SRT takes it.
+func (c PreAcceptConn) SetLatency(latency time.Duration) error {
+	return c.SetOption("latency", strconv.FormatInt(int64(latency/time.Millisecond), 10))
+}
+
+// SetAcceptHook sets the AcceptHook deciding on the callers of the
+// listener, in place of any set before; nil removes it. The hook runs
+// from the listen callback, once the callbacks and hooks the listener
+// was created with (see WithListenCallback, WithHooks,
+// WithAcceptOptions and WithPassphraseFunc) accepted the caller, so
+// the options it sets win over theirs. It holds up the handshakes of
+// the listener, and should answer quickly. It needs
+// srtapi.FeatureListenCallback.
+func (l *SRTListener) SetAcceptHook(hook AcceptHook) error {
+	if !l.ok() {
+		return srtapi.EINVPARAM
+	}
+	if err := l.fd.setAcceptHook(hook); err != nil {
+		return &OpError{Op: "set", Net: l.fd.net, Source: nil, Addr: l.fd.laddr, Err: err}
+	}
+	return nil
+}
+
+// setAcceptHook sets the hook of the listener fd, and installs its
+// listen callback if the listener had none.
+func (fd *netFD) setAcceptHook(hook AcceptHook) error {
+	fd.hookmu.Lock()
+	defer fd.hookmu.Unlock()
+	if !fd.listenInstalled {
+		if err := fd.listenCallback(fd.listenCb); err != nil {
+			return err
+		}
+		fd.listenInstalled = true
+	}
+	fd.acceptHook.Store(hook)
+	return nil
+}
+
+// acceptHookCallback returns the listen callback running the hook of
+// fd, if any, on each caller callback accepts.
+func (fd *netFD) acceptHookCallback(callback srtapi.SrtListenCallbackFunc) srtapi.SrtListenCallbackFunc {
+	return func(ns, hsversion int, peer syscall.Sockaddr, streamid string) int {
+		ret := 0
+		if callback != nil {
+			if ret = callback(ns, hsversion, peer, streamid); ret < 0 {
+				return ret
+			}
+		}
+		hook, _ := fd.acceptHook.Load().(AcceptHook)
+		if hook == nil {
+			return ret
+		}
+		if err := hook(sockaddrToSRT(peer), streamid, PreAcceptConn{s: ns}); err != nil {
+			setRejectReason(ns, err)
+			return -1
+		}
+		return ret
+	}
+}
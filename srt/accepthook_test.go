@@ -0,0 +1,78 @@
+// Copyright (c) 2020 CyberAgent, Inc. All rights reserved.
+// https://github.com/openfresh/gosrt
+
+package srt
+
+import (
+	"context"
+	"errors"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/openfresh/gosrt/srtapi"
+)
+
+func TestAcceptHook(t *testing.T) {
+	if !srtapi.Has(srtapi.FeatureRejectReason) {
+		t.Skip("no reject reasons in listen callbacks")
+	}
+	ln, err := listenSRT(context.Background(), "srt4", &SRTAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	raddr := ln.fd.laddr.(*SRTAddr)
+
+	hooked := make(chan string, 4)
+	err = ln.SetAcceptHook(func(addr net.Addr, streamID string, conn PreAcceptConn) error {
+		hooked <- streamID
+		switch streamID {
+		case "deny":
+			return &RejectError{Reason: RejectXForbidden}
+		case "slow":
+			return conn.SetLatency(400 * time.Millisecond)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dial := func(streamID string) (*SRTConn, error) {
+		return dialSRT(WithOptions(context.Background(), Options("streamid", streamID)), "srt4", nil, raddr)
+	}
+	_, err = dial("deny")
+	var rerr *RejectError
+	if !errors.As(err, &rerr) || rerr.Reason != RejectXForbidden {
+		t.Fatalf("got %v; want a rejection for %v", err, RejectXForbidden)
+	}
+
+	c, err := dial("slow")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	ln.SetDeadline(time.Now().Add(someTimeout))
+	p, err := ln.accept()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer p.Close()
+	if v, err := p.GetOption("rcvlatency"); err != nil || v != "400" {
+		t.Errorf("got rcvlatency %s, %v; want 400", v, err)
+	}
+	if got := []string{<-hooked, <-hooked}; got[0] != "deny" || got[1] != "slow" {
+		t.Errorf("hook called for %v", got)
+	}
+
+	// Removing the hook lets every caller in.
+	if err := ln.SetAcceptHook(nil); err != nil {
+		t.Fatal(err)
+	}
+	c, err = dial("deny")
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.Close()
+}
@@ -0,0 +1,81 @@
+// Copyright (c) 2020 CyberAgent, Inc. All rights reserved.
+// https://github.com/openfresh/gosrt
+
+package srt
+
+import (
+	"context"
+	"net"
+	"syscall"
+
+	"github.com/openfresh/gosrt/srtapi"
+)
+
+// AcceptOptionsFunc returns the options of the connection a listener
+// is about to accept from peer for streamID, on top of those the
+// listener was created with. It lets one port take callers of
+// different kinds, live streams and file pushes say, by returning
+// StreamOptions for the stream IDs of the latter.
+type AcceptOptionsFunc func(ctx context.Context, peer net.Addr, streamID string) (OptionSet, error)
+
+// acceptOptionsContextKey is the type of contextKeys used for
+// AcceptOptionsFunc.
+type acceptOptionsContextKey struct{}
+
+// WithAcceptOptions returns a new context.Context with the
+// AcceptOptionsFunc choosing the options of each connection of the
+// listeners created with it.
+//
+// The listener calls fn from its listen callback, after any callback
+// set with WithListenCallback and the BeforeHandshake hooks accepted
+// the peer, and before the PassphraseFunc; an error rejects the peer,
+// as it does for BeforeHandshake.
+// The options are set on the new socket before the handshake is
+// answered, so transtype and the options it implies, messageapi,
+// tsbpdmode, tlpktdrop and payloadsize, can differ from those of the
+// listener; the accepted connection's StreamMode reports its own.
+// Options the socket refuses are ignored, as those of WithOptions are:
+// the pure Go implementation keeps file pushes in live mode. Listeners
+// need srtapi.FeatureListenCallback.
+func WithAcceptOptions(ctx context.Context, fn AcceptOptionsFunc) context.Context {
+	return context.WithValue(ctx, acceptOptionsContextKey{}, fn)
+}
+
+func acceptOptionsValue(ctx context.Context) AcceptOptionsFunc {
+	fn, _ := ctx.Value(acceptOptionsContextKey{}).(AcceptOptionsFunc)
+	return fn
+}
+
+// acceptOptionsCallback returns the listen callback setting the
+// options fn returns on each socket callback accepts.
+func acceptOptionsCallback(ctx context.Context, callback srtapi.SrtListenCallbackFunc, fn AcceptOptionsFunc) srtapi.SrtListenCallbackFunc {
+	return func(ns, hsversion int, peer syscall.Sockaddr, streamid string) int {
+		ret := 0
+		if callback != nil {
+			if ret = callback(ns, hsversion, peer, streamid); ret < 0 {
+				return ret
+			}
+		}
+		options, err := fn(ctx, sockaddrToSRT(peer), streamid)
+		if err != nil {
+			setRejectReason(ns, err)
+			return -1
+		}
+		configureAll(options, ns)
+		return ret
+	}
+}
+
+// configureAll sets options on s whatever their binding, in the order
+// of srtOptions, so that transtype comes before the options it resets.
+func configureAll(options OptionSet, s int) {
+	m := make(optionMap)
+	for _, o := range options.list {
+		m[o.key] = o.value
+	}
+	for _, o := range srtOptions {
+		if v, ok := m[o.name]; ok {
+			o.apply(s, v)
+		}
+	}
+}
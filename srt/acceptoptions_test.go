@@ -0,0 +1,68 @@
+// Copyright (c) 2020 CyberAgent, Inc. All rights reserved.
+// https://github.com/openfresh/gosrt
+
+package srt
+
+import (
+	"context"
+	"errors"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/openfresh/gosrt/srtapi"
+)
+
+func TestAcceptOptions(t *testing.T) {
+	if !srtapi.Has(srtapi.FeatureListenCallback) {
+		t.Skip("no listen callbacks")
+	}
+	ctx := WithAcceptOptions(context.Background(), func(_ context.Context, _ net.Addr, streamID string) (OptionSet, error) {
+		switch streamID {
+		case "push":
+			return StreamOptions(), nil
+		case "deny":
+			return OptionSet{}, errors.New("denied")
+		}
+		return OptionSet{}, nil
+	})
+	ln, err := listenSRT(ctx, "srt4", &SRTAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	raddr := ln.fd.laddr.(*SRTAddr)
+
+	for _, tt := range []struct {
+		streamID   string
+		options    OptionSet
+		messageAPI int
+	}{
+		{"live", OptionSet{}, 1},
+		{"push", StreamOptions(), 0},
+	} {
+		dctx := WithOptions(WithOptions(context.Background(), tt.options), Options("streamid", tt.streamID))
+		c, err := dialSRT(dctx, "srt4", nil, raddr)
+		if err != nil {
+			t.Fatalf("%s: %v", tt.streamID, err)
+		}
+		defer c.Close()
+		ln.SetDeadline(time.Now().Add(someTimeout))
+		p, err := ln.accept()
+		if err != nil {
+			t.Fatalf("%s: %v", tt.streamID, err)
+		}
+		defer p.Close()
+		if v, err := srtapi.GetsockflagInt(p.fd.pfd.Sysfd, srtapi.OptionMessageapi); err != nil || v != tt.messageAPI {
+			t.Errorf("%s: messageapi %d, %v; want %d", tt.streamID, v, err, tt.messageAPI)
+		}
+		if p.StreamMode() != c.StreamMode() {
+			t.Errorf("%s: accepted StreamMode %v; caller's %v", tt.streamID, p.StreamMode(), c.StreamMode())
+		}
+	}
+
+	if c, err := dialSRT(WithOptions(context.Background(), Options("streamid", "deny")), "srt4", nil, raddr); err == nil {
+		c.Close()
+		t.Error("dial denied by the AcceptOptionsFunc succeeded")
+	}
+}
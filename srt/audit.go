@@ -0,0 +1,204 @@
+// Copyright (c) 2020 CyberAgent, Inc. All rights reserved.
+// https://github.com/openfresh/gosrt
+
+package srt
+
+import (
+	"context"
+	"errors"
+	"net"
+	"syscall"
+	"time"
+
+	"github.com/openfresh/gosrt/srtapi"
+)
+
+// Ciphers reported by HandshakeAttempt.
+const (
+	CipherAESCTR = "AES-CTR"
+	CipherAESGCM = "AES-GCM"
+)
+
+// HandshakeAttempt is an audit record of an SRT handshake, as
+// delivered by the AuditFunc of WithAudit.
+type HandshakeAttempt struct {
+	Time     time.Time
+	Local    net.Addr
+	Peer     net.Addr
+	StreamID string
+
+	// Caller reports whether this side dialed. Otherwise the
+	// attempt was seen by a listener.
+	Caller bool
+
+	// Accepted reports whether the connection was established and,
+	// on a listener, passed its EncryptionPolicy. Otherwise Reason
+	// tells why not, and Detail gives any further explanation.
+	Accepted bool
+	Reason   RejectReason
+	Detail   string
+
+	// KeyLength is the length in bytes of the negotiated key, 0 if
+	// the connection isn't encrypted, and Cipher its cipher.
+	KeyLength int
+	Cipher    string
+
+	// Labels are those of the connection, or of the listener for
+	// the peers it turned down.
+	Labels Labels
+}
+
+// KeyValues returns the attempt as alternating keys and values, in
+// the form structured loggers such as log/slog take, the labels last.
+// Time is left out, the logger stamping its own.
+func (a HandshakeAttempt) KeyValues() []interface{} {
+	kv := []interface{}{
+		"local", addrString(a.Local),
+		"peer", addrString(a.Peer),
+		"streamid", a.StreamID,
+		"caller", a.Caller,
+		"accepted", a.Accepted,
+	}
+	if !a.Accepted {
+		kv = append(kv, "reason", a.Reason.String())
+		if a.Detail != "" {
+			kv = append(kv, "detail", a.Detail)
+		}
+	}
+	if a.KeyLength > 0 {
+		kv = append(kv, "keylen", a.KeyLength, "cipher", a.Cipher)
+	}
+	return append(kv, a.Labels.keyValues()...)
+}
+
+// AuditFunc receives the HandshakeAttempt records of WithAudit.
+type AuditFunc func(HandshakeAttempt)
+
+// AuditLogger is the part of a structured logger AuditLog needs;
+// *slog.Logger satisfies it.
+type AuditLogger interface {
+	Info(msg string, args ...interface{})
+}
+
+// AuditLog returns an AuditFunc logging each attempt to l.
+func AuditLog(l AuditLogger) AuditFunc {
+	return func(a HandshakeAttempt) {
+		l.Info("srt handshake", a.KeyValues()...)
+	}
+}
+
+// auditContextKey is the type of contextKeys used for AuditFunc.
+type auditContextKey struct{}
+
+// WithAudit returns a new context.Context with the AuditFunc recording
+// the handshakes of the listeners and dials made with it.
+//
+// Dials record their outcome once the handshake ends. Listeners
+// record the peers their listen callback (see WithListenCallback)
+// turns down, from the SRT library's thread, and every connection
+// Accept takes, from the goroutine calling Accept. SRT rejects peers
+// with a wrong passphrase by itself, after the listen callback ran,
+// so only their caller records those.
+func WithAudit(ctx context.Context, audit AuditFunc) context.Context {
+	return context.WithValue(ctx, auditContextKey{}, audit)
+}
+
+func auditValue(ctx context.Context) AuditFunc {
+	audit, _ := ctx.Value(auditContextKey{}).(AuditFunc)
+	return audit
+}
+
+// auditListenCallback wraps the listen callback of fd to record the
+// peers it rejects.
+func (fd *netFD) auditListenCallback(callback srtapi.SrtListenCallbackFunc, audit AuditFunc) srtapi.SrtListenCallbackFunc {
+	return func(ns, hsversion int, peer syscall.Sockaddr, streamid string) int {
+		ret := callback(ns, hsversion, peer, streamid)
+		if ret < 0 {
+			reason := RejectReason(srtapi.GetRejectReason(ns))
+			if reason < RejectCallback {
+				reason = RejectCallback
+			}
+			audit(HandshakeAttempt{
+				Time:     time.Now(),
+				Local:    fd.laddr,
+				Peer:     sockaddrToSRT(peer),
+				StreamID: streamid,
+				Reason:   reason,
+				Labels:   fd.getLabels(),
+			})
+		}
+		return ret
+	}
+}
+
+// auditAccept records the connection fd a listener accepted, and the
+// decision of its EncryptionPolicy, if any.
+func (fd *netFD) auditAccept(audit AuditFunc, d *EncryptionDecision) {
+	a := fd.attempt(false)
+	if d != nil && !d.Accepted {
+		a.Accepted = false
+		a.Reason = RejectPolicy
+		a.Detail = d.Reason
+	}
+	audit(a)
+}
+
+// auditDial records the outcome err of dialing raddr.
+func (fd *netFD) auditDial(ctx context.Context, raddr net.Addr, err error) {
+	audit := auditValue(ctx)
+	if audit == nil {
+		return
+	}
+	if err == nil {
+		audit(fd.attempt(true))
+		return
+	}
+	a := HandshakeAttempt{Time: time.Now(), Peer: raddr, Caller: true, Detail: err.Error(), Labels: fd.getLabels()}
+	a.StreamID, _ = srtapi.GetsockflagString(fd.pfd.Sysfd, srtapi.OptionStreamid)
+	var rerr *RejectError
+	if errors.As(err, &rerr) {
+		a.Reason = rerr.Reason
+		a.Detail = ""
+	} else if errors.Is(err, context.DeadlineExceeded) {
+		a.Reason = RejectTimeout
+	}
+	audit(a)
+}
+
+// attempt returns the record of the established connection fd.
+func (fd *netFD) attempt(caller bool) HandshakeAttempt {
+	a := HandshakeAttempt{
+		Time:     time.Now(),
+		Local:    fd.laddr,
+		Peer:     fd.raddr,
+		Caller:   caller,
+		Accepted: true,
+		Labels:   fd.getLabels(),
+	}
+	a.StreamID, _ = srtapi.GetsockflagString(fd.pfd.Sysfd, srtapi.OptionStreamid)
+	a.KeyLength, a.Cipher = negotiatedCrypto(fd.pfd.Sysfd)
+	return a
+}
+
+// negotiatedCrypto returns the key length and cipher of the connected
+// socket s, 0 and "" if it isn't encrypted.
+func negotiatedCrypto(s int) (int, string) {
+	km, err := getsockoptIntFunc(s, 0, srtapi.OptionKmstate)
+	if err != nil || km != srtapi.KmStateSecured {
+		return 0, ""
+	}
+	keyLen, _ := getsockoptIntFunc(s, 0, srtapi.OptionPbkeylen)
+	if srtapi.Has(srtapi.FeatureCryptoMode) {
+		if mode, _ := getsockoptIntFunc(s, 0, srtapi.OptionCryptomode); mode == cryptoModeGCM {
+			return keyLen, CipherAESGCM
+		}
+	}
+	return keyLen, CipherAESCTR
+}
+
+func addrString(a net.Addr) string {
+	if a == nil {
+		return ""
+	}
+	return a.String()
+}
@@ -0,0 +1,98 @@
+// Copyright (c) 2020 CyberAgent, Inc. All rights reserved.
+// https://github.com/openfresh/gosrt
+
+package srt
+
+import (
+	"context"
+	"fmt"
+	"syscall"
+	"testing"
+
+	"github.com/openfresh/gosrt/srtapi"
+)
+
+func TestAudit(t *testing.T) {
+	if !srtapi.Has(srtapi.FeatureListenCallback) {
+		t.Skip("SRT library lacks listen callbacks")
+	}
+	listened := make(chan HandshakeAttempt, 2)
+	ctx := WithAudit(context.Background(), func(a HandshakeAttempt) { listened <- a })
+	ctx = WithListenCallback(ctx, func(ns, hsversion int, peer syscall.Sockaddr, streamid string) int {
+		if streamid == "deny" {
+			return -1
+		}
+		return 0
+	})
+	ctx = WithOptions(ctx, Options("passphrase", "0123456789abcdef"))
+	ln, err := ListenContext(ctx, "srt4", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+
+	dialed := make(chan HandshakeAttempt, 2)
+	ctx = WithAudit(context.Background(), func(a HandshakeAttempt) { dialed <- a })
+	ctx = WithOptions(ctx, Options("passphrase", "0123456789abcdef", "pbkeylen", "32"))
+	var d Dialer
+	if c, err := d.DialContext(WithOptions(ctx, Options("streamid", "deny")), "srt", ln.Addr().String()); err == nil {
+		c.Close()
+		t.Fatal("dial succeeded; want it rejected by the listen callback")
+	}
+	c, err := d.DialContext(WithOptions(ctx, Options("streamid", "allow")), "srt", ln.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	a, err := ln.Accept()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer a.Close()
+
+	rejected, accepted := <-listened, <-listened
+	if rejected.Caller || rejected.Accepted || rejected.StreamID != "deny" || rejected.Reason != RejectCallback {
+		t.Errorf("got %+v; want the listen callback rejecting stream deny", rejected)
+	}
+	if accepted.Caller || !accepted.Accepted || accepted.StreamID != "allow" || accepted.KeyLength != 32 || accepted.Cipher == "" {
+		t.Errorf("got %+v; want stream allow accepted with a 32-byte key", accepted)
+	}
+	if ua, _ := c.(*SRTConn).UDPAddr(); accepted.Peer == nil || accepted.Peer.String() != ua.String() {
+		t.Errorf("got peer %v; want %v", accepted.Peer, ua)
+	}
+
+	failed, ok := <-dialed, <-dialed
+	if !failed.Caller || failed.Accepted || failed.StreamID != "deny" {
+		t.Errorf("got %+v; want the dial of stream deny failed", failed)
+	}
+	if !ok.Caller || !ok.Accepted || ok.StreamID != "allow" || ok.KeyLength != 32 {
+		t.Errorf("got %+v; want the dial of stream allow established with a 32-byte key", ok)
+	}
+	if ok.Local == nil || ok.Local.String() != c.LocalAddr().String() {
+		t.Errorf("got local %v; want %v", ok.Local, c.LocalAddr())
+	}
+}
+
+type auditLogger []string
+
+func (l *auditLogger) Info(msg string, args ...interface{}) {
+	*l = append(*l, fmt.Sprint(append([]interface{}{msg}, args...)...))
+}
+
+func TestAuditLog(t *testing.T) {
+	var l auditLogger
+	AuditLog(&l)(HandshakeAttempt{StreamID: "feed", Reason: RejectBadSecret})
+	AuditLog(&l)(HandshakeAttempt{StreamID: "feed", Caller: true, Accepted: true, KeyLength: 16, Cipher: CipherAESCTR})
+	want := []string{
+		fmt.Sprint("srt handshake", "local", "", "peer", "", "streamid", "feed", "caller", false, "accepted", false, "reason", RejectBadSecret.String()),
+		fmt.Sprint("srt handshake", "local", "", "peer", "", "streamid", "feed", "caller", true, "accepted", true, "keylen", 16, "cipher", CipherAESCTR),
+	}
+	if len(l) != len(want) {
+		t.Fatalf("got %d records; want %d", len(l), len(want))
+	}
+	for i := range want {
+		if l[i] != want[i] {
+			t.Errorf("#%d: got %q; want %q", i, l[i], want[i])
+		}
+	}
+}
@@ -0,0 +1,76 @@
+// Copyright (c) 2020 CyberAgent, Inc. All rights reserved.
+// https://github.com/openfresh/gosrt
+
+package srt
+
+import (
+	"context"
+	"time"
+
+	"github.com/openfresh/gosrt/internal/poll/runtime"
+	"github.com/openfresh/gosrt/srtapi"
+)
+
+// backpressurePoll is the interval at which a BackpressureWriter
+// checks the send buffer while it waits. libsrt has no event for the
+// buffer draining below a level.
+var backpressurePoll = 5 * time.Millisecond
+
+// A BackpressureWriter writes to a connection, waiting before each
+// write while the send buffer holds more than its watermark, so that a
+// file pusher sends at the rate of the link: a plain Write only blocks
+// once the buffer is full, which in live mode means the data already
+// queued waits longer than the latency, and is dropped.
+type BackpressureWriter struct {
+	c         *SRTConn
+	watermark int
+}
+
+// NewBackpressureWriter returns a BackpressureWriter writing to c,
+// waiting while more than watermark bytes are in the send buffer, or
+// half the buffer if watermark is 0.
+func NewBackpressureWriter(c *SRTConn, watermark int) *BackpressureWriter {
+	return &BackpressureWriter{c: c, watermark: watermark}
+}
+
+// Write waits for the send buffer to drain below the watermark, then
+// writes b. It waits until the connection is closed or fails, whatever
+// its write deadline, which applies to the write itself.
+func (w *BackpressureWriter) Write(b []byte) (int, error) {
+	return w.WriteContext(context.Background(), b)
+}
+
+// WriteContext is like Write, but stops waiting once ctx is done.
+func (w *BackpressureWriter) WriteContext(ctx context.Context, b []byte) (int, error) {
+	if !w.c.ok() {
+		return 0, srtapi.EINVPARAM
+	}
+	if err := w.wait(ctx); err != nil {
+		return 0, &OpError{Op: "write", Net: w.c.fd.net, Source: w.c.fd.laddr, Addr: w.c.fd.raddr, Err: err}
+	}
+	return w.c.WriteContext(ctx, b)
+}
+
+func (w *BackpressureWriter) wait(ctx context.Context) error {
+	for {
+		st, err := w.c.fd.sendState()
+		if err != nil {
+			return err
+		}
+		limit := w.watermark
+		if limit <= 0 {
+			limit = (st.BufferedBytes + st.AvailableBytes) / 2
+		}
+		if st.BufferedBytes <= limit {
+			return nil
+		}
+		wake := make(chan struct{})
+		t := runtime.Clock.AfterFunc(backpressurePoll, func() { close(wake) })
+		select {
+		case <-ctx.Done():
+			t.Stop()
+			return mapErr(ctx.Err())
+		case <-wake:
+		}
+	}
+}
@@ -0,0 +1,131 @@
+// Copyright (c) 2020 CyberAgent, Inc. All rights reserved.
+// https://github.com/openfresh/gosrt
+
+package srt
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/openfresh/gosrt/srtapi"
+)
+
+func TestBackpressureWriter(t *testing.T) {
+	c1, c2, err := Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c1.Close()
+	defer c2.Close()
+
+	// The buffer drains over the first calls.
+	var mu sync.Mutex
+	fill := []int{9000, 7000, 5001, 5000}
+	calls := 0
+	defer func(f func(int) (srtapi.SendState, error)) { getSendStateFunc = f }(getSendStateFunc)
+	getSendStateFunc = func(s int) (srtapi.SendState, error) {
+		mu.Lock()
+		defer mu.Unlock()
+		st := srtapi.SendState{BufferedBytes: fill[0], AvailableBytes: 10000 - fill[0]}
+		if len(fill) > 1 {
+			fill = fill[1:]
+		}
+		calls++
+		return st, nil
+	}
+
+	w := NewBackpressureWriter(c1, 5000)
+	if _, err := w.Write([]byte("paced")); err != nil {
+		t.Fatal(err)
+	}
+	if calls != 4 {
+		t.Errorf("checked the buffer %d times; want 4", calls)
+	}
+	b := make([]byte, 1500)
+	c2.SetReadDeadline(time.Now().Add(someTimeout))
+	if n, err := c2.Read(b); err != nil || string(b[:n]) != "paced" {
+		t.Errorf("got %q, %v", b[:n], err)
+	}
+
+	// Half the buffer by default: 5000 of 10000.
+	mu.Lock()
+	fill = []int{6000}
+	mu.Unlock()
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	_, err = NewBackpressureWriter(c1, 0).WriteContext(ctx, []byte("stuck"))
+	if nerr, ok := err.(*OpError); !ok || !nerr.Timeout() {
+		t.Errorf("got %v with a full buffer; want a timeout", err)
+	}
+
+	// A connection breaking while waiting.
+	mu.Lock()
+	fill, calls = []int{9000}, 0
+	mu.Unlock()
+	defer func(f func(int) int) { getsockstateFunc = f }(getsockstateFunc)
+	getsockstateFunc = func(s int) int {
+		mu.Lock()
+		defer mu.Unlock()
+		if calls > 4 {
+			return srtapi.StatusBroken
+		}
+		return srtapi.StatusConnected
+	}
+	ctx, cancel = context.WithTimeout(context.Background(), someTimeout)
+	defer cancel()
+	if _, err := w.WriteContext(ctx, []byte("broken")); !errors.Is(err, srtapi.ECONNLOST) {
+		t.Errorf("got %v on a broken connection; want %v", err, srtapi.ECONNLOST)
+	}
+
+	c1.Close()
+	if _, err := w.Write([]byte("closed")); !errors.Is(err, ErrClosed) {
+		t.Errorf("got %v on a closed connection; want %v", err, ErrClosed)
+	}
+}
+
+func TestBackpressureWriterLink(t *testing.T) {
+	c1, c2, err := Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c1.Close()
+	defer c2.Close()
+
+	const messages = 200
+	done := make(chan error, 1)
+	go func() {
+		b := make([]byte, 1500)
+		for i := 0; i < messages; i++ {
+			if _, err := c2.Read(b); err != nil {
+				done <- err
+				return
+			}
+		}
+		done <- nil
+	}()
+	w := NewBackpressureWriter(c1, 4*1316)
+	b := make([]byte, 1316)
+	for i := 0; i < messages; i++ {
+		if _, err := w.Write(b); err != nil {
+			t.Fatal(err)
+		}
+		st, err := srtapi.GetSendState(c1.fd.pfd.Sysfd)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if st.BufferedBytes > 6*1316 {
+			t.Fatalf("%d bytes buffered; want at most about 5 messages", st.BufferedBytes)
+		}
+	}
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(someTimeout):
+		t.Fatal("messages not received")
+	}
+}
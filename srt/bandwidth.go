@@ -0,0 +1,92 @@
+// Copyright (c) 2020 CyberAgent, Inc. All rights reserved.
+// https://github.com/openfresh/gosrt
+
+package srt
+
+import (
+	"errors"
+
+	"github.com/openfresh/gosrt/srtapi"
+)
+
+// Special values of SetMaxBandwidth.
+const (
+	// BandwidthUnlimited lifts the limit on the send bandwidth.
+	BandwidthUnlimited int64 = -1
+
+	// BandwidthRelative limits the send bandwidth to the input rate,
+	// as set with SetInputBandwidth or else estimated, plus the
+	// overhead of the "oheadbw" option.
+	BandwidthRelative int64 = 0
+)
+
+// ErrBandwidthNotApplied is the error, wrapped in an OpError, of
+// SetMaxBandwidth and SetInputBandwidth when the SRT library reports
+// another value than the one set.
+var ErrBandwidthNotApplied = errors.New("bandwidth setting not applied")
+
+// SetMaxBandwidth changes the maximum send bandwidth of the connection,
+// in bytes per second, as the "maxbw" option sets it once connected,
+// so that a stream can be throttled during congestion without being
+// reconnected. The pure Go implementation paces its sending to it too,
+// with its built-in congestion controls.
+func (c *conn) SetMaxBandwidth(bps int64) error {
+	return c.setBandwidth(srtapi.OptionMaxbw, bps, BandwidthUnlimited)
+}
+
+// SetInputBandwidth changes the input rate of the connection, in bytes
+// per second, that the send bandwidth is relative to with
+// BandwidthRelative; 0 has it estimated from the writes.
+func (c *conn) SetInputBandwidth(bps int64) error {
+	return c.setBandwidth(srtapi.OptionInputbw, bps, 0)
+}
+
+// MaxBandwidth returns the maximum send bandwidth of the connection,
+// in bytes per second, or one of BandwidthUnlimited and
+// BandwidthRelative.
+func (c *conn) MaxBandwidth() (int64, error) {
+	return c.bandwidth(srtapi.OptionMaxbw)
+}
+
+// InputBandwidth returns the input rate set for the connection, in
+// bytes per second, 0 if it is estimated.
+func (c *conn) InputBandwidth() (int64, error) {
+	return c.bandwidth(srtapi.OptionInputbw)
+}
+
+// setBandwidth sets the option opt to bps, no less than min, and reads
+// it back to check that the library took it.
+func (c *conn) setBandwidth(opt int, bps, min int64) error {
+	if !c.ok() {
+		return srtapi.EINVPARAM
+	}
+	if bps < min {
+		return c.bandwidthError(srtapi.EINVPARAM)
+	}
+	if err := srtapi.SetsockflagInt64(c.fd.pfd.Sysfd, opt, bps); err != nil {
+		return c.bandwidthError(err)
+	}
+	v, err := srtapi.GetsockflagInt64(c.fd.pfd.Sysfd, opt)
+	if err != nil {
+		return c.bandwidthError(err)
+	}
+	if v != bps {
+		return c.bandwidthError(ErrBandwidthNotApplied)
+	}
+	return nil
+}
+
+func (c *conn) bandwidth(opt int) (int64, error) {
+	if !c.ok() {
+		return 0, srtapi.EINVPARAM
+	}
+	v, err := srtapi.GetsockflagInt64(c.fd.pfd.Sysfd, opt)
+	if err != nil {
+		return 0, &OpError{Op: "get", Net: c.fd.net, Source: nil, Addr: c.fd.laddr, Err: err}
+	}
+	return v, nil
+}
+
+func (c *conn) bandwidthError(err error) error {
+	return &OpError{Op: "set", Net: c.fd.net, Source: nil, Addr: c.fd.laddr, Err: err}
+}
@@ -0,0 +1,53 @@
+// Copyright (c) 2020 CyberAgent, Inc. All rights reserved.
+// https://github.com/openfresh/gosrt
+
+package srt
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/openfresh/gosrt/srtapi"
+)
+
+func TestSetMaxBandwidth(t *testing.T) {
+	c1, c2, err := Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c1.Close()
+	defer c2.Close()
+
+	for _, bps := range []int64{1 << 20, BandwidthRelative, BandwidthUnlimited} {
+		if err := c1.SetMaxBandwidth(bps); err != nil {
+			t.Fatalf("SetMaxBandwidth(%d): %v", bps, err)
+		}
+		if v, err := c1.MaxBandwidth(); err != nil || v != bps {
+			t.Errorf("got %d, %v; want %d", v, err, bps)
+		}
+	}
+	if err := c1.SetInputBandwidth(500000); err != nil {
+		t.Fatal(err)
+	}
+	if v, err := c1.InputBandwidth(); err != nil || v != 500000 {
+		t.Errorf("got an input bandwidth of %d, %v; want 500000", v, err)
+	}
+
+	if err := c1.SetMaxBandwidth(-2); !errors.Is(err, srtapi.EINVPARAM) {
+		t.Errorf("got %v for a negative bandwidth; want %v", err, srtapi.EINVPARAM)
+	}
+	if err := c1.SetInputBandwidth(-1); !errors.Is(err, srtapi.EINVPARAM) {
+		t.Errorf("got %v for a negative input bandwidth; want %v", err, srtapi.EINVPARAM)
+	}
+
+	// The connection carries on.
+	if _, err := c1.Write([]byte("throttled")); err != nil {
+		t.Fatal(err)
+	}
+	b := make([]byte, 1500)
+	c2.SetReadDeadline(time.Now().Add(someTimeout))
+	if n, err := c2.Read(b); err != nil || string(b[:n]) != "throttled" {
+		t.Errorf("got %q, %v", b[:n], err)
+	}
+}
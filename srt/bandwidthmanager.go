@@ -0,0 +1,334 @@
+// Copyright (c) 2020 CyberAgent, Inc. All rights reserved.
+// https://github.com/openfresh/gosrt
+
+package srt
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/openfresh/gosrt/internal/poll/runtime"
+	"github.com/openfresh/gosrt/srtapi"
+)
+
+// DefaultBandwidthInterval is the interval of the rebalancing of a
+// BandwidthManager run with an interval of 0.
+const DefaultBandwidthInterval = time.Second
+
+// DefaultMinBandwidth is the least send bandwidth, in bytes per second,
+// that a BandwidthManager with no Min leaves a connection.
+const DefaultMinBandwidth = 16000
+
+// bandwidthHeadroom is how much more than it sends a connection is
+// allowed, for its demand to show when it grows.
+const bandwidthHeadroom = 1.25
+
+// A BandwidthManager holds the output of its connections to a global
+// limit, as a relay on a constrained uplink needs, by setting the
+// maxbw of each as its priority gives: the connections of the highest
+// priority get the bandwidth they use first, those of the next one
+// what is left, and so on, so that low priority streams degrade first
+// rather than all of them alike. Connections of the same priority
+// share what is left to them evenly, short of what they use.
+//
+// The bandwidth a connection uses is measured from its statistics, as
+// sent on the wire, retransmissions included, as maxbw counts it. The
+// bandwidth the connections are given beyond what they use is shared
+// between them all, for their demand to show.
+//
+// The connections are added with Add, or with a context carrying the
+// manager (see WithBandwidthManager), and leave it at the rebalancing
+// after they are closed. Run rebalances the bandwidth as they go.
+type BandwidthManager struct {
+	mu     sync.Mutex
+	limit  int64
+	min    int64
+	shares map[*SRTConn]*bandwidthShare
+}
+
+type bandwidthShare struct {
+	c        *SRTConn
+	priority int
+	restore  int64 // the maxbw before Add
+
+	sent  int64     // bytes sent at the last rebalancing
+	at    time.Time // of the last rebalancing, zero before the first
+	rate  float64   // bytes per second since the one before
+	max   int64     // the maxbw set, 0 before the first
+	alloc float64
+}
+
+// A BandwidthUsage is the bandwidth a connection of a BandwidthManager
+// uses, and the one it is given, in bytes per second.
+type BandwidthUsage struct {
+	Conn     *SRTConn
+	Priority int
+	Rate     int64 // measured over the last interval
+	Max      int64 // the maxbw set, 0 before the first rebalancing
+}
+
+// NewBandwidthManager returns a BandwidthManager holding its
+// connections to limit bytes per second, none if limit is 0.
+func NewBandwidthManager(limit int64) *BandwidthManager {
+	return &BandwidthManager{limit: limit, shares: make(map[*SRTConn]*bandwidthShare)}
+}
+
+// bandwidthManagerContextKey is the type of contextKeys used for
+// BandwidthManager.
+type bandwidthManagerContextKey struct{}
+
+// bandwidthPriorityContextKey is the type of contextKeys used for
+// bandwidth priorities.
+type bandwidthPriorityContextKey struct{}
+
+// WithBandwidthManager returns a new context.Context with the
+// BandwidthManager taking the connections dialed or accepted with it,
+// at the priority of WithBandwidthPriority, 0 without it. SetPriority
+// changes the priority of a connection accepted, once its stream ID
+// tells what it is.
+func WithBandwidthManager(ctx context.Context, m *BandwidthManager) context.Context {
+	return context.WithValue(ctx, bandwidthManagerContextKey{}, m)
+}
+
+// WithBandwidthPriority returns a new context.Context with priority
+// the priority of the connections its BandwidthManager takes.
+func WithBandwidthPriority(ctx context.Context, priority int) context.Context {
+	return context.WithValue(ctx, bandwidthPriorityContextKey{}, priority)
+}
+
+// addToBandwidthManager adds c to the BandwidthManager of ctx, if any.
+func addToBandwidthManager(ctx context.Context, c *SRTConn) error {
+	m, _ := ctx.Value(bandwidthManagerContextKey{}).(*BandwidthManager)
+	if m == nil {
+		return nil
+	}
+	priority, _ := ctx.Value(bandwidthPriorityContextKey{}).(int)
+	if err := m.Add(c, priority); err != nil {
+		c.Close()
+		return err
+	}
+	return nil
+}
+
+// SetLimit sets the limit to limit bytes per second, 0 for none, from
+// the next rebalancing. Without a limit, the connections get back the
+// maxbw they had before they were added.
+func (m *BandwidthManager) SetLimit(limit int64) {
+	m.mu.Lock()
+	m.limit = limit
+	m.mu.Unlock()
+}
+
+// Limit returns the limit in bytes per second, 0 for none.
+func (m *BandwidthManager) Limit() int64 {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.limit
+}
+
+// SetMin sets the least bandwidth a connection is left, in bytes per
+// second, DefaultMinBandwidth if 0. The connections get it even when
+// it takes them all past the limit.
+func (m *BandwidthManager) SetMin(min int64) {
+	m.mu.Lock()
+	m.min = min
+	m.mu.Unlock()
+}
+
+// Add adds c to the manager at priority, higher priorities being
+// served first. The maxbw of c is left as it is until the next
+// rebalancing.
+func (m *BandwidthManager) Add(c *SRTConn, priority int) error {
+	if !c.ok() {
+		return srtapi.EINVPARAM
+	}
+	restore, err := c.MaxBandwidth()
+	if err != nil {
+		return err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if s, ok := m.shares[c]; ok {
+		s.priority = priority
+		return nil
+	}
+	m.shares[c] = &bandwidthShare{c: c, priority: priority, restore: restore}
+	return nil
+}
+
+// SetPriority changes the priority of c, from the next rebalancing. It
+// returns false if c isn't in the manager.
+func (m *BandwidthManager) SetPriority(c *SRTConn, priority int) bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	s, ok := m.shares[c]
+	if ok {
+		s.priority = priority
+	}
+	return ok
+}
+
+// Remove removes c from the manager, and sets its maxbw back to what
+// it was when added, unless it is closed.
+func (m *BandwidthManager) Remove(c *SRTConn) error {
+	m.mu.Lock()
+	s, ok := m.shares[c]
+	delete(m.shares, c)
+	m.mu.Unlock()
+	if !ok || s.max == 0 {
+		return nil
+	}
+	if _, err := srtapi.GetSendState(c.fd.pfd.Sysfd); err != nil {
+		return nil // closed
+	}
+	return c.SetMaxBandwidth(s.restore)
+}
+
+// Usage returns the bandwidth of the connections, by priority from
+// the highest, then socket ID.
+func (m *BandwidthManager) Usage() []BandwidthUsage {
+	m.mu.Lock()
+	us := make([]BandwidthUsage, 0, len(m.shares))
+	for _, s := range m.shares {
+		us = append(us, BandwidthUsage{Conn: s.c, Priority: s.priority, Rate: int64(s.rate), Max: s.max})
+	}
+	m.mu.Unlock()
+	sort.Slice(us, func(i, j int) bool {
+		if us[i].Priority != us[j].Priority {
+			return us[i].Priority > us[j].Priority
+		}
+		return us[i].Conn.fd.pfd.Sysfd < us[j].Conn.fd.pfd.Sysfd
+	})
+	return us
+}
+
+// Run rebalances the bandwidth every interval, DefaultBandwidthInterval
+// if 0, until ctx is done, and returns its error.
+func (m *BandwidthManager) Run(ctx context.Context, interval time.Duration) error {
+	if interval <= 0 {
+		interval = DefaultBandwidthInterval
+	}
+	t := runtime.Clock.NewTicker(interval)
+	defer t.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-t.C():
+			m.Rebalance()
+		}
+	}
+}
+
+// Rebalance measures the bandwidth the connections used since the last
+// rebalancing, and sets their maxbw. Connections that were closed
+// leave the manager. It returns the first error setting a maxbw.
+func (m *BandwidthManager) Rebalance() error {
+	now := runtime.Clock.Now()
+	m.mu.Lock()
+	var shares []*bandwidthShare
+	for c, s := range m.shares {
+		st, err := srtapi.GetSendState(c.fd.pfd.Sysfd)
+		if err != nil {
+			delete(m.shares, c)
+			continue
+		}
+		if !s.at.IsZero() {
+			if d := now.Sub(s.at).Seconds(); d > 0 {
+				s.rate = float64(st.BytesSent-s.sent) / d
+			}
+		}
+		s.sent, s.at = st.BytesSent, now
+		shares = append(shares, s)
+	}
+	min := m.min
+	if min <= 0 {
+		min = DefaultMinBandwidth
+	}
+	allocateBandwidth(shares, m.limit, min)
+	type setting struct {
+		c   *SRTConn
+		max int64
+	}
+	var set []setting
+	for _, s := range shares {
+		max := s.restore
+		if m.limit > 0 {
+			max = int64(s.alloc)
+		}
+		if max != s.max {
+			s.max = max
+			set = append(set, setting{s.c, max})
+		}
+	}
+	m.mu.Unlock()
+
+	var first error
+	for _, s := range set {
+		if err := s.c.SetMaxBandwidth(s.max); err != nil && first == nil {
+			first = err
+		}
+	}
+	return first
+}
+
+// allocateBandwidth sets the alloc of shares, out of limit, each
+// getting at least min: the priorities from the highest get what they
+// demand, with headroom, or share the rest evenly, and what is left
+// after all is shared between all.
+func allocateBandwidth(shares []*bandwidthShare, limit, min int64) {
+	sort.Slice(shares, func(i, j int) bool {
+		if shares[i].priority != shares[j].priority {
+			return shares[i].priority > shares[j].priority
+		}
+		return shares[i].c.fd.pfd.Sysfd < shares[j].c.fd.pfd.Sysfd
+	})
+	left := float64(limit) - float64(min)*float64(len(shares))
+	for i := 0; i < len(shares); {
+		j := i
+		for j < len(shares) && shares[j].priority == shares[i].priority {
+			j++
+		}
+		left -= fillBandwidth(shares[i:j], left, float64(min))
+		i = j
+	}
+	if left > 0 && len(shares) > 0 {
+		extra := left / float64(len(shares))
+		for _, s := range shares {
+			s.alloc += extra
+		}
+	}
+}
+
+// fillBandwidth gives shares of a priority what they demand beyond min, out of
+// left, by water-filling: the smallest demands are met first, the rest
+// share what remains evenly. It returns what it gave beyond min.
+func fillBandwidth(shares []*bandwidthShare, left, min float64) float64 {
+	demand := make([]float64, len(shares))
+	for i, s := range shares {
+		s.alloc = min
+		if d := s.rate*bandwidthHeadroom - min; d > 0 {
+			demand[i] = d
+		}
+	}
+	order := make([]int, len(shares))
+	for i := range order {
+		order[i] = i
+	}
+	sort.Slice(order, func(a, b int) bool { return demand[order[a]] < demand[order[b]] })
+	given := 0.0
+	for k, i := range order {
+		if left <= given {
+			break
+		}
+		give := demand[i]
+		if even := (left - given) / float64(len(order)-k); give > even {
+			give = even
+		}
+		shares[i].alloc += give
+		given += give
+	}
+	return given
+}
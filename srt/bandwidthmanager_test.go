@@ -0,0 +1,140 @@
+// Copyright (c) 2020 CyberAgent, Inc. All rights reserved.
+// https://github.com/openfresh/gosrt
+
+package srt
+
+import (
+	"context"
+	"math"
+	"testing"
+
+	"github.com/openfresh/gosrt/internal/poll"
+)
+
+func TestAllocateBandwidth(t *testing.T) {
+	share := func(id, priority int, rate float64) *bandwidthShare {
+		return &bandwidthShare{c: &SRTConn{conn{&netFD{pfd: poll.FD{Sysfd: id}}}}, priority: priority, rate: rate}
+	}
+	for _, tt := range []struct {
+		name   string
+		limit  int64
+		shares []*bandwidthShare
+		want   []float64 // in the order of shares
+	}{
+		{
+			// The high priority stream gets what it uses, with
+			// headroom; the low ones share the rest.
+			name:   "low degrade first",
+			limit:  1000000,
+			shares: []*bandwidthShare{share(1, 10, 600000), share(2, 0, 400000), share(3, 0, 400000)},
+			want:   []float64{750000, 125000, 125000},
+		},
+		{
+			// Everything fits, and the spare bandwidth is shared.
+			name:   "spare",
+			limit:  1000000,
+			shares: []*bandwidthShare{share(1, 1, 80000), share(2, 0, 80000)},
+			want:   []float64{100000 + 400000, 100000 + 400000},
+		},
+		{
+			// A small demand of a priority is met in full, the larger
+			// ones share what remains.
+			name:   "water-filling",
+			limit:  448000,
+			shares: []*bandwidthShare{share(1, 0, 40000), share(2, 0, 400000), share(3, 0, 400000)},
+			want:   []float64{50000, 199000, 199000},
+		},
+		{
+			// Past the limit, each keeps the minimum.
+			name:   "minimum",
+			limit:  32000,
+			shares: []*bandwidthShare{share(1, 1, 400000), share(2, 0, 400000), share(3, 0, 0)},
+			want:   []float64{16000, 16000, 16000},
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			shares := append([]*bandwidthShare(nil), tt.shares...)
+			allocateBandwidth(shares, tt.limit, DefaultMinBandwidth)
+			for i, s := range tt.shares {
+				if math.Abs(s.alloc-tt.want[i]) > 1 {
+					t.Errorf("share %d: got %.0f; want %.0f", i, s.alloc, tt.want[i])
+				}
+			}
+		})
+	}
+}
+
+func TestBandwidthManager(t *testing.T) {
+	m := NewBandwidthManager(1000000)
+	ctx := WithBandwidthManager(context.Background(), m)
+	ln, err := listenSRT(WithBandwidthPriority(ctx, 5), "srt4", &SRTAddr{IP: []byte{127, 0, 0, 1}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	c, err := dialSRT(ctx, "srt4", nil, ln.fd.laddr.(*SRTAddr))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	a, err := ln.accept()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer a.Close()
+
+	us := m.Usage()
+	if len(us) != 2 || us[0].Conn != a || us[0].Priority != 5 || us[1].Conn != c || us[1].Priority != 0 {
+		t.Fatalf("got usage %+v; want the accepted conn at 5 and the dialed one at 0", us)
+	}
+	if err := m.Rebalance(); err != nil {
+		t.Fatal(err)
+	}
+	for _, u := range m.Usage() {
+		// Nothing sent yet: the minimum, and half the rest.
+		if want := int64(DefaultMinBandwidth + (1000000-2*DefaultMinBandwidth)/2); u.Max != want {
+			t.Errorf("priority %d: got maxbw %d; want %d", u.Priority, u.Max, want)
+		}
+		if bw, _ := u.Conn.MaxBandwidth(); bw != u.Max {
+			t.Errorf("priority %d: got maxbw %d set; want %d", u.Priority, bw, u.Max)
+		}
+	}
+
+	// Without a limit, and once removed, the original maxbw.
+	if err := m.Remove(a); err != nil {
+		t.Fatal(err)
+	}
+	if err := a.SetMaxBandwidth(200000); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.Add(a, 5); err != nil {
+		t.Fatal(err)
+	}
+	m.Rebalance()
+	m.SetLimit(0)
+	m.Rebalance()
+	if bw, _ := a.MaxBandwidth(); bw != 200000 {
+		t.Errorf("got maxbw %d without a limit; want 200000", bw)
+	}
+	if bw, _ := c.MaxBandwidth(); bw != BandwidthUnlimited {
+		t.Errorf("got maxbw %d without a limit; want BandwidthUnlimited", bw)
+	}
+	m.SetLimit(500000)
+	m.Rebalance()
+	if err := m.Remove(a); err != nil {
+		t.Fatal(err)
+	}
+	if bw, _ := a.MaxBandwidth(); bw != 200000 {
+		t.Errorf("got maxbw %d once removed; want 200000", bw)
+	}
+	if m.SetPriority(a, 1) {
+		t.Error("SetPriority of a conn removed")
+	}
+
+	// Closed connections leave the manager.
+	c.Close()
+	m.Rebalance()
+	if us := m.Usage(); len(us) != 0 {
+		t.Errorf("got usage %+v after Close", us)
+	}
+}
@@ -0,0 +1,86 @@
+// Copyright (c) 2020 CyberAgent, Inc. All rights reserved.
+// https://github.com/openfresh/gosrt
+
+package srt
+
+import (
+	"time"
+
+	"github.com/openfresh/gosrt/srtapi"
+)
+
+// A BufferLevel is the fill level of the send or receive buffer of a
+// connection.
+type BufferLevel struct {
+	Packets int
+	Bytes   int
+
+	// Span is the time span of the data in the buffer: for the send
+	// buffer, the age of the oldest data not acknowledged yet; for
+	// the receive buffer, the spread of the timestamps of the data
+	// not delivered yet.
+	Span time.Duration
+
+	// Available is the room left in the buffer, in bytes.
+	Available int
+}
+
+// Fill returns the fraction of the buffer in use.
+func (l BufferLevel) Fill() float64 {
+	if total := l.Bytes + l.Available; total > 0 {
+		return float64(l.Bytes) / float64(total)
+	}
+	return 0
+}
+
+// SendBufferLevel returns the fill level of the send buffer of the
+// connection. It is cheaper than Stats, which gathers every counter,
+// and clears none, so it may be polled as often as a flow-control loop
+// or a gauge needs.
+func (c *conn) SendBufferLevel() (BufferLevel, error) {
+	if !c.ok() {
+		return BufferLevel{}, srtapi.EINVPARAM
+	}
+	var (
+		st  srtapi.SendState
+		err error
+	)
+	if rerr := c.fd.pfd.RawControl(func(s int) { st, err = getSendStateFunc(s) }); rerr != nil {
+		err = rerr
+	}
+	if err != nil {
+		return BufferLevel{}, &OpError{Op: "buffer", Net: c.fd.net, Source: c.fd.laddr, Addr: c.fd.raddr, Err: err}
+	}
+	return BufferLevel{
+		Packets:   st.BufferedPackets,
+		Bytes:     st.BufferedBytes,
+		Span:      time.Duration(st.BufferedMs) * time.Millisecond,
+		Available: st.AvailableBytes,
+	}, nil
+}
+
+// RecvBufferLevel returns the fill level of the receive buffer of the
+// connection, as SendBufferLevel does for the send buffer. In live
+// mode, the data waits there for its play time, so the span stays
+// below the latency while the reader keeps up.
+func (c *conn) RecvBufferLevel() (BufferLevel, error) {
+	if !c.ok() {
+		return BufferLevel{}, srtapi.EINVPARAM
+	}
+	var (
+		st  srtapi.RecvState
+		err error
+	)
+	if rerr := c.fd.pfd.RawControl(func(s int) { st, err = getRecvStateFunc(s) }); rerr != nil {
+		err = rerr
+	}
+	if err != nil {
+		return BufferLevel{}, &OpError{Op: "buffer", Net: c.fd.net, Source: c.fd.laddr, Addr: c.fd.raddr, Err: err}
+	}
+	return BufferLevel{
+		Packets:   st.BufferedPackets,
+		Bytes:     st.BufferedBytes,
+		Span:      time.Duration(st.BufferedMs) * time.Millisecond,
+		Available: st.AvailableBytes,
+	}, nil
+}
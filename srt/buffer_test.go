@@ -0,0 +1,84 @@
+// Copyright (c) 2020 CyberAgent, Inc. All rights reserved.
+// https://github.com/openfresh/gosrt
+
+package srt
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/openfresh/gosrt/srtapi"
+)
+
+func TestSendBufferLevel(t *testing.T) {
+	c1, c2, err := Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c1.Close()
+	defer c2.Close()
+
+	defer func(f func(int) (srtapi.SendState, error)) { getSendStateFunc = f }(getSendStateFunc)
+	getSendStateFunc = func(s int) (srtapi.SendState, error) {
+		return srtapi.SendState{BufferedPackets: 3, BufferedBytes: 3000, BufferedMs: 40, AvailableBytes: 9000}, nil
+	}
+	l, err := c1.SendBufferLevel()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := BufferLevel{Packets: 3, Bytes: 3000, Span: 40 * time.Millisecond, Available: 9000}
+	if l != want {
+		t.Errorf("got %+v; want %+v", l, want)
+	}
+	if f := l.Fill(); f != 0.25 {
+		t.Errorf("got a fill of %v; want 0.25", f)
+	}
+
+	c1.Close()
+	if _, err := c1.SendBufferLevel(); !errors.Is(err, ErrClosed) {
+		t.Errorf("got %v on a closed connection; want %v", err, ErrClosed)
+	}
+}
+
+func TestRecvBufferLevel(t *testing.T) {
+	c1, c2, err := Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c1.Close()
+	defer c2.Close()
+
+	const messages = 5
+	b := make([]byte, 1000)
+	for i := 0; i < messages; i++ {
+		if _, err := c1.Write(b); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// The messages wait in the receive buffer until they are read.
+	deadline := time.Now().Add(someTimeout)
+	var l BufferLevel
+	for {
+		if l, err = c2.RecvBufferLevel(); err != nil {
+			t.Fatal(err)
+		}
+		if l.Packets == messages || time.Now().After(deadline) {
+			break
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	if l.Packets != messages || l.Bytes != messages*len(b) || l.Available <= 0 {
+		t.Fatalf("got %+v with %d messages of %d bytes unread", l, messages, len(b))
+	}
+
+	c2.SetReadDeadline(time.Now().Add(someTimeout))
+	for i := 0; i < messages; i++ {
+		if _, err := c2.Read(b); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if l, err = c2.RecvBufferLevel(); err != nil || l.Packets != 0 || l.Bytes != 0 {
+		t.Errorf("got %+v, %v once read; want an empty buffer", l, err)
+	}
+}
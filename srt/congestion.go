@@ -0,0 +1,27 @@
+// Copyright (c) 2020 CyberAgent, Inc. All rights reserved.
+// https://github.com/openfresh/gosrt
+
+package srt
+
+import "github.com/openfresh/gosrt/srtapi"
+
+// RegisterCongestionControl makes the congestion controls returned by
+// newCC available as the "congestion" option name, so that a custom
+// algorithm can be tried on real connections without changing the
+// protocol engine:
+//
+//	srt.RegisterCongestionControl("mine", newMine)
+//	ctx := srt.WithOptions(ctx, srt.Options("congestion", "mine"))
+//
+// newCC is called for each connection made or accepted with the option,
+// as it is established. The built-in "live", the default, paces the
+// packets to the "maxbw" option if it is set and bounds nothing else;
+// "file" also grows and halves a window of packets in flight as the
+// peer acknowledges and reports losses. Neither name can be replaced.
+//
+// Only the pure Go SRT implementation runs Go congestion controls (see
+// srtapi.FeatureCongestionControl); with libsrt,
+// RegisterCongestionControl fails with srtapi.EINVOP.
+func RegisterCongestionControl(name string, newCC func(srtapi.CongestionParams) srtapi.CongestionControl) error {
+	return srtapi.RegisterCongestion(name, newCC)
+}
@@ -12,8 +12,13 @@
 package srt
 
 import (
+	"bytes"
 	"context"
+	"errors"
+	"io"
+	"io/ioutil"
 	"net"
+	"sync"
 	"testing"
 	"time"
 )
@@ -71,3 +76,146 @@ func TestConnAndListener(t *testing.T) {
 		}
 	}
 }
+
+// TestConnChurn opens and closes connections rapidly, giving the SRT
+// library every chance to reuse socket IDs, while a long-lived
+// connection keeps exchanging data. Readiness for the recycled IDs
+// must not be lost or delivered to the wrong incarnation.
+func TestConnChurn(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping in short mode")
+	}
+	const (
+		workers = 4
+		churns  = 25
+		rounds  = 50
+	)
+
+	ln, err := newLocalListener("srt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+
+	go func() {
+		first := true
+		for {
+			c, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			if first {
+				first = false
+				go func() {
+					defer c.Close()
+					io.Copy(c, c)
+				}()
+				continue
+			}
+			c.Close()
+		}
+	}()
+
+	lc, err := Dial(ln.Addr().Network(), ln.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer lc.Close()
+
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < churns; j++ {
+				c, err := Dial(ln.Addr().Network(), ln.Addr().String())
+				if err != nil {
+					continue
+				}
+				c.Close()
+			}
+		}()
+	}
+
+	wb := []byte("CONN CHURN TEST")
+	rb := make([]byte, 128)
+	for i := 0; i < rounds; i++ {
+		lc.SetDeadline(time.Now().Add(someTimeout))
+		if _, err := lc.Write(wb); err != nil {
+			t.Fatalf("round %d: %v", i, err)
+		}
+		n, err := lc.Read(rb)
+		if err != nil {
+			t.Fatalf("round %d: %v", i, err)
+		}
+		if !bytes.Equal(rb[:n], wb) {
+			t.Fatalf("round %d: got %q; want %q", i, rb[:n], wb)
+		}
+	}
+	wg.Wait()
+}
+
+func TestConnUseAfterClose(t *testing.T) {
+	ln, err := newLocalListener("srt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+
+	go func() {
+		c, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		defer c.Close()
+		io.Copy(ioutil.Discard, c)
+	}()
+
+	c, err := Dial(ln.Addr().Network(), ln.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Close concurrently with a blocked Read; exactly one Close wins.
+	rerrc := make(chan error, 1)
+	go func() {
+		_, err := c.Read(make([]byte, 128))
+		rerrc <- err
+	}()
+	time.Sleep(50 * time.Millisecond)
+	const closers = 4
+	cerrc := make(chan error, closers)
+	for i := 0; i < closers; i++ {
+		go func() { cerrc <- c.Close() }()
+	}
+	var nils int
+	for i := 0; i < closers; i++ {
+		err := <-cerrc
+		if err == nil {
+			nils++
+			continue
+		}
+		if perr := parseCloseError(err, false); perr != nil {
+			t.Error(perr)
+		}
+		if !errors.Is(err, ErrClosed) {
+			t.Errorf("got %v; want %v", err, ErrClosed)
+		}
+	}
+	if nils != 1 {
+		t.Errorf("got %d successful Close calls; want 1", nils)
+	}
+	if err := <-rerrc; !errors.Is(err, ErrClosed) {
+		t.Errorf("blocked Read: got %v; want %v", err, ErrClosed)
+	}
+
+	if _, err := c.Read(make([]byte, 128)); !errors.Is(err, ErrClosed) {
+		t.Errorf("Read: got %v; want %v", err, ErrClosed)
+	}
+	if _, err := c.Write([]byte("USE AFTER CLOSE")); !errors.Is(err, ErrClosed) {
+		t.Errorf("Write: got %v; want %v", err, ErrClosed)
+	}
+	if err := c.SetDeadline(time.Now().Add(someTimeout)); !errors.Is(err, ErrClosed) {
+		t.Errorf("SetDeadline: got %v; want %v", err, ErrClosed)
+	}
+}
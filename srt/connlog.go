@@ -0,0 +1,80 @@
+// Copyright (c) 2020 CyberAgent, Inc. All rights reserved.
+// https://github.com/openfresh/gosrt
+
+package srt
+
+import (
+	"context"
+	"strconv"
+
+	"github.com/openfresh/gosrt/srtapi"
+)
+
+// The roles of the "role" key of the connection loggers.
+const (
+	RoleCaller     = "caller"
+	RoleListener   = "listener"
+	RoleRendezvous = "rendezvous"
+)
+
+// connLoggerContextKey is the type of contextKeys used for connection
+// loggers.
+type connLoggerContextKey struct{}
+
+// WithConnLogger returns a new context.Context with the Logger the
+// connections made with it, and accepted by the listeners made with
+// it, log to: each logs through one of its own, which adds the keys
+// "sid", "streamid", "peer" and "role" (RoleCaller, RoleListener or
+// RoleRendezvous), and its Labels, to every line, so that the lines of
+// a session can be told apart and correlated with those of the
+// application, which gets it from Logger. The package logs the drops
+// of the connection to it, held to the limits of SetLogger.
+func WithConnLogger(ctx context.Context, l Logger) context.Context {
+	return context.WithValue(ctx, connLoggerContextKey{}, l)
+}
+
+func connLoggerValue(ctx context.Context) Logger {
+	l, _ := ctx.Value(connLoggerContextKey{}).(Logger)
+	return l
+}
+
+// A connLogger adds the keys of a connection to the lines of a Logger.
+type connLogger struct {
+	l    Logger
+	keys []interface{}
+}
+
+func (l *connLogger) Debug(msg string, args ...interface{}) {
+	l.l.Debug(msg, append(l.keys[:len(l.keys):len(l.keys)], args...)...)
+}
+
+// setLogger gives fd the connection logger of ctx, if any, in role. It
+// must be called before the connection is returned.
+func (fd *netFD) setLogger(ctx context.Context, role string) {
+	l := connLoggerValue(ctx)
+	if l == nil {
+		return
+	}
+	if v, ok := Option(ctx, "rendezvous"); ok && role == RoleCaller {
+		if on, _ := strconv.ParseBool(v); on {
+			role = RoleRendezvous
+		}
+	}
+	streamID, _ := srtapi.GetsockflagString(fd.pfd.Sysfd, srtapi.OptionStreamid)
+	keys := []interface{}{
+		"sid", fd.pfd.Sysfd,
+		"streamid", streamID,
+		"peer", addrString(fd.raddr),
+		"role", role,
+	}
+	fd.logger = &connLogger{l: l, keys: append(keys, fd.getLabels().keyValues()...)}
+}
+
+// Logger returns the logger of the connection, which adds its keys to
+// the lines logged, or nil if it wasn't made with WithConnLogger.
+func (c *conn) Logger() Logger {
+	if !c.ok() || c.fd.logger == nil {
+		return nil
+	}
+	return c.fd.logger
+}
@@ -0,0 +1,249 @@
+// Copyright (c) 2020 CyberAgent, Inc. All rights reserved.
+// https://github.com/openfresh/gosrt
+
+package srt
+
+import (
+	"time"
+
+	"github.com/openfresh/gosrt/srtapi"
+)
+
+// MsgCtrl controls how SendMessage sends a message, and reports what
+// ReadMessage knows of one received.
+type MsgCtrl struct {
+	// TTL is how long the message may be sent, or retransmitted
+	// once lost, before it is dropped; 0 means no limit but that of
+	// the "tlpktdrop" option. It is rounded up to the millisecond.
+	// The receiver acknowledges the messages it gives up on like
+	// those it got, so only with a TTL well below the latency are
+	// lost messages reported dropped.
+	TTL time.Duration
+
+	// InOrder has the message delivered only after those sent before
+	// it, which live mode always does.
+	InOrder bool
+
+	// Track has the delivery of the message reported on the channel
+	// of Deliveries, which must have been called before.
+	Track bool
+
+	// SourceTime is the time the message was produced at, as with
+	// WriteWithSourceTime; zero stands for the time of sending. On
+	// receipt it is that time on this side's clock, zero without
+	// srtapi.FeatureSourceTime.
+	SourceTime time.Time
+
+	// MsgNo is set by SendMessage to the number of the message, which
+	// its Delivery carries. ReadMessage sets it, and PktSeq to the
+	// sequence number of the first packet of the message: a gap in
+	// either tells of messages dropped too late to play.
+	MsgNo  int32
+	PktSeq int32
+}
+
+// A Delivery reports what became of a message sent with Track set.
+type Delivery struct {
+	MsgNo int32
+	Time  time.Time
+
+	// Delivered reports whether the peer acknowledged the message;
+	// it was dropped otherwise, and the application must send its
+	// content again if it matters.
+	Delivered bool
+}
+
+// SendMessage sends p as one message, as ctrl says if it is not nil,
+// and sets ctrl.MsgNo. Unlike Write, it never splits p: on a live mode
+// connection, a p longer than the payload size, at most
+// MaxPayloadSize, fails with a *MessageTooLongError whatever the
+// PayloadPolicy.
+func (c *conn) SendMessage(p []byte, ctrl *MsgCtrl) error {
+	if !c.ok() {
+		return srtapi.EINVPARAM
+	}
+	var (
+		mc srtapi.MsgCtrl
+		st time.Time
+	)
+	if ctrl != nil {
+		if ctrl.Track && !srtapi.Has(srtapi.FeatureDeliveryReports) ||
+			!ctrl.SourceTime.IsZero() && !srtapi.Has(srtapi.FeatureSourceTime) {
+			return &OpError{Op: "write", Net: c.fd.net, Source: c.fd.laddr, Addr: c.fd.raddr, Err: srtapi.EINVOP}
+		}
+		if ctrl.TTL > 0 {
+			mc.MsgTTL = int32((ctrl.TTL + time.Millisecond - 1) / time.Millisecond)
+		}
+		mc.InOrder = ctrl.InOrder
+		mc.Track = ctrl.Track
+		if st = ctrl.SourceTime; !st.IsZero() {
+			mc.SrcTime = toSourceTime(st)
+		}
+	}
+	if limit := c.fd.payloadLimit(); limit > 0 && len(p) > limit {
+		return &OpError{Op: "write", Net: c.fd.net, Source: c.fd.laddr, Addr: c.fd.raddr, Err: &MessageTooLongError{Size: len(p), Limit: limit}}
+	}
+	if _, err := c.fd.pfd.WriteMsg(p, &mc); err != nil {
+		return &OpError{Op: "write", Net: c.fd.net, Source: c.fd.laddr, Addr: c.fd.raddr, Err: wrapSyscallError("write", err)}
+	}
+	c.fd.tap(TapOutbound, p, st, mc.MsgNo)
+	if ctrl != nil {
+		ctrl.MsgNo = mc.MsgNo
+	}
+	return nil
+}
+
+// ReadMessage reads one message, the data of a SendMessage, Write or
+// WriteWithSourceTime of the peer, and returns it with its source
+// time, number and first packet sequence number in a MsgCtrl; the
+// times of successive messages give their spacing at the source,
+// which remuxing MPEG-TS needs. Messages are read into buffers of
+// MaxPayloadSize, whatever the payload size of either side: longer
+// messages, which only file mode carries, are better read with
+// ReadWithSourceTime.
+func (c *conn) ReadMessage() ([]byte, *MsgCtrl, error) {
+	if !c.ok() {
+		return nil, nil, srtapi.EINVPARAM
+	}
+	p, ctrl, err := c.fd.readMessage()
+	if err != nil {
+		return nil, nil, &OpError{Op: "read", Net: c.fd.net, Source: c.fd.laddr, Addr: c.fd.raddr, Err: err}
+	}
+	return p, ctrl, nil
+}
+
+func (fd *netFD) readMessage() ([]byte, *MsgCtrl, error) {
+	// The payload size is this side's: the peer may send messages up
+	// to its own, as long as MaxPayloadSize.
+	size := MaxPayloadSize
+	if n := fd.payloadLimit(); n > size {
+		size = n
+	}
+	p := make([]byte, size)
+	if n, ok := fd.readPeeked(p); ok {
+		fd.tap(TapInbound, p[:n], time.Time{}, 0)
+		return p[:n], &MsgCtrl{}, nil
+	}
+	var mc srtapi.MsgCtrl
+	n, err := fd.pfd.ReadMsg(p, &mc, fd.rseq.seen())
+	if err != nil {
+		return nil, nil, wrapSyscallError("read", err)
+	}
+	ctrl := &MsgCtrl{MsgNo: mc.MsgNo, PktSeq: mc.PktSeq}
+	if mc.SrcTime != 0 && srtapi.Has(srtapi.FeatureSourceTime) {
+		ctrl.SourceTime = fromSourceTime(mc.SrcTime)
+	}
+	fd.tap(TapInbound, p[:n], ctrl.SourceTime, ctrl.MsgNo)
+	return p[:n], ctrl, nil
+}
+
+// Deliveries returns the channel on which the deliveries of the
+// messages sent with MsgCtrl.Track are reported, as they are
+// acknowledged or dropped: metadata channels can send the records
+// that didn't make it again. Unlike events, reports are queued until
+// they are received, up to 4096 of them, past which the oldest are
+// dropped, and logged as LogEventDrop. The channel is closed when
+// the connection is; the messages not reported by then may or may not
+// have been delivered.
+//
+// Only the pure Go SRT implementation reports deliveries; with libsrt,
+// Deliveries fails with srtapi.EINVOP.
+func (c *conn) Deliveries() (<-chan Delivery, error) {
+	if !c.ok() {
+		return nil, srtapi.EINVPARAM
+	}
+	ch, err := c.fd.deliveryChan()
+	if err != nil {
+		return nil, &OpError{Op: "deliveries", Net: c.fd.net, Source: c.fd.laddr, Addr: c.fd.raddr, Err: err}
+	}
+	return ch, nil
+}
+
+func (fd *netFD) deliveryChan() (chan Delivery, error) {
+	fd.dlvmu.Lock()
+	if fd.deliveries != nil {
+		defer fd.dlvmu.Unlock()
+		return fd.deliveries, nil
+	}
+	if fd.dlvClosed {
+		fd.dlvmu.Unlock()
+		return nil, ErrClosed
+	}
+	if !srtapi.Has(srtapi.FeatureDeliveryReports) {
+		fd.dlvmu.Unlock()
+		return nil, srtapi.EINVOP
+	}
+	ch := make(chan Delivery)
+	fd.deliveries = ch
+	fd.dlvWake = make(chan struct{}, 1)
+	fd.dlvDone = make(chan struct{})
+	fd.dlvmu.Unlock()
+
+	// As with events, the callback runs with the SRT socket locked,
+	// and takes dlvmu.
+	err := srtapi.DeliveryCallback(fd.pfd.Sysfd, func(msgno int32, delivered bool) {
+		fd.queueDelivery(Delivery{MsgNo: msgno, Time: time.Now(), Delivered: delivered})
+	})
+	if err != nil {
+		fd.dlvmu.Lock()
+		fd.deliveries = nil
+		fd.dlvmu.Unlock()
+		return nil, err
+	}
+	go fd.pumpDeliveries(ch)
+	return ch, nil
+}
+
+// deliveryQueue is the number of reports Deliveries queues.
+const deliveryQueue = 4096
+
+func (fd *netFD) queueDelivery(d Delivery) {
+	fd.dlvmu.Lock()
+	defer fd.dlvmu.Unlock()
+	if fd.dlvClosed {
+		return
+	}
+	if len(fd.dlvQueue) == deliveryQueue {
+		fd.logf(LogEventDrop, "srt delivery report dropped", "msgno", fd.dlvQueue[0].MsgNo)
+		fd.dlvQueue = fd.dlvQueue[1:]
+	}
+	fd.dlvQueue = append(fd.dlvQueue, d)
+	select {
+	case fd.dlvWake <- struct{}{}:
+	default:
+	}
+}
+
+// pumpDeliveries hands the queued reports to ch until the connection
+// is closed.
+func (fd *netFD) pumpDeliveries(ch chan<- Delivery) {
+	defer close(ch)
+	for {
+		fd.dlvmu.Lock()
+		q := fd.dlvQueue
+		fd.dlvQueue = nil
+		fd.dlvmu.Unlock()
+		for _, d := range q {
+			select {
+			case ch <- d:
+			case <-fd.dlvDone:
+				return
+			}
+		}
+		select {
+		case <-fd.dlvWake:
+		case <-fd.dlvDone:
+			return
+		}
+	}
+}
+
+func (fd *netFD) closeDeliveries() {
+	fd.dlvmu.Lock()
+	defer fd.dlvmu.Unlock()
+	if fd.deliveries != nil && !fd.dlvClosed {
+		close(fd.dlvDone)
+	}
+	fd.dlvClosed = true
+	fd.dlvQueue = nil
+}
@@ -0,0 +1,177 @@
+// Copyright (c) 2020 CyberAgent, Inc. All rights reserved.
+// https://github.com/openfresh/gosrt
+
+package srt
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/openfresh/gosrt/srtapi"
+)
+
+func TestDeliveries(t *testing.T) {
+	c1, c2, err := Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c1.Close()
+	defer c2.Close()
+
+	if !srtapi.Has(srtapi.FeatureDeliveryReports) {
+		if err := c1.SendMessage([]byte("x"), &MsgCtrl{Track: true}); !errors.Is(err, srtapi.EINVOP) {
+			t.Errorf("got %v; want %v", err, srtapi.EINVOP)
+		}
+		t.Skip("SRT library doesn't report deliveries")
+	}
+	deliveries, err := c1.Deliveries()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Nobody receives the reports while the messages are sent: they
+	// are queued.
+	var msgnos []int32
+	for _, m := range []string{"one", "two", "three"} {
+		ctrl := &MsgCtrl{TTL: 50 * time.Millisecond, Track: true}
+		if err := c1.SendMessage([]byte(m), ctrl); err != nil {
+			t.Fatal(err)
+		}
+		msgnos = append(msgnos, ctrl.MsgNo)
+	}
+	if err := c1.SendMessage([]byte("untracked"), nil); err != nil {
+		t.Fatal(err)
+	}
+	if msgnos[1] != msgnos[0]+1 || msgnos[2] != msgnos[1]+1 {
+		t.Errorf("messages numbered %v", msgnos)
+	}
+	b := make([]byte, 1500)
+	c2.SetReadDeadline(time.Now().Add(someTimeout))
+	for i := 0; i < 4; i++ {
+		if _, err := c2.Read(b); err != nil {
+			t.Fatal(err)
+		}
+	}
+	time.Sleep(100 * time.Millisecond)
+	for _, msgno := range msgnos {
+		select {
+		case d := <-deliveries:
+			if d.MsgNo != msgno || !d.Delivered || d.Time.IsZero() {
+				t.Errorf("got %+v; want message %d delivered", d, msgno)
+			}
+		case <-time.After(someTimeout):
+			t.Fatalf("message %d not reported", msgno)
+		}
+	}
+
+	c1.Close()
+	select {
+	case d, ok := <-deliveries:
+		if ok {
+			t.Errorf("got %+v; want the channel closed", d)
+		}
+	case <-time.After(time.Second):
+		t.Error("channel not closed with the connection")
+	}
+}
+
+func TestReadMessage(t *testing.T) {
+	c, sc := newPayloadTestPair(t)
+	defer c.Close()
+	defer sc.Close()
+
+	// Messages are never split, whatever the policy.
+	if err := c.SetPayloadPolicy(PayloadSplit); err != nil {
+		t.Fatal(err)
+	}
+	var mtl *MessageTooLongError
+	if err := c.SendMessage(make([]byte, 129), nil); !errors.As(err, &mtl) || mtl.Limit != 128 {
+		t.Fatalf("got %v; want a message too long for 128 bytes", err)
+	}
+
+	var st time.Time
+	if srtapi.Has(srtapi.FeatureSourceTime) {
+		time.Sleep(50 * time.Millisecond)
+		st = time.Now().Add(-20 * time.Millisecond)
+	} else if err := c.SendMessage([]byte("x"), &MsgCtrl{SourceTime: time.Now()}); !errors.Is(err, srtapi.EINVOP) {
+		t.Errorf("got %v for a source time; want %v", err, srtapi.EINVOP)
+	}
+	sent := []*MsgCtrl{{SourceTime: st, TTL: time.Second}, {InOrder: true}}
+	for _, ctrl := range sent {
+		if err := c.SendMessage(bytes.Repeat([]byte("m"), 128), ctrl); err != nil {
+			t.Fatal(err)
+		}
+	}
+	var seq int32
+	for i, want := range sent {
+		p, ctrl, err := sc.ReadMessage()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(p) != 128 {
+			t.Errorf("#%d: got a %d-byte message; want 128", i, len(p))
+		}
+		if ctrl.MsgNo != want.MsgNo {
+			t.Errorf("#%d: got message %d; want %d", i, ctrl.MsgNo, want.MsgNo)
+		}
+		if i > 0 && ctrl.PktSeq != seq+1 {
+			t.Errorf("#%d: got packet %d after %d", i, ctrl.PktSeq, seq)
+		}
+		seq = ctrl.PktSeq
+		if !want.SourceTime.IsZero() {
+			if d := ctrl.SourceTime.Sub(want.SourceTime); d < -5*time.Millisecond || d > 5*time.Millisecond {
+				t.Errorf("#%d: got source time %v off by %v", i, ctrl.SourceTime, d)
+			}
+		}
+	}
+}
+
+func TestReadMessagePeerPayloadSize(t *testing.T) {
+	ln, err := newLocalListenerContext(WithOptions(context.Background(), Options("payloadsize", "128")), "srt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	var d Dialer
+	c, err := d.DialContext(WithOptions(context.Background(), Options("payloadsize", strconv.Itoa(MaxPayloadSize))), ln.Addr().Network(), ln.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	ln.(*SRTListener).SetDeadline(time.Now().Add(someTimeout))
+	sc, err := ln.Accept()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sc.Close()
+
+	// The receiver's payload size doesn't limit what it reads.
+	m := bytes.Repeat([]byte("m"), MaxPayloadSize)
+	if err := c.(*SRTConn).SendMessage(m, nil); err != nil {
+		t.Fatal(err)
+	}
+	sc.SetReadDeadline(time.Now().Add(someTimeout))
+	p, _, err := sc.(*SRTConn).ReadMessage()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(p, m) {
+		t.Errorf("got a %d-byte message; want %d bytes", len(p), len(m))
+	}
+}
+
+func TestDeliveryQueue(t *testing.T) {
+	fd := &netFD{dlvWake: make(chan struct{}, 1)}
+	for i := 0; i < deliveryQueue+10; i++ {
+		fd.queueDelivery(Delivery{MsgNo: int32(i)})
+	}
+	if n := len(fd.dlvQueue); n != deliveryQueue {
+		t.Fatalf("queued %d reports; want %d", n, deliveryQueue)
+	}
+	if first, last := fd.dlvQueue[0].MsgNo, fd.dlvQueue[deliveryQueue-1].MsgNo; first != 10 || last != deliveryQueue+9 {
+		t.Errorf("queued messages %d to %d; want the latest, 10 to %d", first, last, deliveryQueue+9)
+	}
+}
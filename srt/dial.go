@@ -11,6 +11,7 @@ package srt
 import (
 	"context"
 	"net"
+	"strings"
 	"time"
 
 	"github.com/openfresh/gosrt/internal/nettrace"
@@ -63,6 +64,20 @@ type Dialer struct {
 
 	// Resolver optionally specifies an alternate resolver to use.
 	Resolver *Resolver
+
+	// Retry, if set, retries a dial whose handshake was rejected, as
+	// the policy says. Timeout and Deadline bound the whole dial,
+	// retries included.
+	Retry *RetryPolicy
+
+	// Handshake, if set, tunes the timing of the handshake, for links
+	// of long round trips.
+	Handshake *HandshakeTiming
+
+	// Latency, if set, picks the "latency" option of each dial from
+	// the connections made before to the same address, and watches
+	// the connection made, overriding the option of the context.
+	Latency *LatencyTuner
 }
 
 func minNonzeroTime(a, b time.Time) time.Time {
@@ -90,6 +105,18 @@ func (d *Dialer) deadline(ctx context.Context, now time.Time) (earliest time.Tim
 	return minNonzeroTime(earliest, d.Deadline)
 }
 
+// withDeadline returns ctx bounded by the Timeout and Deadline of d,
+// and the function releasing it.
+func (d *Dialer) withDeadline(ctx context.Context) (context.Context, context.CancelFunc) {
+	deadline := d.deadline(ctx, time.Now())
+	if !deadline.IsZero() {
+		if d, ok := ctx.Deadline(); !ok || deadline.Before(d) {
+			return context.WithDeadline(ctx, deadline)
+		}
+	}
+	return ctx, func() {}
+}
+
 func (d *Dialer) resolver() *Resolver {
 	if d.Resolver != nil {
 		return d.Resolver
@@ -204,6 +231,14 @@ func (r *Resolver) resolveAddrList(ctx context.Context, op, network, addr string
 //	Dial("srt", "[fe80::1%lo0]:53")
 //	Dial("srt", ":1024")
 //
+// The address may also be a GroupURL listing several endpoints, which
+// Dial connects as the members of a socket group, bonding them with
+// srt_connect_group; this needs srtapi.FeatureGroups. The group is
+// named after its first endpoint in errors and in the hooks of
+// WithHooks, and doesn't use the LocalAddr of a Dialer.
+//
+//	Dial("srt", "srt://a.example.com:9000,b.example.com:9000?mode=backup")
+//
 // For SRT networks, if the host is empty or a literal
 // unspecified IP address, as in ":80", "0.0.0.0:80" or "[::]:80" for
 // SRT, "", "0.0.0.0" or "::" for IP, the local system is
@@ -266,13 +301,36 @@ func (d *Dialer) DialContext(ctx context.Context, network, address string) (net.
 	if ctx == nil {
 		panic("nil context")
 	}
-	deadline := d.deadline(ctx, time.Now())
-	if !deadline.IsZero() {
-		if d, ok := ctx.Deadline(); !ok || deadline.Before(d) {
-			subCtx, cancel := context.WithDeadline(ctx, deadline)
-			defer cancel()
-			ctx = subCtx
+	ctx, cancel := d.withDeadline(ctx)
+	defer cancel()
+
+	if d.Handshake != nil {
+		ctx = d.Handshake.withOptions(ctx)
+	}
+	if d.Latency != nil {
+		ctx = d.Latency.withOptions(ctx, address)
+	}
+	var c net.Conn
+	var err error
+	if d.Retry != nil {
+		c, err = d.Retry.dial(ctx, func() (net.Conn, error) { return d.dial(ctx, network, address) })
+	} else {
+		c, err = d.dial(ctx, network, address)
+	}
+	if sc, ok := c.(*SRTConn); ok && err == nil && d.Latency != nil {
+		d.Latency.Watch(context.Background(), address, sc)
+	}
+	return c, err
+}
+
+// dial makes one attempt of DialContext, within its deadline.
+func (d *Dialer) dial(ctx context.Context, network, address string) (net.Conn, error) {
+	if strings.HasPrefix(address, urlPrefix) {
+		u, err := ParseGroupURL(address)
+		if err != nil {
+			return nil, &OpError{Op: "dial", Net: network, Source: nil, Addr: nil, Err: err}
 		}
+		return d.dialURL(ctx, network, u)
 	}
 
 	// Shadow the nettrace (if any) during resolve so Connect events don't fire for DNS lookups.
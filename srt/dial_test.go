@@ -9,6 +9,7 @@ package srt
 
 import (
 	"context"
+	"errors"
 	"io"
 	"net"
 	"runtime"
@@ -563,3 +564,41 @@ func TestDialListenerAddr(t *testing.T) {
 	}
 	c.Close()
 }
+
+func TestDialEncryptionMismatch(t *testing.T) {
+	ctx := WithOptions(context.Background(), Options("passphrase", "0123456789abcdef"))
+	ln, err := ListenContext(ctx, "srt4", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+
+	for _, tt := range []struct {
+		passphrase string
+		reason     RejectReason
+	}{
+		{"", RejectUnsecure},
+		{"fedcba9876543210", RejectBadSecret},
+	} {
+		ctx := context.Background()
+		if tt.passphrase != "" {
+			ctx = WithOptions(ctx, Options("passphrase", tt.passphrase))
+		}
+		var d Dialer
+		c, err := d.DialContext(ctx, "srt", ln.Addr().String())
+		if err == nil {
+			c.Close()
+			t.Fatalf("passphrase %q: dial succeeded", tt.passphrase)
+		}
+		if perr := parseDialError(err); perr != nil {
+			t.Error(perr)
+		}
+		if !errors.Is(err, ErrEncryptionMismatch) {
+			t.Errorf("passphrase %q: got %v; want %v", tt.passphrase, err, ErrEncryptionMismatch)
+		}
+		var rerr *RejectError
+		if !errors.As(err, &rerr) || rerr.Reason != tt.reason {
+			t.Errorf("passphrase %q: got %v; want reject reason %v", tt.passphrase, err, tt.reason)
+		}
+	}
+}
@@ -0,0 +1,137 @@
+// Copyright (c) 2020 CyberAgent, Inc. All rights reserved.
+// https://github.com/openfresh/gosrt
+
+package srt
+
+import "time"
+
+// DefaultDriftWindow is the Window of a DriftEstimator left zero.
+const DefaultDriftWindow = time.Minute
+
+// minDriftSpan is the shortest span of samples a DriftEstimator fits a
+// skew over; over less, jitter swamps any drift.
+const minDriftSpan = time.Second
+
+// Drift is the relation between the clock of a sender and this side's
+// clock, as a DriftEstimator measures it.
+type Drift struct {
+	// Factor is how long the sender clock advances in a second of
+	// this side's clock: above 1, the sender runs fast and a
+	// re-clocking receiver must play out faster to keep its latency.
+	Factor float64
+
+	// Offset is the sender time minus this side's, fitted at the
+	// latest sample.
+	Offset time.Duration
+
+	// Samples is the number of samples the estimate comes from.
+	Samples int
+}
+
+// PPM returns the skew of the sender clock in parts per million,
+// positive when it runs fast.
+func (d Drift) PPM() float64 {
+	return (d.Factor - 1) * 1e6
+}
+
+// Local returns how long d on the sender clock lasts on this side's.
+func (d Drift) Local(dur time.Duration) time.Duration {
+	if d.Factor == 0 {
+		return dur
+	}
+	return time.Duration(float64(dur) / d.Factor)
+}
+
+// A DriftEstimator measures the skew between the clock of a sender and
+// this side's clock, from the times messages were produced at on the
+// sender and the times they were received at. libsrt compensates its
+// own drift tracer for its delivery times but doesn't report it; the
+// estimate lets playout servers re-clock their output to the sender.
+// The source times may be those ReadWithSourceTime returns when the
+// sender stamps its messages with WriteWithSourceTime, or any clock
+// the stream carries, such as MPEG-TS PCRs.
+//
+// The zero value is ready to use. A DriftEstimator must not be used
+// concurrently.
+type DriftEstimator struct {
+	// Window is how long samples are taken into account for. Zero
+	// means DefaultDriftWindow.
+	Window time.Duration
+
+	samples []driftSample
+	first   int // of the samples in the window
+	origin  time.Time
+	offset0 time.Duration // the offset of the first sample
+	started bool
+
+	// Sums of the least squares fit of the offsets y over the local
+	// times x, in seconds since origin and from offset0, which keep
+	// them small enough for float64 whatever the clocks.
+	n, sx, sy, sxx, sxy float64
+}
+
+type driftSample struct {
+	x, y float64
+}
+
+// Add records that a message produced at source on the sender clock
+// was received at local.
+func (e *DriftEstimator) Add(source, local time.Time) {
+	if !e.started {
+		e.started = true
+		e.origin, e.offset0 = local, source.Sub(local)
+	}
+	s := driftSample{
+		x: local.Sub(e.origin).Seconds(),
+		y: (source.Sub(local) - e.offset0).Seconds(),
+	}
+	e.samples = append(e.samples, s)
+	e.add(s, 1)
+
+	window := e.Window
+	if window <= 0 {
+		window = DefaultDriftWindow
+	}
+	for e.first < len(e.samples) && s.x-e.samples[e.first].x > window.Seconds() {
+		e.add(e.samples[e.first], -1)
+		e.first++
+	}
+	if e.first > len(e.samples)/2 {
+		e.samples = e.samples[:copy(e.samples, e.samples[e.first:])]
+		e.first = 0
+	}
+}
+
+func (e *DriftEstimator) add(s driftSample, sign float64) {
+	e.n += sign
+	e.sx += sign * s.x
+	e.sy += sign * s.y
+	e.sxx += sign * s.x * s.x
+	e.sxy += sign * s.x * s.y
+}
+
+// Drift returns the current estimate. Until the samples span a second,
+// it reports no skew.
+func (e *DriftEstimator) Drift() Drift {
+	samples := e.samples[e.first:]
+	if len(samples) == 0 {
+		return Drift{Factor: 1}
+	}
+	last := samples[len(samples)-1]
+	d := Drift{Factor: 1, Samples: len(samples)}
+	slope := 0.0
+	den := e.n*e.sxx - e.sx*e.sx
+	if last.x-samples[0].x >= minDriftSpan.Seconds() && den > 0 {
+		slope = (e.n*e.sxy - e.sx*e.sy) / den
+	}
+	d.Factor = 1 + slope
+	mean := e.sy / e.n
+	d.Offset = e.offset0 + time.Duration((mean+slope*(last.x-e.sx/e.n))*float64(time.Second))
+	return d
+}
+
+// Reset forgets the samples, as when the stream moves to another
+// sender.
+func (e *DriftEstimator) Reset() {
+	*e = DriftEstimator{Window: e.Window}
+}
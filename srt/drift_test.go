@@ -0,0 +1,62 @@
+// Copyright (c) 2020 CyberAgent, Inc. All rights reserved.
+// https://github.com/openfresh/gosrt
+
+package srt
+
+import (
+	"math"
+	"testing"
+	"time"
+)
+
+func TestDriftEstimator(t *testing.T) {
+	e := testDriftEstimator(t, 200*time.Millisecond)
+	e.Reset()
+	start := time.Unix(1000, 0)
+	e.Add(start, start)
+	if d := e.Drift(); d.Factor != 1 || d.Samples != 1 || d.Offset != 0 {
+		t.Errorf("got %+v after Reset; want one sample", d)
+	}
+}
+
+// TestDriftEstimatorOffset has source times of another epoch than the
+// local ones, as with stream clocks.
+func TestDriftEstimatorOffset(t *testing.T) {
+	testDriftEstimator(t, -50*365*24*time.Hour+200*time.Millisecond)
+}
+
+func testDriftEstimator(t *testing.T, offset time.Duration) *DriftEstimator {
+	start := time.Unix(1000, 0)
+	e := new(DriftEstimator)
+	if d := e.Drift(); d.Factor != 1 || d.Samples != 0 {
+		t.Errorf("got %+v; want no skew before any sample", d)
+	}
+	// The sender runs 50 ppm fast, offset ahead, with ±1ms of jitter.
+	for i := 0; i < 4000; i++ {
+		local := start.Add(time.Duration(i) * 20 * time.Millisecond)
+		elapsed := local.Sub(start)
+		source := start.Add(offset + elapsed + elapsed*50/1000000)
+		if i%2 == 0 {
+			local = local.Add(time.Millisecond)
+		} else {
+			local = local.Add(-time.Millisecond)
+		}
+		e.Add(source, local)
+	}
+	d := e.Drift()
+	if math.Abs(d.PPM()-50) > 2 {
+		t.Errorf("got %.1f ppm; want 50", d.PPM())
+	}
+	// After 80s at 50 ppm, the sender is 4ms further ahead.
+	if want := offset + 4*time.Millisecond; d.Offset < want-time.Millisecond || d.Offset > want+time.Millisecond {
+		t.Errorf("got offset %v; want %v", d.Offset, want)
+	}
+	if d.Samples >= 4000 {
+		t.Errorf("got %d samples; want those of the last minute", d.Samples)
+	}
+	if got := d.Local(time.Second); got >= time.Second {
+		t.Errorf("a second of a fast sender lasts %v here; want less", got)
+	}
+
+	return e
+}
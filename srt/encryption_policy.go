@@ -0,0 +1,181 @@
+// Copyright (c) 2020 CyberAgent, Inc. All rights reserved.
+// https://github.com/openfresh/gosrt
+
+package srt
+
+import (
+	"context"
+	"errors"
+	"net"
+	"strconv"
+	"syscall"
+	"time"
+
+	"github.com/openfresh/gosrt/srtapi"
+)
+
+// cryptoModeGCM is the SRTO_CRYPTOMODE value of AES-GCM.
+const cryptoModeGCM = 2
+
+// EncryptionPolicy is the encryption a listener requires of its
+// callers. Its listen callback has the handshake of each caller enforce
+// the encryption and the cipher, so that SRT rejects the callers that
+// don't encrypt with RejectUnsecure, and those of another cipher, and
+// their dials fail with that reason. SRT lets the caller pick the key
+// length once the callback has run, so the policy is checked again on
+// each connection once it is established; a connection failing it is
+// closed before Accept would return it. Dials check only that the SRT
+// library can meet the policy. Listeners need
+// srtapi.FeatureListenCallback.
+type EncryptionPolicy struct {
+	// RequireEncryption rejects callers that don't encrypt.
+	RequireEncryption bool
+
+	// MinKeyLength rejects encrypting callers using keys shorter
+	// than this many bytes (16, 24 or 32). Zero accepts any length.
+	MinKeyLength int
+
+	// RequireGCM rejects callers not using AES-GCM. Listening with it
+	// fails if the SRT library lacks FeatureCryptoMode.
+	RequireGCM bool
+
+	// RequireFIPS refuses to listen or dial unless the crypto
+	// library of SRT runs in FIPS mode.
+	RequireFIPS bool
+
+	// Providers, if not empty, lists the crypto libraries (see
+	// srtapi.CryptoProvider) SRT may encrypt with; listening or
+	// dialing with any other fails.
+	Providers []string
+
+	// Audit, if not nil, is called with every decision of the
+	// policy, from the goroutine calling Accept.
+	Audit func(EncryptionDecision)
+}
+
+// EncryptionDecision is an audit record of an EncryptionPolicy
+// checking a connection.
+type EncryptionDecision struct {
+	Time     time.Time
+	Listener net.Addr
+	Peer     net.Addr
+	StreamID string
+
+	// KeyLength is the length in bytes of the connection's key, 0 if
+	// it isn't encrypted.
+	KeyLength int
+
+	// GCM reports whether the connection uses AES-GCM.
+	GCM bool
+
+	// Accepted reports whether the policy let the connection
+	// through. Otherwise Reason tells why not.
+	Accepted bool
+	Reason   string
+}
+
+// encryptionPolicyContextKey is the type of contextKeys used for
+// EncryptionPolicy.
+type encryptionPolicyContextKey struct{}
+
+// WithEncryptionPolicy returns a new context.Context with the
+// EncryptionPolicy enforced by the listeners and dials made with it.
+func WithEncryptionPolicy(ctx context.Context, policy *EncryptionPolicy) context.Context {
+	return context.WithValue(ctx, encryptionPolicyContextKey{}, policy)
+}
+
+func encryptionPolicyValue(ctx context.Context) *EncryptionPolicy {
+	policy, _ := ctx.Value(encryptionPolicyContextKey{}).(*EncryptionPolicy)
+	return policy
+}
+
+// ErrCryptoProvider is the error of listening or dialing with an
+// EncryptionPolicy the crypto library of SRT doesn't meet.
+var ErrCryptoProvider = errors.New("crypto provider doesn't meet the encryption policy")
+
+// supported reports an error if the SRT library can't tell what the
+// policy asks about, or can't meet it.
+func (p *EncryptionPolicy) supported() error {
+	if p.RequireGCM && !srtapi.Has(srtapi.FeatureCryptoMode) {
+		return srtapi.EINVOP
+	}
+	provider, fips := srtapi.CryptoProvider()
+	if p.RequireFIPS && !fips {
+		return ErrCryptoProvider
+	}
+	if len(p.Providers) == 0 {
+		return nil
+	}
+	for _, allowed := range p.Providers {
+		if provider == allowed {
+			return nil
+		}
+	}
+	return ErrCryptoProvider
+}
+
+// encrypts reports whether the policy requires encryption.
+func (p *EncryptionPolicy) encrypts() bool {
+	return p.RequireEncryption || p.MinKeyLength > 0 || p.RequireGCM
+}
+
+// enforce has the handshake of ns, a socket a listener is accepting,
+// reject the callers the policy turns down as far as SRT can tell
+// before the key exchange.
+func (p *EncryptionPolicy) enforce(ns int) error {
+	if !p.encrypts() {
+		return nil
+	}
+	if err := srtapi.SetsockoptBool(ns, 0, srtapi.OptionEnforcedencryption, true); err != nil {
+		return err
+	}
+	if p.RequireGCM {
+		return srtapi.SetsockoptInt(ns, 0, srtapi.OptionCryptomode, cryptoModeGCM)
+	}
+	return nil
+}
+
+// encryptionCallback returns the listen callback having the sockets
+// callback accepts enforce policy in their handshake.
+func encryptionCallback(callback srtapi.SrtListenCallbackFunc, policy *EncryptionPolicy) srtapi.SrtListenCallbackFunc {
+	return func(ns, hsversion int, peer syscall.Sockaddr, streamid string) int {
+		ret := 0
+		if callback != nil {
+			if ret = callback(ns, hsversion, peer, streamid); ret < 0 {
+				return ret
+			}
+		}
+		if err := policy.enforce(ns); err != nil {
+			return -1
+		}
+		return ret
+	}
+}
+
+// check decides on the accepted connection fd.
+func (p *EncryptionPolicy) check(fd *netFD) EncryptionDecision {
+	s := fd.pfd.Sysfd
+	d := EncryptionDecision{
+		Time:     time.Now(),
+		Listener: fd.laddr,
+		Peer:     fd.raddr,
+	}
+	d.StreamID, _ = srtapi.GetsockflagString(s, srtapi.OptionStreamid)
+	var cipher string
+	d.KeyLength, cipher = negotiatedCrypto(s)
+	d.GCM = cipher == CipherAESGCM
+	switch {
+	case d.KeyLength == 0 && p.encrypts():
+		d.Reason = "connection not encrypted"
+	case d.KeyLength < p.MinKeyLength:
+		d.Reason = "key length " + strconv.Itoa(d.KeyLength) + " below minimum " + strconv.Itoa(p.MinKeyLength)
+	case p.RequireGCM && !d.GCM:
+		d.Reason = "cipher is not AES-GCM"
+	default:
+		d.Accepted = true
+	}
+	if p.Audit != nil {
+		p.Audit(d)
+	}
+	return d
+}
@@ -0,0 +1,126 @@
+// Copyright (c) 2020 CyberAgent, Inc. All rights reserved.
+// https://github.com/openfresh/gosrt
+
+package srt
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/openfresh/gosrt/srtapi"
+)
+
+func TestEncryptionPolicy(t *testing.T) {
+	decisions := make(chan EncryptionDecision, 2)
+	policy := &EncryptionPolicy{
+		RequireEncryption: true,
+		MinKeyLength:      32,
+		Audit:             func(d EncryptionDecision) { decisions <- d },
+	}
+	ctx := WithEncryptionPolicy(context.Background(), policy)
+	ctx = WithOptions(ctx, Options("passphrase", "0123456789abcdef", "enforcedencryption", "false"))
+	ln, err := ListenContext(ctx, "srt4", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+
+	accepted := make(chan error, 1)
+	go func() {
+		c, err := ln.Accept()
+		if err == nil {
+			c.Close()
+		}
+		accepted <- err
+	}()
+
+	// The handshake turns down the callers that don't encrypt.
+	var d Dialer
+	if c, err := d.DialContext(WithOptions(context.Background(), Options("enforcedencryption", "false")), "srt", ln.Addr().String()); err == nil {
+		c.Close()
+		t.Error("unencrypted dial succeeded")
+	} else if rerr := (*RejectError)(nil); !errors.As(err, &rerr) || rerr.Reason != RejectUnsecure {
+		t.Errorf("got %v; want a rejection for %v", err, RejectUnsecure)
+	}
+
+	tests := []struct {
+		options   OptionSet
+		keyLength int
+		accepted  bool
+	}{
+		{Options("passphrase", "0123456789abcdef", "pbkeylen", "16"), 16, false},
+		{Options("passphrase", "0123456789abcdef", "pbkeylen", "32"), 32, true},
+	}
+	for i, tt := range tests {
+		c, err := d.DialContext(WithOptions(context.Background(), tt.options), "srt", ln.Addr().String())
+		if err != nil {
+			t.Fatalf("#%d: %v", i, err)
+		}
+		defer c.Close()
+		dec := <-decisions
+		if dec.Accepted != tt.accepted || dec.KeyLength != tt.keyLength {
+			t.Errorf("#%d: got accepted=%v key length %d; want accepted=%v key length %d", i, dec.Accepted, dec.KeyLength, tt.accepted, tt.keyLength)
+		}
+		if dec.Accepted == (dec.Reason != "") {
+			t.Errorf("#%d: accepted=%v with reason %q", i, dec.Accepted, dec.Reason)
+		}
+		if ua, _ := c.(*SRTConn).UDPAddr(); dec.Peer == nil || dec.Peer.String() != ua.String() {
+			t.Errorf("#%d: got peer %v; want %v", i, dec.Peer, ua)
+		}
+	}
+	if err := <-accepted; err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestEncryptionPolicyUnsupported(t *testing.T) {
+	if supported := (&EncryptionPolicy{RequireGCM: true}).supported() == nil; supported {
+		t.Skip("SRT library supports AES-GCM")
+	}
+	ctx := WithEncryptionPolicy(context.Background(), &EncryptionPolicy{RequireGCM: true})
+	ln, err := ListenContext(ctx, "srt4", "127.0.0.1:0")
+	if err == nil {
+		ln.Close()
+		t.Fatal("listen succeeded without AES-GCM support")
+	}
+	if perr := parseDialError(err); perr != nil {
+		t.Error(perr)
+	}
+}
+
+func TestEncryptionPolicyProviders(t *testing.T) {
+	provider, fips := srtapi.CryptoProvider()
+	ctx := WithEncryptionPolicy(context.Background(), &EncryptionPolicy{Providers: []string{provider}})
+	ln, err := ListenContext(ctx, "srt4", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+
+	policies := []*EncryptionPolicy{
+		{Providers: []string{"none"}},
+		{RequireFIPS: true},
+	}
+	for i, policy := range policies {
+		if policy.RequireFIPS && fips {
+			continue
+		}
+		ctx := WithEncryptionPolicy(context.Background(), policy)
+		if ln, err := ListenContext(ctx, "srt4", "127.0.0.1:0"); err == nil {
+			ln.Close()
+			t.Errorf("#%d: listen succeeded with crypto provider %q (FIPS %v)", i, provider, fips)
+		} else if !errors.Is(err, ErrCryptoProvider) {
+			t.Errorf("#%d: got %v; want ErrCryptoProvider", i, err)
+		}
+		var d Dialer
+		if c, err := d.DialContext(ctx, "srt", ln.Addr().String()); err == nil {
+			c.Close()
+			t.Errorf("#%d: dial succeeded with crypto provider %q (FIPS %v)", i, provider, fips)
+		} else if perr := parseDialError(err); perr != nil {
+			t.Errorf("#%d: %v", i, perr)
+		} else if !errors.Is(err, ErrCryptoProvider) {
+			t.Errorf("#%d: got %v; want ErrCryptoProvider", i, err)
+		}
+	}
+}
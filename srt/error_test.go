@@ -70,7 +70,7 @@ second:
 		return nil
 	}
 	switch err := nestedErr.(type) {
-	case *net.AddrError, *net.DNSError, net.InvalidAddrError, *net.ParseError, *poll.TimeoutError, net.UnknownNetworkError:
+	case *net.AddrError, *net.DNSError, net.InvalidAddrError, *net.ParseError, *poll.TimeoutError, net.UnknownNetworkError, *RejectError:
 		return nil
 	case *os.SyscallError:
 		nestedErr = err.Err
@@ -81,7 +81,7 @@ second:
 	}
 	switch nestedErr {
 	case errCanceled, poll.ErrNetClosing, errMissingAddress, errNoSuitableAddress,
-		context.DeadlineExceeded, context.Canceled:
+		context.DeadlineExceeded, context.Canceled, ErrCryptoProvider:
 		return nil
 	}
 	return fmt.Errorf("unexpected type on 2nd nested level: %T", nestedErr)
@@ -348,7 +348,7 @@ second:
 		goto third
 	}
 	switch nestedErr {
-	case poll.ErrNetClosing, poll.ErrTimeout:
+	case errCanceled, poll.ErrNetClosing, poll.ErrTimeout:
 		return nil
 	}
 	return fmt.Errorf("unexpected type on 2nd nested level: %T", nestedErr)
@@ -383,7 +383,7 @@ second:
 		return nil
 	}
 	switch err := nestedErr.(type) {
-	case *net.AddrError, *net.DNSError, net.InvalidAddrError, *net.ParseError, *poll.TimeoutError, net.UnknownNetworkError:
+	case *net.AddrError, *net.DNSError, net.InvalidAddrError, *net.ParseError, *poll.TimeoutError, net.UnknownNetworkError, *MessageTooLongError:
 		return nil
 	case *os.SyscallError:
 		nestedErr = err.Err
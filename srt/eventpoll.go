@@ -0,0 +1,143 @@
+// Copyright (c) 2020 CyberAgent, Inc. All rights reserved.
+// https://github.com/openfresh/gosrt
+
+package srt
+
+import (
+	"time"
+
+	"github.com/openfresh/gosrt/srtapi"
+)
+
+// eventPollInterval is how often the sockets of libsrt are polled for
+// the events it doesn't report.
+const eventPollInterval = 100 * time.Millisecond
+
+// An eventPoll makes up for the events the SRT library doesn't report
+// by polling the socket of a connection: the packets it drops as a
+// sender, from its statistics, and the changes of its key states,
+// where the steps of its key refreshes aren't reported. The drops of
+// the receiver are found by the recvSeq of the connection.
+type eventPoll struct {
+	fd    *netFD
+	drops bool
+	keys  bool
+
+	sndDropped       int64
+	sndKeys, rcvKeys keyState
+
+	done, stopped chan struct{}
+}
+
+// A keyState is the key state a direction of a connection was in at
+// the last poll, -1 until Events is called.
+type keyState struct {
+	opt    int
+	sender bool
+	state  int
+}
+
+func newEventPoll(fd *netFD) *eventPoll {
+	p := &eventPoll{
+		fd:      fd,
+		drops:   !hasReportsFunc(srtapi.FeatureDropEvents),
+		keys:    !hasReportsFunc(srtapi.FeatureKeyEvents),
+		sndKeys: keyState{opt: srtapi.OptionSndkmstate, sender: true, state: -1},
+		rcvKeys: keyState{opt: srtapi.OptionRcvkmstate, state: -1},
+		done:    make(chan struct{}),
+		stopped: make(chan struct{}),
+	}
+	if st, err := bistatsFunc(fd.pfd.Sysfd, false, false); err == nil {
+		p.sndDropped = st.Total.PacketsSendDropped
+	}
+	return p
+}
+
+func (p *eventPoll) run() {
+	defer close(p.stopped)
+	t := time.NewTicker(eventPollInterval)
+	defer t.Stop()
+	p.poll()
+	for {
+		select {
+		case <-t.C:
+			p.poll()
+		case <-p.done:
+			return
+		}
+	}
+}
+
+// stop stops p, polling a last time for the events since the previous
+// poll.
+func (p *eventPoll) stop() {
+	close(p.done)
+	<-p.stopped
+	p.poll()
+}
+
+func (p *eventPoll) poll() {
+	if p.keys && p.fd.listening() {
+		now := time.Now()
+		p.watch(&p.sndKeys, now)
+		p.watch(&p.rcvKeys, now)
+	}
+	if !p.drops {
+		return
+	}
+	st, err := bistatsFunc(p.fd.pfd.Sysfd, false, false)
+	if err != nil {
+		return
+	}
+	if n := st.Total.PacketsSendDropped - p.sndDropped; n > 0 {
+		p.fd.dropped(0, 0, int(n), true)
+	}
+	p.sndDropped = st.Total.PacketsSendDropped
+}
+
+// watch reports the key state of k if it changed since the last poll.
+func (p *eventPoll) watch(k *keyState, now time.Time) {
+	state, err := srtapi.GetsockflagInt(p.fd.pfd.Sysfd, k.opt)
+	if err != nil || state == k.state {
+		return
+	}
+	k.state = state
+	p.fd.sendEvent(ConnEvent{Type: EventKeyState, Time: now, Sender: k.sender, KeyState: state})
+}
+
+// startEventPoll has the socket of fd polled for the events the SRT
+// library doesn't report, until fd is closed, if it isn't already.
+func (fd *netFD) startEventPoll() {
+	if hasReportsFunc(srtapi.FeatureDropEvents) && hasReportsFunc(srtapi.FeatureKeyEvents) {
+		return
+	}
+	// Polling the socket must not be done with evmu held, which the
+	// callbacks of the pure Go implementation take with the socket
+	// locked.
+	fd.evmu.Lock()
+	started := fd.evPoll != nil || fd.evPollStopped
+	fd.evmu.Unlock()
+	if started {
+		return
+	}
+	p := newEventPoll(fd)
+	fd.evmu.Lock()
+	if fd.evPoll != nil || fd.evPollStopped {
+		fd.evmu.Unlock()
+		return
+	}
+	fd.evPoll = p
+	fd.evmu.Unlock()
+	go p.run()
+}
+
+// stopEventPoll stops the polling of startEventPoll, if started.
+func (fd *netFD) stopEventPoll() {
+	fd.evmu.Lock()
+	p := fd.evPoll
+	fd.evPoll, fd.evPollStopped = nil, true
+	fd.evmu.Unlock()
+	if p != nil {
+		p.stop()
+	}
+}
@@ -0,0 +1,84 @@
+// Copyright (c) 2020 CyberAgent, Inc. All rights reserved.
+// https://github.com/openfresh/gosrt
+
+package srt
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/openfresh/gosrt/srtapi"
+)
+
+func TestPolledSendDrops(t *testing.T) {
+	defer emulateReports()()
+	var dropped int64
+	origBistats := bistatsFunc
+	defer func() { bistatsFunc = origBistats }()
+	bistatsFunc = func(fd int, clear, instantaneous bool) (srtapi.Stats, error) {
+		st, err := origBistats(fd, clear, instantaneous)
+		st.Total.PacketsSendDropped += atomic.LoadInt64(&dropped)
+		return st, err
+	}
+
+	c1, c2, err := Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c1.Close()
+	defer c2.Close()
+	events, err := c1.Events()
+	if err != nil {
+		t.Fatal(err)
+	}
+	atomic.StoreInt64(&dropped, 3)
+	timeout := time.After(someTimeout)
+	for {
+		select {
+		case ev := <-events:
+			if ev.Type == EventKeyState {
+				continue
+			}
+			if ev.Type != EventDropped || !ev.Sender || ev.Packets != 3 {
+				t.Errorf("got %+v; want 3 packets dropped by the sender", ev)
+			}
+			return
+		case <-timeout:
+			t.Fatal("drop not reported")
+		}
+	}
+}
+
+func TestKeyStateEvents(t *testing.T) {
+	defer emulateReports()()
+	ctx := WithOptions(context.Background(), Options("passphrase", "0123456789abcdef"))
+	c1, c2, err := PipeContext(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c1.Close()
+	defer c2.Close()
+	events, err := c1.Events()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Both directions are reported as Events is called, sender first.
+	for _, sender := range []bool{true, false} {
+		select {
+		case ev := <-events:
+			if ev.Type != EventKeyState || ev.Sender != sender || ev.KeyState != srtapi.KmStateSecured || ev.Time.IsZero() {
+				t.Errorf("got %+v; want the secured state of the sender %v", ev, sender)
+			}
+		case <-time.After(someTimeout):
+			t.Fatal("key state not reported")
+		}
+	}
+	// Nothing more while the states stay the same.
+	select {
+	case ev := <-events:
+		t.Errorf("got %+v; want no event", ev)
+	case <-time.After(3 * eventPollInterval):
+	}
+}
@@ -0,0 +1,200 @@
+// Copyright (c) 2020 CyberAgent, Inc. All rights reserved.
+// https://github.com/openfresh/gosrt
+
+package srt
+
+import (
+	"time"
+
+	"github.com/openfresh/gosrt/srtapi"
+)
+
+// ConnEventType is the kind of a ConnEvent.
+type ConnEventType int
+
+const (
+	// EventKeyAnnounced reports a new encryption key sent to the
+	// peer, or received from it, ahead of its use.
+	EventKeyAnnounced ConnEventType = srtapi.KeyAnnounced
+
+	// EventKeySwitched reports packets starting to be sent, or first
+	// arriving, encrypted with the announced key.
+	EventKeySwitched ConnEventType = srtapi.KeySwitched
+
+	// EventKeyRetired reports the previous key being withdrawn.
+	EventKeyRetired ConnEventType = srtapi.KeyRetired
+
+	// EventDropped reports packets given up on as too late to be
+	// delivered in live mode (see the "tlpktdrop" option): by the
+	// sender, once they outlived the latency in its buffer, or by
+	// the receiver, for packets that were lost past their play time
+	// or that the sender dropped.
+	EventDropped ConnEventType = 16
+
+	// EventKeyState reports the key state of a direction of the
+	// connection, as Events is called and as it changes, with the SRT
+	// libraries that don't report the steps of the key refreshes.
+	EventKeyState ConnEventType = 17
+)
+
+func (t ConnEventType) String() string {
+	switch t {
+	case EventKeyAnnounced:
+		return "key announced"
+	case EventKeySwitched:
+		return "key switched"
+	case EventKeyRetired:
+		return "key retired"
+	case EventDropped:
+		return "dropped"
+	case EventKeyState:
+		return "key state"
+	}
+	return "event " + itoa(int(t))
+}
+
+// ConnEvent is an event of a connection, as delivered by Events.
+type ConnEvent struct {
+	Type ConnEventType
+	Time time.Time
+
+	// For key events, Key is the key, srtapi.KeyEven or
+	// srtapi.KeyOdd, and Sender reports whether it encrypts what this
+	// side sends rather than what it receives. For drop events,
+	// Sender reports whether the sending side of this connection
+	// dropped the packets.
+	Key    int
+	Sender bool
+
+	// For key state events, KeyState is the state, srtapi.KmStateSecured
+	// say, and Sender reports whether it is that of what this side
+	// sends rather than of what it receives.
+	KeyState int
+
+	// For drop events, FirstSeq and LastSeq are the sequence numbers
+	// of the range dropped, both included, and Packets the number of
+	// packets of the range dropped: those of the range received
+	// already are not. With libsrt, the drops of the sender have
+	// zero sequence numbers.
+	FirstSeq, LastSeq int32
+	Packets           int
+
+	// Labels are those of the connection.
+	Labels Labels
+}
+
+// eventBuffer is the number of events Events buffers.
+const eventBuffer = 64
+
+// Events returns the channel on which the events of the connection
+// are delivered: the steps of each key refresh (see the
+// "kmrefreshrate" and "kmpreannounce" options), and the packets
+// dropped as too late, as they are dropped rather than once the
+// decoder shows it. Events that find the channel full are dropped.
+// The channel is closed when the connection is.
+//
+// libsrt doesn't report these events. As it doesn't tell of the steps
+// of its key refreshes, the connection delivers EventKeyState events
+// instead, which tell of the key states libsrt tracks: that of each
+// direction as Events is called, and each change of one. It makes up
+// for the drops: it finds the packets dropped on reception in live
+// mode from the sequence numbers of the messages it reads, which libsrt
+// skips them in, so the first message read after them reports them.
+// It polls its socket every 100ms for the key states and for the
+// packets dropped on sending, of which the drop counter of the
+// statistics tells the number but not the sequence numbers.
+func (c *conn) Events() (<-chan ConnEvent, error) {
+	if !c.ok() {
+		return nil, srtapi.EINVPARAM
+	}
+	ch, err := c.fd.eventChan()
+	if err != nil {
+		return nil, &OpError{Op: "events", Net: c.fd.net, Source: c.fd.laddr, Addr: c.fd.raddr, Err: err}
+	}
+	return ch, nil
+}
+
+func (fd *netFD) eventChan() (chan ConnEvent, error) {
+	fd.evmu.Lock()
+	if fd.events != nil {
+		defer fd.evmu.Unlock()
+		return fd.events, nil
+	}
+	ch := make(chan ConnEvent, eventBuffer)
+	fd.events = ch
+	fd.evmu.Unlock()
+
+	// The callbacks run with the SRT socket locked, and take evmu,
+	// so evmu must not be held while installing them.
+	var err error
+	if hasReportsFunc(srtapi.FeatureKeyEvents) {
+		err = srtapi.KeyEventCallback(fd.pfd.Sysfd, func(event, key int, sender bool) {
+			fd.sendEvent(ConnEvent{Type: ConnEventType(event), Time: time.Now(), Key: key, Sender: sender})
+		})
+	}
+	if err == nil && hasReportsFunc(srtapi.FeatureDropEvents) {
+		err = srtapi.DropEventCallback(fd.pfd.Sysfd, fd.dropped)
+	}
+	if err != nil {
+		fd.evmu.Lock()
+		fd.events = nil
+		fd.evmu.Unlock()
+		return nil, err
+	}
+	fd.startEventPoll()
+	return ch, nil
+}
+
+// dropped is the callback of the packets fd drops, which logs them and
+// delivers their event.
+func (fd *netFD) dropped(first, last int32, packets int, sender bool) {
+	fd.logf(LogPacketDrop, "srt packets dropped", "first", first, "last", last, "packets", packets, "sender", sender)
+	fd.sendEvent(ConnEvent{Type: EventDropped, Time: time.Now(), Sender: sender, FirstSeq: first, LastSeq: last, Packets: packets})
+}
+
+// logDrops has the packets fd drops logged, if a LogLimiter or a
+// connection logger is set, before Events is called.
+func (fd *netFD) logDrops() {
+	if loggerValue() == nil && fd.logger == nil {
+		return
+	}
+	if hasReportsFunc(srtapi.FeatureDropEvents) {
+		srtapi.DropEventCallback(fd.pfd.Sysfd, fd.dropped)
+	} else {
+		fd.startEventPoll()
+	}
+}
+
+// listening reports whether Events was called on fd, and fd isn't
+// closed.
+func (fd *netFD) listening() bool {
+	fd.evmu.Lock()
+	defer fd.evmu.Unlock()
+	return fd.events != nil && !fd.evClosed
+}
+
+// sendEvent delivers ev unless the channel is full or closed, or
+// Events wasn't called.
+func (fd *netFD) sendEvent(ev ConnEvent) {
+	fd.evmu.Lock()
+	defer fd.evmu.Unlock()
+	if fd.evClosed || fd.events == nil {
+		return
+	}
+	ev.Labels = fd.getLabels()
+	select {
+	case fd.events <- ev:
+	default:
+		fd.logf(LogEventDrop, "srt event dropped", "event", ev.Type.String())
+	}
+}
+
+func (fd *netFD) closeEvents() {
+	fd.stopEventPoll()
+	fd.evmu.Lock()
+	defer fd.evmu.Unlock()
+	if fd.events != nil && !fd.evClosed {
+		close(fd.events)
+	}
+	fd.evClosed = true
+}
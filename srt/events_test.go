@@ -0,0 +1,112 @@
+// Copyright (c) 2020 CyberAgent, Inc. All rights reserved.
+// https://github.com/openfresh/gosrt
+
+package srt
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/openfresh/gosrt/srtapi"
+)
+
+func TestKeyRefreshEvents(t *testing.T) {
+	if !srtapi.Has(srtapi.FeatureKeyEvents) {
+		t.Skip("SRT library doesn't report key refreshes")
+	}
+	testKeyRefreshEvents(t)
+}
+
+func testKeyRefreshEvents(t *testing.T) {
+	ctx := WithOptions(context.Background(), Options("passphrase", "0123456789abcdef"))
+	ln, err := ListenContext(ctx, "srt4", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+
+	ctx = WithOptions(ctx, Options("kmrefreshrate", "8", "kmpreannounce", "2"))
+	var d Dialer
+	c, err := d.DialContext(ctx, "srt", ln.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	events, err := c.(*SRTConn).Events()
+	if err != nil {
+		t.Fatal(err)
+	}
+	a, err := ln.Accept()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer a.Close()
+
+	// The 9th packet switches to the new key, the 11th retires the
+	// old one.
+	for i := 0; i < 12; i++ {
+		if _, err := c.Write([]byte("KEY REFRESH TEST")); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// Once the packets are read, their sender counted them all.
+	b := make([]byte, 1500)
+	a.SetReadDeadline(time.Now().Add(someTimeout))
+	for i := 0; i < 12; i++ {
+		if _, err := a.Read(b); err != nil {
+			t.Fatal(err)
+		}
+	}
+	c.Close()
+
+	var got []ConnEventType
+	for ev := range events {
+		if !ev.Sender || ev.Time.IsZero() {
+			t.Errorf("got %+v; want a sender event", ev)
+		}
+		got = append(got, ev.Type)
+	}
+	want := []ConnEventType{EventKeyAnnounced, EventKeySwitched, EventKeyRetired}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v; want %v", got, want)
+	}
+}
+
+func TestEventsClosed(t *testing.T) {
+	testEventsClosed(t)
+	defer emulateReports()()
+	testEventsClosed(t)
+}
+
+func testEventsClosed(t *testing.T) {
+	ln, err := newLocalListener("srt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	c, err := Dial("srt", ln.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	events, err := c.(*SRTConn).Events()
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.Close()
+	timeout := time.After(time.Second)
+	for {
+		select {
+		case ev, ok := <-events:
+			if !ok {
+				return
+			}
+			// The key states with libsrt, polled before the close.
+			if ev.Type != EventKeyState {
+				t.Errorf("got %+v; want the channel closed", ev)
+			}
+		case <-timeout:
+			t.Fatal("channel not closed with the connection")
+		}
+	}
+}
@@ -0,0 +1,247 @@
+// Copyright (c) 2020 CyberAgent, Inc. All rights reserved.
+// https://github.com/openfresh/gosrt
+
+package srt
+
+import (
+	"io"
+	"reflect"
+	"sync"
+	"sync/atomic"
+)
+
+// DefaultFanOutQueueLen is the queue length of a FanOutWriter created
+// with a queue length of 0.
+const DefaultFanOutQueueLen = 64
+
+// A FanOutWriter writes each message it is given to a set of
+// destinations, the SRT connections of the viewers of a stream say.
+// The message is copied once, into a pooled buffer the destinations
+// share, and each destination is written to by a goroutine of its own
+// from a queue of its own, so that a slow or broken one holds up
+// neither Write nor the others: a message finding the queue of a
+// destination full is dropped for it, and a destination whose write
+// fails is removed.
+type FanOutWriter struct {
+	// OnError, if set, is called with the destinations removed after a
+	// failed write, and their error. It must be set before the first
+	// Add.
+	OnError func(dst io.Writer, err error)
+
+	queueLen int
+	pool     sync.Pool
+
+	mu     sync.RWMutex
+	dests  map[uint64]*fanOutDest // by id, any io.Writer not being a valid key
+	nextID uint64
+	closed bool
+	wg     sync.WaitGroup
+}
+
+// FanOutStats are the counters of a destination of a FanOutWriter.
+type FanOutStats struct {
+	Sent    uint64 // messages written
+	Dropped uint64 // messages dropped, the queue being full
+	Queued  int    // messages waiting in the queue
+}
+
+type fanOutDest struct {
+	id      uint64
+	dst     io.Writer
+	q       chan *fanOutBuf
+	sent    uint64
+	dropped uint64
+}
+
+// A fanOutBuf is a message shared by the destinations it is queued
+// for, and goes back to the pool once they all wrote it.
+type fanOutBuf struct {
+	b    []byte
+	refs int32
+	pool *sync.Pool
+}
+
+func (b *fanOutBuf) release() {
+	if atomic.AddInt32(&b.refs, -1) == 0 {
+		b.pool.Put(b)
+	}
+}
+
+// NewFanOutWriter returns a FanOutWriter queueing up to queueLen
+// messages per destination, or DefaultFanOutQueueLen if queueLen is 0.
+func NewFanOutWriter(queueLen int) *FanOutWriter {
+	if queueLen <= 0 {
+		queueLen = DefaultFanOutQueueLen
+	}
+	w := &FanOutWriter{queueLen: queueLen, dests: make(map[uint64]*fanOutDest)}
+	w.pool.New = func() interface{} { return &fanOutBuf{b: make([]byte, 0, 1500), pool: &w.pool} }
+	return w
+}
+
+// Add adds dst to the destinations, which receives the messages of
+// the following writes. Adding a destination twice, or to a closed
+// FanOutWriter, does nothing. A destination is the same as another if
+// they are equal, or, for the types that can't be compared, if they
+// are the same func, map or slice; other values of such types, as
+// structs holding a slice, are told apart from all others.
+func (w *FanOutWriter) Add(dst io.Writer) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.closed || w.find(dst) != nil {
+		return
+	}
+	w.nextID++
+	d := &fanOutDest{id: w.nextID, dst: dst, q: make(chan *fanOutBuf, w.queueLen)}
+	w.dests[d.id] = d
+	w.wg.Add(1)
+	go w.run(d)
+}
+
+// Remove removes dst from the destinations. The messages already
+// queued for it are dropped; a write in progress is not interrupted.
+func (w *FanOutWriter) Remove(dst io.Writer) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if d := w.find(dst); d != nil {
+		delete(w.dests, d.id)
+		close(d.q)
+	}
+}
+
+// find returns the destination of dst, nil if there is none. w.mu must
+// be held.
+func (w *FanOutWriter) find(dst io.Writer) *fanOutDest {
+	for _, d := range w.dests {
+		if sameWriter(d.dst, dst) {
+			return d
+		}
+	}
+	return nil
+}
+
+// sameWriter reports whether a and b are the same destination, as Add
+// tells, without the panic of comparing values of a type that can't be.
+func sameWriter(a, b io.Writer) bool {
+	ta, tb := reflect.TypeOf(a), reflect.TypeOf(b)
+	if ta != tb {
+		return false
+	}
+	if ta == nil || ta.Comparable() {
+		return a == b
+	}
+	va, vb := reflect.ValueOf(a), reflect.ValueOf(b)
+	switch ta.Kind() {
+	case reflect.Func, reflect.Map:
+		return va.Pointer() == vb.Pointer()
+	case reflect.Slice:
+		return va.Pointer() == vb.Pointer() && va.Len() == vb.Len()
+	}
+	return false
+}
+
+// Len returns the number of destinations.
+func (w *FanOutWriter) Len() int {
+	w.mu.RLock()
+	defer w.mu.RUnlock()
+	return len(w.dests)
+}
+
+// Stats returns the counters of dst, and whether it is a destination.
+func (w *FanOutWriter) Stats(dst io.Writer) (FanOutStats, bool) {
+	w.mu.RLock()
+	defer w.mu.RUnlock()
+	d := w.find(dst)
+	if d == nil {
+		return FanOutStats{}, false
+	}
+	return FanOutStats{
+		Sent:    atomic.LoadUint64(&d.sent),
+		Dropped: atomic.LoadUint64(&d.dropped),
+		Queued:  len(d.q),
+	}, true
+}
+
+// Write queues p, as one message, for each destination, and returns
+// len(p) without waiting for the destinations to write it; it only
+// fails once w is closed.
+func (w *FanOutWriter) Write(p []byte) (int, error) {
+	w.mu.RLock()
+	defer w.mu.RUnlock()
+	if w.closed {
+		return 0, ErrClosed
+	}
+	if len(w.dests) == 0 {
+		return len(p), nil
+	}
+	b := w.pool.Get().(*fanOutBuf)
+	b.b = append(b.b[:0], p...)
+	b.refs = int32(len(w.dests)) + 1
+	for _, d := range w.dests {
+		select {
+		case d.q <- b:
+		default:
+			atomic.AddUint64(&d.dropped, 1)
+			b.release()
+		}
+	}
+	b.release()
+	return len(p), nil
+}
+
+// Close removes the destinations, and waits for their writes in
+// progress to return. It doesn't close the destinations.
+func (w *FanOutWriter) Close() error {
+	w.mu.Lock()
+	if w.closed {
+		w.mu.Unlock()
+		return ErrClosed
+	}
+	w.closed = true
+	for id, d := range w.dests {
+		delete(w.dests, id)
+		close(d.q)
+	}
+	w.mu.Unlock()
+	w.wg.Wait()
+	return nil
+}
+
+// run writes the messages queued for d until it is removed.
+func (w *FanOutWriter) run(d *fanOutDest) {
+	defer w.wg.Done()
+	for b := range d.q {
+		if w.removed(d) {
+			b.release()
+			continue
+		}
+		_, err := d.dst.Write(b.b)
+		b.release()
+		if err != nil {
+			w.fail(d, err)
+			continue
+		}
+		atomic.AddUint64(&d.sent, 1)
+	}
+}
+
+// removed reports whether d is no longer a destination.
+func (w *FanOutWriter) removed(d *fanOutDest) bool {
+	w.mu.RLock()
+	defer w.mu.RUnlock()
+	return w.dests[d.id] != d
+}
+
+// fail removes d after its write failed with err.
+func (w *FanOutWriter) fail(d *fanOutDest, err error) {
+	w.mu.Lock()
+	if w.dests[d.id] != d {
+		w.mu.Unlock()
+		return
+	}
+	delete(w.dests, d.id)
+	close(d.q)
+	w.mu.Unlock()
+	if w.OnError != nil {
+		w.OnError(d.dst, err)
+	}
+}
@@ -0,0 +1,173 @@
+// Copyright (c) 2020 CyberAgent, Inc. All rights reserved.
+// https://github.com/openfresh/gosrt
+
+package srt
+
+import (
+	"errors"
+	"io"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fanOutDst records the messages written to it, after waiting for
+// unblock if set, and fails once it holds max messages if max is set.
+type fanOutDst struct {
+	mu      sync.Mutex
+	msgs    []string
+	max     int
+	unblock chan struct{}
+}
+
+func (d *fanOutDst) Write(p []byte) (int, error) {
+	if d.unblock != nil {
+		<-d.unblock
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.max > 0 && len(d.msgs) >= d.max {
+		return 0, errors.New("broken")
+	}
+	d.msgs = append(d.msgs, string(p))
+	return len(p), nil
+}
+
+func (d *fanOutDst) len() int {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return len(d.msgs)
+}
+
+func TestFanOutWriter(t *testing.T) {
+	w := NewFanOutWriter(4)
+	failed := make(chan io.Writer, 1)
+	w.OnError = func(dst io.Writer, err error) { failed <- dst }
+
+	fast := &fanOutDst{}
+	slow := &fanOutDst{unblock: make(chan struct{})}
+	broken := &fanOutDst{max: 2}
+	for _, d := range []*fanOutDst{fast, slow, broken, fast} {
+		w.Add(d)
+	}
+	if w.Len() != 3 {
+		t.Fatalf("Len() = %d; want 3", w.Len())
+	}
+
+	b := make([]byte, 1)
+	for i := 0; i < 10; i++ {
+		b[0] = byte('0' + i)
+		if n, err := w.Write(b); n != 1 || err != nil {
+			t.Fatalf("Write: %d, %v", n, err)
+		}
+		// The writer reuses its buffer.
+		b[0] = 'x'
+		for deadline := time.Now().Add(time.Second); fast.len() < i+1; time.Sleep(time.Millisecond) {
+			if time.Now().After(deadline) {
+				t.Fatalf("fast destination got %d messages; want %d", fast.len(), i+1)
+			}
+		}
+		for deadline := time.Now().Add(time.Second); i == 0; time.Sleep(time.Millisecond) {
+			if st, _ := w.Stats(slow); st.Queued == 0 {
+				break
+			}
+			if time.Now().After(deadline) {
+				t.Fatal("slow destination not writing")
+			}
+		}
+	}
+	fast.mu.Lock()
+	got := fast.msgs
+	fast.mu.Unlock()
+	if len(got) != 10 || got[0] != "0" || got[9] != "9" {
+		t.Errorf("fast destination got %q", got)
+	}
+
+	// The broken destination is removed after its third write.
+	select {
+	case dst := <-failed:
+		if dst != broken {
+			t.Errorf("OnError called for %v; want the broken destination", dst)
+		}
+	case <-time.After(someTimeout):
+		t.Fatal("broken destination not removed")
+	}
+	if _, ok := w.Stats(broken); ok {
+		t.Error("broken destination still there")
+	}
+
+	// The slow destination is writing the first message, holds 4 more
+	// in its queue, and missed the others.
+	st, ok := w.Stats(slow)
+	if !ok || st.Dropped != 5 || st.Queued != 4 {
+		t.Errorf("slow destination stats %+v, %v; want 5 dropped, 4 queued", st, ok)
+	}
+	close(slow.unblock)
+	w.Remove(fast)
+	if w.Close() != nil {
+		t.Error("Close failed")
+	}
+	if _, err := w.Write(b); err != ErrClosed {
+		t.Errorf("Write after Close: %v; want ErrClosed", err)
+	}
+	if w.Len() != 0 {
+		t.Errorf("Len() = %d after Close", w.Len())
+	}
+}
+
+// fanOutFunc is a destination of a type that can't be compared.
+type fanOutFunc func(p []byte) (int, error)
+
+func (f fanOutFunc) Write(p []byte) (int, error) { return f(p) }
+
+// fanOutValue is a destination whose values can't be compared.
+type fanOutValue struct {
+	got chan string
+	_   []byte
+}
+
+func (d fanOutValue) Write(p []byte) (int, error) {
+	d.got <- string(p)
+	return len(p), nil
+}
+
+func TestFanOutWriterIncomparable(t *testing.T) {
+	w := NewFanOutWriter(4)
+	defer w.Close()
+	got := make(chan string, 4)
+	f := fanOutFunc(func(p []byte) (int, error) {
+		got <- "func " + string(p)
+		return len(p), nil
+	})
+	v := fanOutValue{got: got}
+	for _, d := range []io.Writer{f, v, f} {
+		w.Add(d)
+	}
+	if w.Len() != 2 {
+		t.Fatalf("Len() = %d; want 2", w.Len())
+	}
+	if _, ok := w.Stats(f); !ok {
+		t.Error("no stats for the func destination")
+	}
+	if _, ok := w.Stats(v); ok {
+		t.Error("got stats for a value that can't be told apart")
+	}
+	w.Write([]byte("x"))
+	msgs := map[string]bool{}
+	for i := 0; i < 2; i++ {
+		select {
+		case m := <-got:
+			msgs[m] = true
+		case <-time.After(time.Second):
+			t.Fatalf("got %v; want both destinations written", msgs)
+		}
+	}
+	if !msgs["x"] || !msgs["func x"] {
+		t.Errorf("got %v; want both destinations written", msgs)
+	}
+	w.Remove(f)
+	w.Remove(v)
+	if w.Len() != 1 {
+		t.Errorf("Len() = %d after Remove; want 1, the value staying", w.Len())
+	}
+}
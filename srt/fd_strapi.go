@@ -14,7 +14,10 @@ import (
 	"net"
 	"os"
 	"runtime"
+	"sync"
+	"sync/atomic"
 	"syscall"
+	"time"
 
 	"github.com/openfresh/gosrt/internal/poll"
 	"github.com/openfresh/gosrt/srtapi"
@@ -31,6 +34,77 @@ type netFD struct {
 	net         string
 	laddr       net.Addr
 	raddr       net.Addr
+
+	// the members of a group dial, nil for a single socket
+	group *groupDial
+
+	// deadlines set by the user, restored after a context interrupt
+	dlmu      sync.Mutex
+	rdeadline time.Time
+	wdeadline time.Time
+
+	// oversize payload handling, see PayloadPolicy
+	payloadPolicy int32
+	payloadOnce   sync.Once
+	payloadSize   int
+
+	// the low watermark of reads, see SetMinRead
+	minRead int32
+
+	// connection events, see Events, and the polling of the socket
+	// for those the SRT library doesn't report
+	evmu          sync.Mutex
+	events        chan ConnEvent
+	evClosed      bool
+	evPoll        *eventPoll
+	evPollStopped bool
+
+	// the sequence numbers of the packets read, followed if the SRT
+	// library doesn't report drops and gaps; set before the
+	// connection is returned
+	rseq *recvSeq
+
+	// delivery reports, see Deliveries
+	dlvmu      sync.Mutex
+	deliveries chan Delivery
+	dlvQueue   []Delivery
+	dlvWake    chan struct{}
+	dlvDone    chan struct{}
+	dlvClosed  bool
+
+	// the Taps of the connection, and their count for reads and
+	// writes to check without taking tapmu
+	tapmu     sync.Mutex
+	taps      []*Tap
+	ntaps     int32
+	tapClosed bool
+
+	// messages held back by Peek, and their count for reads to check
+	// without taking peekmu
+	peekmu  sync.Mutex
+	peeked  [][]byte
+	npeeked int32
+
+	// the Registry the connection or listener is in, set before it
+	// is returned
+	registry *Registry
+
+	// the connection logger, see WithConnLogger, set before it is
+	// returned
+	logger Logger
+
+	// the Labels of the connection or listener, replaced whole by
+	// SetLabel under labelmu
+	labelmu sync.Mutex
+	labels  atomic.Value
+
+	// the listen callback of a listener, installed with libsrt if
+	// listenInstalled, and the AcceptHook it runs, replaced whole by
+	// SetAcceptHook under hookmu
+	hookmu          sync.Mutex
+	listenCb        srtapi.SrtListenCallbackFunc
+	listenInstalled bool
+	acceptHook      atomic.Value
 }
 
 func newFD(sysfd, family, sotype int, net string) (*netFD, error) {
@@ -56,10 +130,14 @@ func (fd *netFD) setAddr(laddr, raddr net.Addr) {
 }
 
 func (fd *netFD) connect(ctx context.Context, la, ra syscall.Sockaddr) (rsa syscall.Sockaddr, ret error) {
-	if err := connectFunc(fd.pfd.Sysfd, ra); err != nil {
+	if fd.group != nil {
+		if err := srtapi.ConnectGroup(fd.pfd.Sysfd, fd.group.members); err != nil {
+			return nil, os.NewSyscallError("srt_connect_group", err)
+		}
+	} else if err := connectFunc(fd.pfd.Sysfd, ra); err != nil {
 		return nil, os.NewSyscallError("connect", err)
 	}
-	state, err := getsockoptIntFunc(fd.pfd.Sysfd, 0, srtapi.OptionState)
+	state, err := fd.state()
 	if err != nil {
 		return nil, os.NewSyscallError("getsockopt", err)
 	}
@@ -67,6 +145,14 @@ func (fd *netFD) connect(ctx context.Context, la, ra syscall.Sockaddr) (rsa sysc
 	case srtapi.StatusConnecting:
 	case srtapi.StatusConnected:
 		return nil, nil
+	case srtapi.StatusBroken:
+		if established(fd.pfd.Sysfd) {
+			return nil, nil
+		}
+		if err := rejectError(fd.pfd.Sysfd); err != nil {
+			return nil, err
+		}
+		return nil, fmt.Errorf("unexpected socket state %d", state)
 	default:
 		return nil, fmt.Errorf("unexpected socket state %d", state)
 	}
@@ -126,7 +212,7 @@ func (fd *netFD) connect(ctx context.Context, la, ra syscall.Sockaddr) (rsa sysc
 			}
 			return nil, err
 		}
-		state, err := getsockoptIntFunc(fd.pfd.Sysfd, 0, srtapi.OptionState)
+		state, err := fd.state()
 		if err != nil {
 			return nil, os.NewSyscallError("getsockopt", err)
 		}
@@ -134,27 +220,170 @@ func (fd *netFD) connect(ctx context.Context, la, ra syscall.Sockaddr) (rsa sysc
 		case srtapi.StatusConnecting:
 		case srtapi.StatusConnected:
 			return nil, nil
+		case srtapi.StatusBroken:
+			if established(fd.pfd.Sysfd) {
+				return nil, nil
+			}
+			if err := rejectError(fd.pfd.Sysfd); err != nil {
+				return nil, err
+			}
+			return nil, fmt.Errorf("unexpected socket state %d", state)
 		default:
 			return nil, fmt.Errorf("unexpected socket state %d", state)
 		}
 	}
 }
 
+// state returns the state of the socket, or of the group, which
+// doesn't have the SRTO_STATE option.
+func (fd *netFD) state() (int, error) {
+	if fd.group != nil {
+		return srtapi.Getsockstate(fd.pfd.Sysfd), nil
+	}
+	return getsockoptIntFunc(fd.pfd.Sysfd, 0, srtapi.OptionState)
+}
+
+// established reports whether the broken socket fd completed its
+// handshake before breaking, which happens when the peer closes the
+// connection right after accepting it. Like a TCP dial, that dial
+// succeeds, and the first read or write reports the loss. The peer
+// version is only known once the handshake completed.
+func established(fd int) bool {
+	v, err := getsockoptIntFunc(fd, 0, srtapi.OptionPeerversion)
+	return err == nil && v != 0
+}
+
 func (fd *netFD) Close() error {
 	runtime.SetFinalizer(fd, nil)
+	fd.closeEvents()
+	fd.closeDeliveries()
+	fd.closeTaps()
+	fd.deregister()
 	return fd.pfd.Close()
 }
 
 func (fd *netFD) Read(p []byte) (n int, err error) {
-	n, err = fd.pfd.Read(p)
-	return n, wrapSyscallError("read", err)
+	if min := atomic.LoadInt32(&fd.minRead); min > 0 {
+		return fd.readMin(p, int(min))
+	}
+	return fd.read(p)
+}
+
+// read reads one message.
+func (fd *netFD) read(p []byte) (n int, err error) {
+	n, ok := fd.readPeeked(p)
+	if !ok {
+		if n, err = fd.readPfd(p); err != nil {
+			return n, wrapSyscallError("read", err)
+		}
+	}
+	fd.tap(TapInbound, p[:n], time.Time{}, 0)
+	return n, nil
 }
 
 func (fd *netFD) Write(p []byte) (nn int, err error) {
+	if policy := PayloadPolicy(atomic.LoadInt32(&fd.payloadPolicy)); policy != PayloadPassThrough {
+		if limit := fd.payloadLimit(); limit > 0 && len(p) > limit {
+			if policy == PayloadFailFast {
+				return 0, &MessageTooLongError{Size: len(p), Limit: limit}
+			}
+			nn, err = fd.writeSplit(p, limit)
+			return nn, wrapSyscallError("write", err)
+		}
+	}
 	nn, err = fd.pfd.Write(p)
+	if err == nil {
+		fd.tap(TapOutbound, p, time.Time{}, 0)
+	}
 	return nn, wrapSyscallError("write", err)
 }
 
+func (fd *netFD) readContext(ctx context.Context, p []byte) (n int, err error) {
+	if err := ctx.Err(); err != nil {
+		return 0, mapErr(err)
+	}
+	stop := fd.interruptOn(ctx, 'r')
+	n, err = fd.Read(p)
+	if ctxErr := stop(); ctxErr != nil && err != nil {
+		err = mapErr(ctxErr)
+	}
+	return n, err
+}
+
+func (fd *netFD) writeContext(ctx context.Context, p []byte) (nn int, err error) {
+	if err := ctx.Err(); err != nil {
+		return 0, mapErr(err)
+	}
+	stop := fd.interruptOn(ctx, 'w')
+	nn, err = fd.Write(p)
+	if ctxErr := stop(); ctxErr != nil && err != nil {
+		err = mapErr(ctxErr)
+	}
+	return nn, err
+}
+
+// interruptOn starts the "interrupter" goroutine for I/O in the given
+// mode. Once ctx is done, it forces the poller to give up waiting, the
+// same way connect does for a canceled dial. The returned stop function
+// must be called after the I/O has returned; it reports the context's
+// error if the I/O was interrupted, in which case the deadline set by
+// the user is put back so the connection remains usable.
+func (fd *netFD) interruptOn(ctx context.Context, mode int) (stop func() error) {
+	if ctx.Done() == nil {
+		return func() error { return nil }
+	}
+	done := make(chan struct{})
+	interruptRes := make(chan error)
+	go func() {
+		select {
+		case <-ctx.Done():
+			if mode == 'r' {
+				fd.pfd.SetReadDeadline(aLongTimeAgo)
+			} else {
+				fd.pfd.SetWriteDeadline(aLongTimeAgo)
+			}
+			interruptRes <- ctx.Err()
+		case <-done:
+			interruptRes <- nil
+		}
+	}()
+	return func() error {
+		close(done)
+		ctxErr := <-interruptRes
+		if ctxErr != nil {
+			fd.dlmu.Lock()
+			if mode == 'r' {
+				fd.pfd.SetReadDeadline(fd.rdeadline)
+			} else {
+				fd.pfd.SetWriteDeadline(fd.wdeadline)
+			}
+			fd.dlmu.Unlock()
+		}
+		return ctxErr
+	}
+}
+
+func (fd *netFD) setDeadline(t time.Time) error {
+	fd.dlmu.Lock()
+	defer fd.dlmu.Unlock()
+	fd.rdeadline, fd.wdeadline = t, t
+	return fd.pfd.SetDeadline(t)
+}
+
+func (fd *netFD) setReadDeadline(t time.Time) error {
+	fd.dlmu.Lock()
+	defer fd.dlmu.Unlock()
+	fd.rdeadline = t
+	return fd.pfd.SetReadDeadline(t)
+}
+
+func (fd *netFD) setWriteDeadline(t time.Time) error {
+	fd.dlmu.Lock()
+	defer fd.dlmu.Unlock()
+	fd.wdeadline = t
+	return fd.pfd.SetWriteDeadline(t)
+}
+
 func (fd *netFD) accept() (netfd *netFD, err error) {
 	d, rsa, errcall, err := fd.pfd.Accept()
 	if err != nil {
@@ -169,7 +398,7 @@ func (fd *netFD) accept() (netfd *netFD, err error) {
 		return nil, err
 	}
 	if err = netfd.init(); err != nil {
-		fd.Close()
+		netfd.Close()
 		return nil, err
 	}
 	lsa, _ := srtapi.Getsockname(netfd.pfd.Sysfd)
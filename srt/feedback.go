@@ -0,0 +1,159 @@
+// Copyright (c) 2020 CyberAgent, Inc. All rights reserved.
+// https://github.com/openfresh/gosrt
+
+package srt
+
+import (
+	"context"
+	"time"
+
+	"github.com/openfresh/gosrt/internal/poll/runtime"
+	"github.com/openfresh/gosrt/srtapi"
+)
+
+// DefaultFeedbackInterval is the interval of Feedback with an interval
+// of 0.
+const DefaultFeedbackInterval = time.Second
+
+// Feedback is the state of the sending side of a connection over an
+// interval, as Feedback reports it to drive an adaptive encoder. Data
+// that stays in the send buffer past the latency is dropped in live
+// mode; an encoder lowering its bitrate as the buffer delay grows, or
+// losses climb, avoids the drops.
+type Feedback struct {
+	Time time.Time
+
+	// BufferFill is the fraction of the send buffer in use.
+	BufferFill float64
+
+	// BufferDelay is the age of the oldest data not acknowledged
+	// yet, one round trip when the link keeps up.
+	BufferDelay time.Duration
+
+	Latency time.Duration
+	RTT     time.Duration
+
+	// Capacity is the link capacity libsrt estimates, in Mbit/s; 0
+	// when unknown, always with the pure Go implementation.
+	Capacity float64
+
+	// SendRate is what was sent over the interval, retransmissions
+	// included, in Mbit/s.
+	SendRate float64
+
+	// LossRate is the fraction of the packets sent over the interval
+	// the peer reported lost, and LossTrend how far above its moving
+	// average it is: positive while losses grow.
+	LossRate  float64
+	LossTrend float64
+
+	// Dropped is the number of packets dropped over the interval for
+	// being too late.
+	Dropped int64
+
+	// Bitrate is a conservative bitrate to encode at, in Mbit/s,
+	// from the other fields: lower than SendRate under pressure,
+	// slightly higher when the link has room, 0 while nothing is
+	// sent.
+	Bitrate float64
+}
+
+// lossAvgWeight is the weight of each interval in the moving average
+// of the loss rate.
+const lossAvgWeight = 0.2
+
+// Feedback returns a channel receiving the Feedback of the connection
+// every interval, until ctx is done or the connection is closed, when
+// it is closed. A receiver that falls behind gets the latest Feedback
+// only. An interval of 0 means DefaultFeedbackInterval.
+func (c *conn) Feedback(ctx context.Context, interval time.Duration) (<-chan Feedback, error) {
+	if !c.ok() {
+		return nil, srtapi.EINVPARAM
+	}
+	if interval <= 0 {
+		interval = DefaultFeedbackInterval
+	}
+	prev, err := srtapi.GetSendState(c.fd.pfd.Sysfd)
+	if err != nil {
+		return nil, &OpError{Op: "feedback", Net: c.fd.net, Source: c.fd.laddr, Addr: c.fd.raddr, Err: err}
+	}
+	ch := make(chan Feedback, 1)
+	go func() {
+		defer close(ch)
+		t := runtime.Clock.NewTicker(interval)
+		defer t.Stop()
+		var lossAvg float64
+		last := runtime.Clock.Now()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case now := <-t.C():
+				st, err := srtapi.GetSendState(c.fd.pfd.Sysfd)
+				if err != nil {
+					return
+				}
+				f := newFeedback(prev, st, now.Sub(last), &lossAvg)
+				f.Time = now
+				prev, last = st, now
+				select {
+				case <-ch:
+				default:
+				}
+				ch <- f
+			}
+		}
+	}()
+	return ch, nil
+}
+
+// newFeedback returns the Feedback of the interval d between the
+// states prev and st, updating the moving average of the loss rate.
+func newFeedback(prev, st srtapi.SendState, d time.Duration, lossAvg *float64) Feedback {
+	f := Feedback{
+		BufferDelay: time.Duration(st.BufferedMs) * time.Millisecond,
+		Latency:     time.Duration(st.LatencyMs) * time.Millisecond,
+		RTT:         time.Duration(st.RTTMs * float64(time.Millisecond)),
+		Capacity:    st.Bandwidth,
+		Dropped:     st.PacketsDropped - prev.PacketsDropped,
+	}
+	if size := st.BufferedBytes + st.AvailableBytes; size > 0 {
+		f.BufferFill = float64(st.BufferedBytes) / float64(size)
+	}
+	if d > 0 {
+		f.SendRate = float64(st.BytesSent-prev.BytesSent) * 8 / d.Seconds() / 1e6
+	}
+	if sent := st.PacketsSent - prev.PacketsSent; sent > 0 {
+		f.LossRate = float64(st.PacketsLost-prev.PacketsLost) / float64(sent)
+	}
+	f.LossTrend = f.LossRate - *lossAvg
+	*lossAvg += lossAvgWeight * f.LossTrend
+	f.Bitrate = f.suggest()
+	return f
+}
+
+// suggest returns the bitrate Feedback suggests.
+func (f *Feedback) suggest() float64 {
+	rate := f.SendRate
+	if rate <= 0 {
+		return 0
+	}
+	// The time data queues beyond a round trip, against the latency
+	// after which it is dropped.
+	var pressure float64
+	if f.Latency > 0 && f.BufferDelay > f.RTT {
+		pressure = float64(f.BufferDelay-f.RTT) / float64(f.Latency)
+	}
+	switch {
+	case f.Dropped > 0 || pressure > 0.5:
+		rate *= 0.7
+	case f.LossTrend > 0.01 || f.LossRate > 0.05 || pressure > 0.25:
+		rate *= 0.85
+	case f.LossRate < 0.01:
+		rate *= 1.05
+	}
+	if f.Capacity > 0 && rate > 0.9*f.Capacity {
+		rate = 0.9 * f.Capacity
+	}
+	return rate
+}
@@ -0,0 +1,101 @@
+// Copyright (c) 2020 CyberAgent, Inc. All rights reserved.
+// https://github.com/openfresh/gosrt
+
+package srt
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/openfresh/gosrt/srtapi"
+)
+
+func TestFeedbackBitrate(t *testing.T) {
+	base := srtapi.SendState{BufferedMs: 20, LatencyMs: 120, RTTMs: 20, AvailableBytes: 1000}
+	sent := func(st srtapi.SendState, bytes, packets, lost, dropped int64) srtapi.SendState {
+		st.BytesSent += bytes
+		st.PacketsSent += packets
+		st.PacketsLost += lost
+		st.PacketsDropped += dropped
+		return st
+	}
+	queued := base
+	queued.BufferedMs = 100
+	capped := base
+	capped.Bandwidth = 5
+	for _, tt := range []struct {
+		name     string
+		st       srtapi.SendState
+		lost     int64
+		dropped  int64
+		min, max float64
+	}{
+		{"room", base, 0, 0, 8.1, 8.5},
+		{"drops", base, 0, 1, 5.5, 5.7},
+		{"queue", queued, 0, 0, 5.5, 5.7},
+		{"losses", base, 100, 0, 6.7, 6.9},
+		{"capacity", capped, 0, 0, 4.5, 4.5},
+	} {
+		var lossAvg float64
+		// 1 MB in a second, 8 Mbit/s.
+		f := newFeedback(tt.st, sent(tt.st, 1000000, 1000, tt.lost, tt.dropped), time.Second, &lossAvg)
+		if f.SendRate != 8 {
+			t.Errorf("%s: got a send rate of %v; want 8", tt.name, f.SendRate)
+		}
+		if f.Bitrate < tt.min || f.Bitrate > tt.max {
+			t.Errorf("%s: got a bitrate of %v; want %v to %v", tt.name, f.Bitrate, tt.min, tt.max)
+		}
+	}
+
+	var lossAvg float64
+	if f := newFeedback(base, base, time.Second, &lossAvg); f.Bitrate != 0 {
+		t.Errorf("got a bitrate of %v with nothing sent; want 0", f.Bitrate)
+	}
+}
+
+func TestFeedback(t *testing.T) {
+	ln, err := Listen("srt", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	c, err := Dial("srt", ln.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	a, err := ln.Accept()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer a.Close()
+
+	ch, err := c.(*SRTConn).Feedback(context.Background(), 20*time.Millisecond)
+	if err != nil {
+		c.Close()
+		t.Fatal(err)
+	}
+	b := make([]byte, 1316)
+	for i := 0; i < 10; i++ {
+		if _, err := c.Write(b); err != nil {
+			t.Fatal(err)
+		}
+	}
+	f := <-ch
+	if f.SendRate <= 0 || f.BufferFill < 0 || f.BufferFill > 1 || f.Latency <= 0 {
+		t.Errorf("got %+v; want data sent within the latency", f)
+	}
+
+	// An interval of 0 is DefaultFeedbackInterval.
+	ctx0, cancel0 := context.WithCancel(context.Background())
+	ch0, err := c.(*SRTConn).Feedback(ctx0, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cancel0()
+	for range ch0 {
+	}
+	c.Close()
+	for range ch {
+	}
+}
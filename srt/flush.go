@@ -0,0 +1,79 @@
+// Copyright (c) 2020 CyberAgent, Inc. All rights reserved.
+// https://github.com/openfresh/gosrt
+
+package srt
+
+import (
+	"context"
+	"time"
+
+	"github.com/openfresh/gosrt/internal/poll/runtime"
+	"github.com/openfresh/gosrt/srtapi"
+)
+
+// flushPoll is the interval at which Flush checks the send buffer.
+var flushPoll = 5 * time.Millisecond
+
+// Flush waits until every byte written to c was acknowledged by the
+// peer, and the send buffer is empty, so that a sender of data it
+// can't afford to lose knows it was delivered before closing: Close
+// itself doesn't wait, and discards what the buffer holds. It returns
+// the number of bytes still unacknowledged, 0 unless ctx is done or
+// the connection fails first, with an error wrapping that of ctx in
+// the former case, and with ECONNLOST in the latter.
+//
+// Packets dropped as too late in live mode leave the buffer as if
+// they had been acknowledged; telling them apart needs the drop
+// counters of the statistics.
+func (c *conn) Flush(ctx context.Context) (int, error) {
+	if !c.ok() {
+		return 0, srtapi.EINVPARAM
+	}
+	n, err := c.fd.flush(ctx)
+	if err != nil {
+		err = &OpError{Op: "flush", Net: c.fd.net, Source: c.fd.laddr, Addr: c.fd.raddr, Err: err}
+	}
+	return n, err
+}
+
+func (fd *netFD) flush(ctx context.Context) (int, error) {
+	for {
+		st, err := fd.sendState()
+		if err != nil {
+			return st.BufferedBytes, err
+		}
+		if st.BufferedBytes == 0 && st.BufferedPackets == 0 {
+			return 0, nil
+		}
+		wake := make(chan struct{})
+		t := runtime.Clock.AfterFunc(flushPoll, func() { close(wake) })
+		select {
+		case <-ctx.Done():
+			t.Stop()
+			return st.BufferedBytes, mapErr(ctx.Err())
+		case <-wake:
+		}
+	}
+}
+
+// sendState returns the state of the send buffer of fd, and ECONNLOST
+// once the connection broke, whose buffer is never acknowledged: the
+// callers polling it would wait forever otherwise.
+func (fd *netFD) sendState() (st srtapi.SendState, err error) {
+	var state int
+	if rerr := fd.pfd.RawControl(func(s int) {
+		if st, err = getSendStateFunc(s); err == nil {
+			state = getsockstateFunc(s)
+		}
+	}); rerr != nil {
+		return st, rerr
+	}
+	if err != nil {
+		return st, err
+	}
+	switch state {
+	case srtapi.StatusBroken, srtapi.StatusClosing, srtapi.StatusClosed, srtapi.StatusNonexist:
+		return st, srtapi.ECONNLOST
+	}
+	return st, nil
+}
@@ -0,0 +1,78 @@
+// Copyright (c) 2020 CyberAgent, Inc. All rights reserved.
+// https://github.com/openfresh/gosrt
+
+package srt
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/openfresh/gosrt/srtapi"
+)
+
+func TestFlush(t *testing.T) {
+	c1, c2, err := Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c1.Close()
+	defer c2.Close()
+
+	if _, err := c1.Write([]byte("critical")); err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), someTimeout)
+	defer cancel()
+	if n, err := c1.Flush(ctx); n != 0 || err != nil {
+		t.Errorf("Flush() = %d, %v; want 0, nil", n, err)
+	}
+	b := make([]byte, 1500)
+	c2.SetReadDeadline(time.Now().Add(someTimeout))
+	if n, err := c2.Read(b); err != nil || string(b[:n]) != "critical" {
+		t.Errorf("got %q, %v", b[:n], err)
+	}
+
+	// An acknowledgement that doesn't come.
+	var mu sync.Mutex
+	calls := 0
+	defer func(f func(int) (srtapi.SendState, error)) { getSendStateFunc = f }(getSendStateFunc)
+	getSendStateFunc = func(s int) (srtapi.SendState, error) {
+		mu.Lock()
+		defer mu.Unlock()
+		calls++
+		return srtapi.SendState{BufferedPackets: 2, BufferedBytes: 2632}, nil
+	}
+	ctx, cancel = context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	n, err := c1.Flush(ctx)
+	if nerr, ok := err.(*OpError); !ok || !nerr.Timeout() || n != 2632 {
+		t.Errorf("Flush() = %d, %v with a stuck buffer; want 2632 and a timeout", n, err)
+	}
+	if calls < 2 {
+		t.Errorf("checked the buffer %d times; want it polled", calls)
+	}
+
+	// A connection breaking while waiting.
+	defer func(f func(int) int) { getsockstateFunc = f }(getsockstateFunc)
+	getsockstateFunc = func(s int) int {
+		mu.Lock()
+		defer mu.Unlock()
+		if calls > 4 {
+			return srtapi.StatusBroken
+		}
+		return srtapi.StatusConnected
+	}
+	ctx, cancel = context.WithTimeout(context.Background(), someTimeout)
+	defer cancel()
+	if n, err := c1.Flush(ctx); !errors.Is(err, srtapi.ECONNLOST) || n != 2632 {
+		t.Errorf("Flush() = %d, %v on a broken connection; want 2632, %v", n, err, srtapi.ECONNLOST)
+	}
+
+	c1.Close()
+	if _, err := c1.Flush(context.Background()); !errors.Is(err, ErrClosed) {
+		t.Errorf("got %v on a closed connection; want %v", err, ErrClosed)
+	}
+}
@@ -0,0 +1,325 @@
+// Copyright (c) 2020 CyberAgent, Inc. All rights reserved.
+// https://github.com/openfresh/gosrt
+
+package srt
+
+import (
+	"encoding/binary"
+	"errors"
+	"sync"
+
+	"github.com/openfresh/gosrt/mpegts"
+)
+
+// A Framer maps the data an application writes and reads onto the
+// messages of an SRT connection. FramedConn calls Frame and Flush
+// from its writers and Deframe from its readers, which may run
+// concurrently; each side is called by one goroutine at a time.
+type Framer interface {
+	// Frame returns the messages carrying p, each at most limit
+	// bytes long, or of any length if limit is 0. It may hold back
+	// data until later writes complete a message.
+	Frame(p []byte, limit int) ([][]byte, error)
+
+	// Flush returns the messages carrying the data held back.
+	Flush(limit int) ([][]byte, error)
+
+	// Deframe returns the data a received message completes,
+	// nil if it needs more messages.
+	Deframe(msg []byte) ([]byte, error)
+}
+
+// RawFramer sends each write as is, split into as many messages as
+// its length needs, and reads messages as they come.
+type RawFramer struct{}
+
+// Frame implements the Framer Frame method.
+func (RawFramer) Frame(p []byte, limit int) ([][]byte, error) {
+	return split(nil, p, limit), nil
+}
+
+// Flush implements the Framer Flush method.
+func (RawFramer) Flush(limit int) ([][]byte, error) { return nil, nil }
+
+// Deframe implements the Framer Deframe method.
+func (RawFramer) Deframe(msg []byte) ([]byte, error) { return msg, nil }
+
+func split(msgs [][]byte, p []byte, limit int) [][]byte {
+	for len(p) > 0 {
+		n := len(p)
+		if limit > 0 && n > limit {
+			n = limit
+		}
+		msgs = append(msgs, append([]byte(nil), p[:n]...))
+		p = p[n:]
+	}
+	return msgs
+}
+
+// DefaultMaxFrameSize is the MaxSize of a LengthFramer left zero.
+const DefaultMaxFrameSize = 16 << 20
+
+// ErrFrameTooLarge is the error of a LengthFramer writing or reading
+// a frame larger than its MaxSize.
+var ErrFrameTooLarge = errors.New("frame too large")
+
+// LengthFramer carries writes of any length: each one travels behind
+// its length, as a 4-byte big-endian prefix, in messages of its own.
+// Where messages keep their boundaries, as in live mode, a Read with a
+// large enough buffer returns a write whole, however many messages it
+// took; a stream split anywhere, as file mode delivers it, may have a
+// Read return several writes joined. It needs every message to arrive,
+// which live mode only ensures with "tlpktdrop" disabled.
+type LengthFramer struct {
+	// MaxSize bounds the frames written and read. Zero means
+	// DefaultMaxFrameSize.
+	MaxSize int
+
+	frame []byte // frame being read
+	need  int    // length of the frame being read
+	hdr   []byte // partial prefix
+	skip  int    // bytes left of a frame too large, dropped
+}
+
+// Frame implements the Framer Frame method.
+func (f *LengthFramer) Frame(p []byte, limit int) ([][]byte, error) {
+	if len(p) > f.maxSize() {
+		return nil, ErrFrameTooLarge
+	}
+	b := make([]byte, 4+len(p))
+	binary.BigEndian.PutUint32(b, uint32(len(p)))
+	copy(b[4:], p)
+	return split(nil, b, limit), nil
+}
+
+// Flush implements the Framer Flush method.
+func (f *LengthFramer) Flush(limit int) ([][]byte, error) { return nil, nil }
+
+// Deframe implements the Framer Deframe method. Frames may end and
+// start anywhere in msg, so it also reads a length-prefixed stream
+// split arbitrarily, as file mode delivers it. When msg completes
+// more than one frame, Deframe returns them joined. A frame longer
+// than MaxSize fails with ErrFrameTooLarge, and the length it declares
+// is dropped, for the frames after it to be read.
+func (f *LengthFramer) Deframe(msg []byte) ([]byte, error) {
+	var out []byte
+	var err error
+	for len(msg) > 0 {
+		if f.skip > 0 {
+			n := f.skip
+			if n > len(msg) {
+				n = len(msg)
+			}
+			f.skip, msg = f.skip-n, msg[n:]
+			continue
+		}
+		if f.hdr == nil && f.frame == nil {
+			f.hdr = make([]byte, 0, 4)
+		}
+		if f.hdr != nil {
+			n := copy(f.hdr[len(f.hdr):4], msg)
+			f.hdr, msg = f.hdr[:len(f.hdr)+n], msg[n:]
+			if len(f.hdr) < 4 {
+				break
+			}
+			f.need = int(binary.BigEndian.Uint32(f.hdr))
+			f.hdr = nil
+			if f.need > f.maxSize() {
+				f.skip, f.need = f.need, 0
+				err = ErrFrameTooLarge
+				continue
+			}
+			f.frame = make([]byte, 0, f.need)
+		}
+		n := f.need - len(f.frame)
+		if n > len(msg) {
+			n = len(msg)
+		}
+		f.frame, msg = append(f.frame, msg[:n]...), msg[n:]
+		if len(f.frame) == f.need {
+			out = append(out, f.frame...)
+			f.frame = nil
+		}
+	}
+	return out, err
+}
+
+func (f *LengthFramer) maxSize() int {
+	if f.MaxSize > 0 {
+		return f.MaxSize
+	}
+	return DefaultMaxFrameSize
+}
+
+// TSFramer sends MPEG-TS in messages of whole 188-byte packets,
+// mpegts.PacketsPerPayload at most, holding back what doesn't fill
+// one until Flush, and rejects received messages that aren't whole
+// packets with mpegts.ErrSync.
+type TSFramer struct {
+	buf []byte
+}
+
+// Frame implements the Framer Frame method. p must hold whole
+// packets once joined to what earlier writes held back.
+func (f *TSFramer) Frame(p []byte, limit int) ([][]byte, error) {
+	size := tsBundle(limit)
+	var msgs [][]byte
+	for len(p) > 0 {
+		off := len(f.buf) % mpegts.PacketSize
+		if off == 0 && p[0] != mpegts.SyncByte {
+			return msgs, mpegts.ErrSync
+		}
+		n := mpegts.PacketSize - off
+		if n > len(p) {
+			n = len(p)
+		}
+		f.buf, p = append(f.buf, p[:n]...), p[n:]
+		if len(f.buf) == size {
+			msgs = append(msgs, f.buf)
+			f.buf = nil
+		}
+	}
+	return msgs, nil
+}
+
+// Flush implements the Framer Flush method. It keeps back a trailing
+// partial packet.
+func (f *TSFramer) Flush(limit int) ([][]byte, error) {
+	whole := len(f.buf) - len(f.buf)%mpegts.PacketSize
+	if whole == 0 {
+		return nil, nil
+	}
+	msg := f.buf[:whole]
+	f.buf = append([]byte(nil), f.buf[whole:]...)
+	return [][]byte{msg}, nil
+}
+
+// Deframe implements the Framer Deframe method.
+func (f *TSFramer) Deframe(msg []byte) ([]byte, error) {
+	if len(msg)%mpegts.PacketSize != 0 {
+		return nil, mpegts.ErrSync
+	}
+	for i := 0; i < len(msg); i += mpegts.PacketSize {
+		if msg[i] != mpegts.SyncByte {
+			return nil, mpegts.ErrSync
+		}
+	}
+	return msg, nil
+}
+
+// tsBundle returns the size of the messages of TSFramer under limit.
+func tsBundle(limit int) int {
+	n := mpegts.PacketsPerPayload
+	if limit > 0 && limit/mpegts.PacketSize < n {
+		n = limit / mpegts.PacketSize
+	}
+	if n < 1 {
+		n = 1
+	}
+	return n * mpegts.PacketSize
+}
+
+// framedReadSize is the size of the reads of FramedConn, enough for
+// any live mode message.
+const framedReadSize = 64 << 10
+
+// FramedConn is an SRTConn whose writes and reads go through a
+// Framer.
+type FramedConn struct {
+	*SRTConn
+	f Framer
+
+	wmu sync.Mutex
+
+	rmu  sync.Mutex
+	rbuf []byte // deframed data not read yet
+	rerr error  // of the Deframe that returned rbuf, for once it is read
+	msg  []byte
+}
+
+// NewFramedConn returns c with its Write and Read going through f.
+func NewFramedConn(c *SRTConn, f Framer) *FramedConn {
+	return &FramedConn{SRTConn: c, f: f}
+}
+
+// Write frames b and writes the messages carrying it, which the Framer
+// may hold part of b back from until later writes or Flush, as
+// TSFramer does; the messages keep the boundaries of the writes only
+// as far as the Framer does. It returns len(b) on success; on error,
+// part of b may have been sent.
+func (c *FramedConn) Write(b []byte) (int, error) {
+	c.wmu.Lock()
+	defer c.wmu.Unlock()
+	msgs, err := c.f.Frame(b, c.limit())
+	if werr := c.send(msgs); werr != nil {
+		return 0, werr
+	}
+	if err != nil {
+		return 0, c.opError("write", err)
+	}
+	return len(b), nil
+}
+
+// Flush writes the messages carrying the data the Framer held back.
+func (c *FramedConn) Flush() error {
+	c.wmu.Lock()
+	defer c.wmu.Unlock()
+	msgs, err := c.f.Flush(c.limit())
+	if werr := c.send(msgs); werr != nil {
+		return werr
+	}
+	if err != nil {
+		return c.opError("write", err)
+	}
+	return nil
+}
+
+func (c *FramedConn) send(msgs [][]byte) error {
+	for _, m := range msgs {
+		if _, err := c.SRTConn.Write(m); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Read reads the data the Framer extracts from the messages received.
+// When a message gives both data and an error, Read returns the data,
+// and the error once they are read.
+func (c *FramedConn) Read(b []byte) (int, error) {
+	c.rmu.Lock()
+	defer c.rmu.Unlock()
+	for len(c.rbuf) == 0 {
+		if err := c.rerr; err != nil {
+			c.rerr = nil
+			return 0, c.opError("read", err)
+		}
+		if c.msg == nil {
+			c.msg = make([]byte, framedReadSize)
+		}
+		n, err := c.SRTConn.Read(c.msg)
+		if err != nil {
+			return 0, err
+		}
+		data, err := c.f.Deframe(c.msg[:n])
+		c.rbuf = append(c.rbuf, data...)
+		c.rerr = err
+	}
+	n := copy(b, c.rbuf)
+	c.rbuf = c.rbuf[n:]
+	return n, nil
+}
+
+func (c *FramedConn) limit() int {
+	if !c.ok() {
+		return 0
+	}
+	return c.fd.payloadLimit()
+}
+
+func (c *FramedConn) opError(op string, err error) error {
+	if !c.ok() {
+		return err
+	}
+	return &OpError{Op: op, Net: c.fd.net, Source: c.fd.laddr, Addr: c.fd.raddr, Err: err}
+}
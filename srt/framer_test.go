@@ -0,0 +1,162 @@
+// Copyright (c) 2020 CyberAgent, Inc. All rights reserved.
+// https://github.com/openfresh/gosrt
+
+package srt
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+
+	"github.com/openfresh/gosrt/mpegts"
+)
+
+func TestLengthFramer(t *testing.T) {
+	var f LengthFramer
+	frames := [][]byte{bytes.Repeat([]byte("a"), 3000), []byte("b"), {}, bytes.Repeat([]byte("c"), 1316)}
+	var msgs [][]byte
+	for _, fr := range frames {
+		m, err := f.Frame(fr, 1316)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, msg := range m {
+			if len(msg) > 1316 {
+				t.Fatalf("got a %d-byte message; want 1316 at most", len(msg))
+			}
+		}
+		msgs = append(msgs, m...)
+	}
+	var got []byte
+	for _, msg := range msgs {
+		data, err := f.Deframe(msg)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got = append(got, data...)
+	}
+	if want := bytes.Join(frames, nil); !bytes.Equal(got, want) {
+		t.Errorf("got %d bytes; want %d", len(got), len(want))
+	}
+
+	// A stream split anywhere, as file mode reads it.
+	stream := bytes.Join(msgs, nil)
+	got = nil
+	for len(stream) > 0 {
+		n := 7
+		if n > len(stream) {
+			n = len(stream)
+		}
+		data, err := f.Deframe(stream[:n])
+		if err != nil {
+			t.Fatal(err)
+		}
+		got = append(got, data...)
+		stream = stream[n:]
+	}
+	if want := bytes.Join(frames, nil); !bytes.Equal(got, want) {
+		t.Errorf("stream: got %d bytes; want %d", len(got), len(want))
+	}
+
+	small := LengthFramer{MaxSize: 10}
+	if _, err := small.Frame(make([]byte, 11), 0); err != ErrFrameTooLarge {
+		t.Errorf("got %v; want %v", err, ErrFrameTooLarge)
+	}
+	if _, err := small.Deframe([]byte{0, 0, 0, 11}); err != ErrFrameTooLarge {
+		t.Errorf("got %v; want %v", err, ErrFrameTooLarge)
+	}
+	small = LengthFramer{MaxSize: 10}
+	if _, err := small.Deframe(append([]byte{0, 0, 0, 11}, make([]byte, 6)...)); err != ErrFrameTooLarge {
+		t.Errorf("got %v; want %v", err, ErrFrameTooLarge)
+	}
+	if got, err := small.Deframe(append(make([]byte, 5), 0, 0, 0, 2, 'o', 'k')); string(got) != "ok" || err != nil {
+		t.Errorf("after a frame too large: got %q, %v; want \"ok\", nil", got, err)
+	}
+}
+
+func tsPackets(n int) []byte {
+	b := make([]byte, n*mpegts.PacketSize)
+	for i := 0; i < n; i++ {
+		b[i*mpegts.PacketSize] = mpegts.SyncByte
+	}
+	return b
+}
+
+func TestTSFramer(t *testing.T) {
+	var f TSFramer
+	msgs, err := f.Frame(tsPackets(10)[:1400], 1456)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(msgs) != 1 || len(msgs[0]) != 7*mpegts.PacketSize {
+		t.Fatalf("got %d messages; want one of 7 packets", len(msgs))
+	}
+	msgs, err = f.Frame(tsPackets(10)[1400:], 1456)
+	if err != nil || len(msgs) != 0 {
+		t.Fatalf("got %d messages, %v; want none", len(msgs), err)
+	}
+	msgs, _ = f.Flush(1456)
+	if len(msgs) != 1 || len(msgs[0]) != 3*mpegts.PacketSize {
+		t.Fatalf("got %d messages from Flush; want one of 3 packets", len(msgs))
+	}
+	if _, err := f.Frame([]byte{0x00}, 1456); err != mpegts.ErrSync {
+		t.Errorf("got %v; want %v", err, mpegts.ErrSync)
+	}
+	if _, err := f.Deframe(tsPackets(2)[1:]); err != mpegts.ErrSync {
+		t.Errorf("got %v; want %v", err, mpegts.ErrSync)
+	}
+}
+
+func TestFramedConn(t *testing.T) {
+	ln, err := newLocalListener("srt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	c, err := Dial("srt", ln.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	a, err := ln.Accept()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer a.Close()
+
+	w := NewFramedConn(c.(*SRTConn), &LengthFramer{})
+	r := NewFramedConn(a.(*SRTConn), &LengthFramer{})
+	frames := [][]byte{bytes.Repeat([]byte("FRAMED CONN TEST"), 400), []byte("short")}
+	for _, fr := range frames {
+		if n, err := w.Write(fr); n != len(fr) || err != nil {
+			t.Fatalf("got %d, %v; want %d, nil", n, err, len(fr))
+		}
+	}
+	b := make([]byte, 10000)
+	for i, want := range frames {
+		n, err := r.Read(b)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(b[:n], want) {
+			t.Errorf("#%d: got %d bytes; want %d", i, n, len(want))
+		}
+	}
+	// A message giving data and an error: the data first, then the
+	// error.
+	r = NewFramedConn(a.(*SRTConn), &LengthFramer{MaxSize: 10})
+	msg := append([]byte{0, 0, 0, 5}, "short"...)
+	msg = append(msg, 0, 0, 0, 11)
+	msg = append(msg, make([]byte, 11)...)
+	msg = append(msg, 0, 0, 0, 2, 'o', 'k')
+	if _, err := c.Write(msg); err != nil {
+		t.Fatal(err)
+	}
+	n, err := r.Read(b)
+	if got := string(b[:n]); got != "shortok" || err != nil {
+		t.Fatalf("got %q, %v; want \"shortok\", nil", got, err)
+	}
+	if _, err := r.Read(b); !errors.Is(err, ErrFrameTooLarge) {
+		t.Errorf("got %v; want %v", err, ErrFrameTooLarge)
+	}
+}
@@ -0,0 +1,69 @@
+// Copyright (c) 2020 CyberAgent, Inc. All rights reserved.
+// https://github.com/openfresh/gosrt
+
+//go:build go1.18
+// +build go1.18
+
+package srt
+
+import (
+	"reflect"
+	"strconv"
+	"testing"
+)
+
+// Option values reach extract from configuration and from the query
+// strings of srtmobile.
+func FuzzOptionValue(f *testing.F) {
+	for _, o := range srtOptions {
+		f.Add(o.name, "1")
+	}
+	f.Add("latency", "-1")
+	f.Add("maxbw", "9223372036854775808")
+	f.Add("tsbpdmode", "yes")
+	f.Fuzz(func(t *testing.T, name, value string) {
+		for i := range srtOptions {
+			o := &srtOptions[i]
+			if o.name != name {
+				continue
+			}
+			v, err := o.extract(value)
+			if err != nil {
+				return
+			}
+			var s string
+			switch v := v.(type) {
+			case string:
+				s = v
+			case int:
+				s = strconv.Itoa(v)
+			case int64:
+				s = strconv.FormatInt(v, 10)
+			case bool:
+				s = strconv.FormatBool(v)
+			default:
+				t.Fatalf("%s=%q: got a %T", name, value, v)
+			}
+			if again, err := o.extract(s); err != nil || again != v {
+				t.Fatalf("%s=%q: got %v, then %v, %v from %q", name, value, v, again, err, s)
+			}
+		}
+	})
+}
+
+// Group URLs come from configuration files.
+func FuzzParseGroupURL(f *testing.F) {
+	for _, tt := range parseGroupURLTests {
+		f.Add(tt.in)
+	}
+	f.Add("srt://a:9000;weight=+5,b:9000?mode=backup&streamid=%23%21%3A%3Ar%3Dlive")
+	f.Fuzz(func(t *testing.T, s string) {
+		u, err := ParseGroupURL(s)
+		if err != nil {
+			return
+		}
+		if again, err := ParseGroupURL(u.String()); err != nil || !reflect.DeepEqual(again, u) {
+			t.Fatalf("%q: got %+v, then %+v, %v from %q", s, u, again, err, u.String())
+		}
+	})
+}
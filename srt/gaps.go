@@ -0,0 +1,92 @@
+// Copyright (c) 2020 CyberAgent, Inc. All rights reserved.
+// https://github.com/openfresh/gosrt
+
+package srt
+
+import (
+	"time"
+
+	"github.com/openfresh/gosrt/srtapi"
+)
+
+// A SeqGap is a range of packets a connection found missing on
+// reception, a packet further on having arrived first, and what became
+// of them: the packets lost, or reordered, in a burst.
+type SeqGap struct {
+	// FirstSeq and LastSeq are the sequence numbers of the range,
+	// both included, and Packets the number of packets in it.
+	FirstSeq, LastSeq int32
+	Packets           int
+
+	// Detected is when the gap was found.
+	Detected time.Time
+
+	// Recovered counts the packets of the range that arrived since,
+	// retransmitted or out of order, and Dropped those given up on as
+	// too late (see EventDropped). Resolved is when the last of them
+	// did, zero while some are still missing.
+	Recovered int
+	Dropped   int
+	Resolved  time.Time
+}
+
+// Duration returns how long the gap stayed open, up to now for an open
+// one.
+func (g SeqGap) Duration(now time.Time) time.Duration {
+	if g.Resolved.IsZero() {
+		return now.Sub(g.Detected)
+	}
+	return g.Resolved.Sub(g.Detected)
+}
+
+// A GapReport lists the receive gaps of a connection.
+type GapReport struct {
+	// Gaps are the latest gaps, oldest first; the connection keeps
+	// the last 256.
+	Gaps []SeqGap
+
+	// Total and Packets are the number of gaps found since the
+	// connection started, and of packets missing in them, which
+	// include those of the gaps no longer listed.
+	Total   int64
+	Packets int64
+}
+
+// Gaps returns the receive gaps of the connection, which the loss
+// counters of Stats only sum up, for quality analysis to tell the loss
+// bursts apart and line them up with the events of the network.
+//
+// libsrt doesn't report gaps, which the connection then finds in live
+// mode from the sequence numbers of the messages it reads. libsrt
+// recovers the packets it can before they are read, so those gaps are
+// of the packets dropped only, all counted in Dropped, and found as
+// the first message after them is read. In other modes, Gaps fails
+// with srtapi.EINVOP with libsrt.
+func (c *conn) Gaps() (GapReport, error) {
+	if !c.ok() {
+		return GapReport{}, srtapi.EINVPARAM
+	}
+	if !hasReportsFunc(srtapi.FeatureGapReports) {
+		if c.fd.rseq == nil {
+			return GapReport{}, &OpError{Op: "gaps", Net: c.fd.net, Source: c.fd.laddr, Addr: c.fd.raddr, Err: srtapi.EINVOP}
+		}
+		return c.fd.rseq.report(), nil
+	}
+	gaps, total, pkts, err := srtapi.Gaps(c.fd.pfd.Sysfd)
+	if err != nil {
+		return GapReport{}, &OpError{Op: "gaps", Net: c.fd.net, Source: c.fd.laddr, Addr: c.fd.raddr, Err: err}
+	}
+	r := GapReport{Gaps: make([]SeqGap, len(gaps)), Total: total, Packets: pkts}
+	for i, g := range gaps {
+		r.Gaps[i] = SeqGap{
+			FirstSeq:  g.First,
+			LastSeq:   g.Last,
+			Packets:   g.Packets,
+			Detected:  g.Detected,
+			Recovered: g.Recovered,
+			Dropped:   g.Dropped,
+			Resolved:  g.Resolved,
+		}
+	}
+	return r, nil
+}
@@ -0,0 +1,64 @@
+// Copyright (c) 2020 CyberAgent, Inc. All rights reserved.
+// https://github.com/openfresh/gosrt
+
+package srt
+
+import (
+	"testing"
+	"time"
+)
+
+func TestGaps(t *testing.T) {
+	testGaps(t, false)
+	defer emulateReports()()
+	testGaps(t, true)
+}
+
+func testGaps(t *testing.T, emulated bool) {
+	c1, c2, err := Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c1.Close()
+	defer c2.Close()
+
+	for i := 0; i < 2; i++ {
+		if _, err := c1.Write([]byte("hello")); err != nil {
+			t.Fatal(err)
+		}
+		c2.SetReadDeadline(time.Now().Add(someTimeout))
+		if _, err := c2.Read(make([]byte, 1500)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	r, err := c2.Gaps()
+	if err != nil || len(r.Gaps) != 0 || r.Total != 0 || r.Packets != 0 {
+		t.Errorf("got %+v, %v; want no gap without loss", r, err)
+	}
+	if !emulated {
+		return
+	}
+
+	// A message further on than the next one tells of those dropped.
+	next := c2.fd.rseq.next
+	c2.fd.rseq.received((next+2)&seqMax, time.Now())
+	r, err = c2.Gaps()
+	if err != nil || len(r.Gaps) != 1 || r.Total != 1 || r.Packets != 2 {
+		t.Fatalf("got %+v, %v; want a gap of 2 packets", r, err)
+	}
+	if g := r.Gaps[0]; g.FirstSeq != next || g.LastSeq != (next+1)&seqMax || g.Dropped != 2 {
+		t.Errorf("got gap %+v; want %d to %d dropped", g, next, (next+1)&seqMax)
+	}
+}
+
+func TestSeqGapDuration(t *testing.T) {
+	now := time.Now()
+	g := SeqGap{Detected: now.Add(-time.Second)}
+	if d := g.Duration(now); d != time.Second {
+		t.Errorf("open gap lasted %v; want 1s", d)
+	}
+	g.Resolved = now.Add(-900 * time.Millisecond)
+	if d := g.Duration(now); d != 100*time.Millisecond {
+		t.Errorf("resolved gap lasted %v; want 100ms", d)
+	}
+}
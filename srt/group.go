@@ -0,0 +1,197 @@
+// Copyright (c) 2020 CyberAgent, Inc. All rights reserved.
+// https://github.com/openfresh/gosrt
+
+package srt
+
+import (
+	"context"
+	"fmt"
+	"net"
+
+	"github.com/openfresh/gosrt/srtapi"
+)
+
+// A Group is a socket group to dial, built link by link, for programs
+// that set up bonded links as they go rather than from a GroupURL:
+//
+//	g := srt.NewGroup(srt.GroupBackup)
+//	g.AddLink("198.51.100.2:0", "srt.example.com:9000", 10) // ISP 1
+//	g.AddLink("203.0.113.2:0", "srt.example.com:9000", 1)   // ISP 2
+//	c, err := g.Dial("srt4")
+//
+// The connection Dial returns reads and writes through the group, its
+// links carrying the data as the mode of the group says. Groups need
+// srtapi.FeatureGroups, and the listener they dial the "groupconnect"
+// option.
+type Group struct {
+	mode  string
+	links []groupLink
+}
+
+type groupLink struct {
+	local, remote string
+	weight        int
+}
+
+// NewGroup returns a Group of mode, GroupBroadcast, GroupBackup or
+// GroupBalancing, with no links.
+func NewGroup(mode string) *Group {
+	return &Group{mode: mode}
+}
+
+// AddLink adds a link of weight from localAddr, "" for any local
+// address, to remoteAddr. Links from the local addresses of different
+// interfaces go out through them, over different ISPs say. The weight,
+// from 0 to 65535, is the priority of the link in a backup group, and
+// its share of the load in a balancing one.
+func (g *Group) AddLink(localAddr, remoteAddr string, weight int) error {
+	if weight < 0 || weight > 0xFFFF {
+		return fmt.Errorf("invalid weight %d", weight)
+	}
+	if localAddr != "" {
+		if _, _, err := net.SplitHostPort(localAddr); err != nil {
+			return err
+		}
+	}
+	if _, port, err := net.SplitHostPort(remoteAddr); err != nil {
+		return err
+	} else if port == "" {
+		return fmt.Errorf("missing port in address %q", remoteAddr)
+	}
+	g.links = append(g.links, groupLink{local: localAddr, remote: remoteAddr, weight: weight})
+	return nil
+}
+
+// Dial connects the links of the group on the named network; see func
+// Dial for a description of the network.
+func (g *Group) Dial(network string) (*SRTConn, error) {
+	var d Dialer
+	return d.DialGroup(context.Background(), network, g)
+}
+
+// DialGroup connects the links of g on the named network, within the
+// Timeout and Deadline of d and the deadline of ctx, as DialContext
+// does a single connection. Options set on ctx with WithOptions apply
+// to every link. The group is named after the remote address of its
+// first link in errors and in the hooks of WithHooks.
+func (d *Dialer) DialGroup(ctx context.Context, network string, g *Group) (*SRTConn, error) {
+	if ctx == nil {
+		panic("nil context")
+	}
+	ctx, cancel := d.withDeadline(ctx)
+	defer cancel()
+	if d.Handshake != nil {
+		ctx = d.Handshake.withOptions(ctx)
+	}
+	return d.dialGroup(ctx, network, g)
+}
+
+func (d *Dialer) dialGroup(ctx context.Context, network string, g *Group) (*SRTConn, error) {
+	typ, ok := groupTypes[g.mode]
+	if !ok {
+		return nil, &OpError{Op: "dial", Net: network, Source: nil, Addr: nil, Err: fmt.Errorf("unknown group mode %q", g.mode)}
+	}
+	if len(g.links) == 0 {
+		return nil, &OpError{Op: "dial", Net: network, Source: nil, Addr: nil, Err: errMissingAddress}
+	}
+	gd := &groupDial{typ: typ}
+	var first *SRTAddr
+	for _, l := range g.links {
+		addrs, err := d.resolver().resolveAddrList(ctx, "dial", network, l.remote, nil)
+		if err != nil {
+			return nil, &OpError{Op: "dial", Net: network, Source: nil, Addr: nil, Err: err}
+		}
+		ra, ok := addrs.forResolve(network, l.remote).(*SRTAddr)
+		if !ok {
+			return nil, &OpError{Op: "dial", Net: network, Source: nil, Addr: nil, Err: &net.AddrError{Err: "unexpected address type", Addr: l.remote}}
+		}
+		sa, err := ra.sockaddr(ra.family())
+		if err != nil {
+			return nil, &OpError{Op: "dial", Net: network, Source: nil, Addr: ra, Err: err}
+		}
+		m := srtapi.GroupMember{Addr: sa, Weight: l.weight}
+		if l.local != "" {
+			la, err := ResolveSRTAddr(network, l.local)
+			if err != nil {
+				return nil, &OpError{Op: "dial", Net: network, Source: nil, Addr: ra, Err: err}
+			}
+			if m.Local, err = la.sockaddr(ra.family()); err != nil {
+				return nil, &OpError{Op: "dial", Net: network, Source: la, Addr: ra, Err: err}
+			}
+		}
+		gd.members = append(gd.members, m)
+		if first == nil {
+			first = ra
+		}
+	}
+	c, err := dialSRT(context.WithValue(ctx, groupDialContextKey{}, gd), network, nil, first)
+	if err != nil {
+		return nil, &OpError{Op: "dial", Net: network, Source: nil, Addr: first, Err: err}
+	}
+	return c, nil
+}
+
+// States of a GroupMember
+const (
+	GroupMemberPending = "pending" // connecting
+	GroupMemberIdle    = "idle"    // connected, standing by
+	GroupMemberRunning = "running" // connected, carrying data
+	GroupMemberBroken  = "broken"  // lost, about to leave the group
+)
+
+var groupMemberStates = map[int]string{
+	srtapi.GroupMemberPending: GroupMemberPending,
+	srtapi.GroupMemberIdle:    GroupMemberIdle,
+	srtapi.GroupMemberRunning: GroupMemberRunning,
+	srtapi.GroupMemberBroken:  GroupMemberBroken,
+}
+
+// A GroupMember is a link of a group connection, as GroupMembers
+// reports it.
+type GroupMember struct {
+	SocketID int
+	Peer     net.Addr
+	Weight   int
+	State    string
+
+	// Failed is set if the last send or receive of the group on the
+	// link failed.
+	Failed bool
+}
+
+// GroupMembers returns the links of a group connection, as dialed with
+// a Group or a GroupURL, or accepted by a listener with the
+// "groupconnect" option, for monitoring to tell which carry the data.
+// It fails with srtapi.EINVOP for other connections.
+func (c *conn) GroupMembers() ([]GroupMember, error) {
+	if !c.ok() {
+		return nil, srtapi.EINVPARAM
+	}
+	var (
+		ms  []srtapi.GroupMemberStatus
+		err error
+	)
+	if rerr := c.fd.pfd.RawControl(func(s int) {
+		if !srtapi.IsGroup(s) {
+			err = srtapi.EINVOP
+			return
+		}
+		ms, err = srtapi.GroupData(s)
+	}); rerr != nil {
+		err = rerr
+	}
+	if err != nil {
+		return nil, &OpError{Op: "group", Net: c.fd.net, Source: c.fd.laddr, Addr: c.fd.raddr, Err: err}
+	}
+	members := make([]GroupMember, len(ms))
+	for i, m := range ms {
+		members[i] = GroupMember{
+			SocketID: m.ID,
+			Peer:     sockaddrToSRT(m.Peer),
+			Weight:   m.Weight,
+			State:    groupMemberStates[m.MemberState],
+			Failed:   m.Result < 0,
+		}
+	}
+	return members, nil
+}
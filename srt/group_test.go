@@ -0,0 +1,118 @@
+// Copyright (c) 2020 CyberAgent, Inc. All rights reserved.
+// https://github.com/openfresh/gosrt
+
+package srt
+
+import (
+	"context"
+	"errors"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/openfresh/gosrt/srtapi"
+)
+
+func TestGroupAddLink(t *testing.T) {
+	g := NewGroup(GroupBackup)
+	for _, tt := range []struct {
+		local, remote string
+		weight        int
+	}{
+		{"", "a", 0},
+		{"", "a:", 0},
+		{"", "a:9000", -1},
+		{"", "a:9000", 65536},
+		{"192.0.2.1", "a:9000", 0},
+	} {
+		if err := g.AddLink(tt.local, tt.remote, tt.weight); err == nil {
+			t.Errorf("AddLink(%q, %q, %d) succeeded", tt.local, tt.remote, tt.weight)
+		}
+	}
+	if len(g.links) != 0 {
+		t.Errorf("got links %v after failures", g.links)
+	}
+}
+
+func TestDialGroup(t *testing.T) {
+	origTestHookDialSRT := testHookDialSRT
+	defer func() { testHookDialSRT = origTestHookDialSRT }()
+	errDialed := errors.New("dialed")
+	var gd *groupDial
+	testHookDialSRT = func(ctx context.Context, network string, laddr, raddr *SRTAddr) (*SRTConn, error) {
+		gd = groupDialValue(ctx)
+		return nil, errDialed
+	}
+
+	g := NewGroup(GroupBackup)
+	if err := g.AddLink("192.0.2.1:0", "192.0.2.10:9000", 10); err != nil {
+		t.Fatal(err)
+	}
+	if err := g.AddLink("", "198.51.100.10:9000", 1); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := g.Dial("srt4"); !errors.Is(err, errDialed) {
+		t.Fatalf("got %v; want the error of the dial", err)
+	}
+	if gd == nil || gd.typ != srtapi.GroupBackup || len(gd.members) != 2 {
+		t.Fatalf("got group dial %+v", gd)
+	}
+	if sa, ok := gd.members[0].Local.(*syscall.SockaddrInet4); !ok || sa.Addr != [4]byte{192, 0, 2, 1} {
+		t.Errorf("got local address %v for the first link", gd.members[0].Local)
+	}
+	if gd.members[0].Weight != 10 || gd.members[1].Local != nil || gd.members[1].Weight != 1 {
+		t.Errorf("got members %+v", gd.members)
+	}
+
+	if _, err := NewGroup("none").Dial("srt4"); err == nil {
+		t.Error("dial of an unknown mode succeeded")
+	}
+	if _, err := NewGroup(GroupBroadcast).Dial("srt4"); !errors.Is(err, errMissingAddress) {
+		t.Errorf("got %v for a group of no links; want %v", err, errMissingAddress)
+	}
+}
+
+func TestGroupMembers(t *testing.T) {
+	c1, c2, err := Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c1.Close()
+	defer c2.Close()
+	if _, err := c1.GroupMembers(); !errors.Is(err, srtapi.EINVOP) {
+		t.Errorf("got %v for a single connection; want %v", err, srtapi.EINVOP)
+	}
+
+	if !srtapi.Has(srtapi.FeatureGroups) {
+		t.Skip("no socket groups")
+	}
+	ctx := WithOptions(context.Background(), Options("groupconnect", "1"))
+	ln, err := listenSRT(ctx, "srt4", &SRTAddr{IP: []byte{127, 0, 0, 1}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	g := NewGroup(GroupBroadcast)
+	g.AddLink("", ln.fd.laddr.String(), 0)
+	g.AddLink("", ln.fd.laddr.String(), 0)
+	c, err := g.Dial("srt4")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	ln.SetDeadline(time.Now().Add(someTimeout))
+	p, err := ln.accept()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer p.Close()
+	for _, conn := range []*SRTConn{c, p} {
+		ms, err := conn.GroupMembers()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(ms) == 0 {
+			t.Error("no members")
+		}
+	}
+}
@@ -0,0 +1,224 @@
+// Copyright (c) 2020 CyberAgent, Inc. All rights reserved.
+// https://github.com/openfresh/gosrt
+
+package srt
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/openfresh/gosrt/internal/poll"
+	"github.com/openfresh/gosrt/srtapi"
+)
+
+// urlPrefix starts the addresses Dial takes as a GroupURL.
+const urlPrefix = "srt://"
+
+// Group modes of a GroupURL
+const (
+	GroupBroadcast = "broadcast" // every member sends all the data
+	GroupBackup    = "backup"    // the member of the highest weight sends, the others stand by
+	GroupBalancing = "balancing" // the members share the data, by weight
+)
+
+var groupTypes = map[string]int{
+	GroupBroadcast: srtapi.GroupBroadcast,
+	GroupBackup:    srtapi.GroupBackup,
+	GroupBalancing: srtapi.GroupBalancing,
+}
+
+// A GroupEndpoint is a member of a socket group.
+type GroupEndpoint struct {
+	Address string // host:port
+	Weight  int    // 0 to 65535; see srtapi.GroupMember
+}
+
+// A GroupURL describes a dial of several endpoints bonded in a socket
+// group, as configuration files hold it:
+//
+//	srt://a.example.com:9000;weight=10,b.example.com:9000;weight=1?mode=backup&latency=200
+//
+// The endpoints are separated by commas, and may give a weight. The
+// query holds the group mode, broadcast if there are several endpoints
+// and no mode, and the options of the connection, which must be valid
+// for CheckOption. A URL of one endpoint and no mode stands for a plain
+// connection with the options.
+type GroupURL struct {
+	Mode      string
+	Endpoints []GroupEndpoint
+	Options   map[string]string
+}
+
+// ParseGroupURL parses s. Its errors are *url.Error.
+func ParseGroupURL(s string) (*GroupURL, error) {
+	u, err := parseGroupURL(s)
+	if err != nil {
+		return nil, &url.Error{Op: "parse", URL: s, Err: err}
+	}
+	return u, nil
+}
+
+func parseGroupURL(s string) (*GroupURL, error) {
+	if !strings.HasPrefix(s, urlPrefix) {
+		return nil, errors.New("missing srt:// scheme")
+	}
+	hosts, query := s[len(urlPrefix):], ""
+	if i := strings.IndexByte(hosts, '?'); i >= 0 {
+		hosts, query = hosts[:i], hosts[i+1:]
+	}
+	u := &GroupURL{}
+	for _, h := range strings.Split(hosts, ",") {
+		ep, err := parseGroupEndpoint(h)
+		if err != nil {
+			return nil, err
+		}
+		u.Endpoints = append(u.Endpoints, ep)
+	}
+	q, err := url.ParseQuery(query)
+	if err != nil {
+		return nil, err
+	}
+	for k, vs := range q {
+		if len(vs) > 1 {
+			return nil, fmt.Errorf("repeated %s", k)
+		}
+		if k == "mode" {
+			if _, ok := groupTypes[vs[0]]; !ok {
+				return nil, fmt.Errorf("unknown group mode %q", vs[0])
+			}
+			u.Mode = vs[0]
+			continue
+		}
+		if err := CheckOption(k, vs[0]); err != nil {
+			return nil, fmt.Errorf("option %s: %v", k, err)
+		}
+		if u.Options == nil {
+			u.Options = make(map[string]string)
+		}
+		u.Options[k] = vs[0]
+	}
+	if u.Mode == "" && len(u.Endpoints) > 1 {
+		u.Mode = GroupBroadcast
+	}
+	return u, nil
+}
+
+func parseGroupEndpoint(s string) (GroupEndpoint, error) {
+	var ep GroupEndpoint
+	addr, param := s, ""
+	if i := strings.IndexByte(s, ';'); i >= 0 {
+		addr, param = s[:i], s[i+1:]
+	}
+	if _, port, err := net.SplitHostPort(addr); err != nil {
+		return ep, err
+	} else if port == "" {
+		return ep, fmt.Errorf("missing port in address %q", addr)
+	}
+	ep.Address = addr
+	if param != "" {
+		if !strings.HasPrefix(param, "weight=") {
+			return ep, fmt.Errorf("unknown endpoint parameter %q", param)
+		}
+		w, err := strconv.Atoi(param[len("weight="):])
+		if err != nil || w < 0 || w > 0xFFFF {
+			return ep, fmt.Errorf("invalid weight in %q", s)
+		}
+		ep.Weight = w
+	}
+	return ep, nil
+}
+
+// String returns u in the syntax of ParseGroupURL, with the options in
+// key order.
+func (u *GroupURL) String() string {
+	var b strings.Builder
+	b.WriteString(urlPrefix)
+	for i, ep := range u.Endpoints {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+		b.WriteString(ep.Address)
+		if ep.Weight != 0 {
+			b.WriteString(";weight=")
+			b.WriteString(strconv.Itoa(ep.Weight))
+		}
+	}
+	q := make(url.Values)
+	for k, v := range u.Options {
+		q.Set(k, v)
+	}
+	if u.Mode != "" {
+		q.Set("mode", u.Mode)
+	}
+	if len(q) > 0 {
+		b.WriteByte('?')
+		b.WriteString(q.Encode())
+	}
+	return b.String()
+}
+
+// options returns the Options of u as an OptionSet, in key order.
+func (u *GroupURL) options() OptionSet {
+	keys := make([]string, 0, len(u.Options))
+	for k := range u.Options {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	var options OptionSet
+	for _, k := range keys {
+		options.list = append(options.list, option{key: k, value: u.Options[k]})
+	}
+	return options
+}
+
+// groupDialContextKey is the type of contextKeys carrying the members
+// of a group dial down to the SRT socket.
+type groupDialContextKey struct{}
+
+type groupDial struct {
+	typ     int
+	members []srtapi.GroupMember
+}
+
+func groupDialValue(ctx context.Context) *groupDial {
+	gd, _ := ctx.Value(groupDialContextKey{}).(*groupDial)
+	return gd
+}
+
+// groupSocket returns a new socket group of type typ.
+func groupSocket(typ int) (int, error) {
+	g, err := srtapi.CreateGroup(typ)
+	if err != nil {
+		return -1, os.NewSyscallError("srt_create_group", err)
+	}
+	if err = srtapi.SetNonblock(g, true); err != nil {
+		poll.CloseFunc(g)
+		return -1, os.NewSyscallError("setnonblock", err)
+	}
+	return g, nil
+}
+
+// dialURL dials the endpoints of u, as a group unless it stands for a
+// plain connection.
+func (d *Dialer) dialURL(ctx context.Context, network string, u *GroupURL) (net.Conn, error) {
+	ctx = WithOptions(ctx, u.options())
+	if u.Mode == "" {
+		return d.dial(ctx, network, u.Endpoints[0].Address)
+	}
+	g := NewGroup(u.Mode)
+	for _, ep := range u.Endpoints {
+		g.links = append(g.links, groupLink{remote: ep.Address, weight: ep.Weight})
+	}
+	c, err := d.dialGroup(ctx, network, g)
+	if err != nil {
+		return nil, err
+	}
+	return c, nil
+}
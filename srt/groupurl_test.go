@@ -0,0 +1,115 @@
+// Copyright (c) 2020 CyberAgent, Inc. All rights reserved.
+// https://github.com/openfresh/gosrt
+
+package srt
+
+import (
+	"context"
+	"errors"
+	"net/url"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/openfresh/gosrt/srtapi"
+)
+
+var parseGroupURLTests = []struct {
+	in   string
+	want *GroupURL
+}{
+	{"srt://a:9000,b:9000?mode=backup", &GroupURL{
+		Mode:      GroupBackup,
+		Endpoints: []GroupEndpoint{{Address: "a:9000"}, {Address: "b:9000"}},
+	}},
+	{"srt://a:9000;weight=10,[2001:db8::1]:9000;weight=1?mode=balancing&latency=200&streamid=feed", &GroupURL{
+		Mode:      GroupBalancing,
+		Endpoints: []GroupEndpoint{{Address: "a:9000", Weight: 10}, {Address: "[2001:db8::1]:9000", Weight: 1}},
+		Options:   map[string]string{"latency": "200", "streamid": "feed"},
+	}},
+	{"srt://a:9000,b:9000", &GroupURL{
+		Mode:      GroupBroadcast,
+		Endpoints: []GroupEndpoint{{Address: "a:9000"}, {Address: "b:9000"}},
+	}},
+	{"srt://a:9000?latency=120", &GroupURL{
+		Endpoints: []GroupEndpoint{{Address: "a:9000"}},
+		Options:   map[string]string{"latency": "120"},
+	}},
+}
+
+func TestParseGroupURL(t *testing.T) {
+	for _, tt := range parseGroupURLTests {
+		u, err := ParseGroupURL(tt.in)
+		if err != nil {
+			t.Errorf("ParseGroupURL(%q): %v", tt.in, err)
+			continue
+		}
+		if !reflect.DeepEqual(u, tt.want) {
+			t.Errorf("ParseGroupURL(%q) = %+v; want %+v", tt.in, u, tt.want)
+		}
+		if again, err := ParseGroupURL(u.String()); err != nil || !reflect.DeepEqual(again, u) {
+			t.Errorf("ParseGroupURL(%q) = %+v, %v; want %+v", u.String(), again, err, u)
+		}
+	}
+
+	for _, in := range []string{
+		"udp://a:9000",
+		"srt://",
+		"srt://a:9000,",
+		"srt://a",
+		"srt://a:",
+		"srt://a:9000;weight=-1",
+		"srt://a:9000;weight=65536",
+		"srt://a:9000;priority=1",
+		"srt://a:9000?mode=multicast",
+		"srt://a:9000?mode=backup&mode=broadcast",
+		"srt://a:9000?lateny=120",
+		"srt://a:9000?latency=low",
+	} {
+		_, err := ParseGroupURL(in)
+		if _, ok := err.(*url.Error); !ok {
+			t.Errorf("ParseGroupURL(%q): %v; want a *url.Error", in, err)
+		}
+	}
+}
+
+func TestDialURL(t *testing.T) {
+	ln, err := ListenContext(context.Background(), "srt4", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	addr := ln.Addr().String()
+
+	// One endpoint and no mode is a plain connection.
+	c, err := Dial("srt4", "srt://"+addr+"?streamid=feed")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	ln.(*SRTListener).SetDeadline(time.Now().Add(someTimeout))
+	p, err := ln.Accept()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer p.Close()
+	if sid, err := p.(*SRTConn).StreamID(); err != nil || sid != "feed" {
+		t.Errorf("stream ID %q, %v; want feed", sid, err)
+	}
+
+	if _, err := Dial("srt4", "srt://"+addr+"?mode=none"); err == nil {
+		t.Error("dial of an invalid URL succeeded")
+	}
+
+	_, err = Dial("srt4", "srt://"+addr+","+addr+"?mode=backup")
+	if !srtapi.Has(srtapi.FeatureGroups) {
+		if !errors.Is(err, srtapi.EINVOP) {
+			t.Errorf("group dial without groups: %v; want %v", err, srtapi.EINVOP)
+		}
+		return
+	}
+	// The listener doesn't take group connections.
+	if err == nil {
+		t.Error("group dial to a listener without groupconnect succeeded")
+	}
+}
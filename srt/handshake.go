@@ -0,0 +1,60 @@
+// Copyright (c) 2020 CyberAgent, Inc. All rights reserved.
+// https://github.com/openfresh/gosrt
+
+package srt
+
+import (
+	"context"
+	"strconv"
+	"time"
+)
+
+// rendezvousTimeoFactor is how much longer than "conntimeo" libsrt
+// waits for a rendezvous handshake.
+const rendezvousTimeoFactor = 10
+
+// HandshakeTiming tunes how long a Dialer waits for the handshake of
+// a peer, which the defaults of libsrt, tuned for terrestrial links,
+// give up on too early over links of seconds of round trip, such as
+// satellite ones. Zero fields keep the defaults, or the options of the
+// dial's context.
+type HandshakeTiming struct {
+	// ConnectTimeout is how long the handshake request is repeated,
+	// every 250ms, before the dial fails with RejectTimeout; libsrt
+	// defaults to 3s. It sets the "conntimeo" option, which libsrt
+	// applies ten times over to rendezvous handshakes; ConnectTimeout
+	// is the whole wait in either mode. The Timeout and Deadline of
+	// the Dialer still bound the dial.
+	ConnectTimeout time.Duration
+
+	// PeerIdleTimeout is how long an established connection may hear
+	// nothing from its peer before it is broken, 5s by default: the
+	// "peeridletimeo" option.
+	PeerIdleTimeout time.Duration
+}
+
+// withOptions returns ctx with the options of h added.
+func (h *HandshakeTiming) withOptions(ctx context.Context) context.Context {
+	var options OptionSet
+	if h.ConnectTimeout > 0 {
+		d := h.ConnectTimeout
+		if v, ok := Option(ctx, "rendezvous"); ok {
+			if on, _ := strconv.ParseBool(v); on {
+				d /= rendezvousTimeoFactor
+			}
+		}
+		options.list = append(options.list, option{key: "conntimeo", value: millis(d)})
+	}
+	if h.PeerIdleTimeout > 0 {
+		options.list = append(options.list, option{key: "peeridletimeo", value: millis(h.PeerIdleTimeout)})
+	}
+	if len(options.list) == 0 {
+		return ctx
+	}
+	return WithOptions(ctx, options)
+}
+
+// millis returns d in milliseconds, rounded up.
+func millis(d time.Duration) string {
+	return strconv.FormatInt(int64((d+time.Millisecond-1)/time.Millisecond), 10)
+}
@@ -0,0 +1,60 @@
+// Copyright (c) 2020 CyberAgent, Inc. All rights reserved.
+// https://github.com/openfresh/gosrt
+
+package srt
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/openfresh/gosrt/srtapi"
+)
+
+func TestHandshakeTiming(t *testing.T) {
+	for _, tt := range []struct {
+		h         HandshakeTiming
+		options   OptionSet
+		conntimeo string
+		idle      string
+	}{
+		{HandshakeTiming{}, Options(), "", ""},
+		{HandshakeTiming{ConnectTimeout: 20 * time.Second, PeerIdleTimeout: 1500 * time.Microsecond}, Options(), "20000", "2"},
+		{HandshakeTiming{ConnectTimeout: 20 * time.Second}, Options("rendezvous", "true", "conntimeo", "100"), "2000", ""},
+		{HandshakeTiming{PeerIdleTimeout: time.Minute}, Options("conntimeo", "100"), "100", "60000"},
+	} {
+		ctx := tt.h.withOptions(WithOptions(context.Background(), tt.options))
+		if v, _ := Option(ctx, "conntimeo"); v != tt.conntimeo {
+			t.Errorf("%+v: conntimeo %q; want %q", tt.h, v, tt.conntimeo)
+		}
+		if v, _ := Option(ctx, "peeridletimeo"); v != tt.idle {
+			t.Errorf("%+v: peeridletimeo %q; want %q", tt.h, v, tt.idle)
+		}
+	}
+}
+
+func TestDialHandshakeTiming(t *testing.T) {
+	ln, err := ListenContext(context.Background(), "srt4", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	go func() {
+		c, err := ln.Accept()
+		if err == nil {
+			defer c.Close()
+			c.Read(make([]byte, 1))
+		}
+	}()
+
+	d := Dialer{Handshake: &HandshakeTiming{ConnectTimeout: 10 * time.Second, PeerIdleTimeout: 30 * time.Second}}
+	c, err := d.Dial("srt4", ln.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	s := c.(*SRTConn).SocketID()
+	if v, err := srtapi.GetsockflagInt(s, srtapi.OptionPeeridletimeo); err != nil || v != 30000 {
+		t.Errorf("peeridletimeo %d, %v; want 30000", v, err)
+	}
+}
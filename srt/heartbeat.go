@@ -0,0 +1,230 @@
+// Copyright (c) 2020 CyberAgent, Inc. All rights reserved.
+// https://github.com/openfresh/gosrt
+
+package srt
+
+import (
+	"bytes"
+	"encoding/binary"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// DefaultHeartbeatInterval is the interval of a HeartbeatConn made with
+// an interval of 0.
+const DefaultHeartbeatInterval = time.Second
+
+// The heartbeat messages are the magic, a kind, and for pings and
+// pongs the time the ping was sent at, on the clock of its sender.
+// Data messages starting with the magic are sent with the kind
+// heartbeatData before them, so that none is taken for a heartbeat.
+const (
+	heartbeatMagic = "\xffSRT-HB"
+	heartbeatPing  = 'p'
+	heartbeatPong  = 'P'
+	heartbeatData  = 'd'
+
+	heartbeatHeader = len(heartbeatMagic) + 1
+	heartbeatLen    = heartbeatHeader + 8
+)
+
+// HeartbeatStatus is the liveness of the peer of a HeartbeatConn.
+type HeartbeatStatus struct {
+	// RTT is the round trip time of the last ping answered, 0 before
+	// the first.
+	RTT time.Duration
+
+	// LastReply is when the last ping was answered, and LastRecv
+	// when the last message of any kind came, zero before the first.
+	LastReply time.Time
+	LastRecv  time.Time
+
+	Pings   uint64 // pings sent
+	Replies uint64 // pings answered
+}
+
+// A HeartbeatConn is an SRTConn sending a ping, a message of 16 bytes,
+// whenever nothing was written for an interval, so that the flows of
+// an idle connection stay open across the NATs and firewalls which
+// forget them sooner than the SRT keepalives come, and measuring from
+// the replies whether the peer is still answering at the application
+// layer. Both sides must use one: a HeartbeatConn answers the pings it
+// reads and keeps them, and the replies, from the data.
+//
+// The pings and replies are taken in by Read, so a side that doesn't
+// read otherwise should have a goroutine read and discard the data.
+// Only Write counts as activity; the data written otherwise, with
+// WriteContext or SendMessage say, must not start with the bytes of a
+// ping.
+type HeartbeatConn struct {
+	*SRTConn
+	interval time.Duration
+	base     time.Time
+
+	lastWrite int64 // since base, atomically
+
+	mu     sync.Mutex
+	status HeartbeatStatus
+
+	rmu  sync.Mutex
+	rbuf []byte // for the reads into buffers too short for a ping
+
+	stop     chan struct{}
+	done     chan struct{}
+	stopOnce sync.Once
+}
+
+// NewHeartbeatConn returns c sending a ping after each interval
+// without writes, or DefaultHeartbeatInterval if interval is 0, until
+// it is closed.
+func NewHeartbeatConn(c *SRTConn, interval time.Duration) *HeartbeatConn {
+	if interval <= 0 {
+		interval = DefaultHeartbeatInterval
+	}
+	hc := &HeartbeatConn{
+		SRTConn:  c,
+		interval: interval,
+		base:     time.Now(),
+		stop:     make(chan struct{}),
+		done:     make(chan struct{}),
+	}
+	go hc.run()
+	return hc
+}
+
+// run sends the pings until hc is closed or a ping fails.
+func (hc *HeartbeatConn) run() {
+	defer close(hc.done)
+	t := time.NewTicker(hc.interval / 4)
+	defer t.Stop()
+	for {
+		select {
+		case <-hc.stop:
+			return
+		case <-t.C:
+		}
+		now := time.Since(hc.base)
+		if now-time.Duration(atomic.LoadInt64(&hc.lastWrite)) < hc.interval {
+			continue
+		}
+		if err := hc.send(heartbeatPing, now); err != nil {
+			return
+		}
+		hc.mu.Lock()
+		hc.status.Pings++
+		hc.mu.Unlock()
+	}
+}
+
+// send writes a heartbeat of kind stamped with at.
+func (hc *HeartbeatConn) send(kind byte, at time.Duration) error {
+	var b [heartbeatLen]byte
+	copy(b[:], heartbeatMagic)
+	b[len(heartbeatMagic)] = kind
+	binary.BigEndian.PutUint64(b[heartbeatHeader:], uint64(at))
+	atomic.StoreInt64(&hc.lastWrite, int64(time.Since(hc.base)))
+	_, err := hc.SRTConn.Write(b[:])
+	return err
+}
+
+// Write writes b as a message, and puts off the next ping.
+func (hc *HeartbeatConn) Write(b []byte) (int, error) {
+	atomic.StoreInt64(&hc.lastWrite, int64(time.Since(hc.base)))
+	if !bytes.HasPrefix(b, []byte(heartbeatMagic)) {
+		return hc.SRTConn.Write(b)
+	}
+	msg := make([]byte, 0, heartbeatHeader+len(b))
+	msg = append(append(append(msg, heartbeatMagic...), heartbeatData), b...)
+	n, err := hc.SRTConn.Write(msg)
+	if n -= heartbeatHeader; n < 0 {
+		n = 0
+	}
+	return n, err
+}
+
+// Read reads the next data message, answering the pings and taking in
+// the replies that come before it.
+func (hc *HeartbeatConn) Read(b []byte) (int, error) {
+	hc.rmu.Lock()
+	defer hc.rmu.Unlock()
+	buf := b
+	if len(b) < heartbeatLen {
+		if hc.rbuf == nil {
+			hc.rbuf = make([]byte, framedReadSize)
+		}
+		buf = hc.rbuf
+	}
+	for {
+		n, err := hc.SRTConn.Read(buf)
+		if err != nil {
+			return 0, err
+		}
+		now := time.Now()
+		msg := buf[:n]
+		kind, at, ok := parseHeartbeat(msg)
+		hc.mu.Lock()
+		hc.status.LastRecv = now
+		if kind == heartbeatPong && ok {
+			hc.status.RTT = now.Sub(hc.base) - at
+			hc.status.LastReply = now
+			hc.status.Replies++
+		}
+		hc.mu.Unlock()
+		switch kind {
+		case heartbeatPing:
+			if ok {
+				if err := hc.send(heartbeatPong, at); err != nil {
+					return 0, err
+				}
+			}
+			continue
+		case heartbeatPong:
+			continue
+		case heartbeatData:
+			msg = msg[heartbeatHeader:]
+		}
+		return copy(b, msg), nil
+	}
+}
+
+// parseHeartbeat returns the kind of the message b, 0 for data, and for
+// a ping or a reply its time and whether it is well formed.
+func parseHeartbeat(b []byte) (kind byte, at time.Duration, ok bool) {
+	if len(b) < heartbeatHeader || !bytes.HasPrefix(b, []byte(heartbeatMagic)) {
+		return 0, 0, false
+	}
+	kind = b[len(heartbeatMagic)]
+	switch kind {
+	case heartbeatPing, heartbeatPong:
+		if len(b) != heartbeatLen {
+			return kind, 0, false
+		}
+		return kind, time.Duration(binary.BigEndian.Uint64(b[heartbeatHeader:])), true
+	case heartbeatData:
+		return kind, 0, true
+	}
+	return 0, 0, false
+}
+
+// Heartbeat returns the liveness of the peer.
+func (hc *HeartbeatConn) Heartbeat() HeartbeatStatus {
+	hc.mu.Lock()
+	defer hc.mu.Unlock()
+	return hc.status
+}
+
+// Alive reports whether anything came from the peer, a reply or data,
+// within the last d.
+func (hc *HeartbeatConn) Alive(d time.Duration) bool {
+	last := hc.Heartbeat().LastRecv
+	return !last.IsZero() && time.Since(last) < d
+}
+
+// Close stops the pings, and closes the connection.
+func (hc *HeartbeatConn) Close() error {
+	hc.stopOnce.Do(func() { close(hc.stop) })
+	err := hc.SRTConn.Close()
+	<-hc.done
+	return err
+}
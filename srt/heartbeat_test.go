@@ -0,0 +1,69 @@
+// Copyright (c) 2020 CyberAgent, Inc. All rights reserved.
+// https://github.com/openfresh/gosrt
+
+package srt
+
+import (
+	"testing"
+	"time"
+)
+
+func TestHeartbeatConn(t *testing.T) {
+	c1, c2, err := Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	h1 := NewHeartbeatConn(c1, 50*time.Millisecond)
+	h2 := NewHeartbeatConn(c2, time.Hour)
+	defer h1.Close()
+	defer h2.Close()
+
+	// h2 answers the pings of the idle h1 as it reads, and hands over
+	// the data of h1 only, a message starting like a ping included.
+	msgs := make(chan string, 2)
+	go func() {
+		b := make([]byte, 1500)
+		for {
+			n, err := h2.Read(b)
+			if err != nil {
+				close(msgs)
+				return
+			}
+			msgs <- string(b[:n])
+		}
+	}()
+	go func() {
+		b := make([]byte, 4)
+		for {
+			if _, err := h1.Read(b); err != nil {
+				return
+			}
+		}
+	}()
+	deadline := time.Now().Add(someTimeout)
+	for h1.Heartbeat().Replies < 2 {
+		if time.Now().After(deadline) {
+			t.Fatalf("status %+v; want pings answered", h1.Heartbeat())
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if st := h1.Heartbeat(); st.RTT <= 0 || st.Pings < st.Replies || !h1.Alive(time.Second) {
+		t.Errorf("status %+v; want a round trip time and the peer alive", st)
+	}
+	if h2.Heartbeat().Pings != 0 {
+		t.Errorf("h2 sent %d pings within an hour", h2.Heartbeat().Pings)
+	}
+	for _, m := range []string{"hello", heartbeatMagic + "p12345678"} {
+		if _, err := h1.Write([]byte(m)); err != nil {
+			t.Fatal(err)
+		}
+		select {
+		case got := <-msgs:
+			if got != m {
+				t.Errorf("read %q; want %q", got, m)
+			}
+		case <-time.After(someTimeout):
+			t.Fatalf("%q not read", m)
+		}
+	}
+}
@@ -21,4 +21,13 @@ var (
 	connectFunc       = srtapi.Connect
 	listenFunc        = srtapi.Listen
 	getsockoptIntFunc = srtapi.GetsockoptInt
+	getsockstateFunc  = srtapi.Getsockstate
+	getSendStateFunc  = srtapi.GetSendState
+	getRecvStateFunc  = srtapi.GetRecvState
+	bistatsFunc       = srtapi.Bistats
+
+	// Whether the SRT library reports the events of a feature itself,
+	// which connections make up for otherwise (see recvSeq and
+	// eventPoll).
+	hasReportsFunc = srtapi.Has
 )
@@ -0,0 +1,122 @@
+// Copyright (c) 2020 CyberAgent, Inc. All rights reserved.
+// https://github.com/openfresh/gosrt
+
+package srt
+
+import (
+	"context"
+	"net"
+	"syscall"
+
+	"github.com/openfresh/gosrt/srtapi"
+)
+
+// Hooks are called around the dials and accepts made with a context
+// carrying them (see WithHooks), for metrics, logging or admission
+// control to be layered over the package. Any of them may be nil. The
+// op they are given is "dial" or "accept".
+type Hooks struct {
+	// BeforeHandshake is called before a dial starts its handshake
+	// with addr, and when a listener hears a handshake from addr, with
+	// the stream ID of the caller. An error fails the dial, or rejects
+	// the caller, with the reason of the RejectError it wraps if that
+	// is an extended one, RejectXForbidden say. Listeners call it from
+	// their listen callback, which needs srtapi.FeatureListenCallback,
+	// after any callback set with WithListenCallback accepted the
+	// caller; it must answer quickly.
+	BeforeHandshake func(ctx context.Context, op string, addr net.Addr, streamID string) error
+
+	// AfterConnect is called with each connection a dial made or
+	// Accept took, before it is returned. An error closes the
+	// connection, and fails the dial; Accept goes on to the next
+	// connection.
+	AfterConnect func(ctx context.Context, op string, c *SRTConn) error
+
+	// OnError is called with the errors of dials and accepts,
+	// including those of the other hooks. For listeners, addr is the
+	// caller, or the listener's own address if the error is not about
+	// a caller.
+	OnError func(ctx context.Context, op string, addr net.Addr, err error)
+}
+
+// hooksContextKey is the type of contextKeys used for Hooks.
+type hooksContextKey struct{}
+
+// WithHooks returns a new context.Context with h called after the
+// hooks ctx already carries, so that each layer adds its own.
+func WithHooks(ctx context.Context, h *Hooks) context.Context {
+	prev := hooksValue(ctx)
+	hs := make(hookChain, len(prev), len(prev)+1)
+	copy(hs, prev)
+	return context.WithValue(ctx, hooksContextKey{}, append(hs, h))
+}
+
+func hooksValue(ctx context.Context) hookChain {
+	hs, _ := ctx.Value(hooksContextKey{}).(hookChain)
+	return hs
+}
+
+// A hookChain is the hooks of a context, in the order they were added.
+type hookChain []*Hooks
+
+func (hs hookChain) beforeHandshake(ctx context.Context, op string, addr net.Addr, streamID string) error {
+	for _, h := range hs {
+		if h.BeforeHandshake != nil {
+			if err := h.BeforeHandshake(ctx, op, addr, streamID); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// afterConnect runs the AfterConnect hooks on c, and closes c if one
+// fails.
+func (hs hookChain) afterConnect(ctx context.Context, op string, c *SRTConn) error {
+	for _, h := range hs {
+		if h.AfterConnect != nil {
+			if err := h.AfterConnect(ctx, op, c); err != nil {
+				c.fd.Close()
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (hs hookChain) onError(ctx context.Context, op string, addr net.Addr, err error) {
+	for _, h := range hs {
+		if h.OnError != nil {
+			h.OnError(ctx, op, addr, err)
+		}
+	}
+}
+
+func (hs hookChain) handshakes() bool {
+	for _, h := range hs {
+		if h.BeforeHandshake != nil {
+			return true
+		}
+	}
+	return false
+}
+
+// hooksCallback returns the listen callback running the
+// BeforeHandshake hooks on each caller callback accepts.
+func hooksCallback(ctx context.Context, callback srtapi.SrtListenCallbackFunc, hs hookChain) srtapi.SrtListenCallbackFunc {
+	return func(ns, hsversion int, peer syscall.Sockaddr, streamid string) int {
+		ret := 0
+		if callback != nil {
+			if ret = callback(ns, hsversion, peer, streamid); ret < 0 {
+				return ret
+			}
+		}
+		addr := sockaddrToSRT(peer)
+		if err := hs.beforeHandshake(ctx, "accept", addr, streamid); err != nil {
+			hs.onError(ctx, "accept", addr, err)
+			setRejectReason(ns, err)
+			return -1
+		}
+		return ret
+	}
+}
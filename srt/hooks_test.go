@@ -0,0 +1,146 @@
+// Copyright (c) 2020 CyberAgent, Inc. All rights reserved.
+// https://github.com/openfresh/gosrt
+
+package srt
+
+import (
+	"context"
+	"errors"
+	"net"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/openfresh/gosrt/srtapi"
+)
+
+// hookLog records the calls of the hooks it makes.
+type hookLog struct {
+	mu    sync.Mutex
+	calls []string
+}
+
+func (l *hookLog) add(s string) {
+	l.mu.Lock()
+	l.calls = append(l.calls, s)
+	l.mu.Unlock()
+}
+
+func (l *hookLog) get() []string {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return append([]string(nil), l.calls...)
+}
+
+func (l *hookLog) hooks(name string, reject string) *Hooks {
+	return &Hooks{
+		BeforeHandshake: func(ctx context.Context, op string, addr net.Addr, streamID string) error {
+			l.add(name + " before " + op + " " + streamID)
+			if streamID == reject {
+				return errors.New("rejected")
+			}
+			return nil
+		},
+		AfterConnect: func(ctx context.Context, op string, c *SRTConn) error {
+			l.add(name + " after " + op)
+			return nil
+		},
+		OnError: func(ctx context.Context, op string, addr net.Addr, err error) {
+			l.add(name + " error " + op)
+		},
+	}
+}
+
+func TestHooks(t *testing.T) {
+	if !srtapi.Has(srtapi.FeatureListenCallback) {
+		t.Skip("no listen callbacks")
+	}
+	var ll, dl hookLog
+	lctx := WithHooks(WithHooks(context.Background(), ll.hooks("outer", "")), ll.hooks("inner", "deny"))
+	ln, err := listenSRT(lctx, "srt4", &SRTAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	raddr := ln.fd.laddr.(*SRTAddr)
+
+	dctx := WithHooks(context.Background(), dl.hooks("dial", "local"))
+	c, err := dialSRT(WithOptions(dctx, Options("streamid", "feed")), "srt4", nil, raddr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	ln.SetDeadline(time.Now().Add(someTimeout))
+	p, err := ln.accept()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer p.Close()
+
+	if _, err := dialSRT(WithOptions(dctx, Options("streamid", "deny")), "srt4", nil, raddr); err == nil {
+		t.Error("dial rejected by the listener hook succeeded")
+	}
+	if _, err := dialSRT(WithOptions(dctx, Options("streamid", "local")), "srt4", nil, raddr); err == nil {
+		t.Error("dial rejected by its own hook succeeded")
+	}
+
+	want := []string{
+		"dial before dial feed", "dial after dial",
+		"dial before dial deny", "dial error dial",
+		"dial before dial local", "dial error dial",
+	}
+	if got := dl.get(); !reflect.DeepEqual(got, want) {
+		t.Errorf("dial hooks: %q; want %q", got, want)
+	}
+	want = []string{
+		"outer before accept feed", "inner before accept feed",
+		"outer after accept", "inner after accept",
+		"outer before accept deny", "inner before accept deny", "outer error accept", "inner error accept",
+	}
+	if got := ll.get(); !reflect.DeepEqual(got, want) {
+		t.Errorf("listener hooks: %q; want %q", got, want)
+	}
+}
+
+func TestHooksAfterConnect(t *testing.T) {
+	refuse := errors.New("refused")
+	var errs []error
+	n := 0
+	ctx := WithHooks(context.Background(), &Hooks{
+		AfterConnect: func(ctx context.Context, op string, c *SRTConn) error {
+			if op == "accept" {
+				if n++; n == 1 {
+					return refuse
+				}
+			}
+			return nil
+		},
+		OnError: func(ctx context.Context, op string, addr net.Addr, err error) {
+			errs = append(errs, err)
+		},
+	})
+	ln, err := listenSRT(ctx, "srt4", &SRTAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	for i := 0; i < 2; i++ {
+		c, err := dialSRT(context.Background(), "srt4", nil, ln.fd.laddr.(*SRTAddr))
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer c.Close()
+	}
+
+	// Accept drops the first connection, and returns the second.
+	ln.SetDeadline(time.Now().Add(someTimeout))
+	p, err := ln.accept()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer p.Close()
+	if n != 2 || len(errs) != 1 || errs[0] != refuse {
+		t.Errorf("%d AfterConnect calls, errors %v; want 2 and the refusal", n, errs)
+	}
+}
@@ -8,94 +8,22 @@
 
 package srt
 
-import (
-	"net"
-	"os"
-	"syscall"
-	"unsafe"
-)
-
-// adapterAddresses returns a list of IP adapter and address
-// structures. The structure contains an IP adapter and flattened
-// multiple IP addresses including unicast, anycast and multicast
-// addresses.
-func adapterAddresses() ([]*windows.IpAdapterAddresses, error) {
-	var b []byte
-	l := uint32(15000) // recommended initial size
-	for {
-		b = make([]byte, l)
-		err := windows.GetAdaptersAddresses(syscall.AF_UNSPEC, windows.GAA_FLAG_INCLUDE_PREFIX, 0, (*windows.IpAdapterAddresses)(unsafe.Pointer(&b[0])), &l)
-		if err == nil {
-			if l == 0 {
-				return nil, nil
-			}
-			break
-		}
-		if err.(syscall.Errno) != syscall.ERROR_BUFFER_OVERFLOW {
-			return nil, os.NewSyscallError("getadaptersaddresses", err)
-		}
-		if l <= uint32(len(b)) {
-			return nil, os.NewSyscallError("getadaptersaddresses", err)
-		}
-	}
-	var aas []*windows.IpAdapterAddresses
-	for aa := (*windows.IpAdapterAddresses)(unsafe.Pointer(&b[0])); aa != nil; aa = aa.Next {
-		aas = append(aas, aa)
-	}
-	return aas, nil
-}
+import "net"
 
 // If the ifindex is zero, interfaceTable returns mappings of all
 // network interfaces. Otherwise it returns a mapping of a specific
 // interface.
+//
+// The adapter table is only reachable through the standard library's
+// internal/syscall/windows package, so this leaves walking it to the
+// net package.
 func interfaceTable(ifindex int) ([]net.Interface, error) {
-	aas, err := adapterAddresses()
+	if ifindex == 0 {
+		return net.Interfaces()
+	}
+	ifi, err := net.InterfaceByIndex(ifindex)
 	if err != nil {
 		return nil, err
 	}
-	var ift []net.Interface
-	for _, aa := range aas {
-		index := aa.IfIndex
-		if index == 0 { // ipv6IfIndex is a substitute for ifIndex
-			index = aa.Ipv6IfIndex
-		}
-		if ifindex == 0 || ifindex == int(index) {
-			ifi := net.Interface{
-				Index: int(index),
-				Name:  syscall.UTF16ToString((*(*[10000]uint16)(unsafe.Pointer(aa.FriendlyName)))[:]),
-			}
-			if aa.OperStatus == windows.IfOperStatusUp {
-				ifi.Flags |= FlagUp
-			}
-			// For now we need to infer link-layer service
-			// capabilities from media types.
-			// We will be able to use
-			// MIB_IF_ROW2.AccessType once we drop support
-			// for Windows XP.
-			switch aa.IfType {
-			case windows.IF_TYPE_ETHERNET_CSMACD, windows.IF_TYPE_ISO88025_TOKENRING, windows.IF_TYPE_IEEE80211, windows.IF_TYPE_IEEE1394:
-				ifi.Flags |= net.FlagBroadcast | net.FlagMulticast
-			case windows.IF_TYPE_PPP, windows.IF_TYPE_TUNNEL:
-				ifi.Flags |= net.FlagPointToPoint | net.FlagMulticast
-			case windows.IF_TYPE_SOFTWARE_LOOPBACK:
-				ifi.Flags |= net.FlagLoopback | net.FlagMulticast
-			case windows.IF_TYPE_ATM:
-				ifi.Flags |= net.FlagBroadcast | net.FlagPointToPoint | net.FlagMulticast // assume all services available; LANE, point-to-point and point-to-multipoint
-			}
-			if aa.Mtu == 0xffffffff {
-				ifi.MTU = -1
-			} else {
-				ifi.MTU = int(aa.Mtu)
-			}
-			if aa.PhysicalAddressLength > 0 {
-				ifi.HardwareAddr = make(net.HardwareAddr, aa.PhysicalAddressLength)
-				copy(ifi.HardwareAddr, aa.PhysicalAddress[:])
-			}
-			ift = append(ift, ifi)
-			if ifindex == ifi.Index {
-				break
-			}
-		}
-	}
-	return ift, nil
+	return []net.Interface{*ifi}, nil
 }
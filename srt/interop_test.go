@@ -0,0 +1,249 @@
+// Copyright (c) 2020 CyberAgent, Inc. All rights reserved.
+// https://github.com/openfresh/gosrt
+
+// +build !srtmock
+
+package srt
+
+import (
+	"bytes"
+	"context"
+	"flag"
+	"fmt"
+	"net"
+	"net/url"
+	"os"
+	"os/exec"
+	"testing"
+	"time"
+
+	"github.com/openfresh/gosrt/srtapi"
+)
+
+// The interop tests exchange data with srt-live-transmit, the
+// reference application of libsrt, in both directions. They only run
+// when given its path:
+//
+//	go test -run Interop ./srt -srt-live-transmit=/usr/local/bin/srt-live-transmit
+var interopBinary = flag.String("srt-live-transmit", "", "path of the srt-live-transmit binary the interop tests run against")
+
+// An interopTest is a scenario run with gosrt as caller sending to an
+// srt-live-transmit listener, then with srt-live-transmit calling a
+// gosrt listener.
+type interopTest struct {
+	name string
+
+	ours   []string // options of the gosrt socket
+	theirs []string // URI query parameters of srt-live-transmit
+	size   int      // size of the messages; 1316 if zero
+
+	// check, if set, inspects the gosrt end once data went through.
+	check func(t *testing.T, c *SRTConn)
+}
+
+var interopTests = []interopTest{
+	{name: "plain"},
+	{
+		name:   "encryption",
+		ours:   []string{"passphrase", "interop-passphrase", "pbkeylen", "32"},
+		theirs: []string{"passphrase", "interop-passphrase", "pbkeylen", "32"},
+		check: func(t *testing.T, c *SRTConn) {
+			if km, err := getsockoptIntFunc(c.fd.pfd.Sysfd, 0, srtapi.OptionKmstate); err != nil || km != srtapi.KmStateSecured {
+				t.Errorf("got key material state %d, %v; want secured", km, err)
+			}
+		},
+	},
+	{
+		name:   "streamid",
+		ours:   []string{"streamid", "#!::r=live/feed,m=publish"},
+		theirs: []string{"streamid", "#!::r=live/feed,m=publish"},
+		check: func(t *testing.T, c *SRTConn) {
+			if id, err := c.StreamID(); err != nil || id != "#!::r=live/feed,m=publish" {
+				t.Errorf("got stream ID %q, %v; want the caller's", id, err)
+			}
+		},
+	},
+	{
+		name:   "latency",
+		ours:   []string{"latency", "120"},
+		theirs: []string{"latency", "400"},
+		check: func(t *testing.T, c *SRTConn) {
+			for _, opt := range []int{srtapi.OptionRcvlatency, srtapi.OptionPeerlatency} {
+				if ms, err := getsockoptIntFunc(c.fd.pfd.Sysfd, 0, opt); err != nil || ms != 400 {
+					t.Errorf("got negotiated latency %d, %v; want 400", ms, err)
+				}
+			}
+		},
+	},
+	{
+		name:   "bigpayload",
+		ours:   []string{"payloadsize", "1456"},
+		theirs: []string{"payloadsize", "1456"},
+		size:   1456,
+	},
+}
+
+// interopMessages is the number of messages each scenario sends.
+const interopMessages = 50
+
+func interopBin(t *testing.T) string {
+	if *interopBinary == "" {
+		t.Skip("no -srt-live-transmit given")
+	}
+	return *interopBinary
+}
+
+// startInterop runs srt-live-transmit from input to output, stopping
+// it when the test ends.
+func startInterop(t *testing.T, input, output string, size int) {
+	cmd := exec.Command(interopBin(t), fmt.Sprintf("-chunk:%d", size), "-loglevel:error", input, output)
+	cmd.Stderr = os.Stderr
+	if err := cmd.Start(); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		cmd.Process.Kill()
+		cmd.Wait()
+	})
+}
+
+// interopURI returns the srt:// URI of addr in mode with params.
+func interopURI(addr, mode string, params []string) string {
+	q := url.Values{"mode": {mode}}
+	for i := 0; i+1 < len(params); i += 2 {
+		q.Set(params[i], params[i+1])
+	}
+	return "srt://" + addr + "?" + q.Encode()
+}
+
+// freePort returns a UDP port of the loopback interface nothing is
+// bound to at the time.
+func freePort(t *testing.T) int {
+	c, err := net.ListenUDP("udp4", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	return c.LocalAddr().(*net.UDPAddr).Port
+}
+
+func interopMessage(i, size int) []byte {
+	b := bytes.Repeat([]byte{byte(i)}, size)
+	copy(b, fmt.Sprintf("message %d", i))
+	return b
+}
+
+// TestInteropSend sends from a gosrt caller through srt-live-transmit
+// listening, which relays to UDP.
+func TestInteropSend(t *testing.T) {
+	interopBin(t)
+	for _, tt := range interopTests {
+		t.Run(tt.name, func(t *testing.T) {
+			size := tt.size
+			if size == 0 {
+				size = 1316
+			}
+			out, err := net.ListenUDP("udp4", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer out.Close()
+			port := freePort(t)
+			startInterop(t, interopURI(fmt.Sprintf(":%d", port), "listener", tt.theirs), "udp://"+out.LocalAddr().String(), size)
+
+			// Retry until srt-live-transmit listens.
+			ctx := WithOptions(context.Background(), Options(tt.ours...))
+			var c net.Conn
+			for start := time.Now(); ; {
+				var d Dialer
+				if c, err = d.DialContext(ctx, "srt4", fmt.Sprintf("127.0.0.1:%d", port)); err == nil || time.Since(start) > 5*time.Second {
+					break
+				}
+				time.Sleep(100 * time.Millisecond)
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer c.Close()
+
+			go func() {
+				for i := 0; i < interopMessages; i++ {
+					if _, err := c.Write(interopMessage(i, size)); err != nil {
+						return
+					}
+					time.Sleep(5 * time.Millisecond)
+				}
+			}()
+			b := make([]byte, 2048)
+			for i := 0; i < interopMessages; i++ {
+				out.SetReadDeadline(time.Now().Add(someTimeout))
+				n, err := out.Read(b)
+				if err != nil {
+					t.Fatalf("message %d: %v", i, err)
+				}
+				if want := interopMessage(i, size); !bytes.Equal(b[:n], want) {
+					t.Fatalf("message %d: got %q; want %q", i, b[:n], want)
+				}
+			}
+			if tt.check != nil {
+				tt.check(t, c.(*SRTConn))
+			}
+		})
+	}
+}
+
+// TestInteropReceive receives on a gosrt listener what
+// srt-live-transmit reads from UDP and sends as caller.
+func TestInteropReceive(t *testing.T) {
+	interopBin(t)
+	for _, tt := range interopTests {
+		t.Run(tt.name, func(t *testing.T) {
+			size := tt.size
+			if size == 0 {
+				size = 1316
+			}
+			ctx := WithOptions(context.Background(), Options(tt.ours...))
+			ln, err := ListenContext(ctx, "srt4", "127.0.0.1:0")
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer ln.Close()
+			in := fmt.Sprintf("127.0.0.1:%d", freePort(t))
+			startInterop(t, "udp://"+in, interopURI(ln.Addr().String(), "caller", tt.theirs), size)
+
+			ln.(*SRTListener).SetDeadline(time.Now().Add(someTimeout))
+			c, err := ln.Accept()
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer c.Close()
+			src, err := net.Dial("udp4", in)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer src.Close()
+			go func() {
+				for i := 0; i < interopMessages; i++ {
+					if _, err := src.Write(interopMessage(i, size)); err != nil {
+						return
+					}
+					time.Sleep(5 * time.Millisecond)
+				}
+			}()
+			b := make([]byte, 2048)
+			for i := 0; i < interopMessages; i++ {
+				c.SetReadDeadline(time.Now().Add(someTimeout))
+				n, err := c.Read(b)
+				if err != nil {
+					t.Fatalf("message %d: %v", i, err)
+				}
+				if want := interopMessage(i, size); !bytes.Equal(b[:n], want) {
+					t.Fatalf("message %d: got %q; want %q", i, b[:n], want)
+				}
+			}
+			if tt.check != nil {
+				tt.check(t, c.(*SRTConn))
+			}
+		})
+	}
+}
@@ -0,0 +1,101 @@
+// Copyright (c) 2020 CyberAgent, Inc. All rights reserved.
+// https://github.com/openfresh/gosrt
+
+package srt
+
+import (
+	"context"
+	"sort"
+
+	"github.com/openfresh/gosrt/srtapi"
+)
+
+// Labels are key-value pairs describing a connection, such as the
+// tenant, channel or region it serves. They are carried by its
+// events, audit records and statistics, the lines of its connection
+// logger, and the metrics and admin entries of the statsd and srtadmin
+// packages. A Labels value is never modified once given to a
+// connection, so it can be shared.
+type Labels map[string]string
+
+// labelsContextKey is the type of contextKeys used for Labels.
+type labelsContextKey struct{}
+
+// WithLabels returns a new context.Context with the Labels of the
+// connections made with it, and accepted by the listeners made with
+// it: those of l, added to those ctx already carries.
+func WithLabels(ctx context.Context, l Labels) context.Context {
+	return context.WithValue(ctx, labelsContextKey{}, labelsValue(ctx).with(l))
+}
+
+func labelsValue(ctx context.Context) Labels {
+	l, _ := ctx.Value(labelsContextKey{}).(Labels)
+	return l
+}
+
+// with returns a copy of l with the labels of add, or l itself if add
+// is empty.
+func (l Labels) with(add Labels) Labels {
+	if len(add) == 0 {
+		return l
+	}
+	m := make(Labels, len(l)+len(add))
+	for k, v := range l {
+		m[k] = v
+	}
+	for k, v := range add {
+		m[k] = v
+	}
+	return m
+}
+
+// keyValues returns the labels as alternating keys and values, in key
+// order.
+func (l Labels) keyValues() []interface{} {
+	keys := make([]string, 0, len(l))
+	for k := range l {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	kv := make([]interface{}, 0, 2*len(keys))
+	for _, k := range keys {
+		kv = append(kv, k, l[k])
+	}
+	return kv
+}
+
+// setLabels gives fd the labels of ctx. It must be called before the
+// connection or listener is returned.
+func (fd *netFD) setLabels(ctx context.Context) {
+	if l := labelsValue(ctx); l != nil {
+		fd.labels.Store(l)
+	}
+}
+
+func (fd *netFD) getLabels() Labels {
+	l, _ := fd.labels.Load().(Labels)
+	return l
+}
+
+// Labels returns the labels of the connection, which must not be
+// modified; nil if it has none.
+func (c *conn) Labels() Labels {
+	if !c.ok() {
+		return nil
+	}
+	return c.fd.getLabels()
+}
+
+// SetLabel sets the label key of the connection to value, for an
+// accept hook or handler to label a connection once it knows more
+// about it, from its stream ID say. The events and records that follow
+// carry it; its connection logger keeps the labels it was made with.
+func (c *conn) SetLabel(key, value string) error {
+	if !c.ok() {
+		return srtapi.EINVPARAM
+	}
+	c.fd.labelmu.Lock()
+	defer c.fd.labelmu.Unlock()
+	c.fd.labels.Store(c.fd.getLabels().with(Labels{key: value}))
+	return nil
+}
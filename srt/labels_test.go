@@ -0,0 +1,80 @@
+// Copyright (c) 2020 CyberAgent, Inc. All rights reserved.
+// https://github.com/openfresh/gosrt
+
+package srt
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestLabels(t *testing.T) {
+	var mu sync.Mutex
+	var attempts []HandshakeAttempt
+	audit := func(a HandshakeAttempt) {
+		mu.Lock()
+		defer mu.Unlock()
+		attempts = append(attempts, a)
+	}
+	ctx := WithAudit(WithLabels(context.Background(), Labels{"region": "tokyo"}), audit)
+	ln, err := ListenContext(WithLabels(ctx, Labels{"service": "ingest"}), "srt4", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	d := Dialer{}
+	caller, err := d.DialContext(WithLabels(ctx, Labels{"tenant": "acme", "region": "osaka"}), "srt", ln.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer caller.Close()
+	ln.(*SRTListener).SetDeadline(time.Now().Add(someTimeout))
+	peer, err := ln.(*SRTListener).AcceptSRT()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer peer.Close()
+
+	if got, want := caller.(*SRTConn).Labels(), (Labels{"tenant": "acme", "region": "osaka"}); !reflect.DeepEqual(got, want) {
+		t.Errorf("caller labels %v; want %v", got, want)
+	}
+	want := Labels{"region": "tokyo", "service": "ingest"}
+	if got := peer.Labels(); !reflect.DeepEqual(got, want) {
+		t.Errorf("peer labels %v; want %v", got, want)
+	}
+
+	// A label set once accepted is added to a copy.
+	got := peer.Labels()
+	if err := peer.SetLabel("channel", "news"); err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 2 || peer.Labels()["channel"] != "news" {
+		t.Errorf("labels %v after SetLabel, %v before; want channel added to a copy", peer.Labels(), got)
+	}
+	if l, _ := peer.Stats()["labels"].(Labels); l["channel"] != "news" {
+		t.Errorf("stats labels %v; want those of the connection", peer.Stats()["labels"])
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	for _, a := range attempts {
+		if !reflect.DeepEqual(a.Labels, want) && !reflect.DeepEqual(a.Labels, caller.(*SRTConn).Labels()) {
+			t.Errorf("attempt labels %v", a.Labels)
+		}
+	}
+	if len(attempts) != 2 {
+		t.Fatalf("%d attempts; want 2", len(attempts))
+	}
+	a := attempts[0]
+	kv := a.KeyValues()
+	if s, w := fmt.Sprint(kv[len(kv)-2*len(a.Labels):]), fmt.Sprint(a.Labels.keyValues()); s != w {
+		t.Errorf("key values %v; want the labels %s last", kv, w)
+	}
+	if s, w := fmt.Sprint(Labels{"b": "2", "a": "1"}.keyValues()), "[a 1 b 2]"; s != w {
+		t.Errorf("keyValues = %s; want %s", s, w)
+	}
+}
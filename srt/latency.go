@@ -0,0 +1,196 @@
+// Copyright (c) 2020 CyberAgent, Inc. All rights reserved.
+// https://github.com/openfresh/gosrt
+
+package srt
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/openfresh/gosrt/internal/poll/runtime"
+	"github.com/openfresh/gosrt/srtapi"
+)
+
+// Defaults of the LatencyTuner fields left zero.
+const (
+	DefaultMinLatency      = 20 * time.Millisecond
+	DefaultMaxLatency      = 2 * time.Second
+	DefaultLatencyRTTs     = 4
+	DefaultLatencyInterval = time.Second
+)
+
+// latencyDropRaise is how much a LatencyTuner raises the latency of a
+// path whose connections drop packets as too late, and latencyEase how
+// much of the raise it gives back per interval without drops.
+const (
+	latencyDropRaise = 1.5
+	latencyEase      = 0.01
+)
+
+// A LatencyTuner picks the "latency" option of the connections of a
+// Dialer from what the previous connections to the same address went
+// through, so that each path gets about the latency it needs without
+// an operator tuning it: a multiple of its round trip time, raised
+// when packets arrive too late to be delivered. The latency of a
+// connection is agreed on in its handshake, so a new latency applies
+// from the next dial, a reconnect say; the connections established
+// keep theirs.
+//
+// The zero LatencyTuner is ready to use. The fields must not be changed
+// once it is used.
+type LatencyTuner struct {
+	// Min and Max bound the latencies picked; zero means
+	// DefaultMinLatency and DefaultMaxLatency.
+	Min, Max time.Duration
+
+	// RTTs is the latency in round trip times of the path, before
+	// drops raise it; 0 means DefaultLatencyRTTs.
+	RTTs float64
+
+	// Interval is the time between two looks at the statistics of a
+	// connection; 0 means DefaultLatencyInterval.
+	Interval time.Duration
+
+	mu    sync.Mutex
+	paths map[string]*latencyPath
+}
+
+// A latencyPath is what a LatencyTuner knows of an address.
+type latencyPath struct {
+	rtt   time.Duration // smoothed, rising at once
+	floor time.Duration // the latency drops called for
+}
+
+// A latencySample is the state of a connection over an interval.
+type latencySample struct {
+	rtt     time.Duration
+	latency time.Duration
+	dropped int64 // packets dropped as too late over the interval
+}
+
+// Latency returns the latency picked for address, and whether a
+// connection to it has been watched yet.
+func (t *LatencyTuner) Latency(address string) (time.Duration, bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	p := t.paths[address]
+	if p == nil {
+		return 0, false
+	}
+	return t.pick(p), true
+}
+
+// pick returns the latency of p. t.mu must be held.
+func (t *LatencyTuner) pick(p *latencyPath) time.Duration {
+	rtts := t.RTTs
+	if rtts <= 0 {
+		rtts = DefaultLatencyRTTs
+	}
+	l := time.Duration(rtts * float64(p.rtt))
+	if p.floor > l {
+		l = p.floor
+	}
+	min, max := t.Min, t.Max
+	if min <= 0 {
+		min = DefaultMinLatency
+	}
+	if max <= 0 {
+		max = DefaultMaxLatency
+	}
+	if l < min {
+		l = min
+	}
+	if l > max {
+		l = max
+	}
+	return l
+}
+
+// observe takes in a sample of a connection to address.
+func (t *LatencyTuner) observe(address string, s latencySample) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.paths == nil {
+		t.paths = make(map[string]*latencyPath)
+	}
+	p := t.paths[address]
+	if p == nil {
+		p = &latencyPath{rtt: s.rtt}
+		t.paths[address] = p
+	}
+	if s.rtt > p.rtt {
+		p.rtt = s.rtt
+	} else {
+		p.rtt += (s.rtt - p.rtt) / 8
+	}
+	if s.dropped > 0 {
+		if raised := time.Duration(latencyDropRaise * float64(s.latency)); raised > p.floor {
+			p.floor = raised
+		}
+	} else {
+		p.floor -= time.Duration(latencyEase * float64(p.floor))
+	}
+}
+
+// withOptions returns ctx with the latency picked for address, if any.
+func (t *LatencyTuner) withOptions(ctx context.Context, address string) context.Context {
+	l, ok := t.Latency(address)
+	if !ok {
+		return ctx
+	}
+	return WithOptions(ctx, Options("latency", millis(l)))
+}
+
+// Watch has t learn from c, a connection to address, until c is closed
+// or ctx is done. A Dialer with a LatencyTuner watches the connections
+// it makes; Watch is for those made otherwise.
+func (t *LatencyTuner) Watch(ctx context.Context, address string, c *SRTConn) {
+	if !c.ok() {
+		return
+	}
+	interval := t.Interval
+	if interval <= 0 {
+		interval = DefaultLatencyInterval
+	}
+	state := func() (latencySample, int64, bool) {
+		var snd srtapi.SendState
+		var rcv srtapi.RecvState
+		var serr, rerr error
+		if err := c.fd.pfd.RawControl(func(s int) {
+			snd, serr = getSendStateFunc(s)
+			rcv, rerr = getRecvStateFunc(s)
+		}); err != nil || serr != nil || rerr != nil {
+			return latencySample{}, 0, false
+		}
+		latency := rcv.LatencyMs
+		if snd.LatencyMs > latency {
+			latency = snd.LatencyMs
+		}
+		return latencySample{
+			rtt:     time.Duration(snd.RTTMs * float64(time.Millisecond)),
+			latency: time.Duration(latency) * time.Millisecond,
+		}, snd.PacketsDropped + rcv.PacketsDropped, true
+	}
+	_, prev, ok := state()
+	if !ok {
+		return
+	}
+	go func() {
+		tk := runtime.Clock.NewTicker(interval)
+		defer tk.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-tk.C():
+			}
+			s, dropped, ok := state()
+			if !ok {
+				return
+			}
+			s.dropped, prev = dropped-prev, dropped
+			t.observe(address, s)
+		}
+	}()
+}
@@ -0,0 +1,87 @@
+// Copyright (c) 2020 CyberAgent, Inc. All rights reserved.
+// https://github.com/openfresh/gosrt
+
+package srt
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/openfresh/gosrt/srtapi"
+)
+
+func TestLatencyTuner(t *testing.T) {
+	tu := &LatencyTuner{Min: 50 * time.Millisecond, Max: time.Second}
+	if _, ok := tu.Latency("a"); ok {
+		t.Error("latency picked for an address never watched")
+	}
+
+	// Four round trips, within the bounds.
+	tu.observe("a", latencySample{rtt: 30 * time.Millisecond, latency: 120 * time.Millisecond})
+	if l, _ := tu.Latency("a"); l != 120*time.Millisecond {
+		t.Errorf("latency %v at 30ms round trips; want 120ms", l)
+	}
+	tu.observe("b", latencySample{rtt: time.Millisecond})
+	if l, _ := tu.Latency("b"); l != tu.Min {
+		t.Errorf("latency %v at 1ms round trips; want the minimum %v", l, tu.Min)
+	}
+	tu.observe("b", latencySample{rtt: time.Second})
+	if l, _ := tu.Latency("b"); l != tu.Max {
+		t.Errorf("latency %v at 1s round trips; want the maximum %v", l, tu.Max)
+	}
+
+	// Drops raise the latency, which eases off slowly without them.
+	tu.observe("a", latencySample{rtt: 30 * time.Millisecond, latency: 120 * time.Millisecond, dropped: 3})
+	raised, _ := tu.Latency("a")
+	if raised != 180*time.Millisecond {
+		t.Errorf("latency %v after drops at 120ms; want 180ms", raised)
+	}
+	tu.observe("a", latencySample{rtt: 30 * time.Millisecond, latency: 180 * time.Millisecond})
+	if l, _ := tu.Latency("a"); l >= raised || l < 170*time.Millisecond {
+		t.Errorf("latency %v an interval without drops after %v", l, raised)
+	}
+}
+
+func TestDialerLatency(t *testing.T) {
+	ln, err := Listen("srt4", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	defer func(f func(int) (srtapi.SendState, error)) { getSendStateFunc = f }(getSendStateFunc)
+	getSendState := getSendStateFunc
+	getSendStateFunc = func(s int) (srtapi.SendState, error) {
+		st, err := getSendState(s)
+		st.RTTMs = 100
+		return st, err
+	}
+
+	tu := &LatencyTuner{Interval: 10 * time.Millisecond}
+	d := Dialer{Latency: tu}
+	address := ln.Addr().String()
+	dial := func() int {
+		t.Helper()
+		c, err := d.DialContext(context.Background(), "srt", address)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer c.Close()
+		v, err := srtapi.GetsockflagInt(c.(*SRTConn).SocketID(), srtapi.OptionRcvlatency)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for {
+			if _, ok := tu.Latency(address); ok {
+				return v
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+	}
+	if v := dial(); v != 120 {
+		t.Errorf("first dial with a latency of %dms; want the default 120ms", v)
+	}
+	if v := dial(); v != 400 {
+		t.Errorf("dial after 100ms round trips with a latency of %dms; want 400ms", v)
+	}
+}
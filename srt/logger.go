@@ -0,0 +1,226 @@
+// Copyright (c) 2020 CyberAgent, Inc. All rights reserved.
+// https://github.com/openfresh/gosrt
+
+package srt
+
+import (
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Logger is the part of a structured logger the package logs its
+// debug lines to; *slog.Logger satisfies it.
+type Logger interface {
+	Debug(msg string, args ...interface{})
+}
+
+// LogCategory is the kind of a line the package logs.
+type LogCategory string
+
+const (
+	// LogPacketDrop logs the packets dropped as too late, as reported
+	// by EventDropped. The pure Go SRT implementation reports them
+	// itself; with libsrt, the connection finds those of the receiver
+	// from the gaps in the sequence numbers it reads, and those of the
+	// sender from its drop counter.
+	LogPacketDrop LogCategory = "packet drop"
+
+	// LogEventDrop logs the events Events dropped, their channel
+	// being full, and the reports Deliveries dropped, its queue being
+	// full.
+	LogEventDrop LogCategory = "event drop"
+
+	// LogTapDrop logs the copies a Tap dropped, C being full.
+	LogTapDrop LogCategory = "tap drop"
+
+	// LogLibSRT logs the lines of libsrt's own log, limited per
+	// source line rather than per connection; see
+	// LogLimiter.LoggingHandler.
+	LogLibSRT LogCategory = "libsrt"
+)
+
+// DefaultLogEvery is the interval of a LogLimit of Every 0.
+const DefaultLogEvery = time.Second
+
+// A LogLimit bounds the lines of a category logged for a connection.
+type LogLimit struct {
+	// Every is the interval at which lines are allowed: DefaultLogEvery
+	// if 0, no limit if negative.
+	Every time.Duration
+
+	// Burst is the number of lines allowed at once, 1 if 0.
+	Burst int
+
+	// Sample, if above 1, logs only one of every Sample lines the
+	// limit allows.
+	Sample int
+}
+
+// A LogLimiter logs the package's debug lines to Logger, a category and
+// a connection at a time up to a LogLimit each, so that a loss storm
+// makes a line a second per connection rather than a line a packet.
+// The lines held back are counted, and the next line logged carries
+// their number as "suppressed".
+//
+// A line is logged as msg followed by the key-value pairs "category",
+// "sid" (the socket ID), those of the line, and "suppressed" if any.
+type LogLimiter struct {
+	Logger Logger
+
+	// Limits are the limits by category; the categories not in it are
+	// held to Default.
+	Limits  map[LogCategory]LogLimit
+	Default LogLimit
+
+	mu      sync.Mutex
+	buckets map[logKey]*logBucket
+}
+
+type logKey struct {
+	cat LogCategory
+	key string
+}
+
+// A logBucket is the token bucket of a category and connection.
+type logBucket struct {
+	tokens     float64
+	last       time.Time
+	passed     int // lines within the limit, for sampling
+	suppressed int
+}
+
+// logBucketIdle is the time after which an idle bucket is forgotten,
+// which a full one is as good as.
+const logBucketIdle = time.Minute
+
+var theLogger atomic.Value // loggerHolder
+
+type loggerHolder struct{ l *LogLimiter }
+
+// SetLogger sets the LogLimiter the package logs to, nil (the default)
+// for none. Its limits also apply to the connection loggers of
+// WithConnLogger. The connections made before report their packet drops
+// only if Events was called on them.
+func SetLogger(l *LogLimiter) {
+	theLogger.Store(loggerHolder{l})
+}
+
+func loggerValue() *LogLimiter {
+	h, _ := theLogger.Load().(loggerHolder)
+	return h.l
+}
+
+// defaultLogLimiter holds the lines of the connection loggers to the
+// default limits when SetLogger wasn't called.
+var defaultLogLimiter LogLimiter
+
+// logf logs msg for fd in cat, to its connection logger if it has one
+// (see WithConnLogger) or else to the LogLimiter set, if that allows
+// it.
+func (fd *netFD) logf(cat LogCategory, msg string, args ...interface{}) {
+	l := loggerValue()
+	if fd.logger != nil {
+		if l == nil {
+			l = &defaultLogLimiter
+		}
+		l.logTo(fd.logger, cat, strconv.Itoa(fd.pfd.Sysfd), msg, args)
+		return
+	}
+	if l != nil && l.Logger != nil {
+		sid := fd.pfd.Sysfd
+		l.logTo(l.Logger, cat, strconv.Itoa(sid), msg, append([]interface{}{"sid", sid}, args...))
+	}
+}
+
+// logTo logs msg with the key-value pairs args to dst, if the limit of
+// cat for key allows it.
+func (l *LogLimiter) logTo(dst Logger, cat LogCategory, key string, msg string, args []interface{}) {
+	suppressed, ok := l.allow(cat, key, time.Now())
+	if !ok {
+		return
+	}
+	kv := make([]interface{}, 0, 4+len(args))
+	kv = append(kv, "category", string(cat))
+	kv = append(kv, args...)
+	if suppressed > 0 {
+		kv = append(kv, "suppressed", suppressed)
+	}
+	dst.Debug(msg, kv...)
+}
+
+// allow reports whether a line of cat for key may be logged now, and
+// the number of those held back since the last.
+func (l *LogLimiter) allow(cat LogCategory, key string, now time.Time) (int, bool) {
+	limit, ok := l.Limits[cat]
+	if !ok {
+		limit = l.Default
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.buckets == nil {
+		l.buckets = make(map[logKey]*logBucket)
+	}
+	burst := float64(limit.Burst)
+	if burst < 1 {
+		burst = 1
+	}
+	k := logKey{cat, key}
+	b := l.buckets[k]
+	if b == nil {
+		if len(l.buckets) >= 1024 {
+			l.expire(now)
+		}
+		b = &logBucket{tokens: burst, last: now}
+		l.buckets[k] = b
+	}
+	every := limit.Every
+	if every == 0 {
+		every = DefaultLogEvery
+	}
+	if every > 0 {
+		if d := now.Sub(b.last); d > 0 {
+			b.tokens += float64(d) / float64(every)
+			if b.tokens > burst {
+				b.tokens = burst
+			}
+		}
+		b.last = now
+		if b.tokens < 1 {
+			b.suppressed++
+			return 0, false
+		}
+		b.tokens--
+	}
+	b.passed++
+	if limit.Sample > 1 && (b.passed-1)%limit.Sample != 0 {
+		b.suppressed++
+		return 0, false
+	}
+	n := b.suppressed
+	b.suppressed = 0
+	return n, true
+}
+
+// expire forgets the buckets idle for logBucketIdle, keeping those
+// with lines to report. l.mu must be held.
+func (l *LogLimiter) expire(now time.Time) {
+	for k, b := range l.buckets {
+		if b.suppressed == 0 && now.Sub(b.last) > logBucketIdle {
+			delete(l.buckets, k)
+		}
+	}
+}
+
+// LoggingHandler returns a handler for SetLoggingHandler logging the
+// lines of libsrt to l, in the category LogLibSRT and limited per
+// source line, with the keys "file", "line", "area" and "level".
+func (l *LogLimiter) LoggingHandler() LoggingHandlerFunc {
+	return func(level int, file string, line int, area string, message string) {
+		if l.Logger != nil {
+			src := file + ":" + strconv.Itoa(line)
+			l.logTo(l.Logger, LogLibSRT, src, message, []interface{}{"file", file, "line", line, "area", area, "level", level})
+		}
+	}
+}
@@ -0,0 +1,145 @@
+// Copyright (c) 2020 CyberAgent, Inc. All rights reserved.
+// https://github.com/openfresh/gosrt
+
+package srt
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+)
+
+type testLogger struct {
+	mu    sync.Mutex
+	lines []string
+}
+
+func (l *testLogger) Debug(msg string, args ...interface{}) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.lines = append(l.lines, fmt.Sprint(append([]interface{}{msg}, args...)...))
+}
+
+func TestLogLimiter(t *testing.T) {
+	l := &LogLimiter{
+		Limits: map[LogCategory]LogLimit{
+			LogTapDrop: {Every: -1, Sample: 3},
+		},
+		Default: LogLimit{Every: time.Second, Burst: 2},
+	}
+	now := time.Now()
+	allowed := func(cat LogCategory, key string, d time.Duration) (n int, ok bool) {
+		return l.allow(cat, key, now.Add(d))
+	}
+
+	// A burst of 2, then a line a second, counting those held back.
+	for i, want := range []bool{true, true, false, false} {
+		if _, ok := allowed(LogPacketDrop, "1", 0); ok != want {
+			t.Errorf("line %d allowed %v; want %v", i, ok, want)
+		}
+	}
+	if _, ok := allowed(LogPacketDrop, "2", 0); !ok {
+		t.Error("the line of another connection was held back")
+	}
+	if _, ok := allowed(LogPacketDrop, "1", 500*time.Millisecond); ok {
+		t.Error("line allowed after half a second")
+	}
+	if n, ok := allowed(LogPacketDrop, "1", time.Second); !ok || n != 3 {
+		t.Errorf("line after a second: allowed %v, %d suppressed; want true, 3", ok, n)
+	}
+
+	// One line in 3, without a rate limit.
+	var got []bool
+	for i := 0; i < 6; i++ {
+		_, ok := allowed(LogTapDrop, "1", 0)
+		got = append(got, ok)
+	}
+	if fmt.Sprint(got) != "[true false false true false false]" {
+		t.Errorf("sampled lines %v; want one in 3", got)
+	}
+}
+
+func TestLogTapDrop(t *testing.T) {
+	logger := &testLogger{}
+	SetLogger(&LogLimiter{Logger: logger})
+	defer SetLogger(nil)
+
+	c1, c2, err := Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c1.Close()
+	defer c2.Close()
+	tap, err := c1.Tap(TapOutbound, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tap.Close()
+	go func() {
+		b := make([]byte, 1500)
+		for {
+			if _, err := c2.Read(b); err != nil {
+				return
+			}
+		}
+	}()
+	for i := 0; i < 5; i++ {
+		if _, err := c1.Write([]byte("hello")); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if tap.Dropped() != 4 {
+		t.Fatalf("tap dropped %d copies; want 4", tap.Dropped())
+	}
+	logger.mu.Lock()
+	defer logger.mu.Unlock()
+	if len(logger.lines) != 1 {
+		t.Errorf("logged %q; want one line a second", logger.lines)
+	}
+}
+
+func TestConnLogger(t *testing.T) {
+	logger := &testLogger{}
+	ctx := WithConnLogger(context.Background(), logger)
+	ln, err := ListenContext(ctx, "srt4", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	d := Dialer{}
+	caller, err := d.DialContext(WithOptions(ctx, Options("streamid", "feed")), "srt", ln.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer caller.Close()
+	ln.(*SRTListener).SetDeadline(time.Now().Add(someTimeout))
+	peer, err := ln.(*SRTListener).AcceptSRT()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer peer.Close()
+
+	peer.Logger().Debug("hello", "k", 1)
+	tap, err := caller.(*SRTConn).Tap(TapOutbound, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tap.Close()
+	for i := 0; i < 2; i++ {
+		if _, err := caller.Write([]byte("hello")); err != nil {
+			t.Fatal(err)
+		}
+	}
+	logger.mu.Lock()
+	defer logger.mu.Unlock()
+	want := []string{
+		fmt.Sprint("hello", "sid", peer.SocketID(), "streamid", "feed", "peer", peer.RemoteAddr().String(), "role", RoleListener, "k", 1),
+		fmt.Sprint("srt tap dropped a copy", "sid", caller.(*SRTConn).SocketID(), "streamid", "feed", "peer", ln.Addr().String(), "role", RoleCaller,
+			"category", string(LogTapDrop), "direction", "outbound", "dropped", uint64(1)),
+	}
+	if fmt.Sprint(logger.lines) != fmt.Sprint(want) {
+		t.Errorf("logged\n%q\nwant\n%q", logger.lines, want)
+	}
+}
@@ -0,0 +1,61 @@
+// Copyright (c) 2020 CyberAgent, Inc. All rights reserved.
+// https://github.com/openfresh/gosrt
+
+package srt
+
+import (
+	"math"
+	"sync/atomic"
+
+	"github.com/openfresh/gosrt/srtapi"
+)
+
+// SetMinRead sets the low watermark of Read and ReadContext: instead of
+// one message, they read messages into the buffer until it holds at
+// least n bytes, so that a consumer working on blocks, of ten
+// 7-packet MPEG-TS bundles say, makes one call per block. A read stops
+// short of n bytes when the buffer has no room left for a message of
+// the payload size, and when the deadline passes or the connection
+// fails after the first message, returning what it read; the error
+// comes with the next read. The message boundaries are lost, which a
+// consumer of messages of a fixed size doesn't need. n = 0, the
+// default, reads one message at a time.
+func (c *conn) SetMinRead(n int) error {
+	if !c.ok() {
+		return srtapi.EINVPARAM
+	}
+	if n < 0 || n > math.MaxInt32 {
+		return &OpError{Op: "set", Net: c.fd.net, Source: nil, Addr: c.fd.laddr, Err: srtapi.EINVPARAM}
+	}
+	atomic.StoreInt32(&c.fd.minRead, int32(n))
+	return nil
+}
+
+// MinRead returns the low watermark set by SetMinRead.
+func (c *conn) MinRead() int {
+	if !c.ok() {
+		return 0
+	}
+	return int(atomic.LoadInt32(&c.fd.minRead))
+}
+
+// readMin reads messages into p until it holds min bytes, or can't
+// hold another message.
+func (fd *netFD) readMin(p []byte, min int) (int, error) {
+	limit := fd.payloadLimit()
+	n := 0
+	for n < min && (n == 0 || len(p)-n >= limit) {
+		m, err := fd.read(p[n:])
+		n += m
+		if err != nil {
+			if n > 0 {
+				return n, nil
+			}
+			return 0, err
+		}
+		if m == 0 {
+			break
+		}
+	}
+	return n, nil
+}
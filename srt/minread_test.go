@@ -0,0 +1,58 @@
+// Copyright (c) 2020 CyberAgent, Inc. All rights reserved.
+// https://github.com/openfresh/gosrt
+
+package srt
+
+import (
+	"bytes"
+	"testing"
+	"time"
+)
+
+func TestMinRead(t *testing.T) {
+	c1, c2, err := Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c1.Close()
+	defer c2.Close()
+
+	if err := c2.SetMinRead(-1); err == nil {
+		t.Error("SetMinRead(-1) succeeded")
+	}
+	if err := c2.SetMinRead(3 * 1316); err != nil {
+		t.Fatal(err)
+	}
+	if c2.MinRead() != 3*1316 {
+		t.Errorf("MinRead() = %d; want %d", c2.MinRead(), 3*1316)
+	}
+
+	var want []byte
+	for i := 0; i < 3; i++ {
+		msg := bytes.Repeat([]byte{byte(i)}, 1316)
+		want = append(want, msg...)
+		if _, err := c1.Write(msg); err != nil {
+			t.Fatal(err)
+		}
+	}
+	b := make([]byte, 10*1316)
+	n, err := c2.Read(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(b[:n], want) {
+		t.Errorf("read %d bytes; want the %d bytes of 3 messages", n, len(want))
+	}
+
+	// A read past its deadline returns the messages it has.
+	if _, err := c1.Write(want[:1316]); err != nil {
+		t.Fatal(err)
+	}
+	c2.SetReadDeadline(time.Now().Add(time.Second))
+	if n, err := c2.Read(b); n != 1316 || err != nil {
+		t.Errorf("got %d, %v; want 1316, nil", n, err)
+	}
+	if _, err := c2.Read(b); err == nil || !err.(*OpError).Timeout() {
+		t.Errorf("got %v; want a timeout", err)
+	}
+}
@@ -0,0 +1,78 @@
+// Copyright (c) 2020 CyberAgent, Inc. All rights reserved.
+// https://github.com/openfresh/gosrt
+
+package srt
+
+import (
+	"context"
+	"net"
+	"syscall"
+
+	"github.com/openfresh/gosrt/srtapi"
+)
+
+// packetConnContextKey is the type of contextKeys carrying the UDP
+// socket of ListenPacket and DialPacket down to the SRT socket.
+type packetConnContextKey struct{}
+
+func packetConnValue(ctx context.Context) *net.UDPConn {
+	pc, _ := ctx.Value(packetConnContextKey{}).(*net.UDPConn)
+	return pc
+}
+
+// packetNetwork returns the network of the SRT socket bound to pc.
+func packetNetwork(pc *net.UDPConn) (string, *SRTAddr) {
+	a := pc.LocalAddr().(*net.UDPAddr)
+	la := &SRTAddr{IP: a.IP, Port: a.Port, Zone: a.Zone}
+	if la.family() == syscall.AF_INET {
+		return "srt4", la
+	}
+	return "srt6", la
+}
+
+// ListenPacket listens for SRT connections on the bound UDP socket pc,
+// with the options of ctx, instead of opening a socket of its own, as
+// srt_bind_acquire does: pc may come from the process that started
+// this one, or have been set up with socket options gosrt doesn't
+// know. The listener works on a duplicate of pc, so pc may be closed
+// once ListenPacket returned, and must not be read from while it is
+// open.
+//
+// ListenPacket fails with srtapi.EINVOP on Windows, and with the
+// in-memory network of the srtmock build.
+func ListenPacket(ctx context.Context, pc *net.UDPConn) (*SRTListener, error) {
+	network, laddr := packetNetwork(pc)
+	ln, err := listenSRT(context.WithValue(ctx, packetConnContextKey{}, pc), network, laddr)
+	if err != nil {
+		return nil, &OpError{Op: "listen", Net: network, Source: nil, Addr: laddr, Err: err}
+	}
+	return ln, nil
+}
+
+// DialPacket connects to address from the bound UDP socket pc, as
+// ListenPacket listens on it.
+func DialPacket(ctx context.Context, pc *net.UDPConn, address string) (*SRTConn, error) {
+	network, laddr := packetNetwork(pc)
+	raddr, err := ResolveSRTAddr(network, address)
+	if err != nil {
+		return nil, &OpError{Op: "dial", Net: network, Source: laddr, Addr: nil, Err: err}
+	}
+	c, err := dialSRT(context.WithValue(ctx, packetConnContextKey{}, pc), network, laddr, raddr)
+	if err != nil {
+		return nil, &OpError{Op: "dial", Net: network, Source: laddr, Addr: raddr, Err: err}
+	}
+	return c, nil
+}
+
+// bindAcquire binds fd to a duplicate of pc.
+func (fd *netFD) bindAcquire(pc *net.UDPConn) error {
+	s, err := dupSocket(pc)
+	if err != nil {
+		return err
+	}
+	if err := srtapi.BindAcquire(fd.pfd.Sysfd, s); err != nil {
+		closeSocket(s)
+		return wrapSyscallError("bind", err)
+	}
+	return nil
+}
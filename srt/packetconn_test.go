@@ -0,0 +1,67 @@
+// Copyright (c) 2020 CyberAgent, Inc. All rights reserved.
+// https://github.com/openfresh/gosrt
+
+package srt
+
+import (
+	"context"
+	"errors"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/openfresh/gosrt/srtapi"
+)
+
+func TestListenDialPacket(t *testing.T) {
+	lpc, err := net.ListenUDP("udp4", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ln, err := ListenPacket(context.Background(), lpc)
+	if errors.Is(err, srtapi.EINVOP) {
+		lpc.Close()
+		t.Skip(err)
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	// The listener has a socket of its own.
+	lpc.Close()
+	if got, want := ln.Addr().String(), lpc.LocalAddr().String(); got != want {
+		t.Errorf("listener address %s; want %s", got, want)
+	}
+
+	dpc, err := net.ListenUDP("udp4", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer dpc.Close()
+	c, err := DialPacket(context.Background(), dpc, ln.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	if got, want := c.LocalAddr().String(), dpc.LocalAddr().String(); got != want {
+		t.Errorf("caller address %s; want %s", got, want)
+	}
+
+	ln.SetDeadline(time.Now().Add(someTimeout))
+	p, err := ln.AcceptSRT()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer p.Close()
+	if got, want := p.RemoteAddr().String(), dpc.LocalAddr().String(); got != want {
+		t.Errorf("peer address %s; want %s", got, want)
+	}
+	if _, err := c.Write([]byte("hello")); err != nil {
+		t.Fatal(err)
+	}
+	b := make([]byte, 1500)
+	p.SetReadDeadline(time.Now().Add(someTimeout))
+	if n, err := p.Read(b); err != nil || string(b[:n]) != "hello" {
+		t.Errorf("read %q, %v; want hello", b[:n], err)
+	}
+}
@@ -0,0 +1,33 @@
+// Copyright (c) 2020 CyberAgent, Inc. All rights reserved.
+// https://github.com/openfresh/gosrt
+
+// +build !windows
+
+package srt
+
+import (
+	"net"
+	"os"
+	"syscall"
+)
+
+// dupSocket returns a duplicate of the socket of pc.
+func dupSocket(pc *net.UDPConn) (int, error) {
+	rc, err := pc.SyscallConn()
+	if err != nil {
+		return -1, err
+	}
+	s := -1
+	var derr error
+	if err := rc.Control(func(fd uintptr) { s, derr = syscall.Dup(int(fd)) }); err != nil {
+		return -1, err
+	}
+	if derr != nil {
+		return -1, os.NewSyscallError("dup", derr)
+	}
+	return s, nil
+}
+
+func closeSocket(s int) {
+	syscall.Close(s)
+}
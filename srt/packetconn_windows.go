@@ -0,0 +1,18 @@
+// Copyright (c) 2020 CyberAgent, Inc. All rights reserved.
+// https://github.com/openfresh/gosrt
+
+package srt
+
+import (
+	"net"
+
+	"github.com/openfresh/gosrt/srtapi"
+)
+
+// dupSocket fails: libsrt takes Windows sockets over, which can't be
+// duplicated like file descriptors.
+func dupSocket(pc *net.UDPConn) (int, error) {
+	return -1, srtapi.EINVOP
+}
+
+func closeSocket(s int) {}
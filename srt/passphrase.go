@@ -0,0 +1,80 @@
+// Copyright (c) 2020 CyberAgent, Inc. All rights reserved.
+// https://github.com/openfresh/gosrt
+
+package srt
+
+import (
+	"context"
+	"net"
+	"syscall"
+
+	"github.com/openfresh/gosrt/srtapi"
+)
+
+// PassphraseFunc returns the passphrase of the connection with peer
+// for streamID, or "" for an unencrypted connection. It lets secrets
+// be fetched when they are needed, from a secret store for instance,
+// instead of being held in the options.
+type PassphraseFunc func(ctx context.Context, peer net.Addr, streamID string) (string, error)
+
+// passphraseContextKey is the type of contextKeys used for
+// PassphraseFunc.
+type passphraseContextKey struct{}
+
+// WithPassphraseFunc returns a new context.Context with the
+// PassphraseFunc looking up the passphrases of the listeners and
+// dials made with it, overriding the "passphrase" option.
+//
+// A dial calls fn with its own context, the address it dials and its
+// "streamid" option before connecting, and fails with the error fn
+// returns. A listener calls fn with the context it was created with
+// from its listen callback, once for every handshake, once any
+// callback set with WithListenCallback accepted the peer; an error
+// rejects the peer. The handshake waits for fn, and with libsrt so do
+// the other handshakes of the listener, so it should answer from a
+// cache or within a short deadline. Listeners need
+// srtapi.FeatureListenCallback.
+func WithPassphraseFunc(ctx context.Context, fn PassphraseFunc) context.Context {
+	return context.WithValue(ctx, passphraseContextKey{}, fn)
+}
+
+func passphraseFuncValue(ctx context.Context) PassphraseFunc {
+	fn, _ := ctx.Value(passphraseContextKey{}).(PassphraseFunc)
+	return fn
+}
+
+// dialPassphrase sets the passphrase of fd, about to dial raddr.
+func (fd *netFD) dialPassphrase(ctx context.Context, raddr net.Addr) error {
+	fn := passphraseFuncValue(ctx)
+	if fn == nil {
+		return nil
+	}
+	streamID, _ := srtapi.GetsockflagString(fd.pfd.Sysfd, srtapi.OptionStreamid)
+	passphrase, err := fn(ctx, raddr, streamID)
+	if err != nil {
+		return err
+	}
+	return srtapi.SetsockoptString(fd.pfd.Sysfd, 0, srtapi.OptionPassphrase, passphrase)
+}
+
+// passphraseCallback returns the listen callback setting the
+// passphrase fn looks up on each socket callback accepts.
+func passphraseCallback(ctx context.Context, callback srtapi.SrtListenCallbackFunc, fn PassphraseFunc) srtapi.SrtListenCallbackFunc {
+	return func(ns, hsversion int, peer syscall.Sockaddr, streamid string) int {
+		ret := 0
+		if callback != nil {
+			if ret = callback(ns, hsversion, peer, streamid); ret < 0 {
+				return ret
+			}
+		}
+		passphrase, err := fn(ctx, sockaddrToSRT(peer), streamid)
+		if err != nil {
+			setRejectReason(ns, err)
+			return -1
+		}
+		if err := srtapi.SetsockoptString(ns, 0, srtapi.OptionPassphrase, passphrase); err != nil {
+			return -1
+		}
+		return ret
+	}
+}
@@ -0,0 +1,92 @@
+// Copyright (c) 2020 CyberAgent, Inc. All rights reserved.
+// https://github.com/openfresh/gosrt
+
+package srt
+
+import (
+	"context"
+	"errors"
+	"net"
+	"testing"
+
+	"github.com/openfresh/gosrt/srtapi"
+)
+
+var errNoSecret = errors.New("no secret")
+
+// lookupSecret serves the passphrases of each stream ID.
+func lookupSecret(ctx context.Context, peer net.Addr, streamID string) (string, error) {
+	switch streamID {
+	case "feed1":
+		return "feed1-passphrase", nil
+	case "feed2":
+		return "feed2-passphrase", nil
+	case "open":
+		return "", nil
+	}
+	return "", errNoSecret
+}
+
+func TestListenPassphraseFunc(t *testing.T) {
+	if !srtapi.Has(srtapi.FeatureListenCallback) {
+		t.Skip("SRT library lacks listen callbacks")
+	}
+	ln, err := ListenContext(WithPassphraseFunc(context.Background(), lookupSecret), "srt4", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	go func() {
+		for {
+			c, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			c.Close()
+		}
+	}()
+
+	tests := []struct {
+		options OptionSet
+		ok      bool
+	}{
+		{Options("streamid", "feed1", "passphrase", "feed1-passphrase"), true},
+		{Options("streamid", "feed2", "passphrase", "feed2-passphrase"), true},
+		{Options("streamid", "open"), true},
+		{Options("streamid", "feed2", "passphrase", "feed1-passphrase"), false},
+		{Options("streamid", "feed1"), false},
+		{Options("streamid", "unknown", "passphrase", "feed1-passphrase"), false},
+	}
+	for i, tt := range tests {
+		var d Dialer
+		c, err := d.DialContext(WithOptions(context.Background(), tt.options), "srt", ln.Addr().String())
+		if err == nil {
+			c.Close()
+		}
+		if (err == nil) != tt.ok {
+			t.Errorf("#%d: got %v; want success %v", i, err, tt.ok)
+		}
+	}
+}
+
+func TestDialPassphraseFunc(t *testing.T) {
+	ctx := WithOptions(context.Background(), Options("passphrase", "feed1-passphrase"))
+	ln, err := ListenContext(ctx, "srt4", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+
+	ctx = WithPassphraseFunc(context.Background(), lookupSecret)
+	var d Dialer
+	c, err := d.DialContext(WithOptions(ctx, Options("streamid", "feed1")), "srt", ln.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.Close()
+
+	_, err = d.DialContext(WithOptions(ctx, Options("streamid", "unknown")), "srt", ln.Addr().String())
+	if !errors.Is(err, errNoSecret) {
+		t.Errorf("got %v; want %v", err, errNoSecret)
+	}
+}
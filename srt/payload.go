@@ -0,0 +1,120 @@
+// Copyright (c) 2020 CyberAgent, Inc. All rights reserved.
+// https://github.com/openfresh/gosrt
+
+package srt
+
+import (
+	"errors"
+	"strconv"
+	"sync/atomic"
+	"time"
+
+	"github.com/openfresh/gosrt/srtapi"
+)
+
+// MaxPayloadSize is the largest payload size, and so message, of a
+// live mode connection: that of a 1500-byte UDP packet, less the
+// headers of IP, UDP and SRT. The "payloadsize" option defaults to
+// 1316 bytes, as much MPEG-TS as fits.
+const MaxPayloadSize = 1456
+
+// PayloadPolicy selects what Write does with a payload larger than
+// the payload size negotiated for a live mode connection
+// (the "payloadsize" option).
+type PayloadPolicy int32
+
+const (
+	// PayloadPassThrough hands the payload to the SRT library as is.
+	// This is the default.
+	PayloadPassThrough PayloadPolicy = iota
+
+	// PayloadSplit splits the payload across as many messages as
+	// needed, each at most the payload size long.
+	PayloadSplit
+
+	// PayloadFailFast rejects the payload before anything is sent,
+	// with a *MessageTooLongError carrying the payload size limit.
+	PayloadFailFast
+)
+
+// ErrMessageTooLong is matched by errors.Is for writes rejected by
+// PayloadFailFast, and messages SendMessage rejects.
+var ErrMessageTooLong = errors.New("message too long")
+
+// MessageTooLongError is returned, wrapped in an OpError, for the
+// payloads longer than the payload size that PayloadFailFast or
+// SendMessage reject.
+type MessageTooLongError struct {
+	Size  int // length of the rejected payload
+	Limit int // negotiated payload size
+}
+
+func (e *MessageTooLongError) Error() string {
+	return ErrMessageTooLong.Error() + ": " + strconv.Itoa(e.Size) + " bytes exceeds payload size " + strconv.Itoa(e.Limit)
+}
+
+// Is reports whether target is ErrMessageTooLong, or srtapi.ELARGEMSG,
+// the error of libsrt for the same payloads.
+func (e *MessageTooLongError) Is(target error) bool {
+	return target == ErrMessageTooLong || target == srtapi.ELARGEMSG
+}
+
+// Timeout reports whether this error represents a timeout.
+func (e *MessageTooLongError) Timeout() bool { return false }
+
+// Temporary reports whether this error is temporary.
+func (e *MessageTooLongError) Temporary() bool { return false }
+
+// SetPayloadPolicy sets the policy applied by Write and WriteContext to
+// payloads larger than the connection's payload size.
+// It has no effect on file mode connections, which have no payload
+// size limit.
+func (c *conn) SetPayloadPolicy(p PayloadPolicy) error {
+	if !c.ok() {
+		return srtapi.EINVPARAM
+	}
+	switch p {
+	case PayloadPassThrough, PayloadSplit, PayloadFailFast:
+	default:
+		return &OpError{Op: "set", Net: c.fd.net, Source: nil, Addr: c.fd.laddr, Err: srtapi.EINVPARAM}
+	}
+	atomic.StoreInt32(&c.fd.payloadPolicy, int32(p))
+	return nil
+}
+
+// PayloadPolicy returns the policy set by SetPayloadPolicy.
+func (c *conn) PayloadPolicy() PayloadPolicy {
+	if !c.ok() {
+		return PayloadPassThrough
+	}
+	return PayloadPolicy(atomic.LoadInt32(&c.fd.payloadPolicy))
+}
+
+// payloadLimit returns the negotiated payload size, or 0 if there is
+// no limit. It is queried once, since the value can't change after
+// the connection is established.
+func (fd *netFD) payloadLimit() int {
+	fd.payloadOnce.Do(func() {
+		if n, err := srtapi.GetsockflagInt(fd.pfd.Sysfd, srtapi.OptionPayloadsize); err == nil && n > 0 {
+			fd.payloadSize = n
+		}
+	})
+	return fd.payloadSize
+}
+
+// writeSplit writes p as a series of messages of at most limit bytes.
+func (fd *netFD) writeSplit(p []byte, limit int) (nn int, err error) {
+	for nn < len(p) {
+		end := nn + limit
+		if end > len(p) {
+			end = len(p)
+		}
+		n, err := fd.pfd.Write(p[nn:end])
+		if err != nil {
+			return nn + n, err
+		}
+		fd.tap(TapOutbound, p[nn:end], time.Time{}, 0)
+		nn += n
+	}
+	return nn, nil
+}
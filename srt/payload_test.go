@@ -0,0 +1,96 @@
+// Copyright (c) 2020 CyberAgent, Inc. All rights reserved.
+// https://github.com/openfresh/gosrt
+
+package srt
+
+import (
+	"context"
+	"errors"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/openfresh/gosrt/srtapi"
+)
+
+// newPayloadTestPair returns a connected pair of live mode connections
+// with a payload size of 128 bytes.
+func newPayloadTestPair(t *testing.T) (c, sc *SRTConn) {
+	ctx := WithOptions(context.Background(), Options("payloadsize", "128"))
+	ln, err := newLocalListenerContext(ctx, "srt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+
+	connc := make(chan net.Conn, 1)
+	go func() {
+		c, err := ln.Accept()
+		if err != nil {
+			t.Error(err)
+		}
+		connc <- c // might be nil
+	}()
+	var d Dialer
+	cc, err := d.DialContext(ctx, ln.Addr().Network(), ln.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := <-connc
+	if s == nil {
+		cc.Close()
+		t.FailNow()
+	}
+	cc.SetDeadline(time.Now().Add(someTimeout))
+	s.SetDeadline(time.Now().Add(someTimeout))
+	return cc.(*SRTConn), s.(*SRTConn)
+}
+
+func TestPayloadSplit(t *testing.T) {
+	c, sc := newPayloadTestPair(t)
+	defer c.Close()
+	defer sc.Close()
+
+	if err := c.SetPayloadPolicy(PayloadSplit); err != nil {
+		t.Fatal(err)
+	}
+	wb := make([]byte, 300)
+	if n, err := c.Write(wb); n != len(wb) || err != nil {
+		t.Fatalf("got (%d, %v); want (%d, nil)", n, err, len(wb))
+	}
+	rb := make([]byte, 1500)
+	for _, want := range []int{128, 128, 44} {
+		n, err := sc.Read(rb)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if n != want {
+			t.Fatalf("got a %d byte message; want %d", n, want)
+		}
+	}
+}
+
+func TestPayloadFailFast(t *testing.T) {
+	c, sc := newPayloadTestPair(t)
+	defer c.Close()
+	defer sc.Close()
+
+	if err := c.SetPayloadPolicy(PayloadFailFast); err != nil {
+		t.Fatal(err)
+	}
+	n, err := c.Write(make([]byte, 300))
+	if perr := parseWriteError(err); perr != nil {
+		t.Error(perr)
+	}
+	if n != 0 || !errors.Is(err, ErrMessageTooLong) || !errors.Is(err, srtapi.ELARGEMSG) {
+		t.Fatalf("got (%d, %v); want (0, %v)", n, err, ErrMessageTooLong)
+	}
+	var merr *MessageTooLongError
+	if !errors.As(err, &merr) || merr.Size != 300 || merr.Limit != 128 {
+		t.Fatalf("got %#v; want size 300 and limit 128", merr)
+	}
+	// Payloads within the limit are unaffected.
+	if _, err := c.Write(make([]byte, 128)); err != nil {
+		t.Fatal(err)
+	}
+}
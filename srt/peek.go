@@ -0,0 +1,94 @@
+// Copyright (c) 2020 CyberAgent, Inc. All rights reserved.
+// https://github.com/openfresh/gosrt
+
+package srt
+
+import (
+	"io"
+	"sync/atomic"
+
+	"github.com/openfresh/gosrt/srtapi"
+)
+
+// maxPeek is the most Peek returns, which bounds the messages it holds
+// back for the following reads.
+const maxPeek = 64 << 10
+
+// Peek returns the next n bytes of the connection without consuming
+// them, so that a sniffer can tell the format of a stream, MPEG-TS or
+// RTP say, before handing the connection on. It reads as many messages
+// as it takes, which the following reads return again one at a time,
+// as they came; a read with a buffer shorter than a message held back
+// gets the rest of it on the next read. Messages read again this way
+// have no source time.
+//
+// If Peek returns fewer than n bytes, it also returns why, the read
+// deadline passing say. n must be at most 64KiB. Peek must not be
+// called concurrently with reads.
+func (c *conn) Peek(n int) ([]byte, error) {
+	if !c.ok() {
+		return nil, srtapi.EINVPARAM
+	}
+	if n < 0 || n > maxPeek {
+		return nil, &OpError{Op: "peek", Net: c.fd.net, Source: c.fd.laddr, Addr: c.fd.raddr, Err: srtapi.EINVPARAM}
+	}
+	b, err := c.fd.peek(n)
+	if err != nil && err != io.EOF {
+		err = &OpError{Op: "peek", Net: c.fd.net, Source: c.fd.laddr, Addr: c.fd.raddr, Err: err}
+	}
+	return b, err
+}
+
+func (fd *netFD) peek(n int) ([]byte, error) {
+	fd.peekmu.Lock()
+	defer fd.peekmu.Unlock()
+	have := 0
+	for _, m := range fd.peeked {
+		have += len(m)
+	}
+	var err error
+	if have < n {
+		buf := make([]byte, maxPeek)
+		for have < n {
+			var m int
+			if m, err = fd.readPfd(buf); err != nil {
+				err = wrapSyscallError("read", err)
+				break
+			}
+			fd.peeked = append(fd.peeked, append([]byte(nil), buf[:m]...))
+			atomic.AddInt32(&fd.npeeked, 1)
+			have += m
+		}
+	}
+	b := make([]byte, 0, n)
+	for _, m := range fd.peeked {
+		if len(b)+len(m) > n {
+			m = m[:n-len(b)]
+		}
+		b = append(b, m...)
+	}
+	return b, err
+}
+
+// readPeeked reads into p the first message held back by Peek, if
+// there is one.
+func (fd *netFD) readPeeked(p []byte) (int, bool) {
+	if atomic.LoadInt32(&fd.npeeked) == 0 {
+		return 0, false
+	}
+	fd.peekmu.Lock()
+	defer fd.peekmu.Unlock()
+	if len(fd.peeked) == 0 {
+		return 0, false
+	}
+	m := fd.peeked[0]
+	n := copy(p, m)
+	if n < len(m) {
+		fd.peeked[0] = m[n:]
+		return n, true
+	}
+	fd.peeked[0] = nil
+	fd.peeked = fd.peeked[1:]
+	atomic.AddInt32(&fd.npeeked, -1)
+	return n, true
+}
@@ -0,0 +1,74 @@
+// Copyright (c) 2020 CyberAgent, Inc. All rights reserved.
+// https://github.com/openfresh/gosrt
+
+package srt
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/openfresh/gosrt/srtapi"
+)
+
+func TestPeek(t *testing.T) {
+	c1, c2, err := Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c1.Close()
+	defer c2.Close()
+
+	for _, m := range []string{"0123456789", "abcdef", "tail"} {
+		if _, err := c1.Write([]byte(m)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	c2.SetReadDeadline(time.Now().Add(someTimeout))
+	for _, tt := range []struct {
+		n    int
+		want string
+	}{
+		{4, "0123"},
+		{12, "0123456789ab"},
+		{0, ""},
+		{16, "0123456789abcdef"},
+	} {
+		b, err := c2.Peek(tt.n)
+		if err != nil || string(b) != tt.want {
+			t.Errorf("Peek(%d) = %q, %v; want %q", tt.n, b, err, tt.want)
+		}
+	}
+
+	// The messages come back as they were sent, the rest of one read
+	// short on the next read.
+	b := make([]byte, 1500)
+	for _, want := range []string{"0123456789", "abc", "def", "tail"} {
+		buf := b
+		if want == "abc" {
+			buf = b[:3]
+		}
+		n, err := c2.Read(buf)
+		if err != nil || string(buf[:n]) != want {
+			t.Errorf("got %q, %v; want %q", buf[:n], err, want)
+		}
+	}
+
+	// Peek returns what came before the deadline.
+	if _, err := c1.Write([]byte("partial")); err != nil {
+		t.Fatal(err)
+	}
+	c2.SetReadDeadline(time.Now().Add(200 * time.Millisecond))
+	p, err := c2.Peek(100)
+	if nerr, ok := err.(*OpError); !ok || !nerr.Timeout() || string(p) != "partial" {
+		t.Errorf("got %q, %v; want %q and a timeout", p, err, "partial")
+	}
+	c2.SetReadDeadline(time.Now().Add(someTimeout))
+	if n, err := c2.Read(b); err != nil || string(b[:n]) != "partial" {
+		t.Errorf("got %q, %v after the timeout", b[:n], err)
+	}
+
+	if _, err := c2.Peek(maxPeek + 1); !errors.Is(err, srtapi.EINVPARAM) {
+		t.Errorf("got %v peeking too much; want %v", err, srtapi.EINVPARAM)
+	}
+}
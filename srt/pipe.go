@@ -0,0 +1,40 @@
+// Copyright (c) 2020 CyberAgent, Inc. All rights reserved.
+// https://github.com/openfresh/gosrt
+
+package srt
+
+import (
+	"context"
+	"net"
+)
+
+// Pipe returns the two ends of a connection, the caller first, for
+// tests of code using the SRT API. It connects them over the loopback
+// interface through a listener that is gone once Pipe returns. Built
+// with the srtmock tag, the connection runs over the in-memory
+// network of the pure Go implementation instead, and needs no socket
+// or network permission on the host.
+func Pipe() (*SRTConn, *SRTConn, error) {
+	return PipeContext(context.Background())
+}
+
+// PipeContext is like Pipe, with the options of ctx applied to both
+// ends (see WithOptions).
+func PipeContext(ctx context.Context) (*SRTConn, *SRTConn, error) {
+	ln, err := listenSRT(ctx, "srt4", &SRTAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		return nil, nil, &OpError{Op: "pipe", Net: "srt4", Err: err}
+	}
+	defer ln.close()
+	raddr := ln.fd.laddr.(*SRTAddr)
+	caller, err := dialSRT(ctx, "srt4", nil, raddr)
+	if err != nil {
+		return nil, nil, &OpError{Op: "pipe", Net: "srt4", Addr: raddr, Err: err}
+	}
+	peer, err := ln.accept()
+	if err != nil {
+		caller.Close()
+		return nil, nil, &OpError{Op: "pipe", Net: "srt4", Addr: raddr, Err: err}
+	}
+	return caller, peer, nil
+}
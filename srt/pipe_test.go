@@ -0,0 +1,37 @@
+// Copyright (c) 2020 CyberAgent, Inc. All rights reserved.
+// https://github.com/openfresh/gosrt
+
+package srt
+
+import (
+	"context"
+	"testing"
+)
+
+func TestPipe(t *testing.T) {
+	ctx := WithOptions(context.Background(), Options("latency", "40"))
+	c1, c2, err := PipeContext(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c1.Close()
+	defer c2.Close()
+	if ua, _ := c1.UDPAddr(); ua.String() != c2.RemoteAddr().String() {
+		t.Errorf("caller is %v; peer sees %v", ua, c2.RemoteAddr())
+	}
+	for _, m := range []string{"one", "two"} {
+		if _, err := c1.Write([]byte(m)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	b := make([]byte, 1500)
+	for _, want := range []string{"one", "two"} {
+		n, err := c2.Read(b)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(b[:n]) != want {
+			t.Errorf("got %q; want %q", b[:n], want)
+		}
+	}
+}
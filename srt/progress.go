@@ -0,0 +1,250 @@
+// Copyright (c) 2020 CyberAgent, Inc. All rights reserved.
+// https://github.com/openfresh/gosrt
+
+package srt
+
+import (
+	"context"
+	"io"
+	"os"
+	"sync/atomic"
+	"time"
+
+	"github.com/openfresh/gosrt/internal/poll/runtime"
+	"github.com/openfresh/gosrt/srtapi"
+)
+
+// DefaultProgressInterval is the interval of the progress reports of
+// SendFile and RecvFile given 0.
+const DefaultProgressInterval = time.Second
+
+// DefaultProgressWindow is the Window of a ProgressMeter left zero.
+const DefaultProgressWindow = 5 * time.Second
+
+// fileBuffer is the size of the writes of SendFile without a payload
+// limit, and of the reads of RecvFile.
+const fileBuffer = 64 << 10
+
+// A Progress is how far along a transfer is.
+type Progress struct {
+	// Total is the size of the transfer in bytes, 0 if unknown.
+	Total int64
+
+	// Bytes is the bytes written to the connection so far, or read
+	// from it, and Acked those of them the peer acknowledged: all of
+	// them on the receiving side.
+	Bytes, Acked int64
+
+	// Rate is the throughput of the bytes acknowledged, in bytes per
+	// second, over the Window of the ProgressMeter.
+	Rate float64
+
+	// Elapsed is the time since the transfer started.
+	Elapsed time.Duration
+}
+
+// ETA returns the time the rest of the transfer takes at Rate, or -1
+// if the Total or the Rate is unknown.
+func (p Progress) ETA() time.Duration {
+	left := p.Total - p.Acked
+	switch {
+	case p.Total <= 0:
+		return -1
+	case left <= 0:
+		return 0
+	case p.Rate <= 0:
+		return -1
+	}
+	return time.Duration(float64(left) / p.Rate * float64(time.Second))
+}
+
+// A ProgressMeter turns the byte counts of a transfer, sampled over
+// time, into its Progress, for transfers of other kinds than those of
+// SendFile and RecvFile.
+//
+// The zero value is ready to use. A ProgressMeter must not be used
+// concurrently.
+type ProgressMeter struct {
+	// Total is the size of the transfer, 0 if unknown.
+	Total int64
+
+	// Window is the span that the Rate is averaged over. Zero means
+	// DefaultProgressWindow.
+	Window time.Duration
+
+	start   time.Time
+	samples []progressSample // over the last Window, oldest first
+}
+
+type progressSample struct {
+	at    time.Time
+	acked int64
+}
+
+// Update returns the progress at now of the transfer, bytes of which
+// were transferred, acked of those acknowledged. The first call starts
+// the transfer.
+func (m *ProgressMeter) Update(now time.Time, bytes, acked int64) Progress {
+	window := m.Window
+	if window <= 0 {
+		window = DefaultProgressWindow
+	}
+	if m.start.IsZero() {
+		m.start = now
+	}
+	m.samples = append(m.samples, progressSample{at: now, acked: acked})
+	// The oldest sample kept is the last one the window starts after.
+	i := 0
+	for i+1 < len(m.samples) && !m.samples[i+1].at.After(now.Add(-window)) {
+		i++
+	}
+	m.samples = append(m.samples[:0], m.samples[i:]...)
+	p := Progress{Total: m.Total, Bytes: bytes, Acked: acked, Elapsed: now.Sub(m.start)}
+	if first := m.samples[0]; now.After(first.at) {
+		p.Rate = float64(acked-first.acked) / now.Sub(first.at).Seconds()
+	}
+	return p
+}
+
+// WatchProgress calls progress, unless nil, every interval,
+// DefaultProgressInterval if 0, with the Progress of a transfer of
+// total bytes from the counts of sample, until stop calls it a last
+// time, for transfers of other kinds than those of SendFile and
+// RecvFile to report theirs alike.
+func WatchProgress(total int64, interval time.Duration, progress func(Progress), sample func() (bytes, acked int64)) (stop func()) {
+	if progress == nil {
+		return func() {}
+	}
+	if interval <= 0 {
+		interval = DefaultProgressInterval
+	}
+	m := &ProgressMeter{Total: total}
+	bytes, acked := sample()
+	m.Update(runtime.Clock.Now(), bytes, acked)
+	done := make(chan struct{})
+	finished := make(chan struct{})
+	go func() {
+		defer close(finished)
+		t := runtime.Clock.NewTicker(interval)
+		defer t.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case now := <-t.C():
+				bytes, acked := sample()
+				progress(m.Update(now, bytes, acked))
+			}
+		}
+	}()
+	return func() {
+		close(done)
+		<-finished
+		bytes, acked := sample()
+		progress(m.Update(runtime.Clock.Now(), bytes, acked))
+	}
+}
+
+// SendFile sends the rest of f from its offset over the connection,
+// and waits until the peer acknowledged all of it, as Flush does. It
+// calls progress, unless nil, with the progress of the transfer every
+// interval, DefaultProgressInterval if 0, and once at the end. It
+// returns the bytes written; if ctx is done first, with an error
+// wrapping that of ctx.
+//
+// Unlike ReadFrom, SendFile writes the file as Write does, in messages
+// of the payload size outside of stream mode; in live mode, the packets
+// dropped as too late are missing from the file received, unless the
+// "tlpktdrop" option is off.
+func (c *SRTConn) SendFile(ctx context.Context, f *os.File, interval time.Duration, progress func(Progress)) (int64, error) {
+	if !c.ok() {
+		return 0, srtapi.EINVPARAM
+	}
+	var total int64
+	if fi, err := f.Stat(); err == nil && fi.Mode().IsRegular() {
+		if off, err := f.Seek(0, io.SeekCurrent); err == nil && off < fi.Size() {
+			total = fi.Size() - off
+		}
+	}
+	var written, flushed int64
+	stop := WatchProgress(total, interval, progress, func() (int64, int64) {
+		n := atomic.LoadInt64(&written)
+		if atomic.LoadInt64(&flushed) != 0 {
+			return n, n
+		}
+		l, err := c.SendBufferLevel()
+		if err != nil || int64(l.Bytes) > n {
+			return n, 0
+		}
+		return n, n - int64(l.Bytes)
+	})
+	defer stop()
+	size := c.fd.payloadLimit()
+	if size == 0 {
+		size = fileBuffer
+	}
+	buf := make([]byte, size)
+	for {
+		nr, err := f.Read(buf)
+		if nr > 0 {
+			nw, werr := c.WriteContext(ctx, buf[:nr])
+			atomic.AddInt64(&written, int64(nw))
+			if werr != nil {
+				return atomic.LoadInt64(&written), werr
+			}
+		}
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return atomic.LoadInt64(&written), err
+		}
+	}
+	if _, err := c.Flush(ctx); err != nil {
+		return atomic.LoadInt64(&written), err
+	}
+	atomic.StoreInt64(&flushed, 1)
+	return atomic.LoadInt64(&written), nil
+}
+
+// RecvFile receives n bytes over the connection into f, at its
+// offset, calling progress as SendFile does. It returns the bytes
+// received, fewer than n with io.ErrUnexpectedEOF if the peer closes
+// the connection first.
+func (c *SRTConn) RecvFile(ctx context.Context, f *os.File, n int64, interval time.Duration, progress func(Progress)) (int64, error) {
+	if !c.ok() {
+		return 0, srtapi.EINVPARAM
+	}
+	var received int64
+	stop := WatchProgress(n, interval, progress, func() (int64, int64) {
+		n := atomic.LoadInt64(&received)
+		return n, n
+	})
+	defer stop()
+	buf := make([]byte, fileBuffer)
+	for left := n; left > 0; {
+		b := buf
+		if int64(len(b)) > left && c.StreamMode() {
+			b = b[:left]
+		}
+		nr, err := c.ReadContext(ctx, b)
+		if int64(nr) > left {
+			// A message went past the end of the file.
+			nr = int(left)
+		}
+		if nr > 0 {
+			if _, werr := f.Write(b[:nr]); werr != nil {
+				return atomic.LoadInt64(&received), werr
+			}
+			atomic.AddInt64(&received, int64(nr))
+			left -= int64(nr)
+		}
+		if err == io.EOF && left > 0 {
+			err = io.ErrUnexpectedEOF
+		}
+		if err != nil && left > 0 {
+			return atomic.LoadInt64(&received), err
+		}
+	}
+	return atomic.LoadInt64(&received), nil
+}
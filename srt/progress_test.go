@@ -0,0 +1,109 @@
+// Copyright (c) 2020 CyberAgent, Inc. All rights reserved.
+// https://github.com/openfresh/gosrt
+
+package srt
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestProgressMeter(t *testing.T) {
+	m := &ProgressMeter{Total: 1000, Window: 2 * time.Second}
+	start := time.Unix(100, 0)
+	if p := m.Update(start, 0, 0); p.Rate != 0 || p.ETA() != -1 {
+		t.Errorf("at the start: %+v, ETA %v; want no rate and no ETA", p, p.ETA())
+	}
+	m.Update(start.Add(time.Second), 200, 100)
+	p := m.Update(start.Add(2*time.Second), 400, 300)
+	if p.Rate != 150 || p.Elapsed != 2*time.Second || p.ETA() != 700*time.Second/150 {
+		t.Errorf("after 2s: %+v, ETA %v; want 150 B/s", p, p.ETA())
+	}
+	// The first second falls out of the window.
+	if p = m.Update(start.Add(3*time.Second), 800, 700); p.Rate != 300 {
+		t.Errorf("after 3s: rate %v; want 300 B/s of the last 2s", p.Rate)
+	}
+	if p = m.Update(start.Add(4*time.Second), 1000, 1000); p.ETA() != 0 {
+		t.Errorf("done: ETA %v; want 0", p.ETA())
+	}
+	if p := (Progress{Acked: 10, Rate: 5}); p.ETA() != -1 {
+		t.Errorf("ETA of an unknown total %v; want -1", p.ETA())
+	}
+}
+
+func TestSendFile(t *testing.T) {
+	data := make([]byte, 30<<10)
+	rand.New(rand.NewSource(1)).Read(data)
+	dir := t.TempDir()
+	src := filepath.Join(dir, "src")
+	if err := ioutil.WriteFile(src, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	ln, err := Listen("srt", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	c, err := Dial("srt", ln.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	a, err := ln.Accept()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer a.Close()
+
+	dst, err := os.Create(filepath.Join(dir, "dst"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer dst.Close()
+	type outcome struct {
+		n    int64
+		err  error
+		last Progress
+	}
+	ch := make(chan outcome, 1)
+	go func() {
+		var o outcome
+		o.n, o.err = a.(*SRTConn).RecvFile(context.Background(), dst, int64(len(data)), 10*time.Millisecond, func(p Progress) { o.last = p })
+		ch <- o
+	}()
+
+	f, err := os.Open(src)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	var reports []Progress
+	n, err := c.(*SRTConn).SendFile(context.Background(), f, 10*time.Millisecond, func(p Progress) { reports = append(reports, p) })
+	if err != nil || n != int64(len(data)) {
+		t.Fatalf("SendFile: %d, %v; want %d", n, err, len(data))
+	}
+	last := reports[len(reports)-1]
+	if last.Total != n || last.Bytes != n || last.Acked != n || last.ETA() != 0 {
+		t.Errorf("last progress sending %+v; want all acknowledged", last)
+	}
+	for _, p := range reports {
+		if p.Acked > p.Bytes || p.Bytes > p.Total {
+			t.Errorf("progress sending %+v; want acknowledged <= sent <= total", p)
+		}
+	}
+
+	o := <-ch
+	if o.err != nil || o.n != n || o.last.Bytes != n || o.last.Acked != n {
+		t.Errorf("RecvFile: %d, %v, last progress %+v; want %d", o.n, o.err, o.last, n)
+	}
+	if got, _ := ioutil.ReadFile(dst.Name()); !bytes.Equal(got, data) {
+		t.Error("file received differs")
+	}
+}
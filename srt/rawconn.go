@@ -0,0 +1,85 @@
+// Copyright (c) 2020 CyberAgent, Inc. All rights reserved.
+// https://github.com/openfresh/gosrt
+
+package srt
+
+import (
+	"github.com/openfresh/gosrt/srtapi"
+)
+
+// A RawConn gives access to the SRT socket of a connection or
+// listener, for libsrt functions gosrt doesn't wrap. Like
+// syscall.RawConn, it keeps the socket from being closed while the
+// functions run, and lets Read and Write wait on the poller that owns
+// the socket instead of blocking in libsrt, which the socket being
+// non-blocking doesn't allow anyway.
+type RawConn struct {
+	fd       *netFD
+	listener bool
+}
+
+func (c *RawConn) ok() bool { return c != nil && c.fd != nil }
+
+// Control calls f with the socket. The socket stays valid until f
+// returns; f must not close it, and must not block.
+func (c *RawConn) Control(f func(s srtapi.SrtSocket)) error {
+	if !c.ok() {
+		return srtapi.EINVPARAM
+	}
+	err := c.fd.pfd.RawControl(func(s int) { f(srtapi.SrtSocket(s)) })
+	if err != nil {
+		err = &OpError{Op: "raw-control", Net: c.fd.net, Source: nil, Addr: c.fd.laddr, Err: err}
+	}
+	return err
+}
+
+// Read calls f with the socket until f returns true, waiting for the
+// socket to be readable each time it returns false, as after a read
+// failing with srtapi.EASYNCRCV. It holds the read side of the
+// connection meanwhile, and honors its read deadline.
+func (c *RawConn) Read(f func(s srtapi.SrtSocket) (done bool)) error {
+	if !c.ok() {
+		return srtapi.EINVPARAM
+	}
+	if c.listener {
+		return &OpError{Op: "raw-read", Net: c.fd.net, Source: nil, Addr: c.fd.laddr, Err: srtapi.EINVOP}
+	}
+	err := c.fd.pfd.RawRead(func(s int) bool { return f(srtapi.SrtSocket(s)) })
+	if err != nil {
+		err = &OpError{Op: "raw-read", Net: c.fd.net, Source: c.fd.laddr, Addr: c.fd.raddr, Err: err}
+	}
+	return err
+}
+
+// Write is like Read for writing, waiting for the socket to be
+// writable.
+func (c *RawConn) Write(f func(s srtapi.SrtSocket) (done bool)) error {
+	if !c.ok() {
+		return srtapi.EINVPARAM
+	}
+	if c.listener {
+		return &OpError{Op: "raw-write", Net: c.fd.net, Source: nil, Addr: c.fd.laddr, Err: srtapi.EINVOP}
+	}
+	err := c.fd.pfd.RawWrite(func(s int) bool { return f(srtapi.SrtSocket(s)) })
+	if err != nil {
+		err = &OpError{Op: "raw-write", Net: c.fd.net, Source: c.fd.laddr, Addr: c.fd.raddr, Err: err}
+	}
+	return err
+}
+
+// RawConn returns access to the SRT socket of c.
+func (c *conn) RawConn() (*RawConn, error) {
+	if !c.ok() {
+		return nil, srtapi.EINVPARAM
+	}
+	return &RawConn{fd: c.fd}, nil
+}
+
+// RawConn returns access to the SRT socket of l. Its Read and Write
+// fail with srtapi.EINVOP: the socket is only read by Accept.
+func (l *SRTListener) RawConn() (*RawConn, error) {
+	if !l.ok() {
+		return nil, srtapi.EINVPARAM
+	}
+	return &RawConn{fd: l.fd, listener: true}, nil
+}
@@ -0,0 +1,107 @@
+// Copyright (c) 2020 CyberAgent, Inc. All rights reserved.
+// https://github.com/openfresh/gosrt
+
+package srt
+
+import (
+	"context"
+	"errors"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/openfresh/gosrt/srtapi"
+)
+
+func TestRawConn(t *testing.T) {
+	c1, c2, err := PipeContext(WithOptions(context.Background(), Options("streamid", "raw")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c1.Close()
+	defer c2.Close()
+
+	rc, err := c2.RawConn()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var id string
+	if err := rc.Control(func(s srtapi.SrtSocket) {
+		id, err = srtapi.GetsockflagString(int(s), srtapi.OptionStreamid)
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if err != nil || id != "raw" {
+		t.Errorf("got stream ID %q, %v; want %q", id, err, "raw")
+	}
+
+	// Control doesn't wait for a pending read.
+	done := make(chan []byte)
+	go func() {
+		var got []byte
+		rc.Read(func(s srtapi.SrtSocket) bool {
+			b := make([]byte, 1500)
+			n, err := srtapi.Read(int(s), b)
+			if err == srtapi.EASYNCRCV {
+				return false
+			}
+			got = b[:n]
+			return true
+		})
+		done <- got
+	}()
+	time.Sleep(10 * time.Millisecond)
+	if err := rc.Control(func(srtapi.SrtSocket) {}); err != nil {
+		t.Fatal(err)
+	}
+
+	wc, _ := c1.RawConn()
+	if err := wc.Write(func(s srtapi.SrtSocket) bool {
+		_, err := srtapi.Write(int(s), []byte("raw data"))
+		return err != srtapi.EASYNCSND
+	}); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case got := <-done:
+		if string(got) != "raw data" {
+			t.Errorf("got %q; want %q", got, "raw data")
+		}
+	case <-time.After(someTimeout):
+		t.Fatal("raw read didn't complete")
+	}
+
+	// The read deadline applies.
+	c2.SetReadDeadline(time.Now().Add(10 * time.Millisecond))
+	err = rc.Read(func(srtapi.SrtSocket) bool { return false })
+	if perr := parseReadError(err); perr != nil {
+		t.Error(perr)
+	}
+	if nerr, ok := err.(net.Error); !ok || !nerr.Timeout() {
+		t.Errorf("got %v; want a timeout", err)
+	}
+
+	c2.Close()
+	if err := rc.Control(func(srtapi.SrtSocket) { t.Error("Control called f on a closed connection") }); !errors.Is(err, ErrClosed) {
+		t.Errorf("got %v; want %v", err, ErrClosed)
+	}
+}
+
+func TestListenerRawConn(t *testing.T) {
+	ln, err := newLocalListener("srt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	rc, err := ln.(*SRTListener).RawConn()
+	if err != nil {
+		t.Fatal(err)
+	}
+	called := false
+	if err := rc.Control(func(srtapi.SrtSocket) { called = true }); err != nil || !called {
+		t.Errorf("Control = %v, called %v", err, called)
+	}
+	if err := rc.Read(func(srtapi.SrtSocket) bool { return true }); !errors.Is(err, srtapi.EINVOP) {
+		t.Errorf("Read on a listener = %v; want %v", err, srtapi.EINVOP)
+	}
+}
@@ -0,0 +1,148 @@
+// Copyright (c) 2020 CyberAgent, Inc. All rights reserved.
+// https://github.com/openfresh/gosrt
+
+package srt
+
+import (
+	"sync"
+	"time"
+
+	"github.com/openfresh/gosrt/srtapi"
+)
+
+// maxSeqGaps is the number of gaps a recvSeq keeps, as many as the pure
+// Go implementation does.
+const maxSeqGaps = 256
+
+// A recvSeq follows the sequence numbers of the packets a live mode
+// connection reads, for the SRT libraries that don't report what
+// became of the others. Live mode delivers the packets in order, one
+// message each, and only skips those dropped as too late: a packet
+// further on than the next one expected tells of the range dropped.
+type recvSeq struct {
+	mu      sync.Mutex
+	started bool
+	next    int32
+
+	// the latest gaps, oldest first, and the counts of GapReport
+	gaps           []SeqGap
+	total, packets int64
+
+	// dropped is called with each range skipped, without mu held
+	dropped func(first, last int32, packets int)
+}
+
+// newRecvSeq returns the recvSeq of the live mode connection fd, nil if
+// the SRT library reports drops and gaps itself or fd isn't in live
+// mode.
+func newRecvSeq(fd *netFD) *recvSeq {
+	if hasReportsFunc(srtapi.FeatureDropEvents) && hasReportsFunc(srtapi.FeatureGapReports) {
+		return nil
+	}
+	if tsbpd, err := srtapi.GetsockflagInt(fd.pfd.Sysfd, srtapi.OptionTsbpdmode); err != nil || tsbpd == 0 {
+		return nil
+	}
+	r := new(recvSeq)
+	if !hasReportsFunc(srtapi.FeatureDropEvents) {
+		r.dropped = func(first, last int32, packets int) {
+			fd.dropped(first, last, packets, false)
+		}
+	}
+	return r
+}
+
+// seqMax is the largest SRT sequence number, after which they wrap.
+const seqMax = 0x7FFFFFFF
+
+// seqOffset returns the distance from the sequence number a to b, in
+// (-2^30, 2^30].
+func seqOffset(a, b int32) int32 {
+	d := (b - a) & seqMax
+	if d > seqMax/2+1 {
+		d = d - seqMax - 1
+	}
+	return d
+}
+
+// received follows the packet seq read at now.
+func (r *recvSeq) received(seq int32, now time.Time) {
+	r.mu.Lock()
+	if !r.started {
+		r.started, r.next = true, (seq+1)&seqMax
+		r.mu.Unlock()
+		return
+	}
+	d := seqOffset(r.next, seq)
+	if d < 0 {
+		// Not a packet of live mode, which doesn't go back.
+		r.mu.Unlock()
+		return
+	}
+	first := r.next
+	r.next = (seq + 1) & seqMax
+	if d == 0 {
+		r.mu.Unlock()
+		return
+	}
+	last := (seq - 1) & seqMax
+	if len(r.gaps) == maxSeqGaps {
+		copy(r.gaps, r.gaps[1:])
+		r.gaps = r.gaps[:maxSeqGaps-1]
+	}
+	r.gaps = append(r.gaps, SeqGap{
+		FirstSeq: first,
+		LastSeq:  last,
+		Packets:  int(d),
+		Detected: now,
+		Dropped:  int(d),
+		Resolved: now,
+	})
+	r.total++
+	r.packets += int64(d)
+	r.mu.Unlock()
+	if r.dropped != nil {
+		r.dropped(first, last, int(d))
+	}
+}
+
+// seen returns the function recording the messages the connection
+// reads as received, for the poll.FD to call while it holds the read
+// lock: recorded after, concurrent reads could be out of order, and
+// seem to leave gaps. It returns nil for a nil r.
+func (r *recvSeq) seen() func(*srtapi.MsgCtrl) {
+	if r == nil {
+		return nil
+	}
+	return func(mc *srtapi.MsgCtrl) { r.received(mc.PktSeq, time.Now()) }
+}
+
+// report returns the gaps found so far.
+func (r *recvSeq) report() GapReport {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return GapReport{Gaps: append([]SeqGap(nil), r.gaps...), Total: r.total, Packets: r.packets}
+}
+
+// readPfd reads one message into p, through srt_recvmsg2 when fd
+// follows the sequence numbers of its packets.
+func (fd *netFD) readPfd(p []byte) (int, error) {
+	if fd.rseq == nil || len(p) == 0 {
+		return fd.pfd.Read(p)
+	}
+	var mc srtapi.MsgCtrl
+	return fd.pfd.ReadMsg(p, &mc, fd.rseq.seen())
+}
+
+// readRaw reads one message into p from s, the socket of fd, within a
+// RawRead, as readPfd does.
+func (fd *netFD) readRaw(s int, p []byte) (int, error) {
+	if fd.rseq == nil {
+		return srtapi.Read(s, p)
+	}
+	var mc srtapi.MsgCtrl
+	n, err := srtapi.RecvMsg2(s, p, &mc)
+	if err == nil {
+		fd.rseq.received(mc.PktSeq, time.Now())
+	}
+	return n, err
+}
@@ -0,0 +1,84 @@
+// Copyright (c) 2020 CyberAgent, Inc. All rights reserved.
+// https://github.com/openfresh/gosrt
+
+package srt
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/openfresh/gosrt/srtapi"
+)
+
+// emulateReports has the connections made until restore is called make
+// up for the drops, gaps and key refreshes the SRT library doesn't
+// report, as with libsrt.
+func emulateReports() (restore func()) {
+	orig := hasReportsFunc
+	hasReportsFunc = func(f srtapi.Feature) bool {
+		switch f {
+		case srtapi.FeatureDropEvents, srtapi.FeatureGapReports, srtapi.FeatureKeyEvents:
+			return false
+		}
+		return orig(f)
+	}
+	return func() { hasReportsFunc = orig }
+}
+
+func TestSeqOffset(t *testing.T) {
+	for _, tt := range []struct {
+		a, b, want int32
+	}{
+		{10, 10, 0},
+		{10, 13, 3},
+		{13, 10, -3},
+		{seqMax, 0, 1},
+		{seqMax - 1, 2, 4},
+		{2, seqMax - 1, -4},
+	} {
+		if got := seqOffset(tt.a, tt.b); got != tt.want {
+			t.Errorf("seqOffset(%d, %d) = %d; want %d", tt.a, tt.b, got, tt.want)
+		}
+	}
+}
+
+func TestRecvSeq(t *testing.T) {
+	type drop struct {
+		first, last int32
+		packets     int
+	}
+	var drops []drop
+	r := &recvSeq{dropped: func(first, last int32, packets int) {
+		drops = append(drops, drop{first, last, packets})
+	}}
+	now := time.Now()
+	for _, seq := range []int32{seqMax - 2, seqMax - 1, 1, 2, 1, 5} {
+		r.received(seq, now)
+	}
+	want := []drop{{seqMax, 0, 2}, {3, 4, 2}}
+	if !reflect.DeepEqual(drops, want) {
+		t.Errorf("got drops %v; want %v", drops, want)
+	}
+
+	rep := r.report()
+	if rep.Total != 2 || rep.Packets != 4 || len(rep.Gaps) != 2 {
+		t.Fatalf("got %+v; want 2 gaps of 4 packets", rep)
+	}
+	g := rep.Gaps[0]
+	if g.FirstSeq != seqMax || g.LastSeq != 0 || g.Packets != 2 || g.Dropped != 2 || g.Recovered != 0 || !g.Detected.Equal(now) || !g.Resolved.Equal(now) {
+		t.Errorf("got gap %+v", g)
+	}
+
+	// Only the latest gaps are kept.
+	for seq := int32(7); seq < 7+2*(maxSeqGaps+10); seq += 2 {
+		r.received(seq, now)
+	}
+	rep = r.report()
+	if len(rep.Gaps) != maxSeqGaps || rep.Total != 2+maxSeqGaps+10 {
+		t.Fatalf("got %d gaps of %d; want %d of %d", len(rep.Gaps), rep.Total, maxSeqGaps, 2+maxSeqGaps+10)
+	}
+	if last := rep.Gaps[maxSeqGaps-1]; last.FirstSeq != 6+2*(maxSeqGaps+9) {
+		t.Errorf("got last gap %+v", last)
+	}
+}
@@ -0,0 +1,160 @@
+// Copyright (c) 2020 CyberAgent, Inc. All rights reserved.
+// https://github.com/openfresh/gosrt
+
+package srt
+
+import (
+	"context"
+	"sort"
+	"sync"
+)
+
+// A Registry tracks the open connections and listeners made with a
+// context carrying it (see WithRegistry), and the connections those
+// listeners accept, for admin tooling to list them and for a process
+// to close them all when it shuts down. They leave the registry when
+// they are closed.
+//
+// The zero Registry is empty and ready to use.
+type Registry struct {
+	mu        sync.Mutex
+	conns     map[*netFD]*SRTConn
+	listeners map[*netFD]*SRTListener
+	closed    bool
+}
+
+// NewRegistry returns an empty Registry.
+func NewRegistry() *Registry {
+	return new(Registry)
+}
+
+// registryContextKey is the type of contextKeys used for Registry.
+type registryContextKey struct{}
+
+// WithRegistry returns a new context.Context with the Registry taking
+// the connections and listeners made with it.
+func WithRegistry(ctx context.Context, r *Registry) context.Context {
+	return context.WithValue(ctx, registryContextKey{}, r)
+}
+
+func registryValue(ctx context.Context) *Registry {
+	r, _ := ctx.Value(registryContextKey{}).(*Registry)
+	return r
+}
+
+// addConn registers c, unless CloseAll was called, in which case it
+// closes c and returns ErrClosed.
+func (r *Registry) addConn(c *SRTConn) error {
+	r.mu.Lock()
+	if r.closed {
+		r.mu.Unlock()
+		c.fd.Close()
+		return ErrClosed
+	}
+	if r.conns == nil {
+		r.conns = make(map[*netFD]*SRTConn)
+	}
+	r.conns[c.fd] = c
+	c.fd.registry = r
+	r.mu.Unlock()
+	return nil
+}
+
+func (r *Registry) addListener(ln *SRTListener) error {
+	r.mu.Lock()
+	if r.closed {
+		r.mu.Unlock()
+		ln.fd.Close()
+		return ErrClosed
+	}
+	if r.listeners == nil {
+		r.listeners = make(map[*netFD]*SRTListener)
+	}
+	r.listeners[ln.fd] = ln
+	ln.fd.registry = r
+	r.mu.Unlock()
+	return nil
+}
+
+func (r *Registry) remove(fd *netFD) {
+	r.mu.Lock()
+	delete(r.conns, fd)
+	delete(r.listeners, fd)
+	r.mu.Unlock()
+}
+
+// Conns returns the open connections, by socket ID.
+func (r *Registry) Conns() []*SRTConn {
+	r.mu.Lock()
+	cs := make([]*SRTConn, 0, len(r.conns))
+	for _, c := range r.conns {
+		cs = append(cs, c)
+	}
+	r.mu.Unlock()
+	sort.Slice(cs, func(i, j int) bool { return cs[i].fd.pfd.Sysfd < cs[j].fd.pfd.Sysfd })
+	return cs
+}
+
+// Listeners returns the open listeners, by socket ID.
+func (r *Registry) Listeners() []*SRTListener {
+	r.mu.Lock()
+	ls := make([]*SRTListener, 0, len(r.listeners))
+	for _, ln := range r.listeners {
+		ls = append(ls, ln)
+	}
+	r.mu.Unlock()
+	sort.Slice(ls, func(i, j int) bool { return ls[i].fd.pfd.Sysfd < ls[j].fd.pfd.Sysfd })
+	return ls
+}
+
+// Lookup returns the open connection with the SRT socket ID id, or nil.
+func (r *Registry) Lookup(id int) *SRTConn {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for fd, c := range r.conns {
+		if fd.pfd.Sysfd == id {
+			return c
+		}
+	}
+	return nil
+}
+
+// LookupStreamID returns the open connections with the stream ID id,
+// by socket ID.
+func (r *Registry) LookupStreamID(id string) []*SRTConn {
+	var cs []*SRTConn
+	for _, c := range r.Conns() {
+		if sid, err := c.StreamID(); err == nil && sid == id {
+			cs = append(cs, c)
+		}
+	}
+	return cs
+}
+
+// CloseAll closes the listeners, then the connections, and has the
+// registry close those made with it from then on. It returns the first
+// error closing them.
+func (r *Registry) CloseAll() error {
+	r.mu.Lock()
+	r.closed = true
+	r.mu.Unlock()
+	var first error
+	for _, ln := range r.Listeners() {
+		if err := ln.Close(); err != nil && first == nil {
+			first = err
+		}
+	}
+	for _, c := range r.Conns() {
+		if err := c.Close(); err != nil && first == nil {
+			first = err
+		}
+	}
+	return first
+}
+
+// deregister removes fd from the registry it is in, if any.
+func (fd *netFD) deregister() {
+	if fd.registry != nil {
+		fd.registry.remove(fd)
+	}
+}
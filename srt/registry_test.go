@@ -0,0 +1,75 @@
+// Copyright (c) 2020 CyberAgent, Inc. All rights reserved.
+// https://github.com/openfresh/gosrt
+
+package srt
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+func TestRegistry(t *testing.T) {
+	r := NewRegistry()
+	ctx := WithRegistry(context.Background(), r)
+	ln, err := listenSRT(ctx, "srt4", &SRTAddr{IP: []byte{127, 0, 0, 1}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	if ls := r.Listeners(); len(ls) != 1 || ls[0] != ln {
+		t.Fatalf("Listeners() = %v; want the listener", ls)
+	}
+
+	// The dial goes through another registry: only the accepted end
+	// joins r.
+	other := NewRegistry()
+	caller, err := dialSRT(WithOptions(WithRegistry(context.Background(), other), Options("streamid", "feed")), "srt4", nil, ln.fd.laddr.(*SRTAddr))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer caller.Close()
+	peer, err := ln.accept()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer peer.Close()
+
+	if cs := r.Conns(); len(cs) != 1 || cs[0] != peer {
+		t.Errorf("Conns() = %v; want the accepted connection", cs)
+	}
+	if cs := other.Conns(); len(cs) != 1 || cs[0] != caller {
+		t.Errorf("other Conns() = %v; want the caller", cs)
+	}
+	if c := r.Lookup(peer.SocketID()); c != peer {
+		t.Errorf("Lookup(%d) = %v; want the accepted connection", peer.SocketID(), c)
+	}
+	if c := r.Lookup(caller.SocketID()); c != nil {
+		t.Errorf("Lookup(%d) = %v; want nil", caller.SocketID(), c)
+	}
+	if cs := r.LookupStreamID("feed"); len(cs) != 1 || cs[0] != peer {
+		t.Errorf("LookupStreamID(feed) = %v; want the accepted connection", cs)
+	}
+	if cs := r.LookupStreamID("other"); len(cs) != 0 {
+		t.Errorf("LookupStreamID(other) = %v; want none", cs)
+	}
+
+	// Closed connections leave the registry.
+	caller.Close()
+	if cs := other.Conns(); len(cs) != 0 {
+		t.Errorf("other Conns() after Close = %v; want none", cs)
+	}
+
+	if err := r.CloseAll(); err != nil {
+		t.Fatal(err)
+	}
+	if ls, cs := r.Listeners(), r.Conns(); len(ls) != 0 || len(cs) != 0 {
+		t.Errorf("after CloseAll: %v, %v; want none", ls, cs)
+	}
+	if _, err := peer.Write([]byte("x")); err == nil {
+		t.Error("Write after CloseAll succeeded")
+	}
+	if _, err := listenSRT(ctx, "srt4", &SRTAddr{IP: []byte{127, 0, 0, 1}}); !errors.Is(err, ErrClosed) {
+		t.Errorf("listen after CloseAll: %v; want ErrClosed", err)
+	}
+}
@@ -0,0 +1,227 @@
+// Copyright (c) 2020 CyberAgent, Inc. All rights reserved.
+// https://github.com/openfresh/gosrt
+
+package srt
+
+import (
+	"errors"
+	"strconv"
+
+	"github.com/openfresh/gosrt/srtapi"
+)
+
+// ErrEncryptionMismatch is matched by the error of a dial the peer
+// rejected because the passphrases differ, or because only one side
+// has one while encryption is enforced. Test for it with
+// errors.Is(err, srt.ErrEncryptionMismatch); the RejectError in the
+// chain tells which of the two happened. A listener rejects such
+// peers during the handshake, so its Accept never sees them.
+var ErrEncryptionMismatch = errors.New("encryption mismatch")
+
+// A RejectReason tells why an SRT handshake was rejected.
+type RejectReason int
+
+// Reject reasons
+const (
+	RejectUnknown    RejectReason = srtapi.RejectUnknown
+	RejectSystem     RejectReason = srtapi.RejectSystem
+	RejectPeer       RejectReason = srtapi.RejectPeer
+	RejectResource   RejectReason = srtapi.RejectResource
+	RejectRogue      RejectReason = srtapi.RejectRogue
+	RejectBacklog    RejectReason = srtapi.RejectBacklog
+	RejectIPE        RejectReason = srtapi.RejectIpe
+	RejectClose      RejectReason = srtapi.RejectClose
+	RejectVersion    RejectReason = srtapi.RejectVersion
+	RejectRdvCookie  RejectReason = srtapi.RejectRdvcookie
+	RejectBadSecret  RejectReason = srtapi.RejectBadsecret
+	RejectUnsecure   RejectReason = srtapi.RejectUnsecure
+	RejectMessageAPI RejectReason = srtapi.RejectMessageapi
+	RejectCongestion RejectReason = srtapi.RejectCongestion
+	RejectFilter     RejectReason = srtapi.RejectFilter
+	RejectTimeout    RejectReason = srtapi.RejectTimeout
+
+	// RejectCallback is the reason of peers a listen callback
+	// turned down without giving a reason of its own.
+	RejectCallback RejectReason = 1000
+
+	// RejectPolicy marks, in HandshakeAttempt records, connections
+	// an EncryptionPolicy closed. SRT never reports it.
+	RejectPolicy RejectReason = -2
+)
+
+// RejectUserDefined starts the range of the reject reasons left to
+// applications, above the extended ones SRT predefines.
+const RejectUserDefined RejectReason = 2000
+
+// Extended reject reasons, the SRT_REJX_* codes of the SRT access
+// control guidelines, which a listen callback rejecting a caller can
+// give it: RejectCallback names SRT_REJX_FALLBACK. Most are
+// RejectCallback plus the HTTP status of the same meaning; see
+// RejectReason.HTTPStatus.
+const (
+	RejectXKeyNotSupported RejectReason = 1001 // a stream ID key isn't supported
+	RejectXFilePath        RejectReason = 1002 // the resource is a path the listener refuses
+	RejectXHostNotFound    RejectReason = 1003 // the "h" host is not served here
+
+	RejectXBadRequest          RejectReason = 1400
+	RejectXUnauthorized        RejectReason = 1401 // credentials missing or wrong
+	RejectXOverload            RejectReason = 1402 // the caller is over its quota
+	RejectXForbidden           RejectReason = 1403 // the caller may not have the resource
+	RejectXNotFound            RejectReason = 1404 // no such resource
+	RejectXBadMode             RejectReason = 1405 // the mode doesn't apply to the resource
+	RejectXUnacceptable        RejectReason = 1406 // the parameters can't be met
+	RejectXConflict            RejectReason = 1409 // the resource is taken, by another publisher say
+	RejectXUnsupportedMedia    RejectReason = 1415
+	RejectXLocked              RejectReason = 1423
+	RejectXFailedDependency    RejectReason = 1424
+	RejectXInternal            RejectReason = 1500
+	RejectXUnimplemented       RejectReason = 1501
+	RejectXGateway             RejectReason = 1502 // an upstream the listener relays failed
+	RejectXDown                RejectReason = 1503 // the service is down for now
+	RejectXVersion             RejectReason = 1505
+	RejectXInsufficientStorage RejectReason = 1507
+)
+
+var rejectReasons = map[RejectReason]string{
+	RejectUnknown:    "unknown or erroneous",
+	RejectSystem:     "system function error",
+	RejectPeer:       "rejected by peer",
+	RejectResource:   "resource allocation problem",
+	RejectRogue:      "incorrect data in handshake",
+	RejectBacklog:    "listener's backlog exceeded",
+	RejectIPE:        "internal program error",
+	RejectClose:      "socket is closing",
+	RejectVersion:    "peer is older than the minimum version",
+	RejectRdvCookie:  "rendezvous cookie collision",
+	RejectBadSecret:  "wrong password",
+	RejectUnsecure:   "password required or unexpected",
+	RejectMessageAPI: "stream and message API mismatch",
+	RejectCongestion: "congestion controller type collision",
+	RejectFilter:     "packet filter settings error",
+	RejectTimeout:    "connection timeout",
+	RejectCallback:   "rejected by listen callback",
+	RejectPolicy:     "encryption policy not met",
+
+	RejectXKeyNotSupported:     "stream ID key not supported",
+	RejectXFilePath:            "resource path refused",
+	RejectXHostNotFound:        "host not found",
+	RejectXBadRequest:          "bad request",
+	RejectXUnauthorized:        "unauthorized",
+	RejectXOverload:            "overloaded or over quota",
+	RejectXForbidden:           "forbidden",
+	RejectXNotFound:            "resource not found",
+	RejectXBadMode:             "mode not allowed",
+	RejectXUnacceptable:        "parameters unacceptable",
+	RejectXConflict:            "resource in use",
+	RejectXUnsupportedMedia:    "media type not supported",
+	RejectXLocked:              "resource locked",
+	RejectXFailedDependency:    "dependent session failed",
+	RejectXInternal:            "internal server error",
+	RejectXUnimplemented:       "not implemented",
+	RejectXGateway:             "upstream failed",
+	RejectXDown:                "service unavailable",
+	RejectXVersion:             "version not supported",
+	RejectXInsufficientStorage: "insufficient storage",
+}
+
+func (r RejectReason) String() string {
+	// RejectTimeout is -1 with SRT libraries lacking it.
+	if s, ok := rejectReasons[r]; ok && r != -1 {
+		return s
+	}
+	if r >= RejectUserDefined {
+		return "application reject reason " + strconv.Itoa(int(r-RejectUserDefined))
+	}
+	return "reject reason " + strconv.Itoa(int(r))
+}
+
+// HTTPStatus returns the HTTP status of the meaning of r, for servers
+// fronting SRT with HTTP APIs and for callers to tell whether trying
+// again can help, or 0 if none fits. The extended reasons of HTTP
+// statuses map to their status, but RejectXOverload, which stands for
+// 402 in SRT, to 429; the other extended reasons and the passphrase and
+// load reasons of SRT map to the status closest to them, and the
+// reasons of the application to none.
+func (r RejectReason) HTTPStatus() int {
+	switch {
+	case r == RejectXOverload:
+		return 429
+	case r >= RejectCallback+100 && r < RejectCallback+600:
+		return int(r - RejectCallback)
+	}
+	switch r {
+	case RejectCallback:
+		return 403
+	case RejectXKeyNotSupported, RejectXFilePath:
+		return 400
+	case RejectXHostNotFound:
+		return 404
+	case RejectBadSecret, RejectUnsecure:
+		return 401
+	case RejectBacklog, RejectResource, RejectClose:
+		return 503
+	case RejectVersion:
+		return 505
+	}
+	return 0
+}
+
+// RejectReasonFromHTTP returns the extended reject reason of the HTTP
+// status, RejectXForbidden for 403 say, for listeners to reject callers
+// with the status an authorization service answered. 429 maps to
+// RejectXOverload, and statuses out of the HTTP range to RejectCallback.
+// The statuses below 400, which aren't errors, have no reason:
+// RejectUnknown.
+func RejectReasonFromHTTP(status int) RejectReason {
+	switch {
+	case status == 429:
+		return RejectXOverload
+	case status < 100 || status > 599:
+		return RejectCallback
+	case status < 400:
+		return RejectUnknown
+	}
+	return RejectCallback + RejectReason(status)
+}
+
+// RejectError is the error of a dial whose handshake was rejected.
+type RejectError struct {
+	Reason RejectReason
+}
+
+func (e *RejectError) Error() string {
+	return "connection rejected: " + e.Reason.String()
+}
+
+// Is reports whether target is ErrEncryptionMismatch and the reason
+// is a passphrase problem.
+func (e *RejectError) Is(target error) bool {
+	return target == ErrEncryptionMismatch &&
+		(e.Reason == RejectBadSecret || e.Reason == RejectUnsecure)
+}
+
+// Timeout reports whether the peer never answered the handshake.
+func (e *RejectError) Timeout() bool { return e.Reason == RejectTimeout }
+
+// HTTPStatus returns the HTTP status of the reason.
+func (e *RejectError) HTTPStatus() int { return e.Reason.HTTPStatus() }
+
+// setRejectReason has the listen callback rejecting ns because of err
+// give the caller the reason of err, if err is or wraps a RejectError
+// of an extended reason. Other errors leave RejectCallback.
+func setRejectReason(ns int, err error) {
+	var rerr *RejectError
+	if errors.As(err, &rerr) && rerr.Reason > RejectCallback {
+		srtapi.SetRejectReason(ns, int(rerr.Reason))
+	}
+}
+
+// rejectError returns the error for the handshake of fd failing, or
+// nil if SRT reports no reason for it.
+func rejectError(fd int) error {
+	r := RejectReason(srtapi.GetRejectReason(fd))
+	if r == RejectUnknown {
+		return nil
+	}
+	return &RejectError{Reason: r}
+}
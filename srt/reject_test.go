@@ -0,0 +1,105 @@
+// Copyright (c) 2020 CyberAgent, Inc. All rights reserved.
+// https://github.com/openfresh/gosrt
+
+package srt
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"testing"
+
+	"github.com/openfresh/gosrt/srtapi"
+)
+
+func TestRejectReasonHTTP(t *testing.T) {
+	for _, tt := range []struct {
+		r      RejectReason
+		status int
+	}{
+		{RejectXUnauthorized, 401},
+		{RejectXForbidden, 403},
+		{RejectXNotFound, 404},
+		{RejectXDown, 503},
+		{RejectXOverload, 429},
+		{RejectCallback, 403},
+		{RejectXHostNotFound, 404},
+		{RejectBadSecret, 401},
+		{RejectBacklog, 503},
+		{RejectPeer, 0},
+		{RejectUserDefined + 403, 0},
+	} {
+		if got := tt.r.HTTPStatus(); got != tt.status {
+			t.Errorf("%v.HTTPStatus() = %d; want %d", tt.r, got, tt.status)
+		}
+	}
+	for status, want := range map[int]RejectReason{
+		401: RejectXUnauthorized,
+		403: RejectXForbidden,
+		404: RejectXNotFound,
+		503: RejectXDown,
+		429: RejectXOverload,
+		418: RejectCallback + 418,
+		0:   RejectCallback,
+		700: RejectCallback,
+		200: RejectUnknown,
+		302: RejectUnknown,
+	} {
+		if got := RejectReasonFromHTTP(status); got != want {
+			t.Errorf("RejectReasonFromHTTP(%d) = %v; want %v", status, got, want)
+		}
+	}
+	if s := (RejectUserDefined + 7).String(); s != "application reject reason 7" {
+		t.Errorf("user-defined reason %q", s)
+	}
+}
+
+func TestRejectExtendedReason(t *testing.T) {
+	if !srtapi.Has(srtapi.FeatureRejectReason) {
+		t.Skip("no reject reasons in listen callbacks")
+	}
+	var audited []RejectReason
+	ctx := WithAudit(context.Background(), func(a HandshakeAttempt) {
+		if !a.Accepted {
+			audited = append(audited, a.Reason)
+		}
+	})
+	ctx = WithHooks(ctx, &Hooks{
+		BeforeHandshake: func(ctx context.Context, op string, addr net.Addr, streamID string) error {
+			switch streamID {
+			case "secret":
+				return fmt.Errorf("token: %w", &RejectError{Reason: RejectXUnauthorized})
+			case "deny":
+				return errors.New("denied")
+			}
+			return nil
+		},
+	})
+	ln, err := listenSRT(ctx, "srt4", &SRTAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	raddr := ln.fd.laddr.(*SRTAddr)
+
+	for streamID, want := range map[string]RejectReason{"secret": RejectXUnauthorized, "deny": RejectCallback} {
+		_, err := dialSRT(WithOptions(context.Background(), Options("streamid", streamID)), "srt4", nil, raddr)
+		var rerr *RejectError
+		if !errors.As(err, &rerr) || rerr.Reason != want {
+			t.Errorf("stream ID %q: %v; want a rejection for %v", streamID, err, want)
+			continue
+		}
+		if want == RejectXUnauthorized && rerr.HTTPStatus() != 401 {
+			t.Errorf("HTTPStatus() = %d; want 401", rerr.HTTPStatus())
+		}
+	}
+	if len(audited) != 2 {
+		t.Fatalf("audited %v; want 2 rejections", audited)
+	}
+	for _, r := range audited {
+		if r != RejectXUnauthorized && r != RejectCallback {
+			t.Errorf("audited reason %v", r)
+		}
+	}
+}
@@ -0,0 +1,72 @@
+// Copyright (c) 2020 CyberAgent, Inc. All rights reserved.
+// https://github.com/openfresh/gosrt
+
+package srt
+
+import (
+	"context"
+	"errors"
+	"net"
+)
+
+// errMissingLocalPort is the error of a rendezvous dial from no port
+// in particular, which the peer couldn't dial back.
+var errMissingLocalPort = errors.New("missing local port")
+
+// DialRendezvous connects to raddr in rendezvous mode, from laddr.
+//
+// In rendezvous mode neither side listens: both dial each other at
+// the same time, from the port the other dials, which lets two peers
+// behind NATs connect. laddr must have a port, and may leave the host
+// empty for all the local addresses, as in ":9000"; raddr is the
+// address of the peer, dialing back from it.
+//
+// See func Dial for a description of the network and address
+// parameters. Rendezvous connections need the SRT library: the pure
+// Go implementation doesn't have them.
+func DialRendezvous(network, laddr, raddr string) (*SRTConn, error) {
+	var d Dialer
+	return d.DialRendezvous(context.Background(), network, laddr, raddr)
+}
+
+// DialRendezvous connects to raddr in rendezvous mode, from laddr, as
+// the DialRendezvous function does, within the Timeout and Deadline of
+// d and the deadline of ctx. Canceling ctx before the connection is
+// made stops the handshake. Options set on ctx with WithOptions apply
+// to the connection, and so does Handshake, with the timeouts libsrt
+// gives rendezvous handshakes; the LocalAddr, DualStack, Retry and
+// Latency of d are not used.
+func (d *Dialer) DialRendezvous(ctx context.Context, network, laddr, raddr string) (*SRTConn, error) {
+	if ctx == nil {
+		panic("nil context")
+	}
+	switch network {
+	case "srt", "srt4", "srt6":
+	default:
+		return nil, &OpError{Op: "dial", Net: network, Source: nil, Addr: nil, Err: net.UnknownNetworkError(network)}
+	}
+	la, err := ResolveSRTAddr(network, laddr)
+	if err != nil {
+		return nil, &OpError{Op: "dial", Net: network, Source: nil, Addr: nil, Err: err}
+	}
+	ra, err := ResolveSRTAddr(network, raddr)
+	if err != nil {
+		return nil, &OpError{Op: "dial", Net: network, Source: la.opAddr(), Addr: nil, Err: err}
+	}
+	if la.Port == 0 {
+		return nil, &OpError{Op: "dial", Net: network, Source: la.opAddr(), Addr: ra.opAddr(), Err: errMissingLocalPort}
+	}
+
+	ctx, cancel := d.withDeadline(ctx)
+	defer cancel()
+	ctx = WithOptions(ctx, Options("rendezvous", "true"))
+	if d.Handshake != nil {
+		ctx = d.Handshake.withOptions(ctx)
+	}
+
+	c, err := dialSRT(ctx, network, la, ra)
+	if err != nil {
+		return nil, &OpError{Op: "dial", Net: network, Source: la.opAddr(), Addr: ra.opAddr(), Err: err}
+	}
+	return c, nil
+}
@@ -0,0 +1,105 @@
+// Copyright (c) 2020 CyberAgent, Inc. All rights reserved.
+// https://github.com/openfresh/gosrt
+
+package srt
+
+import (
+	"context"
+	"errors"
+	"net"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/openfresh/gosrt/srtapi"
+)
+
+func TestDialRendezvous(t *testing.T) {
+	origTestHookDialSRT := testHookDialSRT
+	defer func() { testHookDialSRT = origTestHookDialSRT }()
+	errDialed := errors.New("dialed")
+	var gotLaddr, gotRaddr *SRTAddr
+	var rendezvous string
+	var hasDeadline bool
+	testHookDialSRT = func(ctx context.Context, network string, laddr, raddr *SRTAddr) (*SRTConn, error) {
+		gotLaddr, gotRaddr = laddr, raddr
+		rendezvous, _ = Option(ctx, "rendezvous")
+		_, hasDeadline = ctx.Deadline()
+		return nil, errDialed
+	}
+
+	d := Dialer{Timeout: time.Second}
+	_, err := d.DialRendezvous(context.Background(), "srt4", ":9000", "192.0.2.1:9001")
+	if !errors.Is(err, errDialed) {
+		t.Fatalf("got %v; want the error of the dial", err)
+	}
+	if gotLaddr.Port != 9000 || gotRaddr.Port != 9001 || !gotRaddr.IP.Equal([]byte{192, 0, 2, 1}) {
+		t.Errorf("dialed %v from %v", gotRaddr, gotLaddr)
+	}
+	if rendezvous != "true" {
+		t.Errorf("got rendezvous option %q; want true", rendezvous)
+	}
+	if !hasDeadline {
+		t.Error("no deadline from the Timeout")
+	}
+
+	// The peer couldn't dial back an ephemeral port.
+	gotLaddr = nil
+	if _, err := DialRendezvous("srt4", ":0", "192.0.2.1:9001"); !errors.Is(err, errMissingLocalPort) {
+		t.Errorf("got %v; want %v", err, errMissingLocalPort)
+	}
+	if gotLaddr != nil {
+		t.Error("dialed without a local port")
+	}
+}
+
+func TestDialRendezvousLoopback(t *testing.T) {
+	// Two free ports, for the peers to dial each other from.
+	var addrs [2]string
+	for i := range addrs {
+		pc, err := net.ListenPacket("udp4", "127.0.0.1:0")
+		if err != nil {
+			t.Fatal(err)
+		}
+		addrs[i] = "127.0.0.1:" + strconv.Itoa(pc.LocalAddr().(*net.UDPAddr).Port)
+		pc.Close()
+	}
+
+	type result struct {
+		c   *SRTConn
+		err error
+	}
+	ch := make(chan result, 2)
+	d := Dialer{Timeout: someTimeout}
+	for i := range addrs {
+		go func(laddr, raddr string) {
+			c, err := d.DialRendezvous(context.Background(), "srt4", laddr, raddr)
+			ch <- result{c, err}
+		}(addrs[i], addrs[1-i])
+	}
+	var cs []*SRTConn
+	for range addrs {
+		r := <-ch
+		if r.err != nil {
+			if errors.Is(r.err, srtapi.EINVOP) {
+				t.Skip("no rendezvous connections")
+			}
+			t.Fatal(r.err)
+		}
+		defer r.c.Close()
+		cs = append(cs, r.c)
+	}
+
+	if _, err := cs[0].Write([]byte("RENDEZVOUS TEST")); err != nil {
+		t.Fatal(err)
+	}
+	b := make([]byte, 1500)
+	cs[1].SetReadDeadline(time.Now().Add(someTimeout))
+	n, err := cs[1].Read(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(b[:n]) != "RENDEZVOUS TEST" {
+		t.Errorf("got %q", b[:n])
+	}
+}
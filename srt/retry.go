@@ -0,0 +1,116 @@
+// Copyright (c) 2020 CyberAgent, Inc. All rights reserved.
+// https://github.com/openfresh/gosrt
+
+package srt
+
+import (
+	"context"
+	"errors"
+	"math/rand"
+	"net"
+	"time"
+
+	"github.com/openfresh/gosrt/internal/poll/runtime"
+)
+
+// Defaults of the Backoff and MaxBackoff of a RetryPolicy left zero
+const (
+	DefaultRetryBackoff    = 250 * time.Millisecond
+	DefaultRetryMaxBackoff = time.Minute
+)
+
+// DefaultRetryReasons are the reject reasons a RetryPolicy without
+// Reasons retries: those of a listener that is down, restarting or
+// busy for a moment, rather than of a caller it will keep turning
+// down.
+var DefaultRetryReasons = []RejectReason{RejectTimeout, RejectClose, RejectBacklog, RejectResource, RejectXDown}
+
+// A RetryPolicy has a Dialer try again when the handshake of its first
+// connection is rejected, so that a short restart of the listener
+// doesn't fail the dial. It only covers establishing the connection:
+// what to do when an established one fails is up to its user.
+type RetryPolicy struct {
+	// MaxAttempts is the number of attempts, the first included; a
+	// policy of 0 or 1 attempts doesn't retry.
+	MaxAttempts int
+
+	// Backoff is the wait after the first failed attempt, which
+	// doubles after each of the following ones, up to MaxBackoff.
+	Backoff    time.Duration
+	MaxBackoff time.Duration
+
+	// Jitter, between 0 and 1, is the fraction of each wait that is
+	// random, so that callers turned down together don't come back
+	// together.
+	Jitter float64
+
+	// Reasons are the reject reasons that are retried; nil stands for
+	// DefaultRetryReasons. Errors other than a *RejectError, from
+	// resolving the address or from ctx, aren't retried.
+	Reasons []RejectReason
+}
+
+// retryable reports whether the dial that failed with err is to be
+// tried again.
+func (p *RetryPolicy) retryable(err error) bool {
+	var rerr *RejectError
+	if !errors.As(err, &rerr) {
+		return false
+	}
+	reasons := p.Reasons
+	if reasons == nil {
+		reasons = DefaultRetryReasons
+	}
+	for _, r := range reasons {
+		// RejectTimeout is -1 with SRT libraries lacking it.
+		if r == rerr.Reason && r != -1 {
+			return true
+		}
+	}
+	return false
+}
+
+// backoff returns the wait after attempt n failed.
+func (p *RetryPolicy) backoff(n int) time.Duration {
+	d, max := p.Backoff, p.MaxBackoff
+	if d <= 0 {
+		d = DefaultRetryBackoff
+	}
+	if max <= 0 {
+		max = DefaultRetryMaxBackoff
+	}
+	for i := 1; i < n && d < max; i++ {
+		d *= 2
+	}
+	if d > max {
+		d = max
+	}
+	if p.Jitter > 0 {
+		j := p.Jitter
+		if j > 1 {
+			j = 1
+		}
+		d -= time.Duration(j * rand.Float64() * float64(d))
+	}
+	return d
+}
+
+// dial calls dial until it succeeds, fails with an error p doesn't
+// retry, runs out of attempts or ctx is done, and returns the result
+// of the last attempt.
+func (p *RetryPolicy) dial(ctx context.Context, dial func() (net.Conn, error)) (net.Conn, error) {
+	for n := 1; ; n++ {
+		c, err := dial()
+		if err == nil || n >= p.MaxAttempts || !p.retryable(err) {
+			return c, err
+		}
+		wake := make(chan struct{})
+		t := runtime.Clock.AfterFunc(p.backoff(n), func() { close(wake) })
+		select {
+		case <-ctx.Done():
+			t.Stop()
+			return nil, err
+		case <-wake:
+		}
+	}
+}
@@ -0,0 +1,81 @@
+// Copyright (c) 2020 CyberAgent, Inc. All rights reserved.
+// https://github.com/openfresh/gosrt
+
+package srt
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestDialRetry(t *testing.T) {
+	// The first attempts are turned down, and the others succeed
+	// without dialing: a real dial could be rejected as well, and
+	// retried, when the stack is busy with other tests.
+	var rejects []RejectReason
+	attempts := 0
+	defer func(f func(context.Context, string, *SRTAddr, *SRTAddr) (*SRTConn, error)) { testHookDialSRT = f }(testHookDialSRT)
+	testHookDialSRT = func(ctx context.Context, network string, laddr, raddr *SRTAddr) (*SRTConn, error) {
+		attempts++
+		if len(rejects) > 0 {
+			r := rejects[0]
+			rejects = rejects[1:]
+			return nil, &RejectError{Reason: r}
+		}
+		return &SRTConn{}, nil
+	}
+
+	d := Dialer{Retry: &RetryPolicy{MaxAttempts: 3, Backoff: time.Millisecond, Jitter: 0.5}}
+	for _, tt := range []struct {
+		rejects  []RejectReason
+		attempts int
+		ok       bool
+	}{
+		{nil, 1, true},
+		{[]RejectReason{RejectClose, RejectBacklog}, 3, true},
+		{[]RejectReason{RejectClose, RejectClose, RejectClose}, 3, false},
+		{[]RejectReason{RejectBadSecret}, 1, false},
+	} {
+		rejects, attempts = tt.rejects, 0
+		c, err := d.Dial("srt4", "127.0.0.1:9")
+		if (err == nil) != tt.ok || attempts != tt.attempts {
+			t.Errorf("rejects %v: %v after %d attempts; want success %v after %d", tt.rejects, err, attempts, tt.ok, tt.attempts)
+		}
+		var rerr *RejectError
+		if err != nil && !errors.As(err, &rerr) {
+			t.Errorf("rejects %v: %v; want the last RejectError", tt.rejects, err)
+		}
+		if c != nil {
+			c.Close()
+		}
+	}
+
+	// The dial gives up once its context is done.
+	rejects, attempts = []RejectReason{RejectClose, RejectClose}, 0
+	d.Retry = &RetryPolicy{MaxAttempts: 3, Backoff: time.Hour}
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if _, err := d.DialContext(ctx, "srt4", "127.0.0.1:9"); err == nil || attempts != 1 {
+		t.Errorf("%v after %d attempts; want a failure after 1", err, attempts)
+	}
+}
+
+func TestRetryBackoff(t *testing.T) {
+	p := &RetryPolicy{Backoff: 100 * time.Millisecond, MaxBackoff: time.Second}
+	for i, want := range []time.Duration{100 * time.Millisecond, 200 * time.Millisecond, 400 * time.Millisecond, 800 * time.Millisecond, time.Second, time.Second} {
+		if got := p.backoff(i + 1); got != want {
+			t.Errorf("backoff(%d) = %v; want %v", i+1, got, want)
+		}
+	}
+	p.Jitter = 0.5
+	for i := 0; i < 100; i++ {
+		if got := p.backoff(2); got < 100*time.Millisecond || got > 200*time.Millisecond {
+			t.Fatalf("backoff(2) with jitter = %v; want within 100ms-200ms", got)
+		}
+	}
+	if got := (&RetryPolicy{}).backoff(100); got != DefaultRetryMaxBackoff {
+		t.Errorf("default backoff(100) = %v; want %v", got, DefaultRetryMaxBackoff)
+	}
+}
@@ -0,0 +1,136 @@
+// Copyright (c) 2020 CyberAgent, Inc. All rights reserved.
+// https://github.com/openfresh/gosrt
+
+package srt
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/openfresh/gosrt/internal/poll/runtime"
+	"github.com/openfresh/gosrt/srtapi"
+)
+
+// A ShapedWriter writes to a connection at no more than a rate, which
+// can change as the connection goes, so that a relay can hold each
+// tenant to a cap: unlike the maxbw option, which libsrt applies to
+// the packets it sends, retransmissions included, the rate counts the
+// bytes written, and SetRate takes effect at the next write without
+// touching the socket.
+//
+// The rate is kept with a token bucket: writes take tokens, which come
+// back at the rate, up to the burst. A message larger than the burst
+// waits for a full bucket, and leaves it in debt.
+type ShapedWriter struct {
+	c *SRTConn
+
+	mu     sync.Mutex
+	rate   int64
+	burst  int
+	tokens float64
+	last   time.Time
+	set    chan struct{} // closed by SetRate
+}
+
+// NewShapedWriter returns a ShapedWriter writing to c at rate bytes
+// per second, 0 for no limit, in bursts of up to burst bytes, or of the
+// bytes of 20ms at the rate if burst is 0.
+func NewShapedWriter(c *SRTConn, rate int64, burst int) *ShapedWriter {
+	w := &ShapedWriter{c: c, rate: rate, burst: burst, last: runtime.Clock.Now(), set: make(chan struct{})}
+	w.tokens = float64(w.size())
+	return w
+}
+
+// size returns the size of the bucket. w.mu must be held.
+func (w *ShapedWriter) size() int {
+	if w.burst > 0 {
+		return w.burst
+	}
+	return int(w.rate / 50)
+}
+
+// SetRate sets the rate to rate bytes per second, 0 for no limit.
+// Writes waiting for tokens go on at the new rate.
+func (w *ShapedWriter) SetRate(rate int64) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.refill(runtime.Clock.Now())
+	w.rate = rate
+	if size := float64(w.size()); w.tokens > size {
+		w.tokens = size
+	}
+	close(w.set)
+	w.set = make(chan struct{})
+}
+
+// Rate returns the rate in bytes per second, 0 for no limit.
+func (w *ShapedWriter) Rate() int64 {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.rate
+}
+
+// refill adds the tokens earned since the last refill. w.mu must be
+// held.
+func (w *ShapedWriter) refill(now time.Time) {
+	if d := now.Sub(w.last); d > 0 {
+		w.tokens += float64(w.rate) * d.Seconds()
+		if size := float64(w.size()); w.tokens > size {
+			w.tokens = size
+		}
+	}
+	w.last = now
+}
+
+// Write waits for the tokens of b, then writes it. The write deadline
+// of the connection applies to the write itself.
+func (w *ShapedWriter) Write(b []byte) (int, error) {
+	return w.WriteContext(context.Background(), b)
+}
+
+// WriteContext is like Write, but stops waiting once ctx is done.
+func (w *ShapedWriter) WriteContext(ctx context.Context, b []byte) (int, error) {
+	if !w.c.ok() {
+		return 0, srtapi.EINVPARAM
+	}
+	if err := w.take(ctx, len(b)); err != nil {
+		return 0, &OpError{Op: "write", Net: w.c.fd.net, Source: w.c.fd.laddr, Addr: w.c.fd.raddr, Err: err}
+	}
+	return w.c.WriteContext(ctx, b)
+}
+
+// take waits for the tokens of n bytes, and takes them.
+func (w *ShapedWriter) take(ctx context.Context, n int) error {
+	for {
+		w.mu.Lock()
+		if w.rate <= 0 {
+			w.mu.Unlock()
+			return nil
+		}
+		w.refill(runtime.Clock.Now())
+		need := float64(n)
+		if size := float64(w.size()); need > size {
+			need = size
+		}
+		if w.tokens >= need {
+			w.tokens -= float64(n)
+			w.mu.Unlock()
+			return nil
+		}
+		wait := time.Duration((need - w.tokens) / float64(w.rate) * float64(time.Second))
+		set := w.set
+		w.mu.Unlock()
+
+		wake := make(chan struct{})
+		t := runtime.Clock.AfterFunc(wait, func() { close(wake) })
+		select {
+		case <-ctx.Done():
+			t.Stop()
+			return mapErr(ctx.Err())
+		case <-set:
+			t.Stop()
+		case <-wake:
+		}
+	}
+}
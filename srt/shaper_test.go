@@ -0,0 +1,67 @@
+// Copyright (c) 2020 CyberAgent, Inc. All rights reserved.
+// https://github.com/openfresh/gosrt
+
+package srt
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestShapedWriter(t *testing.T) {
+	c1, c2, err := Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c1.Close()
+	defer c2.Close()
+	go func() {
+		b := make([]byte, 1500)
+		for {
+			if _, err := c2.Read(b); err != nil {
+				return
+			}
+		}
+	}()
+
+	// A full bucket of 10000 bytes, then 20000 bytes at 100000 bytes
+	// per second.
+	w := NewShapedWriter(c1, 100000, 10000)
+	msg := make([]byte, 1000)
+	start := time.Now()
+	for i := 0; i < 30; i++ {
+		if _, err := w.Write(msg); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if d := time.Since(start); d < 150*time.Millisecond || d > 2*time.Second {
+		t.Errorf("wrote 30000 bytes in %v; want about 200ms", d)
+	}
+
+	// A write waiting for tokens goes on once the limit is lifted.
+	w.SetRate(1)
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if _, err := w.WriteContext(ctx, msg); err == nil || !err.(*OpError).Timeout() {
+		t.Errorf("got %v at 1 byte per second; want a timeout", err)
+	}
+	done := make(chan error, 1)
+	go func() {
+		_, err := w.Write(msg)
+		done <- err
+	}()
+	time.Sleep(10 * time.Millisecond)
+	w.SetRate(0)
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Error(err)
+		}
+	case <-time.After(someTimeout):
+		t.Fatal("write still waiting without a limit")
+	}
+	if w.Rate() != 0 {
+		t.Errorf("Rate() = %d; want 0", w.Rate())
+	}
+}
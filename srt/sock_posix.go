@@ -45,7 +45,13 @@ type sockaddr interface {
 
 // socket returns a network file descriptor
 func socket(ctx context.Context, net string, family, sotype, proto int, ipv6only bool, laddr, raddr sockaddr) (fd *netFD, err error) {
-	s, err := srtSocket()
+	gd := groupDialValue(ctx)
+	var s int
+	if gd != nil {
+		s, err = groupSocket(gd.typ)
+	} else {
+		s, err = srtSocket()
+	}
 	if err != nil {
 		return nil, err
 	}
@@ -58,21 +64,56 @@ func socket(ctx context.Context, net string, family, sotype, proto int, ipv6only
 		poll.CloseFunc(s)
 		return nil, err
 	}
+	fd.group = gd
+	fd.setLabels(ctx)
+
+	// A socket bound to the UDP socket of ListenPacket or DialPacket
+	// is not bound again.
+	bindAddr := laddr
+	if pc := packetConnValue(ctx); pc != nil {
+		if err := fd.bindAcquire(pc); err != nil {
+			fd.Close()
+			return nil, err
+		}
+		bindAddr = nil
+	}
 
 	if laddr != nil && raddr == nil {
-		if err := fd.listen(laddr, listenerBacklog); err != nil {
+		if err := fd.listen(bindAddr, listenerBacklog); err != nil {
 			fd.Close()
 			return nil, err
 		}
-		if callback := listenCallbackValue(ctx); callback != nil {
+		callback := listenCallbackValue(ctx)
+		if hs := hooksValue(ctx); hs.handshakes() {
+			callback = hooksCallback(ctx, callback, hs)
+		}
+		if fn := acceptOptionsValue(ctx); fn != nil {
+			callback = acceptOptionsCallback(ctx, callback, fn)
+		}
+		if fn := passphraseFuncValue(ctx); fn != nil {
+			callback = passphraseCallback(ctx, callback, fn)
+		}
+		if policy := encryptionPolicyValue(ctx); policy != nil && policy.encrypts() {
+			callback = encryptionCallback(callback, policy)
+		}
+		// The callback is installed once there is something for it to
+		// do, and otherwise by SetAcceptHook.
+		install := callback != nil
+		callback = fd.acceptHookCallback(callback)
+		if audit := auditValue(ctx); audit != nil {
+			callback = fd.auditListenCallback(callback, audit)
+		}
+		fd.listenCb = callback
+		if install {
 			if err := fd.listenCallback(callback); err != nil {
 				fd.Close()
 				return nil, err
 			}
+			fd.listenInstalled = true
 		}
 		return fd, nil
 	}
-	if err := fd.dial(ctx, laddr, raddr); err != nil {
+	if err := fd.dial(ctx, bindAddr, raddr); err != nil {
 		fd.Close()
 		return nil, err
 	}
@@ -105,7 +146,17 @@ func (fd *netFD) dial(ctx context.Context, laddr, raddr sockaddr) error {
 		if rsa, err = raddr.sockaddr(fd.family); err != nil {
 			return err
 		}
+		if err := fd.dialPassphrase(ctx, raddr); err != nil {
+			return err
+		}
+		if hs := hooksValue(ctx); hs.handshakes() {
+			streamID, _ := srtapi.GetsockflagString(fd.pfd.Sysfd, srtapi.OptionStreamid)
+			if err := hs.beforeHandshake(ctx, "dial", raddr, streamID); err != nil {
+				return err
+			}
+		}
 		if crsa, err = fd.connect(ctx, lsa, rsa); err != nil {
+			fd.auditDial(ctx, raddr, err)
 			return err
 		}
 		fd.isConnected = true
@@ -139,6 +190,9 @@ func (fd *netFD) dial(ctx context.Context, laddr, raddr sockaddr) error {
 	} else {
 		fd.setAddr(fd.addrFunc()(lsa), raddr)
 	}
+	if fd.isConnected {
+		fd.auditDial(ctx, fd.raddr, nil)
+	}
 	return nil
 }
 
@@ -146,11 +200,13 @@ func (fd *netFD) listen(laddr sockaddr, backlog int) error {
 	if err := setDefaultListenerSockopts(fd.pfd.Sysfd); err != nil {
 		return err
 	}
-	if lsa, err := laddr.sockaddr(fd.family); err != nil {
-		return err
-	} else if lsa != nil {
-		if err := srtapi.Bind(fd.pfd.Sysfd, lsa); err != nil {
-			return os.NewSyscallError("bind", err)
+	if laddr != nil {
+		if lsa, err := laddr.sockaddr(fd.family); err != nil {
+			return err
+		} else if lsa != nil {
+			if err := srtapi.Bind(fd.pfd.Sysfd, lsa); err != nil {
+				return os.NewSyscallError("bind", err)
+			}
 		}
 	}
 	if err := listenFunc(fd.pfd.Sysfd, backlog); err != nil {
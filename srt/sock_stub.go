@@ -6,7 +6,7 @@
 // license that can be found in the LICENSE file.
 // https://github.com/golang/go
 
-// +build nacl solaris
+// +build nacl solaris windows
 
 package srt
 
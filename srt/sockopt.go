@@ -5,7 +5,9 @@ package srt
 
 import (
 	"context"
+	"errors"
 	"strconv"
+	"time"
 
 	"github.com/openfresh/gosrt/srtapi"
 )
@@ -17,9 +19,15 @@ const (
 	typeBool
 )
 
+// Options of bindPre are set before connecting, and only apply to the
+// handshake. Those of bindPost, which libsrt lets change at any time,
+// are set once connected, and SetOption changes them. Those of bindAny
+// are set before connecting, for the connection to start with them,
+// and SetOption changes them too.
 const (
 	bindPre = 0 + iota
 	bindPost
+	bindAny
 )
 
 type socketOption struct {
@@ -64,7 +72,7 @@ func (o *socketOption) extract(v string) (ov interface{}, err error) {
 
 var srtOptions = []socketOption{
 	{"transtype", 0, srtapi.OptionTranstype, bindPre, typeInt},
-	{"maxbw", 0, srtapi.OptionMaxbw, bindPre, typeInt64},
+	{"maxbw", 0, srtapi.OptionMaxbw, bindAny, typeInt64},
 	{"pbkeylen", 0, srtapi.OptionPbkeylen, bindPre, typeInt},
 	{"passphrase", 0, srtapi.OptionPassphrase, bindPre, typeString},
 
@@ -82,7 +90,8 @@ var srtOptions = []socketOption{
 	{"snddropdelay", 0, srtapi.OptionSnddropdelay, bindPost, typeInt},
 	{"nakreport", 0, srtapi.OptionNakreport, bindPre, typeBool},
 	{"conntimeo", 0, srtapi.OptionConntimeo, bindPre, typeInt},
-	{"lossmaxttl", 0, srtapi.OptionLossmaxttl, bindPre, typeInt},
+	{"rendezvous", 0, srtapi.OptionRendezvous, bindPre, typeBool},
+	{"lossmaxttl", 0, srtapi.OptionLossmaxttl, bindAny, typeInt},
 	{"rcvlatency", 0, srtapi.OptionRcvlatency, bindPre, typeInt},
 	{"peerlatency", 0, srtapi.OptionPeerlatency, bindPre, typeInt},
 	{"minversion", 0, srtapi.OptionMinversion, bindPre, typeInt},
@@ -95,6 +104,10 @@ var srtOptions = []socketOption{
 	{"enforcedencryption", 0, srtapi.OptionEnforcedencryption, bindPre, typeBool},
 	{"peeridletimeo", 0, srtapi.OptionPeeridletimeo, bindPre, typeInt},
 	{"packetfilter", 0, srtapi.OptionPacketfilter, bindPre, typeString},
+	{"retransmitalgo", 0, srtapi.OptionRetransmitalgo, bindPre, typeInt},
+	{"bindtodevice", 0, srtapi.OptionBindtodevice, bindPre, typeString},
+	{"cryptomode", 0, srtapi.OptionCryptomode, bindPre, typeInt},
+	{"groupconnect", 0, srtapi.OptionGroupconnect, bindPre, typeInt},
 }
 
 type option struct {
@@ -150,6 +163,16 @@ func Options(args ...string) OptionSet {
 	return options
 }
 
+// StreamOptions returns the options of stream mode: file transmission
+// with the message API off, so that connections carry a byte stream
+// that writes and reads of any size split anywhere, as net.Conn users
+// such as net/http and gRPC expect. Stream mode needs libsrt: the pure
+// Go implementation of the nosrtlib build ignores these options, like
+// any it doesn't support, and stays in live mode.
+func StreamOptions() OptionSet {
+	return Options("transtype", strconv.Itoa(srtapi.TypeFile), "messageapi", "false")
+}
+
 // Option returns the value of the option with the given key on ctx, and a boolean indicating
 // whether that option exists.
 func Option(ctx context.Context, key string) (string, bool) {
@@ -158,16 +181,174 @@ func Option(ctx context.Context, key string) (string, bool) {
 	return v, ok
 }
 
-func configure(ctx context.Context, s int, binding int) error {
+// ErrUnknownOption is the error of CheckOption for a key that isn't
+// an option name.
+var ErrUnknownOption = errors.New("unknown option")
+
+// ErrOptionBound is the error, wrapped in an OpError, of SetOption for
+// an option that can only be set before connecting.
+var ErrOptionBound = errors.New("option only settable before connecting")
+
+func lookupOption(key string) *socketOption {
+	for i := range srtOptions {
+		if srtOptions[i].name == key {
+			return &srtOptions[i]
+		}
+	}
+	return nil
+}
+
+// CheckOption reports whether value is a valid value of the option
+// with the given key, for configurations to be checked before they
+// are used. It fails with ErrUnknownOption for a key that isn't an
+// option name, and with the strconv error for a value of the wrong
+// type; it doesn't check ranges, which libsrt does when connecting.
+func CheckOption(key, value string) error {
+	if o := lookupOption(key); o != nil {
+		_, err := o.extract(value)
+		return err
+	}
+	return ErrUnknownOption
+}
+
+// SetOption sets the option of the connection with the given key to
+// value, given as WithOptions takes it. Most options only apply to the
+// handshake, and are set with WithOptions before connecting: those
+// fail with ErrOptionBound, keys that aren't option names with
+// ErrUnknownOption. The options libsrt lets change on a connection
+// are maxbw, inputbw, oheadbw, snddropdelay and lossmaxttl; for the
+// bandwidths, SetMaxBandwidth and SetInputBandwidth also check that
+// the library took the value.
+func (c *conn) SetOption(key, value string) error {
+	if !c.ok() {
+		return srtapi.EINVPARAM
+	}
+	o := lookupOption(key)
+	var err error
+	switch {
+	case o == nil:
+		err = ErrUnknownOption
+	case o.binding == bindPre:
+		err = ErrOptionBound
+	default:
+		err = o.apply(c.fd.pfd.Sysfd, value)
+	}
+	if err != nil {
+		return &OpError{Op: "set", Net: c.fd.net, Source: nil, Addr: c.fd.laddr, Err: err}
+	}
+	return nil
+}
+
+// GetOption returns the value of the option of the connection with the
+// given key, formatted as WithOptions takes it. libsrt doesn't give
+// the passphrase back.
+func (c *conn) GetOption(key string) (string, error) {
+	if !c.ok() {
+		return "", srtapi.EINVPARAM
+	}
+	v, err := getOption(c.fd.pfd.Sysfd, key)
+	if err != nil {
+		return "", &OpError{Op: "get", Net: c.fd.net, Source: nil, Addr: c.fd.laddr, Err: err}
+	}
+	return v, nil
+}
+
+func getOption(s int, key string) (string, error) {
+	o := lookupOption(key)
+	if o == nil {
+		return "", ErrUnknownOption
+	}
+	switch o.typ {
+	case typeString:
+		return srtapi.GetsockflagString(s, o.sym)
+	case typeInt64:
+		v, err := srtapi.GetsockflagInt64(s, o.sym)
+		return strconv.FormatInt(v, 10), err
+	}
+	v, err := srtapi.GetsockflagInt(s, o.sym)
+	if o.typ == typeBool {
+		return strconv.FormatBool(v != 0), err
+	}
+	return strconv.Itoa(v), err
+}
+
+// A SocketOptions is the options most deployments set, typed, for
+// WithOptions to take through OptionSet. Fields left zero are left
+// unset, to the defaults of libsrt or to other options of the context.
+type SocketOptions struct {
+	// Latency sets the latency of both directions, RecvLatency and
+	// PeerLatency those of receiving and of the peer receiving. The
+	// durations of the options are rounded down to milliseconds.
+	Latency, RecvLatency, PeerLatency time.Duration
+
+	StreamID   string
+	Passphrase string
+
+	// TransType is srtapi.TypeFile for file mode, or the default,
+	// srtapi.TypeLive, 0.
+	TransType int
+
+	// MaxBandwidth is in bytes per second, as SetMaxBandwidth takes it.
+	MaxBandwidth int64
+
+	MSS int
+
+	// TooLatePacketDrop, if set, turns the "tlpktdrop" option on or
+	// off.
+	TooLatePacketDrop *bool
+
+	ConnTimeout     time.Duration
+	PeerIdleTimeout time.Duration
+}
+
+// OptionSet returns the options of o.
+func (o SocketOptions) OptionSet() OptionSet {
+	var args []string
+	ms := func(key string, d time.Duration) {
+		if d != 0 {
+			args = append(args, key, strconv.FormatInt(int64(d/time.Millisecond), 10))
+		}
+	}
+	str := func(key, v string) {
+		if v != "" {
+			args = append(args, key, v)
+		}
+	}
+	ms("latency", o.Latency)
+	ms("rcvlatency", o.RecvLatency)
+	ms("peerlatency", o.PeerLatency)
+	str("streamid", o.StreamID)
+	str("passphrase", o.Passphrase)
+	if o.TransType != 0 {
+		args = append(args, "transtype", strconv.Itoa(o.TransType))
+	}
+	if o.MaxBandwidth != 0 {
+		args = append(args, "maxbw", strconv.FormatInt(o.MaxBandwidth, 10))
+	}
+	if o.MSS != 0 {
+		args = append(args, "mss", strconv.Itoa(o.MSS))
+	}
+	if o.TooLatePacketDrop != nil {
+		args = append(args, "tlpktdrop", strconv.FormatBool(*o.TooLatePacketDrop))
+	}
+	ms("conntimeo", o.ConnTimeout)
+	ms("peeridletimeo", o.PeerIdleTimeout)
+	return Options(args...)
+}
+
+// configure sets the options of ctx with the given binding on s. An
+// option s refuses doesn't keep the others from being set; the first
+// error is returned.
+func configure(ctx context.Context, s int, binding int) (err error) {
 	ctxOptions := optionValue(ctx)
 	for _, o := range srtOptions {
-		if o.binding == binding {
+		if o.binding == binding || o.binding == bindAny && binding == bindPre {
 			if v, ok := ctxOptions[o.name]; ok {
-				if err := o.apply(s, v); err != nil {
-					return err
+				if e := o.apply(s, v); e != nil && err == nil {
+					err = e
 				}
 			}
 		}
 	}
-	return nil
+	return err
 }
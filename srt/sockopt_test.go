@@ -0,0 +1,95 @@
+// Copyright (c) 2020 CyberAgent, Inc. All rights reserved.
+// https://github.com/openfresh/gosrt
+
+package srt
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/openfresh/gosrt/srtapi"
+)
+
+func TestSetOption(t *testing.T) {
+	c1, c2, err := Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c1.Close()
+	defer c2.Close()
+
+	for _, tt := range []struct{ key, value string }{
+		{"maxbw", "1000000"},
+		{"inputbw", "500000"},
+		{"oheadbw", "50"},
+		{"snddropdelay", "100"},
+		{"lossmaxttl", "4"},
+	} {
+		if err := c1.SetOption(tt.key, tt.value); err != nil {
+			t.Fatalf("SetOption(%s, %s): %v", tt.key, tt.value, err)
+		}
+		if v, err := c1.GetOption(tt.key); err != nil || v != tt.value {
+			t.Errorf("GetOption(%s) = %q, %v; want %q", tt.key, v, err, tt.value)
+		}
+	}
+	for _, o := range srtOptions {
+		if o.binding == bindPre {
+			if err := c1.SetOption(o.name, "1"); !errors.Is(err, ErrOptionBound) {
+				t.Errorf("got %v setting %s once connected; want ErrOptionBound", err, o.name)
+			}
+		}
+	}
+	if err := c1.SetOption("nosuchoption", "1"); !errors.Is(err, ErrUnknownOption) {
+		t.Errorf("got %v for an unknown option; want ErrUnknownOption", err)
+	}
+	if _, err := c1.GetOption("nosuchoption"); !errors.Is(err, ErrUnknownOption) {
+		t.Errorf("got %v getting an unknown option; want ErrUnknownOption", err)
+	}
+	if err := c1.SetOption("maxbw", "fast"); err == nil {
+		t.Error("SetOption(maxbw, fast) succeeded")
+	}
+	if v, err := c1.GetOption("tlpktdrop"); err != nil || (v != "true" && v != "false") {
+		t.Errorf("GetOption(tlpktdrop) = %q, %v; want a bool", v, err)
+	}
+}
+
+func TestSocketOptions(t *testing.T) {
+	drop := false
+	o := SocketOptions{
+		Latency:           120 * time.Millisecond,
+		PeerLatency:       time.Second,
+		StreamID:          "#!::r=live/feed",
+		TransType:         srtapi.TypeFile,
+		MaxBandwidth:      1 << 20,
+		TooLatePacketDrop: &drop,
+		ConnTimeout:       1500 * time.Millisecond,
+	}
+	ctx := WithOptions(context.Background(), o.OptionSet())
+	got := map[string]string{}
+	for _, key := range []string{"latency", "rcvlatency", "peerlatency", "streamid", "passphrase", "transtype", "maxbw", "mss", "tlpktdrop", "conntimeo"} {
+		if v, ok := Option(ctx, key); ok {
+			got[key] = v
+			if err := CheckOption(key, v); err != nil {
+				t.Errorf("option %s=%s: %v", key, v, err)
+			}
+		}
+	}
+	want := map[string]string{
+		"latency":     "120",
+		"peerlatency": "1000",
+		"streamid":    "#!::r=live/feed",
+		"transtype":   "1",
+		"maxbw":       "1048576",
+		"tlpktdrop":   "false",
+		"conntimeo":   "1500",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got options %v; want %v", got, want)
+	}
+	if n := len(SocketOptions{}.OptionSet().list); n != 0 {
+		t.Errorf("got %d options of zero SocketOptions", n)
+	}
+}
@@ -0,0 +1,205 @@
+// Copyright (c) 2020 CyberAgent, Inc. All rights reserved.
+// https://github.com/openfresh/gosrt
+
+package srt
+
+import (
+	"context"
+	"io"
+	"net"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/openfresh/gosrt/srtapi"
+)
+
+// spliceBatchLen is the number of messages Splice moves per read.
+const spliceBatchLen = 16
+
+// A spliceBatch holds the messages of a read, in buffers of a size of
+// its pool.
+type spliceBatch struct {
+	bufs [][]byte
+	n    []int
+}
+
+// The pools of batches of MTU-sized buffers, for SRT connections in
+// live mode, and of 64KiB ones, for those of larger messages.
+var (
+	spliceSmallPool = sync.Pool{New: func() interface{} { return newSpliceBatch(1500) }}
+	spliceLargePool = sync.Pool{New: func() interface{} { return newSpliceBatch(64 << 10) }}
+)
+
+func newSpliceBatch(size int) *spliceBatch {
+	b := &spliceBatch{bufs: make([][]byte, spliceBatchLen), n: make([]int, spliceBatchLen)}
+	for i := range b.bufs {
+		b.bufs[i] = make([]byte, size)
+	}
+	return b
+}
+
+// Splice relays messages between the SRT connection c and the UDP
+// socket pc, each message of c going out as a datagram of pc and each
+// datagram of pc as a message of c, until ctx is done, c is closed by
+// its peer or either side fails. It returns nil when c reached EOF.
+//
+// The messages are moved in batches: those c has buffered are read
+// with one wait on the poller, and on Linux the datagrams of pc are
+// read and written with recvmmsg and sendmmsg, which takes the per
+// packet overhead of io.Copy out of a bridge. If pc isn't connected,
+// the messages of c go to the source of the last datagram instead, a
+// datagram at a time, and are dropped until one came.
+//
+// A datagram the peer of a connected pc refuses is dropped. Splice
+// interrupts its reads and writes with the deadlines of c and pc,
+// which it clears on return. It closes neither, and neither must be
+// read from meanwhile.
+func Splice(ctx context.Context, c *SRTConn, pc *net.UDPConn) error {
+	if !c.ok() {
+		return srtapi.EINVPARAM
+	}
+	pool := &spliceSmallPool
+	if l := c.fd.payloadLimit(); l == 0 || l > 1500 {
+		pool = &spliceLargePool
+	}
+	s := &splicer{c: c, pc: pc, connected: pc.RemoteAddr() != nil}
+
+	errc := make(chan error, 2)
+	for _, f := range []func(*spliceBatch) error{s.toUDP, s.toSRT} {
+		go func(f func(*spliceBatch) error) {
+			b := pool.Get().(*spliceBatch)
+			defer pool.Put(b)
+			errc <- f(b)
+		}(f)
+	}
+	var err error
+	pending := 2
+	select {
+	case <-ctx.Done():
+		err = ctx.Err()
+	case err = <-errc:
+		pending--
+	}
+	c.SetDeadline(aLongTimeAgo)
+	pc.SetDeadline(aLongTimeAgo)
+	for ; pending > 0; pending-- {
+		<-errc
+	}
+	c.SetDeadline(noDeadline)
+	pc.SetDeadline(noDeadline)
+	if err == io.EOF {
+		err = nil
+	}
+	return err
+}
+
+// A splicer is the state of a Splice.
+type splicer struct {
+	c         *SRTConn
+	pc        *net.UDPConn
+	connected bool
+	peer      atomic.Value // *net.UDPAddr, of the last datagram if !connected
+}
+
+// toUDP relays the messages of s.c to s.pc.
+func (s *splicer) toUDP(b *spliceBatch) error {
+	for {
+		n, rerr := s.c.fd.readBatch(b)
+		if rerr != nil && rerr != io.EOF {
+			rerr = &OpError{Op: "read", Net: s.c.fd.net, Source: s.c.fd.laddr, Addr: s.c.fd.raddr, Err: rerr}
+		}
+		if n > 0 {
+			if err := s.writeUDP(b, n); err != nil {
+				return err
+			}
+		}
+		if rerr != nil {
+			return rerr
+		}
+	}
+}
+
+// toSRT relays the datagrams of s.pc to s.c.
+func (s *splicer) toSRT(b *spliceBatch) error {
+	for {
+		n, rerr := s.readUDP(b)
+		for i := 0; i < n; i++ {
+			if _, err := s.c.Write(b.bufs[i][:b.n[i]]); err != nil {
+				return err
+			}
+		}
+		if rerr != nil {
+			return rerr
+		}
+	}
+}
+
+func (s *splicer) readUDP(b *spliceBatch) (int, error) {
+	if s.connected {
+		return readUDPBatch(s.pc, b)
+	}
+	n, addr, err := s.pc.ReadFromUDP(b.bufs[0])
+	if err != nil {
+		return 0, err
+	}
+	s.peer.Store(addr)
+	b.n[0] = n
+	return 1, nil
+}
+
+func (s *splicer) writeUDP(b *spliceBatch, n int) error {
+	if s.connected {
+		return writeUDPBatch(s.pc, b, n)
+	}
+	addr, _ := s.peer.Load().(*net.UDPAddr)
+	if addr == nil {
+		return nil
+	}
+	for i := 0; i < n; i++ {
+		if _, err := s.pc.WriteToUDP(b.bufs[i][:b.n[i]], addr); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// readBatch reads into b the messages fd has buffered, waiting for one
+// if there is none. It returns the messages read before an error along
+// with it.
+func (fd *netFD) readBatch(b *spliceBatch) (int, error) {
+	if atomic.LoadInt32(&fd.npeeked) > 0 {
+		n, err := fd.read(b.bufs[0])
+		if err != nil {
+			return 0, err
+		}
+		b.n[0] = n
+		return 1, nil
+	}
+	n := 0
+	var rerr error
+	err := fd.pfd.RawRead(func(s int) bool {
+		for n < len(b.bufs) {
+			m, err := fd.readRaw(s, b.bufs[n])
+			if err == srtapi.EASYNCRCV {
+				return n > 0
+			}
+			if err != nil {
+				rerr = wrapSyscallError("read", err)
+				return true
+			}
+			if m == 0 {
+				rerr = io.EOF
+				return true
+			}
+			b.n[n] = m
+			fd.tap(TapInbound, b.bufs[n][:m], time.Time{}, 0)
+			n++
+		}
+		return true
+	})
+	if rerr == nil {
+		rerr = err
+	}
+	return n, rerr
+}
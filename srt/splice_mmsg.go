@@ -0,0 +1,114 @@
+// Copyright (c) 2020 CyberAgent, Inc. All rights reserved.
+// https://github.com/openfresh/gosrt
+
+// +build linux,amd64 linux,arm64
+
+package srt
+
+import (
+	"net"
+	"os"
+	"syscall"
+	"unsafe"
+)
+
+// mmsghdr is struct mmsghdr of recvmmsg and sendmmsg.
+type mmsghdr struct {
+	hdr syscall.Msghdr
+	len uint32
+}
+
+// mmsgBatch returns the headers of the first n buffers of b, of their
+// length if write is set.
+func mmsgBatch(b *spliceBatch, n int, write bool) []mmsghdr {
+	hs := make([]mmsghdr, n)
+	iovs := make([]syscall.Iovec, n)
+	for i := range hs {
+		buf := b.bufs[i]
+		if write {
+			buf = buf[:b.n[i]]
+		}
+		if len(buf) > 0 {
+			iovs[i].Base = &buf[0]
+		}
+		iovs[i].SetLen(len(buf))
+		hs[i].hdr.Iov = &iovs[i]
+		hs[i].hdr.Iovlen = 1
+	}
+	return hs
+}
+
+// readUDPBatch reads into b the datagrams pc has buffered with
+// recvmmsg, waiting for one if there is none. It reads none when the
+// peer of pc refused a datagram.
+func readUDPBatch(pc *net.UDPConn, b *spliceBatch) (int, error) {
+	rc, err := pc.SyscallConn()
+	if err != nil {
+		return 0, err
+	}
+	hs := mmsgBatch(b, len(b.bufs), false)
+	n := 0
+	var serr error
+	err = rc.Read(func(fd uintptr) bool {
+		r, _, e := syscall.Syscall6(sysRECVMMSG, fd, uintptr(unsafe.Pointer(&hs[0])), uintptr(len(hs)), 0, 0, 0)
+		if e == syscall.EAGAIN {
+			return false
+		}
+		switch e {
+		case 0:
+			n = int(r)
+		case syscall.ECONNREFUSED:
+			// Nothing read: r is -1.
+		default:
+			serr = os.NewSyscallError("recvmmsg", e)
+		}
+		return true
+	})
+	if err == nil {
+		err = serr
+	}
+	if err != nil {
+		return 0, &net.OpError{Op: "read", Net: "udp", Source: pc.LocalAddr(), Addr: pc.RemoteAddr(), Err: err}
+	}
+	for i := 0; i < n; i++ {
+		b.n[i] = int(hs[i].len)
+	}
+	return n, nil
+}
+
+// writeUDPBatch writes the first n messages of b to pc with sendmmsg,
+// dropping those the peer refuses.
+func writeUDPBatch(pc *net.UDPConn, b *spliceBatch, n int) error {
+	rc, err := pc.SyscallConn()
+	if err != nil {
+		return err
+	}
+	hs := mmsgBatch(b, n, true)
+	sent := 0
+	var serr error
+	err = rc.Write(func(fd uintptr) bool {
+		for sent < len(hs) {
+			r, _, e := syscall.Syscall6(sysSENDMMSG, fd, uintptr(unsafe.Pointer(&hs[sent])), uintptr(len(hs)-sent), 0, 0, 0)
+			if e == syscall.EAGAIN {
+				return false
+			}
+			if e == syscall.ECONNREFUSED {
+				// Nobody listens on the peer for now.
+				return true
+			}
+			if e != 0 {
+				serr = os.NewSyscallError("sendmmsg", e)
+				return true
+			}
+			sent += int(r)
+		}
+		return true
+	})
+	if err == nil {
+		err = serr
+	}
+	if err != nil {
+		return &net.OpError{Op: "write", Net: "udp", Source: pc.LocalAddr(), Addr: pc.RemoteAddr(), Err: err}
+	}
+	return nil
+}
@@ -0,0 +1,10 @@
+// Copyright (c) 2020 CyberAgent, Inc. All rights reserved.
+// https://github.com/openfresh/gosrt
+
+package srt
+
+// The syscall package lacks SYS_SENDMMSG on amd64.
+const (
+	sysRECVMMSG = 299
+	sysSENDMMSG = 307
+)
@@ -0,0 +1,9 @@
+// Copyright (c) 2020 CyberAgent, Inc. All rights reserved.
+// https://github.com/openfresh/gosrt
+
+package srt
+
+const (
+	sysRECVMMSG = 243
+	sysSENDMMSG = 269
+)
@@ -0,0 +1,37 @@
+// Copyright (c) 2020 CyberAgent, Inc. All rights reserved.
+// https://github.com/openfresh/gosrt
+
+// +build !linux linux,!amd64,!arm64
+
+package srt
+
+import (
+	"errors"
+	"net"
+	"syscall"
+)
+
+// readUDPBatch reads a datagram of pc into b, none when the peer of pc
+// refused a datagram: there is no recvmmsg here.
+func readUDPBatch(pc *net.UDPConn, b *spliceBatch) (int, error) {
+	n, err := pc.Read(b.bufs[0])
+	if errors.Is(err, syscall.ECONNREFUSED) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	b.n[0] = n
+	return 1, nil
+}
+
+// writeUDPBatch writes the first n messages of b to pc, one at a time,
+// dropping those the peer refuses.
+func writeUDPBatch(pc *net.UDPConn, b *spliceBatch, n int) error {
+	for i := 0; i < n; i++ {
+		if _, err := pc.Write(b.bufs[i][:b.n[i]]); err != nil && !errors.Is(err, syscall.ECONNREFUSED) {
+			return err
+		}
+	}
+	return nil
+}
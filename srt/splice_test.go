@@ -0,0 +1,102 @@
+// Copyright (c) 2020 CyberAgent, Inc. All rights reserved.
+// https://github.com/openfresh/gosrt
+
+package srt
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"testing"
+	"time"
+)
+
+func TestSplice(t *testing.T) {
+	for _, connected := range []bool{true, false} {
+		t.Run(fmt.Sprintf("connected=%v", connected), func(t *testing.T) {
+			testSplice(t, connected)
+		})
+	}
+}
+
+func testSplice(t *testing.T, connected bool) {
+	c1, c2, err := Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c1.Close()
+	defer c2.Close()
+	peer, err := net.ListenUDP("udp4", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer peer.Close()
+	var pc *net.UDPConn
+	if connected {
+		pc, err = net.DialUDP("udp4", nil, peer.LocalAddr().(*net.UDPAddr))
+	} else {
+		pc, err = net.ListenUDP("udp4", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pc.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() { done <- Splice(ctx, c1, pc) }()
+
+	// A burst of datagrams comes out of the SRT connection in order.
+	for i := 0; i < 40; i++ {
+		if _, err := peer.WriteToUDP([]byte(fmt.Sprint(i)), pc.LocalAddr().(*net.UDPAddr)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	c2.SetReadDeadline(time.Now().Add(someTimeout))
+	b := make([]byte, 1500)
+	for i := 0; i < 40; i++ {
+		n, err := c2.Read(b)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got, want := string(b[:n]), fmt.Sprint(i); got != want {
+			t.Fatalf("message %d is %q; want %q", i, got, want)
+		}
+	}
+
+	// And so do the messages of the SRT connection.
+	for i := 0; i < 40; i++ {
+		if _, err := c2.Write([]byte(fmt.Sprint(i))); err != nil {
+			t.Fatal(err)
+		}
+	}
+	peer.SetReadDeadline(time.Now().Add(someTimeout))
+	for i := 0; i < 40; i++ {
+		n, err := peer.Read(b)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got, want := string(b[:n]), fmt.Sprint(i); got != want {
+			t.Fatalf("datagram %d is %q; want %q", i, got, want)
+		}
+	}
+
+	cancel()
+	select {
+	case err := <-done:
+		if err != context.Canceled {
+			t.Errorf("Splice returned %v; want context.Canceled", err)
+		}
+	case <-time.After(someTimeout):
+		t.Fatal("Splice still running after cancel")
+	}
+
+	// The connection is usable again.
+	if _, err := c2.Write([]byte("again")); err != nil {
+		t.Fatal(err)
+	}
+	c1.SetReadDeadline(time.Now().Add(someTimeout))
+	if n, err := c1.Read(b); err != nil || string(b[:n]) != "again" {
+		t.Errorf("read %q, %v after Splice; want \"again\"", b[:n], err)
+	}
+}
@@ -0,0 +1,90 @@
+// Copyright (c) 2020 CyberAgent, Inc. All rights reserved.
+// https://github.com/openfresh/gosrt
+
+package srt
+
+import (
+	"time"
+
+	"github.com/openfresh/gosrt/srtapi"
+)
+
+// WriteWithSourceTime writes b as one message stamped with the time t
+// it was produced at, instead of the time of writing. SRT delivers
+// messages to the peer at the same latency from their source time, so
+// the receiver can line up streams sent over separate connections,
+// audio and video say, by the times ReadWithSourceTime returns. A zero
+// t stands for the current time. t must not be before the connection
+// was established.
+func (c *conn) WriteWithSourceTime(b []byte, t time.Time) (int, error) {
+	if !c.ok() {
+		return 0, srtapi.EINVPARAM
+	}
+	n, err := c.fd.writeMsg(b, t)
+	if err != nil {
+		err = &OpError{Op: "write", Net: c.fd.net, Source: c.fd.laddr, Addr: c.fd.raddr, Err: err}
+	}
+	return n, err
+}
+
+// ReadWithSourceTime reads one message into b, and returns with it
+// the time the peer produced it at, as given to WriteWithSourceTime,
+// on this side's clock: save for clock drift, two messages produced
+// at the same time on the peer read with the same time, whichever
+// connections from that peer they came over.
+func (c *conn) ReadWithSourceTime(b []byte) (int, time.Time, error) {
+	if !c.ok() {
+		return 0, time.Time{}, srtapi.EINVPARAM
+	}
+	n, t, err := c.fd.readMsg(b)
+	if err != nil {
+		err = &OpError{Op: "read", Net: c.fd.net, Source: c.fd.laddr, Addr: c.fd.raddr, Err: err}
+	}
+	return n, t, err
+}
+
+func (fd *netFD) writeMsg(p []byte, t time.Time) (int, error) {
+	if !srtapi.Has(srtapi.FeatureSourceTime) {
+		return 0, srtapi.EINVOP
+	}
+	var mc srtapi.MsgCtrl
+	if !t.IsZero() {
+		mc.SrcTime = toSourceTime(t)
+	}
+	n, err := fd.pfd.WriteMsg(p, &mc)
+	if err == nil {
+		fd.tap(TapOutbound, p, t, 0)
+	}
+	return n, wrapSyscallError("write", err)
+}
+
+func (fd *netFD) readMsg(p []byte) (int, time.Time, error) {
+	if !srtapi.Has(srtapi.FeatureSourceTime) {
+		return 0, time.Time{}, srtapi.EINVOP
+	}
+	if n, ok := fd.readPeeked(p); ok {
+		fd.tap(TapInbound, p[:n], time.Time{}, 0)
+		return n, time.Time{}, nil
+	}
+	var mc srtapi.MsgCtrl
+	n, err := fd.pfd.ReadMsg(p, &mc, fd.rseq.seen())
+	if err != nil {
+		return n, time.Time{}, wrapSyscallError("read", err)
+	}
+	var t time.Time
+	if mc.SrcTime != 0 {
+		t = fromSourceTime(mc.SrcTime)
+	}
+	fd.tap(TapInbound, p[:n], t, 0)
+	return n, t, nil
+}
+
+// toSourceTime and fromSourceTime convert between time.Time and the
+// microseconds of srtapi.TimeNow, through the current time.
+func toSourceTime(t time.Time) int64 {
+	return srtapi.TimeNow() - int64(time.Since(t)/time.Microsecond)
+}
+
+func fromSourceTime(us int64) time.Time {
+	return time.Now().Add(-time.Duration(srtapi.TimeNow()-us) * time.Microsecond)
+}
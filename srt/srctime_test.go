@@ -0,0 +1,55 @@
+// Copyright (c) 2020 CyberAgent, Inc. All rights reserved.
+// https://github.com/openfresh/gosrt
+
+package srt
+
+import (
+	"testing"
+	"time"
+
+	"github.com/openfresh/gosrt/srtapi"
+)
+
+func TestSourceTime(t *testing.T) {
+	if !srtapi.Has(srtapi.FeatureSourceTime) {
+		t.Skip("SRT library lacks srt_time_now")
+	}
+	ln, err := newLocalListener("srt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	c, err := Dial("srt", ln.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	a, err := ln.Accept()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer a.Close()
+
+	time.Sleep(50 * time.Millisecond)
+	now := time.Now()
+	times := []time.Time{now.Add(-40 * time.Millisecond), now.Add(-20 * time.Millisecond), {}}
+	for _, st := range times {
+		if _, err := c.(*SRTConn).WriteWithSourceTime([]byte("SOURCE TIME TEST"), st); err != nil {
+			t.Fatal(err)
+		}
+	}
+	times[2] = now
+	b := make([]byte, 1500)
+	for i, want := range times {
+		n, got, err := a.(*SRTConn).ReadWithSourceTime(b)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(b[:n]) != "SOURCE TIME TEST" {
+			t.Errorf("#%d: got %q", i, b[:n])
+		}
+		if d := got.Sub(want); d < -5*time.Millisecond || d > 5*time.Millisecond {
+			t.Errorf("#%d: got source time %v off by %v", i, got, d)
+		}
+	}
+}
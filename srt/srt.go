@@ -66,6 +66,46 @@ func (c *conn) Write(b []byte) (int, error) {
 	return n, err
 }
 
+// ReadContext acts like Read but takes a context.
+//
+// If ctx is done before the read completes, the pending read is
+// abandoned and an error wrapping the context's error is returned.
+// Unlike a deadline set with SetReadDeadline, this does not affect
+// subsequent reads, and the connection stays open.
+func (c *conn) ReadContext(ctx context.Context, b []byte) (int, error) {
+	if !c.ok() {
+		return 0, srtapi.EINVPARAM
+	}
+	if ctx == nil {
+		panic("nil context")
+	}
+	n, err := c.fd.readContext(ctx, b)
+	if err != nil && err != io.EOF {
+		err = &OpError{Op: "read", Net: c.fd.net, Source: c.fd.laddr, Addr: c.fd.raddr, Err: err}
+	}
+	return n, err
+}
+
+// WriteContext acts like Write but takes a context.
+//
+// If ctx is done before the write completes, the pending write is
+// abandoned and an error wrapping the context's error is returned
+// along with the number of bytes already written.
+// The connection stays open.
+func (c *conn) WriteContext(ctx context.Context, b []byte) (int, error) {
+	if !c.ok() {
+		return 0, srtapi.EINVPARAM
+	}
+	if ctx == nil {
+		panic("nil context")
+	}
+	n, err := c.fd.writeContext(ctx, b)
+	if err != nil {
+		err = &OpError{Op: "write", Net: c.fd.net, Source: c.fd.laddr, Addr: c.fd.raddr, Err: err}
+	}
+	return n, err
+}
+
 // Close closes the connection.
 func (c *conn) Close() error {
 	if !c.ok() {
@@ -103,7 +143,7 @@ func (c *conn) SetDeadline(t time.Time) error {
 	if !c.ok() {
 		return srtapi.EINVPARAM
 	}
-	if err := c.fd.pfd.SetDeadline(t); err != nil {
+	if err := c.fd.setDeadline(t); err != nil {
 		return &OpError{Op: "set", Net: c.fd.net, Source: nil, Addr: c.fd.laddr, Err: err}
 	}
 	return nil
@@ -114,7 +154,7 @@ func (c *conn) SetReadDeadline(t time.Time) error {
 	if !c.ok() {
 		return srtapi.EINVPARAM
 	}
-	if err := c.fd.pfd.SetReadDeadline(t); err != nil {
+	if err := c.fd.setReadDeadline(t); err != nil {
 		return &OpError{Op: "set", Net: c.fd.net, Source: nil, Addr: c.fd.laddr, Err: err}
 	}
 	return nil
@@ -125,7 +165,7 @@ func (c *conn) SetWriteDeadline(t time.Time) error {
 	if !c.ok() {
 		return srtapi.EINVPARAM
 	}
-	if err := c.fd.pfd.SetWriteDeadline(t); err != nil {
+	if err := c.fd.setWriteDeadline(t); err != nil {
 		return &OpError{Op: "set", Net: c.fd.net, Source: nil, Addr: c.fd.laddr, Err: err}
 	}
 	return nil
@@ -136,12 +176,34 @@ func (c *conn) StreamID() (string, error) {
 	return srtapi.GetsockflagString(c.fd.pfd.Sysfd, srtapi.OptionStreamid)
 }
 
+// SocketID returns the ID of the SRT socket of the connection, which
+// the SRT library logs and Registry.Lookup takes.
+func (c *conn) SocketID() int {
+	if !c.ok() {
+		return -1
+	}
+	return c.fd.pfd.Sysfd
+}
+
+// Stats returns the statistics of the connection, with its Labels
+// under "labels" if it has any.
 func (c *conn) Stats() map[string]interface{} {
-	return srtapi.GetStats(c.fd.pfd.Sysfd, !conf.SystemConf().FullStats())
+	stats := srtapi.GetStats(c.fd.pfd.Sysfd, !conf.SystemConf().FullStats())
+	if l := c.fd.getLabels(); l != nil && stats != nil {
+		stats["labels"] = l
+	}
+	return stats
 }
 
 var listenerBacklog = maxListenerBacklog()
 
+// ErrClosed is the error returned by an I/O call on a network
+// connection or listener that has already been closed, or that is
+// closed by another goroutine before the I/O is completed. This may
+// be wrapped in another error, and should normally be tested using
+// errors.Is(err, srt.ErrClosed).
+var ErrClosed = poll.ErrNetClosing
+
 // Various errors contained in OpError.
 var (
 	// For connection setup operations.
@@ -194,6 +256,9 @@ type OpError struct {
 	Err error
 }
 
+// Unwrap returns the underlying error.
+func (e *OpError) Unwrap() error { return e.Err }
+
 func (e *OpError) Error() string {
 	if e == nil {
 		return "<nil>"
@@ -106,6 +106,8 @@ func (c *SRTConn) ReadFrom(r io.Reader) (int64, error) {
 
 func newSRTConn(fd *netFD) *SRTConn {
 	c := &SRTConn{conn{fd}}
+	fd.rseq = newRecvSeq(fd)
+	fd.logDrops()
 	return c
 }
 
@@ -154,6 +156,31 @@ func (l *SRTListener) AcceptSRT() (*SRTConn, error) {
 	return c, nil
 }
 
+// AcceptContext is like AcceptSRT, but gives up once ctx is done, as
+// ReadContext does, so that servers shut down without a goroutine left
+// waiting for a call. The listener stays usable, with
+// its deadline.
+func (l *SRTListener) AcceptContext(ctx context.Context) (*SRTConn, error) {
+	if !l.ok() {
+		return nil, srtapi.EINVPARAM
+	}
+	if ctx == nil {
+		panic("nil context")
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, &OpError{Op: "accept", Net: l.fd.net, Source: nil, Addr: l.fd.laddr, Err: mapErr(err)}
+	}
+	stop := l.fd.interruptOn(ctx, 'r')
+	c, err := l.accept()
+	if ctxErr := stop(); ctxErr != nil && err != nil {
+		err = mapErr(ctxErr)
+	}
+	if err != nil {
+		return nil, &OpError{Op: "accept", Net: l.fd.net, Source: nil, Addr: l.fd.laddr, Err: err}
+	}
+	return c, nil
+}
+
 // Accept implements the Accept method in the Listener interface; it
 // waits for the next call and returns a generic Conn.
 func (l *SRTListener) Accept() (net.Conn, error) {
@@ -184,13 +211,21 @@ func (l *SRTListener) Close() error {
 // do not modify it.
 func (l *SRTListener) Addr() net.Addr { return l.fd.laddr }
 
+// SocketID returns the ID of the SRT socket the listener listens on.
+func (l *SRTListener) SocketID() int {
+	if !l.ok() {
+		return -1
+	}
+	return l.fd.pfd.Sysfd
+}
+
 // SetDeadline sets the deadline associated with the listener.
 // A zero time value disables the deadline.
 func (l *SRTListener) SetDeadline(t time.Time) error {
 	if !l.ok() {
 		return srtapi.EINVPARAM
 	}
-	if err := l.fd.pfd.SetDeadline(t); err != nil {
+	if err := l.fd.setDeadline(t); err != nil {
 		return &OpError{Op: "set", Net: l.fd.net, Source: nil, Addr: l.fd.laddr, Err: err}
 	}
 	return nil
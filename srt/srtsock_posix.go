@@ -61,22 +61,77 @@ func dialSRT(ctx context.Context, network string, laddr, raddr *SRTAddr) (*SRTCo
 }
 
 func doDialSRT(ctx context.Context, network string, laddr, raddr *SRTAddr) (*SRTConn, error) {
+	if policy := encryptionPolicyValue(ctx); policy != nil {
+		if err := policy.supported(); err != nil {
+			return nil, err
+		}
+	}
+	hs := hooksValue(ctx)
 	fd, err := internetSocket(ctx, network, laddr, raddr, syscall.SOCK_DGRAM, 0, "dial")
 	if err != nil {
+		hs.onError(ctx, "dial", raddr, err)
+		return nil, err
+	}
+	fd.setLogger(ctx, RoleCaller)
+	c := newSRTConn(fd)
+	if err := hs.afterConnect(ctx, "dial", c); err != nil {
+		hs.onError(ctx, "dial", raddr, err)
+		return nil, err
+	}
+	if r := registryValue(ctx); r != nil {
+		if err := r.addConn(c); err != nil {
+			return nil, err
+		}
+	}
+	if err := addToBandwidthManager(ctx, c); err != nil {
 		return nil, err
 	}
-	return newSRTConn(fd), nil
+	return c, nil
 }
 
 func (ln *SRTListener) ok() bool { return ln != nil && ln.fd != nil }
 
 func (ln *SRTListener) accept() (*SRTConn, error) {
-	fd, err := ln.fd.accept()
-	if err != nil {
-		return nil, err
+	policy := encryptionPolicyValue(ln.ctx)
+	audit := auditValue(ln.ctx)
+	hs := hooksValue(ln.ctx)
+	for {
+		fd, err := ln.fd.accept()
+		if err != nil {
+			hs.onError(ln.ctx, "accept", ln.fd.laddr, err)
+			return nil, err
+		}
+		fd.setLabels(ln.ctx)
+		var d *EncryptionDecision
+		if policy != nil {
+			dec := policy.check(fd)
+			d = &dec
+		}
+		if audit != nil {
+			fd.auditAccept(audit, d)
+		}
+		if d != nil && !d.Accepted {
+			fd.Close()
+			continue
+		}
+		configure(ln.ctx, fd.pfd.Sysfd, bindPost)
+		fd.setLogger(ln.ctx, RoleListener)
+		c := newSRTConn(fd)
+		if err := hs.afterConnect(ln.ctx, "accept", c); err != nil {
+			hs.onError(ln.ctx, "accept", fd.raddr, err)
+			continue
+		}
+		if r := registryValue(ln.ctx); r != nil {
+			if err := r.addConn(c); err != nil {
+				return nil, err
+			}
+		}
+		if err := addToBandwidthManager(ln.ctx, c); err != nil {
+			hs.onError(ln.ctx, "accept", fd.raddr, err)
+			continue
+		}
+		return c, nil
 	}
-	configure(ln.ctx, fd.pfd.Sysfd, bindPost)
-	return newSRTConn(fd), nil
 }
 
 func (ln *SRTListener) close() error {
@@ -84,9 +139,20 @@ func (ln *SRTListener) close() error {
 }
 
 func listenSRT(ctx context.Context, network string, laddr *SRTAddr) (*SRTListener, error) {
+	if policy := encryptionPolicyValue(ctx); policy != nil {
+		if err := policy.supported(); err != nil {
+			return nil, &OpError{Op: "listen", Net: network, Source: nil, Addr: laddr, Err: err}
+		}
+	}
 	fd, err := internetSocket(ctx, network, laddr, nil, syscall.SOCK_DGRAM, 0, "listen")
 	if err != nil {
 		return nil, err
 	}
-	return &SRTListener{fd, ctx}, nil
+	ln := &SRTListener{fd, ctx}
+	if r := registryValue(ctx); r != nil {
+		if err := r.addListener(ln); err != nil {
+			return nil, err
+		}
+	}
+	return ln, nil
 }
@@ -0,0 +1,182 @@
+// Copyright (c) 2020 CyberAgent, Inc. All rights reserved.
+// https://github.com/openfresh/gosrt
+
+package srt
+
+import (
+	"context"
+	"time"
+
+	"github.com/openfresh/gosrt/internal/poll/runtime"
+	"github.com/openfresh/gosrt/srtapi"
+)
+
+// DefaultStatisticsInterval is the interval of WatchStatistics with an
+// interval of 0.
+const DefaultStatisticsInterval = time.Second
+
+// Statistics are the statistics of a connection, as libsrt keeps them,
+// typed, for monitoring to export: Stats gives the same in the layout
+// of the admin endpoint.
+type Statistics struct {
+	Time time.Time
+
+	// Elapsed is the time since the socket was created.
+	Elapsed time.Duration
+
+	// Interval counts since the statistics were last cleared, Total
+	// since the connection started, for counters to export.
+	Interval, Total StatisticsCounters
+
+	RTT time.Duration
+
+	// SendRate and RecvRate are in Mbit/s, retransmissions included,
+	// as are the link capacity libsrt estimates and the maxbw, 0 when
+	// unknown, always with the pure Go implementation.
+	SendRate, RecvRate      float64
+	Bandwidth, MaxBandwidth float64
+
+	// FlowWindow is the room the peer's receive buffer has, and
+	// CongestionWindow the packets the congestion control lets be in
+	// flight, FlightSize those that are.
+	FlowWindow, CongestionWindow, FlightSize int
+
+	SendBuffer, RecvBuffer BufferLevel
+
+	// SendLatency and RecvLatency are the latencies agreed on in the
+	// handshake.
+	SendLatency, RecvLatency time.Duration
+}
+
+// StatisticsCounters are the counters of Statistics.
+type StatisticsCounters struct {
+	PacketsSent, PacketsReceived int64
+
+	// PacketsSendLost were reported lost by the peer, and
+	// PacketsRecvLost found missing on reception.
+	PacketsSendLost, PacketsRecvLost int64
+
+	PacketsRetransmitted, PacketsRecvRetransmitted int64
+
+	// PacketsSendDropped and PacketsRecvDropped were given up on as too
+	// late, and PacketsBelated arrived too late.
+	PacketsSendDropped, PacketsRecvDropped int64
+	PacketsBelated                         int64
+
+	BytesSent, BytesReceived           int64
+	BytesSendDropped, BytesRecvDropped int64
+}
+
+func (s *StatisticsCounters) add(o StatisticsCounters) {
+	s.PacketsSent += o.PacketsSent
+	s.PacketsReceived += o.PacketsReceived
+	s.PacketsSendLost += o.PacketsSendLost
+	s.PacketsRecvLost += o.PacketsRecvLost
+	s.PacketsRetransmitted += o.PacketsRetransmitted
+	s.PacketsRecvRetransmitted += o.PacketsRecvRetransmitted
+	s.PacketsSendDropped += o.PacketsSendDropped
+	s.PacketsRecvDropped += o.PacketsRecvDropped
+	s.PacketsBelated += o.PacketsBelated
+	s.BytesSent += o.BytesSent
+	s.BytesReceived += o.BytesReceived
+	s.BytesSendDropped += o.BytesSendDropped
+	s.BytesRecvDropped += o.BytesRecvDropped
+}
+
+// Statistics returns the statistics of the connection, restarting the
+// Interval counters if clear is set. The rates, the RTT and the
+// buffers are the moving averages of libsrt; InstantStatistics gives
+// their current values.
+func (c *conn) Statistics(clear bool) (Statistics, error) {
+	return c.statistics(clear, false)
+}
+
+// InstantStatistics returns the statistics of the connection as
+// Statistics does, with the current rates, RTT and buffers, without
+// clearing the counters.
+func (c *conn) InstantStatistics() (Statistics, error) {
+	return c.statistics(false, true)
+}
+
+func (c *conn) statistics(clear, instantaneous bool) (Statistics, error) {
+	if !c.ok() {
+		return Statistics{}, srtapi.EINVPARAM
+	}
+	var (
+		st  srtapi.Stats
+		err error
+	)
+	if rerr := c.fd.pfd.RawControl(func(s int) { st, err = bistatsFunc(s, clear, instantaneous) }); rerr != nil {
+		err = rerr
+	}
+	if err != nil {
+		return Statistics{}, &OpError{Op: "stats", Net: c.fd.net, Source: c.fd.laddr, Addr: c.fd.raddr, Err: err}
+	}
+	return newStatistics(runtime.Clock.Now(), st), nil
+}
+
+func newStatistics(now time.Time, st srtapi.Stats) Statistics {
+	ms := func(v int) time.Duration { return time.Duration(v) * time.Millisecond }
+	buffer := func(b srtapi.BufferStats) BufferLevel {
+		return BufferLevel{Packets: b.Packets, Bytes: b.Bytes, Span: ms(b.Ms), Available: b.AvailableBytes}
+	}
+	return Statistics{
+		Time:             now,
+		Elapsed:          time.Duration(st.TimestampMs) * time.Millisecond,
+		Interval:         StatisticsCounters(st.Interval),
+		Total:            StatisticsCounters(st.Total),
+		RTT:              time.Duration(st.RTTMs * float64(time.Millisecond)),
+		SendRate:         st.SendRate,
+		RecvRate:         st.RecvRate,
+		Bandwidth:        st.Bandwidth,
+		MaxBandwidth:     st.MaxBandwidth,
+		FlowWindow:       st.FlowWindow,
+		CongestionWindow: st.CongestionWindow,
+		FlightSize:       st.FlightSize,
+		SendBuffer:       buffer(st.SendBuffer),
+		RecvBuffer:       buffer(st.RecvBuffer),
+		SendLatency:      ms(st.SendBuffer.LatencyMs),
+		RecvLatency:      ms(st.RecvBuffer.LatencyMs),
+	}
+}
+
+// WatchStatistics returns a channel receiving the Statistics of the
+// connection every interval, until ctx is done or the connection is
+// closed, when it is closed, for monitoring to export them or an
+// encoder to follow them. The Interval counters of each are those
+// since the one received before; other uses of Statistics clearing
+// them lose counts. A receiver that falls behind gets the latest
+// Statistics only, with the counts of those it missed. An interval of
+// 0 means DefaultStatisticsInterval.
+func (c *conn) WatchStatistics(ctx context.Context, interval time.Duration) (<-chan Statistics, error) {
+	if _, err := c.Statistics(true); err != nil {
+		return nil, err
+	}
+	if interval <= 0 {
+		interval = DefaultStatisticsInterval
+	}
+	ch := make(chan Statistics, 1)
+	go func() {
+		defer close(ch)
+		t := runtime.Clock.NewTicker(interval)
+		defer t.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-t.C():
+				st, err := c.Statistics(true)
+				if err != nil {
+					return
+				}
+				select {
+				case prev := <-ch:
+					st.Interval.add(prev.Interval)
+				default:
+				}
+				ch <- st
+			}
+		}
+	}()
+	return ch, nil
+}
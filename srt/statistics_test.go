@@ -0,0 +1,87 @@
+// Copyright (c) 2020 CyberAgent, Inc. All rights reserved.
+// https://github.com/openfresh/gosrt
+
+package srt
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestStatistics(t *testing.T) {
+	c1, c2, err := Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c1.Close()
+	defer c2.Close()
+
+	msg := make([]byte, 1000)
+	b := make([]byte, 1500)
+	for i := 0; i < 10; i++ {
+		if _, err := c1.Write(msg); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := c2.Read(b); err != nil {
+			t.Fatal(err)
+		}
+	}
+	st, err := c1.Statistics(true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if st.Total.PacketsSent < 10 || st.Total.BytesSent < 10000 || st.Interval.PacketsSent != st.Total.PacketsSent {
+		t.Errorf("got sender counters %+v, %+v; want 10 packets of 1000 bytes sent", st.Interval, st.Total)
+	}
+	if st.Time.IsZero() || st.Elapsed <= 0 {
+		t.Errorf("got time %v, elapsed %v", st.Time, st.Elapsed)
+	}
+	if st, err := c1.Statistics(false); err != nil || st.Interval.PacketsSent != 0 || st.Total.PacketsSent < 10 {
+		t.Errorf("got counters %+v, %+v, %v once cleared", st.Interval, st.Total, err)
+	}
+	st, err = c2.InstantStatistics()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if st.Total.PacketsReceived < 10 || st.Total.BytesReceived < 10000 {
+		t.Errorf("got receiver counters %+v; want 10 packets of 1000 bytes received", st.Total)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	ch, err := c1.WatchStatistics(ctx, 10*time.Millisecond)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c1.Write(msg)
+	c2.Read(b)
+	// Past many intervals: the latest Statistics has the counts of
+	// those that weren't received.
+	time.Sleep(100 * time.Millisecond)
+	deadline := time.After(someTimeout)
+	for sent := int64(0); sent == 0; {
+		select {
+		case st := <-ch:
+			sent = st.Interval.PacketsSent
+		case <-deadline:
+			t.Fatal("no statistics with the packet sent")
+		}
+	}
+
+	// An interval of 0 is DefaultStatisticsInterval.
+	ctx0, cancel0 := context.WithCancel(context.Background())
+	ch0, err := c1.WatchStatistics(ctx0, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cancel0()
+	for range ch0 {
+	}
+	c1.Close()
+	for range ch {
+	}
+	if _, err := c1.Statistics(false); err == nil {
+		t.Error("got statistics of a closed connection")
+	}
+}
@@ -0,0 +1,31 @@
+// Copyright (c) 2020 CyberAgent, Inc. All rights reserved.
+// https://github.com/openfresh/gosrt
+
+package srt
+
+import (
+	"errors"
+
+	"github.com/openfresh/gosrt/srtapi"
+)
+
+// ErrStreamMode is the error of adapters needing stream mode, such as
+// those of packages srtgrpc and srthttp, for a connection or listener
+// that didn't take the StreamOptions.
+var ErrStreamMode = errors.New("stream mode not supported")
+
+// StreamMode reports whether c is in stream mode.
+func (c *conn) StreamMode() bool {
+	return c.ok() && c.fd.streamMode()
+}
+
+// StreamMode reports whether the connections l accepts are in stream
+// mode.
+func (l *SRTListener) StreamMode() bool {
+	return l.ok() && l.fd.streamMode()
+}
+
+func (fd *netFD) streamMode() bool {
+	typ, err := getsockoptIntFunc(fd.pfd.Sysfd, 0, srtapi.OptionTranstype)
+	return err == nil && typ == srtapi.TypeFile
+}
@@ -0,0 +1,20 @@
+// Copyright (c) 2020 CyberAgent, Inc. All rights reserved.
+// https://github.com/openfresh/gosrt
+
+package srt
+
+import (
+	"testing"
+)
+
+func TestStreamModeLive(t *testing.T) {
+	c1, c2, err := Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c1.Close()
+	defer c2.Close()
+	if c1.StreamMode() || c2.StreamMode() {
+		t.Error("live mode connections report stream mode")
+	}
+}
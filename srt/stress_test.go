@@ -0,0 +1,210 @@
+// Copyright (c) 2020 CyberAgent, Inc. All rights reserved.
+// https://github.com/openfresh/gosrt
+
+package srt
+
+import (
+	"fmt"
+	"net"
+	"sync"
+	"testing"
+	"time"
+)
+
+// The stress tests run many connections at once through dials,
+// accepts, I/O, deadlines and closes racing each other, to flush out
+// data races in the poller's descriptor table, the deadline timers and
+// the close paths. They are most useful under the race detector:
+//
+//	go test -race -run Stress ./srt
+//
+// With -short, they run a tenth of the connections.
+
+func stressConns(t *testing.T) int {
+	if testing.Short() {
+		return 20
+	}
+	return 200
+}
+
+// stressWait fails t if wg isn't done within someTimeout, which means
+// some goroutine is stuck.
+func stressWait(t *testing.T, wg *sync.WaitGroup) {
+	t.Helper()
+	done := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(someTimeout):
+		t.Fatal("goroutines stuck")
+	}
+}
+
+func TestStressDialAcceptEcho(t *testing.T) {
+	n := stressConns(t)
+	ln, err := newLocalListener("srt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	var servers sync.WaitGroup
+	go func() {
+		for {
+			c, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			servers.Add(1)
+			go func() {
+				defer servers.Done()
+				defer c.Close()
+				b := make([]byte, 1500)
+				for {
+					n, err := c.Read(b)
+					if err != nil {
+						return
+					}
+					if _, err := c.Write(b[:n]); err != nil {
+						return
+					}
+				}
+			}()
+		}
+	}()
+
+	var clients sync.WaitGroup
+	for i := 0; i < n; i++ {
+		clients.Add(1)
+		go func(i int) {
+			defer clients.Done()
+			c, err := Dial(ln.Addr().Network(), ln.Addr().String())
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			defer c.Close()
+			b := make([]byte, 1500)
+			for j := 0; j < 10; j++ {
+				msg := fmt.Sprintf("%d/%d", i, j)
+				c.SetDeadline(time.Now().Add(someTimeout))
+				if _, err := c.Write([]byte(msg)); err != nil {
+					t.Error(err)
+					return
+				}
+				n, err := c.Read(b)
+				if err != nil {
+					t.Error(err)
+					return
+				}
+				if string(b[:n]) != msg {
+					t.Errorf("got %q; want %q", b[:n], msg)
+					return
+				}
+			}
+		}(i)
+	}
+	stressWait(t, &clients)
+	ln.Close()
+	stressWait(t, &servers)
+}
+
+func TestStressCloseDuringIO(t *testing.T) {
+	n := stressConns(t)
+	var wg sync.WaitGroup
+	for i := 0; i < n; i++ {
+		c1, c2, err := Pipe()
+		if err != nil {
+			t.Fatal(err)
+		}
+		wg.Add(4)
+		// Read, write and move deadlines on both ends while they are
+		// closed.
+		for _, c := range []*SRTConn{c1, c2} {
+			go func(c *SRTConn) {
+				defer wg.Done()
+				b := make([]byte, 1500)
+				for {
+					if _, err := c.Read(b); err != nil {
+						return
+					}
+				}
+			}(c)
+		}
+		go func() {
+			defer wg.Done()
+			for {
+				if _, err := c1.Write([]byte("data")); err != nil {
+					return
+				}
+			}
+		}()
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; j < 10; j++ {
+				c2.SetReadDeadline(time.Now().Add(time.Duration(j) * time.Millisecond))
+				c1.SetWriteDeadline(time.Now().Add(time.Hour))
+				c2.SetReadDeadline(time.Time{})
+			}
+			if i%2 == 0 {
+				c1.Close()
+				c2.Close()
+			} else {
+				c2.Close()
+				c1.Close()
+			}
+			// Calls on closed connections fail cleanly.
+			c1.SetDeadline(time.Now())
+			c2.Write([]byte("late"))
+		}(i)
+	}
+	stressWait(t, &wg)
+}
+
+func TestStressDeadlines(t *testing.T) {
+	c1, c2, err := Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c1.Close()
+	defer c2.Close()
+	n := stressConns(t)
+	var wg sync.WaitGroup
+	for i := 0; i < n; i++ {
+		wg.Add(2)
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; j < 10; j++ {
+				d := time.Duration((i+j)%5) * time.Millisecond
+				c2.SetReadDeadline(time.Now().Add(d))
+			}
+		}(i)
+		go func() {
+			defer wg.Done()
+			b := make([]byte, 1500)
+			for j := 0; j < 3; j++ {
+				_, err := c2.Read(b)
+				if nerr, ok := err.(net.Error); err != nil && (!ok || !nerr.Timeout()) {
+					t.Error(err)
+					return
+				}
+			}
+		}()
+	}
+	// Send now and then, so some reads succeed in the mix.
+	stop := make(chan struct{})
+	go func() {
+		for {
+			select {
+			case <-stop:
+				return
+			case <-time.After(time.Millisecond):
+				c1.Write([]byte("data"))
+			}
+		}
+	}()
+	stressWait(t, &wg)
+	close(stop)
+}
@@ -0,0 +1,161 @@
+// Copyright (c) 2020 CyberAgent, Inc. All rights reserved.
+// https://github.com/openfresh/gosrt
+
+package srt
+
+import (
+	"sync/atomic"
+	"time"
+
+	"github.com/openfresh/gosrt/srtapi"
+)
+
+// TapDirection selects the messages a Tap copies.
+type TapDirection int
+
+const (
+	TapInbound  TapDirection = 1 << iota // messages read
+	TapOutbound                          // messages written
+	TapBoth     = TapInbound | TapOutbound
+)
+
+func (d TapDirection) String() string {
+	switch d {
+	case TapInbound:
+		return "inbound"
+	case TapOutbound:
+		return "outbound"
+	case TapBoth:
+		return "both"
+	}
+	return "direction " + itoa(int(d))
+}
+
+// A TapPacket is a message copied by a Tap.
+type TapPacket struct {
+	Direction TapDirection // TapInbound or TapOutbound
+	Time      time.Time    // when it was read or written
+
+	// SourceTime is the time the message was produced at, for those
+	// of ReadWithSourceTime, WriteWithSourceTime, ReadMessage and
+	// SendMessage, zero otherwise.
+	SourceTime time.Time
+
+	// MsgNo is the number of the messages of SendMessage and
+	// ReadMessage, 0 for the others.
+	MsgNo int32
+
+	// Payload is a copy of the message, shared by the Taps of the
+	// connection, which must not modify it.
+	Payload []byte
+}
+
+// DefaultTapBuffer is the channel buffer of a Tap opened with a buffer
+// of 0.
+const DefaultTapBuffer = 256
+
+// A Tap receives copies of the messages of a connection as the
+// application reads and writes them, for a debugger, a recorder or an
+// analyzer to look at the stream without standing in its way: the
+// copies are delivered on C, and dropped when it is full.
+type Tap struct {
+	// C delivers the copies. It is closed by Close, and when the
+	// connection is.
+	C <-chan TapPacket
+
+	fd      *netFD
+	dir     TapDirection
+	c       chan TapPacket
+	dropped uint64
+	closed  bool // under fd.tapmu
+}
+
+// Tap attaches a Tap to c copying the messages in dir, with a channel
+// of buffer packets, or DefaultTapBuffer if buffer is 0. A connection
+// may have several Taps. The messages are copied as reads return them
+// and as writes are handed to the connection, whole, except that those
+// of a Read shorter than the message are only copied as far as they
+// were read.
+func (c *conn) Tap(dir TapDirection, buffer int) (*Tap, error) {
+	if !c.ok() {
+		return nil, srtapi.EINVPARAM
+	}
+	if dir&TapBoth == 0 || dir&^TapBoth != 0 || buffer < 0 {
+		return nil, &OpError{Op: "tap", Net: c.fd.net, Source: c.fd.laddr, Addr: c.fd.raddr, Err: srtapi.EINVPARAM}
+	}
+	if buffer == 0 {
+		buffer = DefaultTapBuffer
+	}
+	ch := make(chan TapPacket, buffer)
+	t := &Tap{C: ch, fd: c.fd, dir: dir, c: ch}
+	fd := c.fd
+	fd.tapmu.Lock()
+	defer fd.tapmu.Unlock()
+	if fd.tapClosed {
+		return nil, &OpError{Op: "tap", Net: c.fd.net, Source: c.fd.laddr, Addr: c.fd.raddr, Err: ErrClosed}
+	}
+	fd.taps = append(fd.taps, t)
+	atomic.StoreInt32(&fd.ntaps, int32(len(fd.taps)))
+	return t, nil
+}
+
+// Dropped returns the number of copies dropped, C being full.
+func (t *Tap) Dropped() uint64 {
+	return atomic.LoadUint64(&t.dropped)
+}
+
+// Close detaches t from its connection, and closes C.
+func (t *Tap) Close() error {
+	fd := t.fd
+	fd.tapmu.Lock()
+	defer fd.tapmu.Unlock()
+	if t.closed {
+		return nil
+	}
+	for i, x := range fd.taps {
+		if x == t {
+			fd.taps = append(fd.taps[:i:i], fd.taps[i+1:]...)
+			break
+		}
+	}
+	atomic.StoreInt32(&fd.ntaps, int32(len(fd.taps)))
+	t.closed = true
+	close(t.c)
+	return nil
+}
+
+// tap hands a copy of p to the taps of dir, if any.
+func (fd *netFD) tap(dir TapDirection, p []byte, src time.Time, msgno int32) {
+	if atomic.LoadInt32(&fd.ntaps) == 0 {
+		return
+	}
+	fd.tapmu.Lock()
+	defer fd.tapmu.Unlock()
+	var pkt TapPacket
+	for _, t := range fd.taps {
+		if t.dir&dir == 0 {
+			continue
+		}
+		if pkt.Payload == nil {
+			pkt = TapPacket{Direction: dir, Time: time.Now(), SourceTime: src, MsgNo: msgno, Payload: append(make([]byte, 0, len(p)), p...)}
+		}
+		select {
+		case t.c <- pkt:
+		default:
+			atomic.AddUint64(&t.dropped, 1)
+			fd.logf(LogTapDrop, "srt tap dropped a copy", "direction", dir.String(), "dropped", atomic.LoadUint64(&t.dropped))
+		}
+	}
+}
+
+func (fd *netFD) closeTaps() {
+	fd.tapmu.Lock()
+	defer fd.tapmu.Unlock()
+	for _, t := range fd.taps {
+		t.closed = true
+		close(t.c)
+	}
+	fd.taps = nil
+	atomic.StoreInt32(&fd.ntaps, 0)
+	fd.tapClosed = true
+}
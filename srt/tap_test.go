@@ -0,0 +1,82 @@
+// Copyright (c) 2020 CyberAgent, Inc. All rights reserved.
+// https://github.com/openfresh/gosrt
+
+package srt
+
+import (
+	"testing"
+	"time"
+)
+
+func TestTap(t *testing.T) {
+	c1, c2, err := Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c1.Close()
+	defer c2.Close()
+
+	if _, err := c1.Tap(0, 0); err == nil {
+		t.Error("Tap without a direction succeeded")
+	}
+	both, err := c1.Tap(TapBoth, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	in, err := c1.Tap(TapInbound, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	b := make([]byte, 1500)
+	for _, msg := range []string{"a", "b"} {
+		if _, err := c1.Write([]byte(msg)); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := c2.Read(b); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, msg := range []string{"c", "d"} {
+		if _, err := c2.Write([]byte(msg)); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := c1.Read(b); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for _, want := range []struct {
+		dir TapDirection
+		msg string
+	}{{TapOutbound, "a"}, {TapOutbound, "b"}, {TapInbound, "c"}, {TapInbound, "d"}} {
+		select {
+		case pkt := <-both.C:
+			if pkt.Direction != want.dir || string(pkt.Payload) != want.msg || pkt.Time.IsZero() {
+				t.Errorf("got %v %q at %v; want %v %q", pkt.Direction, pkt.Payload, pkt.Time, want.dir, want.msg)
+			}
+		case <-time.After(someTimeout):
+			t.Fatalf("no copy of %q", want.msg)
+		}
+	}
+
+	// The inbound tap has room for "c" only.
+	if pkt := <-in.C; pkt.Direction != TapInbound || string(pkt.Payload) != "c" {
+		t.Errorf("inbound tap got %v %q; want inbound \"c\"", pkt.Direction, pkt.Payload)
+	}
+	if in.Dropped() != 1 {
+		t.Errorf("inbound tap dropped %d copies; want 1", in.Dropped())
+	}
+
+	in.Close()
+	if _, ok := <-in.C; ok {
+		t.Error("channel of a closed tap still open")
+	}
+	c1.Close()
+	if _, ok := <-both.C; ok {
+		t.Error("channel of a tap still open after the connection closed")
+	}
+	if _, err := c1.Tap(TapBoth, 0); err == nil {
+		t.Error("Tap on a closed connection succeeded")
+	}
+}
@@ -0,0 +1,72 @@
+// Copyright (c) 2020 CyberAgent, Inc. All rights reserved.
+// https://github.com/openfresh/gosrt
+
+package srt
+
+import "time"
+
+// DefaultMaxSourceGap is the MaxGap of a SourceTimeline left zero.
+const DefaultMaxSourceGap = time.Second
+
+// A SourceTimeline maps the source times of a stream, as returned by
+// ReadWithSourceTime, onto one output timeline that never goes back,
+// even when the stream comes over successive connections whose source
+// times don't line up: after a sender reconnects, or a receiver fails
+// over to another sender. Output times keep the spacing of the source
+// times across such breaks, so players see no jump.
+//
+// The zero value is ready to use. A SourceTimeline must not be used
+// concurrently.
+type SourceTimeline struct {
+	// MaxGap is the largest step between successive source times
+	// taken as the stream going on; larger steps, forward or back,
+	// break the timeline. A smaller step back is a message out of
+	// order, which keeps the timeline of the others. Zero means
+	// DefaultMaxSourceGap.
+	MaxGap time.Duration
+
+	started bool
+	broken  bool
+	in, out time.Time     // newest source and last output times
+	step    time.Duration // last step between source times
+	offset  time.Duration // output minus source time
+}
+
+// Map returns the output time of the source time t.
+func (tl *SourceTimeline) Map(t time.Time) time.Time {
+	if !tl.started {
+		tl.started = true
+		tl.in, tl.out = t, t
+		return t
+	}
+	maxGap := tl.MaxGap
+	if maxGap <= 0 {
+		maxGap = DefaultMaxSourceGap
+	}
+	d := t.Sub(tl.in)
+	switch {
+	case tl.broken || d < -maxGap || d > maxGap:
+		// Go on one step after the last output time.
+		tl.broken = false
+		tl.offset = tl.out.Add(tl.step).Sub(t)
+		tl.in = t
+	case d >= 0:
+		tl.step = d
+		tl.in = t
+	default:
+		// Out of order: the timeline goes on from the newest.
+	}
+	out := t.Add(tl.offset)
+	if out.Before(tl.out) {
+		out = tl.out
+	}
+	tl.out = out
+	return out
+}
+
+// Break makes the next source time continue the timeline after the
+// last one, whatever their distance. Call it when the stream moves to
+// a new connection.
+func (tl *SourceTimeline) Break() {
+	tl.broken = true
+}
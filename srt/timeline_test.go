@@ -0,0 +1,45 @@
+// Copyright (c) 2020 CyberAgent, Inc. All rights reserved.
+// https://github.com/openfresh/gosrt
+
+package srt
+
+import (
+	"testing"
+	"time"
+)
+
+func TestSourceTimeline(t *testing.T) {
+	base := time.Now()
+	ms := func(n int) time.Time { return base.Add(time.Duration(n) * time.Millisecond) }
+
+	var tl SourceTimeline
+	steps := []struct {
+		in  time.Time
+		brk bool
+		out time.Time
+	}{
+		{ms(0), false, ms(0)},
+		{ms(20), false, ms(20)},
+		{ms(40), false, ms(40)},
+		// The sender restarted with older source times.
+		{ms(-5000), false, ms(60)},
+		{ms(-4980), false, ms(80)},
+		// A jump ahead past MaxGap.
+		{ms(10000), false, ms(100)},
+		// A new connection close to the old times.
+		{ms(10010), true, ms(120)},
+		{ms(10030), false, ms(140)},
+		// A reordered source time never takes the output back, nor
+		// shifts the times after it.
+		{ms(10025), false, ms(140)},
+		{ms(10050), false, ms(160)},
+	}
+	for i, st := range steps {
+		if st.brk {
+			tl.Break()
+		}
+		if got := tl.Map(st.in); !got.Equal(st.out) {
+			t.Errorf("#%d: got %v; want %v", i, got.Sub(base), st.out.Sub(base))
+		}
+	}
+}
@@ -8,6 +8,7 @@
 package srt
 
 import (
+	"context"
 	"fmt"
 	"net"
 	"runtime"
@@ -15,7 +16,9 @@ import (
 	"testing"
 	"time"
 
+	"github.com/openfresh/gosrt/internal/clock"
 	"github.com/openfresh/gosrt/internal/poll"
+	pollrt "github.com/openfresh/gosrt/internal/poll/runtime"
 	"github.com/openfresh/gosrt/internal/socktest"
 	"github.com/openfresh/gosrt/internal/testenv"
 )
@@ -157,6 +160,52 @@ var acceptTimeoutTests = []struct {
 	{50 * time.Millisecond, [2]error{nil, poll.ErrTimeout}},
 }
 
+func TestAcceptContext(t *testing.T) {
+	ln, err := newLocalListener("srt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	sl := ln.(*SRTListener)
+	deadline := time.Now().Add(time.Hour)
+	sl.SetDeadline(deadline)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		cancel()
+	}()
+	start := time.Now()
+	if _, err := sl.AcceptContext(ctx); err == nil || err.(*OpError).Err != errCanceled {
+		t.Fatalf("got %v; want %v", err, errCanceled)
+	}
+	if d := time.Since(start); d > 5*time.Second {
+		t.Errorf("canceled accept took %v", d)
+	}
+	if _, err := sl.AcceptContext(ctx); err == nil || err.(*OpError).Err != errCanceled {
+		t.Errorf("got %v for a done context; want %v", err, errCanceled)
+	}
+
+	// The listener carries on.
+	go func() {
+		c, err := Dial(ln.Addr().Network(), ln.Addr().String())
+		if err == nil {
+			defer c.Close()
+			time.Sleep(100 * time.Millisecond)
+		}
+	}()
+	ctx, cancel = context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	c, err := sl.AcceptContext(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.Close()
+	if !sl.fd.rdeadline.Equal(deadline) {
+		t.Errorf("got deadline %v; want %v put back", sl.fd.rdeadline, deadline)
+	}
+}
+
 func TestAcceptTimeout(t *testing.T) {
 	testenv.SkipFlaky(t, 17948)
 	t.Parallel()
@@ -213,3 +262,91 @@ func TestAcceptTimeout(t *testing.T) {
 	}
 	wg.Wait()
 }
+
+func TestReadContextCancel(t *testing.T) {
+	ln, err := newLocalListener("srt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+
+	connc := make(chan net.Conn, 1)
+	go func() {
+		c, err := ln.Accept()
+		if err != nil {
+			t.Error(err)
+		}
+		connc <- c // might be nil
+	}()
+	c, err := Dial(ln.Addr().Network(), ln.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	sc := <-connc
+	if sc == nil {
+		return
+	}
+	defer sc.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(50*time.Millisecond, cancel)
+	b := make([]byte, 128)
+	n, err := c.(*SRTConn).ReadContext(ctx, b)
+	if perr := parseReadError(err); perr != nil {
+		t.Error(perr)
+	}
+	if n != 0 || err == nil || err.(*OpError).Err != errCanceled {
+		t.Fatalf("got (%d, %v); want (0, %v)", n, err, errCanceled)
+	}
+
+	// The connection must survive the canceled read.
+	if _, err := sc.Write([]byte("CONTEXT TEST")); err != nil {
+		t.Fatal(err)
+	}
+	c.SetReadDeadline(time.Now().Add(someTimeout))
+	if _, err := c.(*SRTConn).ReadContext(context.Background(), b); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestReadDeadlineClock(t *testing.T) {
+	start := time.Now()
+	fake := clock.NewFake(start)
+	defer func(orig clock.Clock) { pollrt.Clock = orig }(pollrt.Clock)
+	pollrt.Clock = fake
+
+	c1, c2, err := Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c1.Close()
+	defer c2.Close()
+
+	// An hour of deadline passes at once.
+	if err := c2.SetReadDeadline(start.Add(time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+	errc := make(chan error, 1)
+	go func() {
+		_, err := c2.Read(make([]byte, 1500))
+		errc <- err
+	}()
+	select {
+	case err := <-errc:
+		t.Fatalf("Read returned %v before the deadline", err)
+	case <-time.After(50 * time.Millisecond):
+	}
+	fake.Advance(time.Hour)
+	select {
+	case err := <-errc:
+		if perr := parseReadError(err); perr != nil {
+			t.Error(perr)
+		}
+		if nerr, ok := err.(net.Error); !ok || !nerr.Timeout() {
+			t.Errorf("got %v; want a timeout", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Read still blocked past the deadline")
+	}
+}
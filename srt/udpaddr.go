@@ -0,0 +1,59 @@
+// Copyright (c) 2020 CyberAgent, Inc. All rights reserved.
+// https://github.com/openfresh/gosrt
+
+package srt
+
+import (
+	"net"
+	"os"
+	"syscall"
+
+	"github.com/openfresh/gosrt/srtapi"
+)
+
+// UDPAddr returns the local address of the UDP socket that carries the
+// packets of c, as the multiplexer bound it, for NAT traversal or
+// firewall rules to use. Unlike LocalAddr, it is read when called, and
+// when the socket is bound to the wildcard address, it holds the
+// address the system sends to the peer from, if it can tell.
+func (c *conn) UDPAddr() (*net.UDPAddr, error) {
+	if !c.ok() {
+		return nil, srtapi.EINVPARAM
+	}
+	return c.fd.udpAddr()
+}
+
+// UDPAddr returns the local address of the UDP socket l receives
+// connection requests on, as the multiplexer bound it.
+func (l *SRTListener) UDPAddr() (*net.UDPAddr, error) {
+	if !l.ok() {
+		return nil, srtapi.EINVPARAM
+	}
+	return l.fd.udpAddr()
+}
+
+func (fd *netFD) udpAddr() (*net.UDPAddr, error) {
+	var (
+		sa  syscall.Sockaddr
+		err error
+	)
+	if rerr := fd.pfd.RawControl(func(s int) { sa, err = srtapi.Getsockname(s) }); rerr != nil {
+		err = rerr
+	} else if err != nil {
+		err = os.NewSyscallError("getsockname", err)
+	}
+	if err != nil {
+		return nil, &OpError{Op: "udpaddr", Net: fd.net, Source: fd.laddr, Addr: fd.raddr, Err: err}
+	}
+	sra, ok := sockaddrToSRT(sa).(*SRTAddr)
+	if !ok {
+		return nil, &OpError{Op: "udpaddr", Net: fd.net, Source: fd.laddr, Addr: fd.raddr, Err: syscall.EAFNOSUPPORT}
+	}
+	a := &net.UDPAddr{IP: sra.IP, Port: sra.Port, Zone: sra.Zone}
+	if ra, ok := fd.raddr.(*SRTAddr); ok && a.IP.IsUnspecified() {
+		if ip := srtapi.RouteSource(&net.UDPAddr{IP: ra.IP, Port: ra.Port, Zone: ra.Zone}); ip != nil {
+			a.IP = ip
+		}
+	}
+	return a, nil
+}
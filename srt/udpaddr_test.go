@@ -0,0 +1,47 @@
+// Copyright (c) 2020 CyberAgent, Inc. All rights reserved.
+// https://github.com/openfresh/gosrt
+
+package srt
+
+import (
+	"net"
+	"testing"
+)
+
+func TestUDPAddr(t *testing.T) {
+	ln, err := Listen("srt4", ":0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	la, err := ln.(*SRTListener).UDPAddr()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if port := ln.Addr().(*SRTAddr).Port; la.Port != port || !la.IP.IsUnspecified() {
+		t.Errorf("got listener UDP address %v; want the wildcard address on port %d", la, port)
+	}
+
+	go func() {
+		c, err := ln.Accept()
+		if err == nil {
+			c.Close()
+		}
+	}()
+	c, err := Dial("srt4", (&net.UDPAddr{IP: net.IPv4(127, 0, 0, 1), Port: la.Port}).String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	a, err := c.(*SRTConn).UDPAddr()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if port := c.LocalAddr().(*SRTAddr).Port; a.Port != port || !a.IP.IsLoopback() {
+		t.Errorf("got caller UDP address %v; want a loopback address on port %d", a, port)
+	}
+
+	c.Close()
+	if _, err := c.(*SRTConn).UDPAddr(); err == nil {
+		t.Error("UDPAddr succeeded on a closed connection")
+	}
+}
@@ -0,0 +1,183 @@
+// Copyright (c) 2020 CyberAgent, Inc. All rights reserved.
+// https://github.com/openfresh/gosrt
+
+// Package srtadmin serves the connections and listeners of an
+// srt.Registry over HTTP as JSON, for operators to inspect a service
+// and drop connections without writing code for it. The handler is
+// mounted on any mux, under a prefix stripped with http.StripPrefix:
+//
+//	mux.Handle("/debug/srt/", http.StripPrefix("/debug/srt", srtadmin.NewHandler(registry)))
+//
+// It answers
+//
+//	GET    /conns           the open connections and their parameters
+//	GET    /conns/{id}      one connection, with its statistics
+//	DELETE /conns/{id}      closes the connection
+//	GET    /listeners       the open listeners
+//
+// where id is the SRT socket ID. Statistics are read without clearing
+// the counters the application reads with Stats. The handler has no
+// access control of its own.
+package srtadmin
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/openfresh/gosrt/srt"
+	"github.com/openfresh/gosrt/srtapi"
+)
+
+// A Conn describes a connection.
+type Conn struct {
+	ID       int    `json:"id"`
+	Local    string `json:"local"`
+	Remote   string `json:"remote"`
+	StreamID string `json:"streamid,omitempty"`
+
+	// Labels are those of the connection; see srt.WithLabels.
+	Labels srt.Labels `json:"labels,omitempty"`
+
+	// Params has the negotiated parameters of the connection, by
+	// option name; those the SRT library doesn't report are left out.
+	Params map[string]int64 `json:"params"`
+
+	// Stats is only set for a single connection.
+	Stats map[string]interface{} `json:"stats,omitempty"`
+}
+
+// A Listener describes a listener.
+type Listener struct {
+	ID    int    `json:"id"`
+	Local string `json:"local"`
+}
+
+// params are the options reported in Conn.Params.
+var params = []struct {
+	name string
+	opt  int
+}{
+	{"rcvlatency", srtapi.OptionRcvlatency},
+	{"peerlatency", srtapi.OptionPeerlatency},
+	{"maxbw", srtapi.OptionMaxbw},
+	{"inputbw", srtapi.OptionInputbw},
+	{"payloadsize", srtapi.OptionPayloadsize},
+	{"mss", srtapi.OptionMss},
+	{"pbkeylen", srtapi.OptionPbkeylen},
+	{"kmstate", srtapi.OptionKmstate},
+	{"transtype", srtapi.OptionTranstype},
+	{"peerversion", srtapi.OptionPeerversion},
+}
+
+// describe returns what c is, and its statistics if stats is set.
+func describe(c *srt.SRTConn, stats bool) Conn {
+	d := Conn{
+		ID:     c.SocketID(),
+		Local:  c.LocalAddr().String(),
+		Remote: c.RemoteAddr().String(),
+		Params: make(map[string]int64),
+	}
+	d.StreamID, _ = c.StreamID()
+	d.Labels = c.Labels()
+	rc, err := c.RawConn()
+	if err != nil {
+		return d
+	}
+	rc.Control(func(s srtapi.SrtSocket) {
+		for _, p := range params {
+			if v, err := srtapi.GetsockflagInt64(int(s), p.opt); err == nil {
+				d.Params[p.name] = v
+			}
+		}
+		if stats {
+			d.Stats = srtapi.GetStats(int(s), false)
+		}
+	})
+	return d
+}
+
+type handler struct {
+	r *srt.Registry
+}
+
+// NewHandler returns the handler serving the connections and listeners
+// of r.
+func NewHandler(r *srt.Registry) http.Handler {
+	return &handler{r}
+}
+
+func (h *handler) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	path := strings.Trim(req.URL.Path, "/")
+	switch {
+	case path == "conns":
+		if !allow(w, req, http.MethodGet) {
+			return
+		}
+		cs := h.r.Conns()
+		ds := make([]Conn, 0, len(cs))
+		for _, c := range cs {
+			ds = append(ds, describe(c, false))
+		}
+		writeJSON(w, ds)
+	case strings.HasPrefix(path, "conns/"):
+		id, err := strconv.Atoi(strings.TrimPrefix(path, "conns/"))
+		if err != nil {
+			http.NotFound(w, req)
+			return
+		}
+		if !allow(w, req, http.MethodGet, http.MethodDelete) {
+			return
+		}
+		c := h.r.Lookup(id)
+		if c == nil {
+			http.Error(w, "no such connection", http.StatusNotFound)
+			return
+		}
+		if req.Method == http.MethodDelete {
+			if err := c.Close(); err != nil {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+		writeJSON(w, describe(c, true))
+	case path == "listeners":
+		if !allow(w, req, http.MethodGet) {
+			return
+		}
+		ls := h.r.Listeners()
+		ds := make([]Listener, 0, len(ls))
+		for _, ln := range ls {
+			ds = append(ds, Listener{ID: ln.SocketID(), Local: ln.Addr().String()})
+		}
+		writeJSON(w, ds)
+	default:
+		http.NotFound(w, req)
+	}
+}
+
+// allow reports whether the method of req is one of methods, and
+// answers it with 405 if it isn't.
+func allow(w http.ResponseWriter, req *http.Request, methods ...string) bool {
+	for _, m := range methods {
+		if req.Method == m {
+			return true
+		}
+	}
+	w.Header().Set("Allow", strings.Join(methods, ", "))
+	http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+	return false
+}
+
+func writeJSON(w http.ResponseWriter, v interface{}) {
+	b, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(append(b, '\n'))
+}
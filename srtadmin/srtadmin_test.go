@@ -0,0 +1,101 @@
+// Copyright (c) 2020 CyberAgent, Inc. All rights reserved.
+// https://github.com/openfresh/gosrt
+
+package srtadmin
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/openfresh/gosrt/srt"
+)
+
+func TestHandler(t *testing.T) {
+	r := srt.NewRegistry()
+	ctx := srt.WithLabels(srt.WithRegistry(context.Background(), r), srt.Labels{"tenant": "acme"})
+	l, err := srt.ListenContext(ctx, "srt4", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	ln := l.(*srt.SRTListener)
+	d := srt.Dialer{}
+	caller, err := d.DialContext(srt.WithOptions(context.Background(), srt.Options("streamid", "feed")), "srt", ln.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer caller.Close()
+	ln.SetDeadline(time.Now().Add(10 * time.Second))
+	peer, err := ln.AcceptSRT()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer peer.Close()
+
+	srv := httptest.NewServer(http.StripPrefix("/srt", NewHandler(r)))
+	defer srv.Close()
+	get := func(path string, v interface{}) int {
+		t.Helper()
+		resp, err := http.Get(srv.URL + path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+		if v != nil && resp.StatusCode == http.StatusOK {
+			if err := json.NewDecoder(resp.Body).Decode(v); err != nil {
+				t.Fatal(err)
+			}
+		}
+		return resp.StatusCode
+	}
+
+	var ls []Listener
+	if get("/srt/listeners", &ls); len(ls) != 1 || ls[0].ID != ln.SocketID() || ls[0].Local != ln.Addr().String() {
+		t.Errorf("listeners = %+v; want %d on %v", ls, ln.SocketID(), ln.Addr())
+	}
+	var cs []Conn
+	if get("/srt/conns", &cs); len(cs) != 1 || cs[0].ID != peer.SocketID() || cs[0].StreamID != "feed" || cs[0].Labels["tenant"] != "acme" || cs[0].Stats != nil {
+		t.Fatalf("conns = %+v; want the accepted connection without stats, labeled", cs)
+	}
+	if _, ok := cs[0].Params["rcvlatency"]; !ok {
+		t.Errorf("params = %v; want rcvlatency", cs[0].Params)
+	}
+	id := strconv.Itoa(peer.SocketID())
+	var c Conn
+	if get("/srt/conns/"+id, &c); c.ID != peer.SocketID() || c.Stats == nil {
+		t.Errorf("conn = %+v; want it with stats", c)
+	}
+	if code := get("/srt/conns/1", nil); code != http.StatusNotFound {
+		t.Errorf("unknown connection: %d; want 404", code)
+	}
+
+	resp, err := http.Post(srv.URL+"/srt/conns", "text/plain", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusMethodNotAllowed {
+		t.Errorf("POST conns: %d; want 405", resp.StatusCode)
+	}
+
+	req, _ := http.NewRequest(http.MethodDelete, srv.URL+"/srt/conns/"+id, nil)
+	resp, err = http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusNoContent {
+		t.Errorf("DELETE: %d; want 204", resp.StatusCode)
+	}
+	if cs = nil; get("/srt/conns", &cs) != http.StatusOK || len(cs) != 0 {
+		t.Errorf("conns after DELETE = %+v; want none", cs)
+	}
+	if _, err := peer.Write([]byte("x")); err == nil {
+		t.Error("write on the deleted connection succeeded")
+	}
+}
@@ -0,0 +1,56 @@
+// Copyright (c) 2020 CyberAgent, Inc. All rights reserved.
+// https://github.com/openfresh/gosrt
+
+// +build !nosrtlib,!srtmock
+
+package srtapi
+
+// #include "compat.h"
+import "C"
+import (
+	"runtime"
+	"sync"
+)
+
+// HeaderVersion is the version of the libsrt headers gosrt was built
+// against, encoded as major<<16 | minor<<8 | patch.
+const HeaderVersion = C.SRT_VERSION_VALUE
+
+var featureSince = map[Feature]int{
+	FeatureListenCallback: 0x010400,
+	FeatureRejectReason:   0x010402,
+	FeatureRetransmitAlgo: 0x010402,
+	FeatureBindToDevice:   0x010402,
+	FeatureGroups:         0x010500,
+	FeatureCryptoMode:     0x010502,
+	FeatureSourceTime:     0x010402,
+}
+
+var (
+	libraryVersionOnce sync.Once
+	libraryVersion     int
+)
+
+// LibraryVersion returns the version of the libsrt loaded at run time,
+// encoded like HeaderVersion. It may be older than HeaderVersion when
+// a binary runs against a different shared library than it was built
+// with.
+func LibraryVersion() int {
+	libraryVersionOnce.Do(func() {
+		libraryVersion = int(C.srt_getversion())
+	})
+	return libraryVersion
+}
+
+// Has reports whether both the libsrt headers gosrt was built against
+// and the library it runs with provide f.
+func Has(f Feature) bool {
+	since, ok := featureSince[f]
+	if !ok || HeaderVersion < since || LibraryVersion() < since {
+		return false
+	}
+	if f == FeatureBindToDevice {
+		return runtime.GOOS == "linux"
+	}
+	return true
+}
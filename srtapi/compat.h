@@ -0,0 +1,149 @@
+// Copyright (c) 2020 CyberAgent, Inc. All rights reserved.
+// https://github.com/openfresh/gosrt
+
+#ifndef gosrt_compat_h
+#define gosrt_compat_h
+
+#include <stdlib.h>
+#include <string.h>
+#include <srt/srt.h>
+
+// Shims over the differences between the libsrt 1.4 and 1.5 headers,
+// so that gosrt builds against either. What the headers lack compiles
+// to a stub that fails, and Has reports it as missing.
+
+#ifndef SRT_MAKE_VERSION_VALUE
+#define SRT_MAKE_VERSION_VALUE(major, minor, patch) (((major) << 16) | ((minor) << 8) | (patch))
+#endif
+#ifndef SRT_VERSION_VALUE
+#define SRT_VERSION_VALUE SRT_MAKE_VERSION_VALUE(SRT_VERSION_MAJOR, SRT_VERSION_MINOR, SRT_VERSION_PATCH)
+#endif
+
+#define GOSRT_SINCE(major, minor, patch) (SRT_VERSION_VALUE >= SRT_MAKE_VERSION_VALUE(major, minor, patch))
+
+// Options the headers don't define are -1, which libsrt rejects with
+// SRT_EINVOP.
+#if GOSRT_SINCE(1, 4, 2)
+#define GOSRT_SRTO_RETRANSMITALGO SRTO_RETRANSMITALGO
+#define GOSRT_SRTO_BINDTODEVICE SRTO_BINDTODEVICE
+#else
+#define GOSRT_SRTO_RETRANSMITALGO -1
+#define GOSRT_SRTO_BINDTODEVICE -1
+#endif
+
+#if GOSRT_SINCE(1, 5, 0)
+#define GOSRT_SRTO_GROUPCONNECT SRTO_GROUPCONNECT
+#else
+#define GOSRT_SRTO_GROUPCONNECT -1
+#endif
+
+#if GOSRT_SINCE(1, 5, 2)
+#define GOSRT_SRTO_CRYPTOMODE SRTO_CRYPTOMODE
+#else
+#define GOSRT_SRTO_CRYPTOMODE -1
+#endif
+
+// Reject reasons the headers don't define are -1, which no connection
+// reports.
+#if GOSRT_SINCE(1, 4, 2)
+#define GOSRT_SRT_REJ_TIMEOUT SRT_REJ_TIMEOUT
+#else
+#define GOSRT_SRT_REJ_TIMEOUT -1
+#endif
+
+// hook is a srt_listen_callback_fn, which the headers declare from
+// 1.4.0.
+static inline int gosrt_listen_callback(SRTSOCKET lsn, void* hook, void* opaq)
+{
+#if GOSRT_SINCE(1, 4, 0)
+	return srt_listen_callback(lsn, (srt_listen_callback_fn*)hook, opaq);
+#else
+	return SRT_ERROR;
+#endif
+}
+
+// The reject reason of a listen callback, from 1.4.2.
+static inline int gosrt_setrejectreason(SRTSOCKET s, int reason)
+{
+#if GOSRT_SINCE(1, 4, 2)
+	return srt_setrejectreason(s, reason);
+#else
+	return SRT_ERROR;
+#endif
+}
+
+// Socket groups, which the headers declare from 1.5.0. Members are
+// passed as n addresses SIZE bytes apart in addrs, with their lengths
+// and weights, and their source addresses likewise in srcs, of length
+// 0 for none.
+static inline SRTSOCKET gosrt_create_group(int type)
+{
+#if GOSRT_SINCE(1, 5, 0)
+	return srt_create_group((SRT_GROUP_TYPE)type);
+#else
+	return SRT_INVALID_SOCK;
+#endif
+}
+
+static inline int gosrt_connect_group(SRTSOCKET group, const char* addrs, const char* srcs, size_t size, const int* lens, const int* srclens, const int* weights, int n)
+{
+#if GOSRT_SINCE(1, 5, 0)
+	SRT_SOCKGROUPCONFIG* cfg = (SRT_SOCKGROUPCONFIG*)calloc(n, sizeof(SRT_SOCKGROUPCONFIG));
+	if (cfg == NULL)
+		return SRT_ERROR;
+	for (int i = 0; i < n; i++) {
+		const struct sockaddr* src = srclens[i] > 0 ? (const struct sockaddr*)(srcs + i * size) : NULL;
+		cfg[i] = srt_prepare_endpoint(src, (const struct sockaddr*)(addrs + i * size), lens[i]);
+		cfg[i].weight = (uint16_t)weights[i];
+	}
+	int stat = srt_connect_group(group, cfg, n);
+	free(cfg);
+	return stat;
+#else
+	return SRT_ERROR;
+#endif
+}
+
+// The members of group, at most *n, whose count it sets *n to, in
+// parallel arrays; their peer addresses are SIZE bytes apart in peers.
+static inline int gosrt_group_data(SRTSOCKET group, int* ids, int* states, int* weights, int* memberstates, int* results, char* peers, size_t size, size_t* n)
+{
+#if GOSRT_SINCE(1, 5, 0)
+	size_t max = *n;
+	SRT_SOCKGROUPDATA* data = (SRT_SOCKGROUPDATA*)calloc(max > 0 ? max : 1, sizeof(SRT_SOCKGROUPDATA));
+	if (data == NULL)
+		return SRT_ERROR;
+	int stat = srt_group_data(group, data, n);
+	if (stat != SRT_ERROR) {
+		for (size_t i = 0; i < *n && i < max; i++) {
+			ids[i] = data[i].id;
+			states[i] = data[i].sockstate;
+			weights[i] = data[i].weight;
+			memberstates[i] = data[i].memberstate;
+			results[i] = data[i].result;
+			memcpy(peers + i * size, &data[i].peeraddr, size < sizeof(data[i].peeraddr) ? size : sizeof(data[i].peeraddr));
+		}
+	}
+	free(data);
+	return stat;
+#else
+	return SRT_ERROR;
+#endif
+}
+
+// srt_time_now, without which source times can't be related to the
+// current time; 0 stands for the time of sending.
+static inline int64_t gosrt_time_now(void)
+{
+#if GOSRT_SINCE(1, 4, 2)
+	return srt_time_now();
+#else
+	return 0;
+#endif
+}
+
+// SRT_MSGCTRL.srctime is unsigned before 1.4.2.
+static inline void gosrt_set_srctime(SRT_MSGCTRL* mc, int64_t t) { mc->srctime = t; }
+static inline int64_t gosrt_srctime(const SRT_MSGCTRL* mc) { return (int64_t)mc->srctime; }
+
+#endif /* gosrt_compat_h */
@@ -0,0 +1,27 @@
+// Copyright (c) 2020 CyberAgent, Inc. All rights reserved.
+// https://github.com/openfresh/gosrt
+
+// +build nosrtlib srtmock
+
+package srtapi
+
+// HeaderVersion is the libsrt version the native implementation
+// follows, encoded as major<<16 | minor<<8 | patch.
+const HeaderVersion = 0x010402
+
+// LibraryVersion returns HeaderVersion; there is no library to load.
+func LibraryVersion() int {
+	return HeaderVersion
+}
+
+// Has reports whether the native implementation provides f. Of the
+// optional features it has the listen callback and its reject
+// reasons, key refresh and drop events, source times, delivery and gap
+// reports, and Go congestion controls.
+func Has(f Feature) bool {
+	switch f {
+	case FeatureListenCallback, FeatureKeyEvents, FeatureSourceTime, FeatureDropEvents, FeatureDeliveryReports, FeatureGapReports, FeatureCongestionControl, FeatureRejectReason:
+		return true
+	}
+	return false
+}
@@ -0,0 +1,75 @@
+// Copyright (c) 2020 CyberAgent, Inc. All rights reserved.
+// https://github.com/openfresh/gosrt
+
+// +build !nosrtlib,!srtmock
+
+package srtapi
+
+/*
+#cgo linux LDFLAGS: -ldl
+
+// libsrt doesn't tell which crypto library it was built with, so the
+// process is searched for the symbols of each one it supports. Only
+// dynamically linked libraries can be found this way.
+#ifdef _WIN32
+static int gosrt_crypto_provider(void) { return 0; }
+static int gosrt_crypto_fips(int provider) { return 0; }
+#else
+#define _GNU_SOURCE
+#include <dlfcn.h>
+
+enum { gosrtUnknown, gosrtOpenSSL, gosrtGnuTLS, gosrtMbedTLS };
+
+static int gosrt_crypto_provider(void)
+{
+	if (dlsym(RTLD_DEFAULT, "mbedtls_aes_setkey_enc"))
+		return gosrtMbedTLS;
+	if (dlsym(RTLD_DEFAULT, "gnutls_global_init"))
+		return gosrtGnuTLS;
+	if (dlsym(RTLD_DEFAULT, "EVP_CIPHER_CTX_new"))
+		return gosrtOpenSSL;
+	return gosrtUnknown;
+}
+
+static int gosrt_crypto_fips(int provider)
+{
+	void* fn;
+	switch (provider) {
+	case gosrtOpenSSL:
+		// OpenSSL 3 replaced FIPS_mode with properties.
+		if ((fn = dlsym(RTLD_DEFAULT, "EVP_default_properties_is_fips_enabled")))
+			return ((int (*)(void*))fn)(NULL);
+		if ((fn = dlsym(RTLD_DEFAULT, "FIPS_mode")))
+			return ((int (*)(void))fn)();
+		break;
+	case gosrtGnuTLS:
+		if ((fn = dlsym(RTLD_DEFAULT, "gnutls_fips140_mode_enabled")))
+			return ((unsigned (*)(void))fn)() != 0;
+		break;
+	}
+	return 0;
+}
+#endif
+*/
+import "C"
+import "sync"
+
+var (
+	cryptoOnce     sync.Once
+	cryptoProvider string
+	cryptoFIPS     bool
+)
+
+// CryptoProvider returns the crypto library libsrt encrypts with,
+// CryptoUnknown if it can't be found, and whether that library runs
+// in FIPS mode. It can only find libraries loaded dynamically; a
+// libsrt statically linked with its crypto library is reported as
+// CryptoUnknown, and never as FIPS capable.
+func CryptoProvider() (provider string, fips bool) {
+	cryptoOnce.Do(func() {
+		p := C.gosrt_crypto_provider()
+		cryptoProvider = [...]string{CryptoUnknown, CryptoOpenSSL, CryptoGnuTLS, CryptoMbedTLS}[p]
+		cryptoFIPS = C.gosrt_crypto_fips(p) != 0
+	})
+	return cryptoProvider, cryptoFIPS
+}
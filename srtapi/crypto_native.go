@@ -0,0 +1,12 @@
+// Copyright (c) 2020 CyberAgent, Inc. All rights reserved.
+// https://github.com/openfresh/gosrt
+
+// +build nosrtlib srtmock
+
+package srtapi
+
+// CryptoProvider returns CryptoGo: the native implementation encrypts
+// with the Go standard library, which has no FIPS mode.
+func CryptoProvider() (provider string, fips bool) {
+	return CryptoGo, false
+}
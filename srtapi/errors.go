@@ -1,9 +1,12 @@
 // Copyright (c) 2018 CyberAgent, Inc. All rights reserved.
 // https://github.com/openfresh/gosrt
 
+// +build !nosrtlib,!srtmock
+
 package srtapi
 
-// #cgo LDFLAGS: -lsrt
+// #cgo !srtstatic,!srtprebuilt,!nopkgconfig pkg-config: srt
+// #cgo !srtstatic,!srtprebuilt,nopkgconfig LDFLAGS: -lsrt
 // #include <srt/srt.h>
 import "C"
 
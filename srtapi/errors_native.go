@@ -0,0 +1,50 @@
+// Copyright (c) 2020 CyberAgent, Inc. All rights reserved.
+// https://github.com/openfresh/gosrt
+
+// +build nosrtlib srtmock
+
+package srtapi
+
+import "github.com/openfresh/gosrt/internal/native"
+
+// Errors
+const (
+	EUNKNOWN        = Errno(native.EUNKNOWN)
+	SUCCESS         = Errno(native.SUCCESS)
+	ECONNSETUP      = Errno(native.ECONNSETUP)
+	ENOSERVER       = Errno(native.ENOSERVER)
+	ECONNREJ        = Errno(native.ECONNREJ)
+	ESOCKFAIL       = Errno(native.ESOCKFAIL)
+	ESECFAIL        = Errno(native.ESECFAIL)
+	ECONNFAIL       = Errno(native.ECONNFAIL)
+	ECONNLOST       = Errno(native.ECONNLOST)
+	ENOCONN         = Errno(native.ENOCONN)
+	ERESOURCE       = Errno(native.ERESOURCE)
+	ETHREAD         = Errno(native.ETHREAD)
+	ENOBUF          = Errno(native.ENOBUF)
+	EFILE           = Errno(native.EFILE)
+	EINVRDOFF       = Errno(native.EINVRDOFF)
+	ERDPERM         = Errno(native.ERDPERM)
+	EINVWROFF       = Errno(native.EINVWROFF)
+	EWRPERM         = Errno(native.EWRPERM)
+	EINVOP          = Errno(native.EINVOP)
+	EBOUNDSOCK      = Errno(native.EBOUNDSOCK)
+	ECONNSOCK       = Errno(native.ECONNSOCK)
+	EINVPARAM       = Errno(native.EINVPARAM)
+	EINVSOCK        = Errno(native.EINVSOCK)
+	EUNBOUNDSOCK    = Errno(native.EUNBOUNDSOCK)
+	ENOLISTEN       = Errno(native.ENOLISTEN)
+	ERDVNOSERV      = Errno(native.ERDVNOSERV)
+	ERDVUNBOUND     = Errno(native.ERDVUNBOUND)
+	EINVALMSGAPI    = Errno(native.EINVALMSGAPI)
+	EINVALBUFFERAPI = Errno(native.EINVALBUFFERAPI)
+	EDUPLISTEN      = Errno(native.EDUPLISTEN)
+	ELARGEMSG       = Errno(native.ELARGEMSG)
+	EINVPOLLID      = Errno(native.EINVPOLLID)
+	EASYNCFAIL      = Errno(native.EASYNCFAIL)
+	EASYNCSND       = Errno(native.EASYNCSND)
+	EASYNCRCV       = Errno(native.EASYNCRCV)
+	ETIMEOUT        = Errno(native.ETIMEOUT)
+	ECONGEST        = Errno(native.ECONGEST)
+	EPEERERR        = Errno(native.EPEERERR)
+)
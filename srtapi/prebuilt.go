@@ -0,0 +1,28 @@
+// Copyright (c) 2020 CyberAgent, Inc. All rights reserved.
+// https://github.com/openfresh/gosrt
+
+// +build srtprebuilt,!nosrtlib,!srtmock
+
+// With the srtprebuilt build tag, libsrt and its crypto library are
+// taken from third_party/prebuilt/<GOOS>-<GOARCH>, one prebuilt copy per
+// mobile ABI. gomobile sets the compiler flags of iOS builds itself, so
+// CGO_CFLAGS and CGO_LDFLAGS can't point there.
+
+package srtapi
+
+/*
+#cgo android,arm64 CPPFLAGS: -I${SRCDIR}/../third_party/prebuilt/android-arm64/include
+#cgo android,arm64 LDFLAGS: -L${SRCDIR}/../third_party/prebuilt/android-arm64/lib
+#cgo android,arm CPPFLAGS: -I${SRCDIR}/../third_party/prebuilt/android-arm/include
+#cgo android,arm LDFLAGS: -L${SRCDIR}/../third_party/prebuilt/android-arm/lib
+#cgo android,386 CPPFLAGS: -I${SRCDIR}/../third_party/prebuilt/android-386/include
+#cgo android,386 LDFLAGS: -L${SRCDIR}/../third_party/prebuilt/android-386/lib
+#cgo android,amd64 CPPFLAGS: -I${SRCDIR}/../third_party/prebuilt/android-amd64/include
+#cgo android,amd64 LDFLAGS: -L${SRCDIR}/../third_party/prebuilt/android-amd64/lib
+#cgo ios,arm64 CPPFLAGS: -I${SRCDIR}/../third_party/prebuilt/ios-arm64/include
+#cgo ios,arm64 LDFLAGS: -L${SRCDIR}/../third_party/prebuilt/ios-arm64/lib
+#cgo ios,amd64 CPPFLAGS: -I${SRCDIR}/../third_party/prebuilt/ios-amd64/include
+#cgo ios,amd64 LDFLAGS: -L${SRCDIR}/../third_party/prebuilt/ios-amd64/lib
+#cgo LDFLAGS: -lsrt -lcrypto
+*/
+import "C"
@@ -8,6 +8,244 @@
 
 package srtapi
 
+import "syscall"
+
 // Single-word zero for use when we need a valid pointer to 0 bytes.
 // See mksyscall.pl.
 var _zero uintptr
+
+// SRT log level
+const (
+	LogEmerg   = 0
+	LogAlert   = 1
+	LogFatal   = 2
+	LogError   = 3
+	LogWarning = 4
+	LogNote    = 5
+	LogInfo    = 6
+	LogDebug   = 7
+)
+
+// SRT log FA
+const (
+	LogFAGeneral = 0
+	LogFABstats  = 1
+	LogFAControl = 2
+	LogFAData    = 3
+	LogFATsbpd   = 4
+	LogFARexmit  = 5
+)
+
+// SRT log flags
+const (
+	LogFlagDisableTime       = 1
+	LogFlagDisableThreadname = 2
+	LogFlagDisableSeverity   = 4
+	LogFlagDisableEOF        = 8
+)
+
+// SRT const
+const (
+	InvalidSock          = -1
+	APIError             = -1
+	DefaultSendfileBlock = 364000
+	DefaultRecvfileBlock = 7280000
+)
+
+// A Feature is an SRT capability that not every supported libsrt
+// version has. Has reports whether the running SRT implementation
+// provides it.
+type Feature int
+
+// SRT features, with the libsrt version introducing them
+const (
+	FeatureListenCallback    Feature = iota // srt_listen_callback, 1.4.0
+	FeatureRetransmitAlgo                   // SRTO_RETRANSMITALGO, 1.4.2
+	FeatureBindToDevice                     // SRTO_BINDTODEVICE, 1.4.2, Linux only
+	FeatureGroups                           // socket groups, 1.5.0 built with bonding
+	FeatureCryptoMode                       // SRTO_CRYPTOMODE (AES-GCM), 1.5.2
+	FeatureKeyEvents                        // key refresh events, pure Go implementation only
+	FeatureSourceTime                       // srt_time_now for source times, 1.4.2
+	FeatureDropEvents                       // too-late drop events, pure Go implementation only
+	FeatureDeliveryReports                  // per-message delivery reports, pure Go implementation only
+	FeatureGapReports                       // receive gap reports, pure Go implementation only
+	FeatureCongestionControl                // Go congestion controls, pure Go implementation only
+	FeatureRejectReason                     // srt_setrejectreason in listen callbacks, 1.4.2
+)
+
+// Socket group types, the values of SRT_GROUP_TYPE
+const (
+	GroupBroadcast = 1
+	GroupBackup    = 2
+	GroupBalancing = 3
+)
+
+// GroupMask is the bit set in the IDs of socket groups, SRTGROUP_MASK.
+const GroupMask = 1 << 30
+
+// IsGroup reports whether s is the ID of a socket group, as those
+// dialed with ConnectGroup and those a listener with the
+// OptionGroupconnect option accepts are.
+func IsGroup(s int) bool {
+	return s != InvalidSock && s&GroupMask != 0
+}
+
+// Group member states, the values of SRT_MEMBERSTATUS
+const (
+	GroupMemberPending = 0 // connecting
+	GroupMemberIdle    = 1 // connected, standing by
+	GroupMemberRunning = 2 // connected, carrying data
+	GroupMemberBroken  = 3 // lost, about to leave the group
+)
+
+// GroupMember is an endpoint of ConnectGroup, like the
+// SRT_SOCKGROUPCONFIG of srt_prepare_endpoint.
+type GroupMember struct {
+	Addr syscall.Sockaddr
+
+	// Local is the source address of the member, nil for any.
+	Local syscall.Sockaddr
+
+	// Weight is the priority of the member in a backup group, and its
+	// share of the load in a balancing one.
+	Weight int
+}
+
+// GroupMemberStatus is a member of a socket group, as GroupData
+// reports it from the SRT_SOCKGROUPDATA of srt_group_data.
+type GroupMemberStatus struct {
+	ID     int
+	Peer   syscall.Sockaddr
+	Weight int
+
+	// State is the state of the member socket, StatusConnected say,
+	// and MemberState its state in the group, GroupMemberRunning say.
+	State       int
+	MemberState int
+
+	// Result is the result of the last operation of the group on the
+	// member, -1 if it failed.
+	Result int
+}
+
+// MsgCtrl carries the per-message information of SendMsg2 and
+// RecvMsg2, like SRT_MSGCTRL.
+type MsgCtrl struct {
+	// SrcTime is the time the message was produced at, in
+	// microseconds on the clock of TimeNow. Zero on send stands for
+	// the current time.
+	SrcTime int64
+
+	// PktSeq and MsgNo are the sequence number of the first packet
+	// and the message number of a received message. On send, MsgNo
+	// is set to the number of the message sent.
+	PktSeq int32
+	MsgNo  int32
+
+	// MsgTTL is how long, in milliseconds, a message sent may be
+	// sent or retransmitted before it is dropped; 0 stands for no
+	// limit.
+	// InOrder has it delivered only after the messages sent before
+	// it, which live mode always does.
+	MsgTTL  int32
+	InOrder bool
+
+	// Track has the delivery of a message sent reported to the
+	// callback of DeliveryCallback. Only the pure Go implementation
+	// tracks messages.
+	Track bool
+}
+
+// SendState is the state of the sending side of a socket, from the
+// fields of CBytePerfMon.
+type SendState struct {
+	BufferedPackets int     // pktSndBuf, unacknowledged packets
+	BufferedBytes   int     // byteSndBuf
+	BufferedMs      int     // msSndBuf, the time span of the buffer
+	AvailableBytes  int     // byteAvailSndBuf
+	LatencyMs       int     // msSndTsbPdDelay
+	RTTMs           float64 // msRTT
+	SendRate        float64 // mbpsSendRate, since the statistics were cleared
+	Bandwidth       float64 // mbpsBandwidth, the estimated link capacity; 0 if unknown
+
+	BytesSent                                                      int64 // byteSentTotal
+	PacketsSent, PacketsLost, PacketsRetransmitted, PacketsDropped int64 // totals
+}
+
+// RecvState is the state of the receiving side of a socket, from the
+// fields of CBytePerfMon.
+type RecvState struct {
+	BufferedPackets int   // pktRcvBuf, received but not delivered
+	BufferedBytes   int   // byteRcvBuf
+	BufferedMs      int   // msRcvBuf, the time span of the buffer
+	AvailableBytes  int   // byteAvailRcvBuf
+	LatencyMs       int   // msRcvTsbPdDelay
+	PacketsDropped  int64 // pktRcvDropTotal, given up on as too late
+	BytesReceived   int64 // byteRecvTotal
+}
+
+// Stats are the statistics of a socket, from CBytePerfMon.
+type Stats struct {
+	TimestampMs int64 // msTimeStamp, since the socket was created
+
+	// Interval counts since the statistics were last cleared, Total
+	// since the socket connected.
+	Interval, Total StatsCounters
+
+	RTTMs            float64 // msRTT
+	SendRate         float64 // mbpsSendRate
+	RecvRate         float64 // mbpsRecvRate
+	Bandwidth        float64 // mbpsBandwidth, the estimated link capacity; 0 if unknown
+	MaxBandwidth     float64 // mbpsMaxBW; 0 if unlimited or unknown
+	FlowWindow       int     // pktFlowWindow
+	CongestionWindow int     // pktCongestionWindow
+	FlightSize       int     // pktFlightSize, packets sent and not acknowledged
+
+	SendBuffer, RecvBuffer BufferStats
+}
+
+// StatsCounters are the counters of Stats, sent and received.
+type StatsCounters struct {
+	PacketsSent, PacketsReceived int64
+	PacketsSendLost              int64 // reported lost by the peer
+	PacketsRecvLost              int64 // found missing
+	PacketsRetransmitted         int64
+	PacketsRecvRetransmitted     int64
+	PacketsSendDropped           int64 // too late to send
+	PacketsRecvDropped           int64 // too late to deliver
+	PacketsBelated               int64 // arrived too late
+	BytesSent, BytesReceived     int64
+	BytesSendDropped             int64
+	BytesRecvDropped             int64
+}
+
+// BufferStats are the fields of Stats of a buffer.
+type BufferStats struct {
+	Packets        int // pktSndBuf or pktRcvBuf
+	Bytes          int // byteSndBuf or byteRcvBuf
+	Ms             int // msSndBuf or msRcvBuf, the time span of the buffer
+	AvailableBytes int // byteAvailSndBuf or byteAvailRcvBuf
+	LatencyMs      int // msSndTsbPdDelay or msRcvTsbPdDelay
+}
+
+// Crypto providers reported by CryptoProvider
+const (
+	CryptoUnknown = ""
+	CryptoOpenSSL = "openssl"
+	CryptoGnuTLS  = "gnutls"
+	CryptoMbedTLS = "mbedtls"
+	CryptoGo      = "go" // the pure Go implementation
+)
+
+// Key refresh events
+const (
+	KeyAnnounced = 1
+	KeySwitched  = 2
+	KeyRetired   = 3
+)
+
+// Encryption keys
+const (
+	KeyEven = 1
+	KeyOdd  = 2
+)
@@ -1,19 +1,29 @@
 // Copyright (c) 2018 CyberAgent, Inc. All rights reserved.
 // https://github.com/openfresh/gosrt
 
+//go:build !nosrtlib && !srtmock
+// +build !nosrtlib,!srtmock
+
 package srtapi
 
 /*
-#cgo LDFLAGS: -lsrt
+#cgo !srtstatic,!srtprebuilt,!nopkgconfig pkg-config: srt
+#cgo !srtstatic,!srtprebuilt,nopkgconfig LDFLAGS: -lsrt
+#cgo srtstatic,linux LDFLAGS: -Wl,--push-state,-Bstatic -lsrt -lcrypto -Wl,--pop-state -lstdc++ -lm -ldl -lpthread
+#cgo srtstatic,darwin LDFLAGS: -lsrt -lcrypto -lc++
+#cgo srtstatic,windows LDFLAGS: -Wl,-Bstatic -lsrt -lcrypto -lstdc++ -Wl,-Bdynamic -lws2_32 -lcrypt32
 
-#include <srt/srt.h>
+#include <stdlib.h>
+#include "compat.h"
 
 int SrtListenCallback_cgo(void* opaq, SRTSOCKET ns, int hsversion,
     const struct sockaddr* peeraddr, const char* streamid);
 */
 import "C"
 import (
+	"fmt"
 	"io"
+	"net"
 	"os"
 	"runtime"
 	"strconv"
@@ -21,9 +31,6 @@ import (
 	"unsafe"
 )
 
-// SrtListenCallbackFunc listen callback function type
-type SrtListenCallbackFunc func(ns int, hsversion int, peeraddr syscall.Sockaddr, streamid string) int
-
 var listenCallbackMap map[string]SrtListenCallbackFunc
 
 // Startup call srt_startup
@@ -95,7 +102,8 @@ func EpollUpdateUsock(epfd int, fd int, events int) (err error) {
 }
 
 // EpollWait call srt_epoll_wait
-func EpollWait(epfd int, rfds *SrtSocket, rfdslen *int, wfds *SrtSocket, wfdslen *int, timeout int64) (n int) {
+// A timeout is not an error; it returns 0 events instead.
+func EpollWait(epfd int, rfds *SrtSocket, rfdslen *int, wfds *SrtSocket, wfdslen *int, timeout int64) (n int, err error) {
 	runtime.LockOSThread()
 	defer runtime.UnlockOSThread()
 
@@ -103,15 +111,12 @@ func EpollWait(epfd int, rfds *SrtSocket, rfdslen *int, wfds *SrtSocket, wfdslen
 	wnum := C.int(*wfdslen)
 	n = int(C.srt_epoll_wait(C.int(epfd), (*C.SRTSOCKET)(unsafe.Pointer(rfds)), &rnum, (*C.SRTSOCKET)(unsafe.Pointer(wfds)), &wnum, C.int64_t(timeout), nil, nil, nil, nil))
 	if n < 0 {
-		err := getLastError()
-		switch err {
-		case ETIMEOUT:
-		default:
-			println("runtime: srt_epoll_wait on fd", epfd, "failed with", err.Error())
-			panic("runtime: netpoll failed")
+		if err = getLastError(); err == ETIMEOUT {
+			err = nil
 		}
 		ClearLastError()
 		n = 0
+		rnum, wnum = 0, 0
 	}
 	*rfdslen = int(rnum)
 	*wfdslen = int(wnum)
@@ -119,18 +124,15 @@ func EpollWait(epfd int, rfds *SrtSocket, rfdslen *int, wfds *SrtSocket, wfdslen
 }
 
 // EpollUwait call srt_epoll_uwait
-func EpollUwait(epfd int, fdsSet *SrtEpollEvent, fdsSize int, msTimeOut int64) (n int) {
+// A timeout is not an error; it returns 0 events instead.
+func EpollUwait(epfd int, fdsSet *SrtEpollEvent, fdsSize int, msTimeOut int64) (n int, err error) {
 	runtime.LockOSThread()
 	defer runtime.UnlockOSThread()
 
 	n = int(C.srt_epoll_uwait(C.int(epfd), (*C.SRT_EPOLL_EVENT)(fdsSet), C.int(fdsSize), C.int64_t(msTimeOut)))
 	if n < 0 {
-		err := getLastError()
-		switch err {
-		case ETIMEOUT:
-		default:
-			println("runtime: srt_epoll_uwait on fd", epfd, "failed with", err.Error())
-			panic("runtime: netpoll failed")
+		if err = getLastError(); err == ETIMEOUT {
+			err = nil
 		}
 		ClearLastError()
 		n = 0
@@ -259,6 +261,98 @@ func setsockopt(s int, level int, name int, val unsafe.Pointer, vallen uintptr)
 	return
 }
 
+func createGroup(typ int) (g int, err error) {
+	runtime.LockOSThread()
+	defer runtime.UnlockOSThread()
+	g = int(C.gosrt_create_group(C.int(typ)))
+	if g == InvalidSock {
+		err = getLastError()
+	}
+	return
+}
+
+func connectGroup(g int, addrs, srcs []byte, lens, srclens, weights []int) (err error) {
+	clens := make([]C.int, len(lens))
+	csrclens := make([]C.int, len(srclens))
+	cweights := make([]C.int, len(weights))
+	for i := range lens {
+		clens[i], csrclens[i], cweights[i] = C.int(lens[i]), C.int(srclens[i]), C.int(weights[i])
+	}
+	runtime.LockOSThread()
+	defer runtime.UnlockOSThread()
+	stat := C.gosrt_connect_group(C.SRTSOCKET(g), (*C.char)(unsafe.Pointer(&addrs[0])), (*C.char)(unsafe.Pointer(&srcs[0])), C.size_t(len(addrs)/len(lens)),
+		&clens[0], &csrclens[0], &cweights[0], C.int(len(lens)))
+	if stat == APIError {
+		err = getLastError()
+	}
+	return
+}
+
+// groupData returns the members of g, asking for at most n, and their
+// count, which may be more.
+func groupData(g int, n int) (ms []GroupMemberStatus, total int, err error) {
+	ids := make([]C.int, n)
+	states := make([]C.int, n)
+	weights := make([]C.int, n)
+	memberstates := make([]C.int, n)
+	results := make([]C.int, n)
+	peers := make([]syscall.RawSockaddrAny, n)
+	cn := C.size_t(n)
+	runtime.LockOSThread()
+	defer runtime.UnlockOSThread()
+	stat := C.gosrt_group_data(C.SRTSOCKET(g), &ids[0], &states[0], &weights[0], &memberstates[0], &results[0],
+		(*C.char)(unsafe.Pointer(&peers[0])), C.size_t(SizeofSockaddrAny), &cn)
+	total = int(cn)
+	if stat == APIError {
+		err = getLastError()
+		return nil, total, err
+	}
+	if total < n {
+		n = total
+	}
+	ms = make([]GroupMemberStatus, n)
+	for i := range ms {
+		ms[i] = GroupMemberStatus{
+			ID:          int(ids[i]),
+			Weight:      int(weights[i]),
+			State:       int(states[i]),
+			MemberState: int(memberstates[i]),
+			Result:      int(results[i]),
+		}
+		ms[i].Peer, _ = anyToSockaddr(&peers[i])
+	}
+	return ms, total, nil
+}
+
+// Getsockstate call srt_getsockstate, which unlike the SRTO_STATE
+// option also reports the state of groups
+func Getsockstate(s int) int {
+	return int(C.srt_getsockstate(C.SRTSOCKET(s)))
+}
+
+// RouteSource returns the local IP the system sends to addr from, or
+// nil if it has no route. Connecting a UDP socket sends nothing.
+func RouteSource(addr *net.UDPAddr) net.IP {
+	c, err := net.DialUDP("udp", nil, addr)
+	if err != nil {
+		return nil
+	}
+	defer c.Close()
+	return c.LocalAddr().(*net.UDPAddr).IP
+}
+
+// BindAcquire call srt_bind_acquire, binding s to the bound UDP socket
+// udp, which SRT takes over and closes with s
+func BindAcquire(s int, udp int) (err error) {
+	runtime.LockOSThread()
+	defer runtime.UnlockOSThread()
+	stat := C.srt_bind_acquire(C.SRTSOCKET(s), C.SYSSOCKET(udp))
+	if stat == APIError {
+		err = getLastError()
+	}
+	return
+}
+
 // Listen call srt_listen
 func Listen(s int, n int) (err error) {
 	runtime.LockOSThread()
@@ -270,8 +364,21 @@ func Listen(s int, n int) (err error) {
 	return
 }
 
+// srtListenCallback takes and returns C ints, as the gateway declares
+// it. A Go int is 64 bits wide on 64-bit targets, where the upper half
+// of the register holding a C int is undefined, so reading hsversion
+// as a Go int could pick up garbage.
+//
 //export srtListenCallback
-func srtListenCallback(opaq unsafe.Pointer, ns C.SRTSOCKET, hsversion int, peeraddr *C.struct_sockaddr, streamid *C.char) int {
+func srtListenCallback(opaq unsafe.Pointer, ns C.SRTSOCKET, hsversion C.int, peeraddr *C.struct_sockaddr, streamid *C.char) (ret C.int) {
+	// A panic can't unwind through libsrt, and would take every
+	// connection down with it; reject this handshake instead.
+	defer func() {
+		if r := recover(); r != nil {
+			println("srtListenCallback: callback panicked:", fmt.Sprint(r))
+			ret = -1
+		}
+	}()
 	key := C.GoString((*C.char)(*(*unsafe.Pointer)(opaq)))
 	callback, ok := listenCallbackMap[key]
 	if !ok {
@@ -283,23 +390,74 @@ func srtListenCallback(opaq unsafe.Pointer, ns C.SRTSOCKET, hsversion int, peera
 		println("srtListenCallback: anyToSockaddr failed with", err.Error())
 		return -1
 	}
-	return callback(int(ns), hsversion, sa, C.GoString(streamid))
+	return C.int(callback(int(ns), int(hsversion), sa, C.GoString(streamid)))
 }
 
 // ListenCallback call srt_listen_callback
 func ListenCallback(s int, callback SrtListenCallbackFunc) (err error) {
 	runtime.LockOSThread()
 	defer runtime.UnlockOSThread()
+	if !Has(FeatureListenCallback) {
+		return EINVOP
+	}
 	key := strconv.Itoa(s)
 	listenCallbackMap[key] = callback
 	cKey := C.CString(key)
-	stat := C.srt_listen_callback(C.SRTSOCKET(s), (*C.srt_listen_callback_fn)(C.SrtListenCallback_cgo), unsafe.Pointer(&cKey))
+	stat := C.gosrt_listen_callback(C.SRTSOCKET(s), unsafe.Pointer(C.SrtListenCallback_cgo), unsafe.Pointer(&cKey))
 	if stat == APIError {
 		err = getLastError()
 	}
 	return
 }
 
+// KeyEventCallback fails with EINVOP: libsrt doesn't report key
+// refreshes.
+func KeyEventCallback(s int, callback SrtKeyEventFunc) (err error) {
+	return EINVOP
+}
+
+// DropEventCallback fails with EINVOP: libsrt only counts the packets
+// it drops.
+func DropEventCallback(s int, callback SrtDropEventFunc) (err error) {
+	return EINVOP
+}
+
+// Gaps fails with EINVOP: libsrt only counts the packets it finds
+// missing.
+func Gaps(s int) ([]SrtGap, int64, int64, error) {
+	return nil, 0, 0, EINVOP
+}
+
+// RegisterCongestion fails with EINVOP: libsrt's congestion controls
+// are its own.
+func RegisterCongestion(name string, newCC func(CongestionParams) CongestionControl) error {
+	return EINVOP
+}
+
+// DeliveryCallback fails with EINVOP: libsrt doesn't report the
+// delivery of messages.
+func DeliveryCallback(s int, callback SrtDeliveryFunc) (err error) {
+	return EINVOP
+}
+
+// GetRejectReason call srt_getrejectreason
+func GetRejectReason(s int) int {
+	return int(C.srt_getrejectreason(C.SRTSOCKET(s)))
+}
+
+// SetRejectReason call srt_setrejectreason
+func SetRejectReason(s int, reason int) (err error) {
+	runtime.LockOSThread()
+	defer runtime.UnlockOSThread()
+	if !Has(FeatureRejectReason) {
+		return EINVOP
+	}
+	if C.gosrt_setrejectreason(C.SRTSOCKET(s), C.int(reason)) == APIError {
+		err = getLastError()
+	}
+	return
+}
+
 // Close call srt_close
 func Close(fd int) (err error) {
 	runtime.LockOSThread()
@@ -347,6 +505,63 @@ func sendfile(outfd int, r io.Reader, offset *int64, count int) (written int, er
 	return
 }
 
+func recvmsg2(fd int, p []byte, mc *MsgCtrl) (n int, err error) {
+	runtime.LockOSThread()
+	defer runtime.UnlockOSThread()
+	var _p0 unsafe.Pointer
+	if len(p) > 0 {
+		_p0 = unsafe.Pointer(&p[0])
+	} else {
+		_p0 = unsafe.Pointer(&_zero)
+	}
+	var m C.SRT_MSGCTRL
+	C.srt_msgctrl_init(&m)
+	r0 := C.srt_recvmsg2(C.SRTSOCKET(fd), (*C.char)(_p0), C.int(len(p)), &m)
+	n = int(r0)
+	if r0 == APIError {
+		err = getLastError()
+	} else if mc != nil {
+		*mc = MsgCtrl{SrcTime: int64(C.gosrt_srctime(&m)), PktSeq: int32(m.pktseq), MsgNo: int32(m.msgno)}
+	}
+	return
+}
+
+func sendmsg2(fd int, p []byte, mc *MsgCtrl) (n int, err error) {
+	runtime.LockOSThread()
+	defer runtime.UnlockOSThread()
+	var _p0 unsafe.Pointer
+	if len(p) > 0 {
+		_p0 = unsafe.Pointer(&p[0])
+	} else {
+		_p0 = unsafe.Pointer(&_zero)
+	}
+	var m C.SRT_MSGCTRL
+	C.srt_msgctrl_init(&m)
+	if mc != nil {
+		C.gosrt_set_srctime(&m, C.int64_t(mc.SrcTime))
+		if mc.MsgTTL > 0 {
+			m.msgttl = C.int(mc.MsgTTL)
+		}
+		if mc.InOrder {
+			m.inorder = 1
+		}
+	}
+	r0 := C.srt_sendmsg2(C.SRTSOCKET(fd), (*C.char)(_p0), C.int(len(p)), &m)
+	n = int(r0)
+	if r0 == APIError {
+		err = getLastError()
+	} else if mc != nil {
+		mc.MsgNo = int32(m.msgno)
+	}
+	return
+}
+
+// TimeNow call srt_time_now. It returns 0 with libsrt older than
+// 1.4.2.
+func TimeNow() int64 {
+	return int64(C.gosrt_time_now())
+}
+
 func write(fd int, p []byte) (n int, err error) {
 	runtime.LockOSThread()
 	defer runtime.UnlockOSThread()
@@ -368,6 +583,10 @@ func getlasterror() int {
 	return int(C.srt_getlasterror(nil))
 }
 
+func getLastError() error {
+	return Errno(getlasterror())
+}
+
 func strerror(code int, errnoval int) string {
 	return C.GoString(C.srt_strerror(C.int(code), C.int(errnoval)))
 }
@@ -392,6 +611,118 @@ func SetLogFlags(flags int) {
 	C.srt_setlogflags(C.int(flags))
 }
 
+// GetSendState returns the state of the sending side of fd, without
+// clearing its statistics
+func GetSendState(fd int) (SendState, error) {
+	var mon C.struct_CBytePerfMon
+	if C.srt_bstats(C.SRTSOCKET(fd), &mon, 0) == APIError {
+		return SendState{}, getLastError()
+	}
+	return SendState{
+		BufferedPackets:      int(mon.pktSndBuf),
+		BufferedBytes:        int(mon.byteSndBuf),
+		BufferedMs:           int(mon.msSndBuf),
+		AvailableBytes:       int(mon.byteAvailSndBuf),
+		LatencyMs:            int(mon.msSndTsbPdDelay),
+		RTTMs:                float64(mon.msRTT),
+		SendRate:             float64(mon.mbpsSendRate),
+		Bandwidth:            float64(mon.mbpsBandwidth),
+		BytesSent:            int64(mon.byteSentTotal),
+		PacketsSent:          int64(mon.pktSentTotal),
+		PacketsLost:          int64(mon.pktSndLossTotal),
+		PacketsRetransmitted: int64(mon.pktRetransTotal),
+		PacketsDropped:       int64(mon.pktSndDropTotal),
+	}, nil
+}
+
+// GetRecvState returns the state of the receiving side of fd, without
+// clearing its statistics
+func GetRecvState(fd int) (RecvState, error) {
+	var mon C.struct_CBytePerfMon
+	if C.srt_bstats(C.SRTSOCKET(fd), &mon, 0) == APIError {
+		return RecvState{}, getLastError()
+	}
+	return RecvState{
+		BufferedPackets: int(mon.pktRcvBuf),
+		BufferedBytes:   int(mon.byteRcvBuf),
+		BufferedMs:      int(mon.msRcvBuf),
+		AvailableBytes:  int(mon.byteAvailRcvBuf),
+		LatencyMs:       int(mon.msRcvTsbPdDelay),
+		PacketsDropped:  int64(mon.pktRcvDropTotal),
+		BytesReceived:   int64(mon.byteRecvTotal),
+	}, nil
+}
+
+// Bistats returns the statistics of fd, clearing the Interval counters
+// if clear is set, with the instantaneous values of the rates, RTT and
+// buffers if instantaneous is set, rather than their moving averages
+func Bistats(fd int, clear, instantaneous bool) (Stats, error) {
+	var mon C.struct_CBytePerfMon
+	var clearStats, instant C.int
+	if clear {
+		clearStats = 1
+	}
+	if instantaneous {
+		instant = 1
+	}
+	if C.srt_bistats(C.SRTSOCKET(fd), &mon, clearStats, instant) == APIError {
+		return Stats{}, getLastError()
+	}
+	return Stats{
+		TimestampMs: int64(mon.msTimeStamp),
+		Interval: StatsCounters{
+			PacketsSent:              int64(mon.pktSent),
+			PacketsReceived:          int64(mon.pktRecv),
+			PacketsSendLost:          int64(mon.pktSndLoss),
+			PacketsRecvLost:          int64(mon.pktRcvLoss),
+			PacketsRetransmitted:     int64(mon.pktRetrans),
+			PacketsRecvRetransmitted: int64(mon.pktRcvRetrans),
+			PacketsSendDropped:       int64(mon.pktSndDrop),
+			PacketsRecvDropped:       int64(mon.pktRcvDrop),
+			PacketsBelated:           int64(mon.pktRcvBelated),
+			BytesSent:                int64(mon.byteSent),
+			BytesReceived:            int64(mon.byteRecv),
+			BytesSendDropped:         int64(mon.byteSndDrop),
+			BytesRecvDropped:         int64(mon.byteRcvDrop),
+		},
+		Total: StatsCounters{
+			PacketsSent:          int64(mon.pktSentTotal),
+			PacketsReceived:      int64(mon.pktRecvTotal),
+			PacketsSendLost:      int64(mon.pktSndLossTotal),
+			PacketsRecvLost:      int64(mon.pktRcvLossTotal),
+			PacketsRetransmitted: int64(mon.pktRetransTotal),
+			PacketsSendDropped:   int64(mon.pktSndDropTotal),
+			PacketsRecvDropped:   int64(mon.pktRcvDropTotal),
+			BytesSent:            int64(mon.byteSentTotal),
+			BytesReceived:        int64(mon.byteRecvTotal),
+			BytesSendDropped:     int64(mon.byteSndDropTotal),
+			BytesRecvDropped:     int64(mon.byteRcvDropTotal),
+		},
+		RTTMs:            float64(mon.msRTT),
+		SendRate:         float64(mon.mbpsSendRate),
+		RecvRate:         float64(mon.mbpsRecvRate),
+		Bandwidth:        float64(mon.mbpsBandwidth),
+		MaxBandwidth:     float64(mon.mbpsMaxBW),
+		FlowWindow:       int(mon.pktFlowWindow),
+		CongestionWindow: int(mon.pktCongestionWindow),
+		FlightSize:       int(mon.pktFlightSize),
+		SendBuffer: BufferStats{
+			Packets:        int(mon.pktSndBuf),
+			Bytes:          int(mon.byteSndBuf),
+			Ms:             int(mon.msSndBuf),
+			AvailableBytes: int(mon.byteAvailSndBuf),
+			LatencyMs:      int(mon.msSndTsbPdDelay),
+		},
+		RecvBuffer: BufferStats{
+			Packets:        int(mon.pktRcvBuf),
+			Bytes:          int(mon.byteRcvBuf),
+			Ms:             int(mon.msRcvBuf),
+			AvailableBytes: int(mon.byteAvailRcvBuf),
+			LatencyMs:      int(mon.msRcvTsbPdDelay),
+		},
+	}, nil
+}
+
 func GetStats(fd int, clear bool) map[string]interface{} {
 	var mon C.struct_CBytePerfMon
 	clearStats := 0
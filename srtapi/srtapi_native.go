@@ -0,0 +1,621 @@
+// Copyright (c) 2020 CyberAgent, Inc. All rights reserved.
+// https://github.com/openfresh/gosrt
+
+//go:build nosrtlib || srtmock
+// +build nosrtlib srtmock
+
+package srtapi
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+	"syscall"
+	"time"
+	"unsafe"
+
+	"github.com/openfresh/gosrt/internal/native"
+)
+
+// This file implements the API on top of the Go implementation of SRT in
+// internal/native instead of libsrt. It only supports live mode.
+
+// errno converts the errors of the native implementation.
+func errno(err error) error {
+	if e, ok := err.(native.Error); ok {
+		return Errno(e)
+	}
+	return err
+}
+
+// Startup initializes the native SRT implementation
+func Startup() (err error) {
+	return errno(native.Startup())
+}
+
+// Cleanup releases the resources of the native SRT implementation
+func Cleanup() (err error) {
+	return errno(native.Cleanup())
+}
+
+// EpollCreate creates an epoll container
+func EpollCreate() (epfd int, err error) {
+	epfd, err = native.EpollCreate()
+	return epfd, errno(err)
+}
+
+// EpollAddUsock adds fd to an epoll container
+func EpollAddUsock(epfd int, fd int, events int) (err error) {
+	return errno(native.EpollAdd(epfd, fd, uint32(events)))
+}
+
+// EpollRemoveUsock removes fd from an epoll container
+func EpollRemoveUsock(epfd int, fd int) (err error) {
+	return errno(native.EpollRemove(epfd, fd))
+}
+
+// EpollUpdateUsock changes the events an epoll container waits for on fd
+func EpollUpdateUsock(epfd int, fd int, events int) (err error) {
+	return errno(native.EpollUpdate(epfd, fd, uint32(events)))
+}
+
+func epollTimeout(ms int64) time.Duration {
+	if ms < 0 {
+		return -1
+	}
+	return time.Duration(ms) * time.Millisecond
+}
+
+// EpollWait waits for sockets to become readable or writable.
+// A timeout is not an error; it returns 0 events instead.
+func EpollWait(epfd int, rfds *SrtSocket, rfdslen *int, wfds *SrtSocket, wfdslen *int, timeout int64) (n int, err error) {
+	rmax, wmax := *rfdslen, *wfdslen
+	if rfds == nil {
+		rmax = 0
+	}
+	if wfds == nil {
+		wmax = 0
+	}
+	// An event may take a slot in both arrays, and edge triggered
+	// ones are consumed once reported: take no more than fit.
+	max := rmax
+	if max == 0 || wmax > 0 && wmax < max {
+		max = wmax
+	}
+	*rfdslen, *wfdslen = 0, 0
+	evs, err := native.EpollWait(epfd, max, epollTimeout(timeout))
+	if err != nil {
+		return 0, errno(err)
+	}
+	r := (*[1 << 20]SrtSocket)(unsafe.Pointer(rfds))
+	w := (*[1 << 20]SrtSocket)(unsafe.Pointer(wfds))
+	for _, ev := range evs {
+		if ev.Events&(native.EpollIn|native.EpollErr) != 0 && *rfdslen < rmax {
+			r[*rfdslen] = SrtSocket(ev.Fd)
+			*rfdslen++
+		}
+		if ev.Events&(native.EpollOut|native.EpollErr) != 0 && *wfdslen < wmax {
+			w[*wfdslen] = SrtSocket(ev.Fd)
+			*wfdslen++
+		}
+	}
+	return len(evs), nil
+}
+
+// EpollUwait waits for events on the sockets of an epoll container.
+// A timeout is not an error; it returns 0 events instead.
+func EpollUwait(epfd int, fdsSet *SrtEpollEvent, fdsSize int, msTimeOut int64) (n int, err error) {
+	evs, err := native.EpollWait(epfd, fdsSize, epollTimeout(msTimeOut))
+	if err != nil {
+		return 0, errno(err)
+	}
+	set := (*[1 << 20]SrtEpollEvent)(unsafe.Pointer(fdsSet))
+	for i, ev := range evs {
+		set[i] = SrtEpollEvent{fd: int32(ev.Fd), events: int32(ev.Events)}
+	}
+	return len(evs), nil
+}
+
+// GetFdFromEpollEvent return fd from SrtEpollEvent
+func GetFdFromEpollEvent(fds *SrtEpollEvent) SrtSocket {
+	return SrtSocket(fds.fd)
+}
+
+// GetEventsFromEpollEvent return events from SrtEpollEvent
+func GetEventsFromEpollEvent(fds *SrtEpollEvent) int {
+	return int(fds.events)
+}
+
+// EpollSet sets the flags of an epoll container
+func EpollSet(epfd int, flags int) (oflags int, err error) {
+	oflags, err = native.EpollSet(epfd, flags)
+	return oflags, errno(err)
+}
+
+// udpAddr converts a raw socket address made by sockaddr.
+func udpAddr(addr unsafe.Pointer) (*net.UDPAddr, error) {
+	sa, err := anyToSockaddr((*syscall.RawSockaddrAny)(addr))
+	if err != nil {
+		return nil, err
+	}
+	switch sa := sa.(type) {
+	case *syscall.SockaddrInet4:
+		return &net.UDPAddr{IP: append(net.IP(nil), sa.Addr[:]...), Port: sa.Port}, nil
+	case *syscall.SockaddrInet6:
+		return &net.UDPAddr{IP: append(net.IP(nil), sa.Addr[:]...), Port: sa.Port}, nil
+	}
+	return nil, syscall.EAFNOSUPPORT
+}
+
+func toSockaddr(addr *net.UDPAddr) syscall.Sockaddr {
+	if ip4 := addr.IP.To4(); ip4 != nil {
+		sa := &syscall.SockaddrInet4{Port: addr.Port}
+		copy(sa.Addr[:], ip4)
+		return sa
+	}
+	sa := &syscall.SockaddrInet6{Port: addr.Port}
+	copy(sa.Addr[:], addr.IP.To16())
+	return sa
+}
+
+// putSockaddr stores addr in rsa, the way libsrt fills in addresses.
+func putSockaddr(rsa *syscall.RawSockaddrAny, addrlen *_Socklen, addr *net.UDPAddr) error {
+	ptr, n, err := sockaddr(toSockaddr(addr))
+	if err != nil {
+		return err
+	}
+	if n > *addrlen {
+		return EINVPARAM
+	}
+	copy((*[SizeofSockaddrAny]byte)(unsafe.Pointer(rsa))[:n], (*[SizeofSockaddrAny]byte)(ptr)[:n])
+	*addrlen = n
+	return nil
+}
+
+func accept(s int, rsa *syscall.RawSockaddrAny, addrlen *_Socklen) (fd int, err error) {
+	fd, addr, err := native.Accept(s)
+	if err != nil {
+		return fd, errno(err)
+	}
+	if err = putSockaddr(rsa, addrlen, addr); err != nil {
+		native.Close(fd)
+		return -1, err
+	}
+	return fd, nil
+}
+
+func getsockname(s int, rsa *syscall.RawSockaddrAny, addrlen *_Socklen) (err error) {
+	addr, err := native.Sockname(s)
+	if err != nil {
+		return errno(err)
+	}
+	return putSockaddr(rsa, addrlen, addr)
+}
+
+func getpeername(s int, rsa *syscall.RawSockaddrAny, addrlen *_Socklen) (err error) {
+	addr, err := native.Peername(s)
+	if err != nil {
+		return errno(err)
+	}
+	return putSockaddr(rsa, addrlen, addr)
+}
+
+func bind(s int, addr unsafe.Pointer, addrlen _Socklen) (err error) {
+	a, err := udpAddr(addr)
+	if err != nil {
+		return err
+	}
+	return errno(native.Bind(s, a))
+}
+
+func connect(s int, addr unsafe.Pointer, addrlen _Socklen) (err error) {
+	a, err := udpAddr(addr)
+	if err != nil {
+		return err
+	}
+	return errno(native.Connect(s, a))
+}
+
+func socket() (fd int, err error) {
+	fd, err = native.Socket()
+	return fd, errno(err)
+}
+
+func getsockflag(s int, name int, val unsafe.Pointer, vallen *_Socklen) (err error) {
+	v, err := native.GetOption(s, name)
+	if err != nil {
+		return errno(err)
+	}
+	buf := (*[1 << 16]byte)(val)[:*vallen:*vallen]
+	switch v := v.(type) {
+	case int32:
+		if len(buf) < 4 {
+			return EINVPARAM
+		}
+		binary.LittleEndian.PutUint32(buf, uint32(v))
+		*vallen = 4
+	case int64:
+		if len(buf) < 8 {
+			return EINVPARAM
+		}
+		binary.LittleEndian.PutUint64(buf, uint64(v))
+		*vallen = 8
+	case bool:
+		if len(buf) < 4 {
+			return EINVPARAM
+		}
+		var n uint32
+		if v {
+			n = 1
+		}
+		binary.LittleEndian.PutUint32(buf, n)
+		*vallen = 4
+	case string:
+		if len(buf) < len(v) {
+			return EINVPARAM
+		}
+		*vallen = _Socklen(copy(buf, v))
+	}
+	return nil
+}
+
+func setsockflag(s int, name int, val unsafe.Pointer, vallen uintptr) (err error) {
+	kind, ok := native.OptionKind(name)
+	if !ok {
+		return EINVOP
+	}
+	buf := (*[1 << 16]byte)(val)[:vallen:vallen]
+	var v interface{}
+	switch {
+	case kind == native.KindString:
+		v = string(buf)
+	case vallen == 1:
+		v = int32(buf[0])
+	case vallen == 4:
+		v = int32(binary.LittleEndian.Uint32(buf))
+	case vallen == 8 && kind == native.KindInt64:
+		v = int64(binary.LittleEndian.Uint64(buf))
+	default:
+		return EINVPARAM
+	}
+	return errno(native.SetOption(s, name, v))
+}
+
+func getsockopt(s int, level int, name int, val unsafe.Pointer, vallen *_Socklen) (err error) {
+	return getsockflag(s, name, val, vallen)
+}
+
+func setsockopt(s int, level int, name int, val unsafe.Pointer, vallen uintptr) (err error) {
+	return setsockflag(s, name, val, vallen)
+}
+
+func createGroup(typ int) (g int, err error) {
+	return InvalidSock, EINVOP
+}
+
+func connectGroup(g int, addrs, srcs []byte, lens, srclens, weights []int) (err error) {
+	return EINVOP
+}
+
+func groupData(g int, n int) (ms []GroupMemberStatus, total int, err error) {
+	return nil, 0, EINVOP
+}
+
+// Getsockstate returns the state of s
+func Getsockstate(s int) int {
+	v, err := native.GetOption(s, native.OptState)
+	if err != nil {
+		return StatusNonexist
+	}
+	n, _ := v.(int32)
+	return int(n)
+}
+
+// RouteSource returns the local IP the system sends to addr from, or
+// nil if it has no route; in the srtmock build, that of the in-memory
+// network.
+func RouteSource(addr *net.UDPAddr) net.IP {
+	return native.RouteSource(addr)
+}
+
+// BindAcquire binds s to the bound UDP socket udp, which s takes over.
+// It fails with EINVOP in the in-memory network of the srtmock build.
+func BindAcquire(s int, udp int) (err error) {
+	return errno(native.BindAcquire(s, udp))
+}
+
+// Listen makes s listen for connections
+func Listen(s int, n int) (err error) {
+	return errno(native.Listen(s, n))
+}
+
+// ListenCallback installs the callback consulted before accepting a
+// connection on listener s
+func ListenCallback(s int, callback SrtListenCallbackFunc) (err error) {
+	return errno(native.SetListenCallback(s, func(ns, hsversion int, peer *net.UDPAddr, streamid string) (ret int) {
+		defer func() {
+			if r := recover(); r != nil {
+				println("srtListenCallback: callback panicked:", fmt.Sprint(r))
+				ret = -1
+			}
+		}()
+		return callback(ns, hsversion, toSockaddr(peer), streamid)
+	}))
+}
+
+// KeyEventCallback installs the callback notified of the key refreshes
+// of s
+func KeyEventCallback(s int, callback SrtKeyEventFunc) (err error) {
+	return errno(native.SetKeyEventHandler(s, func(ev native.KeyEvent) {
+		callback(ev.Kind, ev.Key, ev.Sender)
+	}))
+}
+
+// DropEventCallback installs the callback notified of the packets s
+// drops as too late
+func DropEventCallback(s int, callback SrtDropEventFunc) (err error) {
+	return errno(native.SetDropHandler(s, func(ev native.DropEvent) {
+		callback(int32(ev.First), int32(ev.Last), ev.Packets, ev.Sender)
+	}))
+}
+
+// Gaps returns the latest receive gaps of s, oldest first, and the
+// number of gaps and of packets missing in them since it connected
+func Gaps(s int) ([]SrtGap, int64, int64, error) {
+	gaps, n, pkts, err := native.Gaps(s)
+	if err != nil {
+		return nil, 0, 0, errno(err)
+	}
+	ret := make([]SrtGap, len(gaps))
+	for i, g := range gaps {
+		ret[i] = SrtGap{
+			First:     int32(g.First),
+			Last:      int32(g.Last),
+			Packets:   g.Packets,
+			Detected:  g.Detected,
+			Recovered: g.Recovered,
+			Dropped:   g.Dropped,
+			Resolved:  g.Resolved,
+		}
+	}
+	return ret, n, pkts, nil
+}
+
+// RegisterCongestion makes newCC the congestion control named name, for
+// the sockets given it as OptionCongestion
+func RegisterCongestion(name string, newCC func(CongestionParams) CongestionControl) error {
+	return errno(native.RegisterCongestion(name, func(p native.CongestionParams) native.CongestionControl {
+		return newCC(CongestionParams{PayloadSize: p.PayloadSize, MaxBW: p.MaxBW, MaxWindow: p.MaxWindow})
+	}))
+}
+
+// DeliveryCallback installs the callback notified of the delivery of
+// the messages of s sent with MsgCtrl.Track
+func DeliveryCallback(s int, callback SrtDeliveryFunc) (err error) {
+	return errno(native.SetDeliveryHandler(s, func(msgno uint32, delivered bool) {
+		callback(int32(msgno), delivered)
+	}))
+}
+
+// GetRejectReason returns why the connection of s was rejected
+func GetRejectReason(s int) int {
+	return native.RejectReason(s)
+}
+
+// SetRejectReason sets the reason a listen callback rejects s for
+func SetRejectReason(s int, reason int) (err error) {
+	return errno(native.SetRejectReason(s, reason))
+}
+
+// Close closes fd
+func Close(fd int) (err error) {
+	return errno(native.Close(fd))
+}
+
+func read(fd int, p []byte) (n int, err error) {
+	n, err = native.Recv(fd, p)
+	return n, errno(err)
+}
+
+func recvmsg2(fd int, p []byte, mc *MsgCtrl) (n int, err error) {
+	n, info, err := native.RecvMsg(fd, p)
+	if err == nil && mc != nil {
+		*mc = MsgCtrl{SrcTime: info.SrcTime, PktSeq: int32(info.Seq), MsgNo: int32(info.MsgNo)}
+	}
+	return n, errno(err)
+}
+
+func sendmsg2(fd int, p []byte, mc *MsgCtrl) (n int, err error) {
+	if mc == nil {
+		n, err = native.SendMsg(fd, p, 0)
+		return n, errno(err)
+	}
+	n, msgno, err := native.SendMsgCtrl(fd, p, native.MsgCtrl{
+		SrcTime: mc.SrcTime,
+		TTL:     time.Duration(mc.MsgTTL) * time.Millisecond,
+		Track:   mc.Track,
+	})
+	if err == nil {
+		mc.MsgNo = int32(msgno)
+	}
+	return n, errno(err)
+}
+
+// TimeNow returns the current time on the clock of source times, in
+// microseconds
+func TimeNow() int64 {
+	return native.TimeNow()
+}
+
+func sendfile(outfd int, r io.Reader, offset *int64, count int) (written int, err error) {
+	// Sending files needs file mode, which isn't implemented; the
+	// caller falls back to copying.
+	return 0, nil
+}
+
+func write(fd int, p []byte) (n int, err error) {
+	n, err = native.Send(fd, p)
+	return n, errno(err)
+}
+
+func strerror(code int, errnoval int) string {
+	return native.Error(code).Error()
+}
+
+// ClearLastError does nothing, as errors are returned directly
+func ClearLastError() {}
+
+// SetLogLevel does nothing; the native implementation doesn't log
+func SetLogLevel(level int) {}
+
+// AddLogFA does nothing; the native implementation doesn't log
+func AddLogFA(fa int) {}
+
+// SetLogFlags does nothing; the native implementation doesn't log
+func SetLogFlags(flags int) {}
+
+// GetSendState returns the state of the sending side of fd, without
+// clearing its statistics. The link capacity isn't estimated.
+func GetSendState(fd int) (SendState, error) {
+	mon, err := native.Bstats(fd, false)
+	if err != nil {
+		return SendState{}, errno(err)
+	}
+	return SendState{
+		BufferedPackets:      mon.PktSndBuf,
+		BufferedBytes:        mon.ByteSndBuf,
+		BufferedMs:           mon.MsSndBuf,
+		AvailableBytes:       mon.ByteAvailSndBuf,
+		LatencyMs:            mon.MsSndTsbPdDelay,
+		RTTMs:                mon.MsRTT,
+		SendRate:             mon.MbpsSendRate,
+		BytesSent:            mon.ByteSentTotal,
+		PacketsSent:          mon.PktSentTotal,
+		PacketsLost:          mon.PktSndLossTotal,
+		PacketsRetransmitted: mon.PktRetransTotal,
+		PacketsDropped:       mon.PktSndDropTotal,
+	}, nil
+}
+
+// GetRecvState returns the state of the receiving side of fd, without
+// clearing its statistics
+func GetRecvState(fd int) (RecvState, error) {
+	mon, err := native.Bstats(fd, false)
+	if err != nil {
+		return RecvState{}, errno(err)
+	}
+	return RecvState{
+		BufferedPackets: mon.PktRcvBuf,
+		BufferedBytes:   mon.ByteRcvBuf,
+		BufferedMs:      mon.MsRcvBuf,
+		AvailableBytes:  mon.ByteAvailRcvBuf,
+		LatencyMs:       mon.MsRcvTsbPdDelay,
+		PacketsDropped:  mon.PktRcvDropTotal,
+		BytesReceived:   mon.ByteRecvTotal,
+	}, nil
+}
+
+// Bistats returns the statistics of fd, clearing the Interval counters
+// if clear is set. The pure Go implementation has no moving averages:
+// its values are all instantaneous
+func Bistats(fd int, clear, instantaneous bool) (Stats, error) {
+	mon, err := native.Bstats(fd, clear)
+	if err != nil {
+		return Stats{}, errno(err)
+	}
+	return Stats{
+		TimestampMs: mon.MsTimeStamp,
+		Interval: StatsCounters{
+			PacketsSent:              mon.PktSent,
+			PacketsReceived:          mon.PktRecv,
+			PacketsSendLost:          mon.PktSndLoss,
+			PacketsRecvLost:          mon.PktRcvLoss,
+			PacketsRetransmitted:     mon.PktRetrans,
+			PacketsRecvRetransmitted: mon.PktRcvRetrans,
+			PacketsSendDropped:       mon.PktSndDrop,
+			PacketsRecvDropped:       mon.PktRcvDrop,
+			PacketsBelated:           mon.PktRcvBelated,
+			BytesSent:                mon.ByteSent,
+			BytesReceived:            mon.ByteRecv,
+		},
+		Total: StatsCounters{
+			PacketsSent:              mon.PktSentTotal,
+			PacketsReceived:          mon.PktRecvTotal,
+			PacketsSendLost:          mon.PktSndLossTotal,
+			PacketsRecvLost:          mon.PktRcvLossTotal,
+			PacketsRetransmitted:     mon.PktRetransTotal,
+			PacketsRecvRetransmitted: mon.PktRcvRetransTotal,
+			PacketsSendDropped:       mon.PktSndDropTotal,
+			PacketsRecvDropped:       mon.PktRcvDropTotal,
+			PacketsBelated:           mon.PktRcvBelatedTotal,
+			BytesSent:                mon.ByteSentTotal,
+			BytesReceived:            mon.ByteRecvTotal,
+			BytesSendDropped:         mon.ByteSndDropTotal,
+		},
+		RTTMs:            mon.MsRTT,
+		SendRate:         mon.MbpsSendRate,
+		RecvRate:         mon.MbpsRecvRate,
+		FlowWindow:       mon.PktFlowWindow,
+		CongestionWindow: mon.PktCongestionWindow,
+		FlightSize:       mon.PktFlightSize,
+		SendBuffer: BufferStats{
+			Packets:        mon.PktSndBuf,
+			Bytes:          mon.ByteSndBuf,
+			Ms:             mon.MsSndBuf,
+			AvailableBytes: mon.ByteAvailSndBuf,
+			LatencyMs:      mon.MsSndTsbPdDelay,
+		},
+		RecvBuffer: BufferStats{
+			Packets:        mon.PktRcvBuf,
+			Bytes:          mon.ByteRcvBuf,
+			Ms:             mon.MsRcvBuf,
+			AvailableBytes: mon.ByteAvailRcvBuf,
+			LatencyMs:      mon.MsRcvTsbPdDelay,
+		},
+	}, nil
+}
+
+// GetStats returns the statistics of fd, in the same layout as with
+// libsrt
+func GetStats(fd int, clear bool) map[string]interface{} {
+	mon, _ := native.Bstats(fd, clear)
+	return map[string]interface{}{
+		"sid":  fd,
+		"time": mon.MsTimeStamp,
+		"window": map[string]interface{}{
+			"flow":       mon.PktFlowWindow,
+			"congestion": mon.PktCongestionWindow,
+			"flight":     mon.PktFlightSize,
+		},
+		"link": map[string]interface{}{
+			"rtt":          mon.MsRTT,
+			"bandwidth":    0.0,
+			"maxBandwidth": 0.0,
+		},
+		"send": map[string]interface{}{
+			"packets":              mon.PktSent,
+			"packetsLost":          mon.PktSndLoss,
+			"packetsDropped":       mon.PktSndDrop,
+			"packetsRetransmitted": mon.PktRetrans,
+			"packetsFilterExtra":   int64(0),
+			"bytes":                mon.ByteSent,
+			"bytesDropped":         mon.ByteSndDropTotal,
+			"mbitRate":             mon.MbpsSendRate,
+		},
+		"recv": map[string]interface{}{
+			"packets":              mon.PktRecv,
+			"packetsLost":          mon.PktRcvLoss,
+			"packetsDropped":       mon.PktRcvDrop,
+			"packetsRetransmitted": mon.PktRcvRetrans,
+			"packetsBelated":       mon.PktRcvBelated,
+			"packetsFilterExtra":   int64(0),
+			"packetsFilterSupply":  int64(0),
+			"packetsFilterLoss":    int64(0),
+			"bytes":                mon.ByteRecv,
+			"bytesLost":            int64(0),
+			"bytesDropped":         int64(0),
+			"mbitRate":             mon.MbpsRecvRate,
+		},
+	}
+}
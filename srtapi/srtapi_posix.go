@@ -11,9 +11,69 @@ package srtapi
 import (
 	"io"
 	"syscall"
+	"time"
 	"unsafe"
 )
 
+// SrtListenCallbackFunc listen callback function type
+type SrtListenCallbackFunc func(ns int, hsversion int, peeraddr syscall.Sockaddr, streamid string) int
+
+// SrtKeyEventFunc key refresh event callback function type. It must
+// not block.
+type SrtKeyEventFunc func(event int, key int, sender bool)
+
+// SrtDropEventFunc too-late drop event callback function type, called
+// with the sequence numbers of the range dropped and the number of
+// packets dropped in it. It must not block.
+type SrtDropEventFunc func(first, last int32, packets int, sender bool)
+
+// SrtDeliveryFunc delivery report callback function type, called with
+// the number of a tracked message once it was acknowledged, or
+// dropped. It must not block.
+type SrtDeliveryFunc func(msgno int32, delivered bool)
+
+// SrtGap is a range of packets found missing on reception, as returned
+// by Gaps: the sequence numbers of the range, both included, when it
+// was found, and how many of its packets arrived since or were
+// dropped, with when the last of them did.
+type SrtGap struct {
+	First, Last int32
+	Packets     int
+	Detected    time.Time
+	Recovered   int
+	Dropped     int
+	Resolved    time.Time
+}
+
+// CongestionControl is a congestion control for RegisterCongestion: it
+// paces the data packets a socket sends and bounds those in flight.
+// Its methods are called with the socket locked and must not block.
+type CongestionControl interface {
+	// OnACK is called as the peer acknowledges acked more packets,
+	// with the round trip time it measured.
+	OnACK(acked int, rtt time.Duration)
+
+	// OnLoss is called as the peer reports lost packets missing.
+	OnLoss(lost int)
+
+	// Pacing returns the time to wait after sending a new packet of
+	// size payload bytes before sending the next one, 0 for none.
+	Pacing(size int) time.Duration
+
+	// Window returns the most packets sent and not acknowledged yet,
+	// 0 for no other bound than the send buffer.
+	Window() int
+}
+
+// CongestionParams describe the socket a CongestionControl is made for:
+// the largest payload of its packets, SRTO_MAXBW in bytes per second (0
+// or less for none), and the packets its send buffer holds.
+type CongestionParams struct {
+	PayloadSize int
+	MaxBW       int64
+	MaxWindow   int
+}
+
 // An Errno is an number describing an error condition.
 type Errno int
 
@@ -43,6 +103,16 @@ func Write(fd int, p []byte) (n int, err error) {
 	return
 }
 
+// RecvMsg2 call srt_recvmsg2
+func RecvMsg2(fd int, p []byte, mc *MsgCtrl) (n int, err error) {
+	return recvmsg2(fd, p, mc)
+}
+
+// SendMsg2 call srt_sendmsg2
+func SendMsg2(fd int, p []byte, mc *MsgCtrl) (n int, err error) {
+	return sendmsg2(fd, p, mc)
+}
+
 // Bind call srt_bind
 func Bind(fd int, sa syscall.Sockaddr) (err error) {
 	ptr, n, err := sockaddr(sa)
@@ -61,6 +131,68 @@ func Connect(fd int, sa syscall.Sockaddr) (err error) {
 	return connect(fd, ptr, n)
 }
 
+// CreateGroup call srt_create_group, returning a group of type typ,
+// one of GroupBroadcast, GroupBackup and GroupBalancing. It fails with
+// EINVOP unless Has(FeatureGroups).
+func CreateGroup(typ int) (g int, err error) {
+	if !Has(FeatureGroups) {
+		return InvalidSock, EINVOP
+	}
+	return createGroup(typ)
+}
+
+// ConnectGroup call srt_connect_group, connecting group g to members
+func ConnectGroup(g int, members []GroupMember) (err error) {
+	if !Has(FeatureGroups) {
+		return EINVOP
+	}
+	if len(members) == 0 {
+		return EINVPARAM
+	}
+	// The addresses go to C as one buffer, SizeofSockaddrAny bytes
+	// apart.
+	const stride = int(SizeofSockaddrAny)
+	addrs := make([]byte, len(members)*stride)
+	srcs := make([]byte, len(members)*stride)
+	lens := make([]int, len(members))
+	srclens := make([]int, len(members))
+	weights := make([]int, len(members))
+	for i, m := range members {
+		ptr, n, err := sockaddr(m.Addr)
+		if err != nil {
+			return err
+		}
+		copy(addrs[i*stride:], (*[SizeofSockaddrAny]byte)(ptr)[:n])
+		lens[i], weights[i] = int(n), m.Weight
+		if m.Local != nil {
+			ptr, n, err := sockaddr(m.Local)
+			if err != nil {
+				return err
+			}
+			copy(srcs[i*stride:], (*[SizeofSockaddrAny]byte)(ptr)[:n])
+			srclens[i] = int(n)
+		}
+	}
+	return connectGroup(g, addrs, srcs, lens, srclens, weights)
+}
+
+// GroupData call srt_group_data, returning the members of group g
+func GroupData(g int) ([]GroupMemberStatus, error) {
+	if !Has(FeatureGroups) {
+		return nil, EINVOP
+	}
+	n := 4
+	for {
+		ms, total, err := groupData(g, n)
+		if err == ELARGEMSG && total > n {
+			// Members joined since the last try; ask for them all.
+			n = total
+			continue
+		}
+		return ms, err
+	}
+}
+
 // Getpeername call srt_getpeername
 func Getpeername(fd int) (sa syscall.Sockaddr, err error) {
 	var rsa syscall.RawSockaddrAny
@@ -99,6 +231,13 @@ func GetsockflagInt(fd, opt int) (value int, err error) {
 	return int(n), err
 }
 
+// GetsockflagInt64 call srt_getsockflag
+func GetsockflagInt64(fd, opt int) (value int64, err error) {
+	vallen := _Socklen(8)
+	err = getsockflag(fd, opt, unsafe.Pointer(&value), &vallen)
+	return value, err
+}
+
 // GetsockflagString returns the string value of the socket flag for the
 // socket associated with a fd
 func GetsockflagString(fd, opt int) (string, error) {
@@ -130,7 +269,9 @@ func SetsockoptInt64(fd, level, opt int, value int64) (err error) {
 
 // SetsockoptString call srt_setsockopt
 func SetsockoptString(fd, level, opt int, s string) (err error) {
-	return setsockopt(fd, level, opt, unsafe.Pointer(&[]byte(s)[0]), uintptr(len(s)))
+	// The trailing NUL keeps the buffer addressable for empty strings.
+	b := append([]byte(s), 0)
+	return setsockopt(fd, level, opt, unsafe.Pointer(&b[0]), uintptr(len(s)))
 }
 
 // SetsockoptBool call srt_setsockopt
@@ -161,7 +302,8 @@ func SetsockflagInt64(fd, opt int, value int64) (err error) {
 
 // SetsockflagString call srt_setsockopt
 func SetsockflagString(fd, opt int, s string) (err error) {
-	return setsockflag(fd, opt, unsafe.Pointer(&[]byte(s)[0]), uintptr(len(s)))
+	b := append([]byte(s), 0)
+	return setsockflag(fd, opt, unsafe.Pointer(&b[0]), uintptr(len(s)))
 }
 
 // SetsockflagBool call srt_setsockopt
@@ -278,7 +420,3 @@ func anyToSockaddr(rsa *syscall.RawSockaddrAny) (syscall.Sockaddr, error) {
 	}
 	return nil, syscall.EAFNOSUPPORT
 }
-
-func getLastError() error {
-	return Errno(getlasterror())
-}
@@ -1,10 +1,13 @@
 // Copyright (c) 2018 CyberAgent, Inc. All rights reserved.
 // https://github.com/openfresh/gosrt
 
+// +build !nosrtlib,!srtmock
+
 package srtapi
 
-// #cgo LDFLAGS: -lsrt
-// #include <srt/srt.h>
+// #cgo !srtstatic,!srtprebuilt,!nopkgconfig pkg-config: srt
+// #cgo !srtstatic,!srtprebuilt,nopkgconfig LDFLAGS: -lsrt
+// #include "compat.h"
 import "C"
 import (
 	"syscall"
@@ -105,43 +108,50 @@ const (
 	OptionIpv60only          = C.SRTO_IPV6ONLY
 	OptionPeeridletimeo      = C.SRTO_PEERIDLETIMEO
 	OptionPacketfilter       = C.SRTO_PACKETFILTER
-)
 
-// SRT trans type
-const (
-	TypeLive    = C.SRTT_LIVE
-	TypeFile    = C.SRTT_FILE
-	TypeInvalid = C.SRTT_INVALID
+	// Options not every libsrt version has, -1 if the headers lack it
+	OptionRetransmitalgo = C.GOSRT_SRTO_RETRANSMITALGO
+	OptionBindtodevice   = C.GOSRT_SRTO_BINDTODEVICE
+	OptionCryptomode     = C.GOSRT_SRTO_CRYPTOMODE
+	OptionGroupconnect   = C.GOSRT_SRTO_GROUPCONNECT
 )
 
-// SRT log level
+// SRT key material state
 const (
-	LogEmerg   = 0
-	LogAlert   = 1
-	LogFatal   = 2
-	LogError   = 3
-	LogWarning = 4
-	LogNote    = 5
-	LogInfo    = 6
-	LogDebug   = 7
+	KmStateUnsecured = C.SRT_KM_S_UNSECURED
+	KmStateSecuring  = C.SRT_KM_S_SECURING
+	KmStateSecured   = C.SRT_KM_S_SECURED
+	KmStateNosecret  = C.SRT_KM_S_NOSECRET
+	KmStateBadsecret = C.SRT_KM_S_BADSECRET
 )
 
-// SRT log FA
+// SRT reject reasons
 const (
-	LogFAGeneral = 0
-	LogFABstats  = 1
-	LogFAControl = 2
-	LogFAData    = 3
-	LogFATsbpd   = 4
-	LogFARexmit  = 5
+	RejectUnknown    = C.SRT_REJ_UNKNOWN
+	RejectSystem     = C.SRT_REJ_SYSTEM
+	RejectPeer       = C.SRT_REJ_PEER
+	RejectResource   = C.SRT_REJ_RESOURCE
+	RejectRogue      = C.SRT_REJ_ROGUE
+	RejectBacklog    = C.SRT_REJ_BACKLOG
+	RejectIpe        = C.SRT_REJ_IPE
+	RejectClose      = C.SRT_REJ_CLOSE
+	RejectVersion    = C.SRT_REJ_VERSION
+	RejectRdvcookie  = C.SRT_REJ_RDVCOOKIE
+	RejectBadsecret  = C.SRT_REJ_BADSECRET
+	RejectUnsecure   = C.SRT_REJ_UNSECURE
+	RejectMessageapi = C.SRT_REJ_MESSAGEAPI
+	RejectCongestion = C.SRT_REJ_CONGESTION
+	RejectFilter     = C.SRT_REJ_FILTER
+
+	// Reasons not every libsrt version has, -1 if the headers lack it
+	RejectTimeout = C.GOSRT_SRT_REJ_TIMEOUT
 )
 
-// SRT log flags
+// SRT trans type
 const (
-	LogFlagDisableTime       = 1
-	LogFlagDisableThreadname = 2
-	LogFlagDisableSeverity   = 4
-	LogFlagDisableEOF        = 8
+	TypeLive    = C.SRTT_LIVE
+	TypeFile    = C.SRTT_FILE
+	TypeInvalid = C.SRTT_INVALID
 )
 
 // SRT epoll opt
@@ -152,14 +162,6 @@ const (
 	EpollEt  = C.SRT_EPOLL_ET
 )
 
-// SRT const
-const (
-	InvalidSock          = -1
-	APIError             = -1
-	DefaultSendfileBlock = 364000
-	DefaultRecvfileBlock = 7280000
-)
-
 // SRT_EPOLL_FLAGS
 const (
 	EpollEnableEmpty       = C.SRT_EPOLL_ENABLE_EMPTY
@@ -0,0 +1,167 @@
+// Copyright (c) 2020 CyberAgent, Inc. All rights reserved.
+// https://github.com/openfresh/gosrt
+
+// +build nosrtlib srtmock
+
+package srtapi
+
+import (
+	"syscall"
+	"unsafe"
+
+	"github.com/openfresh/gosrt/internal/native"
+)
+
+type _Socklen int32
+
+// SrtSocket represents SRT C API SRTSOCKET type
+type SrtSocket int32
+
+// SrtEpollEvent represent SRT C API SRT_EPOLL_EVENT structure
+type SrtEpollEvent struct {
+	fd     int32
+	events int32
+}
+
+//lint:ignore U1000 we want to use it to calculate size
+var rsa syscall.RawSockaddrAny
+
+//lint:ignore U1000 we want to use it to calculate size
+var rs4 syscall.RawSockaddrInet4
+
+//lint:ignore U1000 we want to use it to calculate size
+var rs6 syscall.RawSockaddrInet6
+
+// Size of raw sock addr structures
+const (
+	SizeofSockaddrAny   = _Socklen(unsafe.Sizeof(rsa))
+	SizeofSockaddrInet4 = _Socklen(unsafe.Sizeof(rs4))
+	SizeofSockaddrInet6 = _Socklen(unsafe.Sizeof(rs6))
+)
+
+// SRT socket status
+const (
+	StatusInit       = native.StatusInit
+	StatusOpened     = native.StatusOpened
+	StatusListening  = native.StatusListening
+	StatusConnecting = native.StatusConnecting
+	StatusConnected  = native.StatusConnected
+	StatusBroken     = native.StatusBroken
+	StatusClosing    = native.StatusClosing
+	StatusClosed     = native.StatusClosed
+	StatusNonexist   = native.StatusNonexist
+)
+
+const SrtVersion = native.Version
+
+// SRT socket options
+const (
+	OptionMss                = native.OptMSS
+	OptionSndsyn             = native.OptSndSyn
+	OptionRcvsyn             = native.OptRcvSyn
+	OptionIsn                = native.OptISN
+	OptionFc                 = native.OptFC
+	OptionSndbuf             = native.OptSndBuf
+	OptionRcvbuf             = native.OptRcvBuf
+	OptionLinger             = native.OptLinger
+	OptionUDPSndbuf          = native.OptUDPSndBuf
+	OptionUDPRcvbuf          = native.OptUDPRcvBuf
+	OptionRendezvous         = native.OptRendezvous
+	OptionSndtimeo           = native.OptSndTimeo
+	OptionRcvtimeo           = native.OptRcvTimeo
+	OptionReuseaddr          = native.OptReuseAddr
+	OptionMaxbw              = native.OptMaxBW
+	OptionState              = native.OptState
+	OptionEvent              = native.OptEvent
+	OptionSnddata            = native.OptSndData
+	OptionRcvdata            = native.OptRcvData
+	OptionSender             = native.OptSender
+	OptionTsbpdmode          = native.OptTsbpdMode
+	OptionLatency            = native.OptLatency
+	OptionInputbw            = native.OptInputBW
+	OptionOheadbw            = native.OptOheadBW
+	OptionPassphrase         = native.OptPassphrase
+	OptionPbkeylen           = native.OptPBKeyLen
+	OptionKmstate            = native.OptKMState
+	OptionIpttl              = native.OptIPTTL
+	OptionIptos              = native.OptIPTOS
+	OptionTlpktdrop          = native.OptTLPktDrop
+	OptionSnddropdelay       = native.OptSndDropDelay
+	OptionNakreport          = native.OptNAKReport
+	OptionVersion            = native.OptVersion
+	OptionPeerversion        = native.OptPeerVersion
+	OptionConntimeo          = native.OptConnTimeo
+	OptionSndkmstate         = native.OptSndKMState
+	OptionRcvkmstate         = native.OptRcvKMState
+	OptionLossmaxttl         = native.OptLossMaxTTL
+	OptionRcvlatency         = native.OptRcvLatency
+	OptionPeerlatency        = native.OptPeerLatency
+	OptionMinversion         = native.OptMinVersion
+	OptionStreamid           = native.OptStreamID
+	OptionCongestion         = native.OptCongestion
+	OptionMessageapi         = native.OptMessageAPI
+	OptionPayloadsize        = native.OptPayloadSize
+	OptionTranstype          = native.OptTransType
+	OptionKmrefreshrate      = native.OptKMRefreshRate
+	OptionKmpreannounce      = native.OptKMPreAnnounce
+	OptionEnforcedencryption = native.OptEnforcedEncryption
+	OptionIpv60only          = native.OptIPv6Only
+	OptionPeeridletimeo      = native.OptPeerIdleTimeo
+	OptionPacketfilter       = native.OptPacketFilter
+
+	// Options the native implementation doesn't have
+	OptionRetransmitalgo = -1
+	OptionBindtodevice   = -1
+	OptionCryptomode     = -1
+	OptionGroupconnect   = -1
+)
+
+// SRT key material state
+const (
+	KmStateUnsecured = native.KMUnsecured
+	KmStateSecuring  = native.KMSecuring
+	KmStateSecured   = native.KMSecured
+	KmStateNosecret  = native.KMNoSecret
+	KmStateBadsecret = native.KMBadSecret
+)
+
+// SRT reject reasons
+const (
+	RejectUnknown    = native.RejectUnknown
+	RejectSystem     = native.RejectSystem
+	RejectPeer       = native.RejectPeer
+	RejectResource   = native.RejectResource
+	RejectRogue      = native.RejectRogue
+	RejectBacklog    = native.RejectBacklog
+	RejectIpe        = native.RejectIPE
+	RejectClose      = native.RejectClose
+	RejectVersion    = native.RejectVersion
+	RejectRdvcookie  = native.RejectRdvCookie
+	RejectBadsecret  = native.RejectBadSecret
+	RejectUnsecure   = native.RejectUnsecure
+	RejectMessageapi = native.RejectMessageAPI
+	RejectCongestion = native.RejectCongestion
+	RejectFilter     = native.RejectFilter
+	RejectTimeout    = native.RejectTimeout
+)
+
+// SRT trans type
+const (
+	TypeLive    = native.TransLive
+	TypeFile    = native.TransFile
+	TypeInvalid = native.TransInvalid
+)
+
+// SRT epoll opt
+const (
+	EpollIn  = int(native.EpollIn)
+	EpollOut = int(native.EpollOut)
+	EpollErr = int(native.EpollErr)
+	EpollEt  = int(native.EpollET)
+)
+
+// SRT_EPOLL_FLAGS
+const (
+	EpollEnableEmpty       = native.EpollEnableEmpty
+	EpollEnableOutputcheck = native.EpollEnableOutputcheck
+)
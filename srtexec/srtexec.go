@@ -0,0 +1,242 @@
+// Copyright (c) 2020 CyberAgent, Inc. All rights reserved.
+// https://github.com/openfresh/gosrt
+
+// Package srtexec connects SRT connections to external programs, such
+// as ffmpeg or gstreamer, through their standard input and output.
+package srtexec
+
+import (
+	"context"
+	"io"
+	"io/ioutil"
+	"os/exec"
+	"sync"
+	"time"
+)
+
+// Defaults of the Process fields left zero.
+const (
+	DefaultBuffer    = 64
+	DefaultChunkSize = 1316
+	DefaultWaitDelay = 5 * time.Second
+)
+
+// A Process runs a command with its standard input fed from a reader,
+// typically an SRT connection, and its standard output copied to a
+// writer. Each direction reads ahead of its writes through a bounded
+// buffer, and blocks its reads once the buffer is full, so a stalled
+// command holds its source back instead of piling up data.
+type Process struct {
+	// Cmd is the command to run. Run sets its Stdin and Stdout.
+	Cmd *exec.Cmd
+
+	// Buffer is the number of chunks each direction buffers.
+	Buffer int
+
+	// ChunkSize is the size of the reads from the command's output,
+	// and so the largest writes to the writer. The default suits
+	// SRT live payloads.
+	ChunkSize int
+
+	// WaitDelay is how long the command has to exit once its input
+	// is closed on an early stop, before it is killed.
+	WaitDelay time.Duration
+}
+
+var aLongTimeAgo = time.Unix(1, 0)
+
+// Run starts the command and copies in to its standard input and its
+// standard output to out; either may be nil to leave it alone. Run
+// closes the command's input when in is exhausted, and returns once
+// the command exited.
+//
+// When ctx is done, out fails, or the command stops reading its
+// input, Run closes the input and gives the command WaitDelay to exit
+// before killing it. A pending read from in, which Run doesn't own, is
+// interrupted by setting a past read deadline if in has a
+// SetReadDeadline method, as connections do; otherwise Run returns
+// without waiting for it.
+//
+// Run returns the first error among the copies, ctx and the command's
+// exit status.
+func (p *Process) Run(ctx context.Context, in io.Reader, out io.Writer) error {
+	cmd := p.Cmd
+	var (
+		stdin  io.WriteCloser
+		stdout io.ReadCloser
+		err    error
+	)
+	if in != nil {
+		if stdin, err = cmd.StdinPipe(); err != nil {
+			return err
+		}
+	}
+	if out != nil {
+		if stdout, err = cmd.StdoutPipe(); err != nil {
+			return err
+		}
+	}
+	if err := cmd.Start(); err != nil {
+		return err
+	}
+
+	var (
+		once  sync.Once
+		stop  = make(chan struct{})
+		kill  *time.Timer
+		mu    sync.Mutex
+		first error
+	)
+	record := func(err error) {
+		mu.Lock()
+		if first == nil {
+			first = err
+		}
+		mu.Unlock()
+	}
+	teardown := func() {
+		once.Do(func() {
+			close(stop)
+			if d, ok := in.(interface{ SetReadDeadline(time.Time) error }); ok {
+				d.SetReadDeadline(aLongTimeAgo)
+			}
+			if stdin != nil {
+				stdin.Close()
+			}
+			kill = time.AfterFunc(p.waitDelay(), func() { cmd.Process.Kill() })
+		})
+	}
+
+	var feedDone chan error
+	if in != nil {
+		feedDone = make(chan error, 1)
+		go func() {
+			err := p.pump(stdin, in, stop)
+			stdin.Close()
+			feedDone <- err
+		}()
+	}
+	waitDone := make(chan error, 1)
+	go func() {
+		if stdout != nil {
+			if err := p.pump(out, stdout, nil); err != nil {
+				if werr, ok := err.(writeError); ok {
+					err = werr.err
+				}
+				record(err)
+				teardown()
+				// Keep the command from blocking on its output.
+				io.Copy(ioutil.Discard, stdout)
+			}
+		}
+		waitDone <- cmd.Wait()
+	}()
+
+	ctxDone := ctx.Done()
+	for waitDone != nil {
+		select {
+		case err := <-feedDone:
+			feedDone = nil
+			if err != nil {
+				// That the command stopped reading is for its exit
+				// status to tell.
+				if _, ok := err.(writeError); !ok {
+					record(err)
+				}
+				teardown()
+			}
+		case err := <-waitDone:
+			waitDone = nil
+			if err != nil {
+				record(err)
+			}
+		case <-ctxDone:
+			ctxDone = nil
+			record(ctx.Err())
+			teardown()
+		}
+	}
+	if feedDone != nil {
+		teardown()
+		if _, ok := in.(interface{ SetReadDeadline(time.Time) error }); ok {
+			<-feedDone
+		}
+	}
+	if kill != nil {
+		kill.Stop()
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	return first
+}
+
+// pump copies src to dst through a buffer of p.Buffer chunks, until
+// src ends, dst fails or stop is closed.
+func (p *Process) pump(dst io.Writer, src io.Reader, stop <-chan struct{}) error {
+	chunks := make(chan []byte, p.buffer())
+	quit := make(chan struct{})
+	rerr := make(chan error, 1)
+	go func() {
+		defer close(chunks)
+		for {
+			b := make([]byte, p.chunkSize())
+			n, err := src.Read(b)
+			if n > 0 {
+				select {
+				case chunks <- b[:n]:
+				case <-quit:
+					rerr <- nil
+					return
+				case <-stop:
+					rerr <- nil
+					return
+				}
+			}
+			if err != nil {
+				select {
+				case <-stop:
+					err = nil
+				default:
+					if err == io.EOF {
+						err = nil
+					}
+				}
+				rerr <- err
+				return
+			}
+		}
+	}()
+	for b := range chunks {
+		if _, err := dst.Write(b); err != nil {
+			close(quit)
+			return writeError{err}
+		}
+	}
+	return <-rerr
+}
+
+// writeError marks the errors of pump writing to dst.
+type writeError struct{ err error }
+
+func (e writeError) Error() string { return e.err.Error() }
+
+func (p *Process) buffer() int {
+	if p.Buffer > 0 {
+		return p.Buffer
+	}
+	return DefaultBuffer
+}
+
+func (p *Process) chunkSize() int {
+	if p.ChunkSize > 0 {
+		return p.ChunkSize
+	}
+	return DefaultChunkSize
+}
+
+func (p *Process) waitDelay() time.Duration {
+	if p.WaitDelay > 0 {
+		return p.WaitDelay
+	}
+	return DefaultWaitDelay
+}
@@ -0,0 +1,70 @@
+// Copyright (c) 2020 CyberAgent, Inc. All rights reserved.
+// https://github.com/openfresh/gosrt
+
+package srtexec
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"net"
+	"os/exec"
+	"testing"
+	"time"
+)
+
+func command(t *testing.T, name string, args ...string) *exec.Cmd {
+	if _, err := exec.LookPath(name); err != nil {
+		t.Skipf("%s not found", name)
+	}
+	return exec.Command(name, args...)
+}
+
+func TestRun(t *testing.T) {
+	data := bytes.Repeat([]byte("PIPE ADAPTER TEST"), 10000)
+	var out bytes.Buffer
+	p := &Process{Cmd: command(t, "cat"), Buffer: 4}
+	if err := p.Run(context.Background(), bytes.NewReader(data), &out); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(out.Bytes(), data) {
+		t.Errorf("got %d bytes; want %d unchanged", out.Len(), len(data))
+	}
+}
+
+func TestRunCanceled(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	p := &Process{Cmd: command(t, "sleep", "10"), WaitDelay: 50 * time.Millisecond}
+	start := time.Now()
+	if err := p.Run(ctx, nil, nil); err != context.DeadlineExceeded {
+		t.Errorf("got %v; want %v", err, context.DeadlineExceeded)
+	}
+	if d := time.Since(start); d > 2*time.Second {
+		t.Errorf("took %v to stop the command", d)
+	}
+}
+
+type failWriter struct{}
+
+var errWrite = errors.New("write failed")
+
+func (failWriter) Write(p []byte) (int, error) { return 0, errWrite }
+
+func TestRunOutputFails(t *testing.T) {
+	p := &Process{Cmd: command(t, "yes"), WaitDelay: 50 * time.Millisecond}
+	if err := p.Run(context.Background(), nil, failWriter{}); err != errWrite {
+		t.Errorf("got %v; want %v", err, errWrite)
+	}
+}
+
+func TestRunCommandExits(t *testing.T) {
+	// The command exits without reading its input, from which reads
+	// block.
+	r, w := net.Pipe()
+	defer w.Close()
+	p := &Process{Cmd: command(t, "true")}
+	if err := p.Run(context.Background(), r, nil); err != nil {
+		t.Errorf("got %v; want nil", err)
+	}
+}
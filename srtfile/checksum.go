@@ -0,0 +1,64 @@
+// Copyright (c) 2020 CyberAgent, Inc. All rights reserved.
+// https://github.com/openfresh/gosrt
+
+package srtfile
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"hash"
+
+	"github.com/openfresh/gosrt/internal/xxhash"
+)
+
+// Checksums of a transfer.
+const (
+	ChecksumNone   = ""
+	ChecksumXXH64  = "xxh64"  // fast, against corruption only
+	ChecksumSHA256 = "sha256" // against tampering too
+)
+
+// DefaultChunkSize is the chunk size of a Sender with a checksum and a
+// ChunkSize of 0.
+const DefaultChunkSize = 4 << 20
+
+func newHash(alg string) (func() hash.Hash, bool) {
+	switch alg {
+	case ChecksumXXH64:
+		return func() hash.Hash { return xxhash.New() }, true
+	case ChecksumSHA256:
+		return sha256.New, true
+	}
+	return nil, false
+}
+
+// A Mismatch is a checksum the receiver of a file found wrong: that of
+// a chunk, which the next attempt sends again, or of the whole file,
+// which it sends again from the start.
+type Mismatch struct {
+	Name string `json:"name"`
+
+	// Offset and Size are those of the chunk, or 0 and the size of the
+	// file for the whole file.
+	Offset int64 `json:"offset"`
+	Size   int64 `json:"size"`
+	Whole  bool  `json:"whole,omitempty"`
+
+	// Want is the checksum the sender sent, and Got that of the bytes
+	// the receiver has, in hexadecimal.
+	Want string `json:"want"`
+	Got  string `json:"got"`
+}
+
+// A MismatchError is the error of a transfer with a Mismatch, on both
+// sides.
+type MismatchError struct {
+	Mismatch
+}
+
+func (e *MismatchError) Error() string {
+	if e.Whole {
+		return fmt.Sprintf("srtfile: checksum mismatch of %s: got %s, want %s", e.Name, e.Got, e.Want)
+	}
+	return fmt.Sprintf("srtfile: checksum mismatch of %s at %d+%d: got %s, want %s", e.Name, e.Offset, e.Size, e.Got, e.Want)
+}
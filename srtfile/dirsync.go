@@ -0,0 +1,202 @@
+// Copyright (c) 2020 CyberAgent, Inc. All rights reserved.
+// https://github.com/openfresh/gosrt
+
+package srtfile
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// A Syncer mirrors a directory to a receiver, sending the files that
+// are new or changed, an rsync of sorts for remote sites with poor
+// connectivity: each file is resumed where a sync that failed left it,
+// and files failing are left to the next sync.
+type Syncer struct {
+	// Sender sends the files, with its links, retries and checksum.
+	Sender *Sender
+
+	// State, if set, is a file keeping the size and modification time
+	// of the files synced, for later syncs to skip those unchanged
+	// without asking the receiver. It is of one receiver only.
+	State string
+
+	// Skip, if set, is called with the name of each file and directory
+	// found, relative to the directory with slashes, and skips those it
+	// returns true for.
+	Skip func(name string, fi os.FileInfo) bool
+
+	// OnProgress, if set, is called after each file.
+	OnProgress func(SyncProgress)
+}
+
+// A SyncProgress is how far along a sync is, after a file.
+type SyncProgress struct {
+	Name   string // of the file, relative to the directory
+	Result Result
+	Err    error
+
+	// Files is the number of files to send and Bytes their size, of
+	// which FilesDone and BytesDone are done with, synced or not.
+	Files, FilesDone int
+	Bytes, BytesDone int64
+}
+
+// A SyncResult is what a sync did.
+type SyncResult struct {
+	Files   int // found
+	Skipped int // unchanged since the sync of State
+	Synced  int
+	Failed  int
+
+	// Transferred is the bytes sent, of the files synced or not.
+	Transferred int64
+}
+
+// syncState is the content of a State file, by name.
+type syncState map[string]syncedFile
+
+type syncedFile struct {
+	Size    int64 `json:"size"`
+	ModTime int64 `json:"mtime"` // Unix nanoseconds
+}
+
+// Sync sends the files of dir that aren't synced, in name order, and
+// returns an error if ctx is done or some of them fail, after all the
+// others.
+func (s *Syncer) Sync(ctx context.Context, dir string) (res SyncResult, err error) {
+	state, err := s.load()
+	if err != nil {
+		return res, err
+	}
+	files, err := s.walk(dir)
+	if err != nil {
+		return res, err
+	}
+	res.Files = len(files)
+	for name := range state {
+		if _, ok := files[name]; !ok {
+			delete(state, name)
+		}
+	}
+	p := SyncProgress{}
+	var todo []string
+	for name, f := range files {
+		if had, ok := state[name]; ok && had == f {
+			res.Skipped++
+			continue
+		}
+		todo = append(todo, name)
+		p.Bytes += f.Size
+	}
+	sort.Strings(todo)
+	p.Files = len(todo)
+
+	defer func() {
+		if serr := s.save(state); serr != nil && err == nil {
+			err = serr
+		}
+	}()
+	var first error
+	for _, name := range todo {
+		if ctx.Err() != nil {
+			return res, ctx.Err()
+		}
+		r, err := s.Sender.SendFile(ctx, filepath.Join(dir, filepath.FromSlash(name)), name)
+		res.Transferred += r.Transferred()
+		if err == nil {
+			res.Synced++
+			state[name] = files[name]
+		} else {
+			res.Failed++
+			if first == nil {
+				first = err
+			}
+		}
+		p.Name, p.Result, p.Err = name, r, err
+		p.FilesDone++
+		p.BytesDone += files[name].Size
+		if s.OnProgress != nil {
+			s.OnProgress(p)
+		}
+	}
+	if ctx.Err() != nil {
+		return res, ctx.Err()
+	}
+	if first != nil {
+		return res, fmt.Errorf("srtfile: %d of %d files not synced: %w", res.Failed, len(todo), first)
+	}
+	return res, nil
+}
+
+// walk returns the regular files of dir to sync by name, leaving out
+// those Skip skips, parts being received and State.
+func (s *Syncer) walk(dir string) (syncState, error) {
+	files := make(syncState)
+	state, _ := filepath.Abs(s.State)
+	err := filepath.Walk(dir, func(path string, fi os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(dir, path)
+		if err != nil || rel == "." {
+			return err
+		}
+		name := filepath.ToSlash(rel)
+		if s.State != "" {
+			if abs, _ := filepath.Abs(path); abs == state || abs == state+".tmp" {
+				return nil
+			}
+		}
+		if strings.Contains(fi.Name(), PartSuffix) || (s.Skip != nil && s.Skip(name, fi)) {
+			if fi.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if fi.Mode().IsRegular() {
+			files[name] = syncedFile{Size: fi.Size(), ModTime: fi.ModTime().UnixNano()}
+		}
+		return nil
+	})
+	return files, err
+}
+
+func (s *Syncer) load() (syncState, error) {
+	state := make(syncState)
+	if s.State == "" {
+		return state, nil
+	}
+	b, err := ioutil.ReadFile(s.State)
+	if os.IsNotExist(err) {
+		return state, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(b, &state); err != nil {
+		return nil, fmt.Errorf("srtfile: state %s: %v", s.State, err)
+	}
+	return state, nil
+}
+
+func (s *Syncer) save(state syncState) error {
+	if s.State == "" {
+		return nil
+	}
+	b, err := json.Marshal(state)
+	if err != nil {
+		return err
+	}
+	tmp := s.State + ".tmp"
+	if err := ioutil.WriteFile(tmp, b, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, s.State)
+}
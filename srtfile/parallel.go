@@ -0,0 +1,242 @@
+// Copyright (c) 2020 CyberAgent, Inc. All rights reserved.
+// https://github.com/openfresh/gosrt
+
+package srtfile
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/openfresh/gosrt/srt"
+)
+
+// DefaultPartSize is the part size of a Sender with Links and a
+// PartSize of 0.
+const DefaultPartSize = 64 << 20
+
+// GroupLinks returns the Links of a Sender sending over the endpoints
+// of u apart, each dialed with d, or a zero srt.Dialer if d is nil, and
+// the options of u. Rather than the socket group of u sharing one
+// stream, the members carry parts of the file of their own, the faster
+// ones more of them.
+func GroupLinks(d *srt.Dialer, u *srt.GroupURL) []func(ctx context.Context) (net.Conn, error) {
+	links := make([]func(ctx context.Context) (net.Conn, error), len(u.Endpoints))
+	for i, ep := range u.Endpoints {
+		address := (&srt.GroupURL{Endpoints: []srt.GroupEndpoint{ep}, Options: u.Options}).String()
+		links[i] = func(ctx context.Context) (net.Conn, error) {
+			return Dial(ctx, d, address)
+		}
+	}
+	return links
+}
+
+// sendParallel sends the file at path in parts over the Links of s.
+func (s *Sender) sendParallel(ctx context.Context, path, name string) (Result, error) {
+	f, file, err := openFile(path, name)
+	if err != nil {
+		return Result{}, err
+	}
+	defer f.Close()
+	partSize := s.PartSize
+	if partSize <= 0 {
+		partSize = DefaultPartSize
+	}
+	parts := int((file.Size + partSize - 1) / partSize)
+	if parts == 0 {
+		parts = 1
+	}
+	queue := make(chan int, parts)
+	for i := 0; i < parts; i++ {
+		queue <- i
+	}
+	ps := s
+	var agg *partsProgress
+	if s.OnProgress != nil {
+		agg = &partsProgress{s: s, name: file.Name, size: file.Size, parts: make(map[int]Progress)}
+		cp := *s
+		cp.OnProgress = agg.update
+		ps = &cp
+	}
+
+	pctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	var (
+		wg    sync.WaitGroup
+		mu    sync.Mutex
+		left  = parts
+		links = len(s.Links)
+		res   = Result{Name: file.Name, Size: file.Size}
+		last  error
+	)
+	for _, dial := range s.Links {
+		wg.Add(1)
+		go func(dial func(context.Context) (net.Conn, error)) {
+			defer wg.Done()
+			for {
+				var i int
+				select {
+				case i = <-queue:
+				case <-pctx.Done():
+					return
+				}
+				start := int64(i) * partSize
+				n := file.Size - start
+				if n > partSize {
+					n = partSize
+				}
+				offer := &message{Type: typeOffer, Name: file.Name, Size: n, ModTime: file.ModTime,
+					Part: i, Parts: parts, Start: start, Total: file.Size}
+				pres, err := s.retry(pctx, dial, func(c net.Conn) (Result, error) {
+					return ps.send(pctx, c, io.NewSectionReader(f, start, n), offer)
+				})
+				mu.Lock()
+				switch {
+				case err == nil:
+					res.Offset += pres.Offset
+					if left--; left == 0 {
+						cancel()
+					}
+				case pctx.Err() != nil:
+				case permanent(err):
+					last = err
+					cancel()
+				default:
+					// The link is down; the others take its part.
+					last = err
+					queue <- i
+					if links--; links == 0 {
+						cancel()
+					}
+				}
+				mu.Unlock()
+				if err != nil {
+					return
+				}
+			}
+		}(dial)
+	}
+	wg.Wait()
+	if agg != nil {
+		agg.report(time.Now())
+	}
+	switch {
+	case left == 0:
+		return res, nil
+	case ctx.Err() != nil:
+		return res, ctx.Err()
+	}
+	return res, fmt.Errorf("srtfile: %d of %d parts of %s not sent: %w", left, parts, file.Name, last)
+}
+
+// partsProgress sums up the progress of the parts of a file, for the
+// OnProgress of s.
+type partsProgress struct {
+	s    *Sender
+	name string
+	size int64
+
+	mu    sync.Mutex
+	parts map[int]Progress // the latest of each
+	meter srt.ProgressMeter
+	last  time.Time
+}
+
+func (a *partsProgress) update(p Progress) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.parts[p.Part] = p
+	interval := a.s.ProgressInterval
+	if interval <= 0 {
+		interval = DefaultProgressInterval
+	}
+	if now := time.Now(); now.Sub(a.last) >= interval {
+		a.reportLocked(now)
+	}
+}
+
+func (a *partsProgress) report(now time.Time) {
+	a.mu.Lock()
+	a.reportLocked(now)
+	a.mu.Unlock()
+}
+
+func (a *partsProgress) reportLocked(now time.Time) {
+	var off, bytes, acked int64
+	for _, p := range a.parts {
+		off += p.Offset
+		bytes += p.Bytes
+		acked += p.Acked
+	}
+	a.meter.Total = a.size - off
+	a.last = now
+	a.s.OnProgress(Progress{Name: a.name, Offset: off, Progress: a.meter.Update(now, bytes, acked)})
+}
+
+// partName returns the name of the part file of part i of final.
+func partName(final string, i int) string {
+	return fmt.Sprintf("%s%s.%d", final, PartSuffix, i)
+}
+
+// assemble puts the parts of final together into it once they are all
+// received, m being the offer of one of them.
+func (r *Receiver) assemble(final string, m *message) error {
+	r.assembling.Lock()
+	defer r.assembling.Unlock()
+	if fi, err := os.Stat(final); err == nil && fi.Size() == m.Total && fi.ModTime().UnixNano() == m.ModTime {
+		return nil // by another part
+	}
+	var size int64
+	for i := 0; i < m.Parts; i++ {
+		p, ok := readSidecar(partName(final, i))
+		if !ok || p.Type != typeDone || p.Name != m.Name || p.ModTime != m.ModTime ||
+			p.Part != i || p.Parts != m.Parts || p.Total != m.Total || p.Start != size {
+			return nil // more to come
+		}
+		size += p.Size
+	}
+	if size != m.Total {
+		return fmt.Errorf("srtfile: parts of %d bytes of a file of %d", size, m.Total)
+	}
+	part := final + PartSuffix
+	f, err := os.Create(part)
+	if err != nil {
+		return err
+	}
+	for i := 0; i < m.Parts; i++ {
+		if err := appendFile(f, partName(final, i)); err != nil {
+			f.Close()
+			return err
+		}
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	if err := finish(part, final, m.ModTime); err != nil {
+		return err
+	}
+	for i := 0; i < m.Parts; i++ {
+		os.Remove(partName(final, i))
+		os.Remove(partName(final, i) + ".json")
+	}
+	return nil
+}
+
+// appendFile appends the file name to f.
+func appendFile(f *os.File, name string) error {
+	src, err := os.Open(name)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+	_, err = io.Copy(f, src)
+	return err
+}
@@ -0,0 +1,54 @@
+// Copyright (c) 2020 CyberAgent, Inc. All rights reserved.
+// https://github.com/openfresh/gosrt
+
+package srtfile
+
+import (
+	"sync/atomic"
+	"time"
+
+	"github.com/openfresh/gosrt/srt"
+)
+
+// DefaultProgressInterval is the interval of the progress reports of a
+// Sender or Receiver leaving ProgressInterval 0.
+const DefaultProgressInterval = srt.DefaultProgressInterval
+
+// A Progress is how far along the transfer of a file is. It resumed at
+// Offset, its Total being what was left of the file then, as with
+// Result.Transferred.
+type Progress struct {
+	Name   string
+	Offset int64
+
+	// Part of Parts is the part of the file a Receiver is receiving
+	// from a Sender with Links, Parts being 0 for a whole file.
+	Part, Parts int
+
+	srt.Progress
+}
+
+// watchProgress calls f, unless nil, every interval with the progress
+// of the transfer of what m offers from off, from the counts of sample,
+// until stop calls it a last time, with all of it acknowledged if done.
+func watchProgress(m *message, off int64, interval time.Duration, f func(Progress), sample func() (bytes, acked int64)) (stop func(done bool)) {
+	if f == nil {
+		return func(bool) {}
+	}
+	var complete int32
+	stopWatch := srt.WatchProgress(m.Size-off, interval, func(p srt.Progress) {
+		f(Progress{Name: m.Name, Offset: off, Part: m.Part, Parts: m.Parts, Progress: p})
+	}, func() (int64, int64) {
+		bytes, acked := sample()
+		if atomic.LoadInt32(&complete) != 0 {
+			acked = bytes
+		}
+		return bytes, acked
+	})
+	return func(done bool) {
+		if done {
+			atomic.StoreInt32(&complete, 1)
+		}
+		stopWatch()
+	}
+}
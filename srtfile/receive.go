@@ -0,0 +1,429 @@
+// Copyright (c) 2020 CyberAgent, Inc. All rights reserved.
+// https://github.com/openfresh/gosrt
+
+package srtfile
+
+import (
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"io/ioutil"
+	"net"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// PartSuffix is the suffix of the files being received, and of what
+// the receiver knows of their offer, with ".json" after it.
+const PartSuffix = ".srtpart"
+
+// errBusy is the reason of a receiver rejecting a file it is receiving
+// from another connection.
+var errBusy = errors.New("srtfile: file already being received")
+
+// A Receiver receives files into a directory.
+type Receiver struct {
+	// Dir is the directory of the files, the current directory if
+	// empty. The names offered are relative to it, with slashes
+	// between the directories, which are made as needed.
+	Dir string
+
+	// OnReceive, if set, is called by Serve with the outcome of each
+	// transfer.
+	OnReceive func(Result, error)
+
+	// Checksum, if set, is the checksum the offers must have, which are
+	// rejected otherwise. Offers with any checksum are verified.
+	Checksum string
+
+	// OnMismatch, if set, is called with each checksum that doesn't
+	// match, before the sender is told.
+	OnMismatch func(Mismatch)
+
+	// OnProgress, if set, is called with the progress of each transfer
+	// every ProgressInterval, DefaultProgressInterval if 0, and once
+	// at its end.
+	OnProgress       func(Progress)
+	ProgressInterval time.Duration
+
+	mu     sync.Mutex
+	active map[string]bool
+
+	assembling sync.Mutex
+}
+
+// cleanName returns name, a relative slash-separated path, cleaned, or
+// ErrBadName.
+func cleanName(name string) (string, error) {
+	clean := path.Clean(name)
+	if name == "" || clean == "." || path.IsAbs(clean) || clean == ".." || strings.HasPrefix(clean, "../") ||
+		strings.Contains(name, "\\") || strings.Contains(clean, PartSuffix) {
+		return "", ErrBadName
+	}
+	return clean, nil
+}
+
+// Receive receives a file offered from the other end of c, resuming it
+// if an earlier attempt left part of it. c is left open.
+func (r *Receiver) Receive(ctx context.Context, c io.ReadWriter) (Result, error) {
+	defer watch(ctx, c)()
+	res, err := r.receive(c)
+	return res, ctxErr(ctx, err)
+}
+
+func (r *Receiver) receive(c io.ReadWriter) (Result, error) {
+	m, err := readMessage(c)
+	if err != nil {
+		return Result{}, err
+	}
+	if m.Type != typeOffer {
+		return Result{}, r.reject(c, errors.New("srtfile: "+m.Type+" message where an offer was expected"))
+	}
+	res := Result{Name: m.Name, Size: m.Size}
+	name, err := cleanName(m.Name)
+	if err != nil {
+		return res, r.reject(c, err)
+	}
+	if m.Size < 0 {
+		return res, r.reject(c, errors.New("srtfile: negative size"))
+	}
+	if m.Parts > 0 && (m.Part < 0 || m.Part >= m.Parts || m.Start < 0 || m.Start+m.Size > m.Total) {
+		return res, r.reject(c, fmt.Errorf("srtfile: bad part %d of %d at %d+%d of %d bytes", m.Part, m.Parts, m.Start, m.Size, m.Total))
+	}
+	var h func() hash.Hash
+	if m.Checksum != ChecksumNone {
+		var ok bool
+		if h, ok = newHash(m.Checksum); !ok {
+			return res, r.reject(c, fmt.Errorf("srtfile: unknown checksum %q", m.Checksum))
+		}
+		if m.Chunk <= 0 {
+			return res, r.reject(c, errors.New("srtfile: no chunk size"))
+		}
+	}
+	if r.Checksum != ChecksumNone && m.Checksum != r.Checksum {
+		return res, r.reject(c, fmt.Errorf("srtfile: checksum %s required", r.Checksum))
+	}
+	final := filepath.Join(r.Dir, filepath.FromSlash(name))
+	key, part, start, size := name, final+PartSuffix, int64(0), m.Size
+	if m.Parts > 0 {
+		key, part, start, size = fmt.Sprintf("%s\x00%d", name, m.Part), partName(final, m.Part), m.Start, m.Total
+	}
+	if !r.acquire(key) {
+		return res, r.reject(c, errBusy)
+	}
+	defer r.release(key)
+
+	if fi, err := os.Stat(final); err == nil && fi.Mode().IsRegular() && fi.Size() == size && fi.ModTime().UnixNano() == m.ModTime {
+		res.Offset = m.Size
+		return res, r.had(c, final, start, m, h)
+	}
+	if err := os.MkdirAll(filepath.Dir(final), 0755); err != nil {
+		return res, r.reject(c, err)
+	}
+	f, offset, err := openPart(part, m)
+	if err != nil {
+		return res, r.reject(c, err)
+	}
+	res.Offset = offset
+	var whole hash.Hash
+	if h != nil {
+		// What the part has is needed for the checksum of the file.
+		whole = h()
+		if err := hashFile(whole, part, 0, offset); err != nil {
+			f.Close()
+			return res, r.reject(c, err)
+		}
+	}
+	if err := writeMessage(c, &message{Type: typeAccept, Offset: offset}); err != nil {
+		f.Close()
+		return res, err
+	}
+	data := &countReader{r: c}
+	complete := false
+	stop := watchProgress(m, offset, r.ProgressInterval, r.OnProgress, func() (int64, int64) {
+		n := atomic.LoadInt64(&data.n)
+		return n, n
+	})
+	defer func() { stop(complete) }()
+	// What was written of a transfer cut off is kept for the next
+	// attempt to resume from.
+	if h == nil {
+		if _, err := io.CopyN(f, data, m.Size-offset); err != nil {
+			f.Close()
+			return res, unexpected(err)
+		}
+	} else if err := r.receiveChunks(c, data, f, m, offset, whole, h()); err != nil {
+		f.Close()
+		return res, err
+	}
+	var digest string
+	if whole != nil {
+		end, err := readMessage(c)
+		if err != nil {
+			f.Close()
+			return res, unexpected(err)
+		}
+		if end.Type != typeEnd {
+			f.Close()
+			return res, r.reject(c, errors.New("srtfile: "+end.Type+" message where an end was expected"))
+		}
+		if digest = hex.EncodeToString(whole.Sum(nil)); digest != end.Digest {
+			// Which bytes are wrong isn't known, so none are kept.
+			f.Close()
+			os.Remove(part)
+			os.Remove(part + ".json")
+			return res, r.mismatch(c, Mismatch{Name: m.Name, Size: m.Size, Whole: true, Want: end.Digest, Got: digest})
+		}
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return res, r.reject(c, err)
+	}
+	if err := f.Close(); err != nil {
+		return res, r.reject(c, err)
+	}
+	if m.Parts > 0 {
+		// The last part received puts them all together.
+		if err := writeSidecar(part, m, typeDone); err != nil {
+			return res, r.reject(c, err)
+		}
+		if err := r.assemble(final, m); err != nil {
+			return res, r.reject(c, err)
+		}
+	} else if err := finish(part, final, m.ModTime); err != nil {
+		return res, r.reject(c, err)
+	}
+	complete = true
+	return res, writeMessage(c, &message{Type: typeDone, Size: m.Size, Digest: digest})
+}
+
+// finish gives the file part received the modification time mtime and
+// renames it final.
+func finish(part, final string, mtime int64) error {
+	t := time.Unix(0, mtime)
+	if err := os.Chtimes(part, t, t); err != nil {
+		return err
+	}
+	if err := os.Rename(part, final); err != nil {
+		return err
+	}
+	os.Remove(part + ".json")
+	return nil
+}
+
+// had completes the transfer of what m offers of a file the receiver
+// has whole already, at final, from start, verifying it if h is set.
+func (r *Receiver) had(c io.ReadWriter, final string, start int64, m *message, h func() hash.Hash) error {
+	if err := writeMessage(c, &message{Type: typeAccept, Offset: m.Size}); err != nil {
+		return err
+	}
+	var digest string
+	if h != nil {
+		end, err := readMessage(c)
+		if err != nil {
+			return unexpected(err)
+		}
+		if end.Type != typeEnd {
+			return r.reject(c, errors.New("srtfile: "+end.Type+" message where an end was expected"))
+		}
+		whole := h()
+		if err := hashFile(whole, final, start, m.Size); err != nil {
+			return r.reject(c, err)
+		}
+		if digest = hex.EncodeToString(whole.Sum(nil)); digest != end.Digest {
+			os.Remove(final)
+			return r.mismatch(c, Mismatch{Name: m.Name, Size: m.Size, Whole: true, Want: end.Digest, Got: digest})
+		}
+	}
+	return writeMessage(c, &message{Type: typeDone, Size: m.Size, Digest: digest})
+}
+
+// receiveChunks writes the chunks of the file from off, read from data,
+// to f, verifying
+// each. A chunk that doesn't match is truncated off f, for the next
+// attempt to send it again.
+func (r *Receiver) receiveChunks(c io.ReadWriter, data io.Reader, f *os.File, m *message, off int64, whole, chunk hash.Hash) error {
+	for off < m.Size {
+		n := m.Chunk
+		if left := m.Size - off; n > left {
+			n = left
+		}
+		chunk.Reset()
+		if _, err := io.CopyN(io.MultiWriter(f, whole, chunk), data, n); err != nil {
+			return unexpected(err)
+		}
+		cm, err := readMessage(c)
+		if err != nil {
+			return unexpected(err)
+		}
+		if cm.Type != typeChunk {
+			return r.reject(c, errors.New("srtfile: "+cm.Type+" message where a chunk was expected"))
+		}
+		if got := hex.EncodeToString(chunk.Sum(nil)); got != cm.Digest {
+			if err := f.Truncate(off); err != nil {
+				return r.reject(c, err)
+			}
+			if err := f.Sync(); err != nil {
+				return r.reject(c, err)
+			}
+			return r.mismatch(c, Mismatch{Name: m.Name, Offset: off, Size: n, Want: cm.Digest, Got: got})
+		}
+		off += n
+	}
+	return nil
+}
+
+// hashFile writes n bytes of the file name from off to h.
+func hashFile(h hash.Hash, name string, off, n int64) error {
+	f, err := os.Open(name)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	if _, err := io.CopyN(h, io.NewSectionReader(f, off, n), n); err != nil {
+		return unexpected(err)
+	}
+	return nil
+}
+
+// openPart opens the part file part for the offer m, returning the
+// offset to resume from: its size if it was left by an offer of the
+// same file, 0 otherwise.
+func openPart(part string, m *message) (*os.File, int64, error) {
+	if had, ok := readSidecar(part); ok {
+		// Parts received whole are offered again if the file isn't put
+		// together before the sender hears of them.
+		if had.Type == typeDone {
+			had.Type = typeOffer
+		}
+		if *had == offerOf(m, typeOffer) {
+			if f, err := os.OpenFile(part, os.O_WRONLY, 0); err == nil {
+				if off, err := f.Seek(0, io.SeekEnd); err == nil && off <= m.Size {
+					return f, off, nil
+				}
+				f.Close()
+			}
+		}
+	}
+	if err := writeSidecar(part, m, typeOffer); err != nil {
+		return nil, 0, err
+	}
+	f, err := os.OpenFile(part, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0644)
+	return f, 0, err
+}
+
+// offerOf returns what the sidecar of a part file keeps of the offer m,
+// as a message of type typ: typeOffer, or typeDone once received.
+func offerOf(m *message, typ string) message {
+	return message{Type: typ, Name: m.Name, Size: m.Size, ModTime: m.ModTime,
+		Part: m.Part, Parts: m.Parts, Start: m.Start, Total: m.Total}
+}
+
+func readSidecar(part string) (*message, bool) {
+	b, err := ioutil.ReadFile(part + ".json")
+	if err != nil {
+		return nil, false
+	}
+	m := new(message)
+	if json.Unmarshal(b, m) != nil {
+		return nil, false
+	}
+	return m, true
+}
+
+func writeSidecar(part string, m *message, typ string) error {
+	had := offerOf(m, typ)
+	b, err := json.Marshal(&had)
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(part+".json", b, 0644)
+}
+
+// reject tells the sender why its file isn't received, and returns the
+// reason.
+func (r *Receiver) reject(c io.Writer, err error) error {
+	writeMessage(c, &message{Type: typeReject, Error: err.Error()})
+	return err
+}
+
+// A countReader is a reader from a connection counting the bytes of the
+// file read.
+type countReader struct {
+	r io.Reader
+	n int64 // atomic
+}
+
+func (r *countReader) Read(b []byte) (int, error) {
+	n, err := r.r.Read(b)
+	atomic.AddInt64(&r.n, int64(n))
+	return n, err
+}
+
+// mismatch reports mm, to OnMismatch and the sender, and returns it as
+// an error.
+func (r *Receiver) mismatch(c io.Writer, mm Mismatch) error {
+	if r.OnMismatch != nil {
+		r.OnMismatch(mm)
+	}
+	writeMessage(c, &message{Type: typeMismatch, Mismatch: &mm})
+	return &MismatchError{mm}
+}
+
+func (r *Receiver) acquire(name string) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.active[name] {
+		return false
+	}
+	if r.active == nil {
+		r.active = make(map[string]bool)
+	}
+	r.active[name] = true
+	return true
+}
+
+func (r *Receiver) release(name string) {
+	r.mu.Lock()
+	delete(r.active, name)
+	r.mu.Unlock()
+}
+
+// Serve receives a file from each connection ln accepts, until ctx is
+// done, when it closes ln and returns ctx.Err(), or ln fails.
+func (r *Receiver) Serve(ctx context.Context, ln net.Listener) error {
+	stop := make(chan struct{})
+	defer close(stop)
+	go func() {
+		select {
+		case <-ctx.Done():
+			ln.Close()
+		case <-stop:
+		}
+	}()
+	for {
+		c, err := ln.Accept()
+		if err != nil {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			return err
+		}
+		go func() {
+			defer c.Close()
+			res, err := r.Receive(ctx, c)
+			if r.OnReceive != nil {
+				r.OnReceive(res, err)
+			}
+		}()
+	}
+}
@@ -0,0 +1,332 @@
+// Copyright (c) 2020 CyberAgent, Inc. All rights reserved.
+// https://github.com/openfresh/gosrt
+
+package srtfile
+
+import (
+	"context"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"time"
+
+	"github.com/openfresh/gosrt/srt"
+)
+
+// Send offers the file at path to the receiver at the other end of c
+// under name, or the base name of path if name is empty, and sends it
+// from the offset the receiver accepts, without checksums. It returns
+// once the receiver has the whole file. c is left open.
+func Send(ctx context.Context, c io.ReadWriter, path, name string) (Result, error) {
+	return new(Sender).Send(ctx, c, path, name)
+}
+
+// DefaultSendAttempts and DefaultSendBackoff are the attempts and
+// backoff of a Sender leaving them 0.
+const (
+	DefaultSendAttempts = 5
+	DefaultSendBackoff  = time.Second
+)
+
+// A Sender sends files over connections of its own, making a new one
+// to resume each transfer that was cut off.
+type Sender struct {
+	// Dial makes a connection to the receiver, such as with Dial.
+	Dial func(ctx context.Context) (net.Conn, error)
+
+	// Attempts bounds the connections made for a file, and Backoff is
+	// the pause before each one after the first, doubling every time;
+	// 0 means DefaultSendAttempts and DefaultSendBackoff.
+	Attempts int
+	Backoff  time.Duration
+
+	// Checksum is the checksum the receiver verifies the transfers
+	// with, ChecksumNone for none, and ChunkSize the size of the
+	// chunks it verifies, DefaultChunkSize if 0.
+	Checksum  string
+	ChunkSize int64
+
+	// Links, if set, are the dials SendFile uses instead of Dial, one
+	// per uplink say, to send the parts of a file in parallel: each
+	// link sends the next part left, of PartSize bytes, DefaultPartSize
+	// if 0, and links that fail leave their part to the others.
+	Links    []func(ctx context.Context) (net.Conn, error)
+	PartSize int64
+
+	// OnProgress, if set, is called with the progress of each transfer
+	// every ProgressInterval, DefaultProgressInterval if 0, and once
+	// at its end. With Links, it is that of all the parts of the file.
+	OnProgress       func(Progress)
+	ProgressInterval time.Duration
+}
+
+// Send is the package's Send with the checksum of s.
+func (s *Sender) Send(ctx context.Context, c io.ReadWriter, path, name string) (Result, error) {
+	f, offer, err := openFile(path, name)
+	if err != nil {
+		return Result{}, err
+	}
+	defer f.Close()
+	return s.send(ctx, c, f, offer)
+}
+
+// openFile opens the file at path, returning its offer under name, or
+// its base name if name is empty.
+func openFile(path, name string) (*os.File, *message, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, nil, err
+	}
+	fi, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, nil, err
+	}
+	if !fi.Mode().IsRegular() {
+		f.Close()
+		return nil, nil, fmt.Errorf("srtfile: %s is not a regular file", path)
+	}
+	if name == "" {
+		name = filepath.Base(path)
+	}
+	return f, &message{Type: typeOffer, Name: name, Size: fi.Size(), ModTime: fi.ModTime().UnixNano()}, nil
+}
+
+// send sends f, or what offer offers of it, over c.
+func (s *Sender) send(ctx context.Context, c io.ReadWriter, f io.ReadSeeker, offer *message) (Result, error) {
+	var h func() hash.Hash
+	if s.Checksum != ChecksumNone {
+		var ok bool
+		if h, ok = newHash(s.Checksum); !ok {
+			return Result{Name: offer.Name, Size: offer.Size}, fmt.Errorf("srtfile: unknown checksum %q", s.Checksum)
+		}
+		offer.Checksum, offer.Chunk = s.Checksum, s.ChunkSize
+		if offer.Chunk <= 0 {
+			offer.Chunk = DefaultChunkSize
+		}
+	}
+	defer watch(ctx, c)()
+	res, err := s.transfer(c, f, offer, h)
+	return res, ctxErr(ctx, err)
+}
+
+func (s *Sender) transfer(c io.ReadWriter, f io.ReadSeeker, offer *message, h func() hash.Hash) (Result, error) {
+	res := Result{Name: offer.Name, Size: offer.Size}
+	if err := writeMessage(c, offer); err != nil {
+		return res, err
+	}
+	m, err := readMessage(c)
+	if err != nil {
+		return res, unexpected(err)
+	}
+	switch {
+	case m.Type == typeReject:
+		return res, &RejectError{Reason: m.Error}
+	case m.Type != typeAccept:
+		return res, fmt.Errorf("srtfile: %s message where an accept was expected", m.Type)
+	case m.Offset < 0 || m.Offset > offer.Size:
+		return res, fmt.Errorf("srtfile: offset %d accepted of %d bytes", m.Offset, offer.Size)
+	}
+	res.Offset = m.Offset
+	// The receiver answers a chunk that doesn't match right away, so
+	// its answer is read while the file is sent.
+	type answer struct {
+		m   *message
+		err error
+	}
+	ch := make(chan answer, 1)
+	go func() {
+		m, err := readMessage(c)
+		ch <- answer{m, err}
+	}()
+	w := &connWriter{w: c}
+	stop := watchProgress(offer, m.Offset, s.ProgressInterval, s.OnProgress, func() (int64, int64) {
+		n := atomic.LoadInt64(&w.file)
+		if bl, ok := c.(sendBuffer); ok {
+			if l, err := bl.SendBufferLevel(); err == nil && int64(l.Bytes) <= n {
+				return n, n - int64(l.Bytes)
+			}
+			return n, 0
+		}
+		return n, n
+	})
+	digest, err := sendData(w, f, offer, m.Offset, h)
+	if err != nil && w.err == nil {
+		// The file failed, not c, so no answer is coming.
+		expire(c)
+	}
+	a := <-ch
+	stop(a.err == nil && err == nil && a.m.Type == typeDone)
+	switch {
+	case a.err != nil:
+		if err != nil {
+			return res, err
+		}
+		return res, unexpected(a.err)
+	case a.m.Type == typeReject:
+		return res, &RejectError{Reason: a.m.Error}
+	case a.m.Type == typeMismatch && a.m.Mismatch != nil:
+		return res, &MismatchError{*a.m.Mismatch}
+	case err != nil:
+		return res, err
+	case a.m.Type != typeDone || a.m.Size != offer.Size:
+		return res, fmt.Errorf("srtfile: %s message of %d bytes where a done of %d was expected", a.m.Type, a.m.Size, offer.Size)
+	case a.m.Digest != digest:
+		return res, fmt.Errorf("srtfile: done with checksum %s of %s", a.m.Digest, digest)
+	}
+	return res, nil
+}
+
+// sendBuffer is implemented by the SRT connections, whose send buffer
+// tells what of the bytes written isn't acknowledged yet.
+type sendBuffer interface {
+	SendBufferLevel() (srt.BufferLevel, error)
+}
+
+// A connWriter is a writer to a connection that keeps the error of its
+// writes, and counts the bytes of the file among them.
+type connWriter struct {
+	w    io.Writer
+	err  error
+	file int64 // atomic
+}
+
+func (w *connWriter) Write(b []byte) (int, error) {
+	n, err := w.w.Write(b)
+	if err != nil {
+		w.err = err
+	}
+	return n, err
+}
+
+// fileWriter writes the bytes of the file to a connWriter.
+type fileWriter struct {
+	*connWriter
+}
+
+func (w fileWriter) Write(b []byte) (int, error) {
+	n, err := w.connWriter.Write(b)
+	atomic.AddInt64(&w.file, int64(n))
+	return n, err
+}
+
+// sendData sends the file from off, in chunks with their checksums if
+// h is set.
+func sendData(c *connWriter, f io.ReadSeeker, offer *message, off int64, h func() hash.Hash) (string, error) {
+	if h != nil {
+		return sendChunks(c, f, offer, off, h)
+	}
+	if _, err := f.Seek(off, io.SeekStart); err != nil {
+		return "", err
+	}
+	return "", copyFile(fileWriter{c}, f, offer.Name, offer.Size-off)
+}
+
+// copyFile copies n bytes of the file name from f to w.
+func copyFile(w io.Writer, f io.Reader, name string, n int64) error {
+	if _, err := io.CopyN(w, f, n); err != nil {
+		if err == io.EOF {
+			err = fmt.Errorf("srtfile: %s shrank while being sent", name)
+		}
+		return err
+	}
+	return nil
+}
+
+// sendChunks sends the file from off in chunks with their checksums,
+// and then the checksum of the whole file, reading what comes before
+// off for it. It returns the latter.
+func sendChunks(c *connWriter, f io.ReadSeeker, offer *message, off int64, h func() hash.Hash) (string, error) {
+	whole := h()
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		return "", err
+	}
+	if err := copyFile(whole, f, offer.Name, off); err != nil {
+		return "", err
+	}
+	chunk := h()
+	for off < offer.Size {
+		n := offer.Chunk
+		if left := offer.Size - off; n > left {
+			n = left
+		}
+		chunk.Reset()
+		if err := copyFile(io.MultiWriter(fileWriter{c}, whole, chunk), f, offer.Name, n); err != nil {
+			return "", err
+		}
+		if err := writeMessage(c, &message{Type: typeChunk, Digest: hex.EncodeToString(chunk.Sum(nil))}); err != nil {
+			return "", err
+		}
+		off += n
+	}
+	digest := hex.EncodeToString(whole.Sum(nil))
+	return digest, writeMessage(c, &message{Type: typeEnd, Digest: digest})
+}
+
+// SendFile sends the file at path under name, or its base name if name
+// is empty, resuming it until it is complete, the receiver rejects it,
+// the attempts run out or ctx is done. A checksum mismatch is resumed
+// as an interruption is. The Result is that of the last attempt, or
+// with Links, of all the parts together.
+func (s *Sender) SendFile(ctx context.Context, path, name string) (Result, error) {
+	if len(s.Links) > 0 {
+		return s.sendParallel(ctx, path, name)
+	}
+	return s.retry(ctx, s.Dial, func(c net.Conn) (Result, error) {
+		return s.Send(ctx, c, path, name)
+	})
+}
+
+// retry calls send with connections of dial until it succeeds, fails
+// for good or the attempts run out.
+func (s *Sender) retry(ctx context.Context, dial func(context.Context) (net.Conn, error), send func(net.Conn) (Result, error)) (Result, error) {
+	attempts, backoff := s.Attempts, s.Backoff
+	if attempts <= 0 {
+		attempts = DefaultSendAttempts
+	}
+	if backoff <= 0 {
+		backoff = DefaultSendBackoff
+	}
+	var (
+		res Result
+		err error
+	)
+	for i := 0; i < attempts; i++ {
+		if i > 0 {
+			t := time.NewTimer(backoff << uint(i-1))
+			select {
+			case <-ctx.Done():
+				t.Stop()
+				return res, ctx.Err()
+			case <-t.C:
+			}
+		}
+		var c net.Conn
+		if c, err = dial(ctx); err != nil {
+			if ctx.Err() != nil {
+				return res, ctx.Err()
+			}
+			continue
+		}
+		res, err = send(c)
+		c.Close()
+		if err == nil || permanent(err) || ctx.Err() != nil {
+			return res, err
+		}
+	}
+	return res, err
+}
+
+// permanent reports whether err won't go away with another attempt: a
+// rejection, or a file that can't be read.
+func permanent(err error) bool {
+	var re *RejectError
+	var pe *os.PathError
+	return errors.As(err, &re) || errors.As(err, &pe)
+}
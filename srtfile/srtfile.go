@@ -0,0 +1,243 @@
+// Copyright (c) 2020 CyberAgent, Inc. All rights reserved.
+// https://github.com/openfresh/gosrt
+
+// Package srtfile transfers files over SRT stream mode connections,
+// resuming interrupted transfers where they stopped: the sender offers
+// a file, the receiver answers with the offset it already has of it,
+// kept from an earlier attempt, and only the rest is sent. Transfers of
+// large files over flaky links thus make progress with every attempt
+// rather than restarting from zero.
+//
+//	s := &srtfile.Sender{Dial: func(ctx context.Context) (net.Conn, error) {
+//		return srtfile.Dial(ctx, nil, "ingest:5000")
+//	}}
+//	res, err := s.SendFile(ctx, "/var/media/show.ts", "")
+//
+//	ln, err := srtfile.Listen(ctx, ":5000")
+//	r := &srtfile.Receiver{Dir: "/srv/incoming"}
+//	err = r.Serve(ctx, ln)
+//
+// A Sender with a checksum has the receiver verify each chunk of the
+// file, and the whole of it, against those it computes as it sends:
+// chunks that arrive corrupted are sent again, and files that end up
+// different are received anew.
+//
+// A Sender with Links sends files in parts over several connections at
+// once, through several uplinks to aggregate their bandwidth; the
+// receiver puts the parts together once it has them all.
+//
+// The receiver writes a file being received to the name plus
+// PartSuffix, with what it knows of the offer alongside, and renames it
+// once complete; a sender offering the same file again, of the same
+// name, size and modification time, resumes it.
+//
+// The protocol runs over any reliable byte stream; Dial and Listen make
+// the SRT ones, with the options of srt.StreamOptions. Stream mode
+// needs libsrt; otherwise they fail with srt.ErrStreamMode.
+package srtfile
+
+import (
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"time"
+
+	"github.com/openfresh/gosrt/srt"
+)
+
+// Network is the network of the connections.
+const Network = "srt"
+
+// ErrStreamMode is the error of Dial and Listen when the SRT
+// implementation has no stream mode, as in the nosrtlib build.
+var ErrStreamMode = srt.ErrStreamMode
+
+// dialContext dials with d. It is a variable for tests.
+var dialContext = (*srt.Dialer).DialContext
+
+// Dial connects to address in stream mode with d, or a zero srt.Dialer
+// if d is nil.
+func Dial(ctx context.Context, d *srt.Dialer, address string) (net.Conn, error) {
+	if d == nil {
+		d = &srt.Dialer{}
+	}
+	c, err := dialContext(d, srt.WithOptions(ctx, srt.StreamOptions()), Network, address)
+	if err != nil {
+		return nil, err
+	}
+	if sc, ok := c.(interface{ StreamMode() bool }); ok && !sc.StreamMode() {
+		c.Close()
+		return nil, ErrStreamMode
+	}
+	return c, nil
+}
+
+// Listen returns a listener accepting stream mode connections on
+// address, for Receiver.Serve.
+func Listen(ctx context.Context, address string) (net.Listener, error) {
+	ln, err := srt.ListenContext(srt.WithOptions(ctx, srt.StreamOptions()), Network, address)
+	if err != nil {
+		return nil, err
+	}
+	if !ln.(*srt.SRTListener).StreamMode() {
+		ln.Close()
+		return nil, ErrStreamMode
+	}
+	return ln, nil
+}
+
+// Message types. A transfer is an offer from the sender and an accept,
+// or a reject, from the receiver; then the bytes of the file from the
+// offset accepted, and a done from the receiver once it has them all.
+// With a checksum, the bytes come in chunks, each followed by a chunk
+// message with its checksum, and an end message with that of the whole
+// file comes after them; the receiver answers a checksum that doesn't
+// match with a mismatch message.
+const (
+	typeOffer    = "offer"
+	typeAccept   = "accept"
+	typeReject   = "reject"
+	typeDone     = "done"
+	typeChunk    = "chunk"
+	typeEnd      = "end"
+	typeMismatch = "mismatch"
+)
+
+// maxMessage bounds the messages read, which are small.
+const maxMessage = 64 << 10
+
+// A message is a step of the protocol, sent as its JSON length, a
+// 32-bit big-endian number, and its JSON.
+type message struct {
+	Type    string `json:"type"`
+	Name    string `json:"name,omitempty"`
+	Size    int64  `json:"size,omitempty"`
+	ModTime int64  `json:"mtime,omitempty"` // Unix nanoseconds
+	Offset  int64  `json:"offset,omitempty"`
+	Error   string `json:"error,omitempty"`
+
+	Checksum string    `json:"checksum,omitempty"`
+	Chunk    int64     `json:"chunk,omitempty"`  // chunk size
+	Digest   string    `json:"digest,omitempty"` // hexadecimal
+	Mismatch *Mismatch `json:"mismatch,omitempty"`
+
+	// An offer of part Part of Parts of a file sent in parallel offers
+	// Size bytes of it from Start, of the Total.
+	Part  int   `json:"part,omitempty"`
+	Parts int   `json:"parts,omitempty"`
+	Start int64 `json:"start,omitempty"`
+	Total int64 `json:"total,omitempty"`
+}
+
+func writeMessage(w io.Writer, m *message) error {
+	b, err := json.Marshal(m)
+	if err != nil {
+		return err
+	}
+	buf := make([]byte, 4, 4+len(b))
+	binary.BigEndian.PutUint32(buf, uint32(len(b)))
+	_, err = w.Write(append(buf, b...))
+	return err
+}
+
+func readMessage(r io.Reader) (*message, error) {
+	var n [4]byte
+	if _, err := io.ReadFull(r, n[:]); err != nil {
+		return nil, err
+	}
+	size := binary.BigEndian.Uint32(n[:])
+	if size > maxMessage {
+		return nil, fmt.Errorf("srtfile: message of %d bytes", size)
+	}
+	b := make([]byte, size)
+	if _, err := io.ReadFull(r, b); err != nil {
+		return nil, unexpected(err)
+	}
+	m := new(message)
+	if err := json.Unmarshal(b, m); err != nil {
+		return nil, fmt.Errorf("srtfile: bad message: %v", err)
+	}
+	return m, nil
+}
+
+// unexpected turns the EOF of a transfer cut short into
+// io.ErrUnexpectedEOF.
+func unexpected(err error) error {
+	if err == io.EOF {
+		return io.ErrUnexpectedEOF
+	}
+	return err
+}
+
+// A RejectError is the error of a transfer the receiver refused, with
+// its reason.
+type RejectError struct {
+	Reason string
+}
+
+func (e *RejectError) Error() string {
+	return "srtfile: rejected: " + e.Reason
+}
+
+// ErrBadName is the reason of a receiver rejecting a name that isn't a
+// relative slash-separated path within its directory.
+var ErrBadName = errors.New("srtfile: bad file name")
+
+// A Result is what a transfer did.
+type Result struct {
+	Name string
+	Size int64
+
+	// Offset is where the transfer resumed, 0 for a new one, and Size
+	// for a file the receiver had whole already.
+	Offset int64
+}
+
+// Transferred returns the bytes of the file the transfer carried.
+func (r Result) Transferred() int64 {
+	return r.Size - r.Offset
+}
+
+// watch sets a deadline in the past on c once ctx is done, so that the
+// reads and writes of the transfer return, until stop is called.
+func watch(ctx context.Context, c interface{}) (stop func()) {
+	dc, ok := c.(interface{ SetDeadline(time.Time) error })
+	if !ok || ctx.Done() == nil {
+		return func() {}
+	}
+	done := make(chan struct{})
+	finished := make(chan struct{})
+	go func() {
+		defer close(finished)
+		select {
+		case <-ctx.Done():
+			expire(dc)
+		case <-done:
+		}
+	}()
+	return func() {
+		close(done)
+		<-finished
+	}
+}
+
+// expire sets a deadline in the past on c, if it has deadlines, failing
+// its reads and writes.
+func expire(c interface{}) {
+	if dc, ok := c.(interface{ SetDeadline(time.Time) error }); ok {
+		dc.SetDeadline(time.Unix(1, 0))
+	}
+}
+
+// ctxErr returns the error of ctx if it is done, the cause of err most
+// likely, or else err.
+func ctxErr(ctx context.Context, err error) error {
+	if err != nil && ctx.Err() != nil {
+		return ctx.Err()
+	}
+	return err
+}
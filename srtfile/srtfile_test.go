@@ -0,0 +1,476 @@
+// Copyright (c) 2020 CyberAgent, Inc. All rights reserved.
+// https://github.com/openfresh/gosrt
+
+package srtfile
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io/ioutil"
+	"math/rand"
+	"net"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+)
+
+// cutConn is a connection failing once it wrote n bytes.
+type cutConn struct {
+	net.Conn
+	n int
+}
+
+func (c *cutConn) Write(b []byte) (int, error) {
+	if len(b) <= c.n {
+		c.n -= len(b)
+		return c.Conn.Write(b)
+	}
+	n, _ := c.Conn.Write(b[:c.n])
+	c.n = 0
+	c.Conn.Close()
+	return n, errors.New("link down")
+}
+
+func writeFile(t *testing.T, size int) (string, []byte) {
+	t.Helper()
+	data := make([]byte, size)
+	rand.New(rand.NewSource(1)).Read(data)
+	name := filepath.Join(t.TempDir(), "show.ts")
+	if err := ioutil.WriteFile(name, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+	mtime := time.Date(2020, 4, 1, 12, 0, 0, 0, time.UTC)
+	if err := os.Chtimes(name, mtime, mtime); err != nil {
+		t.Fatal(err)
+	}
+	return name, data
+}
+
+// flipConn is a connection flipping a bit of the byte at n of what it
+// writes.
+type flipConn struct {
+	net.Conn
+	n int
+}
+
+func (c *flipConn) Write(b []byte) (int, error) {
+	if c.n >= 0 && c.n < len(b) {
+		b = append([]byte(nil), b...)
+		b[c.n] ^= 1
+	}
+	c.n -= len(b)
+	return c.Conn.Write(b)
+}
+
+// transfer sends src as name through a pipe to r, the sender's end cut
+// after cut bytes if cut isn't 0.
+func transfer(t *testing.T, r *Receiver, src, name string, cut int) (Result, error, Result, error) {
+	t.Helper()
+	return transferBy(t, new(Sender), r, src, name, func(c net.Conn) net.Conn {
+		if cut > 0 {
+			return &cutConn{Conn: c, n: cut}
+		}
+		return c
+	})
+}
+
+// transferBy sends src as name with s through a pipe to r, the sender's
+// end wrapped by wrap.
+func transferBy(t *testing.T, snd *Sender, r *Receiver, src, name string, wrap func(net.Conn) net.Conn) (Result, error, Result, error) {
+	t.Helper()
+	c1, c2 := net.Pipe()
+	defer c1.Close()
+	defer c2.Close()
+	s := wrap(c1)
+	type outcome struct {
+		res Result
+		err error
+	}
+	ch := make(chan outcome, 1)
+	go func() {
+		res, err := r.Receive(context.Background(), c2)
+		c2.Close()
+		ch <- outcome{res, err}
+	}()
+	sres, serr := snd.Send(context.Background(), s, src, name)
+	c1.Close()
+	o := <-ch
+	return sres, serr, o.res, o.err
+}
+
+func TestTransfer(t *testing.T) {
+	src, data := writeFile(t, 1<<20)
+	r := &Receiver{Dir: t.TempDir()}
+	sres, serr, rres, rerr := transfer(t, r, src, "", 0)
+	if serr != nil || rerr != nil {
+		t.Fatalf("transfer: %v, %v", serr, rerr)
+	}
+	want := Result{Name: "show.ts", Size: 1 << 20}
+	if sres != want || rres != want {
+		t.Errorf("results %+v, %+v; want %+v", sres, rres, want)
+	}
+	dst := filepath.Join(r.Dir, "show.ts")
+	if got, _ := ioutil.ReadFile(dst); !bytes.Equal(got, data) {
+		t.Error("file received differs")
+	}
+	sfi, _ := os.Stat(src)
+	if fi, err := os.Stat(dst); err != nil || !fi.ModTime().Equal(sfi.ModTime()) {
+		t.Errorf("modification time %v, %v; want %v", fi.ModTime(), err, sfi.ModTime())
+	}
+	if _, err := os.Stat(dst + PartSuffix + ".json"); !os.IsNotExist(err) {
+		t.Errorf("offer left behind: %v", err)
+	}
+
+	// The same file again is had whole already.
+	sres, serr, _, rerr = transfer(t, r, src, "", 0)
+	if serr != nil || rerr != nil || sres.Offset != sres.Size || sres.Transferred() != 0 {
+		t.Errorf("second transfer %+v: %v, %v; want nothing transferred", sres, serr, rerr)
+	}
+}
+
+func TestResume(t *testing.T) {
+	src, data := writeFile(t, 1<<20)
+	r := &Receiver{Dir: t.TempDir()}
+	_, serr, _, rerr := transfer(t, r, src, "media/show.ts", 300<<10)
+	if serr == nil || rerr == nil {
+		t.Fatalf("cut transfer: %v, %v; want both failing", serr, rerr)
+	}
+	dst := filepath.Join(r.Dir, "media", "show.ts")
+	fi, err := os.Stat(dst + PartSuffix)
+	if err != nil || fi.Size() == 0 {
+		t.Fatalf("part file %v, %v; want what came", fi, err)
+	}
+	kept := fi.Size()
+
+	sres, serr, _, rerr := transfer(t, r, src, "media/show.ts", 0)
+	if serr != nil || rerr != nil {
+		t.Fatalf("resumed transfer: %v, %v", serr, rerr)
+	}
+	if sres.Offset != kept {
+		t.Errorf("resumed at %d; want %d", sres.Offset, kept)
+	}
+	if got, _ := ioutil.ReadFile(dst); !bytes.Equal(got, data) {
+		t.Error("file received differs")
+	}
+
+	// A part left by another version of the file is started over.
+	_, _, _, _ = transfer(t, r, src, "media/other.ts", 300<<10)
+	os.Chtimes(src, time.Now(), time.Now())
+	if sres, serr, _, rerr = transfer(t, r, src, "media/other.ts", 0); serr != nil || rerr != nil || sres.Offset != 0 {
+		t.Errorf("transfer of a changed file %+v: %v, %v; want it started over", sres, serr, rerr)
+	}
+}
+
+func TestReject(t *testing.T) {
+	src, _ := writeFile(t, 1000)
+	r := &Receiver{Dir: t.TempDir()}
+	for _, name := range []string{"../escape", "/abs", "a/../../b", "x" + PartSuffix} {
+		_, serr, _, rerr := transfer(t, r, src, name, 0)
+		var re *RejectError
+		if !errors.As(serr, &re) || rerr != ErrBadName {
+			t.Errorf("transfer as %q: %v, %v; want it rejected", name, serr, rerr)
+		}
+	}
+}
+
+func TestSender(t *testing.T) {
+	src, data := writeFile(t, 1<<20)
+	r := &Receiver{Dir: t.TempDir()}
+	dials := 0
+	s := &Sender{
+		Backoff: time.Millisecond,
+		Dial: func(ctx context.Context) (net.Conn, error) {
+			dials++
+			c1, c2 := net.Pipe()
+			go func() {
+				defer c2.Close()
+				r.Receive(ctx, c2)
+			}()
+			if dials < 3 {
+				return &cutConn{Conn: c1, n: 200 << 10}, nil
+			}
+			return c1, nil
+		},
+	}
+	res, err := s.SendFile(context.Background(), src, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if dials != 3 || res.Offset == 0 {
+		t.Errorf("%d dials, last resumed at %d; want 3, resuming", dials, res.Offset)
+	}
+	if got, _ := ioutil.ReadFile(filepath.Join(r.Dir, "show.ts")); !bytes.Equal(got, data) {
+		t.Error("file received differs")
+	}
+}
+
+func TestChecksum(t *testing.T) {
+	for _, alg := range []string{ChecksumXXH64, ChecksumSHA256} {
+		t.Run(alg, func(t *testing.T) {
+			src, data := writeFile(t, 1<<20)
+			var mismatches []Mismatch
+			r := &Receiver{Dir: t.TempDir(), OnMismatch: func(mm Mismatch) { mismatches = append(mismatches, mm) }}
+			s := &Sender{Checksum: alg, ChunkSize: 100 << 10}
+			dst := filepath.Join(r.Dir, "show.ts")
+
+			// A byte corrupted in the fourth chunk fails it, keeping the
+			// three before.
+			_, serr, _, rerr := transferBy(t, s, r, src, "", func(c net.Conn) net.Conn {
+				return &flipConn{Conn: c, n: 350 << 10}
+			})
+			var sme, rme *MismatchError
+			if !errors.As(serr, &sme) || !errors.As(rerr, &rme) || sme.Mismatch != rme.Mismatch {
+				t.Fatalf("corrupted transfer: %v, %v; want the same mismatch", serr, rerr)
+			}
+			if mm := rme.Mismatch; mm.Whole || mm.Offset != 300<<10 || mm.Size != 100<<10 || mm.Want == mm.Got {
+				t.Errorf("mismatch %+v; want that of the chunk at %d", mm, 300<<10)
+			}
+			if len(mismatches) != 1 || mismatches[0] != rme.Mismatch {
+				t.Errorf("mismatches reported %+v; want %+v", mismatches, rme.Mismatch)
+			}
+			sres, serr, _, rerr := transferBy(t, s, r, src, "", func(c net.Conn) net.Conn { return c })
+			if serr != nil || rerr != nil || sres.Offset != 300<<10 {
+				t.Fatalf("resumed transfer %+v: %v, %v; want it resumed at the chunk", sres, serr, rerr)
+			}
+			if got, _ := ioutil.ReadFile(dst); !bytes.Equal(got, data) {
+				t.Error("file received differs")
+			}
+
+			// A file had whole already is verified, and received anew if
+			// it differs.
+			if sres, serr, _, rerr = transferBy(t, s, r, src, "", func(c net.Conn) net.Conn { return c }); serr != nil || rerr != nil || sres.Transferred() != 0 {
+				t.Errorf("second transfer %+v: %v, %v; want nothing transferred", sres, serr, rerr)
+			}
+			got, _ := ioutil.ReadFile(dst)
+			got[0] ^= 1
+			ioutil.WriteFile(dst, got, 0644)
+			fi, _ := os.Stat(src)
+			os.Chtimes(dst, fi.ModTime(), fi.ModTime())
+			_, serr, _, rerr = transferBy(t, s, r, src, "", func(c net.Conn) net.Conn { return c })
+			if !errors.As(serr, &sme) || !sme.Whole || rerr == nil {
+				t.Fatalf("transfer over a corrupted file: %v, %v; want a whole-file mismatch", serr, rerr)
+			}
+			if sres, serr, _, rerr = transferBy(t, s, r, src, "", func(c net.Conn) net.Conn { return c }); serr != nil || rerr != nil || sres.Offset != 0 {
+				t.Fatalf("transfer after the mismatch %+v: %v, %v; want it started over", sres, serr, rerr)
+			}
+			if got, _ := ioutil.ReadFile(dst); !bytes.Equal(got, data) {
+				t.Error("file received differs")
+			}
+		})
+	}
+}
+
+func TestChecksumRequired(t *testing.T) {
+	src, _ := writeFile(t, 1000)
+	r := &Receiver{Dir: t.TempDir(), Checksum: ChecksumSHA256}
+	_, serr, _, rerr := transfer(t, r, src, "", 0)
+	var re *RejectError
+	if !errors.As(serr, &re) || rerr == nil {
+		t.Errorf("transfer without a checksum: %v, %v; want it rejected", serr, rerr)
+	}
+	s := &Sender{Checksum: "crc"}
+	if _, serr, _, _ = transferBy(t, s, r, src, "", func(c net.Conn) net.Conn { return c }); serr == nil {
+		t.Error("transfer with an unknown checksum succeeded")
+	}
+}
+
+func TestParallel(t *testing.T) {
+	src, data := writeFile(t, 1<<20+1)
+	r := &Receiver{Dir: t.TempDir()}
+	pipe := func(ctx context.Context) (net.Conn, error) {
+		c1, c2 := net.Pipe()
+		go func() {
+			defer c2.Close()
+			r.Receive(ctx, c2)
+		}()
+		return c1, nil
+	}
+	var mu sync.Mutex
+	cuts := 0
+	s := &Sender{
+		Checksum: ChecksumXXH64,
+		Attempts: 2,
+		Backoff:  time.Millisecond,
+		PartSize: 100 << 10,
+		Links: []func(context.Context) (net.Conn, error){
+			pipe,
+			pipe,
+			// A link cut in every part leaves them to the others.
+			func(ctx context.Context) (net.Conn, error) {
+				mu.Lock()
+				cuts++
+				mu.Unlock()
+				c, err := pipe(ctx)
+				return &cutConn{Conn: c, n: 50 << 10}, err
+			},
+			func(ctx context.Context) (net.Conn, error) { return nil, errors.New("no route") },
+		},
+	}
+	res, err := s.SendFile(context.Background(), src, "media/show.ts")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// What the cut link got through of its part isn't sent again.
+	if res.Name != "media/show.ts" || res.Size != 1<<20+1 || res.Offset == 0 {
+		t.Errorf("result %+v; want the file, resumed", res)
+	}
+	if cuts != 2 {
+		t.Errorf("cut link dialed %d times; want 2", cuts)
+	}
+	dst := filepath.Join(r.Dir, "media", "show.ts")
+	if got, _ := ioutil.ReadFile(dst); !bytes.Equal(got, data) {
+		t.Error("file received differs")
+	}
+	if left, _ := filepath.Glob(filepath.Join(r.Dir, "media", "*"+PartSuffix+"*")); len(left) > 0 {
+		t.Errorf("left behind %q", left)
+	}
+
+	// The parts of the file had whole already aren't sent.
+	if res, err = s.SendFile(context.Background(), src, "media/show.ts"); err != nil || res.Transferred() != 0 {
+		t.Errorf("second transfer %+v: %v; want nothing transferred", res, err)
+	}
+
+	// Without working links, the parts left are reported.
+	s.Links = s.Links[3:]
+	if _, err = s.SendFile(context.Background(), src, "other.ts"); err == nil {
+		t.Error("transfer without links succeeded")
+	}
+}
+
+func TestProgress(t *testing.T) {
+	src, _ := writeFile(t, 1<<20)
+	var mu sync.Mutex
+	var sent, received []Progress
+	r := &Receiver{Dir: t.TempDir(), ProgressInterval: time.Millisecond, OnProgress: func(p Progress) {
+		mu.Lock()
+		received = append(received, p)
+		mu.Unlock()
+	}}
+	s := &Sender{Checksum: ChecksumXXH64, ProgressInterval: time.Millisecond, OnProgress: func(p Progress) { sent = append(sent, p) }}
+	transferBy(t, s, r, src, "", func(c net.Conn) net.Conn { return &cutConn{Conn: c, n: 300 << 10} })
+	sent, received = nil, nil
+	sres, serr, _, rerr := transferBy(t, s, r, src, "", func(c net.Conn) net.Conn { return c })
+	if serr != nil || rerr != nil {
+		t.Fatalf("transfer: %v, %v", serr, rerr)
+	}
+	for side, ps := range map[string][]Progress{"sent": sent, "received": received} {
+		if len(ps) == 0 {
+			t.Errorf("no progress %s", side)
+			continue
+		}
+		last := ps[len(ps)-1]
+		want := sres.Transferred()
+		if last.Name != "show.ts" || last.Offset != sres.Offset || last.Total != want || last.Bytes != want || last.Acked != want || last.ETA() != 0 {
+			t.Errorf("last progress %s %+v; want %d bytes from %d", side, last, want, sres.Offset)
+		}
+	}
+
+	// The progress of parts sent in parallel is that of the file.
+	var last Progress
+	s.OnProgress = func(p Progress) { last = p }
+	s.PartSize = 100 << 10
+	pipe := func(ctx context.Context) (net.Conn, error) {
+		c1, c2 := net.Pipe()
+		go func() {
+			defer c2.Close()
+			r.Receive(ctx, c2)
+		}()
+		return c1, nil
+	}
+	s.Links = []func(context.Context) (net.Conn, error){pipe, pipe}
+	if _, err := s.SendFile(context.Background(), src, "parts.ts"); err != nil {
+		t.Fatal(err)
+	}
+	if last.Name != "parts.ts" || last.Offset != 0 || last.Total != 1<<20 || last.Acked != 1<<20 {
+		t.Errorf("last progress of the parts %+v; want all of the file", last)
+	}
+}
+
+func TestSync(t *testing.T) {
+	dir := t.TempDir()
+	for name, content := range map[string]string{
+		"a.ts":                     "first",
+		"sub/b.ts":                 "second",
+		"sub/c.ts" + PartSuffix:    "being received",
+		"skipped/d.ts":             "skipped",
+		"sub/deeper/e.ts":          "third",
+		"sub/deeper/e.ts.srtstate": "not a part",
+	} {
+		path := filepath.Join(dir, filepath.FromSlash(name))
+		os.MkdirAll(filepath.Dir(path), 0755)
+		if err := ioutil.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	r := &Receiver{Dir: t.TempDir()}
+	dials := 0
+	var progress []SyncProgress
+	s := &Syncer{
+		Sender: &Sender{Checksum: ChecksumSHA256, Dial: func(ctx context.Context) (net.Conn, error) {
+			dials++
+			c1, c2 := net.Pipe()
+			go func() {
+				defer c2.Close()
+				r.Receive(ctx, c2)
+			}()
+			return c1, nil
+		}},
+		State:      filepath.Join(dir, "state.json"),
+		Skip:       func(name string, fi os.FileInfo) bool { return name == "skipped" },
+		OnProgress: func(p SyncProgress) { progress = append(progress, p) },
+	}
+	res, err := s.Sync(context.Background(), dir)
+	if want := (SyncResult{Files: 4, Synced: 4, Transferred: 26}); err != nil || res != want {
+		t.Fatalf("sync %+v, %v; want %+v", res, err, want)
+	}
+	last := progress[len(progress)-1]
+	if len(progress) != 4 || last.Name != "sub/deeper/e.ts.srtstate" || last.FilesDone != 4 || last.BytesDone != 26 || last.Bytes != 26 {
+		t.Errorf("progress %+v; want 4 files and 26 bytes", progress)
+	}
+	for _, name := range []string{"a.ts", "sub/b.ts", "sub/deeper/e.ts"} {
+		got, _ := ioutil.ReadFile(filepath.Join(r.Dir, filepath.FromSlash(name)))
+		want, _ := ioutil.ReadFile(filepath.Join(dir, filepath.FromSlash(name)))
+		if !bytes.Equal(got, want) {
+			t.Errorf("%s received %q; want %q", name, got, want)
+		}
+	}
+
+	// The files unchanged are skipped without a dial.
+	later := time.Now().Add(time.Hour)
+	os.Chtimes(filepath.Join(dir, "sub", "b.ts"), later, later)
+	dials = 0
+	if res, err = s.Sync(context.Background(), dir); err != nil || res.Skipped != 3 || res.Synced != 1 || dials != 1 {
+		t.Errorf("second sync %+v, %v with %d dials; want one file sent", res, err, dials)
+	}
+	if fi, err := os.Stat(filepath.Join(r.Dir, "sub", "b.ts")); err != nil || !fi.ModTime().Equal(later) {
+		t.Errorf("changed file received %v, %v", fi, err)
+	}
+}
+
+func TestListenStreamMode(t *testing.T) {
+	ln, err := Listen(context.Background(), "127.0.0.1:0")
+	if err == ErrStreamMode {
+		t.Skip("stream mode not supported:", err)
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	r := &Receiver{Dir: t.TempDir()}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go r.Serve(ctx, ln)
+	src, data := writeFile(t, 1<<20)
+	s := &Sender{Dial: func(ctx context.Context) (net.Conn, error) {
+		return Dial(ctx, nil, ln.Addr().String())
+	}}
+	if _, err := s.SendFile(ctx, src, ""); err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := ioutil.ReadFile(filepath.Join(r.Dir, "show.ts")); !bytes.Equal(got, data) {
+		t.Error("file received differs")
+	}
+}
@@ -0,0 +1,87 @@
+// Copyright (c) 2020 CyberAgent, Inc. All rights reserved.
+// https://github.com/openfresh/gosrt
+
+// Package srtgrpc carries gRPC over SRT stream mode connections, so
+// that control-plane RPCs can share the links of the media. It doesn't
+// depend on gRPC: clients pass ContextDialer to grpc.WithContextDialer,
+// and servers pass a Listen listener to grpc.Server.Serve.
+//
+//	conn, err := grpc.NewClient("passthrough:///encoder:5000",
+//		grpc.WithContextDialer(srtgrpc.ContextDialer(nil)),
+//		grpc.WithTransportCredentials(insecure.NewCredentials()))
+//
+//	ln, err := srtgrpc.Listen(ctx, ":5000")
+//	err = grpc.NewServer().Serve(ln)
+//
+// Options set on the contexts with srt.WithOptions, such as a
+// passphrase or latency, apply to the connections along with those of
+// srt.StreamOptions.
+package srtgrpc
+
+import (
+	"context"
+	"net"
+
+	"github.com/openfresh/gosrt/srt"
+)
+
+// Network is the network of the connections.
+const Network = "srt"
+
+// ErrStreamMode is the error of ContextDialer and Listen when the SRT
+// implementation has no stream mode, as in the nosrtlib build. Live
+// mode messages can't carry gRPC.
+var ErrStreamMode = srt.ErrStreamMode
+
+// dialContext dials with d. It is a variable for tests.
+var dialContext = (*srt.Dialer).DialContext
+
+// ContextDialer returns a dial function for grpc.WithContextDialer
+// that connects in stream mode with d, or a zero srt.Dialer if d is
+// nil. The address is that of the gRPC target; with the passthrough
+// scheme, it is left for SRT to resolve.
+func ContextDialer(d *srt.Dialer) func(ctx context.Context, address string) (net.Conn, error) {
+	if d == nil {
+		d = &srt.Dialer{}
+	}
+	return func(ctx context.Context, address string) (net.Conn, error) {
+		c, err := dialContext(d, srt.WithOptions(ctx, srt.StreamOptions()), Network, address)
+		if err != nil {
+			return nil, err
+		}
+		if sc, ok := c.(streamer); ok {
+			if err := streamMode(sc); err != nil {
+				c.Close()
+				return nil, err
+			}
+		}
+		return c, nil
+	}
+}
+
+// Listen returns a listener accepting stream mode connections on
+// address, for grpc.Server.Serve.
+func Listen(ctx context.Context, address string) (net.Listener, error) {
+	ln, err := srt.ListenContext(srt.WithOptions(ctx, srt.StreamOptions()), Network, address)
+	if err != nil {
+		return nil, err
+	}
+	if err := streamMode(ln.(*srt.SRTListener)); err != nil {
+		ln.Close()
+		return nil, err
+	}
+	return ln, nil
+}
+
+type streamer interface {
+	StreamMode() bool
+}
+
+// streamMode checks that c took the stream mode options, which setting
+// doesn't report.
+func streamMode(c streamer) error {
+	if !c.StreamMode() {
+		return ErrStreamMode
+	}
+	return nil
+}
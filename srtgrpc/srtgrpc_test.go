@@ -0,0 +1,80 @@
+// Copyright (c) 2020 CyberAgent, Inc. All rights reserved.
+// https://github.com/openfresh/gosrt
+
+package srtgrpc
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"net"
+	"testing"
+
+	"github.com/openfresh/gosrt/srt"
+)
+
+func TestContextDialerOptions(t *testing.T) {
+	defer func(f func(*srt.Dialer, context.Context, string, string) (net.Conn, error)) { dialContext = f }(dialContext)
+	var got []string
+	dialContext = func(d *srt.Dialer, ctx context.Context, network, address string) (net.Conn, error) {
+		for _, key := range []string{"transtype", "messageapi", "passphrase"} {
+			v, _ := srt.Option(ctx, key)
+			got = append(got, v)
+		}
+		got = append(got, network, address)
+		return nil, errors.New("no network")
+	}
+	ctx := srt.WithOptions(context.Background(), srt.Options("passphrase", "0123456789"))
+	if _, err := ContextDialer(nil)(ctx, "encoder:5000"); err == nil {
+		t.Fatal("dial succeeded")
+	}
+	want := []string{"1", "false", "0123456789", "srt", "encoder:5000"}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Fatalf("dialed with %q; want %q", got, want)
+		}
+	}
+}
+
+// TestStream checks that the connections carry a byte stream, which
+// HTTP/2 framing relies on: writes larger than a packet, read back in
+// small pieces.
+func TestStream(t *testing.T) {
+	ln, err := Listen(context.Background(), "127.0.0.1:0")
+	if err == ErrStreamMode {
+		t.Skip("stream mode not supported:", err)
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	go func() {
+		c, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		defer c.Close()
+		io.Copy(c, c)
+	}()
+
+	c, err := ContextDialer(nil)(context.Background(), ln.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	data := bytes.Repeat([]byte("0123456789abcdef"), 64<<10/16)
+	go c.Write(data)
+	got := make([]byte, 0, len(data))
+	b := make([]byte, 100)
+	for len(got) < len(data) {
+		n, err := c.Read(b)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got = append(got, b[:n]...)
+	}
+	if !bytes.Equal(got, data) {
+		t.Error("stream corrupted")
+	}
+}
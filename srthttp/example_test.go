@@ -0,0 +1,32 @@
+// Copyright (c) 2020 CyberAgent, Inc. All rights reserved.
+// https://github.com/openfresh/gosrt
+
+package srthttp_test
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"net/http"
+
+	"github.com/openfresh/gosrt/srthttp"
+)
+
+func ExampleListenAndServe() {
+	http.HandleFunc("/status", func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, "ok\n")
+	})
+	log.Fatal(srthttp.ListenAndServe(":8080", nil))
+}
+
+func ExampleNewTransport() {
+	client := &http.Client{Transport: srthttp.NewTransport(nil)}
+	resp, err := client.Get("http://encoder.example.com:8080/status")
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer resp.Body.Close()
+	b, _ := ioutil.ReadAll(resp.Body)
+	fmt.Printf("%s", b)
+}
@@ -0,0 +1,83 @@
+// Copyright (c) 2020 CyberAgent, Inc. All rights reserved.
+// https://github.com/openfresh/gosrt
+
+// Package srthttp runs HTTP over SRT stream mode connections, so that
+// the management API of a device is reachable through its contribution
+// link. Clients use a NewTransport transport in an http.Client, servers
+// serve a Listen listener with http.Serve, and http and https URLs keep
+// their meaning, TLS running inside the SRT connection.
+//
+// Options set on the contexts with srt.WithOptions, such as a
+// passphrase, apply to the connections along with those of
+// srt.StreamOptions. Stream mode needs libsrt; otherwise dialing and
+// listening fail with srt.ErrStreamMode.
+package srthttp
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/openfresh/gosrt/srt"
+)
+
+// dialContext dials with d. It is a variable for tests.
+var dialContext = (*srt.Dialer).DialContext
+
+// DialContext returns a dial function for http.Transport.DialContext
+// that connects in stream mode with d, or a zero srt.Dialer if d is
+// nil. The network the transport asks for is ignored.
+func DialContext(d *srt.Dialer) func(ctx context.Context, network, address string) (net.Conn, error) {
+	if d == nil {
+		d = &srt.Dialer{}
+	}
+	return func(ctx context.Context, _, address string) (net.Conn, error) {
+		c, err := dialContext(d, srt.WithOptions(ctx, srt.StreamOptions()), "srt", address)
+		if err != nil {
+			return nil, err
+		}
+		if sc, ok := c.(interface{ StreamMode() bool }); ok && !sc.StreamMode() {
+			c.Close()
+			return nil, srt.ErrStreamMode
+		}
+		return c, nil
+	}
+}
+
+// NewTransport returns a transport making its connections with
+// DialContext(d), with the idle connection settings of
+// http.DefaultTransport. Requests never go through a proxy.
+func NewTransport(d *srt.Dialer) *http.Transport {
+	return &http.Transport{
+		DialContext:           DialContext(d),
+		MaxIdleConns:          100,
+		IdleConnTimeout:       90 * time.Second,
+		TLSHandshakeTimeout:   10 * time.Second,
+		ExpectContinueTimeout: time.Second,
+	}
+}
+
+// Listen returns a listener accepting stream mode connections on
+// address, for http.Serve or http.Server.Serve.
+func Listen(ctx context.Context, address string) (net.Listener, error) {
+	ln, err := srt.ListenContext(srt.WithOptions(ctx, srt.StreamOptions()), "srt", address)
+	if err != nil {
+		return nil, err
+	}
+	if !ln.(*srt.SRTListener).StreamMode() {
+		ln.Close()
+		return nil, srt.ErrStreamMode
+	}
+	return ln, nil
+}
+
+// ListenAndServe listens on address and serves handler on the
+// connections it accepts, as http.ListenAndServe does over TCP.
+func ListenAndServe(address string, handler http.Handler) error {
+	ln, err := Listen(context.Background(), address)
+	if err != nil {
+		return err
+	}
+	return http.Serve(ln, handler)
+}
@@ -0,0 +1,63 @@
+// Copyright (c) 2020 CyberAgent, Inc. All rights reserved.
+// https://github.com/openfresh/gosrt
+
+package srthttp
+
+import (
+	"context"
+	"errors"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/openfresh/gosrt/srt"
+)
+
+func TestDialContext(t *testing.T) {
+	defer func(f func(*srt.Dialer, context.Context, string, string) (net.Conn, error)) { dialContext = f }(dialContext)
+	var network, address, transtype string
+	dialContext = func(d *srt.Dialer, ctx context.Context, n, a string) (net.Conn, error) {
+		network, address = n, a
+		transtype, _ = srt.Option(ctx, "transtype")
+		return nil, errors.New("no network")
+	}
+	if _, err := DialContext(nil)(context.Background(), "tcp", "device:8080"); err == nil {
+		t.Fatal("dial succeeded")
+	}
+	if network != "srt" || address != "device:8080" || transtype != "1" {
+		t.Errorf("dialed %s %s with transtype %q; want srt device:8080 with 1", network, address, transtype)
+	}
+}
+
+func TestRoundTrip(t *testing.T) {
+	ln, err := Listen(context.Background(), "127.0.0.1:0")
+	if err == srt.ErrStreamMode {
+		t.Skip(err)
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	body := strings.Repeat("status ok\n", 1000)
+	go http.Serve(ln, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, r.URL.Path+"\n"+body)
+	}))
+
+	tr := NewTransport(nil)
+	defer tr.CloseIdleConnections()
+	client := &http.Client{Transport: tr}
+	for i := 0; i < 2; i++ {
+		resp, err := client.Get("http://" + ln.Addr().String() + "/status")
+		if err != nil {
+			t.Fatal(err)
+		}
+		b, err := ioutil.ReadAll(resp.Body)
+		resp.Body.Close()
+		if err != nil || string(b) != "/status\n"+body {
+			t.Fatalf("got %d bytes, %v", len(b), err)
+		}
+	}
+}
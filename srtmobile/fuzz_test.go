@@ -0,0 +1,46 @@
+// Copyright (c) 2020 CyberAgent, Inc. All rights reserved.
+// https://github.com/openfresh/gosrt
+
+//go:build go1.18
+// +build go1.18
+
+package srtmobile
+
+import (
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/openfresh/gosrt/srt"
+)
+
+func FuzzOptions(f *testing.F) {
+	f.Add("latency=200&streamid=feed")
+	f.Add("streamid=%23!%3A%3Ar%3Dlive&streamid=other")
+	f.Add("passphrase=a+b%2B&&transtype=1")
+	f.Add("a;b=c&%zz")
+	f.Fuzz(func(t *testing.T, options string) {
+		ctx, err := optionsContext(options)
+		if err != nil {
+			return
+		}
+		last := make(map[string]string)
+		for _, pair := range strings.Split(options, "&") {
+			if pair == "" {
+				continue
+			}
+			kv := strings.SplitN(pair, "=", 2)
+			k, _ := url.PathUnescape(kv[0])
+			last[k] = ""
+			if len(kv) == 2 {
+				last[k], _ = url.PathUnescape(kv[1])
+			}
+		}
+		for k, want := range last {
+			// The last value of a key wins.
+			if v, ok := srt.Option(ctx, k); !ok || v != want {
+				t.Fatalf("%q: got %s=%q, %v; want %q", options, k, v, ok, want)
+			}
+		}
+	})
+}
@@ -0,0 +1,176 @@
+// Copyright (c) 2020 CyberAgent, Inc. All rights reserved.
+// https://github.com/openfresh/gosrt
+
+// Package srtmobile is a front end to package srt that gomobile can
+// bind: its exported API only uses the types gomobile bind supports, so
+// Android and iOS apps can open SRT connections.
+//
+//	gomobile bind -target android github.com/openfresh/gosrt/srtmobile
+//
+// Socket options are passed as a URL query string of the options
+// accepted by srt.Options, such as "latency=200&streamid=feed", with
+// the keys and values escaped as in URL paths: "%2B" and "+" both
+// stand for '+'.
+package srtmobile
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/openfresh/gosrt/srt"
+)
+
+// optionsContext returns a context of the options of the query string
+// options, set in the order they come in, the last value of a key
+// winning. Keys and values are unescaped as URL paths rather than as
+// form values, so that a '+' in a passphrase stays one.
+func optionsContext(options string) (context.Context, error) {
+	ctx := context.Background()
+	var kv []string
+	for _, pair := range strings.Split(options, "&") {
+		if pair == "" {
+			continue
+		}
+		k, v := pair, ""
+		if i := strings.IndexByte(pair, '='); i >= 0 {
+			k, v = pair[:i], pair[i+1:]
+		}
+		k, err := url.PathUnescape(k)
+		if err != nil {
+			return nil, err
+		}
+		if v, err = url.PathUnescape(v); err != nil {
+			return nil, err
+		}
+		kv = append(kv, k, v)
+	}
+	if len(kv) > 0 {
+		ctx = srt.WithOptions(ctx, srt.Options(kv...))
+	}
+	return ctx, nil
+}
+
+// Conn is an SRT connection.
+type Conn struct {
+	c *srt.SRTConn
+}
+
+// Dial connects to the SRT listener at address, a host:port pair.
+func Dial(address string, options string) (*Conn, error) {
+	ctx, err := optionsContext(options)
+	if err != nil {
+		return nil, err
+	}
+	var d srt.Dialer
+	c, err := d.DialContext(ctx, "srt", address)
+	if err != nil {
+		return nil, err
+	}
+	return &Conn{c: c.(*srt.SRTConn)}, nil
+}
+
+// errBadReadSize is the error of a Read of no bytes at most.
+var errBadReadSize = errors.New("srtmobile: read size must be positive")
+
+// Read reads the next message, of at most max bytes, which must be
+// positive.
+func (c *Conn) Read(max int) ([]byte, error) {
+	if max <= 0 {
+		return nil, errBadReadSize
+	}
+	b := make([]byte, max)
+	n, err := c.c.Read(b)
+	return b[:n], err
+}
+
+// Write sends b as one message.
+func (c *Conn) Write(b []byte) (int, error) {
+	return c.c.Write(b)
+}
+
+// SetReadTimeout makes reads fail once ms milliseconds have passed
+// from now. Zero disables the timeout.
+func (c *Conn) SetReadTimeout(ms int64) error {
+	return c.c.SetReadDeadline(deadline(ms))
+}
+
+// SetWriteTimeout makes writes fail once ms milliseconds have passed
+// from now. Zero disables the timeout.
+func (c *Conn) SetWriteTimeout(ms int64) error {
+	return c.c.SetWriteDeadline(deadline(ms))
+}
+
+func deadline(ms int64) time.Time {
+	if ms == 0 {
+		return time.Time{}
+	}
+	return time.Now().Add(time.Duration(ms) * time.Millisecond)
+}
+
+// StreamID returns the stream ID of the connection.
+func (c *Conn) StreamID() (string, error) {
+	return c.c.StreamID()
+}
+
+// Stats returns the statistics of the connection, as the JSON encoding
+// of srt.SRTConn.Stats.
+func (c *Conn) Stats() (string, error) {
+	b, err := json.Marshal(c.c.Stats())
+	return string(b), err
+}
+
+// LocalAddress returns the local address of the connection.
+func (c *Conn) LocalAddress() string {
+	return c.c.LocalAddr().String()
+}
+
+// RemoteAddress returns the address of the peer.
+func (c *Conn) RemoteAddress() string {
+	return c.c.RemoteAddr().String()
+}
+
+// Close closes the connection.
+func (c *Conn) Close() error {
+	return c.c.Close()
+}
+
+// Listener is an SRT listener.
+type Listener struct {
+	l *srt.SRTListener
+}
+
+// Listen listens for SRT connections on address, a host:port pair.
+func Listen(address string, options string) (*Listener, error) {
+	ctx, err := optionsContext(options)
+	if err != nil {
+		return nil, err
+	}
+	l, err := srt.ListenContext(ctx, "srt", address)
+	if err != nil {
+		return nil, err
+	}
+	return &Listener{l: l.(*srt.SRTListener)}, nil
+}
+
+// Accept waits for and returns the next connection.
+func (l *Listener) Accept() (*Conn, error) {
+	c, err := l.l.AcceptSRT()
+	if err != nil {
+		return nil, err
+	}
+	return &Conn{c: c}, nil
+}
+
+// Address returns the address the listener listens on.
+func (l *Listener) Address() string {
+	return l.l.Addr().String()
+}
+
+// Close closes the listener.
+func (l *Listener) Close() error {
+	return l.l.Close()
+}
@@ -0,0 +1,83 @@
+// Copyright (c) 2020 CyberAgent, Inc. All rights reserved.
+// https://github.com/openfresh/gosrt
+
+package srtmobile
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/openfresh/gosrt/srt"
+)
+
+func TestDialListen(t *testing.T) {
+	l, err := Listen("127.0.0.1:0", "latency=20")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	accepted := make(chan *Conn, 1)
+	go func() {
+		c, err := l.Accept()
+		if err != nil {
+			t.Error(err)
+		}
+		accepted <- c
+	}()
+	c, err := Dial(l.Address(), "latency=20&streamid=feed")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	s := <-accepted
+	if s == nil {
+		return
+	}
+	defer s.Close()
+
+	if id, err := s.StreamID(); err != nil || id != "feed" {
+		t.Errorf("got stream ID %q, %v; want %q", id, err, "feed")
+	}
+	if c.RemoteAddress() != l.Address() {
+		t.Errorf("dialed %s, listening on %s", c.RemoteAddress(), l.Address())
+	}
+	if _, err := c.Write([]byte("hello")); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.SetReadTimeout(5000); err != nil {
+		t.Fatal(err)
+	}
+	b, err := s.Read(1316)
+	if err != nil || string(b) != "hello" {
+		t.Fatalf("got %q, %v; want %q", b, err, "hello")
+	}
+	if _, err := s.Read(0); err == nil {
+		t.Error("Read(0) succeeded")
+	}
+	stats, err := s.Stats()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var m map[string]interface{}
+	if err := json.Unmarshal([]byte(stats), &m); err != nil || m["recv"] == nil {
+		t.Errorf("got stats %s, %v", stats, err)
+	}
+}
+
+func TestBadOptions(t *testing.T) {
+	if _, err := Dial("127.0.0.1:1", "latency=%zz"); err == nil {
+		t.Error("Dial with a malformed options query succeeded")
+	}
+}
+
+func TestOptionsContext(t *testing.T) {
+	ctx, err := optionsContext("passphrase=a+b%2Bc%26d&streamid=one&&streamid=two&nakreport")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for k, want := range map[string]string{"passphrase": "a+b+c&d", "streamid": "two", "nakreport": ""} {
+		if v, ok := srt.Option(ctx, k); !ok || v != want {
+			t.Errorf("got %s=%q, %v; want %q", k, v, ok, want)
+		}
+	}
+}
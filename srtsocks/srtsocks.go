@@ -0,0 +1,391 @@
+// Copyright (c) 2020 CyberAgent, Inc. All rights reserved.
+// https://github.com/openfresh/gosrt
+
+// Package srtsocks gives field units general-purpose connectivity over
+// their SRT links: a Proxy accepts the connections of local
+// applications as a SOCKS5 server, and carries them through a single
+// stream mode SRT tunnel to an Exit, which connects them to their
+// destinations. Each connection is a stream of its own over the
+// tunnel, multiplexed with package mux, and half-closes pass through
+// it.
+//
+// Only the CONNECT command of SOCKS5 is supported, without
+// authentication: the SOCKS listener is meant for the local network of
+// the unit.
+package srtsocks
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"io"
+	"net"
+	"strconv"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/openfresh/gosrt/mux"
+	"github.com/openfresh/gosrt/srt"
+)
+
+// SOCKS5 constants (RFC 1928).
+const (
+	socksVersion = 5
+	cmdConnect   = 1
+	atypIPv4     = 1
+	atypDomain   = 3
+	atypIPv6     = 4
+
+	methodNone         = 0
+	methodNoAcceptable = 0xff
+)
+
+// Reply codes, which the Exit also sends back through the tunnel.
+const (
+	repSucceeded          = 0
+	repGeneralFailure     = 1
+	repNetworkUnreachable = 3
+	repHostUnreachable    = 4
+	repConnectionRefused  = 5
+	repCommandUnsupported = 7
+	repAddressUnsupported = 8
+)
+
+// ErrSOCKS is the error of a SOCKS client that broke the protocol.
+var ErrSOCKS = errors.New("srtsocks: malformed SOCKS request")
+
+// handshakeTimeout bounds the SOCKS negotiation and the connection of
+// the Exit to the destination.
+const handshakeTimeout = 10 * time.Second
+
+// tunnelConfig is the mux configuration of the tunnels: stream mode
+// connections don't bound frames to a packet.
+var tunnelConfig = &mux.Config{MaxFrameSize: 32 << 10}
+
+// A Proxy is the SOCKS5 server of a field unit.
+type Proxy struct {
+	// Exit is the address of the Exit, for srt.Dial.
+	Exit string
+
+	// DialTunnel, if set, dials the tunnel to the Exit instead of a
+	// stream mode connection to Exit with a zero srt.Dialer.
+	DialTunnel func(ctx context.Context) (net.Conn, error)
+
+	mu   sync.Mutex
+	sess *mux.Session
+}
+
+// ListenAndServe listens for SOCKS clients on the TCP address address
+// and serves them.
+func (p *Proxy) ListenAndServe(address string) error {
+	ln, err := net.Listen("tcp", address)
+	if err != nil {
+		return err
+	}
+	return p.Serve(ln)
+}
+
+// Serve accepts SOCKS clients on ln and serves them, until ln fails.
+// The tunnel is dialed when the first client connects, and dialed
+// again after it fails.
+func (p *Proxy) Serve(ln net.Listener) error {
+	defer ln.Close()
+	for {
+		c, err := ln.Accept()
+		if err != nil {
+			return err
+		}
+		go p.serve(c)
+	}
+}
+
+// Close closes the tunnel.
+func (p *Proxy) Close() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.sess == nil {
+		return nil
+	}
+	err := p.sess.Close()
+	p.sess = nil
+	return err
+}
+
+// session returns the session of the tunnel, dialing it if there is
+// none or it ended.
+func (p *Proxy) session(ctx context.Context) (*mux.Session, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.sess != nil {
+		select {
+		case <-p.sess.Done():
+		default:
+			return p.sess, nil
+		}
+	}
+	c, err := p.dialTunnel(ctx)
+	if err != nil {
+		return nil, err
+	}
+	p.sess = mux.Client(c, tunnelConfig)
+	return p.sess, nil
+}
+
+func (p *Proxy) dialTunnel(ctx context.Context) (net.Conn, error) {
+	if p.DialTunnel != nil {
+		return p.DialTunnel(ctx)
+	}
+	var d srt.Dialer
+	c, err := d.DialContext(srt.WithOptions(ctx, srt.StreamOptions()), "srt", p.Exit)
+	if err != nil {
+		return nil, err
+	}
+	if !c.(*srt.SRTConn).StreamMode() {
+		c.Close()
+		return nil, srt.ErrStreamMode
+	}
+	return c, nil
+}
+
+func (p *Proxy) serve(c net.Conn) {
+	defer c.Close()
+	c.SetDeadline(time.Now().Add(handshakeTimeout))
+	dest, err := readRequest(c)
+	if err != nil {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), handshakeTimeout)
+	defer cancel()
+	sess, err := p.session(ctx)
+	if err != nil {
+		writeReply(c, repNetworkUnreachable)
+		return
+	}
+	st, err := sess.Open()
+	if err != nil {
+		writeReply(c, repNetworkUnreachable)
+		return
+	}
+	defer st.Close()
+	st.SetDeadline(time.Now().Add(handshakeTimeout))
+	rep := []byte{repGeneralFailure}
+	if _, err := st.Write(dest); err == nil {
+		io.ReadFull(st, rep)
+	}
+	if err := writeReply(c, rep[0]); err != nil || rep[0] != repSucceeded {
+		return
+	}
+	c.SetDeadline(time.Time{})
+	st.SetDeadline(time.Time{})
+	splice(c, st)
+}
+
+// readRequest negotiates with a SOCKS client, and returns the
+// destination of its CONNECT request, as its address type, address and
+// port. Requests the Proxy can't serve are answered.
+func readRequest(c net.Conn) ([]byte, error) {
+	var b [4]byte
+	if _, err := io.ReadFull(c, b[:2]); err != nil {
+		return nil, err
+	}
+	if b[0] != socksVersion {
+		return nil, ErrSOCKS
+	}
+	methods := make([]byte, b[1])
+	if _, err := io.ReadFull(c, methods); err != nil {
+		return nil, err
+	}
+	method := byte(methodNoAcceptable)
+	for _, m := range methods {
+		if m == methodNone {
+			method = methodNone
+		}
+	}
+	if _, err := c.Write([]byte{socksVersion, method}); err != nil {
+		return nil, err
+	}
+	if method != methodNone {
+		return nil, ErrSOCKS
+	}
+
+	if _, err := io.ReadFull(c, b[:4]); err != nil {
+		return nil, err
+	}
+	if b[0] != socksVersion {
+		return nil, ErrSOCKS
+	}
+	if b[1] != cmdConnect {
+		writeReply(c, repCommandUnsupported)
+		return nil, ErrSOCKS
+	}
+	dest, err := readAddr(c, b[3])
+	if err == ErrSOCKS {
+		writeReply(c, repAddressUnsupported)
+	}
+	return dest, err
+}
+
+// readAddr reads an address of type atyp and its port, and returns
+// them behind atyp.
+func readAddr(r io.Reader, atyp byte) ([]byte, error) {
+	var n int
+	switch atyp {
+	case atypIPv4:
+		n = net.IPv4len
+	case atypIPv6:
+		n = net.IPv6len
+	case atypDomain:
+		var l [1]byte
+		if _, err := io.ReadFull(r, l[:]); err != nil {
+			return nil, err
+		}
+		b := make([]byte, 2+int(l[0])+2)
+		b[0], b[1] = atyp, l[0]
+		if _, err := io.ReadFull(r, b[2:]); err != nil {
+			return nil, err
+		}
+		return b, nil
+	default:
+		return nil, ErrSOCKS
+	}
+	b := make([]byte, 1+n+2)
+	b[0] = atyp
+	if _, err := io.ReadFull(r, b[1:]); err != nil {
+		return nil, err
+	}
+	return b, nil
+}
+
+// parseAddr returns the host:port of an address read by readAddr.
+func parseAddr(b []byte) string {
+	port := binary.BigEndian.Uint16(b[len(b)-2:])
+	var host string
+	if b[0] == atypDomain {
+		host = string(b[2 : len(b)-2])
+	} else {
+		host = net.IP(b[1 : len(b)-2]).String()
+	}
+	return net.JoinHostPort(host, strconv.Itoa(int(port)))
+}
+
+func writeReply(c net.Conn, rep byte) error {
+	// The bound address is left out, as clients connecting through a
+	// tunnel have no use for it.
+	_, err := c.Write([]byte{socksVersion, rep, 0, atypIPv4, 0, 0, 0, 0, 0, 0})
+	return err
+}
+
+// splice copies between a and b. The end of one direction is passed on
+// as a half-close when the other side supports it, like TCP
+// connections and mux streams, and the other direction goes on; else,
+// or on an error, both end.
+func splice(a, b io.ReadWriter) {
+	done := make(chan bool, 2)
+	pass := func(dst, src io.ReadWriter) {
+		_, err := io.Copy(dst, src)
+		cw, ok := dst.(interface{ CloseWrite() error })
+		done <- err == nil && ok && cw.CloseWrite() == nil
+	}
+	go pass(a, b)
+	go pass(b, a)
+	for i := 0; i < 2; i++ {
+		if !<-done {
+			return
+		}
+	}
+}
+
+// An Exit connects the streams of the tunnels of Proxies to their
+// destinations.
+type Exit struct {
+	// Dial, if set, connects to the destinations instead of a zero
+	// net.Dialer, which it can restrict.
+	Dial func(ctx context.Context, network, address string) (net.Conn, error)
+}
+
+// ListenAndServe listens for tunnels as stream mode SRT connections on
+// address and serves them.
+func (e *Exit) ListenAndServe(address string) error {
+	ln, err := srt.ListenContext(srt.WithOptions(context.Background(), srt.StreamOptions()), "srt", address)
+	if err != nil {
+		return err
+	}
+	if !ln.(*srt.SRTListener).StreamMode() {
+		ln.Close()
+		return srt.ErrStreamMode
+	}
+	return e.Serve(ln)
+}
+
+// Serve accepts tunnels on ln and serves them, until ln fails.
+func (e *Exit) Serve(ln net.Listener) error {
+	defer ln.Close()
+	for {
+		c, err := ln.Accept()
+		if err != nil {
+			return err
+		}
+		go e.ServeTunnel(c)
+	}
+}
+
+// ServeTunnel serves the streams of the tunnel c until it fails, and
+// closes it.
+func (e *Exit) ServeTunnel(c net.Conn) error {
+	sess := mux.Server(c, tunnelConfig)
+	defer sess.Close()
+	for {
+		st, err := sess.AcceptStream()
+		if err != nil {
+			return err
+		}
+		go e.serve(st)
+	}
+}
+
+func (e *Exit) serve(st *mux.Stream) {
+	defer st.Close()
+	st.SetDeadline(time.Now().Add(handshakeTimeout))
+	var atyp [1]byte
+	if _, err := io.ReadFull(st, atyp[:]); err != nil {
+		return
+	}
+	dest, err := readAddr(st, atyp[0])
+	if err != nil {
+		st.Write([]byte{repAddressUnsupported})
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), handshakeTimeout)
+	defer cancel()
+	dial := e.Dial
+	if dial == nil {
+		var d net.Dialer
+		dial = d.DialContext
+	}
+	c, err := dial(ctx, "tcp", parseAddr(dest))
+	if err != nil {
+		st.Write([]byte{replyCode(err)})
+		return
+	}
+	defer c.Close()
+	if _, err := st.Write([]byte{repSucceeded}); err != nil {
+		return
+	}
+	st.SetDeadline(time.Time{})
+	splice(c, st)
+}
+
+// replyCode returns the SOCKS reply code of a dial error.
+func replyCode(err error) byte {
+	var dnsErr *net.DNSError
+	switch {
+	case errors.Is(err, syscall.ECONNREFUSED):
+		return repConnectionRefused
+	case errors.Is(err, syscall.ENETUNREACH):
+		return repNetworkUnreachable
+	case errors.Is(err, syscall.EHOSTUNREACH), errors.As(err, &dnsErr):
+		return repHostUnreachable
+	}
+	return repGeneralFailure
+}
@@ -0,0 +1,182 @@
+// Copyright (c) 2020 CyberAgent, Inc. All rights reserved.
+// https://github.com/openfresh/gosrt
+
+package srtsocks
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"io"
+	"net"
+	"strconv"
+	"sync"
+	"testing"
+)
+
+// tunnelPair runs a Proxy on a local listener, whose tunnels are pipes
+// to exit, and returns its address and the number of tunnels dialed.
+func tunnelPair(t *testing.T, exit *Exit) (string, func() int) {
+	var mu sync.Mutex
+	var tunnels []net.Conn
+	p := &Proxy{DialTunnel: func(ctx context.Context) (net.Conn, error) {
+		c1, c2 := net.Pipe()
+		go exit.ServeTunnel(c2)
+		mu.Lock()
+		tunnels = append(tunnels, c2)
+		mu.Unlock()
+		return c1, nil
+	}}
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go p.Serve(ln)
+	t.Cleanup(func() {
+		ln.Close()
+		p.Close()
+	})
+	return ln.Addr().String(), func() int {
+		mu.Lock()
+		defer mu.Unlock()
+		// Break the tunnels as a link failure would.
+		for _, c := range tunnels {
+			c.Close()
+		}
+		return len(tunnels)
+	}
+}
+
+// connect asks the SOCKS server at proxy to connect to host:port, and
+// returns the connection and the reply code.
+func connect(t *testing.T, proxy string, cmd byte, host string, port int) (net.Conn, byte) {
+	t.Helper()
+	c, err := net.Dial("tcp", proxy)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { c.Close() })
+	c.Write([]byte{5, 2, 2, 0})
+	var b [10]byte
+	if _, err := io.ReadFull(c, b[:2]); err != nil || b[0] != 5 || b[1] != 0 {
+		t.Fatalf("got method %v, %v; want no authentication", b[:2], err)
+	}
+	req := []byte{5, cmd, 0}
+	if ip := net.ParseIP(host).To4(); ip != nil {
+		req = append(append(req, atypIPv4), ip...)
+	} else {
+		req = append(append(req, atypDomain, byte(len(host))), host...)
+	}
+	req = append(req, 0, 0)
+	binary.BigEndian.PutUint16(req[len(req)-2:], uint16(port))
+	c.Write(req)
+	if _, err := io.ReadFull(c, b[:]); err != nil {
+		t.Fatal(err)
+	}
+	return c, b[1]
+}
+
+func echoServer(t *testing.T) int {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ln.Close() })
+	go func() {
+		for {
+			c, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer c.Close()
+				io.Copy(c, c)
+			}()
+		}
+	}()
+	return ln.Addr().(*net.TCPAddr).Port
+}
+
+func TestProxy(t *testing.T) {
+	port := echoServer(t)
+	proxy, breakTunnels := tunnelPair(t, &Exit{})
+
+	for _, host := range []string{"127.0.0.1", "localhost", "127.0.0.1"} {
+		c, rep := connect(t, proxy, cmdConnect, host, port)
+		if rep != repSucceeded {
+			t.Fatalf("%s: got reply %d", host, rep)
+		}
+		data := bytes.Repeat([]byte(host), 10000)
+		go c.Write(data)
+		got := make([]byte, len(data))
+		if _, err := io.ReadFull(c, got); err != nil || !bytes.Equal(got, data) {
+			t.Fatalf("%s: echo corrupted: %v", host, err)
+		}
+		c.Close()
+	}
+	// The connections shared a tunnel; once it broke, another is dialed.
+	if n := breakTunnels(); n != 1 {
+		t.Errorf("%d tunnels; want 1", n)
+	}
+	if _, rep := connect(t, proxy, cmdConnect, "127.0.0.1", port); rep != repSucceeded {
+		t.Fatalf("got reply %d after the tunnel broke", rep)
+	}
+	if n := breakTunnels(); n != 2 {
+		t.Errorf("%d tunnels; want 2", n)
+	}
+}
+
+func TestProxyHalfClose(t *testing.T) {
+	port := echoServer(t)
+	proxy, _ := tunnelPair(t, &Exit{})
+	c, rep := connect(t, proxy, cmdConnect, "127.0.0.1", port)
+	if rep != repSucceeded {
+		t.Fatalf("got reply %d", rep)
+	}
+	data := bytes.Repeat([]byte("half-close"), 100000)
+	go func() {
+		c.Write(data)
+		c.(*net.TCPConn).CloseWrite()
+	}()
+	// The echo server closes once it read EOF, after echoing it all.
+	var got bytes.Buffer
+	if _, err := io.Copy(&got, c); err != nil || !bytes.Equal(got.Bytes(), data) {
+		t.Fatalf("got %d bytes, %v; want %d then EOF", got.Len(), err, len(data))
+	}
+}
+
+func TestProxyErrors(t *testing.T) {
+	port := echoServer(t)
+	proxy, _ := tunnelPair(t, &Exit{Dial: func(ctx context.Context, network, address string) (net.Conn, error) {
+		if address != "127.0.0.1:"+strconv.Itoa(port) {
+			return nil, errors.New("destination not allowed")
+		}
+		var d net.Dialer
+		return d.DialContext(ctx, network, address)
+	}})
+
+	// A closed port.
+	ln, _ := net.Listen("tcp", "127.0.0.1:0")
+	closed := ln.Addr().(*net.TCPAddr).Port
+	ln.Close()
+	tests := []struct {
+		cmd  byte
+		port int
+		rep  byte
+	}{
+		{cmdConnect, port, repSucceeded},
+		{2, port, repCommandUnsupported}, // BIND
+		{cmdConnect, port + 1, repGeneralFailure},
+	}
+	for _, tt := range tests {
+		if _, rep := connect(t, proxy, tt.cmd, "127.0.0.1", tt.port); rep != tt.rep {
+			t.Errorf("command %d to port %d: got reply %d; want %d", tt.cmd, tt.port, rep, tt.rep)
+		}
+	}
+
+	proxy, _ = tunnelPair(t, &Exit{})
+	if _, rep := connect(t, proxy, cmdConnect, "127.0.0.1", closed); rep != repConnectionRefused {
+		t.Errorf("got reply %d for a closed port; want %d", rep, repConnectionRefused)
+	}
+}
@@ -0,0 +1,165 @@
+// Copyright (c) 2020 CyberAgent, Inc. All rights reserved.
+// https://github.com/openfresh/gosrt
+
+// Package srttest provides utilities for tests of code using SRT, in
+// the manner of net/http/httptest: listeners and connected pairs on
+// the loopback interface, released when the test ends, and assertions
+// on what they receive.
+//
+// Built with the srtmock tag, everything runs over the in-memory
+// network of the pure Go implementation.
+package srttest
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/openfresh/gosrt/srt"
+)
+
+// Timeout bounds each read and accept of the helpers, so a test that
+// waits for data that never comes fails instead of hanging.
+var Timeout = 10 * time.Second
+
+// maxPayload is the size of the reads of the helpers, enough for any
+// message.
+const maxPayload = 64 << 10
+
+// NewListener returns a listener on an ephemeral port of the IPv4
+// loopback address, with options given as key and value pairs, as
+// srt.Options takes them. The listener is closed when the test ends.
+func NewListener(t testing.TB, options ...string) *srt.SRTListener {
+	t.Helper()
+	ctx := srt.WithOptions(context.Background(), srt.Options(options...))
+	ln, err := srt.ListenContext(ctx, "srt4", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("srttest: listen: %v", err)
+	}
+	t.Cleanup(func() { ln.Close() })
+	return ln.(*srt.SRTListener)
+}
+
+// Accept waits up to Timeout for a connection on ln.
+func Accept(t testing.TB, ln *srt.SRTListener) *srt.SRTConn {
+	t.Helper()
+	ln.SetDeadline(time.Now().Add(Timeout))
+	defer ln.SetDeadline(time.Time{})
+	c, err := ln.AcceptSRT()
+	if err != nil {
+		t.Fatalf("srttest: accept: %v", err)
+	}
+	t.Cleanup(func() { c.Close() })
+	return c
+}
+
+// NewPair returns the two ends of a connection, the caller first,
+// with options applied to both (see srt.PipeContext). They are closed
+// when the test ends.
+func NewPair(t testing.TB, options ...string) (*srt.SRTConn, *srt.SRTConn) {
+	t.Helper()
+	ctx := srt.WithOptions(context.Background(), srt.Options(options...))
+	c1, c2, err := srt.PipeContext(ctx)
+	if err != nil {
+		t.Fatalf("srttest: %v", err)
+	}
+	t.Cleanup(func() {
+		c1.Close()
+		c2.Close()
+	})
+	return c1, c2
+}
+
+// WritePayloads writes each payload as a message of c.
+func WritePayloads(t testing.TB, c net.Conn, payloads ...[]byte) {
+	t.Helper()
+	for i, p := range payloads {
+		if _, err := c.Write(p); err != nil {
+			t.Fatalf("srttest: write of payload %d: %v", i, err)
+		}
+	}
+}
+
+// ReadPayload reads a message from c, waiting up to Timeout.
+func ReadPayload(t testing.TB, c net.Conn) []byte {
+	t.Helper()
+	c.SetReadDeadline(time.Now().Add(Timeout))
+	defer c.SetReadDeadline(time.Time{})
+	b := make([]byte, maxPayload)
+	n, err := c.Read(b)
+	if err != nil {
+		t.Fatalf("srttest: read: %v", err)
+	}
+	return b[:n]
+}
+
+// ExpectPayloads reads as many messages from c as there are payloads
+// given, and fails the test unless they are these payloads in order.
+func ExpectPayloads(t testing.TB, c net.Conn, want ...[]byte) {
+	t.Helper()
+	for i, w := range want {
+		if got := ReadPayload(t, c); !bytes.Equal(got, w) {
+			t.Fatalf("srttest: payload %d: got %s; want %s", i, quote(got), quote(w))
+		}
+	}
+}
+
+// quote formats a payload for failure messages, cut short if long.
+func quote(p []byte) string {
+	const max = 64
+	if len(p) > max {
+		return fmt.Sprintf("%q... (%d bytes)", p[:max], len(p))
+	}
+	return fmt.Sprintf("%q", p)
+}
+
+// Stat returns the statistic of c at path, section and name joined
+// by a dot as in "recv.packetsLost", or "link.rtt". It reads them
+// through c.Stats, so it resets the interval counters as that does
+// unless full statistics are configured.
+func Stat(t testing.TB, c *srt.SRTConn, path string) float64 {
+	t.Helper()
+	v, err := stat(c.Stats(), path)
+	if err != nil {
+		t.Fatalf("srttest: %v", err)
+	}
+	return v
+}
+
+// ExpectStat fails the test unless the statistic of c at path is
+// within [min, max]. Use math.Inf for an unbounded side.
+func ExpectStat(t testing.TB, c *srt.SRTConn, path string, min, max float64) {
+	t.Helper()
+	if v := Stat(t, c, path); v < min || v > max {
+		t.Fatalf("srttest: statistic %s is %v; want it in [%v, %v]", path, v, min, max)
+	}
+}
+
+func stat(stats map[string]interface{}, path string) (float64, error) {
+	var v interface{} = stats
+	for _, name := range strings.Split(path, ".") {
+		m, ok := v.(map[string]interface{})
+		if !ok {
+			return 0, fmt.Errorf("no statistic %s", path)
+		}
+		if v, ok = m[name]; !ok {
+			return 0, fmt.Errorf("no statistic %s", path)
+		}
+	}
+	// The values have the types of the library's structure,
+	// C types in cgo builds.
+	switch rv := reflect.ValueOf(v); rv.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return float64(rv.Int()), nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return float64(rv.Uint()), nil
+	case reflect.Float32, reflect.Float64:
+		return rv.Float(), nil
+	}
+	return 0, fmt.Errorf("statistic %s is not a number", path)
+}
@@ -0,0 +1,69 @@
+// Copyright (c) 2020 CyberAgent, Inc. All rights reserved.
+// https://github.com/openfresh/gosrt
+
+package srttest
+
+import (
+	"math"
+	"testing"
+
+	"github.com/openfresh/gosrt/srt"
+)
+
+func TestNewListener(t *testing.T) {
+	ln := NewListener(t, "latency", "200")
+	c, err := srt.Dial("srt", ln.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	peer := Accept(t, ln)
+	WritePayloads(t, c, []byte("hello"))
+	ExpectPayloads(t, peer, []byte("hello"))
+}
+
+func TestNewPair(t *testing.T) {
+	c1, c2 := NewPair(t)
+	WritePayloads(t, c1, []byte("first"), []byte("second"))
+	ExpectPayloads(t, c2, []byte("first"), []byte("second"))
+	WritePayloads(t, c2, []byte("back"))
+	if got := ReadPayload(t, c1); string(got) != "back" {
+		t.Errorf("got %q; want %q", got, "back")
+	}
+	ExpectStat(t, c1, "send.packets", 2, math.Inf(1))
+}
+
+type cint int32 // stands for a C type
+
+func TestStat(t *testing.T) {
+	stats := map[string]interface{}{
+		"sid": 3,
+		"link": map[string]interface{}{
+			"rtt": 1.5,
+		},
+		"recv": map[string]interface{}{
+			"packets": cint(7),
+			"bytes":   uint64(42),
+		},
+	}
+	tests := []struct {
+		path string
+		v    float64
+		ok   bool
+	}{
+		{"sid", 3, true},
+		{"link.rtt", 1.5, true},
+		{"recv.packets", 7, true},
+		{"recv.bytes", 42, true},
+		{"recv", 0, false},
+		{"recv.unknown", 0, false},
+		{"sid.packets", 0, false},
+		{"", 0, false},
+	}
+	for _, tt := range tests {
+		v, err := stat(stats, tt.path)
+		if (err == nil) != tt.ok || v != tt.v {
+			t.Errorf("stat(%q) = %v, %v; want %v, ok %v", tt.path, v, err, tt.v, tt.ok)
+		}
+	}
+}
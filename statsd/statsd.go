@@ -0,0 +1,279 @@
+// Copyright (c) 2020 CyberAgent, Inc. All rights reserved.
+// https://github.com/openfresh/gosrt
+
+// Package statsd pushes the statistics of the connections of an
+// srt.Registry to a StatsD agent, in the DogStatsD format with tags
+// that Datadog, Telegraf and statsd_exporter read, or in the original
+// format without. Each connection reports, under the prefix,
+//
+//	send.packets, send.bytes, recv.packetsLost, ...   counters, the
+//	                                                  change since the
+//	                                                  last push
+//	link.rtt, window.flight, send.mbitRate, ...       gauges
+//
+// named after the keys of srt.SRTConn.Stats, and tagged with its
+// socket ID and labels (see srt.WithLabels). The counters are read
+// without clearing those the application reads with Stats; when it
+// clears them, the next push counts from zero.
+package statsd
+
+import (
+	"bytes"
+	"context"
+	"net"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/openfresh/gosrt/srt"
+	"github.com/openfresh/gosrt/srtapi"
+)
+
+// Defaults of the Pusher fields left zero.
+const (
+	DefaultAddr          = "127.0.0.1:8125"
+	DefaultInterval      = 10 * time.Second
+	DefaultPrefix        = "srt"
+	DefaultMaxPacketSize = 1432
+)
+
+// A Pusher pushes the statistics of the connections of Registry to a
+// StatsD agent every Interval. The fields must be set before Run.
+type Pusher struct {
+	// Registry holds the connections reported.
+	Registry *srt.Registry
+
+	// Addr is the UDP address of the agent. Empty means DefaultAddr.
+	Addr string
+
+	// Interval is the time between pushes. Zero means
+	// DefaultInterval.
+	Interval time.Duration
+
+	// Prefix starts the metric names. Empty means DefaultPrefix.
+	Prefix string
+
+	// Tags are added to every metric, as "key:value" or "key".
+	Tags []string
+
+	// ConnTags, if set, returns the tags of a connection, to add to
+	// its "sid" tag and its labels (see srt.WithLabels), which are
+	// tagged "key:value": its stream ID, say.
+	ConnTags func(c *srt.SRTConn) []string
+
+	// Plain sends the metrics in the original StatsD format, which
+	// has no tags: the socket ID of the connection goes in the names,
+	// as prefix.sid.name, and Tags and ConnTags are ignored.
+	Plain bool
+
+	// MaxPacketSize bounds the datagrams sent, which carry as many
+	// metrics as fit. Zero means DefaultMaxPacketSize.
+	MaxPacketSize int
+
+	mu   sync.Mutex
+	last map[int]map[string]int64 // the counters last pushed, by socket ID
+}
+
+// Run pushes the statistics every Interval until ctx is done, and
+// returns the error of ctx then, or that of reaching the agent. The
+// errors of the pushes themselves are ignored, as StatsD clients do:
+// metrics sent while the agent is down are lost.
+func (p *Pusher) Run(ctx context.Context) error {
+	addr := p.Addr
+	if addr == "" {
+		addr = DefaultAddr
+	}
+	var d net.Dialer
+	c, err := d.DialContext(ctx, "udp", addr)
+	if err != nil {
+		return err
+	}
+	defer c.Close()
+	interval := p.Interval
+	if interval <= 0 {
+		interval = DefaultInterval
+	}
+	t := time.NewTicker(interval)
+	defer t.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-t.C:
+			for _, b := range p.Collect() {
+				c.Write(b)
+			}
+		}
+	}
+}
+
+// Collect returns the datagrams of a push, and records the counters
+// for the next one.
+func (p *Pusher) Collect() [][]byte {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	prefix := p.Prefix
+	if prefix == "" {
+		prefix = DefaultPrefix
+	}
+	max := p.MaxPacketSize
+	if max <= 0 {
+		max = DefaultMaxPacketSize
+	}
+	last := make(map[int]map[string]int64)
+	var pk packer
+	pk.max = max
+	for _, c := range p.Registry.Conns() {
+		sid := c.SocketID()
+		stats := connStats(c)
+		if stats == nil {
+			continue
+		}
+		name, tags := prefix+".", ""
+		if p.Plain {
+			name += strconv.Itoa(sid) + "."
+		} else {
+			tags = p.tags(c, sid)
+		}
+		prev := p.last[sid]
+		counters := make(map[string]int64)
+		for _, m := range flatten(stats) {
+			if m.counter {
+				v := int64(m.value)
+				counters[m.name] = v
+				if pv, ok := prev[m.name]; ok && pv <= v {
+					v -= pv
+				}
+				pk.add(name + m.name + ":" + strconv.FormatInt(v, 10) + "|c" + tags)
+			} else {
+				pk.add(name + m.name + ":" + strconv.FormatFloat(m.value, 'f', -1, 64) + "|g" + tags)
+			}
+		}
+		last[sid] = counters
+	}
+	p.last = last
+	return pk.flush()
+}
+
+// tags returns the tag section of the metrics of c.
+func (p *Pusher) tags(c *srt.SRTConn, sid int) string {
+	tags := append([]string(nil), p.Tags...)
+	tags = append(tags, "sid:"+strconv.Itoa(sid))
+	labels := c.Labels()
+	keys := make([]string, 0, len(labels))
+	for k := range labels {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		tags = append(tags, k+":"+labels[k])
+	}
+	if p.ConnTags != nil {
+		tags = append(tags, p.ConnTags(c)...)
+	}
+	for i, t := range tags {
+		tags[i] = sanitize(t)
+	}
+	return "|#" + strings.Join(tags, ",")
+}
+
+// sanitize replaces the characters that delimit the fields of a
+// metric.
+func sanitize(s string) string {
+	return strings.Map(func(r rune) rune {
+		switch r {
+		case '|', ',', '#', '\n':
+			return '_'
+		}
+		return r
+	}, s)
+}
+
+// connStats returns the statistics of c, without clearing them, or nil
+// if it is closed.
+func connStats(c *srt.SRTConn) map[string]interface{} {
+	rc, err := c.RawConn()
+	if err != nil {
+		return nil
+	}
+	var stats map[string]interface{}
+	if rc.Control(func(s srtapi.SrtSocket) { stats = srtapi.GetStats(int(s), false) }) != nil {
+		return nil
+	}
+	return stats
+}
+
+type metric struct {
+	name    string
+	value   float64
+	counter bool
+}
+
+// flatten returns the numbers of stats, by dotted key path in key
+// order. The integers of the send and recv sections are counters, the
+// other numbers gauges.
+func flatten(stats map[string]interface{}) []metric {
+	var ms []metric
+	var walk func(path string, m map[string]interface{})
+	walk = func(path string, m map[string]interface{}) {
+		keys := make([]string, 0, len(m))
+		for k := range m {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			name := k
+			if path != "" {
+				name = path + "." + k
+			}
+			if sub, ok := m[k].(map[string]interface{}); ok {
+				walk(name, sub)
+				continue
+			}
+			if path == "" {
+				continue // sid and time
+			}
+			// The values are of C types with libsrt.
+			v := reflect.ValueOf(m[k])
+			switch v.Kind() {
+			case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+				ms = append(ms, metric{name, float64(v.Int()), path == "send" || path == "recv"})
+			case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+				ms = append(ms, metric{name, float64(v.Uint()), path == "send" || path == "recv"})
+			case reflect.Float32, reflect.Float64:
+				ms = append(ms, metric{name, v.Float(), false})
+			}
+		}
+	}
+	walk("", stats)
+	return ms
+}
+
+// A packer gathers metrics into datagrams of up to max bytes.
+type packer struct {
+	max  int
+	buf  bytes.Buffer
+	pkts [][]byte
+}
+
+func (pk *packer) add(line string) {
+	if pk.buf.Len() > 0 && pk.buf.Len()+1+len(line) > pk.max {
+		pk.pkts = append(pk.pkts, append([]byte(nil), pk.buf.Bytes()...))
+		pk.buf.Reset()
+	}
+	if pk.buf.Len() > 0 {
+		pk.buf.WriteByte('\n')
+	}
+	pk.buf.WriteString(line)
+}
+
+func (pk *packer) flush() [][]byte {
+	if pk.buf.Len() > 0 {
+		pk.pkts = append(pk.pkts, append([]byte(nil), pk.buf.Bytes()...))
+		pk.buf.Reset()
+	}
+	return pk.pkts
+}
@@ -0,0 +1,126 @@
+// Copyright (c) 2020 CyberAgent, Inc. All rights reserved.
+// https://github.com/openfresh/gosrt
+
+package statsd
+
+import (
+	"context"
+	"net"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/openfresh/gosrt/srt"
+)
+
+func TestPusher(t *testing.T) {
+	r := srt.NewRegistry()
+	ctx := srt.WithLabels(srt.WithRegistry(context.Background(), r), srt.Labels{"tenant": "acme"})
+	l, err := srt.ListenContext(ctx, "srt4", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	ln := l.(*srt.SRTListener)
+	d := srt.Dialer{}
+	caller, err := d.DialContext(context.Background(), "srt", ln.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer caller.Close()
+	ln.SetDeadline(time.Now().Add(10 * time.Second))
+	peer, err := ln.AcceptSRT()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer peer.Close()
+
+	agent, err := net.ListenPacket("udp4", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer agent.Close()
+	p := &Pusher{
+		Registry: r,
+		Addr:     agent.LocalAddr().String(),
+		Interval: 20 * time.Millisecond,
+		Tags:     []string{"env:test"},
+		ConnTags: func(c *srt.SRTConn) []string { return []string{"role:peer"} },
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	done := make(chan error, 1)
+	go func() { done <- p.Run(ctx) }()
+
+	// A message read by the peer is counted once.
+	if _, err := caller.Write([]byte("hello")); err != nil {
+		t.Fatal(err)
+	}
+	peer.SetReadDeadline(time.Now().Add(time.Second))
+	if _, err := peer.Read(make([]byte, 1500)); err != nil {
+		t.Fatal(err)
+	}
+	tags := "|#env:test,sid:" + strconv.Itoa(peer.SocketID()) + ",tenant:acme,role:peer"
+	var packets int64
+	rtt := false
+	agent.SetReadDeadline(time.Now().Add(5 * time.Second))
+	b := make([]byte, 2048)
+	for i := 0; i < 20; i++ {
+		n, _, err := agent.ReadFrom(b)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if n > DefaultMaxPacketSize {
+			t.Errorf("datagram of %d bytes; want at most %d", n, DefaultMaxPacketSize)
+		}
+		for _, line := range strings.Split(string(b[:n]), "\n") {
+			switch {
+			case !strings.HasSuffix(line, tags):
+				t.Fatalf("metric %q; want it tagged %s", line, tags)
+			case strings.HasPrefix(line, "srt.recv.packets:"):
+				v, err := strconv.ParseInt(strings.TrimSuffix(strings.TrimPrefix(line, "srt.recv.packets:"), "|c"+tags), 10, 64)
+				if err != nil {
+					t.Fatalf("metric %q: %v", line, err)
+				}
+				packets += v
+			case strings.HasPrefix(line, "srt.link.rtt:"):
+				if !strings.Contains(line, "|g|") {
+					t.Errorf("metric %q; want a gauge", line)
+				}
+				rtt = true
+			}
+		}
+	}
+	if packets != 1 || !rtt {
+		t.Errorf("recv.packets counted %d, link.rtt seen %v; want 1 and true", packets, rtt)
+	}
+	cancel()
+	if err := <-done; err != context.Canceled {
+		t.Errorf("Run = %v; want %v", err, context.Canceled)
+	}
+}
+
+func TestPacker(t *testing.T) {
+	pk := packer{max: 64}
+	for i := 0; i < 10; i++ {
+		pk.add("srt.1.send.packets:" + strconv.Itoa(i) + "|c")
+	}
+	pkts := pk.flush()
+	if len(pkts) < 2 {
+		t.Fatalf("%d datagrams; want the metrics split", len(pkts))
+	}
+	lines := 0
+	for _, b := range pkts {
+		if len(b) > 64 {
+			t.Errorf("datagram of %d bytes; want at most 64", len(b))
+		}
+		lines += len(strings.Split(string(b), "\n"))
+	}
+	if lines != 10 {
+		t.Errorf("%d metrics; want 10", lines)
+	}
+	if got := sanitize("a|b,c#d"); got != "a_b_c_d" {
+		t.Errorf("sanitize = %q", got)
+	}
+}
@@ -0,0 +1,71 @@
+// Copyright (c) 2020 CyberAgent, Inc. All rights reserved.
+// https://github.com/openfresh/gosrt
+
+//go:build go1.18
+// +build go1.18
+
+package streamid
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+// Stream IDs come from any caller a listener hears from.
+
+func FuzzParse(f *testing.F) {
+	for _, sid := range []string{"", "live/feed", "#!::", "#!::u=alice,r=live/feed,m=publish,x=1", "#!::r=a=b", "#!::,", "#!::=x"} {
+		f.Add(sid)
+	}
+	f.Fuzz(func(t *testing.T, sid string) {
+		keys, err := Parse(sid)
+		if err != nil {
+			return
+		}
+		formatted, err := Format(keys)
+		if err != nil {
+			// Values may hold '=', which Format refuses.
+			return
+		}
+		again, err := Parse(formatted)
+		if err != nil {
+			t.Fatalf("Parse(%q), formatted from %q: %v", formatted, sid, err)
+		}
+		for k, v := range keys {
+			if v == "" {
+				delete(keys, k)
+			}
+		}
+		if len(keys) > 0 && !reflect.DeepEqual(again, keys) {
+			t.Fatalf("%q: got %v back; want %v", sid, again, keys)
+		}
+	})
+}
+
+func FuzzParseID(f *testing.F) {
+	f.Add("#!::r=live/feed,m=publish")
+	f.Add("#!::m=bidirectional,u=")
+	f.Fuzz(func(t *testing.T, sid string) {
+		id, err := ParseID(sid)
+		if err != nil {
+			return
+		}
+		if id.Mode != ModeRequest && id.Mode != ModePublish && id.Mode != ModeBidirectional {
+			t.Fatalf("%q: got mode %q", sid, id.Mode)
+		}
+	})
+}
+
+func FuzzVerify(f *testing.F) {
+	secret := []byte("secret")
+	sid, err := Sign(secret, map[string]string{KeyUser: "alice", KeyResource: "live/feed"}, time.Unix(2000, 0))
+	if err != nil {
+		f.Fatal(err)
+	}
+	f.Add(sid)
+	f.Add("#!::u=alice.1.~")
+	f.Fuzz(func(t *testing.T, sid string) {
+		Verify(secret, sid, time.Unix(1000, 0))
+	})
+}
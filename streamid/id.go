@@ -0,0 +1,120 @@
+// Copyright (c) 2020 CyberAgent, Inc. All rights reserved.
+// https://github.com/openfresh/gosrt
+
+package streamid
+
+import (
+	"errors"
+	"strings"
+)
+
+// Mode is what the caller wants to do with the stream, the value of
+// the "m" key.
+type Mode string
+
+// Modes of the access control syntax.
+const (
+	ModeRequest       Mode = "request"       // play the stream
+	ModePublish       Mode = "publish"       // send the stream
+	ModeBidirectional Mode = "bidirectional" // both
+)
+
+// ErrMode is returned for an "m" key that isn't one of the modes.
+var ErrMode = errors.New("streamid: unknown mode")
+
+// ID is a stream ID broken down into the keys the common server
+// conventions route on.
+type ID struct {
+	User     string
+	Resource string // path of the stream, such as "live/feed"
+	Host     string
+	Session  string
+	Type     string
+	Mode     Mode // ModeRequest if empty
+
+	// Keys holds the keys other than the standard ones.
+	Keys map[string]string
+}
+
+// Publish returns the ID of publishing resource.
+func Publish(resource string) ID {
+	return ID{Resource: resource, Mode: ModePublish}
+}
+
+// Play returns the ID of playing resource.
+func Play(resource string) ID {
+	return ID{Resource: resource, Mode: ModeRequest}
+}
+
+// ParseID returns the ID of streamID. As the SRT specification
+// suggests, a stream ID not in the access control syntax is taken
+// whole as the resource to play.
+func ParseID(streamID string) (ID, error) {
+	if !strings.HasPrefix(streamID, Prefix) {
+		return ID{Resource: streamID, Mode: ModeRequest}, nil
+	}
+	keys, err := Parse(streamID)
+	if err != nil {
+		return ID{}, err
+	}
+	return FromKeys(keys)
+}
+
+// FromKeys returns the ID with the given keys, as Parse and Verify
+// return them.
+func FromKeys(keys map[string]string) (ID, error) {
+	id := ID{
+		User:     keys[KeyUser],
+		Resource: keys[KeyResource],
+		Host:     keys[KeyHost],
+		Session:  keys[KeySession],
+		Type:     keys[KeyType],
+		Mode:     Mode(keys[KeyMode]),
+	}
+	switch id.Mode {
+	case "":
+		id.Mode = ModeRequest
+	case ModeRequest, ModePublish, ModeBidirectional:
+	default:
+		return ID{}, ErrMode
+	}
+	for k, v := range keys {
+		if !isStandard(k) {
+			if id.Keys == nil {
+				id.Keys = map[string]string{}
+			}
+			id.Keys[k] = v
+		}
+	}
+	return id, nil
+}
+
+// Map returns the keys of id, as Format and Sign take them.
+func (id ID) Map() map[string]string {
+	keys := map[string]string{}
+	for k, v := range id.Keys {
+		keys[k] = v
+	}
+	keys[KeyUser] = id.User
+	keys[KeyResource] = id.Resource
+	keys[KeyHost] = id.Host
+	keys[KeySession] = id.Session
+	keys[KeyType] = id.Type
+	keys[KeyMode] = string(id.Mode)
+	return keys
+}
+
+// Format returns the stream ID of id in the access control syntax.
+func (id ID) Format() (string, error) {
+	return Format(id.Map())
+}
+
+// Publishing reports whether the caller sends the stream.
+func (id ID) Publishing() bool {
+	return id.Mode == ModePublish || id.Mode == ModeBidirectional
+}
+
+// Playing reports whether the caller receives the stream.
+func (id ID) Playing() bool {
+	return id.Mode == "" || id.Mode == ModeRequest || id.Mode == ModeBidirectional
+}
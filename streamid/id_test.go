@@ -0,0 +1,51 @@
+// Copyright (c) 2020 CyberAgent, Inc. All rights reserved.
+// https://github.com/openfresh/gosrt
+
+package streamid
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestID(t *testing.T) {
+	id := Publish("live/feed")
+	id.User = "alice"
+	id.Keys = map[string]string{"x": "1"}
+	sid, err := id.Format()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "#!::u=alice,r=live/feed,m=publish,x=1"; sid != want {
+		t.Fatalf("got %q; want %q", sid, want)
+	}
+	got, err := ParseID(sid)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, id) {
+		t.Errorf("got %+v; want %+v", got, id)
+	}
+	if !got.Publishing() || got.Playing() {
+		t.Errorf("got publishing %v, playing %v; want a publisher", got.Publishing(), got.Playing())
+	}
+}
+
+func TestParseID(t *testing.T) {
+	for _, tt := range []struct {
+		sid  string
+		want ID
+		err  error
+	}{
+		{"live/feed", Play("live/feed"), nil},
+		{"#!::r=live/feed", Play("live/feed"), nil},
+		{"#!::r=live/feed,m=bidirectional", ID{Resource: "live/feed", Mode: ModeBidirectional}, nil},
+		{"#!::r=live/feed,m=watch", ID{}, ErrMode},
+		{"#!::r", ID{}, ErrMalformed},
+	} {
+		got, err := ParseID(tt.sid)
+		if err != tt.err || !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%q: got %+v, %v; want %+v, %v", tt.sid, got, err, tt.want, tt.err)
+		}
+	}
+}
@@ -0,0 +1,109 @@
+// Copyright (c) 2020 CyberAgent, Inc. All rights reserved.
+// https://github.com/openfresh/gosrt
+
+// Package streamid composes and interprets SRT stream IDs written in
+// the access control syntax of the SRT specification,
+// "#!::key=value,key=value".
+package streamid
+
+import (
+	"errors"
+	"sort"
+	"strings"
+)
+
+// Prefix starts every stream ID in the access control syntax.
+const Prefix = "#!::"
+
+// MaxLen is the longest stream ID SRT carries, in bytes.
+const MaxLen = 512
+
+// Standard keys of the access control syntax.
+const (
+	KeyUser     = "u"
+	KeyResource = "r"
+	KeyHost     = "h"
+	KeySession  = "s"
+	KeyType     = "t"
+	KeyMode     = "m"
+)
+
+// keyOrder is the order Format writes the standard keys in.
+var keyOrder = []string{KeyUser, KeyResource, KeyHost, KeySession, KeyType, KeyMode}
+
+var (
+	// ErrNotAccessControl is returned by Parse for stream IDs that
+	// don't start with Prefix.
+	ErrNotAccessControl = errors.New("streamid: not in access control syntax")
+
+	// ErrMalformed is returned by Parse for stream IDs whose items
+	// aren't key=value pairs, and by Format for keys or values
+	// containing ',' or '='.
+	ErrMalformed = errors.New("streamid: malformed access control item")
+
+	// ErrTooLong is returned for stream IDs longer than MaxLen.
+	ErrTooLong = errors.New("streamid: longer than 512 bytes")
+)
+
+// Parse returns the keys of streamID.
+func Parse(streamID string) (map[string]string, error) {
+	if !strings.HasPrefix(streamID, Prefix) {
+		return nil, ErrNotAccessControl
+	}
+	keys := map[string]string{}
+	if len(streamID) == len(Prefix) {
+		// Format writes no keys as the bare prefix.
+		return keys, nil
+	}
+	for _, item := range strings.Split(streamID[len(Prefix):], ",") {
+		i := strings.IndexByte(item, '=')
+		if i <= 0 {
+			return nil, ErrMalformed
+		}
+		keys[item[:i]] = item[i+1:]
+	}
+	return keys, nil
+}
+
+// Format returns the stream ID with the given keys, the standard ones
+// first. Keys with empty values are left out. Keys and values must not
+// contain ',' or '='.
+func Format(keys map[string]string) (string, error) {
+	var others []string
+	for k, v := range keys {
+		if k == "" || strings.ContainsAny(k+v, ",=") {
+			return "", ErrMalformed
+		}
+		if !isStandard(k) {
+			others = append(others, k)
+		}
+	}
+	sort.Strings(others)
+	var b strings.Builder
+	b.WriteString(Prefix)
+	for _, k := range append(keyOrder[:len(keyOrder):len(keyOrder)], others...) {
+		v := keys[k]
+		if v == "" {
+			continue
+		}
+		if b.Len() > len(Prefix) {
+			b.WriteByte(',')
+		}
+		b.WriteString(k)
+		b.WriteByte('=')
+		b.WriteString(v)
+	}
+	if b.Len() > MaxLen {
+		return "", ErrTooLong
+	}
+	return b.String(), nil
+}
+
+func isStandard(k string) bool {
+	for _, s := range keyOrder {
+		if k == s {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,57 @@
+// Copyright (c) 2020 CyberAgent, Inc. All rights reserved.
+// https://github.com/openfresh/gosrt
+
+package streamid
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestFormat(t *testing.T) {
+	keys := map[string]string{"x": "1", "m": "publish", "r": "live/feed", "u": "alice", "h": ""}
+	sid, err := Format(keys)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "#!::u=alice,r=live/feed,m=publish,x=1"; sid != want {
+		t.Fatalf("got %q; want %q", sid, want)
+	}
+	got, err := Parse(sid)
+	if err != nil {
+		t.Fatal(err)
+	}
+	delete(keys, "h")
+	if !reflect.DeepEqual(got, keys) {
+		t.Errorf("got %v; want %v", got, keys)
+	}
+}
+
+func TestParseError(t *testing.T) {
+	for _, tt := range []struct {
+		sid string
+		err error
+	}{
+		{"live/feed", ErrNotAccessControl},
+		{"#!::u=alice,publish", ErrMalformed},
+		{"#!::=alice", ErrMalformed},
+	} {
+		if _, err := Parse(tt.sid); err != tt.err {
+			t.Errorf("%q: got %v; want %v", tt.sid, err, tt.err)
+		}
+	}
+	if _, err := Format(map[string]string{"u": "a,b"}); err != ErrMalformed {
+		t.Errorf("got %v; want %v", err, ErrMalformed)
+	}
+}
+
+func TestFormatEmpty(t *testing.T) {
+	sid, err := Format(map[string]string{KeyUser: ""})
+	if err != nil {
+		t.Fatal(err)
+	}
+	keys, err := Parse(sid)
+	if err != nil || len(keys) != 0 {
+		t.Errorf("Parse(%q) = %v, %v; want no keys", sid, keys, err)
+	}
+}
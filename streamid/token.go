@@ -0,0 +1,101 @@
+// Copyright (c) 2020 CyberAgent, Inc. All rights reserved.
+// https://github.com/openfresh/gosrt
+
+package streamid
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// A signed stream ID carries its token in the user key, as
+// "<user>.<expiry>.<signature>": the expiry in Unix seconds, and the
+// first 16 bytes of an HMAC-SHA256 over the user, the expiry and every
+// other key, in unpadded base64url. A server holding the secret can
+// then authenticate callers in its listen callback without keeping
+// any state.
+const sigLen = 16
+
+var (
+	// ErrNoToken is returned by Verify for stream IDs without a token.
+	ErrNoToken = errors.New("streamid: no token")
+
+	// ErrBadSignature is returned by Verify for tokens not signed with
+	// the secret, or whose stream ID was altered.
+	ErrBadSignature = errors.New("streamid: bad token signature")
+
+	// ErrExpired is returned by Verify for tokens past their expiry.
+	ErrExpired = errors.New("streamid: token expired")
+)
+
+// Sign returns the stream ID with the given keys, signed with secret
+// and valid until expires. keys must have a KeyUser.
+func Sign(secret []byte, keys map[string]string, expires time.Time) (string, error) {
+	user := keys[KeyUser]
+	if user == "" {
+		return "", ErrNoToken
+	}
+	exp := strconv.FormatInt(expires.Unix(), 10)
+	signed := make(map[string]string, len(keys))
+	for k, v := range keys {
+		signed[k] = v
+	}
+	signed[KeyUser] = user + "." + exp + "." + signature(secret, keys, exp)
+	return Format(signed)
+}
+
+// Verify checks the token of streamID against secret and the time
+// now, and returns its keys, with the plain user name as KeyUser.
+func Verify(secret []byte, streamID string, now time.Time) (map[string]string, error) {
+	keys, err := Parse(streamID)
+	if err != nil {
+		return nil, err
+	}
+	token := keys[KeyUser]
+	i := strings.LastIndexByte(token, '.')
+	if i < 0 {
+		return nil, ErrNoToken
+	}
+	j := strings.LastIndexByte(token[:i], '.')
+	if j <= 0 {
+		return nil, ErrNoToken
+	}
+	exp, sig := token[j+1:i], token[i+1:]
+	expires, err := strconv.ParseInt(exp, 10, 64)
+	if err != nil {
+		return nil, ErrNoToken
+	}
+	keys[KeyUser] = token[:j]
+	if !hmac.Equal([]byte(sig), []byte(signature(secret, keys, exp))) {
+		return nil, ErrBadSignature
+	}
+	if now.Unix() >= expires {
+		return nil, ErrExpired
+	}
+	return keys, nil
+}
+
+// signature signs keys, which hold the plain user name, and exp.
+func signature(secret []byte, keys map[string]string, exp string) string {
+	names := make([]string, 0, len(keys))
+	for k, v := range keys {
+		if v != "" {
+			names = append(names, k)
+		}
+	}
+	sort.Strings(names)
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(exp))
+	for _, k := range names {
+		// Neither ',' nor '=' can appear in keys and values, so they
+		// delimit them unambiguously.
+		mac.Write([]byte("," + k + "=" + keys[k]))
+	}
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil)[:sigLen])
+}
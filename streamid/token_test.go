@@ -0,0 +1,51 @@
+// Copyright (c) 2020 CyberAgent, Inc. All rights reserved.
+// https://github.com/openfresh/gosrt
+
+package streamid
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestToken(t *testing.T) {
+	secret := []byte("0123456789abcdef")
+	now := time.Unix(1600000000, 0)
+	keys := map[string]string{KeyUser: "alice.b", KeyResource: "live/feed", KeyMode: "publish"}
+	sid, err := Sign(secret, keys, now.Add(time.Minute))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(sid) > MaxLen {
+		t.Fatalf("stream ID %d bytes long", len(sid))
+	}
+	got, err := Verify(secret, sid, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, keys) {
+		t.Errorf("got %v; want %v", got, keys)
+	}
+
+	tests := []struct {
+		name   string
+		secret []byte
+		sid    string
+		now    time.Time
+		err    error
+	}{
+		{"expired", secret, sid, now.Add(time.Minute), ErrExpired},
+		{"wrong secret", []byte("fedcba9876543210"), sid, now, ErrBadSignature},
+		{"altered", secret, strings.Replace(sid, "live/feed", "live/other", 1), now, ErrBadSignature},
+		{"added key", secret, sid + ",x=1", now, ErrBadSignature},
+		{"unsigned", secret, "#!::u=alice,r=live/feed", now, ErrNoToken},
+		{"plain", secret, "alice", now, ErrNotAccessControl},
+	}
+	for _, tt := range tests {
+		if _, err := Verify(tt.secret, tt.sid, tt.now); err != tt.err {
+			t.Errorf("%s: got %v; want %v", tt.name, err, tt.err)
+		}
+	}
+}